@@ -0,0 +1,164 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/types"
+)
+
+// atDir is the "search/at" directory. Each child names a point in time
+// (RFC3339, a bare "YYYY-MM-DD" date, or a duration relative to now
+// such as "-2d" or "-2h") and resolves to a searchAtDir rooted at that
+// moment.
+type atDir struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node               = (*atDir)(nil)
+	_ fs.HandleReadDirAller = (*atDir)(nil)
+	_ fs.NodeStringLookuper = (*atDir)(nil)
+)
+
+func (n *atDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+func (n *atDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return []fuse.Dirent{
+		{Name: "README.txt"},
+	}, nil
+}
+
+const atReadme = `
+You are in the "search/at" directory, for browsing Perkeep's search
+results as they stood at some point in the past.
+
+Usage: cd <time>, then cd "<search query>", e.g.:
+
+	cd 2015-10-01T00:00:00Z
+	cd "is:image"
+
+<time> may be RFC3339 ("2015-10-01T00:00:00Z"), a bare date
+("2015-10-01"), or a duration relative to now ("-2d", "-2h").
+Everything below a given <time> is read-only: it's a snapshot of
+camliContent as of that moment, following only claims that existed
+by then.
+`
+
+func (n *atDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == "README.txt" {
+		return staticFileNode(atReadme), nil
+	}
+	t, err := parseAtTime(name)
+	if err != nil {
+		Logger.Printf("fs.at: Lookup(%q): %v", name, err)
+		return nil, fuse.ENOENT
+	}
+	return &searchAtDir{fs: n.fs, at: t}, nil
+}
+
+// searchAtDir holds search expressions to be evaluated as of a fixed
+// point in time. Its children are searchResultDir nodes in read-only,
+// historical mode: writes are rejected outright (see
+// searchResultDir.Remove), and a successfully seeded listing is cached
+// forever rather than subject to SearchCacheTTL (see
+// searchResultDir.haveCachedListing), since a snapshot pinned to a
+// past moment can never change underneath it. If the connected server
+// doesn't actually support point-in-time querying, ReadDirAll reports
+// fuse.EOPNOTSUPP (see atUnsupported) instead of silently falling back
+// to present-day results under a path that promised a snapshot.
+type searchAtDir struct {
+	fs *CamliFileSystem
+	at types.Time3339
+}
+
+var (
+	_ fs.Node               = (*searchAtDir)(nil)
+	_ fs.HandleReadDirAller = (*searchAtDir)(nil)
+	_ fs.NodeStringLookuper = (*searchAtDir)(nil)
+)
+
+func (n *searchAtDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+func (n *searchAtDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return nil, nil
+}
+
+func (n *searchAtDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	at := n.at
+	return &searchResultDir{
+		fs:        n.fs,
+		searchExp: name,
+		at:        &at,
+	}, nil
+}
+
+// parseAtTime parses a time specification accepted under search/at/:
+// an RFC3339 timestamp, a bare "YYYY-MM-DD" date, or a duration
+// relative to now such as "-2d" or "-2h30m".
+func parseAtTime(s string) (types.Time3339, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return types.Time3339FromTime(t), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return types.Time3339FromTime(t), nil
+	}
+	if strings.HasPrefix(s, "-") {
+		d, err := parseRelativeDuration(s[1:])
+		if err != nil {
+			return "", err
+		}
+		return types.Time3339FromTime(time.Now().Add(-d)), nil
+	}
+	return "", fmt.Errorf("fs: unrecognized time %q", s)
+}
+
+// parseRelativeDuration parses offsets like "2d" or "2h30m". The "d"
+// (day) unit isn't understood by time.ParseDuration, so it's handled
+// here and everything else is delegated.
+func parseRelativeDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("fs: bad relative duration %q: %v", s, err)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
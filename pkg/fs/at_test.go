@@ -0,0 +1,85 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestParseAtTimeFormats checks each of the three time specifications
+// search/at/ accepts: RFC3339, a bare date, and a relative duration.
+func TestParseAtTimeFormats(t *testing.T) {
+	got, err := parseAtTime("2015-10-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("parseAtTime(RFC3339) error = %v", err)
+	}
+	if want := time.Date(2015, 10, 1, 0, 0, 0, 0, time.UTC); !got.Time().Equal(want) {
+		t.Errorf("parseAtTime(RFC3339) = %v; want %v", got.Time(), want)
+	}
+
+	got, err = parseAtTime("2015-10-01")
+	if err != nil {
+		t.Fatalf("parseAtTime(bare date) error = %v", err)
+	}
+	if want := time.Date(2015, 10, 1, 0, 0, 0, 0, time.UTC); !got.Time().Equal(want) {
+		t.Errorf("parseAtTime(bare date) = %v; want %v", got.Time(), want)
+	}
+
+	before := time.Now()
+	got, err = parseAtTime("-2h")
+	if err != nil {
+		t.Fatalf("parseAtTime(relative) error = %v", err)
+	}
+	if d := before.Add(-2 * time.Hour).Sub(got.Time()); d < -time.Minute || d > time.Minute {
+		t.Errorf("parseAtTime(-2h) = %v; want close to %v", got.Time(), before.Add(-2*time.Hour))
+	}
+
+	if _, err := parseAtTime("not a time"); err == nil {
+		t.Error("parseAtTime(garbage) error = nil; want an error")
+	}
+}
+
+// TestSearchAtDirLookupPinsAt checks that a searchAtDir's Lookup
+// returns a searchResultDir whose query is pinned to the directory's
+// own at-time, the way browsing a query under search/at/<time>/ is
+// meant to.
+func TestSearchAtDirLookupPinsAt(t *testing.T) {
+	at, err := parseAtTime("2015-10-01")
+	if err != nil {
+		t.Fatalf("parseAtTime: %v", err)
+	}
+	n := &searchAtDir{fs: &CamliFileSystem{}, at: at}
+
+	got, err := n.Lookup(context.Background(), "is:image")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	dir, ok := got.(*searchResultDir)
+	if !ok {
+		t.Fatalf("Lookup() returned %T; want *searchResultDir", got)
+	}
+	if dir.searchExp != "is:image" {
+		t.Errorf("dir.searchExp = %q; want %q", dir.searchExp, "is:image")
+	}
+	if dir.at == nil || !dir.at.Time().Equal(at.Time()) {
+		t.Errorf("dir.at = %v; want %v", dir.at, at)
+	}
+}
@@ -0,0 +1,335 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/index"
+	"perkeep.org/pkg/schema"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+	"perkeep.org/pkg/sorted"
+)
+
+// searchContentDir is "search/content" (see searchDir.Lookup), which
+// answers full-text and regexp content queries over indexed files.
+//
+// There's no "content:"/"contentre:" predicate in the search
+// expression grammar for the server to evaluate, so this can't hand
+// the query off as a predicate the way "search/<expr>" hands "is:image"
+// or "after:..." to the server. Instead, Lookup runs the ordinary
+// "is:file" search and returns a contentResultDir that matches each
+// candidate's content against contentIndex, a process-local
+// pkg/index.ContentIndexer this directory builds and feeds itself as
+// it scans (see contentIndex and contentResultDir.matches). A blob
+// only gets fetched and scanned in full the first time this process
+// sees it; after that, repeat queries over the same corpus narrow
+// through the trigram index instead of rescanning every candidate.
+type searchContentDir struct {
+	fs *CamliFileSystem
+}
+
+// contentIndex is the trigram index contentResultDir reads and writes.
+// It's process-local and in-memory: it starts empty on every restart
+// and isn't shared with any other process indexing the same blobs.
+// Durable, shared indexing would mean hooking ContentIndexer into real
+// blob ingestion (see its doc comment); this tree has no ingestion
+// pipeline to hook into, so a self-populating cache here is as far as
+// this can go without fabricating one.
+var contentIndex = index.NewContentIndexer(sorted.NewMemoryKeyValue())
+
+// startCompactorOnce ensures contentIndex's background compaction loop
+// (see index.ContentIndexer.RunCompactor) is only started once, the
+// first time the "content" directory is actually used, rather than on
+// every mount whether or not content search is ever touched.
+var startCompactorOnce sync.Once
+
+func ensureCompactorRunning() {
+	startCompactorOnce.Do(func() {
+		go contentIndex.RunCompactor(context.Background(), 5*time.Minute)
+	})
+}
+
+var (
+	_ fs.Node               = (*searchContentDir)(nil)
+	_ fs.HandleReadDirAller = (*searchContentDir)(nil)
+	_ fs.NodeStringLookuper = (*searchContentDir)(nil)
+)
+
+func (n *searchContentDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+func (n *searchContentDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return []fuse.Dirent{
+		{Name: "README.txt"},
+	}, nil
+}
+
+const contentReadme = `
+You are now in the "content" filesystem, for full-text and regexp
+search over the contents of indexed text files, source code, and
+extracted PDFs.
+
+Usage: cd "<literal needle>", or cd 're:"<regexp pattern>"', e.g.:
+
+	cd "func Fetch"
+	cd 're:"handler\s*func\("'
+
+The first time a file is seen it's read in full (up to
+maxContentSearchBytes) and indexed; later queries over the same files
+only re-fetch the ones the index can't already rule in or out.
+
+`
+
+func (n *searchContentDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == "README.txt" {
+		return staticFileNode(contentReadme), nil
+	}
+	expr, isRegexp, err := parseContentQuery(name)
+	if err != nil {
+		Logger.Printf("fs.content: Lookup(%q): %v", name, err)
+		return nil, fuse.ENOENT
+	}
+	match, re, err := contentMatcher(expr, isRegexp)
+	if err != nil {
+		Logger.Printf("fs.content: Lookup(%q): %v", name, err)
+		return nil, fuse.ENOENT
+	}
+	ensureCompactorRunning()
+	return &contentResultDir{fs: n.fs, expr: expr, isRegexp: isRegexp, re: re, match: match}, nil
+}
+
+// parseContentQuery splits a "content" directory name into its query
+// text and whether it's a regexp ('re:"..."') or literal needle.
+func parseContentQuery(name string) (expr string, isRegexp bool, err error) {
+	if rest := strings.TrimPrefix(name, "re:"); rest != name {
+		unquoted, err := strconv.Unquote(rest)
+		if err != nil {
+			return "", false, fmt.Errorf("bad quoted regexp %q: %v", rest, err)
+		}
+		return unquoted, true, nil
+	}
+	return name, false, nil
+}
+
+// contentMatcher compiles expr into the predicate contentResultDir
+// tests each candidate file's content against, plus the compiled
+// regexp itself when isRegexp (so contentResultDir can also hand it to
+// contentIndex.SearchRegexp).
+func contentMatcher(expr string, isRegexp bool) (match func([]byte) bool, re *regexp.Regexp, err error) {
+	if !isRegexp {
+		needle := []byte(expr)
+		return func(text []byte) bool { return bytes.Contains(text, needle) }, nil, nil
+	}
+	re, err = regexp.Compile(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad regexp %q: %v", expr, err)
+	}
+	return re.Match, re, nil
+}
+
+// maxContentSearchBytes caps how much of each candidate file's
+// content a contentResultDir reads before giving up on matching it,
+// so one huge file can't make every lookup stall.
+const maxContentSearchBytes = 1 << 20 // 1MB
+
+// contentResultDir is the directory of indexed files whose content
+// satisfies match (see searchContentDir.Lookup). It mirrors
+// searchResultDir's caching, but its entry set comes from scanning
+// "is:file" candidates rather than directly from a search expression.
+type contentResultDir struct {
+	fs       *CamliFileSystem
+	expr     string // the literal needle, or the regexp source when isRegexp
+	isRegexp bool
+	re       *regexp.Regexp // set when isRegexp; used to query contentIndex
+	match    func([]byte) bool
+
+	mu          sync.Mutex
+	ents        map[string]*search.DescribedBlob
+	lastReaddir time.Time
+	lastNames   []string
+}
+
+var (
+	_ fs.Node               = (*contentResultDir)(nil)
+	_ fs.HandleReadDirAller = (*contentResultDir)(nil)
+	_ fs.NodeStringLookuper = (*contentResultDir)(nil)
+)
+
+func (n *contentResultDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+func (n *contentResultDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.lastReaddir.After(time.Now().Add(-searchSearchInterval)) {
+		var ents []fuse.Dirent
+		for _, name := range n.lastNames {
+			ents = append(ents, fuse.Dirent{Name: name})
+		}
+		return ents, nil
+	}
+
+	dents, err := dir.Resolve(ctx, n.fs.client, "is:file", nil)
+	if err != nil {
+		Logger.Printf("fs.content: ReadDirAll: %v", err)
+		return nil, fuse.EIO
+	}
+
+	indexMatches, err := n.matchesFromIndex(ctx)
+	if err != nil {
+		Logger.Printf("fs.content: index query failed, falling back to a full scan: %v", err)
+		indexMatches = nil
+	}
+
+	n.ents = make(map[string]*search.DescribedBlob)
+	n.lastNames = nil
+	var ents []fuse.Dirent
+	for _, de := range dents {
+		ok, err := n.matches(ctx, de.Blob, indexMatches)
+		if err != nil {
+			Logger.Printf("fs.content: reading %v: %v", de.Blob.BlobRef, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		n.ents[de.Name] = de.Blob
+		n.lastNames = append(n.lastNames, de.Name)
+		ents = append(ents, fuse.Dirent{Name: de.Name})
+	}
+	n.lastReaddir = time.Now()
+	return ents, nil
+}
+
+// contentBlobFetcher adapts a CamliFileSystem's client to
+// index.BlobFetcher, so contentIndex can verify trigram candidates
+// against real blob content.
+type contentBlobFetcher struct {
+	fs *CamliFileSystem
+}
+
+func (f contentBlobFetcher) FetchText(ctx context.Context, br blob.Ref) ([]byte, error) {
+	blobContent, err := f.fs.fetchSchemaBlobWithFailover(ctx, f.fs.client, br)
+	if err != nil {
+		return nil, err
+	}
+	fr, err := schema.NewFileReader(ctx, f.fs.client, blobContent.BlobRef())
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, fr, maxContentSearchBytes); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// matchesFromIndex runs n's query against contentIndex, returning the
+// set of blobs it already knows match. It's nil if the query can't be
+// served from the index at all (e.g. a literal shorter than a
+// trigram), in which case every candidate in ReadDirAll falls back to
+// a full fetch-and-scan via matches.
+func (n *contentResultDir) matchesFromIndex(ctx context.Context) (map[blob.Ref]bool, error) {
+	var refs []blob.Ref
+	var err error
+	if n.isRegexp {
+		refs, err = contentIndex.SearchRegexp(ctx, contentBlobFetcher{n.fs}, n.re)
+	} else {
+		refs, err = contentIndex.SearchLiteral(ctx, contentBlobFetcher{n.fs}, n.expr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[blob.Ref]bool, len(refs))
+	for _, br := range refs {
+		set[br] = true
+	}
+	return set, nil
+}
+
+// matches reports whether db's file content satisfies n.match. If
+// db's blob has already been run through contentIndex.IndexText,
+// indexMatches (from matchesFromIndex) already has the answer and
+// nothing is fetched; otherwise this fetches and scans the content
+// directly, then indexes it so a future query over this corpus can
+// skip the fetch.
+func (n *contentResultDir) matches(ctx context.Context, db *search.DescribedBlob, indexMatches map[blob.Ref]bool) (bool, error) {
+	if db.File == nil {
+		return false, nil
+	}
+	bf := contentBlobFetcher{n.fs}
+	if indexMatches != nil {
+		indexed, err := contentIndex.IsIndexed(db.BlobRef)
+		if err != nil {
+			Logger.Printf("fs.content: IsIndexed(%v): %v", db.BlobRef, err)
+		} else if indexed {
+			return indexMatches[db.BlobRef], nil
+		}
+	}
+	text, err := bf.FetchText(ctx, db.BlobRef)
+	if err != nil {
+		return false, err
+	}
+	if err := contentIndex.IndexText(ctx, db.BlobRef, text); err != nil {
+		Logger.Printf("fs.content: IndexText(%v): %v", db.BlobRef, err)
+	}
+	return n.match(text), nil
+}
+
+func (n *contentResultDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	n.mu.Lock()
+	if n.ents == nil {
+		n.mu.Unlock()
+		if _, err := n.ReadDirAll(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+	}
+	defer n.mu.Unlock()
+	db, ok := n.ents[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return &searchResultFile{node: node{fs: n.fs, blobref: db.BlobRef}}, nil
+}
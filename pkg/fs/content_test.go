@@ -0,0 +1,64 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestContentMatcherLiteral is a regression test for contentMatcher's
+// non-regexp path: it must do a plain substring test and report no
+// compiled regexp, since a literal query goes to contentIndex via
+// SearchLiteral and has no regexp to hand to SearchRegexp.
+func TestContentMatcherLiteral(t *testing.T) {
+	match, re, err := contentMatcher("needle", false)
+	if err != nil {
+		t.Fatalf("contentMatcher: %v", err)
+	}
+	if re != nil {
+		t.Errorf("re = %v; want nil for a literal query", re)
+	}
+	if !match([]byte("a needle in a haystack")) {
+		t.Errorf("match() = false; want true")
+	}
+	if match([]byte("no match here")) {
+		t.Errorf("match() = true; want false")
+	}
+}
+
+// TestContentMatcherRegexp is a regression test for contentMatcher's
+// regexp path: it must return the compiled regexp alongside match, so
+// callers can also hand it to contentIndex.SearchRegexp.
+func TestContentMatcherRegexp(t *testing.T) {
+	match, re, err := contentMatcher(`cat|dog`, true)
+	if err != nil {
+		t.Fatalf("contentMatcher: %v", err)
+	}
+	if re == nil {
+		t.Fatalf("re = nil; want a compiled regexp")
+	}
+	if !match([]byte("I have a dog")) {
+		t.Errorf("match() = false; want true")
+	}
+	if match([]byte("I have a bird")) {
+		t.Errorf("match() = true; want false")
+	}
+
+	if _, _, err := contentMatcher(`(unclosed`, true); err == nil {
+		t.Errorf("contentMatcher with a bad regexp: got nil error; want one")
+	}
+}
@@ -0,0 +1,149 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// facetDir groups a parent search result directory's entries along
+// one facet ("by-year", "by-month", "by-mime", or "by-camera"):
+// listing it enumerates the distinct values present in the parent's
+// current results. Only "year" and "month" can be looked up into
+// (see Lookup); "mime" and "camera" are listing-only until the search
+// expression language grows a predicate to drill into them with.
+type facetDir struct {
+	parent *searchResultDir
+	facet  string // "year", "month", "mime", or "camera"
+}
+
+var (
+	_ fs.Node               = (*facetDir)(nil)
+	_ fs.HandleReadDirAller = (*facetDir)(nil)
+	_ fs.NodeStringLookuper = (*facetDir)(nil)
+)
+
+func (d *facetDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *facetDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	values, err := d.parent.facetCounts(ctx, d.facet)
+	if err != nil {
+		Logger.Printf("fs.facet: ReadDirAll(%s): %v", d.facet, err)
+		return nil, fuse.EIO
+	}
+	ents := make([]fuse.Dirent, 0, len(values))
+	for v := range values {
+		ents = append(ents, fuse.Dirent{Name: v})
+	}
+	return ents, nil
+}
+
+// Lookup re-runs the parent search narrowed to name, for the facets
+// that support drilling down ("year" and "month", via a client-side
+// timeRange; see timeRange and searchResultDir.ReadDirAll). "mime"
+// and "camera" values are listable but not look-up-able: there's no
+// search expression predicate to narrow by them yet, so this returns
+// ENOENT for those rather than a directory whose search can't be
+// restricted.
+func (d *facetDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	values, err := d.parent.facetCounts(ctx, d.facet)
+	if err != nil {
+		Logger.Printf("fs.facet: Lookup(%s/%s): %v", d.facet, name, err)
+		return nil, fuse.EIO
+	}
+	if _, ok := values[name]; !ok {
+		return nil, fuse.ENOENT
+	}
+	tr, err := facetTimeRange(d.facet, name)
+	if err != nil {
+		Logger.Printf("fs.facet: Lookup(%s/%s): %v", d.facet, name, err)
+		return nil, fuse.ENOENT
+	}
+	return &searchResultDir{
+		fs:        d.parent.fs,
+		searchExp: d.parent.searchExp,
+		timeRange: tr,
+		at:        d.parent.at,
+	}, nil
+}
+
+// timeRange is a half-open [start, end) window, used to narrow a
+// searchResultDir's entries by ModTime client-side (see
+// searchResultDir.ReadDirAll) when the search expression language has
+// no predicate for what's being filtered on.
+type timeRange struct {
+	start, end time.Time
+}
+
+func (r *timeRange) contains(t time.Time) bool {
+	return !t.Before(r.start) && t.Before(r.end)
+}
+
+// facetTimeRange turns a by-year or by-month facet value (e.g. "2019"
+// or "2019-04") into the timeRange it names. "mime" and "camera"
+// have no such translation, since nothing narrows a search by them
+// yet; callers should treat their error as "drill-down unsupported"
+// rather than "bad value".
+func facetTimeRange(facet, value string) (*timeRange, error) {
+	var start, end time.Time
+	var err error
+	switch facet {
+	case "year":
+		start, end, err = yearRange(value)
+	case "month":
+		start, end, err = monthRange(value)
+	default:
+		return nil, fmt.Errorf("no drill-down defined for facet %q", facet)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad %s facet value %q: %v", facet, value, err)
+	}
+	return &timeRange{start: start, end: end}, nil
+}
+
+func yearRange(value string) (start, end time.Time, err error) {
+	y, err := strconv.Atoi(value)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start = time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(1, 0, 0), nil
+}
+
+func monthRange(value string) (start, end time.Time, err error) {
+	t, err := time.Parse("2006-01", value)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0), nil
+}
@@ -0,0 +1,79 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFacetTimeRangeContains is a regression test for the by-year/
+// by-month facet drill-down: it must narrow to exactly the named
+// year or month, since this range is applied client-side instead of
+// as a server-side predicate (see dir.Resolve's doc comment for why).
+func TestFacetTimeRangeContains(t *testing.T) {
+	tests := []struct {
+		facet, value string
+		in, out      []string // RFC3339 instants expected inside/outside the range
+	}{
+		{
+			facet: "year", value: "2019",
+			in:  []string{"2019-01-01T00:00:00Z", "2019-12-31T23:59:59Z"},
+			out: []string{"2018-12-31T23:59:59Z", "2020-01-01T00:00:00Z"},
+		},
+		{
+			facet: "month", value: "2019-02",
+			in:  []string{"2019-02-01T00:00:00Z", "2019-02-28T23:59:59Z"},
+			out: []string{"2019-01-31T23:59:59Z", "2019-03-01T00:00:00Z"},
+		},
+	}
+	for _, tt := range tests {
+		tr, err := facetTimeRange(tt.facet, tt.value)
+		if err != nil {
+			t.Fatalf("facetTimeRange(%q, %q): %v", tt.facet, tt.value, err)
+		}
+		for _, s := range tt.in {
+			if ti, err := time.Parse(time.RFC3339, s); err != nil {
+				t.Fatal(err)
+			} else if !tr.contains(ti) {
+				t.Errorf("facetTimeRange(%q, %q).contains(%s) = false; want true", tt.facet, tt.value, s)
+			}
+		}
+		for _, s := range tt.out {
+			if ti, err := time.Parse(time.RFC3339, s); err != nil {
+				t.Fatal(err)
+			} else if tr.contains(ti) {
+				t.Errorf("facetTimeRange(%q, %q).contains(%s) = true; want false", tt.facet, tt.value, s)
+			}
+		}
+	}
+}
+
+// TestFacetTimeRangeUnsupportedFacet is a regression test for
+// facetDir.Lookup's handling of "mime"/"camera": there's no predicate
+// or structured constraint to narrow a search by them yet, so
+// facetTimeRange must report that as an error rather than silently
+// returning an unrestricted (or empty) range.
+func TestFacetTimeRangeUnsupportedFacet(t *testing.T) {
+	for _, facet := range []string{"mime", "camera"} {
+		if _, err := facetTimeRange(facet, "whatever"); err == nil {
+			t.Errorf("facetTimeRange(%q, ...) = nil error; want an error", facet)
+		}
+	}
+}
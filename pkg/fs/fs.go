@@ -0,0 +1,2307 @@
+// +build linux darwin
+
+/*
+Copyright 2013 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/client"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// CamliFileSystem implements bazil.org/fuse/fs.FS over a Perkeep
+// server's search index: every searchResultDir and searchResultFile
+// in this package carries a *CamliFileSystem (as n.fs) and reads its
+// exported fields for the per-mount behavior that field controls,
+// falling back to a package-level default when the field is left at
+// its zero value. The unexported fields hold the mutable state (the
+// server connection, caches) that behavior is layered on top of.
+type CamliFileSystem struct {
+	// client is the connection to the Perkeep server this mount
+	// searches and, for the search directories that support writes,
+	// uploads new blobs to.
+	client *client.Client
+
+	// SearchCacheTTL governs how long a searchResultDir (see
+	// pkg/fs/searchResult.go) may serve a prior ReadDirAll or facet
+	// listing before re-running the search, instead of the package-level
+	// searchSearchInterval constant that used to apply to every mount
+	// alike. It's meant to be set once, before the mount is used: minutes
+	// for a read-heavy mount over stable data, zero for a mount that's
+	// being actively written to and needs every readdir to see the
+	// latest claims.
+	//
+	// A value below MinSearchCacheTTL (zero included) is raised to that
+	// floor (see clampToMinSearchCacheTTL); only with
+	// AllowSubMinimumSearchCacheTTL set does the zero value disable
+	// caching entirely, so that every ReadDirAll and facet lookup
+	// re-runs its search.
+	SearchCacheTTL time.Duration
+
+	// SearchSortBy orders the fuse.Dirents a searchResultDir's ReadDirAll
+	// returns; see the SearchSortBy type in searchsort.go.
+	SearchSortBy SearchSortBy
+
+	// SearchEndpoint is the search API URL this mount's README.txt
+	// advertises itself as querying; purely informational, it plays no
+	// part in how n.fs actually reaches the server.
+	SearchEndpoint string
+
+	// SearchDescribeDepth caps how many hops dir.ResolvePage's describe
+	// request follows from each search result permanode, to bound the
+	// size of the describe response for mounts over large, deeply nested
+	// collections. Lower it if listing a search result with big sets is
+	// slow or its describe payload is too large; raise it if sets are
+	// showing up elided (see Logger's "elided" log line) more than
+	// wanted.
+	//
+	// The zero value means defaultSearchDescribeDepth.
+	SearchDescribeDepth int
+
+	// SearchCaseInsensitiveLookup makes searchResultDir.Lookup (see
+	// pkg/fs/searchResult.go) fall back to a case-insensitive scan of its
+	// seeded entries when an exact-case lookup misses, the way a
+	// case-insensitive host filesystem or a user who doesn't recall exact
+	// casing expects "Photo.JPG" to find "photo.jpg". It's off by default
+	// so a mount behaves like the Unix filesystems it's otherwise
+	// indistinguishable from.
+	SearchCaseInsensitiveLookup bool
+
+	// MaxResults caps how many entries a searchResultDir (see
+	// pkg/fs/searchResult.go) will materialize for one search, instead of
+	// always querying without a limit. Some server configurations reject
+	// an unbounded query outright, and even one that accepts it can make
+	// "ls" on a search matching a huge fraction of the index slow or
+	// memory-hungry; MaxResults bounds that without needing to rely on
+	// the package's own, much larger maxSearchResultEntries safety net.
+	//
+	// The zero value keeps today's behavior: unbounded, up to
+	// maxSearchResultEntries. Set it to MaxResultsUnlimited to lift even
+	// that safety net. A listing cut short by MaxResults gets a synthetic
+	// ".truncated" marker entry, and README.txt reports the configured
+	// value.
+	MaxResults int
+
+	// QueryTimeout bounds how long a searchResultDir (see
+	// pkg/fs/searchResult.go) will wait on a single client.Query or
+	// fetchSchemaMeta call before giving up and returning
+	// effectiveQueryTimeoutErrno, instead of letting "ls" or a stat hang
+	// for however long the underlying HTTP client (or the kernel's own
+	// FUSE request timeout) takes to give up on its own when the server
+	// is slow or unreachable.
+	//
+	// The zero value uses defaultQueryTimeout (30s). A negative value
+	// disables the timeout entirely, leaving queries to whatever timeout,
+	// if any, the client itself applies, for an operator who has their
+	// own bound on slow-query behavior and doesn't want this package's.
+	QueryTimeout time.Duration
+
+	// CircuitBreakerEnabled makes a searchResultDir stop attempting
+	// queries for a cooldown window after several consecutive failures
+	// (see breakerFailureThreshold, breakerCooldown in
+	// pkg/fs/searchbreaker.go), so a server that's down makes every "ls"
+	// fail instantly instead of each one separately waiting out
+	// QueryTimeout. It closes again, resuming normal queries, the first
+	// time one succeeds.
+	//
+	// The zero value (false) never short-circuits: every ReadDirAll
+	// always attempts its own query.
+	CircuitBreakerEnabled bool
+
+	// ShowDotfiles makes a searchResultDir (see pkg/fs/searchResult.go)
+	// include its hidden per-directory control files (controlFileNames,
+	// plus whichever of errorsLogName/explainFileName/facetsFileName/
+	// timelineFileName/searchStatsFileName their own feature flag has
+	// enabled) in ReadDirAll's listing. They're always resolvable by name
+	// through Lookup regardless (".errors.log" aside, which
+	// DisableErrorsLog turns off outright); this only controls whether a
+	// plain "ls" (as opposed to "ls -a") shows them.
+	//
+	// The zero value (false) keeps listings exactly as they were before
+	// ".query" existed.
+	ShowDotfiles bool
+
+	// DisableErrorsLog, if set, turns errorsLogName off entirely: it's
+	// never listed (regardless of ShowDotfiles), Lookup reports it
+	// doesn't exist, and doReaddir discards n.errorLog instead of keeping
+	// it around, for a mount that has no use for the extra bookkeeping.
+	//
+	// The zero value (false) keeps errorsLogName available, as it is by
+	// default.
+	DisableErrorsLog bool
+
+	// AllowDelete makes "rm" inside a mounted search directory (see
+	// searchResultDir.Remove in pkg/fs/searchResult.go) issue a
+	// camliDeleted claim against the entry's permanode. It's destructive
+	// (the permanode, and anything only reachable through it, disappears
+	// from later searches), so the zero value (false) rejects every
+	// Remove with fuse.EPERM until a caller opts in.
+	AllowDelete bool
+
+	// Metrics receives counters for mount activity when set; see
+	// MetricsCollector in searchmetrics.go.
+	Metrics MetricsCollector
+
+	// PrefetchCount, if positive, makes a searchResultDir warm the blob
+	// cache for its this-many most-recently-modified entries in the
+	// background after each ReadDirAll that actually queries the server
+	// (not one served from cache). It's meant for a mount backing
+	// something like a slideshow, where the first open of each file would
+	// otherwise pay its own fetch latency one at a time.
+	//
+	// The zero value (0) disables prefetching entirely.
+	PrefetchCount int
+
+	// FlattenSets makes a searchResultDir expand each camliMember set it
+	// would otherwise list as a subdirectory (see searchMemberDir in
+	// pkg/fs/searchMember.go) inline instead: every member one level deep
+	// is described and added to the listing directly, named
+	// "<set>-<member>" (see flattenSetInto in pkg/fs/searchResult.go), for
+	// tools that don't walk subdirectories. Members that are themselves
+	// sets aren't expanded further.
+	//
+	// The zero value (false) preserves the existing subdirectory
+	// behavior.
+	FlattenSets bool
+
+	// DescribeRules overrides the search.DescribeRule set a
+	// searchResultDir's ReadDirAll uses (see dir.ResolvePage in
+	// pkg/search/dir/dir.go), for a custom schema whose permanodes carry
+	// attrs beyond camliContent/camliContentImage/camliMember (e.g.
+	// "location" or "album") that a caller wants included in the describe
+	// response so they can be surfaced as xattrs or used for grouping.
+	//
+	// The zero value (nil) leaves ReadDirAll's describe rules at their
+	// existing default, which is the minimum dir.Entry itself needs. A
+	// caller that sets DescribeRules to fetch extra attrs must still
+	// include those same attrs in its own rules if it wants dir.Entry's
+	// fields (Image, Members, IsSymlink, and so on) to keep resolving; a
+	// caller that just wants to add attrs without repeating the default
+	// ones should set DescribeExtraAttrs instead, which takes no effect if
+	// DescribeRules is also set.
+	//
+	// A non-nil DescribeRules must have at least one rule, and every rule
+	// at least one attr, or ReadDirAll's query would ask the server to
+	// describe nothing at all; see ValidateDescribeRules.
+	DescribeRules []*search.DescribeRule
+
+	// DescribeExtraAttrs names additional permanode attrs to fetch
+	// alongside dir.DefaultDescribeRules' own (camliContent,
+	// camliContentImage, camliMember, and the unix* attrs), for a caller
+	// that wants its custom schema's attrs included in the describe
+	// response without having to repeat the defaults DescribeRules would
+	// otherwise make it responsible for. It has no effect once
+	// DescribeRules is set, since that already fully determines the
+	// ruleset; see effectiveDescribeRulesFor.
+	DescribeExtraAttrs []string
+
+	// DedupByContent drops a later entry whose content duplicates one already
+	// listed; see searchdedup.go.
+	DedupByContent bool
+
+	// DefaultSearchExpression, if set, makes the mount's "search"
+	// directory itself behave like a searchResultDir for this expression
+	// (see searchDir.root), instead of the interactive root where "cd
+	// search/<expr>" is how a listing is reached. It's for a mount
+	// dedicated to one expression, where that extra "cd" is pure
+	// friction.
+	//
+	// The zero value ("") preserves the existing interactive behavior,
+	// including README.txt, saved searches, and the "at"/"content"
+	// subdirectories.
+	DefaultSearchExpression string
+
+	// SearchDirCacheSize caps the number of distinct searchResultDir instances
+	// kept resident at once; see searchdircache.go.
+	SearchDirCacheSize int
+
+	// NameAttribute, if set, is a permanode attribute (e.g. "title" or
+	// "camliPathSuffix") that ReadDirAll prefers over the content blob's
+	// own stored filename when building an entry's display name (see
+	// dir.ResolvePage's nameAttr). A permanode lacking the attribute
+	// falls back to the content's filename exactly as before; either way,
+	// a name that collides with one already listed still gets the usual
+	// blobref-suffix disambiguation.
+	//
+	// The zero value ("") preserves the existing filename-only behavior.
+	NameAttribute string
+
+	// FilenameNorm selects the Unicode normalization form applied to entry
+	// names; see the FilenameNorm type in searchnormalize.go.
+	FilenameNorm FilenameNorm
+
+	// ShowEmptyMarker makes a searchResultDir (see pkg/fs/searchResult.go)
+	// append emptyMarkerName to a listing that matched nothing, giving
+	// interactive browsing a visible signal that the query ran and
+	// simply had no results. It defaults to off, so scripts walking a
+	// mount see a plain empty directory rather than having to filter out
+	// the marker.
+	ShowEmptyMarker bool
+
+	// ExtraSearchClients, when non-empty, makes a searchResultDir query
+	// each of these servers with its own expression in addition to the
+	// mount's primary client, folding their results into one federated
+	// listing (see federatedEntries). Unlike the primary client, they
+	// only ever contribute their first page of results.
+	ExtraSearchClients []dir.Querier
+
+	// ValidateSearchExpr makes searchDir.Lookup probe a newly seen search
+	// expression with a zero-cost query before returning its
+	// searchResultDir, so an invalid expression fails immediately with
+	// fuse.EINVAL instead of only surfacing later as an empty, failing
+	// ReadDirAll. The zero value (false) skips validation, since it costs
+	// an extra round trip per expression.
+	ValidateSearchExpr bool
+
+	// ThumbnailSize is the longest-side dimension, in pixels, that a
+	// searchResultDir's .thumbs subdirectory asks Thumbnailer for. The
+	// zero value uses defaultThumbnailSize.
+	ThumbnailSize int
+
+	// Thumbnailer is what a searchResultDir's .thumbs subdirectory asks
+	// for each ThumbnailSize rendition; see the Thumbnailer type in
+	// searchthumbs.go.
+	Thumbnailer Thumbnailer
+
+	// FilenameSanitize selects how sanitizeFilename handles characters unsafe
+	// for the local filesystem; see the FilenameSanitize type in
+	// searchsanitize.go.
+	FilenameSanitize FilenameSanitize
+
+	// ContentIndirectionHops caps how many additional camliContent hops
+	// dir.ResolvePage follows when a result's content itself describes as
+	// a permanode instead of a file, directory, or symlink, e.g. one
+	// permanode re-sharing another's content rather than pointing
+	// straight at a file blob, or a longer chain of permanodes each
+	// pointing at the next. Entries that still don't resolve after this
+	// many hops are skipped, same as an entry with no usable camliContent
+	// at all, but counted and logged rather than silently dropped; a
+	// chain that loops back on itself is detected and stopped regardless
+	// of this setting.
+	//
+	// The zero value means defaultContentIndirectionHops. Clamped to
+	// maxContentIndirectionHops.
+	ContentIndirectionHops int
+
+	// HardlinkContent, when set, makes a searchResultFile report its inode
+	// from its content blobref (the same blobref a by-blobref content view
+	// mounted from the same CamliFileSystem would hash to via
+	// inodeTableFor) rather than from its owning permanode, and its Nlink
+	// as contentLinkCount instead of 1. Two paths naming the same content
+	// this way, one under a search result and one under a by-blobref view,
+	// then share st_ino/st_nlink exactly as two hardlinks to the same
+	// inode would, letting dedup-aware tooling recognize them as the same
+	// file without reading either.
+	//
+	// Leaving it unset keeps a searchResultFile's inode keyed by its
+	// permanode (see searchResultFile.Attr), so two permanodes that happen
+	// to share a content blobref (e.g. after a dedup import) still list as
+	// distinct inodes, matching a filesystem where "the same bytes" and
+	// "the same file identity" aren't assumed to be the same question.
+	HardlinkContent bool
+
+	// IncludeDeleted makes a searchResultDir's ReadDirAll additionally run
+	// its expression narrowed to deleted permanodes (see deletedEntries),
+	// folding the results in under a deletedSuffix name so they're clearly
+	// marked. The default, false, matches the server's own default of
+	// excluding deleted permanodes from every search.
+	//
+	// Entries surfaced this way behave like any other search result: in
+	// particular, copying one back out (or opening and re-saving it) works
+	// the same as it would for a live entry, which is the easiest way to
+	// undelete something without a dedicated recovery tool.
+	IncludeDeleted bool
+
+	// ExposeSidecars makes a searchResultDir's ReadDirAll additionally
+	// list a "<name>.meta.json" entry (see sidecarSuffix) alongside each
+	// of its results. The sidecar is always resolvable through Lookup
+	// regardless, the same way queryFileName is always resolvable
+	// regardless of CamliFileSystem.ShowDotfiles; this only controls
+	// whether a plain "ls" shows it next to the entry it describes.
+	//
+	// The zero value, false, keeps listings exactly as they were before
+	// sidecars existed.
+	ExposeSidecars bool
+
+	// RefreshDebounce is the minimum interval a searchResultDir (see
+	// pkg/fs/searchResult.go) waits after completing one ReadDirAll
+	// refresh before starting another, even if SearchCacheTTL has already
+	// expired. Unlike SearchCacheTTL, which governs how long a listing is
+	// considered fresh, RefreshDebounce exists purely to collapse a
+	// thundering herd of callers that all arrive within milliseconds of
+	// each other right as the TTL lapses: the singleflight dance in
+	// ReadDirAll already coalesces callers that overlap an in-flight
+	// refresh, but it can't help ones that arrive just after the previous
+	// refresh has already completed.
+	//
+	// The zero value defaults to SearchCacheTTL /
+	// defaultRefreshDebounceDivisor, so a mount that never configures
+	// this gets a small amount of protection for free. A mount with
+	// SearchCacheTTL of zero (every ReadDirAll re-runs its search) gets no
+	// debounce by default, since a tenth of zero is zero; set
+	// RefreshDebounce explicitly to still get the protection on such a
+	// mount.
+	RefreshDebounce time.Duration
+
+	// ReadaheadWindow is how many bytes a searchResultFile's Open handle
+	// (see rangedFileHandle) fetches and caches ahead of each read that
+	// misses its cache, so a player scrubbing through a large video file
+	// mostly hits cached data instead of re-fetching from the blobserver
+	// one bazil.org/fuse read request at a time. Tune it down for a slow
+	// or metered storage backend, where over-fetching is expensive, or up
+	// for a fast local one, where fewer, larger fetches win.
+	//
+	// The zero value defaults to defaultReadaheadWindow (1MB).
+	ReadaheadWindow int
+
+	// BlobCacheBytes caps the in-memory cache of fetched content blob bytes;
+	// see searchblobcache.go.
+	BlobCacheBytes int64
+
+	// FilenameNesting makes a '/' in a permanode's filename attribute
+	// split it into a real directory hierarchy under a searchResultDir,
+	// instead of sanitizeFilename escaping it into a single mangled
+	// component: a filename of "a/b/c.txt" shows up as c.txt inside a/b,
+	// with a and a/b materializing as plain directories of whatever's
+	// under them. It takes priority over FilenameSanitize for '/'
+	// specifically (see isIllegalFilenameRune); every other illegal rune
+	// is still handled as FilenameSanitize says.
+	//
+	// The zero value, false, keeps listings exactly as they were before
+	// nesting existed: a name with a '/' in it is sanitized like any
+	// other illegal character.
+	FilenameNesting bool
+
+	// QuerySoftBudget bounds how long a searchResultDir's ReadDirAll will
+	// keep paginating through dir.ResolvePage before giving up on fetching
+	// any further pages and returning whatever results already came back,
+	// marked incomplete with partialMarkerName. Unlike QueryTimeout (see
+	// pkg/fs/searchtimeout.go), which bounds a single query and fails the
+	// whole listing with fuse.EIO, this only ever trims a listing short,
+	// so one overly broad expression can't make "ls" feel broken.
+	//
+	// The zero value never cuts a listing short on time; only
+	// CamliFileSystem.MaxResults and maxSearchResultEntries still bound
+	// it on entry count.
+	QuerySoftBudget time.Duration
+
+	// QueryHardBudget bounds the total time a searchResultDir's
+	// ReadDirAll may spend across every page of a single listing combined
+	// (as opposed to QueryTimeout, which applies separately to each
+	// individual page). Exceeding it fails the listing with fuse.EIO,
+	// the same as QueryTimeout does for one query, rather than returning
+	// a partial result the way QuerySoftBudget does.
+	//
+	// The zero value leaves ReadDirAll to run for as long as
+	// QueryTimeout and the underlying client allow.
+	QueryHardBudget time.Duration
+
+	// Uid, if non-nil, is the owner every node under this mount reports in
+	// its Attr, in place of the mounting process's own os.Getuid(). It's
+	// for a mount served with allow_other to a different user (e.g. a
+	// service account), where the process's own uid would otherwise show
+	// up as the owner of everything.
+	//
+	// The zero value (nil) preserves the existing behavior of reporting
+	// os.Getuid().
+	Uid *uint32
+
+	// Gid is Uid's group analogue, reported in place of os.Getgid().
+	Gid *uint32
+
+	// Server, if set, is this mount's *fuse.Server (from bazil.org/fuse/fs),
+	// the same one returned by serving n.fs's connection. doReaddir uses
+	// it to push targeted kernel cache invalidations for the entries that
+	// actually changed since the previous ReadDirAll (see invalidateDiff),
+	// instead of leaving the kernel to notice only once its own attribute
+	// cache TTL expires.
+	//
+	// The zero value (nil) preserves the previous behavior of never
+	// invalidating proactively.
+	Server *fs.Server
+
+	// ExpressionAliases maps a short name, as typed under "cd" in the
+	// "search" directory, to the search expression (or to another
+	// alias's name) it stands for. It's resolved entirely client-side by
+	// searchDir.Lookup, via expandAlias, making it a lighter-weight
+	// alternative to a server-side saved search for expressions a user
+	// doesn't want to keep retyping. A saved search sharing an alias's
+	// name takes precedence, the same way it does over a literal
+	// expression.
+	//
+	// The zero value (nil) disables aliasing entirely.
+	ExpressionAliases map[string]string
+
+	// CollisionSuffixLen is how many characters of a blob's own
+	// algorithm+digest string resolveDegraded's collision handling starts
+	// from when disambiguating two entries that would otherwise share a
+	// name. It only sets the starting point: a directory big enough that
+	// even that much of the string still collides gets progressively more
+	// of it, rather than silently dropping the entry (see
+	// uniqueCollisionName).
+	//
+	// The zero value keeps the historical fixed length of 10.
+	CollisionSuffixLen int
+
+	// RefreshPolicy selects how a searchResultDir's ReadDirAll decides a
+	// cached listing is stale (see the RefreshPolicy type for the
+	// tradeoffs of each value).
+	//
+	// The zero value (RefreshPolicyTTL) preserves the existing
+	// TTL/debounce-based behavior.
+	RefreshPolicy RefreshPolicy
+
+	// VerifyReads, if set, makes searchResultFile.Open re-hash a file's
+	// content against its own blobref before serving it, returning
+	// fuse.EIO on a mismatch instead of handing back silently corrupted
+	// data. It's off by default: verifying costs a full extra streamed
+	// fetch of the content on every open, on top of whatever the actual
+	// read ends up fetching.
+	VerifyReads bool
+
+	// CollapseSingletonSets makes a searchResultDir surface a camliMember
+	// set's sole member directly, under the set's own display name,
+	// instead of listing the set as a one-entry subdirectory (see
+	// collapseSingletonSetInto in pkg/fs/searchResult.go), for imported
+	// single-item albums where the extra level of nesting has no value. A
+	// set with zero or more than one member keeps its normal subdirectory
+	// representation, as does a singleton set whose sole member doesn't
+	// resolve to a file or directory (e.g. it's itself a set, or its
+	// describe depth didn't reach it).
+	//
+	// Checked after CamliFileSystem.FlattenSets: a set caught by both
+	// takes the FlattenSets expansion, not this collapse.
+	//
+	// The zero value (false) preserves the existing subdirectory
+	// behavior.
+	CollapseSingletonSets bool
+
+	// RecentWindow is how far back recentDirName's built-in query looks
+	// for permanodes modified since, e.g. 24 * time.Hour for "the last
+	// day". The zero value uses defaultRecentWindow (30 days).
+	RecentWindow time.Duration
+
+	// IncludeContentless makes a searchResultDir list a permanode with
+	// neither a camliContent nor a camliMember attribute (e.g. a
+	// pure-metadata permanode like a contact) as a zero-byte, read-only
+	// file named and timestamped the same way an untitled set is (see
+	// contentlessEntry in pkg/search/dir/dir.go), instead of silently
+	// dropping it from the listing as doReaddir always did before this
+	// option existed.
+	//
+	// The zero value (false) preserves that existing behavior.
+	IncludeContentless bool
+
+	// AllowMkdir makes "mkdir" inside a mounted search directory (see
+	// searchResultDir.Mkdir) create a new, empty set permanode, titled
+	// after the requested name. It's opt-in the same way AllowDelete is:
+	// the zero value (false) rejects every Mkdir (see
+	// effectiveUnsupportedErrno(UnsupportedFeatureOff), fuse.EPERM by
+	// default), since a mount that never expected to originate permanodes
+	// shouldn't start just because something ran "mkdir".
+	AllowMkdir bool
+
+	// GroupByAttribute, if set, is a permanode attribute (e.g. "album")
+	// that replaces a search result directory's flat listing with one
+	// subdirectory per distinct value of that attribute (plus
+	// ungroupedBucketName, for names whose permanode doesn't carry it at
+	// all), the same way byTagTreeDirName already facets by "tag" as a
+	// sibling view rather than the primary one. It's added to the
+	// describe rule automatically, the same as NameAttribute (see
+	// dir.ResolvePage's groupAttr), so there's no need to also list it in
+	// DescribeRules.
+	//
+	// A name is still directly reachable by Lookup whether or not it
+	// shows up in the grouped ReadDirAll listing.
+	//
+	// The zero value ("") preserves the existing flat-listing behavior.
+	GroupByAttribute string
+
+	// QueryTimeoutErrno is the errno a query that exceeds QueryTimeout
+	// fails with, in place of the default fuse.EIO; see
+	// effectiveQueryTimeoutErrno. Useful for a caller that wants to tell
+	// "the server said no" (mapped to some other errno by queryErrno)
+	// apart from "the server took too long", e.g. by setting this to
+	// syscall.ETIMEDOUT.
+	//
+	// The zero value (fuse.Errno(0), not a real error) means fuse.EIO.
+	QueryTimeoutErrno fuse.Errno
+
+	// MIMEPreference orders the MIME types a permanode with more than one
+	// camliContent candidate (e.g. an original RAW alongside a derived
+	// JPEG) should be resolved to, trying each type in turn; see
+	// dir.ResolvePage's mimePreference parameter and
+	// preferredCamliContent. The chosen candidate, when more than one was
+	// available, is logged by dir.
+	//
+	// Put "image/jpeg" first to prefer a browsable derivative, or a RAW
+	// MIME type first (e.g. "image/x-canon-cr2") to prefer the original.
+	//
+	// The zero value (nil) preserves today's behavior of always resolving
+	// to the most recently claimed camliContent, the same as before this
+	// field existed.
+	MIMEPreference []string
+
+	// DisableExplainFile, if set, turns explainFileName off entirely:
+	// it's never listed (regardless of ShowDotfiles) and Lookup reports
+	// it doesn't exist, for a mount that doesn't want its query shape
+	// exposed this way.
+	//
+	// The zero value (false) keeps explainFileName available, as it is
+	// by default.
+	DisableExplainFile bool
+
+	// BlockSize, if set, overrides defaultBlockSize as the value
+	// searchResultFile.Attr reports for fuse.Attr.BlockSize, the block
+	// size a client is encouraged to align its reads to. Tuning it to
+	// match a mount's actual chunker output (see mkdir's -blobSize, when
+	// the blobs were written) lets a client that respects it avoid
+	// fetching one blob twice over two overlapping partial reads.
+	//
+	// The zero value leaves defaultBlockSize in effect.
+	BlockSize uint32
+
+	// ExpressionRewriter, if set, is applied to every search expression
+	// before it's used, in searchDir.Lookup (via rewriteExpression) and
+	// for CamliFileSystem.DefaultSearchExpression: a mount-wide
+	// integration point for policy enforcement (e.g. always ANDing in
+	// "owner:me") or expanding an admin-defined shorthand, without
+	// touching the expression-parsing and query paths themselves. An
+	// error from it fails the lookup with fuse.EINVAL, the same as a
+	// malformed expression caught by ValidateSearchExpr.
+	//
+	// The zero value (nil) leaves every expression as given.
+	ExpressionRewriter func(string) (string, error)
+
+	// ExposeHistory makes a searchResultDir's ReadDirAll additionally
+	// list a "<name>.history" directory (see historySuffix) alongside
+	// each of its results, and makes Lookup resolve it for any currently
+	// known entry. Its contents (see claimHistoryDir) are only fetched the
+	// first time it's read or looked into, not eagerly alongside the
+	// entry itself.
+	//
+	// The zero value, false, keeps listings exactly as they were before
+	// history directories existed.
+	ExposeHistory bool
+
+	// PersistentNames makes stableName consult and update an on-disk
+	// mapping (see CamliFileSystem.PersistentNamesPath) from permanode to
+	// display name, shared across remounts, instead of only pinning names
+	// for the lifetime of one searchResultDir (see n.stableNames). This
+	// matters for anything outside the mount that records a FUSE path --
+	// a symlink, an external tool's own index -- since without it, two
+	// permanodes that collide on the same base name can swap which one
+	// keeps the plain name across a remount, depending on the order the
+	// backend happens to return them in.
+	//
+	// The zero value (false) keeps names pinned only in memory, as they
+	// were before PersistentNames existed.
+	PersistentNames bool
+
+	// PersistentNamesPath is the JSON file PersistentNames reads from and
+	// writes to. It's specific to one mount: two mounts configured with
+	// the same path would fight over the same names, so each mount with
+	// PersistentNames set needs its own.
+	//
+	// The zero value ("") disables PersistentNames even if it's set,
+	// logging once rather than picking an implicit location.
+	PersistentNamesPath string
+
+	// PersistentNamesMaxAge bounds how long a PersistentNamesPath entry
+	// survives without being reconfirmed by a ReadDirAll before
+	// persistentNameStore.gc drops it, for content that's since been
+	// deleted or stopped matching the search expressions that once
+	// surfaced it.
+	//
+	// The zero value uses defaultPersistentNamesMaxAge.
+	PersistentNamesMaxAge time.Duration
+
+	// Owner, if set, scopes every searchResultDir's query to permanodes
+	// signed by this blobref, ANDed into the expression as an
+	// "owner:<Owner>" term (see effectiveSearchExpr) so a shared,
+	// multi-user index only surfaces a mount's own content by default
+	// instead of every owner's. A searchDirOptions "owner" override (see
+	// splitSearchOptions) takes priority over this for the one directory
+	// it's set on.
+	//
+	// The zero value ("") applies no owner scoping, matching behavior
+	// from before this field existed.
+	Owner string
+
+	// QueryConcurrency caps how many search queries a mount has
+	// outstanding at once (see queryLimiter): a ReadDirAll beyond the
+	// limit blocks until an earlier one finishes, or its context is done,
+	// in which case it fails the same way a query that exceeded
+	// QueryTimeout would (see effectiveQueryTimeoutErrno).
+	//
+	// The zero value defaults to defaultQueryConcurrency (8).
+	QueryConcurrency int
+
+	// PinnedExpressions, if non-empty, makes the mount pre-resolve each
+	// expression's searchResultDir in the background as soon as it's
+	// touched (see warmupPinnedExpressions), refreshing it on its own
+	// SearchCacheTTL thereafter so the first real "cd" into one of them
+	// already has a warm cache instead of paying that query's latency
+	// itself. Each one also appears in the top-level searchDir listing,
+	// the same way a saved search or expression alias does (see
+	// searchDir.ReadDirAll), using its own expression text as its name.
+	//
+	// Warming up respects CamliFileSystem.QueryConcurrency the same way
+	// any other ReadDirAll does, since it queries through the same
+	// searchResultDir.ReadDirAll path; a mount with many pinned
+	// expressions and a small QueryConcurrency just takes longer to warm
+	// them all.
+	//
+	// The zero value (nil) warms up nothing, preserving the existing
+	// lazy, on-demand resolution of every searchResultDir.
+	PinnedExpressions []string
+
+	// CollisionDirPriority, when set, makes a same-page name collision
+	// between a directory-content entry (a set, or a permanode whose
+	// camliContent resolved to a directory schema blob; see
+	// isDirLikeEntry) and anything else resolve in the directory's favor:
+	// the directory keeps its unsuffixed name, and whatever else wanted it
+	// is the one stableName suffixes instead (see stableCollisionName).
+	// This works by processing every directory-like entry in a page before
+	// any other entry (see prioritizeDirEntries), so it only resolves a
+	// collision within the page doReaddir is currently handling; a
+	// collision spanning two different pages of the same paginated search
+	// still resolves first-seen-wins, since doing better would mean
+	// buffering every page before naming anything.
+	//
+	// The zero value (false) keeps the historical first-seen-wins
+	// behavior, where whichever entry stableName processes first claims
+	// the plain name regardless of type.
+	CollisionDirPriority bool
+
+	// FollowCamliPath makes a search result permanode carrying one or
+	// more camliPath:* attrs (see hasCamliPathAttrs) list as a camliPathDir
+	// of those named children instead of whatever its camliContent or
+	// camliMember would otherwise resolve it to; doReaddir checks it ahead
+	// of IsSet, so a permanode that happens to be both a set and
+	// camliPath-tagged is treated as the latter.
+	//
+	// The zero value (false) keeps listings exactly as they were before
+	// camliPath following existed.
+	FollowCamliPath bool
+
+	// MemberExpandDepth raises the describe depth used specifically to
+	// pre-populate nested camliMember sets (see
+	// effectiveSearchDescribeDepth), so that browsing a set-of-sets
+	// hierarchy several levels deep doesn't cost one query per level: a
+	// set whose own members came back described at construction time
+	// lists immediately, rather than needing its own ReadDirAll/Lookup
+	// round trip first.
+	//
+	// A set nested deeper than the effective depth reaches is still
+	// listed once dir.ResolvePage's own describe sees at least one of its
+	// immediate members (see dir.ResolvePage's "elided" behavior); beyond
+	// that, and for any member's own content, resolution falls back to
+	// the same per-member, on-access describe searchMemberDir.Lookup
+	// always does, regardless of this setting. Raising MemberExpandDepth
+	// only changes how much of the hierarchy arrives pre-resolved, never
+	// what's reachable.
+	//
+	// The zero value leaves the describe depth exactly at
+	// SearchDescribeDepth (or defaultSearchDescribeDepth). A value above
+	// maxMemberExpandDepth is capped to it.
+	MemberExpandDepth int
+
+	// SearchSortBy, SortAttr and SortAttrNumeric together configure
+	// SearchSortByAttr: SortAttr names the permanode attr to sort by (e.g.
+	// "rating" or "sequence"), and SortAttrNumeric says whether its values
+	// should be compared as parsed floats rather than as strings. Both are
+	// ignored unless SearchSortBy is SearchSortByAttr. Like SearchSortBy
+	// itself, either can instead be pinned per directory via an
+	// attrSortDirPrefix Lookup, without changing the mount's own config;
+	// see effectiveSortAttr.
+	SortAttr string
+
+	// SearchSortBy, SortAttr and SortAttrNumeric together configure
+	// SearchSortByAttr: SortAttr names the permanode attr to sort by (e.g.
+	// "rating" or "sequence"), and SortAttrNumeric says whether its values
+	// should be compared as parsed floats rather than as strings. Both are
+	// ignored unless SearchSortBy is SearchSortByAttr. Like SearchSortBy
+	// itself, either can instead be pinned per directory via an
+	// attrSortDirPrefix Lookup, without changing the mount's own config;
+	// see effectiveSortAttr.
+	SortAttrNumeric bool
+
+	// ShowHidden makes a searchResultDir (see pkg/fs/searchResult.go)
+	// include, in ReadDirAll's listing, content filenames (as opposed to
+	// the hidden control files ShowDotfiles governs) that happen to begin
+	// with a dot, the same as matched permanodes were named or
+	// disambiguated to. A dot-prefixed content name is always resolvable
+	// by explicit Lookup regardless of ShowHidden, the same way
+	// ShowDotfiles's own hidden files are; this only controls whether a
+	// plain "ls" (as opposed to "ls -a") shows them.
+	//
+	// The zero value (false) hides such entries, matching how a typical
+	// Unix file manager treats a dotfile.
+	ShowHidden bool
+
+	// ModTimeAttrs, if non-empty, is a prioritized list of permanode
+	// attribute names (e.g. "dateTaken", "startDate") to consult for an
+	// entry's modtime before falling back to dir.Entry.ModTime's own
+	// choice (the file schema's embedded time, or "unixMtime" if that's
+	// absent, or the time the listing ran if neither is). The first
+	// attribute in the list actually present on an entry's permanode
+	// (parsed as a types.Time3339) wins; an attribute present but
+	// unparseable is treated the same as absent, falling through to the
+	// next one. entryModTime applies it in doReaddir wherever a
+	// dir.Entry's own ModTime would otherwise be used verbatim.
+	//
+	// The zero value (nil) leaves every entry's modtime exactly as
+	// dir.Entry.ModTime already computed it.
+	ModTimeAttrs []string
+
+	// CollisionStrategy picks which of CollisionStrategyBlobSuffix (the
+	// zero value, and historical behavior), CollisionStrategyNumericSuffix,
+	// or CollisionStrategySubdirByBlobRef stableName uses when two
+	// permanodes want the same display name.
+	CollisionStrategy CollisionStrategy
+
+	// AllowReindexHint permits reindexHintFileName to be looked up, so a
+	// write to it can ask the server to enqueue indexing (see Reindexer).
+	// Off by default, like AllowDelete, since it's an operation that
+	// reaches out and touches server state rather than just reading it.
+	AllowReindexHint bool
+
+	// RenditionAttrs, if set, maps a permanode attribute name (holding a
+	// blobref to a derived rendition of that permanode's own content, e.g.
+	// a transcoded video or a resized image) to the view name ReadDirAll
+	// exposes it under: a sibling entry named "<base><delimiter><view>"
+	// (see CamliFileSystem.RenditionDelimiter), e.g. "clip@720p.mp4" for
+	// {"rendition720p": "720p"}. An entry whose permanode has none of the
+	// configured attrs is unaffected; one with several gets a sibling per
+	// resolved attr.
+	//
+	// Unlike NameAttribute and GroupByAttribute, a rendition attribute's
+	// value doesn't need to be listed in CamliFileSystem.DescribeRules:
+	// its target is resolved with its own direct describe (see
+	// describeRendition), the same recovery fallbackContentMeta already
+	// uses for an entry whose own camliContent didn't come back described
+	// within the query's depth.
+	//
+	// The zero value (nil) preserves the existing behavior of never
+	// exposing renditions.
+	RenditionAttrs map[string]string
+
+	// RenditionDelimiter is the separator ReadDirAll puts between an
+	// entry's base name and its rendition's view name (see
+	// CamliFileSystem.RenditionAttrs). Configurable so a view name that
+	// happens to collide with a real filename's own "@"-delimited
+	// convention, if any, can be moved out of the way.
+	//
+	// The zero value ("") means defaultRenditionDelimiter.
+	RenditionDelimiter string
+
+	// LookupFreshness bounds how long Lookup may answer a direct stat
+	// against a searchResultFile already backed by n.ents without
+	// re-running n's search, independent of SearchCacheTTL: unlike a
+	// plain "ls" (ReadDirAll), a correctness-sensitive caller opening a
+	// path directly wants that open to reflect reasonably fresh index
+	// state even if nothing has triggered a readdir recently. Lookup
+	// checks this the same way ReadDirAll checks SearchCacheTTL (see
+	// haveCachedListing), and forces a refresh if the cached listing is
+	// older.
+	//
+	// The zero value means EffectiveSearchCacheTTL: a mount that never
+	// sets LookupFreshness keeps Lookup's existing behavior of going
+	// stale at the same rate ReadDirAll already does, rather than never
+	// refreshing on its own as Lookup did before this field existed. Set
+	// it shorter than SearchCacheTTL to trade some Lookup latency for
+	// tighter freshness on direct-path access specifically.
+	LookupFreshness time.Duration
+
+	// LargeListingWarnThreshold, if positive, makes doReaddir log (and
+	// record in errorsDirName) a warning whenever a searchResultDir's
+	// listing reaches at least this many entries. fs.HandleReadDirAller
+	// already hands bazil.org/fuse the complete entry slice and lets it
+	// page that across as many kernel readdir replies as the calling
+	// process needs, so no entry is ever dropped the way MaxResults or
+	// QuerySoftBudget can trim one short; this only flags a listing that's
+	// grown large enough to be worth narrowing (with MaxResults,
+	// FilenameNesting, or GroupByAttribute) before it gets unwieldy to
+	// browse.
+	//
+	// The zero value never warns.
+	LargeListingWarnThreshold int
+
+	// StrictExpressionMacros, if true, makes expandExpressionMacros reject
+	// an expression containing a "${...}" macro token it doesn't
+	// recognize, failing the Lookup with fuse.EINVAL instead of leaving
+	// the unrecognized token in place for the search server to (most
+	// likely) reject on its own with a less helpful error.
+	//
+	// The zero value passes an unrecognized macro through unchanged.
+	StrictExpressionMacros bool
+
+	// MIMETypeXattrName, if set, is an additional extended attribute name
+	// camliXattrs exposes a searchResultFile's resolved MIME type (the
+	// same value already under "user.camli.mime") under, so a file
+	// manager that only knows to check its own desktop-specific xattr
+	// (e.g. "user.mime_type") can pick the right icon without opening the
+	// file to sniff its type.
+	//
+	// An entry whose MIME type isn't known (n.mimeType == "") gets this
+	// xattr set to defaultMIMEType, the same fallback "user.camli.mime"
+	// itself reports.
+	//
+	// The zero value ("") exposes no xattr beyond "user.camli.mime".
+	MIMETypeXattrName string
+
+	// MIMEClassDirs, if set, overrides defaultMIMEClassDirs: it maps a
+	// reserved subdirectory name under a searchResultDir to the predicate
+	// term childExprDir ANDs onto that directory's own expression, so
+	// "ls search/<expr>/images" is equivalent to "ls search/<expr and
+	// is:image>" without typing the predicate out. Like byDateDirName and
+	// facetOnlyDirNames, these names are only ever resolved via Lookup;
+	// they don't appear in a plain "ls" of their parent.
+	//
+	// Unlike those, a real entry already named "images" (or whatever
+	// overrides it) takes precedence over the shorthand, the same way a
+	// real entry named like a sort:<key> directive does (see
+	// searchResultDir.Lookup): a shorthand is only useful for browsing
+	// into, so it never needs to win against an actual file or set.
+	//
+	// The zero value (nil) uses defaultMIMEClassDirs.
+	MIMEClassDirs map[string]string
+
+	// CredentialRefresher, if set, is called by doReaddir to
+	// re-authenticate n.fs's search client when a query fails with what
+	// queryErrno classifies as an auth failure (fuse.EACCES), before
+	// giving up and surfacing that failure to the caller. If it returns
+	// nil, doReaddir retries the query once more; if it returns an error
+	// (logged distinctly from the original query failure), the original
+	// auth failure is what's returned, the same as if CredentialRefresher
+	// were unset.
+	//
+	// Concurrent auth failures across this CamliFileSystem's
+	// searchResultDirs only ever run one refresh at a time (see
+	// refreshCredentials): the caller that finds none already running
+	// starts one and owns it; every other caller waits for it and shares
+	// its outcome instead of each re-authenticating redundantly, exactly
+	// like lookupTargetedOnce dedupes concurrent targeted lookups.
+	//
+	// The zero value (nil) never refreshes; an auth failure is reported
+	// to the caller as fuse.EACCES immediately, as before.
+	CredentialRefresher func(ctx context.Context) error
+
+	// WebUIBaseURL, if set, is the base URL of the Perkeep web UI this
+	// mount's server exposes (e.g. "http://localhost:3179/ui/"), used to
+	// build webURLSuffix's "foo.url" sibling files: its own trailing
+	// slash trimmed, then "/" and the entry's permanode blobref appended.
+	//
+	// The zero value ("") leaves webURLSuffix unresolvable; see
+	// ExposeWebURLFiles for whether it's also listed in a plain "ls".
+	WebUIBaseURL string
+
+	// ExposeWebURLFiles makes a searchResultDir's ReadDirAll additionally
+	// list a "<name>.url" entry (see webURLSuffix) alongside each of its
+	// results, once CamliFileSystem.WebUIBaseURL is also set. The file is
+	// always resolvable through Lookup regardless, the same way
+	// sidecarSuffix is controlled by ExposeSidecars; this only controls
+	// whether a plain "ls" shows it next to the entry it links to.
+	//
+	// The zero value, false, keeps listings exactly as they were before
+	// web UI URL files existed.
+	ExposeWebURLFiles bool
+
+	// DeterministicListing makes doReaddir stable-sort a query's results
+	// by deterministicSortKey before naming them, so the same index state
+	// always yields a byte-identical listing regardless of the order the
+	// server happened to return results in. stableName's own collision
+	// suffixes (see stableCollisionName) are already a deterministic
+	// function of a permanode's own blobref; what isn't, without this,
+	// is which of two colliding permanodes gets to keep the bare name,
+	// since that's decided by whichever one doReaddir sees first.
+	//
+	// This is a test-only affordance, for golden-file tests asserting on
+	// a mount's exact listing: it says nothing about how a real search's
+	// results should be ordered for a human browsing them (see
+	// SearchSortBy for that), only about making repeat runs agree with
+	// each other.
+	//
+	// The zero value, false, keeps listings ordered exactly as the server
+	// returned them, as before.
+	DeterministicListing bool
+
+	// ChecksumXattrName, if set, is an additional extended attribute name
+	// camliXattrs exposes a searchResultFile's content digest under (see
+	// checksumDigest), for a backup-verification tool that wants the hash
+	// without reading the file: n.blobref (already under
+	// "user.camli.camliContent") is the file's schema blob's own digest,
+	// not its content's, so this is derived separately, from the
+	// schema's single content part when there is exactly one.
+	//
+	// The zero value ("") exposes no such xattr.
+	ChecksumXattrName string
+
+	// BlobFetchRetryMax bounds how many times a rangedFileHandle will
+	// retry a single blob fetch (see refillLocked) before giving up and
+	// surfacing fuse.EIO, once isTransientBlobErr says the failure is
+	// worth retrying at all. Backoff between attempts follows
+	// blobRetryDelay, the same doubling schedule queryRetryDelay uses for
+	// page queries.
+	//
+	// The zero value defaults to defaultBlobFetchRetryMax (3).
+	BlobFetchRetryMax int
+
+	// StableIDNames makes doReaddir name each entry after its own
+	// permanode's blobref (see stableIDName) instead of its human
+	// filename, for a programmatic consumer that needs an absolutely
+	// stable, collision-free identifier rather than something readable.
+	// Since two different permanodes never share a blobref, this bypasses
+	// stableName's own collision handling (see CollisionStrategy)
+	// entirely: there's nothing left for it to resolve. The human name,
+	// when it differs from the blobref name, is still available through
+	// the existing user.camli.originalName xattr, the same one
+	// truncateFilename already uses for a name it had to shorten.
+	//
+	// Lookup needs no special casing for this: whichever name doReaddir
+	// decided on is the one stored in n.ents/n.permanode/etc., and that's
+	// what Lookup resolves against either way.
+	//
+	// The zero value, false, keeps entries named after their human
+	// filename, as before.
+	StableIDNames bool
+
+	// DescribeProcessingBudget bounds how long a searchResultDir's
+	// ReadDirAll will spend resolving a single page's worth of entries
+	// (sets, symlinks, xattrs, renditions, and everything else the
+	// per-entry loop does) before giving up on the rest of that page and
+	// returning whatever it already resolved, marked incomplete with
+	// partialMarkerName, the same way QuerySoftBudget does. Unlike
+	// QuerySoftBudget, which only ever fires between pages, this is
+	// checked within a single page's own entry loop, so it protects
+	// against a describe response that comes back quickly but is simply
+	// enormous to process.
+	//
+	// The zero value never cuts entry processing short on time; only
+	// CamliFileSystem.MaxResults and maxSearchResultEntries still bound it
+	// on entry count.
+	DescribeProcessingBudget time.Duration
+
+	// NamedSearchesConfigFile, if set, names a JSON file mapping directory
+	// names to search expressions, with optional per-entry limit/sort/ttl
+	// overrides (the same shape camlifsFileName's own write takes; see
+	// namedSearchView), loaded once at first use (see namedSearchesFor)
+	// and presented by searchDir as a curated dashboard of saved views
+	// instead of its usual saved-search/alias/pinned-expression listing.
+	// A SIGHUP to the process reloads every mount's config file in place,
+	// so changes don't require a remount.
+	//
+	// Unless the config's own "strict" key is true, a name not found
+	// among its views still falls back to searchDir's ordinary
+	// raw-expression Lookup, the same as if NamedSearchesConfigFile were
+	// unset; in strict mode, an unknown name is fuse.ENOENT instead.
+	//
+	// The zero value ("") leaves searchDir's listing and Lookup behaving
+	// as they always have.
+	NamedSearchesConfigFile string
+
+	// FilenameControlChars selects stripControlChars' replacement policy
+	// for control characters (including newlines) in a name derived from a
+	// permanode attribute. The zero value, ControlCharPolicyNone, leaves
+	// such names as they came, matching the historical behavior.
+	FilenameControlChars ControlCharPolicy
+
+	// OpenAheadCount, if positive, makes searchResultFile.Open warm the
+	// shared blob cache (see blobCacheFor) for this many of its parent
+	// directory's entries immediately following it in the listing order
+	// most recently returned by ReadDirAll, the same way a slideshow
+	// advancing through a directory one file at a time would otherwise
+	// pay each entry's own fetch latency one at a time. Unlike
+	// PrefetchCount (see searchprefetch.go), which warms a whole
+	// directory's top entries right after it's listed regardless of
+	// whether any of them are ever opened, this only ever warms relative
+	// to a file actually being opened, so it adapts to wherever browsing
+	// currently is rather than always favoring the most recently
+	// modified entries.
+	//
+	// The zero value (0) disables open-ahead warming entirely.
+	OpenAheadCount int
+
+	// UndescribedContentPolicy selects what dir.ResolvePage does with an entry
+	// whose camliContent describe meta never came back; see the
+	// UndescribedContentPolicy type in searchundescribed.go.
+	UndescribedContentPolicy UndescribedContentPolicy
+
+	// Audit receives structured mount-activity events (query execution, file
+	// opens, delete claims) when set; see AuditSink and auditFor in
+	// searchaudit.go.
+	Audit AuditSink
+
+	// SymlinkContent, when set, makes entryNode represent a set or plain
+	// content entry as a byBlobRefSymlink into this mount's own
+	// by-blobref view instead of resolving it to its own directory or
+	// file node.
+	SymlinkContent bool
+
+	// SymlinkImagesToOriginal is SymlinkContent's image-only counterpart:
+	// it symlinks just the entries entryNode would otherwise resolve as
+	// an image (e.Image != nil, the same check imageMeta is populated
+	// from), leaving every other kind of result as its usual file or
+	// directory node. It's for a caller that wants stat-stable,
+	// inode-less identity for photos specifically, without turning every
+	// other result in the same directory into a symlink too.
+	//
+	// It must not be combined with Thumbnailer or ExposeSidecars: both
+	// describe an image's own derived content (a resized rendition, a
+	// resolved-metadata sidecar), which a symlinked entry no longer
+	// meaningfully has once following it lands on the original instead of
+	// anything this mount derived from it. See ValidateImageSymlinks.
+	SymlinkImagesToOriginal bool
+
+	// RelativeSymlinkTargets, when SymlinkContent is set, makes a
+	// byBlobRefSymlink's target a path relative to this mount's own root
+	// ("search/<blobref>") rather than one rooted at MountPoint, so the
+	// mount can be relocated to a new path without rewriting every
+	// symlink it already handed out, at the cost of the link only
+	// resolving correctly from somewhere under the mount itself (e.g. a
+	// portable archive of the mount's own tree) rather than from
+	// anywhere on the host.
+	//
+	// The zero value reports an absolute target instead, the simplest
+	// behavior for a mount whose path never changes: see
+	// blobRefSymlinkTarget.
+	RelativeSymlinkTargets bool
+
+	// MountPoint is the absolute path this filesystem is mounted at, used
+	// by blobRefSymlinkTarget to build an absolute byBlobRefSymlink target
+	// (MountPoint joined with the mount-relative one) when
+	// RelativeSymlinkTargets is unset. Leaving it empty produces a target
+	// rooted at "/" instead, which still resolves correctly from anywhere
+	// under the mount but, unlike one that's actually rooted at
+	// MountPoint, not from outside it.
+	MountPoint string
+
+	// DirMode, if set, overrides a directory node's own hardcoded default
+	// permission bits (searchDir.Attr's 0500, searchResultDir.Attr's
+	// 0555) with the same value everywhere, for an admin who wants a
+	// stricter or more permissive view than this mount's defaults.
+	//
+	// The zero value leaves each directory's own existing default in
+	// effect.
+	DirMode os.FileMode
+
+	// FileMode, if set, overrides searchResultFile.Attr's hardcoded
+	// 0444/0666 with the same permission bits regardless of readOnly,
+	// except that a read-only file still has its write bits stripped, so
+	// a mount that can't honor a write anyway doesn't advertise that it
+	// can.
+	//
+	// The zero value leaves 0444 (read-only) or 0666 (writable) in
+	// effect, exactly as before FileMode existed.
+	//
+	// A permanode's own unixPermission attr, when present, still takes
+	// precedence over either one; see applyUnixAttrs.
+	FileMode os.FileMode
+
+	// FilenameNestingMaxDepth caps how many path components
+	// FilenameNesting will materialize as real directories for a single
+	// name: a name with more components than this keeps only its first
+	// FilenameNestingMaxDepth-1 as directories, flattening everything
+	// beyond that into one final component, with the slashes that would
+	// otherwise have separated them percent-escaped (the same "%2F"
+	// FilenameSanitizePercent already uses for an illegal '/', so a name
+	// like "a/b/c/d.txt" with a cap of 2 becomes the two components "a"
+	// and "b%2Fc%2Fd.txt") rather than nesting it any deeper. This guards
+	// against a malicious or malformed filename attribute building an
+	// arbitrarily deep directory tree.
+	//
+	// The zero value, 0, leaves nesting uncapped, exactly as before
+	// FilenameNestingMaxDepth existed. Meaningless unless FilenameNesting
+	// is also set.
+	FilenameNestingMaxDepth int
+
+	// ExposeDescribeJSON makes a searchResultDir's ReadDirAll additionally
+	// list a "<name>.describe.json" file (see describeJSONSuffix)
+	// alongside each of its results, and makes Lookup resolve it for any
+	// currently known entry. Its content is generated straight from the
+	// cached n.ents entry, no extra round trip to the server.
+	//
+	// The zero value, false, keeps listings exactly as they were before
+	// describeJSONSuffix existed.
+	ExposeDescribeJSON bool
+
+	// DescribeStrategy selects how a searchResultDir's dir.ResolvePage calls
+	// describe each page's entries; see the DescribeStrategy type in
+	// searchdescribestrategy.go.
+	DescribeStrategy DescribeStrategy
+
+	// DescribedBlobCacheSize caps the number of entries kept in the
+	// describe-meta cache; see searchdescribecache.go.
+	DescribedBlobCacheSize int
+
+	// DescribedBlobCacheTTL is how long a cached describe result stays valid
+	// before a fresh describe is required; see searchdescribecache.go.
+	DescribedBlobCacheTTL time.Duration
+
+	// MissingContentPolicy selects what searchResultFile.Open does when a
+	// file's content blob can't be fetched; see the MissingContentPolicy type
+	// in searchmissingcontent.go.
+	MissingContentPolicy MissingContentPolicy
+
+	// ResultFilter, if set, is consulted by doReaddir for every entry a
+	// search query's page resolves, after describe resolution, so the
+	// predicate sees the entry's permanode with its full describe meta
+	// (attrs, camliContent, etc.) rather than just its blobref. It's
+	// called with the permanode's own *search.DescribedBlob, the same one
+	// camliXattrs and Getxattr already build this file's user.camli.*
+	// attrs from. Returning false excludes the entry: it doesn't appear
+	// in ReadDirAll's listing and isn't resolvable by Lookup, the same as
+	// if the server's own query had never matched it.
+	//
+	// This is an integration point for a program embedding the FUSE layer
+	// that needs client-side visibility rules a server-side search
+	// expression can't express (e.g. a business rule keyed off an attr
+	// the server doesn't index).
+	//
+	// The zero value (nil) preserves the existing behavior of filtering
+	// nothing beyond the search expression itself.
+	ResultFilter func(*search.DescribedBlob) bool
+
+	// FacetAttrs, if non-empty, is the list of facets facetsFileName
+	// reports counts for, in order. Two pseudo-attrs are recognized
+	// beyond a permanode's own multi-valued attrs (e.g. "tag"):
+	// "mimeType" facets by each entry's resolved content MIME type, and
+	// "year" facets by its modtime's year, formatted as a 4-digit string.
+	//
+	// The zero value (nil) means nothing is faceted, even if
+	// EnableFacetsFile is set.
+	FacetAttrs []string
+
+	// EnableFacetsFile turns on facetsFileName; see FacetAttrs. The zero
+	// value (false) keeps it unresolvable via Lookup, the same as if this
+	// feature didn't exist, since computing facet counts is extra work
+	// most mounts have no use for.
+	EnableFacetsFile bool
+
+	// SearchExprCaseInsensitiveCache makes searchDir.resultDirFor (see
+	// pkg/fs/search.go) fold the Lookup name it caches a searchResultDir
+	// under to lowercase, so a host filesystem that presents the exact
+	// same "cd <expr>" path back in a different case on a later lookup
+	// (as a case-insensitive host is free to do) reuses the
+	// searchResultDir already built for it instead of building a second
+	// one and running its query in whatever case the host handed back.
+	// The expression actually sent to the server is never folded: it's
+	// fixed, in its original case, the moment the first Lookup for that
+	// folded key creates the searchResultDir.
+	//
+	// It's off by default, the same as SearchCaseInsensitiveLookup, so a
+	// mount that wants exact-case "cd"s to be distinct directories (e.g.
+	// deliberately mounted search expressions that differ only in case)
+	// keeps that behavior unless it opts in.
+	SearchExprCaseInsensitiveCache bool
+
+	// ModTimePreference selects which of an entry's two time sources
+	// (permanode attr vs. schema blob) wins when both are present; see
+	// the ModTimePreference type in searchmodtimeattrs.go.
+	ModTimePreference ModTimePreference
+
+	// AllRecentLimit is the maximum number of entries allRecentDirName
+	// lists, newest modtime first, across all of its unioned sources
+	// combined (not per source). The zero value uses
+	// defaultAllRecentLimit (200).
+	AllRecentLimit int
+
+	// AutoLimitOnExpensiveQuery, if set, makes doReaddir respond to a
+	// "query too expensive" rejection from the server by automatically
+	// retrying once with a page size of effectiveExpensiveQueryLimit
+	// instead of ResolvePageSize, rather than failing the listing
+	// outright. The retry (and the original query that triggered it) are
+	// both logged either way, so the narrower results a successful retry
+	// returns don't look like a silently complete listing.
+	//
+	// The zero value (false) keeps the historical behavior: a "too
+	// expensive" rejection fails the listing with syscall.E2BIG, and
+	// errorFileName explains why.
+	AutoLimitOnExpensiveQuery bool
+
+	// ExpensiveQueryLimit is the page size doReaddir retries with after a
+	// "too expensive" rejection, when AutoLimitOnExpensiveQuery is set.
+	// The zero value uses defaultExpensiveQueryLimit (100).
+	ExpensiveQueryLimit int
+
+	// CreateTimeAttr, if set, is a permanode attribute name (e.g.
+	// "dateCreated", set once and never updated) whose value
+	// createTime prefers as a searchResultFile's creation time, distinct
+	// from its Mtime (the content's own modtime). There's no claim-history
+	// endpoint this mount's describe metadata exposes to derive "the
+	// permanode's first claim" automatically, so a mount that wants a true
+	// creation time has to record it itself as an ordinary attr the way
+	// ModTimeAttrs already lets a mount record a preferred modtime.
+	//
+	// The zero value ("") leaves createTime to fall back to the
+	// permanode's own ModTime (see PNodeMeta.Permanode.ModTime), and, if
+	// that's absent too, to Mtime itself, so Crtime/Ctime are never left
+	// at their zero value just because nothing more specific was on hand.
+	CreateTimeAttr string
+
+	// NameTemplate, if set, is a Go template (text/template syntax)
+	// stableName renders per entry to build its display name, in place
+	// of NameAttribute's single-attribute preference. It's rendered
+	// against a nameTemplateData built from the entry's permanode
+	// attributes, content filename, MIME type, and modtime, e.g.:
+	//
+	//	{{.Date}}_{{.Title}}{{.Ext}}
+	//
+	// For image results, .CaptureDate prefers the EXIF/schema capture
+	// time the indexer already read off the image blob (ccMeta.File.Time)
+	// over the permanode's own ModTime, so time-sorted browsing reflects
+	// when a photo was actually taken rather than when it was imported:
+	//
+	//	{{if .CaptureDate}}{{.CaptureDate}}_{{end}}{{.Name}}
+	//
+	// A field with nothing to report (e.g. .Title when the permanode has
+	// no "title" attr, .Attr.foo when it has no "foo" attr, or
+	// .CaptureDate for a non-image result or an image with no recorded
+	// capture time) renders empty rather than erroring; only a malformed
+	// template itself is an error, caught once by ValidateNameTemplate
+	// rather than on every entry. If the template as a whole renders to
+	// the empty string (e.g. just "{{.Title}}" for a permanode with no
+	// title attr), the entry keeps its content filename instead, the same
+	// as if NameTemplate weren't set for that one entry. A rendered name
+	// that collides with one already listed is still resolved the usual
+	// way, by CollisionStrategy.
+	//
+	// The zero value ("") leaves NameAttribute (or the content's own
+	// filename) in charge of naming, exactly as before NameTemplate
+	// existed.
+	NameTemplate string
+
+	// AllowContentReplace, if set, lets effectiveFileMode advertise a
+	// writable mode (0666, or FileMode's own write bits) for an existing
+	// searchResultFile. The zero value (false) matches what this tree can
+	// actually honor today: replacing an existing file's content isn't
+	// wired up yet (searchResultFile.Setattr rejects any real truncation
+	// with fuse.EROFS, and Open never hands back a writable handle for
+	// existing content), so every such file reports 0444 regardless of
+	// readOnly, rather than advertising write bits no syscall will ever
+	// honor. Creating a brand new file under a tag-matching search
+	// directory (see searchCreate.go) is unaffected either way, since
+	// that's Create/searchCreateHandle, not this node.
+	AllowContentReplace bool
+
+	// OrigPathAttr, if set, is a permanode attribute name (e.g. whatever
+	// a filesystem importer records a file's original absolute path
+	// under) whose value, when present on a searchResultFile's
+	// permanode, is exposed as the "user.camli.origpath" xattr (see
+	// origPath and camliXattrs). This lets a user correlate mounted
+	// content with where it came from, or audit import provenance,
+	// directly from the mount without going through the describe API.
+	//
+	// The zero value ("") leaves the xattr unset entirely, since there's
+	// no attribute name to look a path up under.
+	OrigPathAttr string
+
+	// OfflineCachePath, if set, is a directory this mount persists each
+	// searchResultDir's last successful ReadDirAll listing to (one JSON
+	// file per search expression, named by a hash of it), so that when a
+	// refresh's live query fails outright, doReaddir can fall back to the
+	// most recent on-disk listing instead of failing the whole directory
+	// with EIO. This is meant for mounts used on an intermittent
+	// connection: basic offline browsing of the directory structure (this
+	// entry existed, was named this, was this kind) stays possible, even
+	// though opening a file's content still requires reaching the server,
+	// exactly as it always has. A served stale listing gets
+	// staleMarkerName appended so it's never mistaken for a fresh one.
+	//
+	// The zero value ("") disables the cache entirely: a failed query
+	// fails the directory the same way it always has.
+	OfflineCachePath string
+
+	// OfflineCacheMaxAge bounds how stale a cached listing can be and
+	// still be served; past this age, doReaddir treats the cache as
+	// though it didn't exist and reports the live query's own failure
+	// instead of quietly serving a listing that's likely no longer
+	// representative.
+	//
+	// The zero value uses defaultOfflineCacheMaxAge.
+	OfflineCacheMaxAge time.Duration
+
+	// ExpressionAllowlist, if non-empty, restricts searchDir.Lookup to
+	// only the search expressions it lists: each entry is tried first as
+	// an exact match against the expression, then, if that doesn't
+	// match, as a regular expression anchored to match the whole
+	// expression (so a plain literal entry like "tag:vacation" behaves
+	// exactly as an exact match would, while an entry like "tag:.*" opens
+	// up a whole family of expressions at once). A saved search or alias
+	// (searchDir.Lookup's savedSearches/ExpressionAliases branch) is
+	// implicitly allowed either way, since it's something the mount
+	// operator already configured, not an arbitrary expression a user of
+	// a shared, locked-down mount typed in directly.
+	//
+	// An expression that doesn't pass is rejected with fuse.EACCES,
+	// before any query for it is ever issued.
+	//
+	// The zero value (nil) permits every expression, exactly as before
+	// ExpressionAllowlist existed.
+	ExpressionAllowlist []string
+
+	// StorageTierAttr, if set, is a permanode attribute name (e.g. one a
+	// tiered-storage-aware importer or admin script records a blob's
+	// storage locality under, like "cold" or "nearline") whose value,
+	// when present on a searchResultFile's permanode, is exposed as the
+	// "user.camli.storageTier" xattr (see storageTier and camliXattrs).
+	// There's no describe-level storage-tier field this tree's describe
+	// metadata exposes to derive this automatically, so a mount that
+	// wants to warn users about slow-to-fetch content has to record the
+	// hint itself as an ordinary attr, the same way CreateTimeAttr and
+	// OrigPathAttr already let a mount surface data it otherwise has no
+	// way to ask the server for directly.
+	//
+	// The zero value ("") leaves the xattr unset entirely, since there's
+	// no attribute name to look a hint up under.
+	StorageTierAttr string
+
+	// IgnoredLookupNames extends defaultIgnoredLookupNames with
+	// additional names searchDir.Lookup should reject with fuse.ENOENT
+	// immediately, for a mount that sees probes from tools
+	// defaultIgnoredLookupNames doesn't already account for.
+	//
+	// The zero value (nil) leaves defaultIgnoredLookupNames as the
+	// complete set.
+	IgnoredLookupNames []string
+
+	// SortTieBreak makes sortLastNames break a tie between two entries
+	// whose primary sort key compares equal (e.g. identical modtimes
+	// under SearchSortByModTimeAsc/Desc, or identical attr values under
+	// SearchSortByAttr) by name, then by content blobref if the names
+	// also collide, instead of leaving them in whatever order they
+	// happened to arrive in. Without it, a tie's relative order depends
+	// on the server's own (generally unordered) result order, so a
+	// listing with many equal-key entries can come back differently
+	// across refreshes even though nothing in the index changed.
+	//
+	// SearchSortByName and SearchSortByNameNatural never need this: name
+	// is already their primary key, and n.lastNames holds no duplicate
+	// names to tie-break between.
+	//
+	// The zero value (false) keeps the original behavior: a tie's
+	// relative order is whatever sort.SliceStable leaves it as, i.e.
+	// whatever order the entries were in before sortLastNames ran.
+	SortTieBreak bool
+
+	// MinSearchCacheTTL, if set, replaces defaultMinSearchCacheTTL as the
+	// floor effectiveSearchCacheTTL clamps a configured TTL up to,
+	// regardless of which of SearchCacheTTL, a "#ttl=" Lookup option, or a
+	// saved search's TTL attr it came from. See
+	// AllowSubMinimumSearchCacheTTL to disable the floor instead of just
+	// moving it.
+	//
+	// The zero value leaves defaultMinSearchCacheTTL as the floor.
+	MinSearchCacheTTL time.Duration
+
+	// AllowSubMinimumSearchCacheTTL disables effectiveSearchCacheTTL's
+	// floor entirely, so a configured TTL below it (including
+	// SearchCacheTTL's own zero value, which otherwise gets clamped up
+	// like anything else) takes effect exactly as configured. It exists
+	// for tests, and for an operator who's actually measured their
+	// server can handle the query rate a near-zero TTL implies.
+	//
+	// The zero value (false) enforces the floor.
+	AllowSubMinimumSearchCacheTTL bool
+
+	// PrimaryContentAttr, if set, is a permanode attribute tried in place
+	// of "camliContent" when resolving a permanode's primary content (see
+	// dir.ResolvePage's contentAttr), for a schema that points at its file
+	// or directory through some other attribute instead. A permanode with
+	// nothing under PrimaryContentAttr still falls back to "camliContent",
+	// so mixing conventions within one mount works.
+	//
+	// The zero value ("") preserves the existing camliContent-only
+	// behavior.
+	PrimaryContentAttr string
+
+	// DirSizeMode picks which of DirSizeZero (the zero value, and
+	// historical behavior), DirSizeEntryCount, or DirSizeContentSum
+	// searchResultDir.Attr uses to compute a.Size. Some tools render a
+	// directory's size in a listing, or simply misbehave when every
+	// directory reports zero; the other two modes give them something
+	// more useful without an extra query beyond what ReadDirAll already
+	// cached.
+	DirSizeMode DirSizeMode
+
+	// DirSizeEntryCountFactor is the per-entry size DirSizeEntryCount
+	// multiplies a directory's entry count by. Zero (the default) leaves
+	// DirSizeEntryCount reporting zero, same as DirSizeZero; set it to get
+	// a nonzero synthetic size out of DirSizeEntryCount.
+	DirSizeEntryCountFactor uint64
+
+	// ReadOnly, if set, makes every mutation handler in this package
+	// (Create, Mkdir, Remove, Rename, Symlink, Setattr, and every control
+	// file's Write) fail with fuse.EROFS, regardless of AllowDelete,
+	// AllowMkdir, AllowContentReplace, or any other flag that would
+	// otherwise let a particular write through. It's meant as a single,
+	// authoritative switch an admin can set on a mount that should never
+	// accept writes, so a future write feature can't reopen one by
+	// forgetting to check its own flag: every handler calls
+	// checkWritable first, before consulting anything else.
+	//
+	// The zero value (false) leaves every other flag in charge of its own
+	// writes, exactly as before ReadOnly existed.
+	ReadOnly bool
+
+	// DescribeCompletenessRetryThreshold, if greater than zero, makes
+	// doReaddir retry a page whose fallbacks-plus-unresolved entries (see
+	// dir.ResolvePage's fallbacks and unresolved, and statusFile's own use
+	// of the same totals) make up more than this fraction of the page,
+	// once, with describe depth increased by one level, before accepting
+	// that page's result. It's for a server whose default describe depth
+	// leaves a large fraction of a particular collection needing a
+	// per-entry fallback describe or, worse, never resolving at all; one
+	// extra, deeper pass often recovers most of them without the mount
+	// having to be reconfigured with a permanently deeper (and so more
+	// expensive, for every other collection too) describe depth.
+	//
+	// Bounded to a single retry per page, regardless of whether it
+	// actually improved completeness, so a collection that's incomplete
+	// no matter the depth doesn't pay for an unbounded number of passes.
+	//
+	// The zero value never retries; every page is accepted exactly as
+	// dir.ResolvePage first returns it, the historical behavior.
+	DescribeCompletenessRetryThreshold float64
+
+	// LazyResolve, if set, makes ReadDirAll answer from a query with no
+	// describe request at all, naming each entry after its own permanode
+	// blobref (see lazyEntryName) instead of waiting on the describe that
+	// would normally tell it the entry's real filename, type, and
+	// metadata. That makes the listing itself return quickly even for a
+	// huge result set, at the cost of every entry's first Lookup or Attr
+	// paying for the describe ReadDirAll would otherwise have already
+	// done on its behalf; see resolveLazyEntry, which does that work once
+	// per entry and caches it back into n.ents/n.sets/n.symlinks exactly
+	// as a normal doReaddir would have, so a second Lookup of the same
+	// name never repeats it.
+	//
+	// Because the listing never names an entry after anything but its own
+	// permanode, a name doReaddir would otherwise have given it (its
+	// filename, or a stableName collision suffix) never appears in a
+	// LazyResolve listing, so mounting with both LazyResolve and
+	// CamliFileSystem.SearchCaseInsensitiveLookup or FollowCamliPath
+	// selects a filesystem view a media player or shell glob expecting
+	// ordinary filenames likely won't find useful; it's meant for a
+	// caller that already knows its own permanodes (a sync or backup tool
+	// doing its own bookkeeping) and just wants the directory to populate
+	// fast.
+	LazyResolve bool
+
+	// MaxOpenFiles caps how many searchResultFile handles a mount has open
+	// at once (see openFileLimiter), protecting the blob-fetch connections
+	// backing them from a client that opens far more files than it could
+	// ever usefully read concurrently. OpenFilesOverLimit selects what an
+	// Open past the limit does while it's at capacity.
+	//
+	// The zero value means no limit is enforced, the historical behavior.
+	MaxOpenFiles int
+
+	// MaxOpenFiles caps how many searchResultFile handles a mount has open
+	// at once (see openFileLimiter), protecting the blob-fetch connections
+	// backing them from a client that opens far more files than it could
+	// ever usefully read concurrently. OpenFilesOverLimit selects what an
+	// Open past the limit does while it's at capacity.
+	//
+	// The zero value means no limit is enforced, the historical behavior.
+	OpenFilesOverLimit OpenFilesOverLimitPolicy
+
+	// LabelAttr names the permanode attribute (e.g. "label" or "color")
+	// searchResultFile.camliXattrs exposes as LabelXattrName, so a value
+	// set in Perkeep (a "label" claim, say) shows up as a
+	// "user.nautilus.emblem"-style xattr a file manager already knows how
+	// to render. Like locationFromMeta's "latitude"/"longitude" or
+	// tagsFor's "tag", it's an ordinary scalar attr already present in a
+	// fully-described permanode's Permanode.Attr map, needing no extra
+	// describe rule of its own to appear; unlike those two, its
+	// destination xattr name and the translation of its raw value are
+	// both configurable rather than fixed, since "what a file manager
+	// expects" varies by file manager.
+	//
+	// Both LabelAttr and LabelXattrName must be set for the xattr to
+	// appear at all; an entry whose permanode lacks LabelAttr omits it,
+	// the same way camliXattrs omits "user.camli.tags" for a permanode
+	// with no "tag" claims.
+	//
+	// LabelValueMap, if non-nil, translates LabelAttr's raw value before
+	// it's exposed: a value found as a key is replaced by the
+	// corresponding map value, letting Perkeep's own vocabulary (say,
+	// "red") translate into a file manager's own naming (say,
+	// "Emblem-red"). A value with no entry in LabelValueMap, or
+	// LabelValueMap left nil altogether, is exposed unchanged.
+	LabelAttr string
+
+	// LabelAttr names the permanode attribute (e.g. "label" or "color")
+	// searchResultFile.camliXattrs exposes as LabelXattrName, so a value
+	// set in Perkeep (a "label" claim, say) shows up as a
+	// "user.nautilus.emblem"-style xattr a file manager already knows how
+	// to render. Like locationFromMeta's "latitude"/"longitude" or
+	// tagsFor's "tag", it's an ordinary scalar attr already present in a
+	// fully-described permanode's Permanode.Attr map, needing no extra
+	// describe rule of its own to appear; unlike those two, its
+	// destination xattr name and the translation of its raw value are
+	// both configurable rather than fixed, since "what a file manager
+	// expects" varies by file manager.
+	//
+	// Both LabelAttr and LabelXattrName must be set for the xattr to
+	// appear at all; an entry whose permanode lacks LabelAttr omits it,
+	// the same way camliXattrs omits "user.camli.tags" for a permanode
+	// with no "tag" claims.
+	//
+	// LabelValueMap, if non-nil, translates LabelAttr's raw value before
+	// it's exposed: a value found as a key is replaced by the
+	// corresponding map value, letting Perkeep's own vocabulary (say,
+	// "red") translate into a file manager's own naming (say,
+	// "Emblem-red"). A value with no entry in LabelValueMap, or
+	// LabelValueMap left nil altogether, is exposed unchanged.
+	LabelXattrName string
+
+	// LabelAttr names the permanode attribute (e.g. "label" or "color")
+	// searchResultFile.camliXattrs exposes as LabelXattrName, so a value
+	// set in Perkeep (a "label" claim, say) shows up as a
+	// "user.nautilus.emblem"-style xattr a file manager already knows how
+	// to render. Like locationFromMeta's "latitude"/"longitude" or
+	// tagsFor's "tag", it's an ordinary scalar attr already present in a
+	// fully-described permanode's Permanode.Attr map, needing no extra
+	// describe rule of its own to appear; unlike those two, its
+	// destination xattr name and the translation of its raw value are
+	// both configurable rather than fixed, since "what a file manager
+	// expects" varies by file manager.
+	//
+	// Both LabelAttr and LabelXattrName must be set for the xattr to
+	// appear at all; an entry whose permanode lacks LabelAttr omits it,
+	// the same way camliXattrs omits "user.camli.tags" for a permanode
+	// with no "tag" claims.
+	//
+	// LabelValueMap, if non-nil, translates LabelAttr's raw value before
+	// it's exposed: a value found as a key is replaced by the
+	// corresponding map value, letting Perkeep's own vocabulary (say,
+	// "red") translate into a file manager's own naming (say,
+	// "Emblem-red"). A value with no entry in LabelValueMap, or
+	// LabelValueMap left nil altogether, is exposed unchanged.
+	LabelValueMap map[string]string
+
+	// LookupBatchWindow, if nonzero, makes resolveLazyEntry hold a
+	// permanode it would otherwise describe on its own for up to this
+	// long, joining it with whatever other permanodes other concurrent or
+	// closely-spaced Lookups against the same LazyResolve directory are
+	// also waiting on, and resolving the whole group with a single
+	// dir.ResolveMembers describe request instead of one dir.ResolveMember
+	// per name. That turns a burst of Lookups (a "ls -l" stating every
+	// lazily-named entry in turn, say) from one round trip per entry into
+	// one round trip per LookupBatchWindow, at the cost of the first
+	// Lookup in a group waiting out the window rather than returning as
+	// soon as its own describe would otherwise have completed.
+	//
+	// LookupBatchSize, if nonzero, flushes a group early, without waiting
+	// out LookupBatchWindow, as soon as it reaches this many permanodes.
+	// It bounds how large one describe request gets when Lookups arrive
+	// quickly enough to otherwise fill the window with more than a
+	// backend should be asked to describe in one call.
+	//
+	// Both are no-ops unless LazyResolve is also set. The zero value for
+	// either leaves resolveLazyEntry calling dir.ResolveMember directly,
+	// the historical behavior.
+	LookupBatchWindow time.Duration
+
+	// LookupBatchWindow, if nonzero, makes resolveLazyEntry hold a
+	// permanode it would otherwise describe on its own for up to this
+	// long, joining it with whatever other permanodes other concurrent or
+	// closely-spaced Lookups against the same LazyResolve directory are
+	// also waiting on, and resolving the whole group with a single
+	// dir.ResolveMembers describe request instead of one dir.ResolveMember
+	// per name. That turns a burst of Lookups (a "ls -l" stating every
+	// lazily-named entry in turn, say) from one round trip per entry into
+	// one round trip per LookupBatchWindow, at the cost of the first
+	// Lookup in a group waiting out the window rather than returning as
+	// soon as its own describe would otherwise have completed.
+	//
+	// LookupBatchSize, if nonzero, flushes a group early, without waiting
+	// out LookupBatchWindow, as soon as it reaches this many permanodes.
+	// It bounds how large one describe request gets when Lookups arrive
+	// quickly enough to otherwise fill the window with more than a
+	// backend should be asked to describe in one call.
+	//
+	// Both are no-ops unless LazyResolve is also set. The zero value for
+	// either leaves resolveLazyEntry calling dir.ResolveMember directly,
+	// the historical behavior.
+	LookupBatchSize int
+
+	// BatchAttribute, if set, is a permanode attribute (e.g. "importBatch"
+	// or "storageGeneration") that byBatchTreeDir facets results by: one
+	// subdirectory per distinct value present across n.ents (plus
+	// unbatchedBucketName, for names whose permanode doesn't carry it),
+	// the same way byTagTreeDirName already facets by "tag". Unlike "tag",
+	// an import batch or storage generation is expected to take at most
+	// one value per permanode, so a name appears under a single bucket,
+	// the same way groupBuckets treats GroupByAttribute.
+	//
+	// Like "tag" and GroupByAttribute, it's an ordinary scalar attr
+	// already present in a fully-described permanode's Permanode.Attr
+	// map, needing no extra describe rule of its own to appear.
+	//
+	// The zero value ("") means byBatchTreeDirName doesn't exist at all.
+	BatchAttribute string
+
+	// ExposeReadProgress makes a searchResultDir's ReadDirAll additionally
+	// list a "<name>.progress" file (see progressSuffix) alongside each of
+	// its results, and makes Lookup resolve it for any currently known
+	// entry. It also makes searchResultFile.Open track fetched-bytes
+	// progress for the handle it returns (see readProgress), which the
+	// progress file otherwise has nothing to report.
+	//
+	// The zero value, false, keeps Open and listings exactly as they were
+	// before progress files existed: a niche, opt-in mechanism for
+	// monitoring a slow fetch from cold storage, not something every mount
+	// pays for.
+	ExposeReadProgress bool
+
+	// ExposeContentGeneration, if set, makes searchResultFile.Attr derive
+	// its Ctime from the entry's current content blobref (see
+	// contentGeneration) instead of leaving it at whatever applyCreateTime
+	// already set: a later camliContent claim on the same permanode gives
+	// n.blobref a new value, so Ctime changes too, even though the
+	// permanode (and so n's inode, via inodeTable) stays exactly the same.
+	// That models "same file, new content" for any client that treats a
+	// changed Ctime as a reason to refetch, the same role a true inode
+	// generation number would play on a filesystem whose protocol exposes
+	// one; bazil.org/fuse's Attr has no such field, so this reuses Ctime,
+	// a field it does have, instead.
+	//
+	// The zero value, false, leaves Ctime exactly as applyCreateTime set
+	// it, the same as before ExposeContentGeneration existed.
+	ExposeContentGeneration bool
+
+	// MaxInlineSetMembers caps how many of a set permanode's camliMember
+	// values dir.ResolvePage embeds in a top-level ReadDirAll's describe
+	// response (see dir.Entry.MembersTruncated): a collection with
+	// thousands of members would otherwise make even a depth-1 describe
+	// enormous, since the server recurses into every one of them. A set
+	// whose member count exceeds this is listed with only the first
+	// MaxInlineSetMembers described inline; opening it (see
+	// searchMemberDir.resolve) re-fetches the permanode directly to page
+	// through the rest.
+	//
+	// The zero value leaves every member inline, exactly as before
+	// MaxInlineSetMembers existed.
+	MaxInlineSetMembers int
+
+	// ManifestIncludeEntries makes manifestFileName embed each cached
+	// search directory's own resultsJSONName entries inline, instead of
+	// just its SearchDirInfo summary. Generating every directory's full
+	// entry list can be expensive for a mount with many large, warm
+	// directories, so this defaults to leaving them out; a backup tool
+	// that actually needs per-entry detail opts in explicitly rather than
+	// paying that cost on every read.
+	//
+	// The zero value (false) reports only directory summaries.
+	ManifestIncludeEntries bool
+
+	// CaseCollisionPolicy picks how stableName handles two entries whose
+	// names differ only in case: CaseCollisionPolicyKeepBoth (the zero
+	// value) for a case-sensitive mount, or CaseCollisionPolicySuffix for
+	// a case-insensitive host that would otherwise lose one of them.
+	//
+	// Unlike CollisionStrategy, which resolves two different permanodes
+	// wanting the exact same name, this targets only a case-only clash --
+	// two names that are already distinct under an exact, case-sensitive
+	// comparison.
+	CaseCollisionPolicy CaseCollisionPolicy
+
+	// BackendAttr, if set, is a permanode attribute name a multi-backend
+	// Perkeep deployment's federation or blob-placement tooling records
+	// which storage backend (e.g. "local", "s3", "nearline") currently
+	// holds a blob's content under. Its value, when present on a
+	// searchResultFile's permanode, is exposed as the "user.camli.backend"
+	// xattr (see backend and camliXattrs), so a user managing tiered or
+	// federated storage can predict an entry's fetch latency and egress
+	// cost before opening it. Like StorageTierAttr, this exists because
+	// this tree's describe metadata has no backend field of its own to
+	// derive the value from automatically; a deployment that wants this
+	// has to record it as an ordinary attr itself.
+	//
+	// The zero value ("") leaves the xattr unset entirely, since there's
+	// no attribute name to look a backend hint up under.
+	BackendAttr string
+
+	// EmptyExpressionDefault, if set, is the search expression
+	// lookupResultDirFor substitutes for an empty one (e.g. `cd ""`, or
+	// creating a directory with an empty name), rather than handing the
+	// server, or a searchDirCache key, an expression with no defined
+	// meaning. A mount that wants "cd" with nothing typed to land
+	// somewhere useful, like its most recent items, sets this to that
+	// expression (e.g. "recent" or a saved search's name).
+	//
+	// The zero value ("") instead makes an empty expression fail
+	// immediately with fuse.EINVAL, the same way any other malformed
+	// expression does under CamliFileSystem.ValidateSearchExpr, rather
+	// than silently running an empty query.
+	EmptyExpressionDefault string
+
+	// ExtractedTextAttr, if set, is a permanode attribute name a search
+	// index's content-extraction pipeline records a document's extracted
+	// plain text under (e.g. what a PDF or text file's indexer ran
+	// through to make it full-text searchable in the first place). An
+	// entry whose permanode carries it gets a sibling named
+	// "<name>.txt" exposing that text directly, via addExtractedTextEntry,
+	// so a user can grep the mount for a document's contents without
+	// opening the original file. An entry without the attribute, or
+	// whose value is empty, gets no sibling at all.
+	//
+	// Like StorageTierAttr and BackendAttr, this exists because this
+	// tree's describe metadata has no extracted-text field of its own;
+	// a deployment that wants this sibling exposed has to record the
+	// text as an ordinary attr itself.
+	//
+	// The zero value ("") leaves the feature off entirely: no sibling is
+	// ever added, and ExtractedTextAttr's own value is never looked up.
+	ExtractedTextAttr string
+
+	// CompletenessStatusFile makes a searchResultDir (see
+	// pkg/fs/searchResult.go) expose completenessStatusFileName
+	// (".status"), unifying truncatedMarkerName, partialMarkerName, and
+	// its describe-fallback count into one structured report of whether
+	// its last listing was complete, rather than a client having to know
+	// about and check each marker separately. It defaults to off, so an
+	// existing mount's listing is unchanged until this is turned on.
+	CompletenessStatusFile bool
+
+	// CompletenessStatusFormat selects completenessStatusFileName's
+	// content format: CompletenessStatusFormatJSON (the zero value) for a
+	// small JSON object, or CompletenessStatusFormatText for a short
+	// human-readable summary. It has no effect unless
+	// CamliFileSystem.CompletenessStatusFile is set.
+	CompletenessStatusFormat CompletenessStatusFormat
+
+	// CollectionBackrefs makes searchResultDir.Lookup resolve
+	// "<name>.collections" (see collectionsSuffix) for any currently known
+	// entry, listing the titles and blobrefs of permanodes that have it as
+	// a camliMember, via collectionBackrefsContents. Each resolution is an
+	// extra search.SearchQuery the mount wouldn't otherwise issue, so this
+	// defaults to off, unlike the describe-from-cache sidecars that cost
+	// nothing extra.
+	CollectionBackrefs bool
+
+	// MaxCollectionBackrefs bounds how many collections
+	// collectionBackrefsContents reports for a single entry (see
+	// effectiveMaxCollectionBackrefs). The zero value means
+	// defaultMaxCollectionBackrefs, not unlimited, since an item belonging
+	// to an unusually large number of collections shouldn't make a single
+	// sidecar read balloon.
+	MaxCollectionBackrefs int
+
+	// CallerUIDOwnerMap, when mounted with allow_other so requests can
+	// arrive from an OS user other than the one that ran the mount, maps
+	// that request's caller uid to the owner it's allowed to read: opening
+	// a searchResultDir denies the request outright (fuse.EPERM) unless
+	// its own owner scope (see effectiveOwner, in searchownerscope.go) is
+	// either unset or equal to the mapped owner. An uid with no entry here
+	// falls back to DefaultCallerOwner.
+	//
+	// This only gates which statically owner-scoped directories (via
+	// Owner or a path's "owner=" override) a caller may open; it does not
+	// split a single unscoped directory's listing per caller. n's listing
+	// and cache are shared across every Open of it (see Open's own doc
+	// comment), so doing that would mean building and caching a distinct
+	// listing per owner behind one path, which needs the directory to be
+	// looked up with the caller's identity already known -- something the
+	// Lookup that resolves a name to a searchResultDir in the first place
+	// (outside this package) doesn't currently have to work with. Until
+	// that exists, secure per-OS-user isolation on one mount means giving
+	// each user their own "owner="-scoped search directory and using this
+	// map to keep one user's requests out of another's.
+	//
+	// The zero value (nil) disables this entirely: Open skips the check
+	// and behaves as it did before this field existed.
+	CallerUIDOwnerMap map[uint32]string
+
+	// DefaultCallerOwner is the owner CallerUIDOwnerMap falls back to for
+	// a caller uid with no entry of its own, when CallerUIDOwnerMap is
+	// set. The zero value ("") denies an unmapped caller rather than
+	// falling back to a shared owner, so forgetting to list a uid fails
+	// closed.
+	DefaultCallerOwner string
+
+	// AttrValidity is how long the kernel may cache a node's fuse.Attr
+	// before calling Attr again, set as a.Valid by every node's Attr
+	// method via effectiveAttrValidity. Setting it close to a
+	// searchResultDir's own TTL (see its cache-refresh fields) keeps
+	// attribute freshness in step with listing freshness; for content
+	// that mutates faster than a directory refreshes, a shorter value
+	// trades away some attribute-cache efficiency to avoid a node
+	// reporting a stale size or mtime between refreshes.
+	//
+	// The zero value leaves fuse.Attr.Valid unset, i.e. bazil.org/fuse's
+	// own default, unchanged from before this field existed.
+	AttrValidity time.Duration
+
+	// ContentAttrAliases, if non-empty, is a prioritized list of
+	// permanode attribute names tried, in order, for a permanode's
+	// primary content (see dir.ResolvePage's contentAttrAliases) whenever
+	// PrimaryContentAttr itself comes up empty on that permanode, before
+	// falling back to "camliContent" exactly as before either field
+	// existed. This is for a mount that needs to browse permanodes
+	// written under more than one schema convention at once (e.g. while
+	// migrating PrimaryContentAttr to a new name): PrimaryContentAttr
+	// alone only recognizes the one name it's set to, while
+	// ContentAttrAliases catches the rest.
+	//
+	// dir.go logs, at its own Logger, which alias (if any) actually
+	// matched, for diagnosing version-skew issues.
+	//
+	// The zero value (nil) tries nothing beyond PrimaryContentAttr and
+	// camliContent, unchanged from before this field existed.
+	ContentAttrAliases []string
+
+	// TitleAttrAliases is ContentAttrAliases' counterpart for an entry's
+	// display name: a prioritized list of permanode attribute names tried
+	// in order (see dir.ResolvePage's titleAttrAliases) whenever
+	// NameAttribute comes up empty on that permanode, before falling back
+	// to the content's own filename exactly as before either field
+	// existed.
+	//
+	// The zero value (nil) tries nothing beyond NameAttribute and the
+	// content's filename, unchanged from before this field existed.
+	TitleAttrAliases []string
+
+	// UnresolvedCountXattrName, if set, is the extended attribute name a
+	// searchResultDir exposes n.lastUnresolvedCount (the most recent
+	// doReaddir's count of matched entries left unresolved; see
+	// completenessStatusContents's FallbackCount for its sibling signal)
+	// under, as a plain decimal string, for a monitoring tool that wants
+	// to alert on a large fraction of unresolved matches without reading
+	// completenessStatusFileName and parsing it itself.
+	//
+	// The zero value ("") exposes no such xattr.
+	UnresolvedCountXattrName string
+
+	// SavedSearchDeletedBehavior selects how a searchResultDir already
+	// built from a saved search (see searchDir.savedSearches) is handled
+	// once that saved search's permanode is deleted server-side:
+	// SavedSearchDeletedKeep (the zero value) leaves it dangling exactly
+	// as before this field existed, SavedSearchDeletedDisappear evicts it
+	// from the cache on the next top-level ReadDirAll, and
+	// SavedSearchDeletedFallback switches it to
+	// SavedSearchDeletedFallbackExpr and marks it stale instead.
+	SavedSearchDeletedBehavior SavedSearchDeletedBehavior
+
+	// SavedSearchDeletedFallbackExpr is the search expression an orphaned
+	// saved-search directory switches to when SavedSearchDeletedBehavior
+	// is SavedSearchDeletedFallback. Left empty, such a directory is
+	// skipped and kept dangling instead, the same as
+	// SavedSearchDeletedKeep, since falling back to an empty expression
+	// has no defined meaning (see CamliFileSystem.EmptyExpressionDefault,
+	// which this deliberately doesn't consult: an orphaned saved search
+	// going stale shouldn't silently start mirroring whatever plain "cd"
+	// with nothing after it means on the day it happens to trigger).
+	SavedSearchDeletedFallbackExpr string
+
+	// SimilarityClusterAttr, if set, is the permanode attribute a server
+	// that supports perceptual-similarity clustering for images populates
+	// with a cluster ID shared by every near-duplicate in a burst (the
+	// same shot, slightly different), for dedupeBySimilarity to group a
+	// listing's entries by. This is stricter than CamliFileSystem.
+	// DedupByContent, which only catches byte-identical content: two
+	// similar but non-identical images can share a SimilarityClusterAttr
+	// value without ever sharing a camliContent blobref.
+	//
+	// The zero value ("") disables the feature. Setting it against a
+	// server that doesn't populate any such attribute is harmless and
+	// simply never finds anything to cluster: every entry keeps its own
+	// place in the listing, exactly as if this were unset.
+	SimilarityClusterAttr string
+
+	// SimilarityRepresentative is meaningless unless
+	// CamliFileSystem.SimilarityClusterAttr is also set.
+	SimilarityRepresentative SimilarityRepresentative
+
+	// ServerEndpoints, if set, is an ordered list of already-constructed
+	// clients for replicas of the same Perkeep server this mount's own
+	// client talks to, for the read path (search queries and schema blob
+	// fetches) to fail over across on a connection error instead of
+	// failing the FUSE request outright. The endpoint that last succeeded
+	// stays sticky-preferred (tried first) until it fails; a failed one is
+	// skipped for FailoverCooldown before being retried. A mutation never
+	// consults this list; see FailoverQueryFetcher's doc comment for why.
+	//
+	// The zero value (nil) disables failover entirely: every read goes to
+	// this CamliFileSystem's own client, exactly as it always has. This is
+	// also what makes the feature a no-op when there's no redundant
+	// backend to fail over to in the first place.
+	ServerEndpoints []FailoverQueryFetcher
+
+	// FailoverCooldown bounds how long a ServerEndpoints entry that just
+	// failed is skipped before being tried again.
+	//
+	// The zero value uses defaultFailoverCooldown.
+	FailoverCooldown time.Duration
+
+	// SmartFolderRefresh, if true, makes every searchResultDir
+	// proactively re-run its search in the background shortly before its
+	// own TTL lapses (see dueForRefresh), once it's been read at least
+	// once (see searchWatcher.register), rather than only refreshing
+	// lazily on a caller's next ReadDirAll or Lookup: a caller arriving
+	// right as the TTL expires finds an already-warm cache instead of
+	// blocking on the network. It only keeps refreshing a dir that's been
+	// opened or looked up within recentAccessWindow; one that's merely
+	// still registered, with nothing actually reading it any more, goes
+	// back to refreshing lazily instead of costing a query every TTL
+	// forever. Paired with CamliFileSystem.Server, whose invalidateDiff
+	// this still goes through on every refresh, a watch-aware application
+	// (one with its own inotify-style watch on the mountpoint) sees
+	// added/removed entries pushed to it instead of needing to poll the
+	// directory to notice them.
+	//
+	// The zero value (false) preserves the original behavior: a dir never
+	// refreshes until something asks it to. It's opt-in because it adds
+	// one background query per watched, recently-accessed dir per TTL even
+	// when nothing is actively browsing the mount at that exact moment.
+	SmartFolderRefresh bool
+
+	// HideEmptySavedSearches, when set, makes ReadDirAll omit a saved
+	// search from the top-level listing once isSavedSearchEmpty reports
+	// it currently matches nothing, so a dashboard full of saved searches
+	// only shows the ones with something in them. Checked lazily off
+	// ReadDirAll, and cached per expression for
+	// EmptySavedSearchCacheTTL, since resolving a saved search's own
+	// match count is its own query, separate from (and more expensive
+	// than) listing the saved searches themselves.
+	//
+	// The zero value (false) lists every saved search regardless of
+	// result count, exactly as before this option existed.
+	HideEmptySavedSearches bool
+
+	// EmptySavedSearchCacheTTL bounds how long isSavedSearchEmpty trusts a
+	// cached answer before re-checking a saved search's result count.
+	//
+	// The zero value uses defaultEmptySavedSearchCacheTTL.
+	EmptySavedSearchCacheTTL time.Duration
+
+	// SpecialContentPolicy selects what dir.ResolvePage does with a permanode
+	// whose camliContent resolved to a special file type (fifo, socket, ...);
+	// see the SpecialContentPolicy type in searchspecial.go.
+	SpecialContentPolicy SpecialContentPolicy
+
+	// EnableTimelineFile turns on timelineFileName; see TimelineGranularity.
+	// The zero value (false) keeps it unresolvable via Lookup, the same as
+	// if this feature didn't exist, since computing the histogram is extra
+	// work most mounts have no use for.
+	EnableTimelineFile bool
+
+	// TimelineGranularity is the bucket size timelineFileName groups
+	// entries' modtimes by.
+	//
+	// The zero value (TimelineDay) buckets by calendar day, even if
+	// EnableTimelineFile is set.
+	TimelineGranularity TimelineGranularity
+
+	// TrimTrailingFilenameWhitespace trims trailing whitespace from entry names
+	// before they're shown; see searchtrimws.go.
+	TrimTrailingFilenameWhitespace bool
+
+	// SizeBucketBoundariesMB sets the boundaries, in megabytes and
+	// ascending order, bySizeDir buckets file sizes at. A size below the
+	// first boundary falls in "<NMB"; a size at or above the last falls in
+	// ">NMB"; a size between two falls in "N-MMB".
+	//
+	// The zero value (nil) uses defaultSizeBucketBoundariesMB (1, 10, 100),
+	// giving the buckets "<1MB", "1-10MB", "10-100MB", and ">100MB".
+	SizeBucketBoundariesMB []int64
+
+	// PinPaginationSnapshot, when set, makes doReaddir pin a point in time
+	// ("now", as of that pass's first page) for every dir.ResolvePage call
+	// in a single ReadDirAll pass, the same way a searchAtDir pins its own
+	// n.at permanently. Without it, a live directory's pages each describe
+	// against whatever "now" happens to be by the time that particular
+	// round trip goes out, so content that changes mid-listing (a rename,
+	// a new upload matching the same expression) can make two pages of the
+	// same listing disagree about it.
+	//
+	// A continue token that outlives however long the server retains the
+	// index generation it was issued against still surfaces as an ordinary
+	// query error from dir.ResolvePage -- doReaddir's existing retry and
+	// offline-cache fallbacks handle it exactly like any other failed
+	// page, since there's nothing pagination-specific to do differently
+	// for an expired token versus any other transient failure.
+	//
+	// If the server doesn't support point-in-time querying at all,
+	// doReaddir falls back to an unpinned retry for the rest of that pass
+	// rather than failing the whole directory the way an explicit,
+	// caller-requested searchAtDir's unsupported n.at does; this is an
+	// internal consistency optimization, not something the caller asked
+	// for, so its own unavailability shouldn't be fatal.
+	//
+	// The zero value (false) never pins a live directory, preserving the
+	// historical per-round-trip "now" behavior. The pin never outlives one
+	// ReadDirAll pass: the next call (a refresh, whether from the cache TTL
+	// expiring or an explicit RefreshFileName write) pins a fresh "now" of
+	// its own.
+	PinPaginationSnapshot bool
+
+	// StarAttr names the permanode attribute starFileSuffix reads and
+	// writes. The zero value ("") uses defaultStarAttr ("star").
+	StarAttr string
+
+	// EnableTrashView makes trashDirName resolvable under the top-level
+	// "search" directory. The zero value (false) makes it behave like any
+	// other unrecognized name: fuse.ENOENT.
+	//
+	// Copying an entry out of trash/ works the same as copying out of any
+	// other search result directory, since it's backed by an ordinary
+	// searchResultDir: reading the bytes back out doesn't touch the
+	// permanode's delete claim either way. Actually retracting that claim
+	// to undelete an entry isn't wired up here, since nothing this mount's
+	// search results expose identifies the specific claim blob to retract;
+	// see (*searchResultDir).Remove for the issuing side of the same
+	// claim.
+	EnableTrashView bool
+
+	// ErrnoPolicy overrides the errno effectiveUnsupportedErrno reports
+	// for a given UnsupportedCondition, in place of this package's own
+	// default, so a mount can be tuned for a FUSE client that reacts badly
+	// to one of them (e.g. a client that treats EROFS as "unmount me" and
+	// would rather see EPERM).
+	//
+	// The zero value (nil) uses the package defaults: fuse.EROFS for
+	// UnsupportedReadOnly, fuse.EPERM for UnsupportedFeatureOff and
+	// UnsupportedImmutable.
+	ErrnoPolicy map[UnsupportedCondition]fuse.Errno
+
+	// SparseFileThreshold, if positive, makes a searchResultFile at or
+	// above this size (in bytes; see searchResultFile.size) use
+	// effectiveSparseReadahead's window instead of
+	// effectiveReadaheadWindow's for its rangedFileHandle, on the
+	// assumption that a file this large is more likely read by seeking
+	// around for small pieces (a media container's index, a specific
+	// member of an archive) than by streaming sequentially from the
+	// start, the pattern ReadaheadWindow is tuned for. Attr still reports
+	// the file's full size either way; only how much of it Open's handle
+	// ever fetches changes.
+	//
+	// The zero value (0) never applies: every file uses
+	// effectiveReadaheadWindow, exactly as before SparseFileThreshold
+	// existed.
+	SparseFileThreshold int64
+
+	// SparseReadahead is the window effectiveReadahead uses in place of
+	// ReadaheadWindow for a file SparseFileThreshold applies to. The zero
+	// value uses defaultSparseReadahead (64KB).
+	SparseReadahead int
+
+	// BlobrefLookupPolicy resolves the ambiguity in searchDir.Lookup's
+	// raw-blobref lookups; see the BlobrefLookupPolicy type in
+	// searchblobrefpolicy.go.
+	BlobrefLookupPolicy BlobrefLookupPolicy
+
+	// OpenContentPolicy controls what an already-open searchResultFile does
+	// when its underlying content changes; see the OpenContentPolicy type in
+	// searchopencontent.go.
+	OpenContentPolicy OpenContentPolicy
+
+	// SampleSize, if positive, makes ReadDirAll return a deterministic
+	// sample of this many entries instead of the full listing: a quick,
+	// representative preview of a result set too large to browse in full,
+	// rather than a head-truncated one that MaxResults alone would give.
+	// SampleStrategy picks how the sample is chosen, and SampleSeed seeds
+	// SampleRandom. The zero value (0) leaves ReadDirAll returning every
+	// entry, as before SampleSize existed.
+	//
+	// Sampling is applied after sorting and after MaxResults truncation,
+	// so it samples from whatever this directory would otherwise have
+	// listed, not from some larger, unfetched result set; a marker entry
+	// like truncatedMarkerName is never counted against SampleSize and
+	// always survives sampling.
+	SampleSize int
+
+	// SampleSize, if positive, makes ReadDirAll return a deterministic
+	// sample of this many entries instead of the full listing: a quick,
+	// representative preview of a result set too large to browse in full,
+	// rather than a head-truncated one that MaxResults alone would give.
+	// SampleStrategy picks how the sample is chosen, and SampleSeed seeds
+	// SampleRandom. The zero value (0) leaves ReadDirAll returning every
+	// entry, as before SampleSize existed.
+	//
+	// Sampling is applied after sorting and after MaxResults truncation,
+	// so it samples from whatever this directory would otherwise have
+	// listed, not from some larger, unfetched result set; a marker entry
+	// like truncatedMarkerName is never counted against SampleSize and
+	// always survives sampling.
+	SampleStrategy SampleStrategy
+
+	// SampleSize, if positive, makes ReadDirAll return a deterministic
+	// sample of this many entries instead of the full listing: a quick,
+	// representative preview of a result set too large to browse in full,
+	// rather than a head-truncated one that MaxResults alone would give.
+	// SampleStrategy picks how the sample is chosen, and SampleSeed seeds
+	// SampleRandom. The zero value (0) leaves ReadDirAll returning every
+	// entry, as before SampleSize existed.
+	//
+	// Sampling is applied after sorting and after MaxResults truncation,
+	// so it samples from whatever this directory would otherwise have
+	// listed, not from some larger, unfetched result set; a marker entry
+	// like truncatedMarkerName is never counted against SampleSize and
+	// always survives sampling.
+	SampleSeed int64
+
+	// NegativeLookupTTL, if set, replaces defaultNegLookupTTL as how long
+	// a Lookup miss is cached for, so repeated probes of a name that will
+	// never exist (e.g. a shell's tab completion, or an editor's ".swp"
+	// check) don't each pay for a fresh ReadDirAll or targeted query.
+	// Setting it to a negative value disables the negative cache entirely
+	// (every Lookup miss is treated as already expired).
+	//
+	// The zero value leaves defaultNegLookupTTL in effect.
+	NegativeLookupTTL time.Duration
+
+	// PrefetchConcurrency bounds how many of PrefetchCount's blobs a
+	// single prefetch pass fetches at once.
+	//
+	// The zero value uses defaultPrefetchConcurrency (4).
+	PrefetchConcurrency int
+
+	// EnableSearchStatsFile turns on searchStatsFileName. The zero value
+	// (false) keeps it unresolvable via Lookup, the same as if this
+	// feature didn't exist; the counters it reports are cheap enough to
+	// keep regardless, so unlike EnableFacetsFile/EnableTimelineFile this
+	// doesn't skip any work when unset, it just hides the file.
+	EnableSearchStatsFile bool
+
+	// SchemaMetaTTL bounds how long searchResultFile.Open trusts the
+	// schemaMeta a preceding Lookup resolved it with before falling back
+	// to a fresh schema.NewFileReader fetch, so a handle opened long after
+	// its Lookup doesn't keep serving a schema blob that may have since
+	// been replaced server-side.
+	//
+	// The zero value uses defaultSchemaMetaTTL.
+	SchemaMetaTTL time.Duration
+
+	// LazySchemaMeta makes searchResultDir.Lookup fall back to its old,
+	// lenient behavior when it can't fetch the looked-up blob's schema
+	// meta: logging the cause and returning the node anyway, leaving it
+	// to fail later on open with a less specific error. Without it,
+	// Lookup itself fails with fuse.ENOENT if the fetch failure looks like
+	// the blob genuinely doesn't exist (see blobNotFound), or fuse.EIO for
+	// anything else (a network error, a malformed schema blob), so a
+	// caller sees the real problem immediately instead of a confusing
+	// later failure. Either way the failure is counted via
+	// MetricsCollector.IncSchemaMetaFailure for diagnostics.
+	//
+	// The zero value (false) is the new, strict default; set this to
+	// restore the lenient behavior a mount may have been relying on.
+	LazySchemaMeta bool
+
+	// NoAtime disables the per-entry access-time tracking
+	// searchResultDir.recordAccess otherwise does on every Lookup/Open
+	// (see relatimeUpdate): a mount that doesn't care about atime, or is
+	// churning through a directory of results fast enough that even the
+	// relatime-throttled map write is unwelcome overhead, can set this to
+	// skip it entirely. searchResultFile.Attr then reports Mtime for
+	// Atime too, the same fallback it already uses when nothing's been
+	// recorded yet.
+	//
+	// The zero value (false) tracks atime, relatime-style, matching what
+	// most Linux filesystems default to these days.
+	NoAtime bool
+
+	// IncrementalReaddir, when set, makes doReaddir publish each page's
+	// resolved entries to n.ents (and the Lookup-able maps alongside it)
+	// as soon as that page finishes, via commitPartialReaddir, instead of
+	// only once the whole multi-page listing is done. A large query's
+	// first page becomes Lookup-able while doReaddir is still fetching its
+	// later pages, rather than a caller waiting on the entire listing
+	// before seeing anything.
+	//
+	// n.lastReaddir, the timestamp haveCachedListing checks against
+	// CamliFileSystem.SearchCacheTTL, is deliberately left untouched by
+	// commitPartialReaddir: it's only set once doReaddir's final commit
+	// runs, after the last page, so a partial listing is never mistaken
+	// for a fresh, complete one and served straight out of the cache.
+	//
+	// The zero value (false) preserves the historical behavior: doReaddir
+	// commits its one, final result only after every page has been
+	// fetched and processed.
+	IncrementalReaddir bool
+
+	// MIMEAllow and MIMEDeny are path.Match glob patterns (e.g.
+	// "image/*") matched against each entry's camliContent MIME type
+	// (de.Blob.File.MIMEType), applied by mimeFilterAllows in doReaddir
+	// right alongside ResultFilter: a client-side backstop for an
+	// expression like "is:image" that still lets through content the
+	// server's own index doesn't precisely classify. An entry matching
+	// any MIMEDeny pattern is excluded outright, even if it also matches
+	// MIMEAllow -- deny always wins. An entry with no MIME type at all
+	// (a set, symlink, contentless permanode, ...) is kept unless MIMEAllow
+	// is non-empty, since there's nothing for an allowlist to match
+	// against.
+	//
+	// The zero value (both nil) preserves the existing behavior of
+	// filtering on MIME type not at all.
+	MIMEAllow []string
+
+	// MIMEAllow and MIMEDeny are path.Match glob patterns (e.g.
+	// "image/*") matched against each entry's camliContent MIME type
+	// (de.Blob.File.MIMEType), applied by mimeFilterAllows in doReaddir
+	// right alongside ResultFilter: a client-side backstop for an
+	// expression like "is:image" that still lets through content the
+	// server's own index doesn't precisely classify. An entry matching
+	// any MIMEDeny pattern is excluded outright, even if it also matches
+	// MIMEAllow -- deny always wins. An entry with no MIME type at all
+	// (a set, symlink, contentless permanode, ...) is kept unless MIMEAllow
+	// is non-empty, since there's nothing for an allowlist to match
+	// against.
+	//
+	// The zero value (both nil) preserves the existing behavior of
+	// filtering on MIME type not at all.
+	MIMEDeny []string
+
+	// EnablePaging makes a truncated searchResultDir (see
+	// CamliFileSystem.MaxResults) additionally expose "page1", "page2",
+	// ... subdirectories, each a window of effectiveResultCap further
+	// results picked up right where the previous window (or, for page1,
+	// the main listing) left off, fetched via the search continue token
+	// doReaddir recorded at the point it stopped, instead of the whole
+	// listing. Only the page currently being browsed is ever resident; a
+	// page dir resolves (and caches) its own window once, the first time
+	// it's actually opened.
+	//
+	// ReadDirAll only lists as many page dirs as are currently known to
+	// exist: page1 as soon as a listing is truncated, and pageN+1 only
+	// once pageN has itself been opened and found more beyond it. Looking
+	// up a page past the last one currently known returns fuse.ENOENT,
+	// the same as any other name that doesn't exist yet.
+	//
+	// Unlike the main listing, a page window doesn't re-sort, dedup, or
+	// cluster its entries (effectiveSortBy, DedupByContent,
+	// SimilarityClusterAttr): doing so needs the whole listing in memory,
+	// which is exactly what paging avoids. It also skips ResultFilter and
+	// MIMEAllow/MIMEDeny, for the same reason sorting is skipped: applying
+	// them consistently across page boundaries would mean re-deriving the
+	// window sizes doReaddir's own truncate loop already committed to.
+	//
+	// The zero value (false) preserves the existing behavior of a
+	// truncated listing having no way to reach beyond its own cap except
+	// raising CamliFileSystem.MaxResults.
+	EnablePaging bool
+}
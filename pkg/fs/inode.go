@@ -0,0 +1,118 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+)
+
+// inodeTables holds each CamliFileSystem's blobref-to-inode mapping,
+// keyed by pointer identity the same way searchWatch.go's watchers
+// registry is, since CamliFileSystem itself isn't a type this package
+// adds fields to casually.
+var (
+	inodeTablesMu sync.Mutex
+	inodeTables   = map[*CamliFileSystem]*inodeTable{}
+)
+
+// inodeTable assigns search mount entries a stable inode number,
+// derived from their permanode's blobref, that holds for as long as
+// fsys is mounted: a refresh of a searchResultDir reuses the same
+// inode for the same permanode rather than whatever a file manager's
+// cache would otherwise treat as a brand new file.
+type inodeTable struct {
+	mu      sync.Mutex
+	byBlob  map[blob.Ref]uint64
+	byInode map[uint64]blob.Ref
+}
+
+func inodeTableFor(fsys *CamliFileSystem) *inodeTable {
+	inodeTablesMu.Lock()
+	defer inodeTablesMu.Unlock()
+	t, ok := inodeTables[fsys]
+	if !ok {
+		t = &inodeTable{
+			byBlob:  make(map[blob.Ref]uint64),
+			byInode: make(map[uint64]blob.Ref),
+		}
+		inodeTables[fsys] = t
+	}
+	return t
+}
+
+// inodeFor returns br's stable inode number, assigning one from a
+// hash of br's bytes the first time br is seen. If that hash
+// collides with a different blobref's already-assigned inode, br is
+// given the next free slot instead, so two unrelated permanodes can
+// never alias to the same inode.
+func (t *inodeTable) inodeFor(br blob.Ref) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ino, ok := t.byBlob[br]; ok {
+		return ino
+	}
+	h := fnv.New64a()
+	h.Write([]byte(br.String()))
+	ino := h.Sum64()
+	for {
+		if ino == 0 {
+			// 0 isn't a valid inode number in FUSE; skip it rather
+			// than special-case it in every caller.
+			ino = 1
+		}
+		owner, taken := t.byInode[ino]
+		if !taken || owner == br {
+			break
+		}
+		ino++
+	}
+	t.byBlob[br] = ino
+	t.byInode[ino] = br
+	return ino
+}
+
+// direntsWithInode is dirents, but with each entry's Inode field
+// filled in from refs (name to the blobref that identifies it) via
+// fsys's inodeTable. A name absent from refs is listed with inode 0,
+// the same as dirents leaves it.
+//
+// kinds gives each entry's fuse.DirentType (name to the type Lookup
+// would resolve that same name to), so a caller doesn't need to stat
+// every entry just to tell a file from a directory. A name absent
+// from kinds, or a nil kinds entirely, is listed as fuse.DT_File, the
+// common case and the same as before this parameter existed.
+func direntsWithInode(fsys *CamliFileSystem, names []string, refs map[string]blob.Ref, kinds map[string]fuse.DirentType) []fuse.Dirent {
+	t := inodeTableFor(fsys)
+	ents := make([]fuse.Dirent, len(names))
+	for i, name := range names {
+		d := fuse.Dirent{Name: name, Type: fuse.DT_File}
+		if typ, ok := kinds[name]; ok {
+			d.Type = typ
+		}
+		if br, ok := refs[name]; ok {
+			d.Inode = t.inodeFor(br)
+		}
+		ents[i] = d
+	}
+	return ents
+}
@@ -0,0 +1,131 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"hash/fnv"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/types"
+)
+
+// TestInodeForStableAcrossCalls checks inodeFor's basic contract: the
+// same blobref always maps to the same inode within one inodeTable,
+// and different blobrefs don't collide.
+func TestInodeForStableAcrossCalls(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	t1 := inodeTableFor(fsys)
+	br1 := blob.RefFromString("one")
+	br2 := blob.RefFromString("two")
+
+	ino1 := t1.inodeFor(br1)
+	ino2 := t1.inodeFor(br2)
+	if ino1 == ino2 {
+		t.Fatalf("inodeFor(%v) == inodeFor(%v) == %d; want distinct inodes", br1, br2, ino1)
+	}
+	if got := inodeTableFor(fsys).inodeFor(br1); got != ino1 {
+		t.Errorf("inodeFor(%v) on a later call = %d; want unchanged %d", br1, got, ino1)
+	}
+}
+
+// TestInodeForPerturbsOnCollision checks that two distinct blobrefs
+// forced to the same starting inode slot end up with distinct, stable
+// inodes rather than aliasing to one another.
+func TestInodeForPerturbsOnCollision(t *testing.T) {
+	tb := &inodeTable{
+		byBlob:  map[blob.Ref]uint64{},
+		byInode: map[uint64]blob.Ref{},
+	}
+	br1 := blob.RefFromString("collide-1")
+	br2 := blob.RefFromString("collide-2")
+
+	// Hand br1 the very slot inodeFor(br2) starts from (the fnv64a hash
+	// of br2's string form, with 0 mapped to 1), so inodeFor(br2) is
+	// forced to collide and must probe past it.
+	hash := fnv.New64a()
+	hash.Write([]byte(br2.String()))
+	forced := hash.Sum64()
+	if forced == 0 {
+		forced = 1
+	}
+	tb.byBlob[br1] = forced
+	tb.byInode[forced] = br1
+
+	ino2 := tb.inodeFor(br2)
+	if ino2 == forced {
+		t.Fatalf("inodeFor(%v) = %d, the slot already owned by %v", br2, ino2, br1)
+	}
+	if again := tb.inodeFor(br2); again != ino2 {
+		t.Errorf("inodeFor(%v) on a later call = %d; want unchanged %d", br2, again, ino2)
+	}
+	if tb.byBlob[br1] == ino2 {
+		t.Errorf("br1 and br2 ended up sharing inode %d", ino2)
+	}
+}
+
+// TestSearchResultDirInodeStableAcrossReaddirCycles checks the
+// scenario the request describes: an unchanged searchResultDir
+// listing keeps returning the same inode, for both Attr and the
+// Dirent ReadDirAll reports, across two separate ReadDirAll cycles
+// (simulated here by an "at" snapshot directory, whose
+// haveCachedListing is always true once seeded, so a second call
+// reuses the cached listing exactly the way a real refresh that found
+// nothing changed would).
+func TestSearchResultDirInodeStableAcrossReaddirCycles(t *testing.T) {
+	br := blob.RefFromString("unchanged-permanode")
+	n := &searchResultDir{
+		fs:          &CamliFileSystem{},
+		searchExp:   "is:file",
+		at:          &types.Time3339{},
+		lastReaddir: time.Now(),
+		lastNames:   []string{"photo.jpg"},
+		permanode:   map[string]blob.Ref{"photo.jpg": br},
+	}
+
+	first, err := n.ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatalf("first ReadDirAll() error = %v", err)
+	}
+	second, err := n.ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatalf("second ReadDirAll() error = %v", err)
+	}
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("ReadDirAll() = %v, %v; want one entry each", first, second)
+	}
+	if first[0].Inode == 0 {
+		t.Fatal("first ReadDirAll() Inode = 0; want a stable non-zero inode")
+	}
+	if first[0].Inode != second[0].Inode {
+		t.Errorf("Inode across two ReadDirAll cycles = %d, then %d; want unchanged", first[0].Inode, second[0].Inode)
+	}
+
+	fileNode := &searchResultFile{node: node{fs: n.fs, permanode: br}}
+	var a fuse.Attr
+	if err := fileNode.Attr(context.Background(), &a); err != nil {
+		t.Fatalf("Attr() error = %v", err)
+	}
+	if a.Inode != first[0].Inode {
+		t.Errorf("Attr().Inode = %d; want the same inode ReadDirAll reported, %d", a.Inode, first[0].Inode)
+	}
+}
@@ -19,12 +19,20 @@ limitations under the License.
 package fs
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
 )
 
 // searchDir implements fuse.Node and is a directory of search
@@ -32,8 +40,55 @@ import (
 // "file".
 type searchDir struct {
 	fs *CamliFileSystem
+
+	// mu guards rootDir, which backs CamliFileSystem.DefaultSearchExpression:
+	// when it's set, n behaves like that expression's own
+	// searchResultDir rather than the interactive "cd <expr>" root.
+	// It's built lazily and reused, rather than a fresh
+	// searchResultDir per call, so it keeps its own cache state
+	// across calls the same way any other searchResultDir does; see
+	// Forget for why this is a mutex-guarded field rather than a
+	// sync.Once.
+	mu      sync.Mutex
+	rootDir *searchResultDir
+}
+
+// root returns the embedded searchResultDir backing
+// CamliFileSystem.DefaultSearchExpression. It must only be called
+// once that's known to be non-empty.
+func (n *searchDir) root() *searchResultDir {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.rootDir == nil {
+		expr, err := n.fs.rewriteExpression(n.fs.DefaultSearchExpression)
+		if err != nil {
+			Logger.Printf("fs.search: DefaultSearchExpression: rewriting expression: %v", err)
+			expr = n.fs.DefaultSearchExpression
+		}
+		n.rootDir = &searchResultDir{fs: n.fs, searchExp: expr}
+	}
+	return n.rootDir
+}
+
+// Forget implements fs.NodeForgetter: it forgets the embedded rootDir,
+// if root ever built one, and drops n's own reference to it so a
+// later root() call (were n looked up again instead of being dropped
+// for good, as DefaultSearchExpression's singleton root normally is)
+// builds a fresh one rather than resurrecting state Forget just tore
+// down. Safe to call more than once: a second call finds n.rootDir
+// already nil and does nothing.
+func (n *searchDir) Forget() {
+	n.mu.Lock()
+	root := n.rootDir
+	n.rootDir = nil
+	n.mu.Unlock()
+	if root != nil {
+		root.Forget()
+	}
 }
 
+var _ fs.NodeForgetter = (*searchDir)(nil)
+
 var (
 	_ fs.Node               = (*searchDir)(nil)
 	_ fs.HandleReadDirAller = (*searchDir)(nil)
@@ -41,33 +96,564 @@ var (
 )
 
 func (n *searchDir) Attr(ctx context.Context, a *fuse.Attr) error {
-	a.Mode = os.ModeDir | 0500
-	a.Uid = uint32(os.Getuid())
-	a.Gid = uint32(os.Getgid())
+	warmupPinnedExpressions(n.fs)
+	a.Mode = os.ModeDir | n.fs.effectiveDirMode(0500)
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
 	return nil
 }
 
+// searchSearchInterval is the cache TTL for the content-search
+// directory (pkg/fs/content.go). searchResultDir has its own,
+// per-mount TTL instead; see CamliFileSystem.SearchCacheTTL.
 const searchSearchInterval = 10 * time.Second
 
 func (n *searchDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
-	return []fuse.Dirent{
-		{Name: "README.txt"},
-	}, nil
+	if n.fs.DefaultSearchExpression != "" {
+		return n.root().ReadDirAll(ctx)
+	}
+	if n.fs.NamedSearchesConfigFile != "" {
+		startNamedSearchesWatcher(n.fs)
+		cfg := namedSearchesFor(n.fs)
+		ents := []fuse.Dirent{{Name: "README.txt"}, {Name: recentDirName}, {Name: allRecentDirName}}
+		for name := range cfg.Views {
+			ents = append(ents, fuse.Dirent{Name: name})
+		}
+		return ents, nil
+	}
+	ents := []fuse.Dirent{{Name: "README.txt"}, {Name: recentDirName}, {Name: allRecentDirName}}
+	used := make(map[string]bool)
+	saved, err := n.savedSearches(ctx)
+	if err != nil {
+		Logger.Printf("fs.search: ReadDirAll: listing saved searches: %v", err)
+		return ents, nil
+	}
+	n.reconcileSavedSearchDirs(saved)
+	for name, ss := range saved {
+		used[name] = true
+		if n.fs.HideEmptySavedSearches && n.isSavedSearchEmpty(ctx, ss.Expr) {
+			continue
+		}
+		ents = append(ents, fuse.Dirent{Name: name})
+	}
+	for name := range n.fs.ExpressionAliases {
+		if used[name] {
+			// A saved search already claims this name; see
+			// Lookup's own precedence between the two.
+			continue
+		}
+		used[name] = true
+		ents = append(ents, fuse.Dirent{Name: name})
+	}
+	for _, expr := range n.fs.PinnedExpressions {
+		if used[expr] {
+			// Already listed as a saved search or alias of the same
+			// name; Lookup would resolve either one first anyway.
+			continue
+		}
+		used[expr] = true
+		ents = append(ents, fuse.Dirent{Name: expr})
+	}
+	return ents, nil
 }
 
-const searchReadme = `
-You are now in the "search" filesystem, where you can use 
-Perkeep's search functionality from the FUSE mount.  
+// searchReadmeDefault is served verbatim whenever searchReadmeTmpl
+// fails to render (so README.txt is never empty or an error page,
+// just the generic instructions it always used to be).
+const searchReadmeDefault = `
+You are now in the "search" filesystem, where you can use
+Perkeep's search functionality from the FUSE mount.
 
 Usage: cd "<search query>", e.g.:
 
 	cd "after:\"2015-10-01\" and is:image"
 
+A before:/after: value can also be given relative to now, e.g.
+"after:-7d" or "after:-1month"; it's expanded to a concrete date
+as of when you cd in, so re-entering the directory later shifts
+the window forward with it.
+
+A "#" suffix sets that directory's own limit/sort/ttl, without
+touching the mount's own settings, e.g.:
+
+	cd "is:image#limit=500&sort=-modtime&ttl=30s"
+
+A "sort:" token inside the expression itself requests the same
+ordering without a "#" suffix, e.g. "is:image sort:-size"; and
+"size>"/"size<" tokens filter results by byte size, e.g.
+"is:image size>1M size<10M". Both are parsed out of the expression
+before it's ever sent to the server.
+
+An expression containing a literal '/', or one that would otherwise
+be mistaken for one of this directory's own reserved prefixes/suffixes
+("match:", "sort:", a trailing '*', or a "#..." options suffix), can
+be given instead as "q:" followed by its url.PathEscape encoding, e.g.:
+
+	cd "q:camliContent%2Ffoo"
+
+An expression a shell's own quoting keeps mangling (e.g. losing track
+of nested quotes around "after:\"2015-10-01\"") can instead be given
+base64.RawURLEncoding-encoded with a "@b64:" prefix, which contains no
+characters any shell treats specially:
+
+	cd "@b64:YWZ0ZXI6IjIwMTUtMTAtMDEiIGFuZCBpczppbWFnZQ"
+
+The decoded expression is echoed back in that directory's ".query"
+file, to confirm it arrived as intended.
+
+To browse results as of a past point in time, see the "at"
+subdirectory instead. To search inside file contents rather than
+permanode attributes, see the "content" subdirectory. To browse a
+known set permanode's members directly by blobref, see the
+"members-of" subdirectory, e.g.:
+
+	cd members-of/sha224-0123456789abcdef...
+
+To combine several expressions' results into a single de-duplicated
+listing, "cd" into "union/" followed by the expressions separated by
+'|', e.g.:
+
+	cd union/is:image|is:video
+
+For a single "what's new everywhere" dashboard unioning every saved
+search and alias this mount knows about, newest first, see
+"all-recent".
+
+To see what's present on one side of a comparison but not the other
+(A minus B, by content rather than name or permanode), "cd" into
+"diff/" followed by the two expressions separated by '|', e.g.:
+
+	cd diff/is:image|camliMember:sha224-0123456789abcdef...
+
+Either side may instead pin the same or a different expression to a
+point in time with a trailing "@<time>", using the same time formats
+the "at" subdirectory accepts, to diff a single expression against
+its own past:
+
+	cd diff/is:image@-7d|is:image
+
+For a reference of the predicates the expression grammar supports,
+with examples, see the "help" subdirectory.
+
+This mount may also be configured with expression aliases: short names
+that expand to a full expression (or to another alias) without a round
+trip to the server, the way a saved search does but purely client-side.
+A saved search of the same name takes precedence over an alias.
+
 `
 
+// searchReadmeTmpl renders README.txt with this mount's actual
+// configuration spliced into the generic instructions, so a user
+// doesn't have to go cross-reference the server to know what they're
+// browsing.
+var searchReadmeTmpl = template.Must(template.New("searchReadme").Parse(searchReadmeDefault + `This mount's search endpoint is {{.Endpoint}}, with a result cache TTL
+of {{.CacheTTL}}. {{.SavedSearches}} saved search(es) are currently
+configured on the server.
+{{if .SavedSearchesUsage}}
+{{.SavedSearchesUsage}}
+{{end}}
+Every search result directory also has a hidden ".refresh" file:
+reading it, or writing any byte to it, invalidates that directory's
+cached listing, forcing the next "ls" to re-run the search instead of
+waiting out the cache TTL.
+{{if .MaxResultsUnlimited}}
+Each search result directory under here is uncapped: MaxResultsUnlimited
+disables even this package's own safety limit.
+{{else if .MaxResults}}
+Each search result directory under here is capped at {{.MaxResults}}
+entries; a listing cut short by that limit gets a ".truncated" marker
+entry.
+{{end}}{{if .RefreshPolicyNote}}
+{{.RefreshPolicyNote}}
+{{end}}{{if .CapabilitiesNote}}
+{{.CapabilitiesNote}}
+{{end}}{{if .MIMEFilterNote}}
+{{.MIMEFilterNote}}
+{{end}}`))
+
+// searchReadmeData is searchReadmeTmpl's input.
+type searchReadmeData struct {
+	Endpoint            string
+	CacheTTL            time.Duration
+	SavedSearches       int
+	SavedSearchesUsage  string
+	MaxResults          int
+	MaxResultsUnlimited bool
+	RefreshPolicyNote   string
+	CapabilitiesNote    string
+	MIMEFilterNote      string
+}
+
+// capabilitiesNote is searchReadmeData.CapabilitiesNote's value: a
+// summary of caps, for troubleshooting why a mount is or isn't taking
+// an optimal code path.
+func capabilitiesNote(caps ServerCapabilities) string {
+	return fmt.Sprintf(`This mount's server has confirmed support for: server-side sort=%v,
+index change subscriptions=%v, since-token conditional queries=%v. An
+unconfirmed capability defaults to false until a searchResultDir
+actually exercises it.`, caps.Sort, caps.ChangeNotify, caps.SinceQuery)
+}
+
+// refreshPolicyNote is searchReadmeData.RefreshPolicyNote's value for
+// policy, documenting the performance tradeoff of whichever
+// non-default RefreshPolicy this mount is configured with; "" for the
+// default RefreshPolicyTTL, which needs no extra explanation beyond
+// the CacheTTL line above.
+func refreshPolicyNote(policy RefreshPolicy) string {
+	switch policy {
+	case RefreshPolicyAlways:
+		return `This mount is configured with RefreshPolicyAlways: every "ls" re-runs
+its search against the server instead of reusing a cached listing, so
+listings are always fresh at the cost of paying a full query's latency
+every time.`
+	case RefreshPolicyOnChangeHint:
+		return `This mount is configured with RefreshPolicyOnChangeHint: a listing is
+reused until the server reports an index change, rather than expiring
+on a fixed TTL.`
+	default:
+		return ""
+	}
+}
+
+// mimeFilterNote is searchReadmeData.MIMEFilterNote's value: "" unless
+// this mount has a MIMEAllow or MIMEDeny configured, in which case it
+// spells out the active glob patterns so a user isn't left wondering
+// why an otherwise-matching file never shows up in a listing.
+func mimeFilterNote(fsys *CamliFileSystem) string {
+	if len(fsys.MIMEAllow) == 0 && len(fsys.MIMEDeny) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("This mount filters listings by content MIME type:")
+	if len(fsys.MIMEAllow) > 0 {
+		fmt.Fprintf(&b, " MIMEAllow=%v", fsys.MIMEAllow)
+	}
+	if len(fsys.MIMEDeny) > 0 {
+		fmt.Fprintf(&b, " MIMEDeny=%v", fsys.MIMEDeny)
+	}
+	b.WriteString(`. An entry whose MIME type is denied is excluded even
+if it also matches an allow pattern; an entry with no MIME type at
+all (a set, a symlink, ...) is kept unless an allowlist is
+configured.`)
+	return b.String()
+}
+
+// savedSearchesUsage is searchReadmeData.SavedSearchesUsage's value:
+// "" when there are no saved searches to use, since there's nothing
+// to point the user at yet.
+func savedSearchesUsage(count int) string {
+	if count == 0 {
+		return ""
+	}
+	return `A saved search is listed by its title as a subdirectory of "search"
+itself, behaving exactly like "cd"-ing into its stored expression
+directly, e.g. "cd my-saved-search".`
+}
+
+// savedSearchCount reports how many saved searches (permanodes with a
+// "camliNodeType" of "query") the server currently holds, for
+// README.txt's live stats.
+func (n *searchDir) savedSearchCount(ctx context.Context) (int, error) {
+	res, err := n.fs.queryWithFailover(ctx, n.fs.client, &search.SearchQuery{
+		Expression: "is:query",
+		Limit:      -1,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(res.Blobs), nil
+}
+
+// savedSearch is one entry from (*searchDir).savedSearches: a saved
+// search's stored expression, plus its own cache TTL if the
+// permanode carries savedSearchTTLAttr.
+type savedSearch struct {
+	Expr string
+	TTL  *time.Duration
+}
+
+// savedSearches returns the user's saved searches (permanodes with a
+// "camliNodeType" of "query") as a map from display name to
+// savedSearch, so ReadDirAll can list them as directories and Lookup
+// can resolve one by name, overriding CamliFileSystem.SearchCacheTTL
+// with its own TTL where one's set. A saved search missing a "title"
+// or "query" attr is skipped, since there's nothing to list or
+// resolve it as. Two saved searches sharing a title are disambiguated
+// the same way searchMemberDir.resolve disambiguates colliding member
+// names.
+func (n *searchDir) savedSearches(ctx context.Context) (map[string]savedSearch, error) {
+	res, err := n.fs.queryWithFailover(ctx, n.fs.client, &search.SearchQuery{
+		Expression: "is:query",
+		Limit:      -1,
+		Describe: &search.DescribeRequest{
+			Rules: []*search.DescribeRule{
+				{Attrs: []string{"title", "query", savedSearchTTLAttr}},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	saved := make(map[string]savedSearch)
+	if res.Describe == nil || res.Describe.Meta == nil {
+		return saved, nil
+	}
+	for _, ri := range res.Blobs {
+		meta := res.Describe.Meta.Get(ri.Blob)
+		if meta == nil || meta.Permanode == nil {
+			continue
+		}
+		title := meta.Permanode.Attr.Get("title")
+		query := meta.Permanode.Attr.Get("query")
+		if title == "" || query == "" {
+			continue
+		}
+		name := uniqueSavedSearchName(title, saved)
+		saved[name] = savedSearch{Expr: query, TTL: savedSearchTTL(meta.Permanode.Attr.Get(savedSearchTTLAttr))}
+	}
+	return saved, nil
+}
+
+// uniqueSavedSearchName returns a name for title that isn't already a
+// key of saved, suffixing ".2", ".3", and so on when two saved
+// searches share a title, the same collision scheme
+// searchMemberDir.resolve uses for colliding member names.
+func uniqueSavedSearchName(title string, saved map[string]savedSearch) string {
+	name := title
+	for i := 2; ; i++ {
+		if _, taken := saved[name]; !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s.%d", title, i)
+	}
+}
+
+// readme renders searchReadmeTmpl with n's live configuration,
+// falling back to searchReadmeDefault if rendering, or gathering the
+// data to render with, fails.
+func (n *searchDir) readme(ctx context.Context) string {
+	data := searchReadmeData{
+		Endpoint:            n.fs.SearchEndpoint,
+		CacheTTL:            n.fs.SearchCacheTTL,
+		MaxResults:          n.fs.MaxResults,
+		MaxResultsUnlimited: n.fs.MaxResults == MaxResultsUnlimited,
+		RefreshPolicyNote:   refreshPolicyNote(n.fs.RefreshPolicy),
+		CapabilitiesNote:    capabilitiesNote(capabilitiesFor(n.fs)),
+		MIMEFilterNote:      mimeFilterNote(n.fs),
+	}
+	count, err := n.savedSearchCount(ctx)
+	if err != nil {
+		Logger.Printf("fs.search: README: counting saved searches: %v", err)
+	} else {
+		data.SavedSearches = count
+	}
+	data.SavedSearchesUsage = savedSearchesUsage(data.SavedSearches)
+
+	var buf bytes.Buffer
+	if err := searchReadmeTmpl.Execute(&buf, data); err != nil {
+		Logger.Printf("fs.search: README: rendering template: %v", err)
+		return searchReadmeDefault
+	}
+	return buf.String()
+}
+
 func (n *searchDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if isIgnoredLookupName(n.fs, name) {
+		debugf("fs.search: Lookup(%q): ignored name, not running a query for it", name)
+		return nil, fuse.ENOENT
+	}
+	if name == statusFileName {
+		return statusFile{fs: n.fs}, nil
+	}
+	if name == readyFileName {
+		return readyFile{fs: n.fs}, nil
+	}
+	if name == configFileName {
+		return configFile{fs: n.fs}, nil
+	}
+	if name == describeRulesFileName {
+		return describeRulesFile{fs: n.fs}, nil
+	}
+	if name == manifestFileName {
+		return manifestFile{fs: n.fs}, nil
+	}
+	if name == flushCacheFileName {
+		return flushCacheControlFile{fs: n.fs}, nil
+	}
+	if n.fs.DefaultSearchExpression != "" {
+		return n.root().Lookup(ctx, name)
+	}
+	if expr, ok := decodeSearchExprPath(name); ok {
+		expr, err := expandExpressionMacros(n.fs, expr, time.Now())
+		if err != nil {
+			Logger.Printf("fs.search: Lookup(%q): %v", name, err)
+			return nil, fuse.EINVAL
+		}
+		return n.lookupResultDirFor(ctx, name, expandRelativeDates(expr, time.Now()), searchDirOptions{}, false, "")
+	}
+	if expr, ok, err := decodeBase64SearchExprPath(name); ok {
+		if err != nil {
+			Logger.Printf("fs.search: Lookup(%q): %v", name, err)
+			return nil, fuse.EINVAL
+		}
+		expr, err = expandExpressionMacros(n.fs, expr, time.Now())
+		if err != nil {
+			Logger.Printf("fs.search: Lookup(%q): %v", name, err)
+			return nil, fuse.EINVAL
+		}
+		return n.lookupResultDirFor(ctx, name, expandRelativeDates(expr, time.Now()), searchDirOptions{}, false, "")
+	}
 	if name == "README.txt" {
-		return staticFileNode(searchReadme), nil
+		return staticFileNode(n.readme(ctx)), nil
+	}
+	if name == "at" {
+		return &atDir{fs: n.fs}, nil
+	}
+	if name == "content" {
+		return &searchContentDir{fs: n.fs}, nil
+	}
+	if name == membersOfDirName {
+		return &membersOfDir{fs: n.fs}, nil
+	}
+	if name == trashDirName && n.fs.EnableTrashView {
+		return n.trashDir(), nil
+	}
+	if rest := strings.TrimPrefix(name, unionDirPrefix); rest != name {
+		return n.lookupUnionDir(name, rest)
+	}
+	if rest := strings.TrimPrefix(name, diffDirPrefix); rest != name {
+		return n.lookupDiffDir(name, rest)
+	}
+	if name == helpDirName {
+		return &helpDir{fs: n.fs}, nil
+	}
+	if name == permanodeDirName {
+		return &permanodeDir{fs: n.fs}, nil
+	}
+	if name == recentDirName {
+		return n.recentDir(), nil
+	}
+	if name == allRecentDirName {
+		return n.allRecentDir(ctx), nil
+	}
+	if br, ok := n.fs.blobrefLookupShortcut(name); ok {
+		return n.lookupBlobRef(ctx, br)
+	}
+	if n.fs.NamedSearchesConfigFile != "" {
+		startNamedSearchesWatcher(n.fs)
+		cfg := namedSearchesFor(n.fs)
+		if view, ok := cfg.Views[name]; ok {
+			opts, err := view.camlifsConfig.toOptions()
+			if err != nil {
+				Logger.Printf("fs.search: named search %q: %v", name, err)
+				return nil, fuse.EINVAL
+			}
+			expr, err := expandExpressionMacros(n.fs, view.Expr, time.Now())
+			if err != nil {
+				Logger.Printf("fs.search: Lookup(%q): %v", name, err)
+				return nil, fuse.EINVAL
+			}
+			return n.lookupResultDirFor(ctx, name, expandRelativeDates(expr, time.Now()), opts, true, "")
+		}
+		if cfg.Strict {
+			return nil, fuse.ENOENT
+		}
+	}
+	expr, opts, err := splitSearchOptions(name)
+	if err != nil {
+		Logger.Printf("fs.search: Lookup(%q): %v", name, err)
+		return nil, fuse.EINVAL
+	}
+	trusted := false
+	savedSearchName := ""
+	saved, err := n.savedSearches(ctx)
+	if err != nil {
+		Logger.Printf("fs.search: Lookup(%q): listing saved searches: %v", name, err)
+	} else if ss, ok := saved[expr]; ok {
+		savedSearchName = expr
+		expr = ss.Expr
+		trusted = true
+		if ss.TTL != nil && opts.ttl == nil {
+			opts.ttl = ss.TTL
+		}
+	} else if aliasExpr, ok, aerr := n.fs.expandAlias(expr); aerr != nil {
+		Logger.Printf("fs.search: Lookup(%q): %v", name, aerr)
+		return nil, fuse.EINVAL
+	} else if ok {
+		expr = aliasExpr
+		trusted = true
+	} else if combined, isCombine, cerr := combineSavedSearches(expr, saved); isCombine {
+		if cerr != nil {
+			Logger.Printf("fs.search: Lookup(%q): %v", name, cerr)
+			return nil, fuse.ENOENT
+		}
+		expr = combined
+		trusted = true
+	} else if n.fs.BlobrefLookupPolicy == ExpressionFirst {
+		// Neither a saved search nor an alias claims this name: under
+		// ExpressionFirst, a bare blobref-shaped name is only
+		// resolved as one once it's lost to those, the opposite
+		// precedence from BlobrefFirst's unconditional early check
+		// above.
+		if br, ok := blob.Parse(name); ok {
+			return n.lookupBlobRef(ctx, br)
+		}
+	}
+	expr, err = expandExpressionMacros(n.fs, expr, time.Now())
+	if err != nil {
+		Logger.Printf("fs.search: Lookup(%q): %v", name, err)
+		return nil, fuse.EINVAL
+	}
+	return n.lookupResultDirFor(ctx, name, expandRelativeDates(expr, time.Now()), opts, trusted, savedSearchName)
+}
+
+// resultDirFor returns the searchResultDir for rawName (the Lookup
+// name as given, options and all), reusing the one already cached
+// under it (so its TTL cache keeps working across repeated "cd"s into
+// the same expression) or building one from expr and opts and caching
+// it via n.fs's searchDirCache. rawName, not expr, is the cache key so
+// that two different searchDirOptionsSep suffixes on the same
+// expression get their own independently tuned, independently cached
+// directories instead of colliding.
+//
+// With CamliFileSystem.SearchExprCaseInsensitiveCache set, the cache
+// key is folded to lowercase, so a host filesystem that re-presents
+// the same logical path in a different case (as case-insensitive
+// hosts are free to do between one "cd" and the next) reuses the
+// searchResultDir its first, case-preserved Lookup already created,
+// rather than building a second one whose query is silently run in
+// whatever case the host happened to hand back. expr itself is never
+// folded: d.searchExp keeps the exact case it was first constructed
+// with for as long as d stays cached, regardless of the case any
+// later rawName arrives in.
+func (n *searchDir) resultDirFor(rawName, expr string, opts searchDirOptions, savedSearchName string) *searchResultDir {
+	cache := searchDirCacheFor(n.fs)
+	cacheKey := rawName
+	if n.fs.SearchExprCaseInsensitiveCache {
+		cacheKey = strings.ToLower(rawName)
+	}
+	if d, ok := cache.get(cacheKey); ok {
+		return d
+	}
+	d := &searchResultDir{fs: n.fs, searchExp: expr, cacheKey: cacheKey, savedSearchName: savedSearchName}
+	opts.applyTo(d)
+	cache.add(cacheKey, d)
+	return d
+}
+
+// lookupBlobRef resolves br directly, the way a camliMember is
+// resolved for a set, so that "cd mount/search/sha224-abc..." behaves
+// like the permanode's content rather than requiring a search
+// expression that happens to match just it.
+func (n *searchDir) lookupBlobRef(ctx context.Context, br blob.Ref) (fs.Node, error) {
+	e, ok, err := dir.ResolveMember(ctx, n.fs.client, br, nil)
+	if err != nil {
+		Logger.Printf("fs.search: Lookup(%v): %v", br, err)
+		return nil, fuse.EIO
+	}
+	if !ok {
+		return nil, fuse.ENOENT
 	}
-	return &searchResultDir{fs: n.fs, searchExp: name}, nil
+	return entryNode(n.fs, e, nil), nil
 }
@@ -0,0 +1,263 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// byDateDirName is the reserved name of the year/month/day drill-down
+// tree under a search result directory. Unlike "by-year" (facetDir),
+// which re-queries the index narrowed by a client-side timeRange,
+// byDateDirName's tree is built entirely from the parent's own
+// n.modTime, already computed by ReadDirAll, so listing or looking up
+// anywhere in it costs no extra query.
+const byDateDirName = "byYear"
+
+// byDateDir is one level of that tree: the root (year == ""), a year
+// (month == ""), a month (day == ""), or a day, which lists the
+// parent's actual entries rather than another bucket level.
+type byDateDir struct {
+	parent           *searchResultDir
+	year, month, day string
+}
+
+var (
+	_ fs.Node               = (*byDateDir)(nil)
+	_ fs.HandleReadDirAller = (*byDateDir)(nil)
+	_ fs.NodeStringLookuper = (*byDateDir)(nil)
+)
+
+func (d *byDateDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+// isLeaf reports whether d is a day directory, whose entries are the
+// parent's actual files rather than a further bucket level.
+func (d *byDateDir) isLeaf() bool {
+	return d.day != ""
+}
+
+// matches reports whether mt falls in d's bucket: every level of d
+// that's already been chosen (year, then month, then day) must agree.
+func (d *byDateDir) matches(mt time.Time) bool {
+	if d.year != "" && mt.Format("2006") != d.year {
+		return false
+	}
+	if d.month != "" && mt.Format("01") != d.month {
+		return false
+	}
+	if d.day != "" && mt.Format("02") != d.day {
+		return false
+	}
+	return true
+}
+
+// nextBucket returns the name mt falls under at the level immediately
+// below d; it must not be called on a leaf (day) directory.
+func (d *byDateDir) nextBucket(mt time.Time) string {
+	switch {
+	case d.year == "":
+		return mt.Format("2006")
+	case d.month == "":
+		return mt.Format("01")
+	default:
+		return mt.Format("02")
+	}
+}
+
+// child returns the byDateDir one level below d for the given bucket
+// name; it must not be called on a leaf (day) directory.
+func (d *byDateDir) child(name string) *byDateDir {
+	c := &byDateDir{parent: d.parent, year: d.year, month: d.month, day: d.day}
+	switch {
+	case c.year == "":
+		c.year = name
+	case c.month == "":
+		c.month = name
+	default:
+		c.day = name
+	}
+	return c
+}
+
+func (d *byDateDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var names []string
+	for name, mt := range d.parent.modTime {
+		if !d.matches(mt) {
+			continue
+		}
+		if d.isLeaf() {
+			names = append(names, name)
+			continue
+		}
+		next := d.nextBucket(mt)
+		if !seen[next] {
+			seen[next] = true
+			names = append(names, next)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if d.isLeaf() {
+		kinds := d.parent.entryKinds(names)
+		ents := make([]fuse.Dirent, len(names), len(names)+1)
+		for i, name := range names {
+			ents[i] = fuse.Dirent{Name: name, Type: kinds[name]}
+		}
+		ents = append(ents, fuse.Dirent{Name: latestEntryName, Type: fuse.DT_Link})
+		return ents, nil
+	}
+	ents := append(dirents(names, fuse.DT_Dir), fuse.Dirent{Name: latestEntryName, Type: fuse.DT_Link})
+	return ents, nil
+}
+
+func (d *byDateDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == latestEntryName {
+		if err := d.parent.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		target, ok := d.latestTarget()
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		return &byDateLatestSymlink{dir: d, target: target}, nil
+	}
+	if d.isLeaf() {
+		// Leaf entries are the parent's own files; delegate so the
+		// returned node carries the same permanode/xattr info a
+		// direct Lookup against the parent would.
+		return d.parent.Lookup(ctx, name)
+	}
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	for _, mt := range d.parent.modTime {
+		if d.matches(mt) && d.nextBucket(mt) == name {
+			return d.child(name), nil
+		}
+	}
+	return nil, fuse.ENOENT
+}
+
+// latestEntryName is the symlink every byDateDir bucket exposes
+// alongside its real entries, pointing at the most recently modified
+// file anywhere within that bucket (see latestTarget). A bucket with
+// no entries has no latestEntryName either.
+const latestEntryName = "latest"
+
+// latestTarget reports the path, relative to d itself, of the most
+// recently modified file in d's bucket, or ok=false if the bucket is
+// empty. For a leaf (day) directory that's just the file's own name;
+// for a year, month, or the byDateDirName root, it's the remaining
+// year/month/day components down to that day, joined with the name,
+// since those levels don't list files directly.
+func (d *byDateDir) latestTarget() (target string, ok bool) {
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	var best string
+	var bestMt time.Time
+	for name, mt := range d.parent.modTime {
+		if !d.matches(mt) {
+			continue
+		}
+		if best == "" || mt.After(bestMt) {
+			best, bestMt = name, mt
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	if d.isLeaf() {
+		return best, true
+	}
+	var parts []string
+	if d.year == "" {
+		parts = append(parts, bestMt.Format("2006"))
+	}
+	if d.month == "" {
+		parts = append(parts, bestMt.Format("01"))
+	}
+	if d.day == "" {
+		parts = append(parts, bestMt.Format("02"))
+	}
+	parts = append(parts, best)
+	return path.Join(parts...), true
+}
+
+// byDateLatestSymlink is latestEntryName's node: a symlink from a
+// byDateDir bucket to the most recent file within it, recomputed by
+// Lookup on every access so it tracks d.parent's modTime across
+// refreshes rather than being fixed at some earlier listing.
+type byDateLatestSymlink struct {
+	dir    *byDateDir
+	target string
+}
+
+var (
+	_ fs.Node           = (*byDateLatestSymlink)(nil)
+	_ fs.NodeReadlinker = (*byDateLatestSymlink)(nil)
+)
+
+func (s *byDateLatestSymlink) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeSymlink | 0777
+	a.Valid = s.dir.parent.fs.effectiveAttrValidity()
+	a.Uid = s.dir.parent.fs.effectiveUid()
+	a.Gid = s.dir.parent.fs.effectiveGid()
+	return nil
+}
+
+func (s *byDateLatestSymlink) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	return s.target, nil
+}
+
+// ensureSeeded forces a ReadDirAll on n if it hasn't been listed yet,
+// so byDateDir can bucket n.modTime without running its own query.
+func (n *searchResultDir) ensureSeeded(ctx context.Context) error {
+	n.mu.Lock()
+	seeded := n.ents != nil
+	n.mu.Unlock()
+	if seeded {
+		return nil
+	}
+	_, err := n.ReadDirAll(ctx)
+	return err
+}
@@ -0,0 +1,56 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestByDateDirLatestTarget checks latestTarget at the root, a year,
+// and a day (leaf) level, and that an empty bucket reports ok=false.
+func TestByDateDirLatestTarget(t *testing.T) {
+	parent := &searchResultDir{
+		modTime: map[string]time.Time{
+			"a.jpg": time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+			"b.jpg": time.Date(2023, 3, 5, 0, 0, 0, 0, time.UTC),
+			"c.jpg": time.Date(2023, 3, 9, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	root := &byDateDir{parent: parent}
+	if target, ok := root.latestTarget(); !ok || target != "2023/03/09/c.jpg" {
+		t.Errorf("root.latestTarget() = (%q, %v); want (%q, true)", target, ok, "2023/03/09/c.jpg")
+	}
+
+	year := &byDateDir{parent: parent, year: "2023"}
+	if target, ok := year.latestTarget(); !ok || target != "03/09/c.jpg" {
+		t.Errorf("year.latestTarget() = (%q, %v); want (%q, true)", target, ok, "03/09/c.jpg")
+	}
+
+	day := &byDateDir{parent: parent, year: "2023", month: "03", day: "09"}
+	if target, ok := day.latestTarget(); !ok || target != "c.jpg" {
+		t.Errorf("day.latestTarget() = (%q, %v); want (%q, true)", target, ok, "c.jpg")
+	}
+
+	empty := &byDateDir{parent: parent, year: "2019"}
+	if target, ok := empty.latestTarget(); ok {
+		t.Errorf("empty.latestTarget() = (%q, %v); want ok=false", target, ok)
+	}
+}
@@ -0,0 +1,145 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+)
+
+// tagExpressionRE matches a searchResultDir's searchExp when it's
+// nothing but a single "tag:value" predicate (quoted or not), the
+// only predicate Create currently knows how to satisfy for a new
+// permanode: other predicates, like "after:...", describe an
+// attribute a freshly created permanode has no sensible value for.
+var tagExpressionRE = regexp.MustCompile(`^tag:(?:"([^"]*)"|(\S+))$`)
+
+// tagForExpression reports the tag value a new permanode must be set
+// to in order to already match expr, if expr is satisfiable that way.
+func tagForExpression(expr string) (tag string, ok bool) {
+	m := tagExpressionRE.FindStringSubmatch(expr)
+	if m == nil {
+		return "", false
+	}
+	if m[1] != "" {
+		return m[1], true
+	}
+	return m[2], m[2] != ""
+}
+
+// Create implements fs.NodeCreater: copying a file into a mounted
+// search directory uploads it as a new permanode tagged (or otherwise
+// attributed) to match n's search expression, so it shows up in n's
+// own listing without the caller having to know anything about
+// permanodes. It's only supported for expressions Create can satisfy
+// this way (currently just "tag:value"); anything else, like
+// "after:...", is rejected outright rather than silently creating a
+// file that won't appear where it was just written.
+func (n *searchResultDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	if err := n.fs.checkWritable(); err != nil {
+		return nil, nil, err
+	}
+	if n.at != nil {
+		return nil, nil, n.fs.effectiveUnsupportedErrno(UnsupportedImmutable)
+	}
+	tag, ok := tagForExpression(n.searchExp)
+	if !ok {
+		Logger.Printf("fs.searchResultDir: Create(%q): search expression %q has no attrs a new permanode can be given to match it", req.Name, n.searchExp)
+		return nil, nil, fuse.EPERM
+	}
+
+	pn, err := n.fs.client.UploadNewPermanode(ctx)
+	if err != nil {
+		Logger.Printf("fs.searchResultDir: Create(%q): creating permanode: %v", req.Name, err)
+		return nil, nil, fuse.EIO
+	}
+	claim := schema.NewSetAttributeClaim(pn.BlobRef, "tag", tag)
+	if _, err := n.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+		Logger.Printf("fs.searchResultDir: Create(%q): tagging: %v", req.Name, err)
+		return nil, nil, fuse.EIO
+	}
+
+	nod := &searchResultFile{
+		node:      node{fs: n.fs, blobref: pn.BlobRef}, // blobref is corrected to the file's once Release uploads its content
+		permanode: pn.BlobRef,
+	}
+	return nod, &searchCreateHandle{n: n, nod: nod, name: req.Name, permanode: pn.BlobRef}, nil
+}
+
+// searchCreateHandle buffers a new file's content between Create and
+// Release, when its full content is uploaded as a single blob and set
+// as its permanode's camliContent. Buffering the whole write spikes
+// memory for a large file, but that's an acceptable tradeoff here
+// since files created this way are expected to be small sidecar
+// uploads, not bulk imports.
+type searchCreateHandle struct {
+	n         *searchResultDir
+	nod       *searchResultFile
+	name      string
+	permanode blob.Ref
+	buf       bytes.Buffer
+}
+
+var (
+	_ fs.Handle         = (*searchCreateHandle)(nil)
+	_ fs.HandleWriter   = (*searchCreateHandle)(nil)
+	_ fs.HandleReleaser = (*searchCreateHandle)(nil)
+)
+
+// Write implements fs.HandleWriter. Only sequential, in-order writes
+// are supported, since that's all a plain "cp into the mount" needs;
+// anything else is rejected rather than silently reordered.
+func (h *searchCreateHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := h.n.fs.checkWritable(); err != nil {
+		return err
+	}
+	if req.Offset != int64(h.buf.Len()) {
+		Logger.Printf("fs.searchCreateHandle: Write(%q): out-of-order write at offset %d (have %d bytes)", h.name, req.Offset, h.buf.Len())
+		return fuse.EIO
+	}
+	n, err := h.buf.Write(req.Data)
+	resp.Size = n
+	return err
+}
+
+// Release implements fs.HandleReleaser: it uploads the buffered
+// content as a file blob, points the permanode's camliContent at it,
+// and invalidates the parent directory's cache so the new file shows
+// up in the very next ReadDirAll rather than waiting out the TTL.
+func (h *searchCreateHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	fileRef, err := schema.WriteFileFromReader(ctx, h.n.fs.client, h.name, bytes.NewReader(h.buf.Bytes()))
+	if err != nil {
+		Logger.Printf("fs.searchCreateHandle: Release(%q): uploading: %v", h.name, err)
+		return fuse.EIO
+	}
+	claim := schema.NewSetAttributeClaim(h.permanode, "camliContent", fileRef.String())
+	if _, err := h.n.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+		Logger.Printf("fs.searchCreateHandle: Release(%q): setting camliContent: %v", h.name, err)
+		return fuse.EIO
+	}
+	h.nod.blobref = fileRef
+	h.n.invalidateCache()
+	return nil
+}
@@ -0,0 +1,87 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/types"
+)
+
+// TestTagForExpression checks which search expressions Create
+// considers "taggable" (satisfiable by tagging a freshly created
+// permanode): a bare or quoted tag:value predicate and nothing else.
+func TestTagForExpression(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantTag string
+		wantOK  bool
+	}{
+		{`tag:vacation`, "vacation", true},
+		{`tag:"with spaces"`, "with spaces", true},
+		{`tag:""`, "", false}, // an empty quoted value has nothing to match m[1]
+		{`is:image`, "", false},
+		{`tag:vacation and is:image`, "", false},
+		{`(tag:vacation)`, "", false},
+		{``, "", false},
+	}
+	for _, tt := range tests {
+		tag, ok := tagForExpression(tt.expr)
+		if tag != tt.wantTag || ok != tt.wantOK {
+			t.Errorf("tagForExpression(%q) = %q, %v; want %q, %v", tt.expr, tag, ok, tt.wantTag, tt.wantOK)
+		}
+	}
+}
+
+// TestCreateRejectsNonTaggableExpression checks that Create fails
+// with fuse.EPERM for a search expression tagForExpression can't
+// satisfy, without ever reaching n.fs.client.
+func TestCreateRejectsNonTaggableExpression(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image"}
+	_, _, err := n.Create(context.Background(), &fuse.CreateRequest{Name: "photo.jpg"}, &fuse.CreateResponse{})
+	if err != fuse.EPERM {
+		t.Errorf("Create() on a non-taggable expression = %v; want fuse.EPERM", err)
+	}
+}
+
+// TestCreateRejectsReadOnly checks that Create is blocked by
+// CamliFileSystem.ReadOnly before it ever looks at the search
+// expression.
+func TestCreateRejectsReadOnly(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{ReadOnly: true}, searchExp: "tag:vacation"}
+	_, _, err := n.Create(context.Background(), &fuse.CreateRequest{Name: "photo.jpg"}, &fuse.CreateResponse{})
+	if err != fuse.EROFS {
+		t.Errorf("Create() on a ReadOnly mount = %v; want fuse.EROFS", err)
+	}
+}
+
+// TestCreateRejectsSnapshotDir checks that Create is blocked against
+// a pinned ("at") directory, which is immutable regardless of its
+// expression's taggability.
+func TestCreateRejectsSnapshotDir(t *testing.T) {
+	at := types.Time3339FromTime(time.Now())
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "tag:vacation", at: &at}
+	_, _, err := n.Create(context.Background(), &fuse.CreateRequest{Name: "photo.jpg"}, &fuse.CreateResponse{})
+	if err != n.fs.effectiveUnsupportedErrno(UnsupportedImmutable) {
+		t.Errorf("Create() on a snapshot dir = %v; want %v", err, n.fs.effectiveUnsupportedErrno(UnsupportedImmutable))
+	}
+}
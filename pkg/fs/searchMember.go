@@ -0,0 +1,269 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+	"perkeep.org/pkg/types"
+)
+
+// searchMemberDir lists a set permanode's camliMember values (see
+// dir.Entry.IsSet): each member that resolves to a file or directory
+// becomes a searchResultFile, and each that's itself a collection
+// becomes a nested searchMemberDir.
+//
+// Unlike searchResultDir, which is seeded from one search query,
+// each member here is described individually via dir.ResolveMember,
+// since a camliMember isn't itself a search result.
+type searchMemberDir struct {
+	fs        *CamliFileSystem
+	at        *types.Time3339
+	permanode blob.Ref
+	pnodeMeta *search.DescribedBlob
+	members   []blob.Ref
+	// membersTruncated is true when members only holds the first
+	// CamliFileSystem.MaxInlineSetMembers of this set's camliMember
+	// values (see dir.Entry.MembersTruncated), rather than every one of
+	// them: resolve notices this and re-fetches the full list via
+	// dir.ResolveSetMembers the first time this directory is actually
+	// opened, rather than silently listing only part of a large set.
+	membersTruncated bool
+	// ancestors holds every permanode already on the path from the
+	// mount's search result down to this directory, this one
+	// included. A member whose own permanode is already in here would
+	// recurse forever, so it's skipped instead (see resolve).
+	ancestors map[blob.Ref]bool
+	// parentMeta is the Meta union of the describe call that resolved
+	// n itself as a set member (dir.Entry.Meta), or nil if n wasn't
+	// built from one (the root searchMemberDir under a search result,
+	// or a set built from a truncated Members list re-fetched via
+	// dir.ResolveSetMembers, which has no single describe call's worth
+	// of meta to retain). resolve tries it first for each of n's own
+	// members via dir.ResolveMemberFromMeta before describing a member
+	// outright, since memberDescribeRules' camliMember rule often
+	// means it already covers them. Deliberately just one level, not
+	// an accumulated chain back to the root: that bounds the retained
+	// metadata to one describe response's worth regardless of how deep
+	// the set nesting goes.
+	parentMeta search.MetaMap
+
+	mu       sync.Mutex
+	resolved map[string]dir.Entry // name to resolved member entry, filled in lazily by resolve
+}
+
+var (
+	_ fs.Node               = (*searchMemberDir)(nil)
+	_ fs.HandleReadDirAller = (*searchMemberDir)(nil)
+	_ fs.NodeStringLookuper = (*searchMemberDir)(nil)
+	_ fs.NodeGetxattrer     = (*searchMemberDir)(nil)
+	_ fs.NodeListxattrer    = (*searchMemberDir)(nil)
+)
+
+func (n *searchMemberDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	if n.permanode.Valid() {
+		a.Inode = inodeTableFor(n.fs).inodeFor(n.permanode)
+	}
+	return nil
+}
+
+// camliXattrs returns the user.camli.* extended attributes for n's
+// own permanode, mirroring searchResultFile.camliXattrs' naming but
+// only the handful of entries that make sense for a set rather than a
+// file: "user.camli.mime" reports directoryMIMEType, since a set has
+// no ccMeta.File.MIMEType to report, so a script that branches on MIME
+// type doesn't need a separate check for a directory-like result.
+func (n *searchMemberDir) camliXattrs() map[string]string {
+	xattrs := map[string]string{
+		"user.camli.permanode": n.permanode.String(),
+		"user.camli.mime":      directoryMIMEType,
+	}
+	if name := n.fs.MIMETypeXattrName; name != "" {
+		xattrs[name] = directoryMIMEType
+	}
+	return xattrs
+}
+
+// Getxattr implements fs.NodeGetxattrer; see camliXattrs.
+func (n *searchMemberDir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	v, ok := n.camliXattrs()[req.Name]
+	if !ok {
+		return fuse.ErrNoXattr
+	}
+	resp.Xattr = []byte(v)
+	return nil
+}
+
+// Listxattr implements fs.NodeListxattrer.
+func (n *searchMemberDir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	for name := range n.camliXattrs() {
+		resp.Append(name)
+	}
+	return nil
+}
+
+// resolve describes every member not already on n.ancestors (breaking
+// cycles) and caches the result in n.resolved, resolving only once per
+// searchMemberDir instance.
+func (n *searchMemberDir) resolve(ctx context.Context) (map[string]dir.Entry, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.resolved != nil {
+		return n.resolved, nil
+	}
+
+	if n.membersTruncated {
+		if d, ok := n.fs.client.(dir.Describer); ok {
+			full, ok, err := dir.ResolveSetMembers(ctx, d, n.permanode, n.at)
+			if err != nil {
+				Logger.Printf("fs.searchMemberDir: re-fetching full member list for %v: %v", n.permanode, err)
+			} else if ok {
+				n.members = full
+			}
+		}
+		n.membersTruncated = false
+	}
+
+	resolved := make(map[string]dir.Entry)
+	for _, member := range n.members {
+		if n.ancestors[member] {
+			Logger.Printf("fs.searchMemberDir: skipping %v under %v: would form a cycle", member, n.permanode)
+			continue
+		}
+		e, ok, covered := dir.ResolveMemberFromMeta(member, n.parentMeta)
+		if !covered {
+			var err error
+			e, ok, err = dir.ResolveMember(ctx, n.fs.client, member, n.at)
+			if err != nil {
+				Logger.Printf("fs.searchMemberDir: resolving member %v: %v", member, err)
+				return nil, fuse.EIO
+			}
+		}
+		if !ok {
+			continue
+		}
+		name := e.Name
+		for i := 2; ; i++ {
+			if _, taken := resolved[name]; !taken {
+				break
+			}
+			// Two different members resolved to the same name (e.g.
+			// two permanodes both named "photo.jpg"); disambiguate.
+			name = fmt.Sprintf("%s.%d", e.Name, i)
+		}
+		resolved[name] = e
+	}
+	n.resolved = resolved
+	return resolved, nil
+}
+
+func (n *searchMemberDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	resolved, err := n.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(resolved))
+	refs := make(map[string]blob.Ref, len(resolved))
+	kinds := make(map[string]fuse.DirentType, len(resolved))
+	for name, e := range resolved {
+		names = append(names, name)
+		refs[name] = e.Permanode
+		kinds[name] = memberDirentKind(n.fs, e)
+	}
+	return direntsWithInode(n.fs, names, refs, kinds), nil
+}
+
+// memberDirentKind reports the fuse.DirentType Lookup resolves e to:
+// fuse.DT_Link when fsys.SymlinkContent redirects e to a
+// byBlobRefSymlink, fuse.DT_Dir for a set (see dir.Entry.IsSet),
+// fuse.DT_File for everything else, the same as Lookup's own
+// SymlinkContent/IsSet checks below.
+func memberDirentKind(fsys *CamliFileSystem, e dir.Entry) fuse.DirentType {
+	if fsys.SymlinkContent && e.Permanode.Valid() {
+		return fuse.DT_Link
+	}
+	if e.IsSet {
+		return fuse.DT_Dir
+	}
+	return fuse.DT_File
+}
+
+func (n *searchMemberDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == memberSearchDirName {
+		return &memberSearchDir{member: n}, nil
+	}
+	resolved, err := n.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := resolved[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	if n.fs.SymlinkContent && e.Permanode.Valid() {
+		return &byBlobRefSymlink{
+			node:      node{fs: n.fs, pnodeModTime: e.ModTime},
+			permanode: e.Permanode,
+		}, nil
+	}
+	if e.IsSet {
+		childAncestors := make(map[blob.Ref]bool, len(n.ancestors)+1)
+		for ref := range n.ancestors {
+			childAncestors[ref] = true
+		}
+		childAncestors[e.Permanode] = true
+		return &searchMemberDir{
+			fs:               n.fs,
+			at:               n.at,
+			permanode:        e.Permanode,
+			pnodeMeta:        e.PNodeMeta,
+			members:          e.Members,
+			membersTruncated: e.MembersTruncated,
+			ancestors:        childAncestors,
+			parentMeta:       e.Meta,
+		}, nil
+	}
+	nod := &searchResultFile{
+		node: node{
+			fs:           n.fs,
+			blobref:      e.Blob.BlobRef,
+			pnodeModTime: e.ModTime,
+		},
+		readOnly:  n.at != nil,
+		permanode: e.Permanode,
+		pnodeMeta: e.PNodeMeta,
+		imageMeta: e.Image,
+	}
+	if e.Blob.File != nil {
+		nod.mimeType = e.Blob.File.MIMEType
+	}
+	return nod, nil
+}
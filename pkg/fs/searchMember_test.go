@@ -0,0 +1,93 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// TestSearchMemberDirReadDirAllListsMembers checks that ReadDirAll
+// lists every already-resolved member of a set, as two file members
+// the way a set permanode with camliMember: file1, camliMember: file2
+// would resolve. Member resolution itself goes through dir.ResolveMember,
+// which needs a real search client, so this seeds n.resolved directly
+// (the same lazy cache resolve itself fills in) rather than a network
+// round trip.
+func TestSearchMemberDirReadDirAllListsMembers(t *testing.T) {
+	n := &searchMemberDir{
+		fs:        &CamliFileSystem{},
+		permanode: blob.MustParse("sha224-" + strings.Repeat("a", 56)),
+		resolved: map[string]dir.Entry{
+			"one.txt": {Name: "one.txt", Permanode: blob.MustParse("sha224-" + strings.Repeat("b", 56))},
+			"two.txt": {Name: "two.txt", Permanode: blob.MustParse("sha224-" + strings.Repeat("c", 56))},
+		},
+	}
+	ents, err := n.ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatalf("ReadDirAll = %v", err)
+	}
+	got := map[string]fuse.DirentType{}
+	for _, e := range ents {
+		got[e.Name] = e.Type
+	}
+	if len(got) != 2 || got["one.txt"] != fuse.DT_File || got["two.txt"] != fuse.DT_File {
+		t.Errorf("ReadDirAll() = %v; want one.txt and two.txt, both DT_File", ents)
+	}
+}
+
+// TestSearchMemberDirGetxattrReportsDirectoryMIME checks that a set's
+// "user.camli.mime" xattr reports directoryMIMEType, since a set has
+// no ccMeta.File.MIMEType of its own the way a searchResultFile does.
+func TestSearchMemberDirGetxattrReportsDirectoryMIME(t *testing.T) {
+	n := &searchMemberDir{fs: &CamliFileSystem{}, permanode: blob.MustParse("sha224-" + strings.Repeat("e", 56))}
+	resp := &fuse.GetxattrResponse{}
+	if err := n.Getxattr(context.Background(), &fuse.GetxattrRequest{Name: "user.camli.mime"}, resp); err != nil {
+		t.Fatalf("Getxattr(user.camli.mime) = %v", err)
+	}
+	if got := string(resp.Xattr); got != directoryMIMEType {
+		t.Errorf("Getxattr(user.camli.mime) = %q; want %q", got, directoryMIMEType)
+	}
+}
+
+// TestSearchMemberDirResolveSkipsCycle checks that resolve skips a
+// member whose permanode is already on n.ancestors instead of
+// recursing into it, the mechanism that keeps a cyclic camliMember
+// graph from looping forever.
+func TestSearchMemberDirResolveSkipsCycle(t *testing.T) {
+	self := blob.MustParse("sha224-" + strings.Repeat("d", 56))
+	n := &searchMemberDir{
+		fs:        &CamliFileSystem{},
+		permanode: self,
+		members:   []blob.Ref{self},
+		ancestors: map[blob.Ref]bool{self: true},
+	}
+	resolved, err := n.resolve(context.Background())
+	if err != nil {
+		t.Fatalf("resolve = %v", err)
+	}
+	if len(resolved) != 0 {
+		t.Errorf("resolve() with a self-referential member = %v; want empty (cycle skipped)", resolved)
+	}
+}
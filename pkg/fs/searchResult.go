@@ -20,186 +20,3842 @@ package fs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
 	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+	"perkeep.org/pkg/types"
 )
 
 type searchResultDir struct {
 	fs *CamliFileSystem
 
-	searchExp   string
-	mu          sync.Mutex
-	ents        map[string]*search.DescribedBlob // filename to blob meta
-	modTime     map[string]time.Time             // filename to permanode modtime
-	lastReaddir time.Time
-	lastNames   []string
+	searchExp string
+	// timeRange, if non-nil, additionally restricts results to those
+	// whose ModTime falls within it. It's applied client-side, after
+	// dir.Resolve returns, for cases the plain-text expression
+	// language has no predicate for (the by-year/by-month facet
+	// drill-downs); see dir.Resolve's doc comment for why it can't
+	// be pushed server-side alongside searchExp.
+	timeRange *timeRange
+	// at, if non-nil, pins this directory to a point in the past:
+	// the search and its camliContent resolutions are evaluated as
+	// of that instant, following prior claims only. Such a
+	// directory is immutable, so its results are cached forever
+	// and its files are read-only.
+	at *types.Time3339
+	// sortOverride, if non-nil, is the SearchSortBy a sortDirPrefix
+	// Lookup pinned this directory to, taking precedence over
+	// CamliFileSystem.SearchSortBy for every ReadDirAll against it;
+	// see effectiveSortBy.
+	sortOverride *SearchSortBy
+	// sortAttrOverride, if non-nil, is the sortAttrSpec an
+	// attrSortDirPrefix Lookup pinned this directory to, taking
+	// precedence over CamliFileSystem.SortAttr/SortAttrNumeric; see
+	// effectiveSortAttr. Meaningless unless effectiveSortBy is
+	// SearchSortByAttr.
+	sortAttrOverride *sortAttrSpec
+	// resultCapOverride and ttlOverride, if non-nil, are this
+	// directory's own "limit=" and "ttl=" options, parsed from the
+	// Lookup name that created it (see splitSearchOptions), taking
+	// precedence over CamliFileSystem.MaxResults and SearchCacheTTL
+	// respectively; see effectiveResultCap and effectiveSearchCacheTTL.
+	resultCapOverride *int
+	ttlOverride       *time.Duration
+	// ownerOverride, if non-nil, is this directory's own "owner="
+	// option, parsed from the Lookup name that created it (see
+	// splitSearchOptions), taking precedence over CamliFileSystem.Owner;
+	// see effectiveOwner.
+	ownerOverride *string
+	// describeAttrsOverride, if non-empty, is this directory's own
+	// describe attribute list, replacing CamliFileSystem.DescribeRules
+	// for every ReadDirAll against it; see effectiveDescribeRules. It,
+	// along with sortOverride, resultCapOverride, and ttlOverride, can
+	// additionally be set after construction by a write to
+	// camlifsFileName (see applyCamlifsConfig), unlike the Lookup-name
+	// options that otherwise populate them once and never again; a
+	// reader racing such a write may see either the old or new value,
+	// taking effect for the next ReadDirAll that starts after the write
+	// returns rather than one already in flight.
+	describeAttrsOverride []string
+	// cacheKey is the key this directory is (or, if evicted, was)
+	// registered under in n.fs's searchDirCache: rawName, possibly
+	// lowercased (see CamliFileSystem.SearchExprCaseInsensitiveCache),
+	// from whichever Lookup call built it. reconcileSavedSearchDirs
+	// needs it to evict a dir whose saved search was deleted
+	// server-side, since n.searchExp itself can change (see
+	// savedSearchName and CamliFileSystem.SavedSearchDeletedFallbackExpr)
+	// and so isn't a reliable cache key by the time that runs.
+	cacheKey string
+	// savedSearchName is the display name n was resolved from in
+	// searchDir.savedSearches, or "" if n didn't come from a saved
+	// search at all (a plain expression, an alias, or a named-searches
+	// config view). It's what searchDir.ReadDirAll's
+	// reconcileSavedSearchDirs matches against a fresh savedSearches
+	// call to notice a saved search deleted server-side since n was
+	// built; see CamliFileSystem.SavedSearchDeletedBehavior.
+	savedSearchName string
+	// stale is set by reconcileSavedSearchDirs when n's savedSearchName
+	// stopped existing server-side and
+	// CamliFileSystem.SavedSearchDeletedBehavior chose
+	// SavedSearchDeletedFallback: n.searchExp has been switched to
+	// CamliFileSystem.SavedSearchDeletedFallbackExpr, and this records
+	// that it's no longer actually serving the saved search its name
+	// suggests. info's SearchDirInfo.Stale surfaces it for
+	// introspection.
+	stale bool
+
+	mu            sync.Mutex
+	ents          map[string]*search.DescribedBlob // filename to blob meta
+	permanode     map[string]blob.Ref              // filename to the permanode claims act on
+	pnodeMeta     map[string]*search.DescribedBlob // filename to the permanode's own describe meta (for its attrs)
+	imageMeta     map[string]*search.DescribedBlob // filename to camliContentImage describe meta (dir.Entry.Image), for image xattrs; nil entries omitted
+	sets          map[string]dir.Entry             // filename to set entry (dir.Entry.IsSet), listed as a searchMemberDir instead of a searchResultFile
+	symlinks      map[string]string                // filename to target, for entries whose camliContent is a symlink schema blob instead of a file or directory
+	contentless   map[string]bool                  // filenames of permanodes with neither camliContent nor camliMember (dir.Entry.IsContentless), listed as zero-byte files; see CamliFileSystem.IncludeContentless
+	placeholders  map[string]bool                  // filenames of entries whose camliContent never resolved (dir.Entry.IsPlaceholder), listed as zero-byte stubs; see CamliFileSystem.UndescribedContentPolicy
+	deleted       map[string]bool                  // filenames surfaced by deletedEntries (dir.Entry.IsDeleted); forced read-only and marked via deletedSuffix/camliXattrs regardless of how the entry would otherwise be listed; see CamliFileSystem.IncludeDeleted
+	camliPaths    map[string]dir.Entry             // filename to entry whose permanode carries camliPath:* attrs, listed as a camliPathDir instead of its usual type; see CamliFileSystem.FollowCamliPath
+	extractedText map[string]string                // "<name>.txt" to an entry's extracted plain text, for entries whose permanode carries CamliFileSystem.ExtractedTextAttr; see addExtractedTextEntry
+	dupes         map[string]dupeEntry             // name suppressed by dedupeByContent to its entry, for dupesDirName; nil unless CamliFileSystem.DedupByContent
+	similar       map[string]similarEntry          // name suppressed by dedupeBySimilarity to its entry, for similarDirName; nil unless CamliFileSystem.SimilarityClusterAttr
+	// collisionSubdirs holds, for each subdirectory name
+	// CollisionStrategySubdirByBlobRef assigned a name-collision loser
+	// (see collisionSubdirName and stableName), the entry it nests and
+	// the display name it keeps inside that subdirectory, unaltered.
+	// Empty unless CamliFileSystem.CollisionStrategy is
+	// CollisionStrategySubdirByBlobRef and a collision has actually
+	// happened.
+	collisionSubdirs map[string]collisionSubdirEntry
+	// originalNames holds, for each entry name truncateFilename had
+	// to shorten to fit maxFilenameBytes, the full name it was
+	// shortened from, so searchResultDir.Lookup can hand it to the
+	// resulting searchResultFile for its user.camli.originalName
+	// xattr (see camliXattrs). A name untouched by truncation has no
+	// entry here at all, not an empty one.
+	originalNames map[string]string
+	badContent    []blob.Ref           // permanodes skipped this round for an empty or unparseable camliContent, for errorsDirName
+	errorLog      []string             // this round's resolution issues (skips, fallbacks, collisions), for errorsLogName
+	modTime       map[string]time.Time // filename to permanode modtime
+	// atime holds each entry's last-recorded access time, relatime-style
+	// (see recordAccess and relatimeUpdate): unlike modTime, it's never
+	// reset by doReaddir, since an access outlives whichever listing
+	// round happened to be current when it occurred. nil, and tracking
+	// skipped entirely, when CamliFileSystem.NoAtime is set.
+	atime map[string]time.Time
+	// facetCounts holds this round's facet counts, keyed by facet
+	// (from CamliFileSystem.FacetAttrs) then by value, for
+	// facetsFileName; nil unless CamliFileSystem.FacetAttrs is set.
+	facetCounts map[string]map[string]int
+	// timeline holds this round's modtime histogram, bucketed per
+	// CamliFileSystem.TimelineGranularity, for timelineFileName; nil
+	// unless CamliFileSystem.EnableTimelineFile is set.
+	timeline []timelineBucket
+	// matchTotal is this round's total match count, for Statfs to
+	// report without re-running the search; distinct from
+	// len(lastNames) once MaxResults or a query's own page size cuts
+	// the listing short. matchTotalKnown is false when the server
+	// didn't report one, in which case matchTotal is just the first
+	// page's own visible count instead of a true total. See
+	// dir.ResolvePage's total and totalKnown. countFileName answers the
+	// same question more cheaply, with its own fetchCount query and
+	// cache, rather than waiting on a full listing; see countTotal.
+	matchTotal      int
+	matchTotalKnown bool
+	// countTotal/countKnown/countCheckedAt are fetchCount's cached
+	// answer for countFileName, refreshed independently of
+	// matchTotal/lastReaddir so reading the count file never forces a
+	// full ReadDirAll. See countCacheTTL.
+	countTotal     int
+	countKnown     bool
+	countCheckedAt time.Time
+	// lastFallbackCount is the most recent doReaddir's totalFallbacks:
+	// how many entries needed a direct describe because their
+	// camliContent didn't come back described within the query's
+	// depth. completenessStatusContents reports it as PartialDescribe.
+	lastFallbackCount int
+	// lastUnresolvedCount is the most recent doReaddir's
+	// totalUnresolved: how many matched entries were skipped or
+	// placeholder'd outright because their camliContent still wasn't a
+	// file or directory after every indirection hop and fallback had
+	// been tried. See CamliFileSystem.UnresolvedCountXattrName.
+	lastUnresolvedCount int
+	// lastFatalError holds errorFileName's content: an explanation of
+	// the most recent doReaddir call's fatal error, if any, or "" if
+	// the most recent call succeeded. Currently only set for a "query
+	// too expensive" rejection; see queryTooExpensive.
+	lastFatalError string
+	lastReaddir    time.Time
+	lastNames      []string
+	// lastAccessed is when Open or Lookup was last called against n by
+	// a real caller, set by markAccessed. Unlike lastReaddir, it isn't
+	// touched by refresh itself (directly or via
+	// runSmartFolderRefresh's proactive calls), so dueForRefresh can
+	// tell a directory something is actively browsing apart from one
+	// that's merely still registered (see Forget) with nothing left
+	// reading it.
+	lastAccessed time.Time
+	// lastQueryDuration, lastResultCount, statsCacheHits, and
+	// statsCacheMisses back searchStatsFileName; see
+	// searchStatsFileContents. statsCacheHits/statsCacheMisses
+	// accumulate across every ReadDirAll since n was constructed;
+	// lastQueryDuration/lastResultCount describe only the most recent
+	// one that actually queried. All four stay zero, at no extra cost,
+	// unless CamliFileSystem.EnableSearchStatsFile is set.
+	lastQueryDuration time.Duration
+	lastResultCount   int
+	statsCacheHits    int
+	statsCacheMisses  int
+	// sinceToken is the last SinceQuerier newSince doReaddir recorded,
+	// or "" if it's never successfully done so. It persists across
+	// refreshes, unlike ents et al, so the next ReadDirAll's
+	// tryApplySince can ask the server for only what changed since
+	// the last one, instead of starting over from the beginning.
+	sinceToken string
+	// lastSeedErr is the error (a fuse.Errno) the most recent doReaddir
+	// call returned, or nil if it succeeded. It's distinct from ents
+	// being seeded at all: ents/lastNames keep whatever they were last
+	// set to on a failed refresh (see doReaddir), so a Lookup miss
+	// against them could otherwise be either a genuinely absent name or
+	// a name that would exist if the last (failed) refresh had
+	// actually reached the server. See Lookup's db == nil case.
+	lastSeedErr error
+	facets      map[string]*facetCache // facet name ("year", "tag", ...) to its cached values
+	// export is the most recently started exportToFileName export, or
+	// nil if none has ever been started. It's kept around after
+	// finishing so a read of exportToFileName still reports the final
+	// outcome instead of going back to "no export running"; a new
+	// write replaces it outright (see startExport).
+	export *exportState
+	// reindexHint is the outcome of the most recently sent
+	// reindexHintFileName hint, or nil if none has ever been sent. Like
+	// export, it's kept around after the hint completes so a read of
+	// reindexHintFileName still reports that outcome.
+	reindexHint *reindexHintState
+	// prefetchCancel cancels the most recently started prefetch pass's
+	// context, if one is still running, so Forget can stop it instead
+	// of leaving it to fetch schema blobs nobody will read anymore;
+	// see startPrefetch.
+	prefetchCancel context.CancelFunc
+	// schemaMeta caches fetchSchemaMeta's result by content blobref,
+	// so that repeated Lookups of the same file (as a media player
+	// stat-ing and then opening the same path does) reuse one fetch
+	// instead of repeating it, and so the resulting searchResultFile
+	// can be handed its schema already resolved. Reset alongside ents
+	// on refresh, like every other per-entry cache here.
+	schemaMeta map[blob.Ref]*schema.Blob
+	// negLookup remembers names Lookup recently found missing, so
+	// repeated stat probes for files like ".git" or "Thumbs.db" that
+	// will never exist in a search result don't repeat the "force a
+	// ReadDirAll" path below on every call. It's cleared whenever
+	// ReadDirAll reseeds ents, so a name that genuinely appears after
+	// the next search isn't masked by a stale miss.
+	negLookup map[string]time.Time
+	// pageCursors holds, for each page dir currently known to exist
+	// (see CamliFileSystem.EnablePaging), the pageCursor its window
+	// resumes from: pageCursors[0] for "page1", and so on. nil unless
+	// the most recent listing was truncated (doReaddir sets
+	// pageCursors[0] then) or a page dir has since been opened and
+	// found more beyond its own window (searchPageDir.resolve appends
+	// to it then). Reset to nil alongside ents on every refresh.
+	pageCursors []pageCursor
+	// inflight is non-nil while a search to reseed ents/lastNames is
+	// already running, so that two concurrent ReadDirAll calls against
+	// a stale cache share the one query between them instead of each
+	// issuing their own (see readdirCall).
+	inflight *readdirCall
+
+	// targetedLookups is the per-name analogue of inflight, for
+	// lookupTargetedOnce: non-nil entries are single-name queries
+	// currently running on behalf of a concurrent Lookup of the same
+	// name against a still-unseeded n, so a second Lookup for it waits
+	// on and shares the first's result instead of repeating the query.
+	// See targetedCall.
+	targetedLookups map[string]*targetedCall
+
+	// lazyBatch coalesces resolveLazyEntry's per-name dir.ResolveMember
+	// calls into one dir.ResolveMembers describe request covering a
+	// short burst of Lookups, instead of a round trip per name; created
+	// lazily on first use. See joinLazyBatch.
+	lazyBatch *lazyBatchCoordinator
+
+	// progress holds, for each name with an active read under
+	// CamliFileSystem.ExposeReadProgress, the readProgress its open
+	// searchResultFile handle is updating; absent for a name with no
+	// open handle right now. See searchprogress.go.
+	progress map[string]*readProgress
+
+	// stableNames and stableOwners pin each permanode to the display
+	// name it was first assigned, across refreshes: unlike ents et al,
+	// they're never reset by doReaddir. Without them, two permanodes
+	// colliding on the same base name (see dir.fileOrDirEntry's
+	// blobref-suffix fallback) could swap which of them keeps the
+	// plain name and which gets suffixed, depending on the order the
+	// backend happened to return them in that refresh; a file manager
+	// with the directory open would see names jump around with no
+	// visible cause. Once a permanode has a name here, doReaddir
+	// reuses it rather than whatever dir.ResolvePage assigned this
+	// time (see stableName).
+	stableNames  map[blob.Ref]string
+	stableOwners map[string]blob.Ref
+	// stableSubdirs pins, for a permanode stableName already nested
+	// under a collisionSubdirs entry, the subdirectory name it was
+	// nested under, the same way stableOwners pins a flat name --
+	// so a later refresh reuses the same choice instead of possibly
+	// picking a different one if the collision it originally lost to
+	// is no longer present. Only populated under
+	// CollisionStrategySubdirByBlobRef.
+	stableSubdirs map[blob.Ref]string
+	// caseFoldOwners pins each case fold (strings.ToLower of a flat,
+	// unsuffixed display name) to the permanode that currently holds
+	// it, for detecting a case-only collision between two otherwise
+	// distinct names (e.g. "photo.jpg" and "Photo.jpg"); see
+	// CamliFileSystem.CaseCollisionPolicy. Only populated for entries
+	// with no subdir, the same restriction stableOwners has.
+	caseFoldOwners map[string]blob.Ref
+
+	// openRefs counts live opens of files under n (see
+	// searchResultFile.Open's openRefHandle), so searchDirCache's
+	// eviction path can skip n while it's non-zero; see hasOpenRefs.
+	openRefs int
+}
+
+// readdirCall is the in-flight state of a single searchResultDir
+// search: the caller that finds n.inflight nil starts the query and
+// owns this value; every other caller that finds it non-nil waits on
+// wg and then reads err, exactly like a single-key singleflight.Group.
+type readdirCall struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// facetCache holds the value counts for one facet, recomputed after
+// fs.SearchCacheTTL the same way lastReaddir governs ReadDirAll.
+type facetCache struct {
+	values   map[string]int
+	computed time.Time
 }
 
 var (
 	_ fs.Node               = (*searchResultDir)(nil)
 	_ fs.HandleReadDirAller = (*searchResultDir)(nil)
 	_ fs.NodeStringLookuper = (*searchResultDir)(nil)
+	_ fs.NodeRenamer        = (*searchResultDir)(nil)
+	_ fs.NodeRemover        = (*searchResultDir)(nil)
+	_ fs.NodeSymlinker      = (*searchResultDir)(nil)
+	_ fs.NodeCreater        = (*searchResultDir)(nil)
+	_ fs.NodeMkdirer        = (*searchResultDir)(nil)
+	_ fs.NodeOpener         = (*searchResultDir)(nil)
 )
 
+// Open implements fs.NodeOpener: each open of a searchResultDir gets
+// its own searchResultDirHandle, a point-in-time snapshot of the
+// listing fixed at open time. bazil.org/fuse/fs has no
+// offset/continuation hook a directory implementation can use to
+// stream HandleReadDirAller's result in pages itself (the kernel's
+// own readdir offset bookkeeping sits below this package, invisible
+// to it); freezing the listing per-handle is what the library does
+// support, and it gets the same practical win a streaming client
+// wants: a long "ls" or directory walk over a huge, slowly-refreshing
+// result set sees one stable ordering throughout, instead of entries
+// shifting or repeating if n.lastNames gets reseeded partway through.
+// This is also what gives a long-running scan snapshot isolation from
+// a concurrent refresh: a refresh triggered by another caller (or by
+// the TTL expiring mid-scan) replaces n's own ents/lastNames for the
+// next Open, but an already-open handle keeps reading the copy it was
+// handed here, wholly unaffected. There's no corresponding Release:
+// a handle's ents slice needs no cleanup, so the fs.HandleReleaser the
+// "releasedir" half of this lifecycle would otherwise map to is
+// simply omitted.
+//
+// req's caller uid is checked against CallerUIDOwnerMap, if set,
+// before any of that: see checkCallerOwner.
+func (n *searchResultDir) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if err := n.checkCallerOwner(req.Uid); err != nil {
+		return nil, err
+	}
+	n.markAccessed()
+	ents, err := n.ReadDirAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &searchResultDirHandle{ents: ents}, nil
+}
+
+// searchResultDirHandle is the fixed listing searchResultDir.Open
+// hands back.
+type searchResultDirHandle struct {
+	ents []fuse.Dirent
+}
+
+var _ fs.HandleReadDirAller = (*searchResultDirHandle)(nil)
+
+func (h *searchResultDirHandle) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return h.ents, nil
+}
+
+// mountStartTime is searchResultDir.Attr's mtime fallback before a
+// directory has ever been listed, so a freshly mounted, not-yet-read
+// search directory reports a sane modtime instead of the zero value,
+// which some file managers render as Jan 1 1970.
+var mountStartTime = time.Now()
+
 func (n *searchResultDir) Attr(ctx context.Context, a *fuse.Attr) error {
-	a.Mode = os.ModeDir | 0555
-	a.Uid = uint32(os.Getuid())
-	a.Gid = uint32(os.Getgid())
+	a.Mode = os.ModeDir | n.fs.effectiveDirMode(0555)
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	mt := n.newestModTime()
+	a.Mtime = mt
+	a.Ctime = mt
+	a.Atime = mt
+	if last := n.lastAccessTime(); last.After(mt) {
+		// lastAccessed (markAccessed's Open/Lookup timestamp) is
+		// the closer thing to a real atime a searchResultDir has; fall
+		// back to mt instead whenever it predates the listing's own
+		// newest modtime, the same contradiction applyCreateTime's
+		// Mtime fallback guards against for a searchResultFile.
+		a.Atime = last
+	}
+	n.mu.Lock()
+	a.Size = n.dirSize()
+	n.mu.Unlock()
 	return nil
 }
 
-func (n *searchResultDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
-	var ents []fuse.Dirent
-
+// newestModTime returns the latest n.modTime value as of n's last
+// ReadDirAll, i.e. the modtime of whichever matching entry arrived
+// most recently, or mountStartTime if n hasn't been seeded yet.
+func (n *searchResultDir) newestModTime() time.Time {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	if n.lastReaddir.After(time.Now().Add(-searchSearchInterval)) {
-		Logger.Printf("fs.search: ReadDirAll from cache")
-		for _, name := range n.lastNames {
-			ents = append(ents, fuse.Dirent{Name: name})
+	newest := mountStartTime
+	for _, mt := range n.modTime {
+		if mt.After(newest) {
+			newest = mt
 		}
-		return ents, nil
 	}
+	return newest
+}
 
-	Logger.Printf("fs.search: ReadDirAll, doing search for '%s'", n.searchExp)
+// approxBytesPerEntry is approxMemoryBytes's rough per-name footprint
+// estimate: a *search.DescribedBlob is itself a sizable tree of
+// nested describe structs, not just a pointer, so this is deliberately
+// generous rather than trying to walk and sum it exactly.
+const approxBytesPerEntry = 1024
 
-	n.ents = make(map[string]*search.DescribedBlob)
-	n.modTime = make(map[string]time.Time)
-
-	req := &search.SearchQuery{
-		Expression: n.searchExp,
-		Limit:      -1,
-		Describe: &search.DescribeRequest{
-			Rules: []*search.DescribeRule{
-				{
-					Attrs: []string{"camliContent", "camliContentImage", "camliMember"},
-				},
-			},
-		},
+// approxMemoryBytes estimates how much memory n's per-entry maps
+// (ents, permanode, pnodeMeta, imageMeta, modTime, and the rest
+// doReaddir seeds alongside them) are holding, for SearchDirInfo. It's
+// deliberately a rough multiple of entry count rather than an exact
+// accounting of every map and every DescribedBlob's own size, which
+// would cost more to compute than the estimate is worth; see
+// approxBytesPerEntry. It must be called with n.mu held.
+func (n *searchResultDir) approxMemoryBytes() int64 {
+	return int64(len(n.lastNames)) * approxBytesPerEntry
+}
+
+// info returns a SearchDirInfo snapshot of n, for CachedSearchDirs.
+func (n *searchResultDir) info() SearchDirInfo {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var age time.Duration
+	if !n.lastReaddir.IsZero() {
+		age = time.Since(n.lastReaddir)
+	}
+	return SearchDirInfo{
+		Expr:        n.searchExp,
+		Entries:     len(n.lastNames),
+		Age:         age,
+		ApproxBytes: n.approxMemoryBytes(),
+		Stale:       n.stale,
+	}
+}
+
+// statfsBlockSize is the synthetic block size searchResultDir.Statfs
+// reports; it has no backing store to size blocks against, so this is
+// just a plausible, internally-consistent unit for Blocks/Bfree/Bavail
+// to be expressed in.
+const statfsBlockSize = 4096
+
+// Statfs implements fs.NodeStatfser (bazil.org/fuse routes a statfs(2)
+// against a path to the Node it resolves to, falling back to
+// CamliFileSystem's own FSStatfser, which this mount doesn't
+// implement, only if the node itself doesn't). It reports n's query's
+// total match count (see countFileName) as the used inode count, and
+// its total size (see totalSizeBytes) as the used block count, so a
+// "df" or a property dialog reflects both how many matches n's query
+// has in total and how much data they add up to, without re-running
+// the search. Ffree reports how many of those matches aren't actually
+// visible in n's current listing, i.e. what MaxResults or a query's
+// own page size cut off; zero once everything matched is shown, or
+// when the server never reported a total in the first place (see
+// dir.ResolvePage's totalKnown), in which case Files is itself just
+// the visible count. An unseeded n (nil n.lastNames) reports zero
+// rather than triggering a query of its own.
+func (n *searchResultDir) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
+	n.mu.Lock()
+	visible := uint64(len(n.lastNames))
+	total := uint64(n.matchTotal)
+	blocks := (n.totalSizeBytes() + statfsBlockSize - 1) / statfsBlockSize
+	n.mu.Unlock()
+	resp.Bsize = statfsBlockSize
+	resp.Blocks = blocks
+	resp.Bfree = 0
+	resp.Bavail = 0
+	resp.Files = total
+	if total > visible {
+		resp.Ffree = total - visible
+	} else {
+		resp.Ffree = 0
+	}
+	return nil
+}
+
+var _ fs.NodeStatfser = (*searchResultDir)(nil)
+
+// markAccessed records that a real caller (Open or Lookup) is actively
+// using n, for runSmartFolderRefresh's dueForRefresh check. It's not
+// called from refresh itself, so a directory's own proactive
+// background refreshes don't count as access and keep it eligible
+// forever; see lastAccessed.
+func (n *searchResultDir) markAccessed() {
+	n.mu.Lock()
+	n.lastAccessed = time.Now()
+	n.mu.Unlock()
+}
+
+// lastAccessTime returns n.lastAccessed, for Attr's Atime; it's the
+// same timestamp markAccessed (called from Open and Lookup)
+// already maintains for recentAccessWindow's sake, reused here rather
+// than tracking a second, separate "atime" for the directory itself.
+func (n *searchResultDir) lastAccessTime() time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.lastAccessed
+}
+
+func (n *searchResultDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	// Registering is idempotent and cheap, so it's simplest to do on
+	// every call rather than trying to do it once at construction.
+	watcherFor(n.fs).register(n)
+
+	n.mu.Lock()
+	// A snapshot ("at") directory is immutable, so once we've done
+	// the search once there's no need to ever redo it.
+	ttl := n.effectiveSearchCacheTTL()
+	// debounce guards the moment a normal TTL expires, or a mount
+	// configured with a very small or zero TTL, from a thundering
+	// herd of simultaneous callers each re-running the same query; see
+	// effectiveRefreshDebounce.
+	debounce := n.effectiveRefreshDebounce()
+	if n.haveCachedListing(ttl, debounce) {
+		debugf("fs.search: ReadDirAll from cache")
+		metricsFor(n.fs).IncCacheHit()
+		searchCacheHitsTotal.Add(1)
+		n.statsCacheHits++
+		names := append(n.visibleNames(n.lastNames), n.pageDirNames()...)
+		refs := n.entryRefs(names)
+		kinds := n.entryKinds(names)
+		n.mu.Unlock()
+		searchResultsServed.Add(int64(len(names)))
+		return n.listingDirents(names, refs, kinds), nil
 	}
-	res, err := n.fs.client.Query(ctx, req)
+	n.mu.Unlock()
+	return n.refresh(ctx)
+}
+
+// refresh re-runs n's search right now, bypassing haveCachedListing
+// entirely: ReadDirAll's own cache-miss branch calls it once it's
+// already decided a reseed is needed, and runSmartFolderRefresh's
+// proactive refresh (see dueForRefresh) calls it directly, shortly
+// before the TTL lapses, while the existing listing is still technically
+// within it and so would otherwise be served as-is. Either way, a
+// concurrent call that arrives while one is already running waits for
+// and reuses it instead of starting a second query, the same
+// singleflight dance ReadDirAll has always used (see readdirCall).
+func (n *searchResultDir) refresh(ctx context.Context) ([]fuse.Dirent, error) {
+	err, ran := n.dedupReaddir(func() error { return n.seedFromQuery(ctx) })
 	if err != nil {
-		Logger.Printf("fs.search: GetRecentPermanodes error in ReadDirAll: %v", err)
-		return nil, fuse.EIO
+		return nil, err
+	}
+	if !ran {
+		// Another caller already reseeded; reuse its result rather
+		// than running the same search ourselves.
+		n.mu.Lock()
+		names := append(n.visibleNames(n.lastNames), n.pageDirNames()...)
+		refs := n.entryRefs(names)
+		kinds := n.entryKinds(names)
+		n.mu.Unlock()
+		searchResultsServed.Add(int64(len(names)))
+		return n.listingDirents(names, refs, kinds), nil
+	}
+	n.startPrefetch()
+	n.mu.Lock()
+	names := n.visibleNames(n.lastNames)
+	refs := n.entryRefs(names)
+	kinds := n.entryKinds(names)
+	n.mu.Unlock()
+	searchResultsServed.Add(int64(len(names)))
+	return n.listingDirents(names, refs, kinds), nil
+}
+
+// dedupReaddir is refresh's singleflight coordination, factored out
+// from the query itself (seedFromQuery) so it can be exercised
+// without a real client (see searchreaddirconcurrent_test.go), the
+// same way dedupTargetedLookup is for lookupTargetedOnce: the caller
+// that finds n.inflight nil runs fn and owns the resulting call; every
+// other caller that finds it non-nil waits on call.wg and shares its
+// err instead of running fn again. ran reports whether this call
+// itself ran fn, as opposed to sharing another caller's result. It
+// must be called with n.mu unheld.
+func (n *searchResultDir) dedupReaddir(fn func() error) (err error, ran bool) {
+	n.mu.Lock()
+	if call := n.inflight; call != nil {
+		n.mu.Unlock()
+		call.wg.Wait()
+		return call.err, false
+	}
+	call := &readdirCall{}
+	call.wg.Add(1)
+	n.inflight = call
+	n.statsCacheMisses++
+	n.mu.Unlock()
+
+	err = fn()
+
+	n.mu.Lock()
+	n.inflight = nil
+	n.mu.Unlock()
+	call.err = err
+	call.wg.Done()
+	return err, true
+}
+
+// seedFromQuery runs doReaddir and records its outcome in n's stats,
+// dedupReaddir's fn for a real refresh: factored out from the
+// coordination itself so the stats bookkeeping below happens exactly
+// once per real query, never once per waiting caller.
+func (n *searchResultDir) seedFromQuery(ctx context.Context) error {
+	metricsFor(n.fs).IncCacheMiss()
+	searchCacheMissTotal.Add(1)
+	searchQueriesTotal.Add(1)
+	start := time.Now()
+	err := n.doReaddir(ctx)
+	duration := time.Since(start)
+	metricsFor(n.fs).ObserveSearchLatency(duration)
+
+	n.mu.Lock()
+	n.lastSeedErr = err
+	n.lastQueryDuration = duration
+	if err == nil {
+		n.lastResultCount = n.matchTotal
 	}
+	n.mu.Unlock()
+	return err
+}
 
-	n.lastNames = nil
-	for _, ri := range res.Blobs {
-		br := ri.Blob
-		modTime := time.Now()
-		if res.Describe == nil || res.Describe.Meta == nil {
-			Logger.Printf("fs.search: res.Describe nil")
+// entryRefs returns, for each of names (a snapshot of n.lastNames),
+// the blobref that identifies it for inode purposes: a set's own
+// permanode, or a file's permanode (not its camliContent, so the
+// inode survives the file's content changing). It must be called
+// with n.mu held.
+func (n *searchResultDir) entryRefs(names []string) map[string]blob.Ref {
+	refs := make(map[string]blob.Ref, len(names))
+	for _, name := range names {
+		if set, ok := n.sets[name]; ok {
+			refs[name] = set.Permanode
 			continue
 		}
-		if res.Describe.Meta == nil {
-			Logger.Printf("fs.search: Describe.Meta nil")
-			continue
+		if pn, ok := n.permanode[name]; ok {
+			refs[name] = pn
 		}
-		meta := res.Describe.Meta.Get(br)
-		if meta == nil {
-			Logger.Printf("fs.search: Meta for br is nil")
+	}
+	return refs
+}
+
+// entryKinds returns, for each of names (a snapshot of n.lastNames),
+// the fuse.DirentType Lookup would resolve that same name to:
+// fuse.DT_Dir for a collisionSubdirs, camliPaths, or sets entry,
+// fuse.DT_Link for a symlinks entry, and fuse.DT_File for everything
+// else (a plain file or a contentless entry), mirroring Lookup's own
+// precedence among those maps. It must be called with n.mu held, the
+// same as entryRefs.
+func (n *searchResultDir) entryKinds(names []string) map[string]fuse.DirentType {
+	kinds := make(map[string]fuse.DirentType, len(names))
+	for _, name := range names {
+		if _, ok := parsePageDirName(name); ok {
+			kinds[name] = fuse.DT_Dir
 			continue
 		}
-		if meta.Permanode == nil {
-			Logger.Printf("fs.search: br meta permanode is nil")
+		if _, ok := n.collisionSubdirs[name]; ok {
+			kinds[name] = fuse.DT_Dir
 			continue
 		}
-		cc, ok := blob.Parse(meta.Permanode.Attr.Get("camliContent"))
-		if !ok {
+		if _, ok := n.camliPaths[name]; ok {
+			kinds[name] = fuse.DT_Dir
 			continue
 		}
-		ccMeta := res.Describe.Meta.Get(cc)
-		if ccMeta == nil {
+		if _, ok := n.sets[name]; ok {
+			kinds[name] = fuse.DT_Dir
 			continue
 		}
-		var name string
-		switch {
-		case ccMeta.File != nil:
-			name = ccMeta.File.FileName
-			if mt := ccMeta.File.Time; !mt.IsAnyZero() {
-				modTime = mt.Time()
-			}
-		case ccMeta.Dir != nil:
-			name = ccMeta.Dir.FileName
-		default:
+		if _, ok := n.symlinks[name]; ok {
+			kinds[name] = fuse.DT_Link
 			continue
 		}
-		if name == "" || n.ents[name] != nil {
-			ext := filepath.Ext(name)
-			if ext == "" && ccMeta.File != nil && strings.HasSuffix(ccMeta.File.MIMEType, "image/jpeg") {
-				ext = ".jpg"
-			}
-			name = strings.TrimPrefix(ccMeta.BlobRef.String(), ccMeta.BlobRef.HashName()+"-")[:10] + ext
-			if n.ents[name] != nil {
-				continue
-			}
-		}
-		n.ents[name] = ccMeta
-		n.modTime[name] = modTime
-		Logger.Printf("fs.search: name %q = %v (at %v)", name, ccMeta.BlobRef, modTime)
-		n.lastNames = append(n.lastNames, name)
-		ents = append(ents, fuse.Dirent{
-			Name: name,
-		})
+		kinds[name] = fuse.DT_File
 	}
-	Logger.Printf("fs.search returning %d entries", len(ents))
-	n.lastReaddir = time.Now()
-	return ents, nil
+	return kinds
 }
 
-type searchResultFile struct {
+// searchResultSymlink is a symlink result: a permanode whose
+// camliContent resolved to a "symlink" schema blob rather than a file
+// or directory (see dir.Entry.IsSymlink). target is returned
+// unverified, exactly as recorded, which may leave it dangling.
+type searchResultSymlink struct {
 	node
+	permanode blob.Ref
+	target    string
 }
 
-var _ fs.Node = (*searchResultFile)(nil)
+var (
+	_ fs.Node           = (*searchResultSymlink)(nil)
+	_ fs.NodeReadlinker = (*searchResultSymlink)(nil)
+)
 
-func (n *searchResultFile) Attr(ctx context.Context, a *fuse.Attr) error {
+func (n *searchResultSymlink) Attr(ctx context.Context, a *fuse.Attr) error {
 	n.node.Attr(ctx, a)
-	a.Mode = 0666
-	a.Uid = uint32(os.Getuid())
-	a.Gid = uint32(os.Getgid())
+	a.Mode = os.ModeSymlink | 0777
+	a.Valid = n.fs.effectiveAttrValidity()
+	if n.permanode.Valid() {
+		a.Inode = inodeTableFor(n.fs).inodeFor(n.permanode)
+	}
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
 	return nil
 }
 
-func (n *searchResultDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+func (n *searchResultSymlink) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	return n.target, nil
+}
+
+// direntsWithDotfiles is direntsWithInode, plus controlFileNames (and
+// whichever of the feature-flag-gated control files are currently
+// enabled) when n.fs.ShowDotfiles is set: every one of them is always
+// resolvable via Lookup regardless, the same way attrDirNames/
+// facetOnlyDirNames are, so this only affects whether it shows up in
+// a plain "ls". kinds is names' entryKinds, threaded through to
+// direntsWithInode; the dotfiles themselves are always plain files.
+func (n *searchResultDir) direntsWithDotfiles(names []string, refs map[string]blob.Ref, kinds map[string]fuse.DirentType) []fuse.Dirent {
+	ents := direntsWithInode(n.fs, names, refs, kinds)
+	if n.fs.ShowDotfiles {
+		for _, name := range controlFileNames {
+			ents = append(ents, fuse.Dirent{Name: name, Type: fuse.DT_File})
+		}
+		if !n.fs.DisableErrorsLog {
+			ents = append(ents, fuse.Dirent{Name: errorsLogName, Type: fuse.DT_File})
+		}
+		if !n.fs.DisableExplainFile {
+			ents = append(ents, fuse.Dirent{Name: explainFileName, Type: fuse.DT_File})
+		}
+		if n.fs.EnableFacetsFile {
+			ents = append(ents, fuse.Dirent{Name: facetsFileName, Type: fuse.DT_File})
+		}
+		if n.fs.EnableTimelineFile {
+			ents = append(ents, fuse.Dirent{Name: timelineFileName, Type: fuse.DT_File})
+		}
+		if n.fs.EnableSearchStatsFile {
+			ents = append(ents, fuse.Dirent{Name: searchStatsFileName, Type: fuse.DT_File})
+		}
+	}
+	return ents
+}
+
+// effectiveResultCap is the lesser of n's own resultCapOverride (if a
+// "limit=" Lookup option, or a write to limitFileName, set one) or the
+// mount's configured MaxResults (if any), and the hard
+// maxSearchResultEntries safety limit, so neither can ever raise the
+// cap past it. The one exception is MaxResultsUnlimited, which
+// disables maxSearchResultEntries too, for an operator who has
+// explicitly decided they want every result regardless of how long or
+// how much memory that takes; a resultCapOverride can still narrow
+// that back down for one directory, or itself be set to
+// MaxResultsUnlimited (via limitFileName) to lift it for just that one
+// directory regardless of the mount's own MaxResults.
+func (n *searchResultDir) effectiveResultCap() int {
+	resultCap := maxSearchResultEntries
+	switch {
+	case n.fs.MaxResults == MaxResultsUnlimited:
+		resultCap = math.MaxInt
+	case n.fs.MaxResults > 0 && n.fs.MaxResults < resultCap:
+		resultCap = n.fs.MaxResults
+	}
+	switch {
+	case n.resultCapOverride != nil && *n.resultCapOverride == MaxResultsUnlimited:
+		resultCap = math.MaxInt
+	case n.resultCapOverride != nil && *n.resultCapOverride < resultCap:
+		resultCap = *n.resultCapOverride
+	}
+	return resultCap
+}
+
+// effectiveSearchCacheTTL is the TTL ReadDirAll's cache check uses: n's
+// own ttlOverride if a "ttl=" Lookup option set one, otherwise
+// CamliFileSystem.SearchCacheTTL, clamped to fs's floor (see
+// clampToMinSearchCacheTTL).
+func (n *searchResultDir) effectiveSearchCacheTTL() time.Duration {
+	if n.ttlOverride != nil {
+		return clampToMinSearchCacheTTL(n.fs, *n.ttlOverride)
+	}
+	return clampToMinSearchCacheTTL(n.fs, n.fs.SearchCacheTTL)
+}
+
+// effectiveDescribeRules is the describe ruleset ReadDirAll actually
+// queries with: n's own describeAttrsOverride, wrapped in a single
+// rule the same shape CamliFileSystem.DescribeRules itself takes, if a
+// camlifsFileName write set one, otherwise whatever
+// effectiveDescribeRulesFor resolves for n.fs (its mount-wide runtime
+// override, its DescribeRules, or dir.DefaultDescribeRules merged with
+// its DescribeExtraAttrs, in that order).
+func (n *searchResultDir) effectiveDescribeRules() []*search.DescribeRule {
+	if len(n.describeAttrsOverride) > 0 {
+		return []*search.DescribeRule{{Attrs: n.describeAttrsOverride}}
+	}
+	return effectiveDescribeRulesFor(n.fs)
+}
+
+// queryFileName is a hidden, per-searchResultDir file reporting the
+// directory's own search expression and effective query parameters,
+// for confirming exactly what a mounted search is running without
+// having to re-derive it from the path. It's always resolvable via
+// Lookup; see CamliFileSystem.ShowDotfiles for whether it's also
+// listed in ReadDirAll.
+const queryFileName = ".query"
+
+// queryFileContents renders queryFileName's content. It must be
+// called with n.mu held, since it reports n.lastReaddir.
+func (n *searchResultDir) queryFileContents() string {
+	cache := "never queried"
+	if !n.lastReaddir.IsZero() {
+		cache = n.lastReaddir.Format(time.RFC3339)
+	}
+	s := fmt.Sprintf("expression: %s\nlimit: %d\nlast queried: %s\n", n.searchExp, n.effectiveResultCap(), cache)
+	if owner := n.effectiveOwner(); owner != "" {
+		s += fmt.Sprintf("owner: %s\n", owner)
+	}
+	return s
+}
+
+// refreshFileName is a hidden, per-searchResultDir control file: any
+// read or write of it invalidates n's cache, forcing the next
+// ReadDirAll to re-run the search instead of waiting out
+// fs.SearchCacheTTL. It's for scripting an explicit sync (e.g. right
+// after a pk-put) without restarting the mount. Like queryFileName,
+// it's always resolvable via Lookup, but unlike queryFileName it never
+// appears in a listing, with or without ShowDotfiles, since it isn't
+// a search result and shouldn't read like one.
+const refreshFileName = ".refresh"
+
+// refreshControlFile is refreshFileName's Node and Handle: reading or
+// writing it is only ever done for its invalidateCache side effect,
+// so both operations succeed trivially without transferring any real
+// data.
+type refreshControlFile struct {
+	dir *searchResultDir
+}
+
+var (
+	_ fs.Node         = refreshControlFile{}
+	_ fs.HandleReader = refreshControlFile{}
+	_ fs.HandleWriter = refreshControlFile{}
+)
+
+func (f refreshControlFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Valid = f.dir.fs.effectiveAttrValidity()
+	return nil
+}
+
+func (f refreshControlFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	f.dir.invalidateCache()
+	Logger.Printf("fs.search: %q read for '%s': cache invalidated", refreshFileName, f.dir.searchExp)
+	return nil
+}
+
+func (f refreshControlFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := f.dir.fs.checkWritable(); err != nil {
+		return err
+	}
+	f.dir.invalidateCache()
+	Logger.Printf("fs.search: %q written for '%s': cache invalidated", refreshFileName, f.dir.searchExp)
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// sinceQueryEligible reports whether n's configuration is simple
+// enough for tryApplySince to even attempt a delta merge. Every
+// feature excluded here either reshapes an added entry's name in a
+// way stableName alone doesn't capture (FlattenSets,
+// CollapseSingletonSets, FollowCamliPath, StableIDNames, DedupByContent,
+// PersistentNames), reorders or filters lastNames in a way a simple
+// append can't reproduce (DeterministicListing, CollisionDirPriority,
+// timeRange), or draws entries from somewhere QuerySince wouldn't know
+// to report deltas for (at, ExtraSearchClients, IncludeDeleted,
+// IncludeContentless). Any of them in play falls back to doReaddir's
+// usual full query, which already handles all of them correctly.
+func (n *searchResultDir) sinceQueryEligible() bool {
+	return n.at == nil &&
+		n.timeRange == nil &&
+		!n.fs.FlattenSets &&
+		!n.fs.CollapseSingletonSets &&
+		!n.fs.FollowCamliPath &&
+		!n.fs.StableIDNames &&
+		!n.fs.DedupByContent &&
+		!n.fs.PersistentNames &&
+		!n.fs.DeterministicListing &&
+		!n.fs.CollisionDirPriority &&
+		!n.fs.IncludeContentless &&
+		!n.fs.IncludeDeleted &&
+		len(n.fs.ExtraSearchClients) == 0
+}
+
+// tryApplySince attempts to refresh n via a SinceQuerier delta instead
+// of doReaddir's usual full query, applying the merge only if every
+// added entry and every removed permanode can be merged unambiguously
+// (see sinceQueryEligible and the per-entry checks below); a delta
+// that's only partly mergeable is left entirely unapplied; nothing
+// about n is mutated unless the whole thing merges cleanly. It reports
+// whether it applied the refresh, in which case doReaddir should
+// return immediately with its own err rather than running the full
+// query too.
+func (n *searchResultDir) tryApplySince(ctx context.Context) (err error, applied bool) {
+	if !n.sinceQueryEligible() {
+		return nil, false
+	}
+	sq, ok := n.fs.client.(SinceQuerier)
+	if !ok {
+		return nil, false
+	}
+	n.mu.Lock()
+	token := n.sinceToken
+	n.mu.Unlock()
+	if token == "" {
+		// No baseline yet; let the full query below establish one.
+		return nil, false
+	}
+
+	added, removed, newSince, err := sq.QuerySince(ctx, n.effectiveSearchExpr(), token)
+	if err != nil {
+		Logger.Printf("fs.search: ReadDirAll for '%s': since-query failed, falling back to a full refresh: %v", n.searchExp, err)
+		return nil, false
+	}
+
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	Logger.Printf("fs.searchResultDir: Lookup(%q)", name)
-	if n.ents == nil {
-		// Odd case: a Lookup before a Readdir. Force a readdir to
-		// seed our map. Mostly hit just during development.
-		n.mu.Unlock() // release, since ReadDirAll will acquire
-		n.ReadDirAll(ctx)
-		n.mu.Lock()
+	type addition struct {
+		name string
+		e    dir.Entry
 	}
-	db := n.ents[name]
-	Logger.Printf("fs.searchResultDir: Lookup(%q) = %v", name, db)
-	if db == nil {
-		return nil, fuse.ENOENT
+	adds := make([]addition, 0, len(added))
+	for _, e := range added {
+		if e.IsSet || e.IsSymlink || e.IsContentless || e.IsPlaceholder || hasCamliPathAttrs(e.PNodeMeta) {
+			debugf("fs.search: ReadDirAll for '%s': since-query added an entry this fast path doesn't handle, falling back to a full refresh", n.searchExp)
+			return nil, false
+		}
+		name, subdir := n.stableName(e, &n.errorLog)
+		if subdir != "" {
+			debugf("fs.search: ReadDirAll for '%s': since-query added entry needs a collision subdirectory, falling back to a full refresh", n.searchExp)
+			return nil, false
+		}
+		adds = append(adds, addition{name: name, e: e})
+	}
+	removeNames := make([]string, 0, len(removed))
+	for _, pn := range removed {
+		name, ok := n.stableNames[pn]
+		if !ok {
+			debugf("fs.search: ReadDirAll for '%s': since-query removed an unrecognized permanode, falling back to a full refresh", n.searchExp)
+			return nil, false
+		}
+		removeNames = append(removeNames, name)
 	}
 
-	nod := &searchResultFile{
-		node: node{
-			fs:           n.fs,
-			blobref:      db.BlobRef,
-			pnodeModTime: n.modTime[name],
-		},
+	oldNames := n.lastNames
+	oldFP := buildSearchResultFingerprints(oldNames, n.permanode, n.modTime)
+
+	existing := make(map[string]bool, len(n.lastNames))
+	for _, name := range n.lastNames {
+		existing[name] = true
 	}
-	blob, err := nod.fs.fetchSchemaMeta(ctx, nod.blobref)
-	if err != nil {
-		Logger.Printf("fs:searchResultDir: Couldn't find meta")
-	} else {
-		Logger.Printf("fs:searchResultDir: Blob type: %s", blob.Type())
+	removeSet := make(map[string]bool, len(removeNames))
+	for _, name := range removeNames {
+		removeSet[name] = true
+	}
+	lastNames := make([]string, 0, len(n.lastNames)+len(adds))
+	for _, name := range n.lastNames {
+		if removeSet[name] {
+			delete(n.ents, name)
+			delete(n.permanode, name)
+			delete(n.pnodeMeta, name)
+			delete(n.imageMeta, name)
+			delete(n.modTime, name)
+			continue
+		}
+		lastNames = append(lastNames, name)
+	}
+	for _, a := range adds {
+		if !existing[a.name] {
+			lastNames = append(lastNames, a.name)
+		}
+		n.ents[a.name] = a.e.Blob
+		n.permanode[a.name] = a.e.Permanode
+		n.pnodeMeta[a.name] = a.e.PNodeMeta
+		n.imageMeta[a.name] = a.e.Image
+		n.modTime[a.name] = n.entryModTime(a.e)
 	}
+	n.lastNames = lastNames
+	n.negLookup = nil
+	n.schemaMeta = nil
+	n.sortLastNames()
+	n.sampleLastNamesLocked()
+	n.sinceToken = newSince
 
-	return nod, nil
+	newNames := n.lastNames
+	newFP := buildSearchResultFingerprints(newNames, n.permanode, n.modTime)
+	Logger.Printf("fs.search: ReadDirAll for '%s': applied a since-query delta (+%d/-%d), now %d entries", n.searchExp, len(adds), len(removeNames), len(n.lastNames))
+	n.lastReaddir = time.Now()
+	n.invalidateDiff(oldNames, oldFP, newNames, newFP)
+	return nil, true
+}
+
+// doReaddir runs n's search and reseeds ents/permanode/pnodeMeta/sets/
+// modTime/lastNames from the results. Callers reach it only through
+// ReadDirAll's singleflight dance above, so at most one doReaddir call
+// for a given n is ever running at a time.
+//
+// n.mu is held only while reading/writing the cached maps themselves
+// (here, in ReadDirAll, and in Lookup), never across the network
+// round trip(s) this performs: ReadDirAll releases n.mu before calling
+// this, and the query loop below only reacquires it at the very end
+// to publish its results (tryApplySince follows the same shape for its
+// own QuerySince round trip). A concurrent Lookup against n blocks on
+// n.mu for as long as that publish step takes, not for the query
+// itself.
+//
+// ctxCancelCheckInterval is how many of a page's entries the per-result
+// describe-and-name loop processes between ctx.Err() checks, so a
+// canceled "ls" against a very large result aborts within a bounded
+// number of entries instead of running the whole page to completion.
+const ctxCancelCheckInterval = 256
+
+// shouldAbortForCancellation reports whether doReaddir's per-result
+// loop, having just reached index i out of a page of total entries,
+// should stop early because ctx is done. It's checked only every
+// ctxCancelCheckInterval entries rather than on every one, so a huge
+// page doesn't pay for a ctx.Err() call per entry.
+func shouldAbortForCancellation(ctx context.Context, i, total int) bool {
+	return i > 0 && i%ctxCancelCheckInterval == 0 && ctx.Err() != nil
+}
+
+func (n *searchResultDir) doReaddir(ctx context.Context) error {
+	if n.fs.client == nil {
+		Logger.Printf("fs.search: ReadDirAll for '%s': CamliFileSystem.client is nil; refusing to query rather than panic", n.searchExp)
+		return fuse.EIO
+	}
+	if _, _, found, err := parseInlineSort(n.searchExp); found && err != nil {
+		Logger.Printf("fs.search: ReadDirAll for '%s': %v", n.searchExp, err)
+		return fuse.EINVAL
+	}
+	if _, _, _, found, err := parseSizeFilter(n.searchExp); found && err != nil {
+		Logger.Printf("fs.search: ReadDirAll for '%s': %v", n.searchExp, err)
+		return fuse.EINVAL
+	}
+	if n.fs.LazyResolve {
+		return n.doLazyReaddir(ctx)
+	}
+	if err, applied := n.tryApplySince(ctx); applied {
+		return err
+	}
+
+	Logger.Printf("fs.search: ReadDirAll, doing search for '%s'", n.searchExp)
+
+	breaker := breakerFor(n.fs)
+	if n.fs.CircuitBreakerEnabled && !breaker.allow() {
+		Logger.Printf("fs.search: ReadDirAll for '%s': circuit breaker open after repeated failures, failing fast", n.searchExp)
+		return fuse.EIO
+	}
+
+	if n.fs.QueryHardBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.fs.QueryHardBudget)
+		defer cancel()
+	}
+
+	limiter := queryLimiterFor(n.fs)
+	if err := limiter.acquire(ctx, metricsFor(n.fs)); err != nil {
+		if n.fs.QueryHardBudget > 0 && ctx.Err() == context.DeadlineExceeded {
+			Logger.Printf("fs.search: ReadDirAll for '%s': exceeded its hard query budget waiting for a query slot", n.searchExp)
+			return fuse.EIO
+		}
+		Logger.Printf("fs.search: ReadDirAll for '%s': waiting for a query slot: %v", n.searchExp, err)
+		return n.fs.effectiveQueryTimeoutErrno()
+	}
+	defer limiter.release()
+
+	auditFor(n.fs).Audit(AuditEvent{Time: time.Now(), Type: AuditQueryExecuted, Expr: n.effectiveSearchExpr()})
+
+	budgetStart := time.Now()
+
+	ents := make(map[string]*search.DescribedBlob)
+	permanode := make(map[string]blob.Ref)
+	pnodeMeta := make(map[string]*search.DescribedBlob)
+	imageMeta := make(map[string]*search.DescribedBlob)
+	sets := make(map[string]dir.Entry)
+	symlinks := make(map[string]string)
+	contentless := make(map[string]bool)
+	placeholders := make(map[string]bool)
+	deleted := make(map[string]bool)
+	camliPaths := make(map[string]dir.Entry)
+	extractedText := make(map[string]string)
+	collisionSubdirs := make(map[string]collisionSubdirEntry)
+	guardedOwners := make(map[string]blob.Ref)
+	modTime := make(map[string]time.Time)
+	originalNames := make(map[string]string)
+	var lastNames []string
+
+	// pinnedAt is the point-in-time every dir.ResolvePage call in this
+	// doReaddir pass describes against. A searchAtDir already has its
+	// own n.at pinned permanently; a live directory has none, so with
+	// CamliFileSystem.PinPaginationSnapshot set, doReaddir pins its own
+	// "now" for the duration of this one pass instead, so a page fetched
+	// several round trips into a large, paginated listing still
+	// describes its entries as of the same instant page one did, rather
+	// than drifting to whatever "now" happens to be by the time that
+	// later round trip goes out. The next ReadDirAll call (this pass's
+	// own refresh) repins to a fresh "now", so the snapshot never goes
+	// stale across refreshes, only within one of them.
+	pinnedAt := n.at
+	if pinnedAt == nil && n.fs.PinPaginationSnapshot {
+		now := types.Time3339FromTime(time.Now())
+		pinnedAt = &now
+	}
+
+	seen := make(map[string]bool)
+	cont := ""
+	depth := n.fs.effectiveSearchDescribeDepth()
+	totalElided := 0
+	totalFallbacks := 0
+	totalUnresolved := 0
+	var matchTotal int
+	var matchTotalKnown bool
+	var badContent, allDegraded []blob.Ref
+	var errLog []string
+	resultCap := n.effectiveResultCap()
+	truncated := false
+	partial := false
+	// pageResumeCont/pageResumeSkip record, if truncated ends up true,
+	// exactly where the cap cut the listing short: the continue token
+	// for the network page truncation happened within, and how many of
+	// that page's own entries were already consumed. See
+	// CamliFileSystem.EnablePaging.
+	var pageResumeCont string
+	var pageResumeSkip int
+	sortBy, serverSorted := serverSortFor(n.effectiveSortBy())
+	if serverSorted && sortKnownUnsupported(n.fs) {
+		// n.fs's server already confirmed it doesn't honor sortBy, from
+		// an earlier searchResultDir's own attempt; skip straight to the
+		// client-side path instead of paying for another doomed query.
+		serverSorted = false
+		sortBy = search.UnspecifiedSort
+	}
+truncate:
+	for {
+		var queryCtx context.Context
+		var dents []dir.Entry
+		var next string
+		var elided, fallbacks, unresolved int
+		var bad, degraded []blob.Ref
+		var total int
+		var totalKnown bool
+		var err error
+		seenBeforePage := make(map[string]bool, len(seen))
+		for k, v := range seen {
+			seenBeforePage[k] = v
+		}
+		for attempt := 0; ; attempt++ {
+			var cancel func()
+			queryCtx = ctx
+			cancel = func() {}
+			if timeout := n.fs.effectiveQueryTimeout(); timeout > 0 {
+				queryCtx, cancel = context.WithTimeout(ctx, timeout)
+			}
+			dents, next, elided, fallbacks, unresolved, bad, degraded, total, totalKnown, err = dir.ResolvePage(queryCtx, n.fs.client, n.effectiveSearchExpr(), pinnedAt, cont, seen, depth, n.effectiveDescribeRules(), sortBy, n.fs.NameAttribute, n.fs.GroupByAttribute, n.fs.MIMEPreference, n.fs.effectiveContentIndirectionHops(), n.fs.IncludeContentless, n.fs.effectiveUndescribedContentPolicy(), n.fs.effectiveDescribeStrategy(), 0, n.fs.PrimaryContentAttr, n.fs.effectiveMaxInlineSetMembers(), n.fs.ContentAttrAliases, n.fs.TitleAttrAliases, n.fs.effectiveSpecialContentPolicy())
+			if serverSorted && cont == "" && sortUnsupported(err) {
+				// The server itself doesn't support sortBy; fall back to
+				// the unsorted query and let sortLastNames order the
+				// result client-side instead, same as SearchSortByDefault
+				// would have. Only attempted on the very first page: once
+				// any page has come back server-sorted, switching away
+				// mid-pagination would make later pages stop stitching
+				// onto earlier ones in order.
+				Logger.Printf("fs.search: ReadDirAll for '%s': server doesn't support sort %v, falling back to client-side sorting: %v", n.searchExp, sortBy, err)
+				recordSortCapability(n.fs, false)
+				serverSorted = false
+				sortBy = search.UnspecifiedSort
+				dents, next, elided, fallbacks, unresolved, bad, degraded, total, totalKnown, err = dir.ResolvePage(queryCtx, n.fs.client, n.effectiveSearchExpr(), pinnedAt, cont, seen, depth, n.effectiveDescribeRules(), sortBy, n.fs.NameAttribute, n.fs.GroupByAttribute, n.fs.MIMEPreference, n.fs.effectiveContentIndirectionHops(), n.fs.IncludeContentless, n.fs.effectiveUndescribedContentPolicy(), n.fs.effectiveDescribeStrategy(), 0, n.fs.PrimaryContentAttr, n.fs.effectiveMaxInlineSetMembers(), n.fs.ContentAttrAliases, n.fs.TitleAttrAliases, n.fs.effectiveSpecialContentPolicy())
+			} else if serverSorted && cont == "" && err == nil {
+				recordSortCapability(n.fs, true)
+			}
+			cancel()
+			queryStatsFor(n.fs).recordResult(n.searchExp, err)
+			if n.fs.CircuitBreakerEnabled {
+				breaker.recordResult(err)
+			}
+			if err == nil || attempt >= queryRetryMax-1 || !isTransientQueryErr(err) {
+				break
+			}
+			delay := queryRetryDelay(attempt)
+			debugf("fs.search: ReadDirAll for '%s': query attempt %d failed transiently, retrying in %v: %v", n.searchExp, attempt+1, delay, err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+		}
+		if err != nil && n.fs.CredentialRefresher != nil && queryErrno(err) == fuse.EACCES {
+			// An auth failure isn't transient in isTransientQueryErr's
+			// sense (queryErrno maps it away from fuse.EIO, so the
+			// retry loop above never touches it), but it is the one
+			// case CredentialRefresher exists to recover from: refresh
+			// once, then reissue this same page's query exactly as the
+			// sortUnsupported fallback above reissues its own, rather
+			// than failing a long-lived mount's every query after its
+			// token happens to expire.
+			Logger.Printf("fs.search: ReadDirAll for '%s': query failed with an auth error, refreshing credentials before retrying", n.searchExp)
+			if rerr := refreshCredentials(ctx, n.fs); rerr != nil {
+				Logger.Printf("fs.search: ReadDirAll for '%s': credential refresh failed, giving up: %v", n.searchExp, rerr)
+			} else {
+				retryCtx := ctx
+				retryCancel := func() {}
+				if timeout := n.fs.effectiveQueryTimeout(); timeout > 0 {
+					retryCtx, retryCancel = context.WithTimeout(ctx, timeout)
+				}
+				dents, next, elided, fallbacks, unresolved, bad, degraded, total, totalKnown, err = dir.ResolvePage(retryCtx, n.fs.client, n.effectiveSearchExpr(), pinnedAt, cont, seen, depth, n.effectiveDescribeRules(), sortBy, n.fs.NameAttribute, n.fs.GroupByAttribute, n.fs.MIMEPreference, n.fs.effectiveContentIndirectionHops(), n.fs.IncludeContentless, n.fs.effectiveUndescribedContentPolicy(), n.fs.effectiveDescribeStrategy(), 0, n.fs.PrimaryContentAttr, n.fs.effectiveMaxInlineSetMembers(), n.fs.ContentAttrAliases, n.fs.TitleAttrAliases, n.fs.effectiveSpecialContentPolicy())
+				retryCancel()
+				queryCtx = retryCtx
+				queryStatsFor(n.fs).recordResult(n.searchExp, err)
+				if n.fs.CircuitBreakerEnabled {
+					breaker.recordResult(err)
+				}
+			}
+		}
+		if err != nil && queryTooExpensive(err) && n.fs.AutoLimitOnExpensiveQuery {
+			// The server rejected this query as too costly to run
+			// unbounded; retry it once with a small, explicit limit
+			// rather than failing outright, the same way the
+			// sortUnsupported fallback above reissues its own query
+			// with an adjusted parameter instead of giving up.
+			limit := n.fs.effectiveExpensiveQueryLimit()
+			Logger.Printf("fs.search: ReadDirAll for '%s': query too expensive, retrying with limit=%d: %v", n.searchExp, limit, err)
+			retryCtx := ctx
+			retryCancel := func() {}
+			if timeout := n.fs.effectiveQueryTimeout(); timeout > 0 {
+				retryCtx, retryCancel = context.WithTimeout(ctx, timeout)
+			}
+			dents, next, elided, fallbacks, unresolved, bad, degraded, total, totalKnown, err = dir.ResolvePage(retryCtx, n.fs.client, n.effectiveSearchExpr(), pinnedAt, cont, seen, depth, n.effectiveDescribeRules(), sortBy, n.fs.NameAttribute, n.fs.GroupByAttribute, n.fs.MIMEPreference, n.fs.effectiveContentIndirectionHops(), n.fs.IncludeContentless, n.fs.effectiveUndescribedContentPolicy(), n.fs.effectiveDescribeStrategy(), limit, n.fs.PrimaryContentAttr, n.fs.effectiveMaxInlineSetMembers(), n.fs.ContentAttrAliases, n.fs.TitleAttrAliases, n.fs.effectiveSpecialContentPolicy())
+			retryCancel()
+			queryCtx = retryCtx
+			queryStatsFor(n.fs).recordResult(n.searchExp, err)
+			if n.fs.CircuitBreakerEnabled {
+				breaker.recordResult(err)
+			}
+			if err != nil {
+				Logger.Printf("fs.search: ReadDirAll for '%s': retry with limit=%d also failed: %v", n.searchExp, limit, err)
+			}
+		}
+		if err != nil && n.at == nil && pinnedAt != nil && atUnsupported(err) {
+			// PinPaginationSnapshot pinned pinnedAt on our own behalf,
+			// not at the caller's request the way n.at is; a server
+			// that doesn't support point-in-time querying at all should
+			// degrade this listing to unpinned rather than fail it
+			// outright the way the genuine n.at case below does.
+			Logger.Printf("fs.search: ReadDirAll for '%s': server doesn't support point-in-time querying, continuing without PinPaginationSnapshot: %v", n.searchExp, err)
+			pinnedAt = nil
+			retryCtx := ctx
+			retryCancel := func() {}
+			if timeout := n.fs.effectiveQueryTimeout(); timeout > 0 {
+				retryCtx, retryCancel = context.WithTimeout(ctx, timeout)
+			}
+			dents, next, elided, fallbacks, unresolved, bad, degraded, total, totalKnown, err = dir.ResolvePage(retryCtx, n.fs.client, n.effectiveSearchExpr(), pinnedAt, cont, seen, depth, n.effectiveDescribeRules(), sortBy, n.fs.NameAttribute, n.fs.GroupByAttribute, n.fs.MIMEPreference, n.fs.effectiveContentIndirectionHops(), n.fs.IncludeContentless, n.fs.effectiveUndescribedContentPolicy(), n.fs.effectiveDescribeStrategy(), 0, n.fs.PrimaryContentAttr, n.fs.effectiveMaxInlineSetMembers(), n.fs.ContentAttrAliases, n.fs.TitleAttrAliases, n.fs.effectiveSpecialContentPolicy())
+			retryCancel()
+			queryCtx = retryCtx
+			queryStatsFor(n.fs).recordResult(n.searchExp, err)
+			if n.fs.CircuitBreakerEnabled {
+				breaker.recordResult(err)
+			}
+		}
+		if err != nil {
+			if queryTooExpensive(err) {
+				// Surfaced via errorFileName instead of the generic EIO
+				// below, so a user who hits this sees a clear
+				// explanation and a suggestion to narrow their
+				// expression, rather than an opaque I/O error.
+				msg := fmt.Sprintf("query %q rejected as too expensive: %v\nnarrow the expression (e.g. add a date range or a more specific predicate) and try again.\n", n.searchExp, err)
+				Logger.Printf("fs.search: ReadDirAll for '%s': %s", n.searchExp, msg)
+				n.mu.Lock()
+				n.lastFatalError = msg
+				n.mu.Unlock()
+				return fuse.Errno(syscall.E2BIG)
+			}
+			if n.fs.QueryHardBudget > 0 && ctx.Err() == context.DeadlineExceeded {
+				Logger.Printf("fs.search: ReadDirAll for '%s': exceeded its hard query budget (%v)", n.searchExp, n.fs.QueryHardBudget)
+				return fuse.EIO
+			}
+			if timeout := n.fs.effectiveQueryTimeout(); timeout > 0 && queryCtx.Err() == context.DeadlineExceeded {
+				Logger.Printf("fs.search: ReadDirAll for '%s': query timed out after %v", n.searchExp, timeout)
+				return n.fs.effectiveQueryTimeoutErrno()
+			}
+			if n.at != nil && atUnsupported(err) {
+				// The server itself doesn't understand the point-in-time
+				// constraint n.at asked for, as opposed to some other query
+				// failure doReaddir should report as a generic EIO; say so
+				// plainly rather than letting the caller mistake a silently
+				// present-day result for the historical snapshot it asked
+				// for.
+				Logger.Printf("fs.search: ReadDirAll for '%s': server doesn't support point-in-time querying: %v", n.searchExp, err)
+				return fuse.EOPNOTSUPP
+			}
+			if listing, ok := n.loadOfflineCache(); ok {
+				// The live query failed outright (most likely the
+				// server is simply unreachable); fall back to the
+				// last successful listing on disk rather than failing
+				// the whole directory with EIO, so a mount used on an
+				// intermittent connection can still browse its
+				// directory structure offline. staleMarkerName flags
+				// the result so it's never mistaken for a fresh one.
+				Logger.Printf("fs.search: ReadDirAll for '%s': live query failed (%v); serving cached listing from %v", n.searchExp, err, listing.SavedAt.Format(time.RFC3339))
+				n.mu.Lock()
+				n.applyOfflineCacheListing(listing)
+				n.mu.Unlock()
+				return nil
+			}
+			if isTransientQueryErr(err) {
+				// All of this page's retries (see isTransientQueryErr,
+				// queryRetryMax) still failed, but there's no need to
+				// break the whole "ls" over it if n already has a
+				// listing from an earlier successful ReadDirAll:
+				// serving that stale listing, flagged with
+				// staleMarkerName the same way a served OfflineCachePath
+				// listing is, is a lot less jarring than EIO for a blip
+				// that's likely to clear up by the next refresh. An
+				// error that queryErrno maps away from fuse.EIO (auth,
+				// permission) skips this and fails fast instead, since
+				// retrying or masking those behind a stale listing
+				// would just hide a problem a stale directory can't fix.
+				n.mu.Lock()
+				if len(n.lastNames) > 0 {
+					names := n.lastNames
+					hasMarker := false
+					for _, name := range names {
+						if name == staleMarkerName {
+							hasMarker = true
+							break
+						}
+					}
+					if !hasMarker {
+						n.lastNames = append(append([]string{}, names...), staleMarkerName)
+					}
+					n.lastFatalError = fmt.Sprintf("live query failed (%v); serving the previous listing\n", err)
+					n.mu.Unlock()
+					Logger.Printf("fs.search: ReadDirAll for '%s': live query failed after retrying (%v); serving previous in-memory listing instead of EIO", n.searchExp, err)
+					return nil
+				}
+				n.mu.Unlock()
+			}
+			n.mu.Lock()
+			n.lastFatalError = fmt.Sprintf("query %q failed: %v\n", n.searchExp, err)
+			n.mu.Unlock()
+			return queryErrnoLogf(fmt.Sprintf("GetRecentPermanodes error in ReadDirAll for '%s'", n.searchExp), err)
+		}
+
+		if threshold := n.fs.DescribeCompletenessRetryThreshold; threshold > 0 {
+			if frac := describeCompletenessFraction(fallbacks, unresolved, len(dents)+unresolved); frac > threshold {
+				Logger.Printf("fs.search: ReadDirAll for '%s': %d/%d entries in this page needed a describe fallback or were left unresolved (%.0f%%, over the %.0f%% threshold); retrying once with describe depth %d", n.searchExp, fallbacks+unresolved, len(dents)+unresolved, frac*100, threshold*100, depth+1)
+				for k := range seen {
+					delete(seen, k)
+				}
+				for k, v := range seenBeforePage {
+					seen[k] = v
+				}
+				retryCtx := ctx
+				retryCancel := func() {}
+				if timeout := n.fs.effectiveQueryTimeout(); timeout > 0 {
+					retryCtx, retryCancel = context.WithTimeout(ctx, timeout)
+				}
+				rdents, rnext, relided, rfallbacks, runresolved, rbad, rdegraded, rtotal, rtotalKnown, rerr := dir.ResolvePage(retryCtx, n.fs.client, n.effectiveSearchExpr(), pinnedAt, cont, seen, depth+1, n.effectiveDescribeRules(), sortBy, n.fs.NameAttribute, n.fs.GroupByAttribute, n.fs.MIMEPreference, n.fs.effectiveContentIndirectionHops(), n.fs.IncludeContentless, n.fs.effectiveUndescribedContentPolicy(), n.fs.effectiveDescribeStrategy(), 0, n.fs.PrimaryContentAttr, n.fs.effectiveMaxInlineSetMembers(), n.fs.ContentAttrAliases, n.fs.TitleAttrAliases, n.fs.effectiveSpecialContentPolicy())
+				retryCancel()
+				queryCtx = retryCtx
+				queryStatsFor(n.fs).recordResult(n.searchExp, rerr)
+				if n.fs.CircuitBreakerEnabled {
+					breaker.recordResult(rerr)
+				}
+				if rerr != nil {
+					Logger.Printf("fs.search: ReadDirAll for '%s': describe-completeness retry failed, keeping the original page: %v", n.searchExp, rerr)
+					for k := range seen {
+						delete(seen, k)
+					}
+					for k, v := range seenBeforePage {
+						seen[k] = v
+					}
+					for _, de := range dents {
+						seen[de.Name] = true
+					}
+				} else {
+					dents, next, elided, fallbacks, unresolved, bad, degraded, total, totalKnown = rdents, rnext, relided, rfallbacks, runresolved, rbad, rdegraded, rtotal, rtotalKnown
+				}
+			}
+		}
+
+		if cont == "" && (len(n.fs.ExtraSearchClients) > 0 || n.fs.IncludeDeleted) {
+			// Federated servers and deleted entries both only ever
+			// contribute their first page (see federatedEntries and
+			// deletedEntries), folded into the primary's own first page
+			// so the rest of this loop's per-entry handling (sets,
+			// symlinks, truncation, ...) applies to them exactly as it
+			// would to a local result.
+			used := make(map[string]bool, len(dents))
+			for _, de := range dents {
+				used[de.Name] = true
+			}
+			dents = append(dents, n.federatedEntries(ctx, seen, used, depth)...)
+			dents = append(dents, n.deletedEntries(ctx, seen, used, depth)...)
+		}
+
+		if n.fs.DeterministicListing {
+			sortEntriesDeterministically(dents)
+		}
+		if n.fs.CollisionDirPriority {
+			dents = prioritizeDirEntries(dents)
+		}
+
+		pageStart := time.Now()
+		for i, de := range dents {
+			if shouldAbortForCancellation(ctx, i, len(dents)) {
+				// doReaddir only commits ents/permanode/lastNames/etc.
+				// into n's fields once, in the n.mu.Lock() block after
+				// every page finishes, so returning here simply discards
+				// this pass's in-progress work without touching n's
+				// existing listing, and the next ReadDirAll starts a
+				// clean pass.
+				Logger.Printf("fs.search: ReadDirAll for '%s' canceled after processing %d/%d entries from this page", n.searchExp, i, len(dents))
+				return fuse.EINTR
+			}
+			if n.fs.DescribeProcessingBudget > 0 && i > 0 && time.Since(pageStart) > n.fs.DescribeProcessingBudget {
+				Logger.Printf("fs.search: ReadDirAll for '%s' hit its describe processing budget (%v) after processing %d/%d entries from this page; returning partial results", n.searchExp, n.fs.DescribeProcessingBudget, i, len(dents))
+				partial = true
+				break truncate
+			}
+			if n.timeRange != nil && !n.timeRange.contains(de.ModTime) {
+				continue
+			}
+			if !n.resultFilterAllows(de) {
+				continue
+			}
+			if !n.mimeFilterAllows(de) {
+				continue
+			}
+			if len(lastNames) >= resultCap {
+				Logger.Printf("fs.search: ReadDirAll for '%s' truncated at %d entries", n.searchExp, resultCap)
+				truncated = true
+				pageResumeCont = cont
+				pageResumeSkip = i
+				break truncate
+			}
+			var rawName, subdir string
+			if n.fs.StableIDNames {
+				rawName = stableIDName(de)
+			} else {
+				rawName, subdir = n.stableName(de, &errLog)
+			}
+			name := capNestingDepth(n.fs, sanitizeFilename(n.fs, normalizeFilename(n.fs, trimTrailingFilenameWhitespace(n.fs, rawName))))
+			if clean, original := stripControlChars(n.fs, name); original != "" {
+				name = clean
+				originalNames[name] = original
+			}
+			if guarded := guardFilename(name, de.Permanode, guardedOwners); guarded != name {
+				originalNames[guarded] = name
+				name = guarded
+			}
+			if n.fs.StableIDNames && de.Name != "" && de.Name != name {
+				originalNames[name] = de.Name
+			}
+			if de.IsDeleted {
+				deleted[name] = true
+			}
+			if subdir != "" {
+				subdirName := sanitizeFilename(n.fs, normalizeFilename(n.fs, trimTrailingFilenameWhitespace(n.fs, subdir)))
+				collisionSubdirs[subdirName] = collisionSubdirEntry{name: name, entry: de}
+				permanode[subdirName] = de.Permanode
+				modTime[subdirName] = n.entryModTime(de)
+				debugf("fs.search: name %q = collision subdir nesting %q (permanode %v)", subdirName, name, de.Permanode)
+				lastNames = append(lastNames, subdirName)
+				continue
+			}
+			if truncatedName, original := truncateFilename(name, de.Permanode); original != "" {
+				name = truncatedName
+				originalNames[name] = original
+			}
+			if n.fs.FollowCamliPath && hasCamliPathAttrs(de.PNodeMeta) {
+				camliPaths[name] = de
+				permanode[name] = de.Permanode
+				pnodeMeta[name] = de.PNodeMeta
+				modTime[name] = n.entryModTime(de)
+				debugf("fs.search: name %q = camliPath permanode %v", name, de.Permanode)
+				lastNames = append(lastNames, name)
+				continue
+			}
+			if de.IsSet {
+				if n.fs.FlattenSets {
+					n.flattenSetInto(ctx, name, de, ents, permanode, pnodeMeta, imageMeta, modTime, &lastNames, seen, pinnedAt)
+					continue
+				}
+				if n.fs.CollapseSingletonSets && n.collapseSingletonSetInto(ctx, name, de, ents, permanode, pnodeMeta, imageMeta, modTime, &lastNames, pinnedAt) {
+					continue
+				}
+				sets[name] = de
+				modTime[name] = n.entryModTime(de)
+				lastNames = append(lastNames, name)
+				continue
+			}
+			if de.IsSymlink {
+				symlinks[name] = de.SymlinkTarget
+				permanode[name] = de.Permanode
+				pnodeMeta[name] = de.PNodeMeta
+				modTime[name] = n.entryModTime(de)
+				debugf("fs.search: name %q = symlink to %q", name, de.SymlinkTarget)
+				lastNames = append(lastNames, name)
+				continue
+			}
+			if de.IsContentless {
+				contentless[name] = true
+				permanode[name] = de.Permanode
+				pnodeMeta[name] = de.PNodeMeta
+				modTime[name] = n.entryModTime(de)
+				debugf("fs.search: name %q = contentless permanode %v", name, de.Permanode)
+				lastNames = append(lastNames, name)
+				continue
+			}
+			if de.IsPlaceholder {
+				placeholders[name] = true
+				permanode[name] = de.Permanode
+				pnodeMeta[name] = de.PNodeMeta
+				modTime[name] = n.entryModTime(de)
+				debugf("fs.search: name %q = placeholder for unresolved camliContent on permanode %v", name, de.Permanode)
+				lastNames = append(lastNames, name)
+				continue
+			}
+			ents[name] = de.Blob
+			permanode[name] = de.Permanode
+			pnodeMeta[name] = de.PNodeMeta
+			imageMeta[name] = de.Image
+			modTime[name] = n.entryModTime(de)
+			debugf("fs.search: name %q = %v (at %v)", name, de.Blob.BlobRef, de.ModTime)
+			lastNames = append(lastNames, name)
+			if len(n.fs.RenditionAttrs) > 0 {
+				n.addRenditionEntries(ctx, name, de, ents, permanode, pnodeMeta, imageMeta, modTime, &lastNames, &errLog)
+			}
+			if n.fs.ExtractedTextAttr != "" {
+				n.addExtractedTextEntry(name, de, ents, extractedText, &lastNames, &errLog)
+			}
+		}
+		if n.fs.IncrementalReaddir {
+			n.commitPartialReaddir(ents, permanode, pnodeMeta, imageMeta, sets, symlinks, contentless, placeholders, deleted, camliPaths, extractedText, collisionSubdirs, originalNames, modTime, lastNames)
+		}
+		totalElided += elided
+		totalFallbacks += fallbacks
+		totalUnresolved += unresolved
+		badContent = append(badContent, bad...)
+		allDegraded = append(allDegraded, degraded...)
+		if cont == "" {
+			// The total match count describes the whole query, not a
+			// single page, so only the first page's value is worth
+			// keeping; a later page's own total (if even reported)
+			// would just repeat it.
+			matchTotal, matchTotalKnown = total, totalKnown
+		}
+		if next == "" {
+			break
+		}
+		if n.fs.QuerySoftBudget > 0 && time.Since(budgetStart) > n.fs.QuerySoftBudget {
+			// Keep whatever pages already came back rather than
+			// paging on indefinitely; see CamliFileSystem.QuerySoftBudget.
+			Logger.Printf("fs.search: ReadDirAll for '%s' hit its query soft budget (%v) after %d entries; returning partial results", n.searchExp, n.fs.QuerySoftBudget, len(lastNames))
+			partial = true
+			break
+		}
+		cont = next
+	}
+	incDescribeSkip("elided", totalElided)
+	incDescribeSkip("fallback", totalFallbacks)
+	incDescribeSkip("unresolved", totalUnresolved)
+	incDescribeSkip("bad_content", len(badContent))
+	incDescribeSkip("degraded", len(allDegraded))
+	if totalElided > 0 {
+		Logger.Printf("fs.search: ReadDirAll for '%s' elided %d set(s) whose members describe depth %d didn't reach", n.searchExp, totalElided, depth)
+		errLog = append(errLog, fmt.Sprintf("elided %d set(s) whose members describe depth %d didn't reach", totalElided, depth))
+	}
+	if totalFallbacks > 0 {
+		Logger.Printf("fs.search: ReadDirAll for '%s' recovered %d entry(s) whose camliContent describe depth %d didn't reach, via a direct describe", n.searchExp, totalFallbacks, depth)
+		errLog = append(errLog, fmt.Sprintf("recovered %d entry(s) whose camliContent describe depth %d didn't reach, via a direct describe", totalFallbacks, depth))
+	}
+	if totalUnresolved > 0 {
+		verb := "skipped"
+		if n.fs.UndescribedContentPolicy == UndescribedContentPlaceholder {
+			verb = "placeholder'd"
+		}
+		Logger.Printf("fs.search: ReadDirAll for '%s' %s %d entry(s) whose camliContent still wasn't a file or directory after %d indirection hop(s)", n.searchExp, verb, totalUnresolved, n.fs.effectiveContentIndirectionHops())
+		errLog = append(errLog, fmt.Sprintf("%s %d entry(s) whose camliContent still wasn't a file or directory after %d indirection hop(s)", verb, totalUnresolved, n.fs.effectiveContentIndirectionHops()))
+	}
+	if len(badContent) > 0 {
+		Logger.Printf("fs.search: ReadDirAll for '%s' skipped %d entry(s) with an empty or unparseable camliContent; see %s", n.searchExp, len(badContent), errorsDirName)
+		errLog = append(errLog, fmt.Sprintf("skipped %d entry(s) with an empty or unparseable camliContent; see %s", len(badContent), errorsDirName))
+	}
+	if len(allDegraded) > 0 {
+		Logger.Printf("fs.search: ReadDirAll for '%s': describe data was missing for %d entry(s) (whole page or individual blobs); falling back to resolving them directly (degraded mode, slower)", n.searchExp, len(allDegraded))
+		errLog = append(errLog, fmt.Sprintf("describe data was missing for %d entry(s); fell back to resolving them directly (degraded mode)", len(allDegraded)))
+		n.resolveDegraded(ctx, allDegraded, ents, modTime, &lastNames, seen)
+	}
+	if warnThreshold := n.fs.effectiveLargeListingWarnThreshold(); len(lastNames) >= warnThreshold {
+		// Unlike truncated and partial below, nothing here was
+		// actually cut short: HandleReadDirAller hands bazil.org/fuse
+		// the whole slice, which pages it across as many kernel
+		// readdir replies as needed. This is only a heads-up that the
+		// listing has grown large enough to be worth narrowing; see
+		// CamliFileSystem.LargeListingWarnThreshold.
+		Logger.Printf("fs.search: ReadDirAll for '%s' returned %d entries, at or above its large-listing warn threshold (%d)", n.searchExp, len(lastNames), warnThreshold)
+		errLog = append(errLog, fmt.Sprintf("listing has %d entries, at or above its large-listing warn threshold (%d); see CamliFileSystem.LargeListingWarnThreshold", len(lastNames), warnThreshold))
+	}
+	if truncated {
+		// A plain log line is easy to miss in "ls" output; a visible
+		// marker entry tells whoever's browsing the mount directly
+		// that the listing isn't everything, without them needing to
+		// go check the logs.
+		lastNames = append(lastNames, truncatedMarkerName)
+		errLog = append(errLog, fmt.Sprintf("listing truncated at %d entries; see CamliFileSystem.MaxResults", resultCap))
+	}
+	if partial {
+		// Same reasoning as truncatedMarkerName: the soft budget
+		// cutting a listing short should be visible in "ls", not
+		// just the logs.
+		lastNames = append(lastNames, partialMarkerName)
+		errLog = append(errLog, fmt.Sprintf("listing cut short after %v; see CamliFileSystem.QuerySoftBudget", n.fs.QuerySoftBudget))
+	}
+	if len(lastNames) == 0 && n.fs.ShowEmptyMarker {
+		// Indistinguishable from a failed query otherwise; see
+		// CamliFileSystem.ShowEmptyMarker.
+		lastNames = append(lastNames, emptyMarkerName)
+	}
+	if minSize, maxSize := n.effectiveSizeFilter(); minSize != sizeFilterUnset || maxSize != sizeFilterUnset {
+		n.filterBySize(ents, permanode, pnodeMeta, imageMeta, modTime, &lastNames, minSize, maxSize)
+	}
+	var dupes map[string]dupeEntry
+	if n.fs.DedupByContent {
+		dupes = n.dedupeByContent(ents, permanode, pnodeMeta, imageMeta, modTime, &lastNames)
+	}
+	var similar map[string]similarEntry
+	if n.fs.SimilarityClusterAttr != "" {
+		similar = n.dedupeBySimilarity(ents, permanode, pnodeMeta, imageMeta, modTime, &lastNames)
+	}
+
+	if n.fs.PersistentNames {
+		n.persistStableNames()
+	}
+
+	facetCounts := n.computeFacetCounts(n.fs.FacetAttrs, lastNames, ents, pnodeMeta, modTime)
+	var timeline []timelineBucket
+	if n.fs.EnableTimelineFile {
+		timeline = computeTimeline(lastNames, modTime, n.fs.effectiveTimelineGranularity())
+	}
+
+	n.mu.Lock()
+	oldNames := n.lastNames
+	oldFP := buildSearchResultFingerprints(oldNames, n.permanode, n.modTime)
+	n.ents = ents
+	n.permanode = permanode
+	n.pnodeMeta = pnodeMeta
+	n.imageMeta = imageMeta
+	n.sets = sets
+	n.symlinks = symlinks
+	n.contentless = contentless
+	n.placeholders = placeholders
+	n.deleted = deleted
+	n.camliPaths = camliPaths
+	n.extractedText = extractedText
+	n.collisionSubdirs = collisionSubdirs
+	n.originalNames = originalNames
+	n.dupes = dupes
+	n.similar = similar
+	n.badContent = badContent
+	if n.fs.DisableErrorsLog {
+		errLog = nil
+	}
+	n.errorLog = errLog
+	n.modTime = modTime
+	n.facetCounts = facetCounts
+	n.timeline = timeline
+	n.matchTotal = matchTotal
+	n.matchTotalKnown = matchTotalKnown
+	n.lastFallbackCount = totalFallbacks
+	n.lastUnresolvedCount = totalUnresolved
+	n.lastFatalError = ""
+	n.lastNames = lastNames
+	n.negLookup = nil
+	n.schemaMeta = nil
+	n.pageCursors = nil
+	if truncated && n.fs.EnablePaging {
+		n.pageCursors = []pageCursor{{cont: pageResumeCont, skip: pageResumeSkip}}
+	}
+	if !serverSorted {
+		n.sortLastNames()
+	}
+	n.sampleLastNamesLocked()
+	newNames := n.lastNames
+	newFP := buildSearchResultFingerprints(newNames, n.permanode, n.modTime)
+	Logger.Printf("fs.search returning %d entries", len(n.lastNames))
+	n.lastReaddir = time.Now()
+	n.mu.Unlock()
+
+	n.saveOfflineCache(newNames, permanode, sets, symlinks, modTime)
+	n.invalidateDiff(oldNames, oldFP, newNames, newFP)
+	n.seedSinceToken(ctx)
+	return nil
+}
+
+// seedSinceToken establishes n.sinceToken right after a full doReaddir
+// pass, if n is sinceQueryEligible and n.fs.client supports
+// SinceQuerier, so the next refresh can try tryApplySince's delta path
+// instead of repeating a full query. The added/removed this call
+// itself returns are discarded; doReaddir's own full pass just seeded
+// n with a complete, fresher listing than any delta could improve on,
+// so only its newSince is of any use here. A failure is logged and
+// otherwise ignored: n.sinceToken simply stays "", and the next
+// refresh tries again the same way this one did.
+func (n *searchResultDir) seedSinceToken(ctx context.Context) {
+	if !n.sinceQueryEligible() {
+		return
+	}
+	sq, ok := n.fs.client.(SinceQuerier)
+	if !ok {
+		return
+	}
+	_, _, newSince, err := sq.QuerySince(ctx, n.effectiveSearchExpr(), "")
+	if err != nil {
+		debugf("fs.search: ReadDirAll for '%s': seeding a since-token failed, staying on full refreshes: %v", n.searchExp, err)
+		return
+	}
+	n.mu.Lock()
+	n.sinceToken = newSince
+	n.mu.Unlock()
+}
+
+// flattenSetInto resolves de's members one level deep (nested sets
+// aren't recursed into further, keeping this a flat, bounded pass
+// rather than a full tree walk) and adds each member that resolves to
+// a file or directory directly into ents/permanode/pnodeMeta/
+// imageMeta/modTime/lastNames, under "<setName>-<member name>", for
+// CamliFileSystem.FlattenSets. setName is already unique per set (see
+// stableName), so prefixing with it is enough to keep two different
+// sets' same-named members from colliding with each other.
+func (n *searchResultDir) flattenSetInto(ctx context.Context, setName string, de dir.Entry, ents map[string]*search.DescribedBlob, permanode map[string]blob.Ref, pnodeMeta, imageMeta map[string]*search.DescribedBlob, modTime map[string]time.Time, lastNames *[]string, seen map[string]bool, at *types.Time3339) {
+	for _, member := range de.Members {
+		e, ok, err := dir.ResolveMember(ctx, n.fs.client, member, at)
+		if err != nil {
+			Logger.Printf("fs.search: flattening set %q: resolving member %v: %v", setName, member, err)
+			continue
+		}
+		if !ok || e.IsSet {
+			continue
+		}
+		name := setName + "-" + e.Name
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		ents[name] = e.Blob
+		permanode[name] = e.Permanode
+		pnodeMeta[name] = e.PNodeMeta
+		imageMeta[name] = e.Image
+		modTime[name] = n.entryModTime(e)
+		*lastNames = append(*lastNames, name)
+	}
+}
+
+// collapseSingletonSetInto resolves de's sole member and, if it
+// resolves to a file or directory (not itself a set), adds it
+// directly into ents/permanode/pnodeMeta/imageMeta/modTime/lastNames
+// under name -- the set's own display name -- rather than name being
+// listed as a one-entry subdirectory; see
+// CamliFileSystem.CollapseSingletonSets. It reports whether the
+// collapse happened; on a false return the caller should list de as
+// an ordinary set directory instead.
+func (n *searchResultDir) collapseSingletonSetInto(ctx context.Context, name string, de dir.Entry, ents map[string]*search.DescribedBlob, permanode map[string]blob.Ref, pnodeMeta, imageMeta map[string]*search.DescribedBlob, modTime map[string]time.Time, lastNames *[]string, at *types.Time3339) bool {
+	if len(de.Members) != 1 {
+		return false
+	}
+	e, ok, err := dir.ResolveMember(ctx, n.fs.client, de.Members[0], at)
+	if err != nil {
+		Logger.Printf("fs.search: collapsing singleton set %q: resolving member %v: %v", name, de.Members[0], err)
+		return false
+	}
+	if !ok || e.IsSet {
+		return false
+	}
+	ents[name] = e.Blob
+	permanode[name] = e.Permanode
+	pnodeMeta[name] = e.PNodeMeta
+	imageMeta[name] = e.Image
+	modTime[name] = n.entryModTime(e)
+	*lastNames = append(*lastNames, name)
+	return true
+}
+
+// stableName returns the display name de's permanode should be listed
+// under, and, under CollisionStrategySubdirByBlobRef, the
+// collisionSubdirs name it should be nested under instead (empty
+// otherwise). Both are pinned in n.stableNames/n.stableOwners/
+// n.stableSubdirs the first time de.Permanode is seen, so later
+// refreshes reuse the same decision. It must be called only from
+// doReaddir (so effectively single-flighted; see
+// searchResultDir.inflight).
+//
+// When CamliFileSystem.PersistentNames is set, a name already pinned
+// to de.Permanode in a prior mount's persistentNameStore takes
+// priority over de.Name, so the same permanode keeps the same name
+// across a remount instead of only within this searchResultDir's own
+// lifetime; see persistStableNames, which records this round's
+// decisions back to the store once doReaddir finishes.
+func (n *searchResultDir) stableName(de dir.Entry, errLog *[]string) (name string, subdir string) {
+	if n.stableNames == nil {
+		n.stableNames = make(map[blob.Ref]string)
+		n.stableOwners = make(map[string]blob.Ref)
+	}
+	if name, ok := n.stableNames[de.Permanode]; ok {
+		return name, n.stableSubdirs[de.Permanode]
+	}
+	name = de.Name
+	if templated, ok := n.renderNameTemplate(de); ok {
+		name = templated
+	}
+	if n.fs.PersistentNames {
+		if persisted, ok := persistentNameStoreFor(n.fs).nameFor(de.Permanode); ok {
+			name = persisted
+		}
+	}
+	if owner, taken := n.stableOwners[name]; taken && owner != de.Permanode {
+		// name was already claimed by a different permanode in a
+		// prior refresh; derive a fallback from this permanode's own
+		// blobref so the choice doesn't depend on which of the two
+		// this refresh happened to see first. Which fallback depends on
+		// CamliFileSystem.CollisionStrategy; see its own doc comment.
+		collided := name
+		switch n.fs.CollisionStrategy {
+		case CollisionStrategyNumericSuffix:
+			name = numericCollisionName(name, n.stableOwners)
+			*errLog = append(*errLog, fmt.Sprintf("name collision: %v and %v both claim %q; %v renamed to %q", owner, de.Permanode, collided, de.Permanode, name))
+		case CollisionStrategySubdirByBlobRef:
+			subdir = collisionSubdirName(de.Permanode)
+			*errLog = append(*errLog, fmt.Sprintf("name collision: %v and %v both claim %q; %v nested under %q instead", owner, de.Permanode, collided, de.Permanode, subdir))
+		default:
+			name = stableCollisionName(name, de.Permanode)
+			*errLog = append(*errLog, fmt.Sprintf("name collision: %v and %v both claim %q; %v renamed to %q", owner, de.Permanode, collided, de.Permanode, name))
+		}
+	}
+	if subdir == "" {
+		name = n.caseFoldName(name, de.Permanode, errLog)
+	}
+	n.stableNames[de.Permanode] = name
+	if subdir != "" {
+		if n.stableSubdirs == nil {
+			n.stableSubdirs = make(map[blob.Ref]string)
+		}
+		n.stableSubdirs[de.Permanode] = subdir
+	} else {
+		n.stableOwners[name] = de.Permanode
+	}
+	return name, subdir
+}
+
+// caseFoldName applies CamliFileSystem.CaseCollisionPolicy to name: if
+// it differs only in case from another permanode's own name (tracked
+// in n.caseFoldOwners), CaseCollisionPolicySuffix disambiguates it the
+// same way numericCollisionName already disambiguates an exact-name
+// collision; the zero value, CaseCollisionPolicyKeepBoth, leaves name
+// untouched so a case-sensitive mount keeps listing both exactly as
+// given. Either way, the result's own fold is recorded as pn's, so a
+// third name colliding with it (case-only or otherwise) is caught too.
+func (n *searchResultDir) caseFoldName(name string, pn blob.Ref, errLog *[]string) string {
+	if n.caseFoldOwners == nil {
+		n.caseFoldOwners = make(map[string]blob.Ref)
+	}
+	fold := strings.ToLower(name)
+	if owner, taken := n.caseFoldOwners[fold]; taken && owner != pn {
+		if n.fs.CaseCollisionPolicy == CaseCollisionPolicySuffix {
+			collided := name
+			name = numericCollisionName(name, n.stableOwners)
+			fold = strings.ToLower(name)
+			*errLog = append(*errLog, fmt.Sprintf("case-only name collision: %v and %v both claim %q case-insensitively; %v renamed to %q", owner, pn, collided, pn, name))
+		} else {
+			*errLog = append(*errLog, fmt.Sprintf("case-only name collision: %v and %v both claim %q case-insensitively; keeping both names", owner, pn, name))
+		}
+	}
+	n.caseFoldOwners[fold] = pn
+	return name
+}
+
+// stableCollisionName derives a display name for pn that won't clash
+// with base, by suffixing base with a short, deterministic slice of
+// pn's own blobref rather than pn's content blobref (as
+// dir.fileOrDirEntry's own, order-dependent fallback does).
+//
+// The slice is taken from pn.String() (algorithm and digest together),
+// not just the digest, so two permanodes under different hash
+// algorithms whose digests happen to share a leading run of
+// characters still can't produce the same suffix: a blob store isn't
+// guaranteed to use one hash algorithm for every blob it ever holds.
+func stableCollisionName(base string, pn blob.Ref) string {
+	ext := filepath.Ext(base)
+	suffix := pn.String()
+	if len(suffix) > 8 {
+		suffix = suffix[:8]
+	}
+	return strings.TrimSuffix(base, ext) + "." + suffix + ext
+}
+
+// queryErrno maps a client.Query error to the errno that best explains
+// it to whatever issued the original syscall, so e.g. "cd
+// mount/search/bad:::expr" fails loudly instead of just listing empty.
+// client.Query's error is a plain error with no structured type to
+// switch on (it crosses an HTTP+JSON RPC boundary), so this is
+// necessarily a heuristic over the error text rather than an exact
+// classification; anything it doesn't recognize is treated as a
+// genuine I/O failure.
+func queryErrno(err error) fuse.Errno {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The caller's own request was interrupted (unmount, process
+		// killed, QueryTimeout), not a genuine query failure; EINTR
+		// tells whoever issued the syscall that, rather than EIO
+		// making it look like the server misbehaved.
+		return fuse.EINTR
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "parse"), strings.Contains(msg, "syntax"), strings.Contains(msg, "expression"):
+		return fuse.EINVAL
+	case strings.Contains(msg, "unauthorized"), strings.Contains(msg, "forbidden"), strings.Contains(msg, "permission denied"), strings.Contains(msg, "auth"):
+		return fuse.EACCES
+	default:
+		return fuse.EIO
+	}
+}
+
+// queryErrnoLogf classifies a client.Query error via queryErrno and
+// logs it under the "fs.search: <context>: ..." prefix the rest of
+// this file uses, then returns the errno. Auth failures (EACCES) get
+// their own message suggesting re-authentication instead of the
+// generic one, so whoever's reading the log (or wired up
+// CredentialRefresher, see searchauthrefresh.go) isn't sent looking
+// for corruption that isn't there. label identifies the call site,
+// e.g. "ReadDirAll for 'is:file'" or countFileName.
+func queryErrnoLogf(label string, err error) fuse.Errno {
+	errno := queryErrno(err)
+	if errno == fuse.EACCES {
+		Logger.Printf("fs.search: %s: server rejected the request as unauthorized (%v); re-authenticate and retry", label, err)
+	} else {
+		Logger.Printf("fs.search: %s: %v", label, err)
+	}
+	return errno
+}
+
+// sortUnsupported reports whether err looks like the server rejecting
+// the Sort a query asked for, as opposed to some other query failure
+// doReaddir should still treat as fatal. It's the same
+// text-matching approach queryErrno already uses for lack of anything
+// more structured to go on.
+func sortUnsupported(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "sort")
+}
+
+// atUnsupported reports whether err looks like the server rejecting
+// the point-in-time constraint an "at" snapshot directory's query
+// asked for (see searchAtDir, n.at), rather than some other query
+// failure doReaddir should still treat as a generic EIO. Same
+// text-matching approach as sortUnsupported, for the same reason:
+// nothing more structured to go on.
+func atUnsupported(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "at=") || strings.Contains(msg, "point in time") ||
+		strings.Contains(msg, "point-in-time") || strings.Contains(msg, "describe.at") ||
+		(strings.Contains(msg, "unsupported") && strings.Contains(msg, "at"))
+}
+
+// queryTooExpensive reports whether err looks like the server
+// rejecting n's query as too costly to run, as opposed to some other
+// query failure doReaddir should still treat as a generic EIO. Same
+// text-matching approach as sortUnsupported/atUnsupported, for the
+// same reason: nothing more structured to go on.
+func queryTooExpensive(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "too expensive") || strings.Contains(msg, "too costly") ||
+		(strings.Contains(msg, "query") && strings.Contains(msg, "cost"))
+}
+
+// dirents turns a slice of names, already in the order they should be
+// listed, into fuse.Dirents.
+// dirents builds a []fuse.Dirent from names, all sharing the uniform
+// fuse.DirentType typ. It's for a listing whose every entry is the
+// same kind (e.g. a pseudo-directory of buckets, always fuse.DT_Dir);
+// a listing mixing files and directories needs direntsWithInode's
+// per-name kinds map instead.
+func dirents(names []string, typ fuse.DirentType) []fuse.Dirent {
+	ents := make([]fuse.Dirent, len(names))
+	for i, name := range names {
+		ents[i] = fuse.Dirent{Name: name, Type: typ}
+	}
+	return ents
+}
+
+// sortLastNames reorders n.lastNames, which must already be seeded,
+// according to n.effectiveSortBy(). It must be called with n.mu held.
+//
+// doReaddir skips calling it for a SearchSortBy that serverSortFor
+// could satisfy via the query's own Sort instead (see its
+// serverSorted), since the pages it fetched are already in that
+// order; this is the fallback for everything else, including when
+// the server turned out not to support the sort requested.
+func (n *searchResultDir) sortLastNames() {
+	switch n.effectiveSortBy() {
+	case SearchSortByName:
+		sort.Strings(n.lastNames)
+	case SearchSortByModTimeAsc:
+		n.sortNamesStable(func(a, b string) bool {
+			return n.modTime[a].Before(n.modTime[b])
+		})
+	case SearchSortByModTimeDesc:
+		n.sortNamesStable(func(a, b string) bool {
+			return n.modTime[a].After(n.modTime[b])
+		})
+	case SearchSortByNameNatural:
+		sort.SliceStable(n.lastNames, func(i, j int) bool {
+			return naturalLess(n.lastNames[i], n.lastNames[j])
+		})
+	case SearchSortByAttr:
+		attr, numeric := n.effectiveSortAttr()
+		n.sortNamesStable(func(a, b string) bool {
+			return attrLess(n.attrVal(a, attr), n.attrVal(b, attr), numeric)
+		})
+	case SearchSortByNameDesc:
+		sort.Sort(sort.Reverse(sort.StringSlice(n.lastNames)))
+	case SearchSortBySizeAsc:
+		n.sortNamesStable(func(a, b string) bool {
+			aSize, aOK := n.fileSize(a)
+			bSize, bOK := n.fileSize(b)
+			return sizeLess(aSize, aOK, bSize, bOK, false)
+		})
+	case SearchSortBySizeDesc:
+		n.sortNamesStable(func(a, b string) bool {
+			aSize, aOK := n.fileSize(a)
+			bSize, bOK := n.fileSize(b)
+			return sizeLess(aSize, aOK, bSize, bOK, true)
+		})
+	}
+}
+
+// fileSize returns name's resolved file size in bytes and ok=true, or
+// ok=false if it has none (a set listed as a subdirectory, a
+// contentless permanode, or anything else without its own describe
+// meta), for sortLastNames' SearchSortBySizeAsc/Desc cases. It must be
+// called with n.mu held.
+func (n *searchResultDir) fileSize(name string) (size int64, ok bool) {
+	db := n.ents[name]
+	if db == nil || db.File == nil {
+		return 0, false
+	}
+	return db.File.Size, true
+}
+
+// sizeLess is attrLess's counterpart for SearchSortBySizeAsc/Desc: an
+// entry with no known size (aOK or bOK false) sorts last regardless
+// of desc, the same missing-sorts-last convention SearchSortByAttr
+// uses for a missing attr.
+func sizeLess(aSize int64, aOK bool, bSize int64, bOK bool, desc bool) bool {
+	if aOK != bOK {
+		return aOK
+	}
+	if !aOK {
+		return false
+	}
+	if desc {
+		return aSize > bSize
+	}
+	return aSize < bSize
+}
+
+// attrVal returns name's permanode's raw value for attr, or "" if it
+// has none, for sortLastNames' SearchSortByAttr case. It must be
+// called with n.mu held.
+func (n *searchResultDir) attrVal(name, attr string) string {
+	pm := n.pnodeMeta[name]
+	if pm == nil || pm.Permanode == nil {
+		return ""
+	}
+	return pm.Permanode.Attr.Get(attr)
+}
+
+// maxSearchResultEntries caps how many entries a single
+// searchResultDir will materialize, so that an expression matching a
+// huge fraction of the index doesn't stall "ls" or exhaust memory
+// paging through results that a directory listing can't usefully
+// show anyway.
+const maxSearchResultEntries = 10000
+
+// truncatedMarkerName is the synthetic entry doReaddir appends to a
+// listing it had to cut short (see CamliFileSystem.MaxResults and
+// maxSearchResultEntries), so the truncation is visible in an "ls"
+// rather than only in the logs.
+const truncatedMarkerName = ".truncated"
+
+// hasTruncatedMarker reports whether n's last listing was truncated,
+// i.e. doReaddir appended truncatedMarkerName to n.lastNames.
+func (n *searchResultDir) hasTruncatedMarker() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, name := range n.lastNames {
+		if name == truncatedMarkerName {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultNegLookupTTL is how long searchResultDir.Lookup remembers a
+// name it just found missing, before it's willing to look again, when
+// CamliFileSystem.NegativeLookupTTL isn't set.
+const defaultNegLookupTTL = 5 * time.Second
+
+// effectiveNegLookupTTL returns n.fs.NegativeLookupTTL if set, else
+// defaultNegLookupTTL.
+func (n *searchResultDir) effectiveNegLookupTTL() time.Duration {
+	if n.fs.NegativeLookupTTL != 0 {
+		return n.fs.NegativeLookupTTL
+	}
+	return defaultNegLookupTTL
+}
+
+type searchResultFile struct {
+	node
+	// parent and name identify this file's entry in parent's ents/
+	// permanode/pnodeMeta/etc. maps, for pruneFromParent to remove on
+	// an open-time not-found; nil/"" for a searchResultFile built
+	// outside a searchResultDir.Lookup (e.g. searchCreateHandle's
+	// brand-new file), which has no such entry to prune.
+	parent *searchResultDir
+	name   string
+	// originalName is name's pre-truncation form, set when
+	// doReaddir's truncateFilename had to shorten it to fit
+	// maxFilenameBytes; empty otherwise. It backs the
+	// user.camli.originalName xattr (see camliXattrs), the only
+	// place the full name is still recoverable once the directory
+	// listing itself only ever shows the truncated one.
+	originalName string
+	// readOnly is set for files reached through a search/at/...
+	// snapshot directory, whose contents can never change.
+	readOnly bool
+	// sourceSearch names the saved search or expression alias this
+	// entry was resolved through, set by allRecentDir.Lookup; empty
+	// for a searchResultFile reached any other way. It backs the
+	// user.camli.sourceSearch xattr (see camliXattrs).
+	sourceSearch string
+	// deleted is set for an entry surfaced by deletedEntries (see
+	// CamliFileSystem.IncludeDeleted): readOnly is forced true
+	// regardless of n.at, since recovering a deleted permanode's
+	// content shouldn't silently also resurrect claims against it,
+	// and it backs the user.camli.deleted xattr (see camliXattrs) so
+	// a caller can tell it apart from a live entry programmatically,
+	// not just from deletedSuffix in its name.
+	deleted bool
+
+	// permanode, pnodeMeta, and mimeType back this file's
+	// user.camli.* xattrs (see Getxattr/Listxattr); they're filled in
+	// by searchResultDir.Lookup from its own cached search results
+	// rather than fetched again per-xattr-call.
+	permanode blob.Ref
+	pnodeMeta *search.DescribedBlob // describe meta of the permanode, for its attrs (e.g. "tag")
+	imageMeta *search.DescribedBlob // describe meta of camliContentImage, for image xattrs; nil if none
+	mimeType  string
+	// size and haveSize let Attr report the size already known from
+	// the describe metadata that resolved this file (ccMeta.File.Size
+	// in dir.Entry.Blob), instead of always falling back to
+	// n.node.Attr's own, lazier resolution. haveSize is false for a
+	// directory entry (ccMeta.Dir has no Size) or anywhere the caller
+	// didn't have a describe result to pull it from, e.g.
+	// searchCreateHandle's brand-new file.
+	size     uint64
+	haveSize bool
+	// schemaMeta is the content blobref's resolved schema blob, as
+	// already fetched (or reused from cache) by
+	// searchResultDir.Lookup; an Open implementation can use it
+	// directly instead of re-fetching the same blob it was just
+	// looked up with. schemaMetaAt is when it was resolved, so Open
+	// can fall back to a fresh fetch once it's older than
+	// effectiveSchemaMetaTTL rather than trusting it forever; see
+	// schemaMetaFresh.
+	schemaMeta   *schema.Blob
+	schemaMetaAt time.Time
+
+	// lastAccess is this session's last Open time, in memory only:
+	// it isn't persisted to the server and resets on remount. See
+	// Open and Attr.
+	//
+	// pendingSync is set by placeholderForMissingContent when
+	// n.fs.MissingContentPolicy served a pendingSyncHandle instead of
+	// failing Open outright, for camliXattrs' "user.camli.pending".
+	// Both fields are guarded by accessMu since they're mutated after
+	// construction, by Open, rather than set up front.
+	accessMu    sync.Mutex
+	lastAccess  time.Time
+	pendingSync bool
+}
+
+var (
+	_ fs.Node              = (*searchResultFile)(nil)
+	_ fs.NodeGetxattrer    = (*searchResultFile)(nil)
+	_ fs.NodeListxattrer   = (*searchResultFile)(nil)
+	_ fs.NodeSetxattrer    = (*searchResultFile)(nil)
+	_ fs.NodeRemovexattrer = (*searchResultFile)(nil)
+	_ fs.NodeSetattrer     = (*searchResultFile)(nil)
+	_ fs.NodeOpener        = (*searchResultFile)(nil)
+	_ fs.HandleFlusher     = (*searchResultFile)(nil)
+	_ fs.NodeFsyncer       = (*searchResultFile)(nil)
+)
+
+// Open implements fs.NodeOpener, additionally recording lastAccess so
+// a gallery-style tool that opens a file to view it gets a meaningful
+// atime back from Attr without any server-side write. Read itself
+// isn't separately tracked: one timestamp per open is already enough
+// to drive a "recently viewed" sort.
+//
+// A file with a valid content blobref gets a rangedFileHandle, so
+// seeking within it (as media playback scrubbing does) turns into a
+// direct ranged fetch against the blob rather than discarding and
+// re-streaming from byte zero; anything else (e.g. a brand-new file
+// still being written through searchCreateHandle) falls back to the
+// promoted node.Open. A content blobref already known (from describe
+// metadata) to hold zero bytes instead gets an emptyFileHandle,
+// skipping the schema.FileReader round trip entirely: there's nothing
+// a fetch could tell Read that haveSize/size don't already know.
+//
+// A blobref that's gone missing (the permanode was deleted server-side
+// mid-session, after this directory's last refresh but before
+// SearchCacheTTL expired it, or its content simply hasn't synced to
+// the blobserver yet) prunes n from its parent immediately under the
+// default MissingContentSkip policy; see pruneIfNotFound. Under
+// MissingContentPlaceholder, the same not-found is instead served as
+// a pendingSyncHandle, leaving n listed; see
+// placeholderForMissingContent.
+//
+// With CamliFileSystem.VerifyReads set, Open additionally re-hashes
+// the content against its own blobref before serving it (see
+// verifyContent), failing the open on a mismatch instead of silently
+// handing back corrupted data.
+//
+// CamliFileSystem.OpenContentPolicy governs what happens if n's
+// camliContent changes server-side while this handle stays open: the
+// default OpenContentStable keeps serving the content resolved here;
+// OpenContentFresh instead wraps the handle so it re-resolves and
+// reopens on the next Read. See OpenContentPolicy for the tradeoffs.
+func (n *searchResultFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	limiter := openFileLimiterFor(n.fs)
+	if limiter != nil {
+		if err := limiter.acquire(ctx, n.fs.OpenFilesOverLimit); err != nil {
+			return nil, err
+		}
+	}
+	release := func() {
+		if limiter != nil {
+			limiter.release()
+		}
+	}
+
+	var h fs.Handle
+	if n.blobref.Valid() && n.haveSize && n.size == 0 {
+		h = emptyFileHandle{}
+	} else if n.blobref.Valid() {
+		if n.fs.VerifyReads {
+			if err := n.fs.verifyContent(ctx, n.blobref); err != nil {
+				if ph, ok := n.placeholderForMissingContent(err); ok {
+					release()
+					return ph, nil
+				}
+				n.pruneIfNotFound(err)
+				release()
+				return nil, err
+			}
+		}
+		fetcher := cachingFetcher{fsys: n.fs, next: n.fs.client}
+		var fr *schema.FileReader
+		var err error
+		if n.schemaMeta != nil && schemaMetaFresh(n.schemaMetaAt, n.effectiveSchemaMetaTTL(), time.Now()) {
+			// Lookup already fetched and parsed n.blobref's schema
+			// blob (see searchResultDir.Lookup and the schemaMeta
+			// field doc); reuse it here instead of re-fetching and
+			// re-parsing the same blob just to open it, as long as
+			// it's still within SchemaMetaTTL.
+			fr, err = n.schemaMeta.NewFileReader(fetcher)
+		} else {
+			fr, err = schema.NewFileReader(ctx, fetcher, n.blobref)
+		}
+		if err != nil {
+			if ph, ok := n.placeholderForMissingContent(err); ok {
+				release()
+				return ph, nil
+			}
+			n.pruneIfNotFound(err)
+			release()
+			return nil, err
+		}
+		auditFor(n.fs).Audit(AuditEvent{Time: time.Now(), Type: AuditFileOpened, BlobRef: n.blobref})
+		ranged := &rangedFileHandle{fr: fr, blobref: n.blobref, fs: n.fs, window: n.fs.effectiveReadahead(n.size)}
+		if n.fs.OpenContentPolicy == OpenContentFresh && n.parent != nil && n.name != "" {
+			h = &freshContentHandle{parent: n.parent, name: n.name, fsys: n.fs, inner: ranged}
+		} else {
+			h = ranged
+		}
+	} else {
+		var err error
+		h, err = n.node.Open(ctx, req, resp)
+		if err != nil {
+			release()
+			return nil, err
+		}
+	}
+	n.accessMu.Lock()
+	n.lastAccess = time.Now()
+	n.accessMu.Unlock()
+	if n.parent != nil && n.name != "" {
+		n.parent.recordAccess(n.name, n.pnodeModTime)
+	}
+	go n.warmOpenAhead()
+	if limiter != nil {
+		h = &openCapHandle{inner: h, limiter: limiter}
+	}
+	if n.fs.ExposeReadProgress && n.parent != nil && n.name != "" {
+		p := newReadProgress(int64(n.size), n.haveSize)
+		n.parent.startProgress(n.name, p)
+		h = &progressTrackingHandle{inner: h, dir: n.parent, name: n.name, progress: p}
+	}
+	if n.parent != nil {
+		n.parent.addOpenRef()
+		h = &openRefHandle{inner: h, dir: n.parent}
+	}
+	return h, nil
+}
+
+func (n *searchResultFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	n.node.Attr(ctx, a)
+	if n.haveSize {
+		a.Size = n.size
+	}
+	switch {
+	case n.fs.HardlinkContent && n.blobref.Valid():
+		a.Inode = inodeTableFor(n.fs).inodeFor(n.blobref)
+		a.Nlink = contentLinkCount
+	case n.permanode.Valid():
+		a.Inode = inodeTableFor(n.fs).inodeFor(n.permanode)
+	}
+	a.Mode = n.fs.effectiveFileMode(n.readOnly)
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	a.BlockSize = n.fs.effectiveBlockSize()
+	n.applyUnixAttrs(a)
+	n.applyCreateTime(a)
+	n.applyContentGeneration(a)
+	n.accessMu.Lock()
+	last := n.lastAccess
+	n.accessMu.Unlock()
+	if last.IsZero() || last.Before(a.Mtime) {
+		// Nothing recorded yet (CamliFileSystem.NoAtime, or this node
+		// was never looked up through a searchResultDir that tracks
+		// it), or what is recorded predates the content's own Mtime
+		// (set just above by node.Attr/applyCreateTime): either way,
+		// Atime shouldn't read as older than Mtime, so fall back to
+		// it rather than leaving a stale or zero value.
+		a.Atime = a.Mtime
+	} else {
+		a.Atime = last
+	}
+	return nil
+}
+
+// Setattr implements fs.NodeSetattrer. A looked-up searchResultFile
+// can't have its existing content replaced or its mode/ownership
+// changed yet (see searchCreateHandle for the only write path
+// currently supported, uploading a brand new file); req.Size == 0 and
+// timestamp-only updates are let through as harmless no-ops, since
+// tools like "cp" routinely issue an ftruncate(fd, 0) or touch the
+// mtime even when there's nothing to actually truncate.
+func (n *searchResultFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if err := n.fs.checkWritable(); err != nil {
+		return err
+	}
+	if req.Valid.Size() && req.Size != 0 {
+		Logger.Printf("fs.searchResultFile: Setattr: truncating to %d bytes isn't supported on an existing search result file", req.Size)
+		return fuse.EROFS
+	}
+	if req.Valid.Mode() || req.Valid.Uid() || req.Valid.Gid() {
+		Logger.Printf("fs.searchResultFile: Setattr: changing mode/owner isn't supported on a search result file")
+		return fuse.EROFS
+	}
+	return n.Attr(ctx, &resp.Attr)
+}
+
+// applyUnixAttrs overrides a's mode, uid, and gid with the permanode's
+// own unixPermission/unixOwner/unixGroup attrs (as set by "pk-put
+// file"), when present, so a restored tree is browsed with its
+// original permission bits rather than always the mount's defaults.
+// readOnly and the current process's uid/gid, already set in a by the
+// caller, are left alone for any attr that's absent or unparsable.
+func (n *searchResultFile) applyUnixAttrs(a *fuse.Attr) {
+	if n.pnodeMeta == nil || n.pnodeMeta.Permanode == nil {
+		return
+	}
+	attrs := n.pnodeMeta.Permanode.Attr
+	if perm := attrs.Get("unixPermission"); perm != "" {
+		if mode, err := strconv.ParseUint(perm, 8, 32); err == nil {
+			a.Mode = os.FileMode(mode) &^ os.ModeType
+		}
+	}
+	if owner := attrs.Get("unixOwner"); owner != "" {
+		if uid, err := strconv.ParseUint(owner, 10, 32); err == nil {
+			a.Uid = uint32(uid)
+		}
+	}
+	if group := attrs.Get("unixGroup"); group != "" {
+		if gid, err := strconv.ParseUint(group, 10, 32); err == nil {
+			a.Gid = uint32(gid)
+		}
+	}
+}
+
+// camliXattrs returns the user.camli.* extended attributes this file
+// currently has values for, in Getxattr/Listxattr's naming: a handful
+// of specifically-named ones (permanode, camliContent, mime, tags,
+// and so on below), plus every other permanode attr generically under
+// its own user.camli.<attr> name.
+func (n *searchResultFile) camliXattrs() map[string]string {
+	xattrs := map[string]string{
+		"user.camli.permanode":    n.permanode.String(),
+		"user.camli.camliContent": n.blobref.String(),
+	}
+	mimeType := n.mimeType
+	if mimeType == "" {
+		mimeType = defaultMIMEType
+	}
+	xattrs["user.camli.mime"] = mimeType
+	if name := n.fs.MIMETypeXattrName; name != "" {
+		xattrs[name] = mimeType
+	}
+	if n.originalName != "" {
+		xattrs["user.camli.originalName"] = n.originalName
+	}
+	if n.pnodeMeta != nil && n.pnodeMeta.Permanode != nil {
+		attrs := n.pnodeMeta.Permanode.Attr
+		if tags := attrs["tag"]; len(tags) > 0 {
+			xattrs["user.camli.tags"] = strings.Join(tags, ",")
+		}
+		// Every other permanode attr is exposed generically under its
+		// own user.camli.<attr> name, multi-valued ones joined by
+		// newlines, for anything this function doesn't already
+		// surface under a more specific, differently-formatted name
+		// above. "tag" is skipped here since user.camli.tags above
+		// already covers it, comma-joined instead, for backward
+		// compatibility with scripts expecting that format.
+		for name, values := range attrs {
+			if name == "tag" || len(values) == 0 {
+				continue
+			}
+			xattrs["user.camli."+name] = strings.Join(values, "\n")
+		}
+	}
+	if n.imageMeta != nil && n.imageMeta.Image != nil {
+		xattrs["user.camli.imageWidth"] = strconv.Itoa(int(n.imageMeta.Image.Width))
+		xattrs["user.camli.imageHeight"] = strconv.Itoa(int(n.imageMeta.Image.Height))
+		_, _, orientedW, orientedH := orientedDimensions(n.imageMeta.Image)
+		xattrs["user.camli.imageWidthOriented"] = strconv.Itoa(orientedW)
+		xattrs["user.camli.imageHeightOriented"] = strconv.Itoa(orientedH)
+	}
+	if n.imageMeta != nil && n.imageMeta.File != nil {
+		if t := n.imageMeta.File.Time; !t.IsAnyZero() {
+			xattrs["user.camli.imageTime"] = t.Time().Format(time.RFC3339)
+		}
+	}
+	if lat, long, ok := locationFromMeta(n.pnodeMeta); ok {
+		xattrs["user.camli.location"] = fmt.Sprintf("%g,%g", lat, long)
+	}
+	if n.isPendingSync() {
+		xattrs["user.camli.pending"] = "1"
+	}
+	if n.deleted {
+		xattrs["user.camli.deleted"] = "1"
+	}
+	if n.sourceSearch != "" {
+		xattrs["user.camli.sourceSearch"] = n.sourceSearch
+	}
+	if path, ok := n.origPath(); ok {
+		xattrs["user.camli.origpath"] = path
+	}
+	if tier, ok := n.storageTier(); ok {
+		xattrs["user.camli.storageTier"] = tier
+	}
+	if be, ok := n.backend(); ok {
+		xattrs["user.camli.backend"] = be
+	}
+	if name := n.fs.ChecksumXattrName; name != "" {
+		if digest, ok := n.checksumDigest(); ok {
+			xattrs[name] = digest
+		}
+	}
+	if name, value, ok := labelXattr(n.fs, n.pnodeMeta); ok {
+		xattrs[name] = value
+	}
+	return xattrs
+}
+
+// Getxattr implements fs.NodeGetxattrer, serving the permanode
+// blobref, camliContent blobref, MIME type, tags, (when
+// truncateFilename shortened this entry's name) original full name,
+// and every other permanode attribute of a search result as
+// "user.camli.*" extended attributes; see camliXattrs.
+func (n *searchResultFile) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	v, ok := n.camliXattrs()[req.Name]
+	if !ok {
+		return fuse.ErrNoXattr
+	}
+	resp.Xattr = []byte(v)
+	return nil
+}
+
+// Listxattr implements fs.NodeListxattrer.
+func (n *searchResultFile) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	for name := range n.camliXattrs() {
+		resp.Append(name)
+	}
+	return nil
+}
+
+// attrDirNames maps the reserved, writable pseudo-directory names
+// under a search result directory to the permanode attribute a
+// "mv file <name>/<value>" into them sets. "by-tag" doubles as a
+// facet (see facetOnlyDirNames and attrValueDir.ReadDirAll); the
+// others are write-only until something is moved into them.
+var attrDirNames = map[string]string{
+	"by-tag":   "tag",
+	"by-title": "title",
+}
+
+// facetOnlyDirNames maps the reserved facet names to the facet
+// search.FacetRequest should compute. Unlike attrDirNames, these
+// aren't attribute claims: "year"/"month" come from a result's
+// modtime and "mime"/"camera" come from its file metadata, so there's
+// no sensible Rename destination for any of them.
+//
+// All four are listable ("ls by-mime" shows the MIME types present,
+// with counts), since facetCounts works for any attr. Only "year" and
+// "month" can be cd'ed into, though (see facetDir.Lookup): the search
+// expression language has no "mime:"/"camera:" predicate to narrow
+// with, so there's nothing for a lookup under "by-mime"/"by-camera" to
+// run yet. Adding those predicates (or a structured constraint for
+// them, the way facetTimeRange narrows "year"/"month") is follow-up
+// work, not something this directory can do on its own.
+var facetOnlyDirNames = map[string]string{
+	"by-year":   "year",
+	"by-month":  "month",
+	"by-mime":   "mime",
+	"by-camera": "camera",
+}
+
+// facetCounts returns the value counts for facet over n's current
+// search results, recomputing at most once per effectiveSearchCacheTTL.
+func (n *searchResultDir) facetCounts(ctx context.Context, facet string) (map[string]int, error) {
+	n.mu.Lock()
+	if n.facets == nil {
+		n.facets = make(map[string]*facetCache)
+	}
+	ttl := n.effectiveSearchCacheTTL()
+	if fc, ok := n.facets[facet]; ok && ttl > 0 && fc.computed.After(time.Now().Add(-ttl)) {
+		values := fc.values
+		n.mu.Unlock()
+		return values, nil
+	}
+	n.mu.Unlock()
+
+	values, err := dir.FacetCounts(ctx, n.fs.client, n.effectiveSearchExpr(), &search.FacetRequest{Attr: facet})
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	n.facets[facet] = &facetCache{values: values, computed: time.Now()}
+	n.mu.Unlock()
+	return values, nil
+}
+
+// globSuffix turns a Lookup name into a derived, server-side-narrowed
+// searchResultDir instead of a file: "ls search/<expr>/vacation*"
+// ANDs <expr> with a "vacation" filename constraint and lists that,
+// rather than pulling every result of <expr> to filter client-side.
+// See matchDirPrefix for an equivalent spelling that doesn't rely on
+// the shell passing the "*" through unexpanded.
+const globSuffix = "*"
+
+// matchDirPrefix is the "match:" spelling of the same narrowing
+// globSuffix does: "ls search/<expr>/match:vacation" is equivalent to
+// "ls search/<expr>/vacation*".
+const matchDirPrefix = "match:"
+
+// matchedDir builds the derived searchResultDir a globSuffix or
+// matchDirPrefix Lookup resolves to: n's own search expression ANDed
+// with a literal term for prefix, the same narrowing lookupTargeted
+// already does for a single exact name.
+func (n *searchResultDir) matchedDir(prefix string) *searchResultDir {
+	return n.childExprDir(strconv.Quote(prefix))
+}
+
+// childExprDir builds a derived searchResultDir narrowed by ANDing
+// term onto n's own expression verbatim, for matchedDir's quoted
+// literal terms and drillDown's raw predicate terms alike.
+func (n *searchResultDir) childExprDir(term string) *searchResultDir {
+	return &searchResultDir{
+		fs:        n.fs,
+		searchExp: n.searchExp + " " + term,
+		timeRange: n.timeRange,
+		at:        n.at,
+	}
+}
+
+// drillDown lets "cd is:image" followed by "cd after:2020-01-01"
+// incrementally narrow a mounted search, by ANDing a Lookup miss onto
+// n's own expression instead of failing it, when the miss looks like
+// a search predicate rather than an ordinary filename: it must
+// contain a ":", the shape every predicate in the expression grammar
+// ("is:image", "after:...", "tag:...") already has. A plain name that
+// simply isn't in this listing (".git", "Thumbs.db", a typo) still
+// falls through to ENOENT rather than becoming a live query, since
+// routine stat probes for such names are common and shouldn't each
+// cost a round trip to the server.
+func (n *searchResultDir) drillDown(name string) (*searchResultDir, bool) {
+	if !strings.Contains(name, ":") {
+		return nil, false
+	}
+	return n.childExprDir(name), true
+}
+
+// resolveByRawBlobRef lets a caller who already knows a permanode's
+// blobref open it directly, e.g. "cat mount/search/is:image/sha224-...",
+// regardless of whether it's actually among n's current query results:
+// the query acts as a namespace plus direct-addressing, the same way
+// searchDir.lookupBlobRef lets a blobref-shaped name at the mount root
+// jump straight to a permanode without a query at all. It's tried only
+// once name has already missed every other Lookup path (n.ents and
+// friends, drillDown, ...), so it never shadows an ordinary filename
+// that merely happens to parse as a blobref.
+//
+// ok is false if name doesn't even parse as a blobref, describing it
+// failed, or it described to nothing -- every case where the caller
+// should fall through to its usual ENOENT/lastSeedErr handling.
+//
+// Must be called with n.mu held, and returns with it held; it releases
+// it only around the describe call itself, the same convention
+// resolveLazyEntry uses.
+func (n *searchResultDir) resolveByRawBlobRef(ctx context.Context, name string) (fs.Node, bool) {
+	br, ok := blob.Parse(name)
+	if !ok {
+		return nil, false
+	}
+	d, ok := n.fs.client.(dir.Describer)
+	if !ok {
+		return nil, false
+	}
+	n.mu.Unlock()
+	nod, found, err := resolveBlobRefLookup(ctx, d, br, n.at, n.fs)
+	n.mu.Lock()
+	if err != nil {
+		Logger.Printf("fs.searchResultDir: resolveByRawBlobRef(%q): %v", name, err)
+		return nil, false
+	}
+	return nod, found
+}
+
+// resolveBlobRefLookup is resolveByRawBlobRef's actual describe-and-
+// build-a-node work, factored out from it (the same way joinLazyBatch
+// is factored out from resolveLazyEntry) so it's testable against a
+// fake dir.Describer instead of a real client.
+func resolveBlobRefLookup(ctx context.Context, d dir.Describer, br blob.Ref, at *types.Time3339, fsys *CamliFileSystem) (fs.Node, bool, error) {
+	e, found, err := dir.ResolveMember(ctx, d, br, at)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return entryNode(fsys, e, at), true, nil
+}
+
+func (n *searchResultDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	n.markAccessed()
+	if strings.HasSuffix(name, globSuffix) && name != globSuffix {
+		return n.matchedDir(strings.TrimSuffix(name, globSuffix)), nil
+	}
+	if prefix := strings.TrimPrefix(name, matchDirPrefix); prefix != name && prefix != "" {
+		return n.matchedDir(prefix), nil
+	}
+	if hasGlobMeta(name) {
+		return &globDir{parent: n, pattern: name}, nil
+	}
+	if key := strings.TrimPrefix(name, sortDirPrefix); key != name {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		_, isRealName := n.ents[sanitizeFilename(n.fs, normalizeFilename(n.fs, trimTrailingFilenameWhitespace(n.fs, name)))]
+		n.mu.Unlock()
+		if !isRealName {
+			if sortBy, ok := sortKeys[key]; ok {
+				return n.sortedDir(sortBy), nil
+			}
+			if spec, ok := parseAttrSortKey(key); ok {
+				return n.sortedAttrDir(spec), nil
+			}
+			return nil, fuse.EINVAL
+		}
+		// A real entry happens to be named like a sort directive;
+		// fall through to the ordinary lookup path below instead of
+		// shadowing it.
+	}
+	if page, ok := parsePageDirName(name); ok && n.fs.EnablePaging {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		_, isRealName := n.ents[sanitizeFilename(n.fs, normalizeFilename(n.fs, trimTrailingFilenameWhitespace(n.fs, name)))]
+		inRange := page <= len(n.pageCursors)
+		n.mu.Unlock()
+		if !isRealName {
+			if !inRange {
+				return nil, fuse.ENOENT
+			}
+			return &searchPageDir{parent: n, page: page}, nil
+		}
+		// A real entry happens to be named like a page directive; fall
+		// through to the ordinary lookup path below instead of
+		// shadowing it.
+	}
+	if term, ok := n.fs.effectiveMIMEClassDirs()[name]; ok {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		_, isRealName := n.ents[sanitizeFilename(n.fs, normalizeFilename(n.fs, trimTrailingFilenameWhitespace(n.fs, name)))]
+		n.mu.Unlock()
+		if !isRealName {
+			return n.childExprDir(term), nil
+		}
+		// A real entry happens to be named like a MIME-class
+		// shorthand; fall through to the ordinary lookup path below
+		// instead of shadowing it.
+	}
+	if base := strings.TrimSuffix(name, tagsFileSuffix); base != name && base != "" {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		pn, ok := n.permanode[base]
+		n.mu.Unlock()
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		return &searchTagsFile{dir: n, name: base, permanode: pn}, nil
+	}
+	if base := strings.TrimSuffix(name, starFileSuffix); base != name && base != "" {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		pn, ok := n.permanode[base]
+		n.mu.Unlock()
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		return &searchStarFile{dir: n, name: base, permanode: pn}, nil
+	}
+	if base, ok := sidecarBase(name); ok {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents, err := n.sidecarContents(base)
+		n.mu.Unlock()
+		if err != nil {
+			if err == fuse.ENOENT {
+				return nil, fuse.ENOENT
+			}
+			Logger.Printf("fs.searchResultDir: %s: %v", sidecarSuffix, err)
+			return nil, fuse.EIO
+		}
+		return staticFileNode(string(contents)), nil
+	}
+	if base := strings.TrimSuffix(name, describeJSONSuffix); base != name && base != "" && n.fs.ExposeDescribeJSON {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents, err := n.describeJSONContents(base)
+		n.mu.Unlock()
+		if err != nil {
+			if err == fuse.ENOENT {
+				return nil, fuse.ENOENT
+			}
+			Logger.Printf("fs.searchResultDir: %s: %v", describeJSONSuffix, err)
+			return nil, fuse.EIO
+		}
+		return staticFileNode(string(contents)), nil
+	}
+	if base := strings.TrimSuffix(name, collectionsSuffix); base != name && base != "" && n.fs.CollectionBackrefs {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		pn, ok := n.permanode[base]
+		n.mu.Unlock()
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		contents, err := n.collectionBackrefsContents(ctx, pn)
+		if err != nil {
+			Logger.Printf("fs.searchResultDir: %s: %v", collectionsSuffix, err)
+			return nil, fuse.EIO
+		}
+		return staticFileNode(string(contents)), nil
+	}
+	if base, ok := historyBase(name); ok && n.fs.ExposeHistory {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		pn, ok := n.permanode[base]
+		n.mu.Unlock()
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		return &claimHistoryDir{fs: n.fs, permanode: pn}, nil
+	}
+	if base, ok := webURLBase(name); ok && n.fs.WebUIBaseURL != "" {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		pn, ok := n.permanode[base]
+		n.mu.Unlock()
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		return staticFileNode(webURLContents(n.fs.WebUIBaseURL, pn)), nil
+	}
+	if base, ok := progressBase(name); ok && n.fs.ExposeReadProgress {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		_, ok := n.permanode[base]
+		n.mu.Unlock()
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		return &progressFile{dir: n, name: base}, nil
+	}
+	if attr, ok := attrDirNames[name]; ok {
+		return &attrValueDir{parent: n, attr: attr}, nil
+	}
+	if facet, ok := facetOnlyDirNames[name]; ok {
+		return &facetDir{parent: n, facet: facet}, nil
+	}
+	if name == byDateDirName {
+		return &byDateDir{parent: n}, nil
+	}
+	if name == byLetterDirName {
+		if !n.hasByLetter() {
+			return nil, fuse.ENOENT
+		}
+		return &byLetterDir{parent: n}, nil
+	}
+	if name == bySizeDirName {
+		if !n.hasBySize() {
+			return nil, fuse.ENOENT
+		}
+		return &bySizeDir{parent: n}, nil
+	}
+	if name == byPeriodDirName {
+		start, end, ok := byPeriodWindow(n.searchExp)
+		if !ok {
+			return nil, fuse.ENOENT
+		}
+		return &byPeriodDir{parent: n, start: start, end: end}, nil
+	}
+	if name == truncatedMarkerName {
+		if !n.hasTruncatedMarker() {
+			return nil, fuse.ENOENT
+		}
+		return staticFileNode("This listing was truncated; see CamliFileSystem.MaxResults.\n"), nil
+	}
+	if name == emptyMarkerName {
+		if !n.hasEmptyMarker() {
+			return nil, fuse.ENOENT
+		}
+		return staticFileNode("This search matched no results.\n"), nil
+	}
+	if name == partialMarkerName {
+		if !n.hasPartialMarker() {
+			return nil, fuse.ENOENT
+		}
+		return staticFileNode("This listing was cut short; see CamliFileSystem.QuerySoftBudget.\n"), nil
+	}
+	if name == staleMarkerName {
+		if !n.hasStaleMarker() {
+			return nil, fuse.ENOENT
+		}
+		n.mu.Lock()
+		contents := n.lastFatalError
+		n.mu.Unlock()
+		return staticFileNode(contents), nil
+	}
+	if name == completenessStatusFileName {
+		if !n.fs.CompletenessStatusFile {
+			return nil, fuse.ENOENT
+		}
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		return staticFileNode(n.completenessStatusContents()), nil
+	}
+	if name == queryFileName {
+		n.mu.Lock()
+		_, isRealName := n.ents[sanitizeFilename(n.fs, normalizeFilename(n.fs, trimTrailingFilenameWhitespace(n.fs, name)))]
+		contents := n.queryFileContents()
+		n.mu.Unlock()
+		if !isRealName {
+			return staticFileNode(contents), nil
+		}
+		// A real result happens to be named queryFileName; fall
+		// through to the ordinary lookup path below instead of
+		// shadowing it the way the sortDirPrefix and MIME-class-dir
+		// pseudo-names above already do for the same reason.
+	}
+	if name == resultsJSONName {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents, err := n.resultsJSONContents()
+		n.mu.Unlock()
+		if err != nil {
+			Logger.Printf("fs.searchResultDir: %s: %v", resultsJSONName, err)
+			return nil, fuse.EIO
+		}
+		return staticFileNode(string(contents)), nil
+	}
+	if name == exportJSONLName {
+		return exportJSONLFile{dir: n}, nil
+	}
+	if name == dimensionsFileName {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents := n.dimensionsFileContents()
+		n.mu.Unlock()
+		return staticFileNode(contents), nil
+	}
+	if name == totalSizeFileName {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents := n.totalSizeFileContents()
+		n.mu.Unlock()
+		return staticFileNode(contents), nil
+	}
+	if name == locationsFileName {
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents := n.locationsFileContents()
+		n.mu.Unlock()
+		return staticFileNode(contents), nil
+	}
+	if name == errorsLogName {
+		if n.fs.DisableErrorsLog {
+			return nil, fuse.ENOENT
+		}
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents := n.errorsLogContents()
+		n.mu.Unlock()
+		return staticFileNode(contents), nil
+	}
+	if name == errorFileName {
+		// ensureSeeded's own error is deliberately ignored here: a
+		// fatal doReaddir failure is exactly what n.lastFatalError
+		// exists to explain, so failing this Lookup the same way
+		// would defeat the point of having errorFileName at all.
+		n.ensureSeeded(ctx)
+		n.mu.Lock()
+		contents := n.errorFileContents()
+		n.mu.Unlock()
+		return staticFileNode(contents), nil
+	}
+	if name == explainFileName {
+		if n.fs.DisableExplainFile {
+			return nil, fuse.ENOENT
+		}
+		n.mu.Lock()
+		contents, err := n.explainContents()
+		n.mu.Unlock()
+		if err != nil {
+			Logger.Printf("fs.searchResultDir: %s: %v", explainFileName, err)
+			return nil, fuse.EIO
+		}
+		return staticFileNode(string(contents)), nil
+	}
+	if name == facetsFileName {
+		if !n.fs.EnableFacetsFile {
+			return nil, fuse.ENOENT
+		}
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents, err := n.facetsFileContents()
+		n.mu.Unlock()
+		if err != nil {
+			Logger.Printf("fs.searchResultDir: %s: %v", facetsFileName, err)
+			return nil, fuse.EIO
+		}
+		return staticFileNode(string(contents)), nil
+	}
+	if name == timelineFileName {
+		if !n.fs.EnableTimelineFile {
+			return nil, fuse.ENOENT
+		}
+		if err := n.ensureSeeded(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents, err := n.timelineFileContents()
+		n.mu.Unlock()
+		if err != nil {
+			Logger.Printf("fs.searchResultDir: %s: %v", timelineFileName, err)
+			return nil, fuse.EIO
+		}
+		return staticFileNode(string(contents)), nil
+	}
+	if name == searchStatsFileName {
+		if !n.fs.EnableSearchStatsFile {
+			return nil, fuse.ENOENT
+		}
+		n.mu.Lock()
+		contents := n.searchStatsFileContents()
+		n.mu.Unlock()
+		return staticFileNode(string(contents)), nil
+	}
+	if name == countFileName {
+		total, known, err := n.fetchCount(ctx)
+		if err != nil {
+			return nil, queryErrnoLogf(countFileName, err)
+		}
+		return staticFileNode(string(countFileContents(total, known))), nil
+	}
+	if name == refreshFileName {
+		return refreshControlFile{dir: n}, nil
+	}
+	if name == limitFileName {
+		return limitControlFile{dir: n}, nil
+	}
+	if name == camlifsFileName {
+		return camlifsFile{dir: n}, nil
+	}
+	if name == exportToFileName {
+		return exportToFile{dir: n}, nil
+	}
+	if name == reindexHintFileName {
+		if !n.fs.AllowReindexHint {
+			return nil, fuse.ENOENT
+		}
+		return reindexHintFile{dir: n}, nil
+	}
+	if name == dupesDirName {
+		if !n.hasDupes() {
+			return nil, fuse.ENOENT
+		}
+		return &searchDupesDir{parent: n}, nil
+	}
+	if name == similarDirName {
+		if !n.hasSimilar() {
+			return nil, fuse.ENOENT
+		}
+		return &searchSimilarDir{parent: n}, nil
+	}
+	if name == dropDirName {
+		if !n.hasDrop() {
+			return nil, fuse.ENOENT
+		}
+		return &dropDir{parent: n}, nil
+	}
+	if name == errorsDirName {
+		if !n.hasBadContent() {
+			return nil, fuse.ENOENT
+		}
+		return &searchErrorsDir{parent: n}, nil
+	}
+	if name == byContentDirName {
+		if !n.hasByContent() {
+			return nil, fuse.ENOENT
+		}
+		return &searchByContentDir{parent: n}, nil
+	}
+	if name == thumbsDirName {
+		if !n.hasThumbs() {
+			return nil, fuse.ENOENT
+		}
+		return &searchThumbsDir{parent: n}, nil
+	}
+	if name == byTagTreeDirName {
+		if !n.hasTagTree() {
+			return nil, fuse.ENOENT
+		}
+		return &byTagTreeDir{parent: n}, nil
+	}
+	if name == byBatchTreeDirName {
+		if !n.hasBatchTree() {
+			return nil, fuse.ENOENT
+		}
+		return &byBatchTreeDir{parent: n}, nil
+	}
+	if node, handled, err := n.lookupGroupBucket(ctx, name); handled {
+		return node, err
+	}
+
+	// Past this point name is a candidate entry name rather than one
+	// of the pseudo-files matched above, so trim, normalize, and
+	// sanitize it to the same form doReaddir stores in n.ents (see
+	// trimTrailingFilenameWhitespace, normalizeFilename, and
+	// sanitizeFilename) before comparing against it.
+	name = sanitizeFilename(n.fs, normalizeFilename(n.fs, trimTrailingFilenameWhitespace(n.fs, name)))
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if missed, ok := n.negLookup[name]; ok && time.Since(missed) < n.effectiveNegLookupTTL() {
+		debugf("fs.searchResultDir: Lookup(%q) = ENOENT (negative cache)", name)
+		return nil, fuse.ENOENT
+	}
+
+	debugf("fs.searchResultDir: Lookup(%q)", name)
+	cold := n.ents == nil
+	stale := !cold && !n.haveCachedListing(n.fs.effectiveLookupFreshness(), 0)
+	if cold || stale {
+		// Not seeded yet, or seeded but older than
+		// CamliFileSystem.LookupFreshness allows: rather than pay for
+		// a full ReadDirAll just to answer a single stat (as a media
+		// player opening mount/search/<expr>/foo.jpg directly would),
+		// try a query narrowed to name first when cold.
+		// lookupTargetedOnce dedupes this against any other
+		// concurrent Lookup of the same name, so hammering the same
+		// cold path from several callers only fires the narrowed
+		// query once. A merely stale (not cold) dir skips straight to
+		// the full refresh instead, since lookupTargetedOnce's point
+		// is avoiding an unnecessary first ReadDirAll, not this case.
+		n.mu.Unlock() // release, since both paths below issue queries
+		if ctx.Err() != nil {
+			n.mu.Lock()
+			return nil, fuse.EINTR
+		}
+		if cold {
+			if nod, ok := n.lookupTargetedOnce(ctx, name); ok {
+				n.mu.Lock()
+				return nod, nil
+			}
+		}
+		if _, err := n.ReadDirAll(ctx); err != nil {
+			n.mu.Lock()
+			return nil, err
+		}
+		n.mu.Lock()
+	}
+	requested := name
+	if _, okEnt := n.ents[name]; !okEnt {
+		_, okSet := n.sets[name]
+		_, okSymlink := n.symlinks[name]
+		okContentless := n.contentless[name]
+		okPlaceholder := n.placeholders[name]
+		_, okCollisionSubdir := n.collisionSubdirs[name]
+		_, okExtractedText := n.extractedText[name]
+		if !okSet && !okSymlink && !okContentless && !okPlaceholder && !okCollisionSubdir && !okExtractedText && n.fs.SearchCaseInsensitiveLookup {
+			if resolved, ok := n.lookupCaseInsensitive(name); ok {
+				name = resolved
+			}
+		}
+		if !okSet && !okSymlink && !okContentless && !okPlaceholder && !okCollisionSubdir && !okExtractedText {
+			if nod, ok := n.resolveLazyEntry(ctx, name); ok {
+				return nod, nil
+			}
+		}
+	}
+
+	if ce, ok := n.collisionSubdirs[name]; ok {
+		return &collisionSubdir{fs: n.fs, at: n.at, name: ce.name, entry: ce.entry}, nil
+	}
+
+	if e, ok := n.camliPaths[name]; ok {
+		return &camliPathDir{
+			fs:        n.fs,
+			at:        n.at,
+			permanode: e.Permanode,
+			pnodeMeta: e.PNodeMeta,
+			ancestors: map[blob.Ref]bool{e.Permanode: true},
+		}, nil
+	}
+
+	if set, ok := n.sets[name]; ok {
+		return &searchMemberDir{
+			fs:               n.fs,
+			at:               n.at,
+			permanode:        set.Permanode,
+			pnodeMeta:        set.PNodeMeta,
+			members:          set.Members,
+			membersTruncated: set.MembersTruncated,
+			ancestors:        map[blob.Ref]bool{set.Permanode: true},
+			parentMeta:       set.Meta,
+		}, nil
+	}
+
+	if target, ok := n.symlinks[name]; ok {
+		return &searchResultSymlink{
+			node:      node{fs: n.fs, pnodeModTime: n.modTime[name]},
+			permanode: n.permanode[name],
+			target:    target,
+		}, nil
+	}
+
+	if text, ok := n.extractedText[name]; ok {
+		return staticFileNode(text), nil
+	}
+
+	if n.contentless[name] || n.placeholders[name] {
+		return &searchResultFile{
+			node: node{
+				fs:           n.fs,
+				pnodeModTime: n.modTime[name],
+			},
+			parent:       n,
+			name:         name,
+			originalName: n.originalNames[name],
+			readOnly:     true,
+			permanode:    n.permanode[name],
+			pnodeMeta:    n.pnodeMeta[name],
+			haveSize:     true,
+		}, nil
+	}
+
+	if n.fs.FilenameNesting {
+		if dir, ok := n.nestedDirFor(name); ok {
+			return dir, nil
+		}
+	}
+
+	db := n.ents[name]
+	debugf("fs.searchResultDir: Lookup(%q) = %v", name, db)
+	if db == nil {
+		if child, ok := n.drillDown(name); ok {
+			return child, nil
+		}
+		if nod, ok := n.resolveByRawBlobRef(ctx, name); ok {
+			return nod, nil
+		}
+		if n.lastSeedErr != nil {
+			// ents/lastNames are only ever the last *successful*
+			// seed's results (see lastSeedErr's doc comment), so a
+			// miss right after a failed refresh can't be trusted as a
+			// genuine absence: report the server error that's the
+			// actual reason name wasn't found, instead of masking it
+			// as ENOENT.
+			debugf("fs.searchResultDir: Lookup(%q): last seed for %q failed, reporting that instead of ENOENT: %v", name, n.searchExp, n.lastSeedErr)
+			return nil, n.lastSeedErr
+		}
+		if n.negLookup == nil {
+			n.negLookup = make(map[string]time.Time)
+		}
+		n.negLookup[requested] = time.Now()
+		return nil, fuse.ENOENT
+	}
+
+	if db.Dir != nil {
+		// A directory's own static entries, not the permanode's
+		// attrs, are what a caller wants to browse into; see
+		// dirBlobDir in pkg/fs/searchdirblob.go.
+		return &dirBlobDir{
+			fs:       n.fs,
+			ref:      db.BlobRef,
+			readOnly: n.at != nil || n.deleted[name],
+		}, nil
+	}
+
+	if db.StaticSet != nil {
+		// A permanode whose content is a static set rather than a
+		// single file; browse its members directly, the same way
+		// db.Dir != nil above browses a directory's own entries. See
+		// staticSetDir in pkg/fs/searchstaticset.go.
+		return &staticSetDir{
+			fs:       n.fs,
+			ref:      db.BlobRef,
+			readOnly: n.at != nil || n.deleted[name],
+		}, nil
+	}
+
+	n.recordAccessLocked(name, n.modTime[name])
+	nod := &searchResultFile{
+		node: node{
+			fs:           n.fs,
+			blobref:      db.BlobRef,
+			pnodeModTime: n.modTime[name],
+		},
+		parent:       n,
+		name:         name,
+		originalName: n.originalNames[name],
+		readOnly:     n.at != nil || n.deleted[name],
+		deleted:      n.deleted[name],
+		permanode:    n.permanode[name],
+		pnodeMeta:    n.pnodeMeta[name],
+		imageMeta:    n.imageMeta[name],
+		lastAccess:   n.atime[name],
+	}
+	if db.File != nil {
+		nod.mimeType = db.File.MIMEType
+		nod.size = uint64(db.File.Size)
+		nod.haveSize = true
+	}
+	meta, ok := n.schemaMeta[nod.blobref]
+	if !ok {
+		metaCtx := ctx
+		if timeout := n.fs.effectiveQueryTimeout(); timeout > 0 {
+			var cancel context.CancelFunc
+			metaCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		// Release n.mu for the fetch itself (a network round trip),
+		// the same way the cold/stale branch above releases it for
+		// its own queries, rather than blocking every other Lookup
+		// and ReadDirAll on this directory for as long as it takes.
+		n.mu.Unlock()
+		var err error
+		meta, err = nod.fs.fetchSchemaMeta(metaCtx, nod.blobref)
+		n.mu.Lock()
+		if !n.entryStillPresent(name, nod.blobref) {
+			// A concurrent refresh (doReaddir) cleared or replaced
+			// this entry while the fetch above ran with n.mu
+			// released; don't hand back a node for an entry that's no
+			// longer there.
+			debugf("fs:searchResultDir: Lookup(%q): %v vanished during a concurrent refresh while fetching its schema meta", name, nod.blobref)
+			return nil, fuse.ENOENT
+		}
+		if err != nil {
+			metricsFor(n.fs).IncSchemaMetaFailure()
+			if timeout := n.fs.effectiveQueryTimeout(); timeout > 0 && metaCtx.Err() == context.DeadlineExceeded {
+				Logger.Printf("fs:searchResultDir: Lookup(%q): fetching schema meta for %v timed out after %v", name, nod.blobref, timeout)
+				return nil, n.fs.effectiveQueryTimeoutErrno()
+			}
+			if !n.fs.LazySchemaMeta {
+				errno := schemaMetaFetchErrno(err)
+				if errno == fuse.ENOENT {
+					Logger.Printf("fs:searchResultDir: Lookup(%q): schema blob %v not found: %v", name, nod.blobref, err)
+				} else {
+					Logger.Printf("fs:searchResultDir: Lookup(%q): fetching schema meta for %v: %v", name, nod.blobref, err)
+				}
+				return nil, errno
+			}
+			Logger.Printf("fs:searchResultDir: Couldn't find meta: %v", err)
+			meta = nil
+		} else {
+			if n.schemaMeta == nil {
+				n.schemaMeta = make(map[blob.Ref]*schema.Blob)
+			}
+			n.schemaMeta[nod.blobref] = meta
+		}
+	}
+	if meta != nil {
+		debugf("fs:searchResultDir: Blob type: %s", meta.Type())
+		nod.schemaMeta = meta
+		nod.schemaMetaAt = time.Now()
+	}
+
+	return nod, nil
+}
+
+// entryStillPresent reports whether name still resolves to blobref in
+// n.ents, i.e. a concurrent refresh (doReaddir) hasn't cleared or
+// replaced it since it was last read, such as right before Lookup
+// released n.mu to fetch that entry's schema meta. It must be called
+// with n.mu held.
+func (n *searchResultDir) entryStillPresent(name string, blobref blob.Ref) bool {
+	db, ok := n.ents[name]
+	return ok && db.BlobRef == blobref
+}
+
+// lookupCaseInsensitive scans n's currently seeded names (n.ents and
+// n.sets) for one matching name case-insensitively, for Lookup's
+// fallback when an exact match misses and
+// fs.SearchCaseInsensitiveLookup is set. It must be called with n.mu
+// held and n already seeded.
+//
+// Among matches it prefers one whose case matches name exactly (in
+// case the exact lookup above missed only because the name doesn't
+// appear as its own map key for some other reason); absent that, it
+// takes the lexicographically first and logs the ambiguity, since
+// which of several same-cased names the caller meant is a genuine
+// guess.
+func (n *searchResultDir) lookupCaseInsensitive(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	var matches []string
+	for _, candidate := range n.lastNames {
+		if candidate == name {
+			return candidate, true
+		}
+		if strings.ToLower(candidate) == lower {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	sort.Strings(matches)
+	if len(matches) > 1 {
+		Logger.Printf("fs.searchResultDir: Lookup(%q): %d case-insensitive matches %v; using %q", name, len(matches), matches, matches[0])
+	}
+	return matches[0], true
+}
+
+// lookupTargeted tries to resolve name without seeding n's full result
+// set, by narrowing n's search expression to name and running that
+// query directly. It must be called with n.mu unheld, since it issues
+// a query; a transient failure (see isTransientQueryErr) is retried
+// with the same queryRetryMax/queryRetryDelay backoff doReaddir's own
+// page queries use, bounded by ctx. ok is false once that retry budget
+// is exhausted, on a non-transient error, or if the narrowed query
+// doesn't turn up an exact match for name, in which case the caller
+// should fall back to a full ReadDirAll.
+func (n *searchResultDir) lookupTargeted(ctx context.Context, name string) (fs.Node, bool) {
+	expr := n.effectiveSearchExpr() + " " + strconv.Quote(name)
+	var ents []dir.Entry
+	var err error
+	for attempt := 0; ; attempt++ {
+		ents, err = dir.Resolve(ctx, n.fs.client, expr, n.at)
+		if err == nil || attempt >= queryRetryMax-1 || !isTransientQueryErr(err) {
+			break
+		}
+		delay := queryRetryDelay(attempt)
+		debugf("fs.searchResultDir: Lookup(%q): targeted query attempt %d failed transiently, retrying in %v: %v", name, attempt+1, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			Logger.Printf("fs.searchResultDir: Lookup(%q): targeted query: %v", name, ctx.Err())
+			return nil, false
+		}
+	}
+	if err != nil {
+		Logger.Printf("fs.searchResultDir: Lookup(%q): targeted query: %v", name, err)
+		return nil, false
+	}
+	for _, e := range ents {
+		if e.Name != name {
+			continue
+		}
+		if n.timeRange != nil && !n.timeRange.contains(e.ModTime) {
+			continue
+		}
+		return entryNode(n.fs, e, n.at), true
+	}
+	return nil, false
+}
+
+// entryNode builds the fs.Node a dir.Entry resolves to: a
+// *searchMemberDir for a set, a *dirBlobDir for a camliContent that
+// resolves to a directory schema blob (e.Blob.Dir != nil, the same
+// check searchResultDir.Lookup's own db.Dir != nil makes), or a
+// *searchResultFile for a file. at is threaded through for the same
+// read-only and point-in-time semantics a snapshot ("at") directory
+// gives its own children.
+func entryNode(fsys *CamliFileSystem, e dir.Entry, at *types.Time3339) fs.Node {
+	if symlinkToOriginal(fsys, e) {
+		return &byBlobRefSymlink{
+			node:      node{fs: fsys, pnodeModTime: e.ModTime},
+			permanode: e.Permanode,
+		}
+	}
+	if e.IsSet {
+		return &searchMemberDir{
+			fs:               fsys,
+			at:               at,
+			permanode:        e.Permanode,
+			pnodeMeta:        e.PNodeMeta,
+			members:          e.Members,
+			membersTruncated: e.MembersTruncated,
+			ancestors:        map[blob.Ref]bool{e.Permanode: true},
+		}
+	}
+	if e.IsSymlink {
+		return &searchResultSymlink{
+			node:      node{fs: fsys, pnodeModTime: e.ModTime},
+			permanode: e.Permanode,
+			target:    e.SymlinkTarget,
+		}
+	}
+	if e.IsSpecial {
+		switch e.SpecialType {
+		case "fifo", "socket":
+			return &specialFileNode{
+				node:      node{fs: fsys, pnodeModTime: e.ModTime},
+				permanode: e.Permanode,
+				kind:      e.SpecialType,
+			}
+		default:
+			// A chardev or blockdev never gets a real FUSE node of its
+			// own; see SpecialContentRepresent's own doc comment for
+			// why. It still shouldn't vanish, so it falls back to the
+			// same zero-byte stub as IsPlaceholder.
+			return &searchResultFile{
+				node:      node{fs: fsys, pnodeModTime: e.ModTime},
+				readOnly:  true,
+				permanode: e.Permanode,
+				pnodeMeta: e.PNodeMeta,
+				haveSize:  true,
+			}
+		}
+	}
+	if e.Blob != nil && e.Blob.Dir != nil {
+		return &dirBlobDir{
+			fs:       fsys,
+			ref:      e.Blob.BlobRef,
+			readOnly: at != nil,
+		}
+	}
+	if e.Blob != nil && e.Blob.StaticSet != nil {
+		return &staticSetDir{
+			fs:       fsys,
+			ref:      e.Blob.BlobRef,
+			readOnly: at != nil,
+		}
+	}
+	if e.IsContentless || e.IsPlaceholder {
+		return &searchResultFile{
+			node:      node{fs: fsys, pnodeModTime: e.ModTime},
+			readOnly:  true,
+			permanode: e.Permanode,
+			pnodeMeta: e.PNodeMeta,
+			haveSize:  true,
+		}
+	}
+	nod := &searchResultFile{
+		node: node{
+			fs:           fsys,
+			blobref:      e.Blob.BlobRef,
+			pnodeModTime: e.ModTime,
+		},
+		readOnly:  at != nil,
+		permanode: e.Permanode,
+		pnodeMeta: e.PNodeMeta,
+		imageMeta: e.Image,
+	}
+	if e.Blob.File != nil {
+		nod.mimeType = e.Blob.File.MIMEType
+		nod.size = uint64(e.Blob.File.Size)
+		nod.haveSize = true
+	}
+	return nod
+}
+
+// entryDirentKind reports the fuse.DirentType entryNode(fsys, e, at)
+// would resolve to, for a caller building a []fuse.Dirent rather than
+// calling entryNode itself: fuse.DT_Link when symlinkToOriginal
+// redirects e to a byBlobRefSymlink, fuse.DT_Dir for a set, a
+// directory-typed camliContent, or a static-set-typed camliContent,
+// fuse.DT_Link for a symlink, fuse.DT_File for everything else (a
+// contentless, placeholder, or plain entry), mirroring entryNode's
+// own symlinkToOriginal/IsSet/Blob.Dir/Blob.StaticSet/IsSymlink checks.
+func entryDirentKind(fsys *CamliFileSystem, e dir.Entry) fuse.DirentType {
+	switch {
+	case symlinkToOriginal(fsys, e):
+		return fuse.DT_Link
+	case e.IsSet:
+		return fuse.DT_Dir
+	case e.IsSymlink:
+		return fuse.DT_Link
+	case e.Blob != nil && e.Blob.Dir != nil:
+		return fuse.DT_Dir
+	case e.Blob != nil && e.Blob.StaticSet != nil:
+		return fuse.DT_Dir
+	default:
+		return fuse.DT_File
+	}
+}
+
+// invalidateCache forces the next ReadDirAll or Lookup to re-run the
+// search, so that a mutation just issued against one of this
+// directory's permanodes is reflected immediately rather than for up
+// to fs.SearchCacheTTL. It also clears negLookup, so a name a probe
+// found missing before the mutation isn't still masked by that stale
+// miss once the next Lookup runs; otherwise a newly created permanode
+// named, say, "Thumbs.db" could stay invisible for up to negLookupTTL
+// even right after an explicit refresh.
+func (n *searchResultDir) invalidateCache() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lastReaddir = time.Time{}
+	n.negLookup = nil
+}
+
+// permanodeFor returns the permanode backing the named entry, forcing
+// a readdir first if this directory hasn't been listed yet.
+func (n *searchResultDir) permanodeFor(ctx context.Context, name string) (blob.Ref, error) {
+	n.mu.Lock()
+	if n.ents == nil {
+		n.mu.Unlock()
+		if _, err := n.ReadDirAll(ctx); err != nil {
+			return blob.Ref{}, err
+		}
+		n.mu.Lock()
+	}
+	defer n.mu.Unlock()
+	pn, ok := n.permanode[name]
+	if !ok {
+		return blob.Ref{}, fuse.ENOENT
+	}
+	return pn, nil
+}
+
+// Remove implements fs.NodeRemover: "rm results/foo.jpg" deletes the
+// permanode the name resolves to (not the underlying file blob, which
+// may still be referenced elsewhere). It's gated behind
+// CamliFileSystem.AllowDelete, off by default, since unlike Rename and
+// Symlink this can make data unreachable.
+func (n *searchResultDir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	if err := n.fs.checkWritable(); err != nil {
+		return err
+	}
+	if n.at != nil {
+		return n.fs.effectiveUnsupportedErrno(UnsupportedImmutable)
+	}
+	if !n.fs.AllowDelete {
+		Logger.Printf("fs.searchResultDir: Remove(%q): rejected, CamliFileSystem.AllowDelete is false", req.Name)
+		return n.fs.effectiveUnsupportedErrno(UnsupportedFeatureOff)
+	}
+	pn, err := n.permanodeFor(ctx, req.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := n.fs.client.UploadAndSignBlob(ctx, schema.NewDeleteClaim(pn)); err != nil {
+		Logger.Printf("fs.searchResultDir: Remove(%q): %v", req.Name, err)
+		return fuse.EIO
+	}
+	auditFor(n.fs).Audit(AuditEvent{Time: time.Now(), Type: AuditDeleteClaimIssued, BlobRef: pn})
+	n.forgetName(req.Name)
+	n.invalidateCache()
+	return nil
+}
+
+// forgetName removes name from n's cached result set immediately,
+// so the entry it just resolved to (a deleted permanode, or a rename
+// target that's moved elsewhere) is gone from the very next
+// ReadDirAll or Lookup rather than lingering until SearchCacheTTL
+// expires, even though invalidateCache also forces a full re-query
+// eventually.
+func (n *searchResultDir) forgetName(name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.ents, name)
+	delete(n.permanode, name)
+	delete(n.pnodeMeta, name)
+	delete(n.imageMeta, name)
+	delete(n.sets, name)
+	delete(n.symlinks, name)
+	delete(n.modTime, name)
+	for i, cur := range n.lastNames {
+		if cur == name {
+			n.lastNames = append(n.lastNames[:i], n.lastNames[i+1:]...)
+			break
+		}
+	}
+}
+
+// blobNotFound reports whether err looks like the fetcher coming back
+// empty-handed for the blob itself, as opposed to some other fetch
+// failure (a network error, a malformed schema blob) that Open should
+// still just surface rather than treat as the permanode having been
+// deleted. Like queryErrno and sortUnsupported, this is necessarily a
+// heuristic over the error text: schema.NewFileReader's error crosses
+// the blobserver's Fetch boundary with no structured type to switch
+// on.
+func blobNotFound(err error) bool {
+	if os.IsNotExist(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "not exist")
+}
+
+// schemaMetaFetchErrno classifies a fetchSchemaMeta failure for
+// Lookup, once CamliFileSystem.LazySchemaMeta has already ruled out
+// falling back to the old, lenient behavior: fuse.ENOENT if err looks
+// like the blob genuinely doesn't exist (see blobNotFound), fuse.EIO
+// for anything else (a network error, a malformed schema blob).
+func schemaMetaFetchErrno(err error) error {
+	if blobNotFound(err) {
+		return fuse.ENOENT
+	}
+	return fuse.EIO
+}
+
+// pruneIfNotFound forgets n's entry from its parent searchResultDir
+// (see forgetName) and forces the parent's next ReadDirAll or Lookup
+// to re-query, when err indicates the blob behind n has gone missing.
+// This is what keeps a permanode deleted server-side mid-session from
+// lingering in a listing until SearchCacheTTL next expires: the first
+// "cat" to trip over it self-heals the listing immediately, rather
+// than every later open failing the same confusing way until the next
+// scheduled refresh. It's a no-op for a searchResultFile with no
+// parent (e.g. one built outside a searchResultDir.Lookup) or an err
+// that doesn't look like a not-found.
+func (n *searchResultFile) pruneIfNotFound(err error) {
+	if n.parent == nil || !blobNotFound(err) {
+		return
+	}
+	Logger.Printf("fs.searchResultFile: Open(%q): %v not found; pruning from %q", n.name, n.blobref, n.parent.searchExp)
+	n.parent.forgetName(n.name)
+	n.parent.invalidateCache()
+}
+
+// Rename implements fs.NodeRenamer. Three destinations are honored:
+// this same directory ("mv foo.jpg bar.jpg" sets the permanode's
+// display-name attribute instead of moving anything, see
+// renameInPlace), one of this directory's own "by-tag"/"by-title"
+// pseudo-directories ("mv results/foo.jpg by-tag/vacation" issues an
+// add-attribute claim on foo.jpg's permanode), or another search
+// result directory whose expression is tag-based ("mv
+// search/tag:vacation/foo.jpg search/tag:archive/foo.jpg" swaps the
+// tag instead, see renameBetweenSearchDirs, which returns fuse.EXDEV
+// for anything it can't handle that way so the FUSE client falls back
+// to a regular copy+delete). Any other destination type isn't a
+// meaningful operation on a search result and is rejected outright.
+func (n *searchResultDir) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	if err := n.fs.checkWritable(); err != nil {
+		return err
+	}
+	if n.at != nil {
+		return n.fs.effectiveUnsupportedErrno(UnsupportedImmutable)
+	}
+	switch dest := newDir.(type) {
+	case *attrValueDir:
+		pn, err := n.permanodeFor(ctx, req.OldName)
+		if err != nil {
+			return err
+		}
+		claim := schema.NewAddAttributeClaim(pn, dest.attr, req.NewName)
+		if _, err := n.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+			Logger.Printf("fs.searchResultDir: Rename(%q -> %s/%s): %v", req.OldName, dest.attr, req.NewName, err)
+			return fuse.EIO
+		}
+		n.invalidateCache()
+		return nil
+	case *searchResultDir:
+		if dest == n {
+			return n.renameInPlace(ctx, req)
+		}
+		return n.renameBetweenSearchDirs(ctx, req, dest)
+	default:
+		return fuse.EIO
+	}
+}
+
+// Symlink implements fs.NodeSymlinker: "ln -s /some/file results/name"
+// ingests the target path as a file blob and creates a new permanode
+// whose camliContent points at it, named req.NewName.
+func (n *searchResultDir) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
+	if err := n.fs.checkWritable(); err != nil {
+		return nil, err
+	}
+	if n.at != nil {
+		return nil, n.fs.effectiveUnsupportedErrno(UnsupportedImmutable)
+	}
+	f, err := os.Open(req.Target)
+	if err != nil {
+		Logger.Printf("fs.searchResultDir: Symlink: opening %q: %v", req.Target, err)
+		return nil, fuse.EIO
+	}
+	defer f.Close()
+
+	fileRef, err := schema.WriteFileFromReader(ctx, n.fs.client, filepath.Base(req.Target), f)
+	if err != nil {
+		Logger.Printf("fs.searchResultDir: Symlink: uploading %q: %v", req.Target, err)
+		return nil, fuse.EIO
+	}
+	pn, err := n.fs.client.UploadNewPermanode(ctx)
+	if err != nil {
+		Logger.Printf("fs.searchResultDir: Symlink: creating permanode: %v", err)
+		return nil, fuse.EIO
+	}
+	claim := schema.NewSetAttributeClaim(pn.BlobRef, "camliContent", fileRef.String())
+	if _, err := n.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+		Logger.Printf("fs.searchResultDir: Symlink: setting camliContent: %v", err)
+		return nil, fuse.EIO
+	}
+	n.invalidateCache()
+
+	return &searchResultFile{
+		node: node{
+			fs:      n.fs,
+			blobref: fileRef,
+		},
+	}, nil
 }
@@ -0,0 +1,192 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+)
+
+// Subscriber is the subset of *client.Client that streams index
+// change notifications, for servers that support it. WatchChanges's
+// channel delivers the blobref of every permanode the index just
+// reindexed and is closed if the subscription ends (the server
+// doesn't support it, the connection dropped, ctx was canceled); a
+// searchWatcher that gets nothing from it simply leaves every
+// registered searchResultDir on its existing TTL-based polling.
+type Subscriber interface {
+	WatchChanges(ctx context.Context) (<-chan blob.Ref, error)
+}
+
+// searchWatcher invalidates every searchResultDir's cache sharing one
+// CamliFileSystem as soon as the index reports a change, rather than
+// each dir separately polling every SearchCacheTTL. It's conservative
+// about relevance: correlating an arbitrary changed blobref against
+// an arbitrary dir's search expression would cost about as much as
+// just re-running the dir's own query, so any change invalidates
+// every dir currently registered rather than trying to filter first.
+type searchWatcher struct {
+	fs *CamliFileSystem
+
+	mu   sync.Mutex
+	dirs map[*searchResultDir]bool
+}
+
+var (
+	watchersMu sync.Mutex
+	watchers   = map[*CamliFileSystem]*searchWatcher{}
+)
+
+// watcherFor returns fsys's shared searchWatcher, starting its
+// subscription (or discovering it falls back to polling) the first
+// time any searchResultDir under fsys asks for it.
+func watcherFor(fsys *CamliFileSystem) *searchWatcher {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+	if w, ok := watchers[fsys]; ok {
+		return w
+	}
+	w := &searchWatcher{fs: fsys, dirs: make(map[*searchResultDir]bool)}
+	watchers[fsys] = w
+	w.start()
+	return w
+}
+
+// start subscribes to fsys's index change stream, if its client
+// supports Subscriber, and runs w.run in the background for as long
+// as the subscription stays open. Any failure to subscribe just logs
+// and leaves w with no goroutine, so registered dirs fall back to
+// their existing TTL polling.
+func (w *searchWatcher) start() {
+	capabilitiesFor(w.fs) // populates ServerCapabilities.ChangeNotify for README/logging
+	if w.fs.SmartFolderRefresh {
+		go w.runSmartFolderRefresh()
+	}
+	sub, ok := w.fs.client.(Subscriber)
+	if !ok {
+		return
+	}
+	ch, err := sub.WatchChanges(context.Background())
+	if err != nil {
+		Logger.Printf("fs.search: subscribing to index changes: %v; falling back to TTL polling", err)
+		return
+	}
+	go w.run(ch)
+}
+
+func (w *searchWatcher) run(ch <-chan blob.Ref) {
+	for range ch {
+		w.invalidateAll()
+	}
+	Logger.Printf("fs.search: index change subscription ended; falling back to TTL polling")
+}
+
+// invalidateAll forces every dir currently registered with w to
+// re-run its search on next access, and reports how many that was
+// (for flushCacheFileName's logging; callers that don't care about the
+// count, like run's own per-change invalidation, are free to ignore
+// it). w.registered's snapshot means a dir that registers concurrently
+// with this call may or may not be included, the same ambiguity any
+// "list then act" pattern has; it will simply re-query anyway on its
+// own next access regardless.
+func (w *searchWatcher) invalidateAll() int {
+	dirs := w.registered()
+	for _, d := range dirs {
+		d.invalidateCache()
+	}
+	return len(dirs)
+}
+
+// registered returns a snapshot of every dir currently registered
+// with w.
+func (w *searchWatcher) registered() []*searchResultDir {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dirs := make([]*searchResultDir, 0, len(w.dirs))
+	for d := range w.dirs {
+		dirs = append(dirs, d)
+	}
+	return dirs
+}
+
+func (w *searchWatcher) register(n *searchResultDir) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dirs[n] = true
+}
+
+func (w *searchWatcher) unregister(n *searchResultDir) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.dirs, n)
+}
+
+// Forget implements fs.NodeForgetter: once the kernel drops its
+// reference to n, there's no longer any open file manager or shell to
+// keep live, so n is unregistered from its CamliFileSystem's
+// searchWatcher rather than invalidated forever on every future
+// change, dropped from its searchDirCache rather than left pinned in
+// the LRU as a reference nothing can reach anymore, has any still-running
+// prefetch pass canceled (see startPrefetch), and has its own
+// ents/permanode/... maps released rather than left for whatever still
+// (if anything) holds a reference to n to eventually garbage-collect.
+//
+// Clearing those maps under n.mu is safe against an in-flight
+// doReaddir: doReaddir only ever installs a freshly built set of maps
+// under n.mu itself (see its final critical section), so this either
+// runs before that install (the maps it clears get overwritten moments
+// later, no different than never having cleared them) or after (there's
+// nothing left for it to race with). A ReadDirAll or Lookup actually
+// reaching n after Forget would be a kernel contract violation, not
+// something this needs to defend against further.
+func (n *searchResultDir) Forget() {
+	watcherFor(n.fs).unregister(n)
+	searchDirCacheFor(n.fs).remove(n.searchExp, n)
+
+	n.mu.Lock()
+	if n.prefetchCancel != nil {
+		n.prefetchCancel()
+		n.prefetchCancel = nil
+	}
+	n.ents = nil
+	n.permanode = nil
+	n.pnodeMeta = nil
+	n.imageMeta = nil
+	n.sets = nil
+	n.symlinks = nil
+	n.contentless = nil
+	n.camliPaths = nil
+	n.collisionSubdirs = nil
+	n.dupes = nil
+	n.similar = nil
+	n.originalNames = nil
+	n.badContent = nil
+	n.errorLog = nil
+	n.modTime = nil
+	n.lastNames = nil
+	n.facets = nil
+	n.schemaMeta = nil
+	n.negLookup = nil
+	n.mu.Unlock()
+}
+
+var _ fs.NodeForgetter = (*searchResultDir)(nil)
@@ -0,0 +1,67 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"perkeep.org/pkg/blob"
+)
+
+// TestSearchWatcherRunInvalidatesOnChange checks that a change pushed
+// on a searchWatcher's subscription channel invalidates every
+// registered dir's cache immediately, the way a fake subscription
+// source pushing an add event would, without anything waiting on
+// SearchCacheTTL.
+func TestSearchWatcherRunInvalidatesOnChange(t *testing.T) {
+	w := &searchWatcher{fs: &CamliFileSystem{}, dirs: make(map[*searchResultDir]bool)}
+	n := &searchResultDir{lastReaddir: time.Now()}
+	w.register(n)
+
+	ch := make(chan blob.Ref, 1)
+	ch <- blob.MustParse("sha224-7777777777777777777777777777777777777777777777777777777777777777")
+	close(ch)
+	w.run(ch)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.lastReaddir.IsZero() {
+		t.Errorf("lastReaddir = %v after a change notification; want zero (invalidated)", n.lastReaddir)
+	}
+}
+
+// TestSearchWatcherRegisterUnregister checks that unregistering a dir
+// removes it from the set invalidateAll/run would reach, so a change
+// notification after Forget doesn't touch a dir that's no longer
+// supposed to be listening.
+func TestSearchWatcherRegisterUnregister(t *testing.T) {
+	w := &searchWatcher{fs: &CamliFileSystem{}, dirs: make(map[*searchResultDir]bool)}
+	n := &searchResultDir{lastReaddir: time.Now()}
+	w.register(n)
+	w.unregister(n)
+
+	w.invalidateAll()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.lastReaddir.IsZero() {
+		t.Error("lastReaddir was invalidated after unregister; want it untouched")
+	}
+}
@@ -0,0 +1,109 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// attrValueDir is a writable pseudo-directory under a search result
+// directory, such as "by-tag" or "by-title" (see attrDirNames). Its
+// primary purpose is as a Rename destination, so that "mv
+// results/foo.jpg by-tag/vacation" reads as shell code for "tag
+// foo.jpg as vacation" and turns into an add-attribute claim on
+// foo.jpg's permanode. When attr is also a reserved facet (currently
+// just "tag"), it additionally supports being listed and cd'ed into
+// like facetDir, so "ls by-tag" shows the tags already present.
+type attrValueDir struct {
+	parent *searchResultDir
+	attr   string
+}
+
+var (
+	_ fs.Node               = (*attrValueDir)(nil)
+	_ fs.HandleReadDirAller = (*attrValueDir)(nil)
+	_ fs.NodeStringLookuper = (*attrValueDir)(nil)
+)
+
+func (d *attrValueDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0700
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+// ReadDirAll lists the facet's existing values when attr is facetable
+// ("tag"); otherwise there's nothing to list, since the set of values
+// isn't known until something has been moved in under one.
+func (d *attrValueDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if d.attr != "tag" {
+		return nil, nil
+	}
+	values, err := d.parent.facetCounts(ctx, d.attr)
+	if err != nil {
+		Logger.Printf("fs.attrValueDir: ReadDirAll(%s): %v", d.attr, err)
+		return nil, fuse.EIO
+	}
+	ents := make([]fuse.Dirent, 0, len(values))
+	for v := range values {
+		ents = append(ents, fuse.Dirent{Name: v})
+	}
+	return ents, nil
+}
+
+// Lookup resolves name as an existing facet value when attr is
+// facetable ("tag"), re-running the parent search constrained to it.
+// Otherwise it always fails: an attrValueDir's children only exist
+// transiently, as the destination name of a Rename.
+func (d *attrValueDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if d.attr != "tag" {
+		return nil, fuse.ENOENT
+	}
+	values, err := d.parent.facetCounts(ctx, d.attr)
+	if err != nil {
+		Logger.Printf("fs.attrValueDir: Lookup(%s/%s): %v", d.attr, name, err)
+		return nil, fuse.EIO
+	}
+	if _, ok := values[name]; !ok {
+		return nil, fuse.ENOENT
+	}
+	return &searchResultDir{
+		fs:        d.parent.fs,
+		searchExp: attrConstrainedExpression(d.parent.searchExp, d.attr, name),
+		at:        d.parent.at,
+	}, nil
+}
+
+// attrConstrainedExpression adds "<attr>:<value>" as a predicate to
+// parentExpr, the same plain-text expression language "search/<expr>"
+// directories already accept (e.g. "is:image", "tag:vacation"). It's
+// only used for attrs the expression language actually has a
+// predicate for, currently just "tag"; facets without one (like
+// "year"/"month") need a structured search.Constraint instead, built
+// the way facetTimeRange in facet.go does.
+func attrConstrainedExpression(parentExpr, attr, value string) string {
+	return fmt.Sprintf("(%s) and %s:%s", parentExpr, attr, strconv.Quote(value))
+}
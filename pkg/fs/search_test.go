@@ -0,0 +1,65 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// renderSearchReadme executes searchReadmeTmpl directly against data,
+// the same rendering readme() performs, without needing a real
+// n.fs.client to gather data with.
+func renderSearchReadme(t *testing.T, data searchReadmeData) string {
+	var buf bytes.Buffer
+	if err := searchReadmeTmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("searchReadmeTmpl.Execute(%+v) = %v", data, err)
+	}
+	return buf.String()
+}
+
+// TestSearchReadmeFeatureSections checks that README.txt's optional
+// feature sections appear only when the corresponding feature is
+// actually configured: a plain mount's render has none of them, while
+// one with a MIME filter and saved searches configured has both.
+func TestSearchReadmeFeatureSections(t *testing.T) {
+	plain := renderSearchReadme(t, searchReadmeData{Endpoint: "http://example.com/"})
+	for _, want := range []string{"MIMEAllow", "MIMEDeny", "saved-search"} {
+		if strings.Contains(plain, want) {
+			t.Errorf("plain render unexpectedly mentions %q:\n%s", want, plain)
+		}
+	}
+
+	withFeatures := renderSearchReadme(t, searchReadmeData{
+		Endpoint:           "http://example.com/",
+		SavedSearches:      2,
+		SavedSearchesUsage: savedSearchesUsage(2),
+		MIMEFilterNote:     mimeFilterNote(&CamliFileSystem{MIMEAllow: []string{"image/*"}, MIMEDeny: []string{"image/gif"}}),
+	})
+	if !strings.Contains(withFeatures, "MIMEAllow=[image/*]") {
+		t.Errorf("render with a MIME filter configured is missing its allow list:\n%s", withFeatures)
+	}
+	if !strings.Contains(withFeatures, "MIMEDeny=[image/gif]") {
+		t.Errorf("render with a MIME filter configured is missing its deny list:\n%s", withFeatures)
+	}
+	if !strings.Contains(withFeatures, `cd my-saved-search`) {
+		t.Errorf("render with saved searches configured is missing usage instructions:\n%s", withFeatures)
+	}
+}
@@ -0,0 +1,46 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "fmt"
+
+// expandAlias reports whether name is a key of fsys.ExpressionAliases
+// and, if so, resolves it to the search expression it ultimately
+// stands for. An alias whose value is itself another alias's name is
+// followed transitively, so aliases can be built out of other
+// aliases; a chain that loops back on itself is reported as an error
+// rather than expanded forever.
+func (fsys *CamliFileSystem) expandAlias(name string) (expr string, ok bool, err error) {
+	val, exists := fsys.ExpressionAliases[name]
+	if !exists {
+		return "", false, nil
+	}
+	seen := map[string]bool{name: true}
+	for {
+		if seen[val] {
+			return "", true, fmt.Errorf("fs: expression alias %q forms a cycle via %q", name, val)
+		}
+		next, isAlias := fsys.ExpressionAliases[val]
+		if !isAlias {
+			return val, true, nil
+		}
+		seen[val] = true
+		val = next
+	}
+}
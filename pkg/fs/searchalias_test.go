@@ -0,0 +1,63 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestExpandAliasTransitive is a regression test for expandAlias's
+// main case: an alias built out of another alias resolves all the way
+// down to the underlying expression, not just one level.
+func TestExpandAliasTransitive(t *testing.T) {
+	fsys := &CamliFileSystem{ExpressionAliases: map[string]string{
+		"vacation": "tag:vacation",
+		"rv":       "vacation",
+	}}
+	expr, ok, err := fsys.expandAlias("rv")
+	if err != nil {
+		t.Fatalf("expandAlias(%q): %v", "rv", err)
+	}
+	if !ok {
+		t.Fatalf("expandAlias(%q) = ok=false; want true", "rv")
+	}
+	if want := "tag:vacation"; expr != want {
+		t.Errorf("expandAlias(%q) = %q; want %q", "rv", expr, want)
+	}
+}
+
+// TestExpandAliasUnknown is a regression test for expandAlias's
+// ok=false path: a name that isn't a key of ExpressionAliases at all.
+func TestExpandAliasUnknown(t *testing.T) {
+	fsys := &CamliFileSystem{ExpressionAliases: map[string]string{"vacation": "tag:vacation"}}
+	if _, ok, _ := fsys.expandAlias("is:image"); ok {
+		t.Errorf("expandAlias(%q) = ok=true; want false", "is:image")
+	}
+}
+
+// TestExpandAliasCycle is a regression test for expandAlias's loop
+// detection: two aliases naming each other must error out instead of
+// recursing forever.
+func TestExpandAliasCycle(t *testing.T) {
+	fsys := &CamliFileSystem{ExpressionAliases: map[string]string{
+		"a": "b",
+		"b": "a",
+	}}
+	if _, _, err := fsys.expandAlias("a"); err == nil {
+		t.Errorf("expandAlias(%q) with a cyclic alias chain = nil error; want non-nil", "a")
+	}
+}
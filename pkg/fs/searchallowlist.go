@@ -0,0 +1,77 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"regexp"
+	"sync"
+)
+
+// expressionAllowlists caches each CamliFileSystem's compiled
+// ExpressionAllowlist, keyed by pointer identity the same way
+// searchbreaker.go's breakers registry is.
+var (
+	expressionAllowlistsMu sync.Mutex
+	expressionAllowlists   = map[*CamliFileSystem][]*regexp.Regexp{}
+)
+
+// compiledExpressionAllowlist returns fsys's ExpressionAllowlist,
+// each entry compiled to a regexp anchored to match the whole
+// expression. An entry that isn't itself valid regexp syntax is
+// compiled instead as the literal pattern regexp.QuoteMeta produces
+// for it, so a plain literal entry always works as an exact match
+// regardless of whether it happens to also be valid regexp syntax.
+func compiledExpressionAllowlist(fsys *CamliFileSystem) []*regexp.Regexp {
+	expressionAllowlistsMu.Lock()
+	defer expressionAllowlistsMu.Unlock()
+	if res, ok := expressionAllowlists[fsys]; ok {
+		return res
+	}
+	res := make([]*regexp.Regexp, 0, len(fsys.ExpressionAllowlist))
+	for _, entry := range fsys.ExpressionAllowlist {
+		re, err := regexp.Compile("^(?:" + entry + ")$")
+		if err != nil {
+			re = regexp.MustCompile("^" + regexp.QuoteMeta(entry) + "$")
+		}
+		res = append(res, re)
+	}
+	expressionAllowlists[fsys] = res
+	return res
+}
+
+// expressionAllowed reports whether expr is permitted by
+// fsys.ExpressionAllowlist: true unconditionally when the allowlist
+// is empty (the default, permit-all behavior), otherwise true only
+// when expr matches one of its entries; see ExpressionAllowlist.
+func expressionAllowed(fsys *CamliFileSystem, expr string) bool {
+	if len(fsys.ExpressionAllowlist) == 0 {
+		return true
+	}
+	for _, entry := range fsys.ExpressionAllowlist {
+		if entry == expr {
+			return true
+		}
+	}
+	for _, re := range compiledExpressionAllowlist(fsys) {
+		if re.MatchString(expr) {
+			return true
+		}
+	}
+	return false
+}
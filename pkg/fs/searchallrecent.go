@@ -0,0 +1,242 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// allRecentDirName is the reserved name of the top-level searchDir's
+// "union of every saved search and alias, newest first" dashboard
+// shortcut (see searchDir.allRecentDir): a single "what's new
+// everywhere" listing, rather than having to cd into each saved
+// search or alias individually.
+const allRecentDirName = "all-recent"
+
+// defaultAllRecentLimit caps allRecentDirName's listing when
+// CamliFileSystem.AllRecentLimit isn't set.
+const defaultAllRecentLimit = 200
+
+// effectiveAllRecentLimit is the limit allRecentDirName actually
+// uses: fsys's own AllRecentLimit if set, else defaultAllRecentLimit.
+func (fsys *CamliFileSystem) effectiveAllRecentLimit() int {
+	if fsys.AllRecentLimit > 0 {
+		return fsys.AllRecentLimit
+	}
+	return defaultAllRecentLimit
+}
+
+// allRecentSource is one named expression allRecentDir.resolve unions
+// over: a saved search's or an expression alias's own query, labeled
+// with whichever name it's listed under, for the
+// user.camli.sourceSearch xattr each of its entries gets.
+type allRecentSource struct {
+	name string
+	expr string
+}
+
+// allRecentSources gathers n's saved searches and expression aliases
+// into a single list of named expressions to union over: saved
+// searches first, then any alias whose name isn't already claimed by
+// one, mirroring searchDir.ReadDirAll's own precedence between the
+// two. A failure listing saved searches is returned to the caller to
+// log and degrade from, the same way savedSearches' other callers do.
+func (n *searchDir) allRecentSources(ctx context.Context) ([]allRecentSource, error) {
+	saved, err := n.savedSearches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]allRecentSource, 0, len(saved)+len(n.fs.ExpressionAliases))
+	used := make(map[string]bool, len(saved))
+	for name, ss := range saved {
+		used[name] = true
+		sources = append(sources, allRecentSource{name: name, expr: ss.Expr})
+	}
+	for name, expr := range n.fs.ExpressionAliases {
+		if used[name] {
+			continue
+		}
+		sources = append(sources, allRecentSource{name: name, expr: expr})
+	}
+	return sources, nil
+}
+
+// allRecentDir is the directory allRecentDirName resolves to: it
+// unions every one of its sources' own dir.Resolve results, keeping
+// only the AllRecentLimit most recently modified entries across all
+// of them combined, newest first. It reuses unionResultDir's own
+// per-expression resolve-and-skip approach, so a saved search or
+// alias that errors out (a bad expression, an unreachable server) is
+// logged and excluded rather than failing the whole listing. Each
+// entry's user.camli.sourceSearch xattr (set on the searchResultFile
+// entryNode returns, in Lookup) names whichever source it came from,
+// so a dashboard can tell entries from different sources apart once
+// they're merged into one flat directory.
+type allRecentDir struct {
+	fs      *CamliFileSystem
+	sources []allRecentSource
+
+	mu           sync.Mutex
+	resolved     bool
+	names        []string
+	refs         map[string]blob.Ref
+	entries      map[string]dir.Entry
+	sourceSearch map[string]string
+}
+
+var (
+	_ fs.Node               = (*allRecentDir)(nil)
+	_ fs.HandleReadDirAller = (*allRecentDir)(nil)
+	_ fs.NodeStringLookuper = (*allRecentDir)(nil)
+)
+
+// allRecentDir returns the directory backing allRecentDirName: a
+// fresh union over n's current saved searches and aliases, resolved
+// lazily on its first ReadDirAll/Lookup the same way unionResultDir
+// is. Unlike recentDir, it isn't cached in n.fs's searchDirCache,
+// since that cache holds *searchResultDir specifically; rebuilding it
+// per Lookup is cheap (it does no querying of its own until
+// resolved) and always reflects whatever saved searches/aliases
+// currently exist. A failure gathering sources (e.g. the saved-search
+// query itself failing) is logged here and yields an allRecentDir
+// with no sources, which lists empty rather than failing the Lookup.
+func (n *searchDir) allRecentDir(ctx context.Context) *allRecentDir {
+	sources, err := n.allRecentSources(ctx)
+	if err != nil {
+		Logger.Printf("fs.search: all-recent: listing sources: %v", err)
+	}
+	return &allRecentDir{fs: n.fs, sources: sources}
+}
+
+func (n *allRecentDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+// resolve runs n.sources, deduplicating by permanode across all of
+// them the same way unionResultDir.resolve does (the first source to
+// name a given permanode wins its entry), then truncates to the
+// n.fs.effectiveAllRecentLimit() entries with the newest ModTime. It's
+// idempotent: only the first call does any work, the rest reuse
+// n.names/n.refs/n.entries/n.sourceSearch.
+func (n *allRecentDir) resolve(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.resolved {
+		return nil
+	}
+	type named struct {
+		name   string
+		source string
+		entry  dir.Entry
+	}
+	var all []named
+	seen := make(map[blob.Ref]bool)
+	for _, src := range n.sources {
+		ents, err := dir.Resolve(ctx, n.fs.client, src.expr, nil)
+		if err != nil {
+			Logger.Printf("fs.all-recent: querying %q (%s): %v", src.expr, src.name, err)
+			continue
+		}
+		for _, e := range ents {
+			if seen[e.Permanode] {
+				continue
+			}
+			seen[e.Permanode] = true
+			all = append(all, named{name: e.Name, source: src.name, entry: e})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].entry.ModTime.After(all[j].entry.ModTime)
+	})
+	if limit := n.fs.effectiveAllRecentLimit(); limit > 0 && len(all) > limit {
+		all = all[:limit]
+	}
+
+	names := make([]string, 0, len(all))
+	refs := make(map[string]blob.Ref, len(all))
+	entries := make(map[string]dir.Entry, len(all))
+	sourceSearch := make(map[string]string, len(all))
+	taken := make(map[string]bool, len(all))
+	for _, it := range all {
+		name := it.name
+		if name == "" {
+			name = it.entry.Permanode.String()
+		}
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s.%d", it.name, i)
+		}
+		taken[name] = true
+		names = append(names, name)
+		refs[name] = it.entry.Permanode
+		entries[name] = it.entry
+		sourceSearch[name] = it.source
+	}
+	n.names = names
+	n.refs = refs
+	n.entries = entries
+	n.sourceSearch = sourceSearch
+	n.resolved = true
+	return nil
+}
+
+func (n *allRecentDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := n.resolve(ctx); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	names := n.names
+	refs := n.refs
+	kinds := make(map[string]fuse.DirentType, len(n.entries))
+	for name, e := range n.entries {
+		kinds[name] = entryDirentKind(n.fs, e)
+	}
+	n.mu.Unlock()
+	return direntsWithInode(n.fs, names, refs, kinds), nil
+}
+
+func (n *allRecentDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := n.resolve(ctx); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	e, ok := n.entries[name]
+	source := n.sourceSearch[name]
+	n.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	node := entryNode(n.fs, e, nil)
+	if sf, ok := node.(*searchResultFile); ok {
+		sf.sourceSearch = source
+	}
+	return node, nil
+}
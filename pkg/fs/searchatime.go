@@ -0,0 +1,66 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// relatimeGranularity bounds how often recordAccess actually updates
+// an entry's stored atime, the same way the kernel's relatime mount
+// option does: a read only bumps atime if the entry looks modified
+// since the last recorded access, or that access is more than this
+// long ago, rather than on every single Lookup/Open turning into a
+// map write under n.mu.
+const relatimeGranularity = 24 * time.Hour
+
+// relatimeUpdate reports the atime recordAccess should store for an
+// entry last recorded at prev (zero if never recorded), given its
+// current mtime and the access happening now: prev itself, unchanged,
+// unless prev doesn't postdate mtime (the entry changed since that
+// recorded access, so it's due regardless of how recent it was) or
+// prev is more than relatimeGranularity stale. Either way the result
+// is never before mtime, since now is never before it either.
+func relatimeUpdate(prev, mtime, now time.Time) time.Time {
+	if prev.IsZero() || !prev.After(mtime) || now.Sub(prev) > relatimeGranularity {
+		return now
+	}
+	return prev
+}
+
+// recordAccessLocked is recordAccess without taking n.mu itself, for
+// a caller (searchResultDir.Lookup) that already holds it. mtime is
+// the entry's own last-modified time (n.modTime[name]), needed to
+// decide whether the update is due.
+func (n *searchResultDir) recordAccessLocked(name string, mtime time.Time) {
+	if n.fs.NoAtime {
+		return
+	}
+	if n.atime == nil {
+		n.atime = make(map[string]time.Time)
+	}
+	n.atime[name] = relatimeUpdate(n.atime[name], mtime, time.Now())
+}
+
+// recordAccess notes that name was just accessed (opened, read, or
+// otherwise touched outside a Lookup that already holds n.mu), for a
+// caller like searchResultFile.Open.
+func (n *searchResultDir) recordAccess(name string, mtime time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.recordAccessLocked(name, mtime)
+}
@@ -0,0 +1,165 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/types"
+)
+
+// TestRelatimeUpdate covers relatimeUpdate's four cases directly,
+// without touching any node: never recorded, recorded before the
+// entry's own mtime (so it's due regardless of age), recorded long
+// enough ago to be stale, and a fresh recording that should be left
+// alone.
+func TestRelatimeUpdate(t *testing.T) {
+	mtime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := mtime.Add(48 * time.Hour)
+
+	if got := relatimeUpdate(time.Time{}, mtime, now); got != now {
+		t.Errorf("never recorded: relatimeUpdate = %v; want now (%v)", got, now)
+	}
+
+	staleButAfterMtime := now.Add(-relatimeGranularity - time.Hour)
+	if got := relatimeUpdate(staleButAfterMtime, mtime, now); got != now {
+		t.Errorf("stale prev: relatimeUpdate = %v; want now (%v)", got, now)
+	}
+
+	beforeMtime := mtime.Add(-time.Hour)
+	if got := relatimeUpdate(beforeMtime, mtime, now); got != now {
+		t.Errorf("prev before mtime: relatimeUpdate = %v; want now (%v)", got, now)
+	}
+
+	fresh := now.Add(-time.Minute)
+	if got := relatimeUpdate(fresh, mtime, now); got != fresh {
+		t.Errorf("fresh prev after mtime: relatimeUpdate = %v; want unchanged (%v)", got, fresh)
+	}
+}
+
+// TestRecordAccessAdvancesAtime checks that recordAccess (and its
+// Lookup-held-lock sibling recordAccessLocked) actually advances
+// n.atime on a fresh access, and that NoAtime suppresses it entirely.
+func TestRecordAccessAdvancesAtime(t *testing.T) {
+	mtime := time.Now().Add(-time.Hour)
+
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	n.recordAccess("photo.jpg", mtime)
+	first, ok := n.atime["photo.jpg"]
+	if !ok {
+		t.Fatalf("recordAccess didn't populate n.atime")
+	}
+	if !first.After(mtime) {
+		t.Errorf("recorded atime %v doesn't postdate mtime %v", first, mtime)
+	}
+
+	noAtime := &searchResultDir{fs: &CamliFileSystem{NoAtime: true}}
+	noAtime.recordAccess("photo.jpg", mtime)
+	if noAtime.atime != nil {
+		t.Errorf("recordAccess populated n.atime despite NoAtime")
+	}
+}
+
+// TestSearchResultDirAtimeFallsBackToMtime checks that Attr reports
+// Atime as the newest modtime when nothing's been accessed yet
+// (lastAccessed is zero), and as lastAccessed once markAccessed has
+// been called more recently than that.
+func TestSearchResultDirAtimeFallsBackToMtime(t *testing.T) {
+	mtime := time.Now().Add(-time.Hour)
+	n := &searchResultDir{
+		fs:      &CamliFileSystem{},
+		modTime: map[string]time.Time{"photo.jpg": mtime},
+	}
+
+	var a fuse.Attr
+	if err := n.Attr(context.Background(), &a); err != nil {
+		t.Fatalf("Attr() = %v", err)
+	}
+	if !a.Atime.Equal(mtime) {
+		t.Errorf("Atime with no access recorded = %v; want mtime %v", a.Atime, mtime)
+	}
+
+	n.markAccessed()
+	a = fuse.Attr{}
+	if err := n.Attr(context.Background(), &a); err != nil {
+		t.Fatalf("Attr() = %v", err)
+	}
+	if !a.Atime.After(mtime) {
+		t.Errorf("Atime after markAccessed = %v; want it to postdate mtime %v", a.Atime, mtime)
+	}
+}
+
+// TestSearchResultFileCtimeMapsToClaimTime checks that Attr's Ctime
+// comes from the permanode's own claim time (Permanode.ModTime) via
+// applyCreateTime/createTime, not from the content's Mtime.
+func TestSearchResultFileCtimeMapsToClaimTime(t *testing.T) {
+	claimTime := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	f := &searchResultFile{
+		node: node{fs: &CamliFileSystem{}},
+		pnodeMeta: &search.DescribedBlob{
+			Permanode: &search.DescribedPermanode{
+				ModTime: types.Time3339FromTime(claimTime),
+			},
+		},
+	}
+
+	var a fuse.Attr
+	if err := f.Attr(context.Background(), &a); err != nil {
+		t.Fatalf("Attr() = %v", err)
+	}
+	if !a.Ctime.Equal(claimTime) {
+		t.Errorf("Ctime = %v; want claim time %v", a.Ctime, claimTime)
+	}
+}
+
+// TestSearchResultFileAtimeAdvancesOnOpenAndFallsBack checks that
+// Attr's Atime falls back to Mtime before any access is recorded,
+// and reflects lastAccess (the field Open advances, set directly here)
+// once it's recorded.
+func TestSearchResultFileAtimeAdvancesOnOpenAndFallsBack(t *testing.T) {
+	mtime := time.Now().Add(-time.Hour)
+	f := &searchResultFile{
+		node: node{fs: &CamliFileSystem{}, pnodeModTime: mtime},
+	}
+
+	var a fuse.Attr
+	if err := f.Attr(context.Background(), &a); err != nil {
+		t.Fatalf("Attr() = %v", err)
+	}
+	if !a.Atime.Equal(a.Mtime) {
+		t.Errorf("Atime with no access recorded = %v; want Mtime %v", a.Atime, a.Mtime)
+	}
+
+	later := time.Now().Add(time.Minute)
+	f.accessMu.Lock()
+	f.lastAccess = later
+	f.accessMu.Unlock()
+
+	a = fuse.Attr{}
+	if err := f.Attr(context.Background(), &a); err != nil {
+		t.Fatalf("Attr() = %v", err)
+	}
+	if !a.Atime.Equal(later) {
+		t.Errorf("Atime after access = %v; want %v", a.Atime, later)
+	}
+}
@@ -0,0 +1,75 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/search/dir"
+)
+
+// TestNewestModTimeReflectsLatestEntry checks that newestModTime (and
+// so Attr's Mtime) reports the most recent of n.modTime's values, not
+// just whichever entry happened to be seeded last.
+func TestNewestModTimeReflectsLatestEntry(t *testing.T) {
+	base := time.Unix(1000, 0)
+	n := &searchResultDir{
+		modTime: map[string]time.Time{
+			"a": base,
+			"b": base.Add(2 * time.Hour),
+			"c": base.Add(time.Hour),
+		},
+	}
+	if got, want := n.newestModTime(), base.Add(2*time.Hour); !got.Equal(want) {
+		t.Errorf("newestModTime() = %v; want %v", got, want)
+	}
+}
+
+// TestNewestModTimeFallsBackToMountStartTime checks that an unseeded
+// directory (no entries yet) reports mountStartTime rather than the
+// zero time.
+func TestNewestModTimeFallsBackToMountStartTime(t *testing.T) {
+	n := &searchResultDir{}
+	if got := n.newestModTime(); !got.Equal(mountStartTime) {
+		t.Errorf("newestModTime() with no entries = %v; want mountStartTime %v", got, mountStartTime)
+	}
+}
+
+// TestEntryDirentKindTypes checks that entryDirentKind reports
+// fuse.DT_Dir for a set, fuse.DT_Link for a symlink, and fuse.DT_File
+// for a plain file entry.
+func TestEntryDirentKindTypes(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	cases := []struct {
+		name string
+		e    dir.Entry
+		want fuse.DirentType
+	}{
+		{"set", dir.Entry{IsSet: true}, fuse.DT_Dir},
+		{"symlink", dir.Entry{IsSymlink: true}, fuse.DT_Link},
+		{"file", dir.Entry{}, fuse.DT_File},
+	}
+	for _, c := range cases {
+		if got := entryDirentKind(fsys, c.e); got != c.want {
+			t.Errorf("entryDirentKind(%s) = %v; want %v", c.name, got, c.want)
+		}
+	}
+}
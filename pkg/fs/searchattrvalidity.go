@@ -0,0 +1,29 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// effectiveAttrValidity returns fs.AttrValidity. Every node's Attr
+// method sets fuse.Attr.Valid from this, instead of leaving it at its
+// own zero value, so the override is honored consistently across the
+// whole mount.
+func (fs *CamliFileSystem) effectiveAttrValidity() time.Duration {
+	return fs.AttrValidity
+}
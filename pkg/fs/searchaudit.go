@@ -0,0 +1,78 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"time"
+
+	"perkeep.org/pkg/blob"
+)
+
+// AuditEventType identifies the kind of mount activity an AuditEvent
+// records.
+type AuditEventType string
+
+const (
+	// AuditQueryExecuted is recorded each time doReaddir actually
+	// issues a search, as opposed to serving a ReadDirAll from cache;
+	// AuditEvent.Expr carries the expression that ran.
+	AuditQueryExecuted AuditEventType = "query_executed"
+	// AuditFileOpened is recorded each time a searchResultFile.Open
+	// reads real content rather than a contentless or placeholder
+	// stub; AuditEvent.BlobRef carries the content blob's ref.
+	AuditFileOpened AuditEventType = "file_opened"
+	// AuditDeleteClaimIssued is recorded each time
+	// searchResultDir.Remove successfully uploads a delete claim;
+	// AuditEvent.BlobRef carries the deleted permanode's ref.
+	AuditDeleteClaimIssued AuditEventType = "delete_claim_issued"
+)
+
+// AuditEvent is one recordable mount activity, passed to an
+// AuditSink. Expr and BlobRef are populated according to Type; the
+// other is left zero.
+type AuditEvent struct {
+	Time    time.Time
+	Type    AuditEventType
+	Expr    string
+	BlobRef blob.Ref
+}
+
+// AuditSink receives structured audit events (query execution, file
+// opens, and delete claims) from the search FUSE layer, for a mount
+// operator who wants to feed mount activity into a compliance or
+// audit pipeline, separate from the unstructured debug Logger.
+type AuditSink interface {
+	Audit(e AuditEvent)
+}
+
+// noopAuditSink is the CamliFileSystem.Audit default: it drops every
+// event, so existing callers that never set Audit pay nothing and see
+// no change in behavior.
+type noopAuditSink struct{}
+
+func (noopAuditSink) Audit(AuditEvent) {}
+
+// auditFor returns fsys.Audit, or noopAuditSink{} if it's unset, so
+// callers never need a nil check.
+func auditFor(fsys *CamliFileSystem) AuditSink {
+	if fsys.Audit != nil {
+		return fsys.Audit
+	}
+	return noopAuditSink{}
+}
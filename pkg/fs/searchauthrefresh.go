@@ -0,0 +1,74 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+)
+
+// refreshCall is one CredentialRefresher invocation's in-flight
+// state, exactly like targetedCall is for a deduplicated
+// lookupTargeted.
+type refreshCall struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// authRefreshers holds each CamliFileSystem's in-flight refreshCall,
+// if any, keyed by pointer identity the same way breakers is.
+var (
+	authRefreshersMu sync.Mutex
+	authRefreshers   = map[*CamliFileSystem]*refreshCall{}
+)
+
+// refreshCredentials calls fsys.CredentialRefresher, deduplicated
+// across concurrent callers the same way dedupTargetedLookup dedupes
+// lookupTargeted: the caller that finds no refresh already running
+// for fsys starts one and owns it; every other caller waits on
+// call.wg and shares its err instead of each re-authenticating
+// redundantly.
+func refreshCredentials(ctx context.Context, fsys *CamliFileSystem) error {
+	authRefreshersMu.Lock()
+	if call, ok := authRefreshers[fsys]; ok {
+		authRefreshersMu.Unlock()
+		call.wg.Wait()
+		return call.err
+	}
+	call := &refreshCall{}
+	call.wg.Add(1)
+	authRefreshers[fsys] = call
+	authRefreshersMu.Unlock()
+
+	Logger.Printf("fs.search: auth failure; refreshing credentials")
+	err := fsys.CredentialRefresher(ctx)
+	if err != nil {
+		Logger.Printf("fs.search: credential refresh failed: %v", err)
+	} else {
+		Logger.Printf("fs.search: credentials refreshed")
+	}
+
+	authRefreshersMu.Lock()
+	delete(authRefreshers, fsys)
+	authRefreshersMu.Unlock()
+
+	call.err = err
+	call.wg.Done()
+	return err
+}
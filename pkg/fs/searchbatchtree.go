@@ -0,0 +1,119 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// byBatchTreeDirName is the reserved name of the faceted sibling view
+// BatchAttribute adds under a search result directory, the same way
+// byTagTreeDirName adds one for "tag". Like byTagTreeDirName, it only
+// "exists" once the parent has been seeded and BatchAttribute is set.
+const byBatchTreeDirName = ".by-batch"
+
+// unbatchedBucketName is batchBuckets' bucket for names whose
+// permanode has no BatchAttribute at all, the same way
+// untaggedTagBucketName buckets byTagTreeDir's own outliers.
+const unbatchedBucketName = "_unbatched"
+
+// batchBuckets groups n.ents by BatchAttribute's value, collecting
+// names with no such attribute (or an empty one) under
+// unbatchedBucketName. Like groupBuckets, and unlike tagBuckets, a
+// name lands in at most one bucket. It must be called with n.mu held.
+func (n *searchResultDir) batchBuckets() map[string][]string {
+	buckets := make(map[string][]string)
+	for name := range n.ents {
+		pm := n.pnodeMeta[name]
+		bucket := unbatchedBucketName
+		if pm != nil && pm.Permanode != nil {
+			if v := pm.Permanode.Attr.Get(n.fs.BatchAttribute); v != "" {
+				bucket = v
+			}
+		}
+		buckets[bucket] = append(buckets[bucket], name)
+	}
+	return buckets
+}
+
+// hasBatchTree reports whether n's last ReadDirAll has anything for
+// byBatchTreeDirName to show, so Lookup can give a plain ENOENT for it
+// instead of an always-present directory when BatchAttribute isn't
+// set or the parent hasn't been seeded yet.
+func (n *searchResultDir) hasBatchTree() bool {
+	if n.fs.BatchAttribute == "" {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.ents) > 0
+}
+
+// byBatchTreeDir lists the BatchAttribute values present across its
+// parent's current results, one subdirectory per value (plus
+// unbatchedBucketName), each resolving to a bucketDir (see
+// searchtagtree.go).
+type byBatchTreeDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*byBatchTreeDir)(nil)
+	_ fs.HandleReadDirAller = (*byBatchTreeDir)(nil)
+	_ fs.NodeStringLookuper = (*byBatchTreeDir)(nil)
+)
+
+func (d *byBatchTreeDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *byBatchTreeDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	buckets := d.parent.batchBuckets()
+	names := make([]string, 0, len(buckets))
+	for bucket := range buckets {
+		names = append(names, bucket)
+	}
+	return dirents(names, fuse.DT_Dir), nil
+}
+
+func (d *byBatchTreeDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	members, ok := d.parent.batchBuckets()[name]
+	d.parent.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return &bucketDir{parent: d.parent, names: members}, nil
+}
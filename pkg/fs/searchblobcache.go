@@ -0,0 +1,181 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"sync"
+
+	"perkeep.org/pkg/blob"
+)
+
+// defaultBlobCacheBytes is the byte budget blobCacheFor uses when
+// CamliFileSystem.BlobCacheBytes isn't set: generous enough that a
+// session's handful of recently viewed files stay resident, small
+// enough that it doesn't surprise a mount that never asked for this.
+const defaultBlobCacheBytes = 64 << 20 // 64MB
+
+// blobCaches holds each CamliFileSystem's shared blobCache, keyed by
+// pointer identity the same way searchbreaker.go's breakers registry
+// and searchdircache.go's searchDirCaches are.
+var (
+	blobCachesMu sync.Mutex
+	blobCaches   = map[*CamliFileSystem]*blobCache{}
+)
+
+// blobCacheFor returns fsys's shared blobCache, creating it with
+// fsys's configured budget (or defaultBlobCacheBytes) the first time
+// any searchResultFile asks for it.
+func blobCacheFor(fsys *CamliFileSystem) *blobCache {
+	blobCachesMu.Lock()
+	defer blobCachesMu.Unlock()
+	if c, ok := blobCaches[fsys]; ok {
+		return c
+	}
+	max := fsys.BlobCacheBytes
+	if max <= 0 {
+		max = defaultBlobCacheBytes
+	}
+	c := &blobCache{
+		maxBytes: max,
+		ll:       list.New(),
+		items:    make(map[blob.Ref]*list.Element),
+	}
+	blobCaches[fsys] = c
+	return c
+}
+
+// blobCache is a size-bounded, LRU, in-memory cache of whole blob
+// contents, shared across every searchResultFile opened against one
+// CamliFileSystem (see blobCacheFor and cachingFetcher). Unlike
+// prefetch (searchprefetch.go), which eagerly warms likely-next
+// entries' metadata in the background ahead of any request for them,
+// this is purely demand-filled: an entry exists only because
+// something already asked to fetch that exact blobref.
+//
+// Its keys are content blobrefs, not paths or permanodes, and that's
+// deliberate: a blobref is immutable, so an entry stays valid across
+// a directory refresh, or a permanode's camliContent changing to
+// point elsewhere and back, for as long as the same content blob is
+// still the one being read. Keying by path or permanode instead would
+// force an eviction on every refresh even when nothing about the
+// underlying content actually changed.
+type blobCache struct {
+	maxBytes int64
+
+	mu       sync.Mutex
+	curBytes int64
+	ll       *list.List                // of *blobCacheEntry, front = most recently used
+	items    map[blob.Ref]*list.Element
+}
+
+// blobCacheEntry is blobCache's list.Element.Value.
+type blobCacheEntry struct {
+	ref  blob.Ref
+	data []byte
+}
+
+// get returns ref's cached content, if any, moving it to the front as
+// the most recently used.
+func (c *blobCache) get(ref blob.Ref) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[ref]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*blobCacheEntry).data, true
+}
+
+// put caches data under ref as the most recently used entry, evicting
+// the least recently used entries until the cache is back under its
+// byte budget. A blob larger than the whole budget is left uncached
+// rather than evicting everything else just to not fit anyway.
+func (c *blobCache) put(ref blob.Ref, data []byte) {
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[ref]; ok {
+		c.curBytes -= int64(len(e.Value.(*blobCacheEntry).data))
+		e.Value.(*blobCacheEntry).data = data
+		c.curBytes += int64(len(data))
+		c.ll.MoveToFront(e)
+	} else {
+		c.items[ref] = c.ll.PushFront(&blobCacheEntry{ref: ref, data: data})
+		c.curBytes += int64(len(data))
+	}
+	for c.curBytes > c.maxBytes {
+		e := c.ll.Back()
+		if e == nil {
+			break
+		}
+		entry := e.Value.(*blobCacheEntry)
+		c.ll.Remove(e)
+		delete(c.items, entry.ref)
+		c.curBytes -= int64(len(entry.data))
+	}
+}
+
+// stats reports c's current occupancy for statusFileName: how many
+// blobs it holds, their total size, and its configured byte budget.
+func (c *blobCache) stats() (items int, curBytes, maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items), c.curBytes, c.maxBytes
+}
+
+// cachingFetcher wraps a blob.Fetcher with blobCacheFor(fsys), so
+// every blob schema.NewFileReader and the *schema.FileReader it
+// returns fetch through it (the schema blob itself, and each part
+// blob a Read walks into) is served from cache on a repeat read
+// instead of going back to the blobserver. fsys's Metrics (see
+// searchmetrics.go) is fed a hit or miss per fetch, for tuning
+// CamliFileSystem.BlobCacheBytes against real traffic.
+type cachingFetcher struct {
+	fsys *CamliFileSystem
+	next interface {
+		Fetch(ctx context.Context, br blob.Ref) (io.ReadCloser, uint32, error)
+	}
+}
+
+func (f cachingFetcher) Fetch(ctx context.Context, br blob.Ref) (io.ReadCloser, uint32, error) {
+	cache := blobCacheFor(f.fsys)
+	if data, ok := cache.get(br); ok {
+		metricsFor(f.fsys).IncBlobCacheHit()
+		return io.NopCloser(bytes.NewReader(data)), uint32(len(data)), nil
+	}
+	metricsFor(f.fsys).IncBlobCacheMiss()
+	rc, size, err := f.next.Fetch(ctx, br)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	cache.put(br, data)
+	return io.NopCloser(bytes.NewReader(data)), size, nil
+}
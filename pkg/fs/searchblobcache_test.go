@@ -0,0 +1,86 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+)
+
+// countingFetcher counts each call to Fetch, returning data for every
+// ref regardless of what ref actually is, so a test can tell whether
+// a cachingFetcher served a request from blobCacheFor(fsys) instead of
+// calling through.
+type countingFetcher struct {
+	data  []byte
+	calls int
+}
+
+func (f *countingFetcher) Fetch(ctx context.Context, br blob.Ref) (io.ReadCloser, uint32, error) {
+	f.calls++
+	return io.NopCloser(bytes.NewReader(f.data)), uint32(len(f.data)), nil
+}
+
+// TestBlobCacheHitPersistsAcrossRefresh checks that blobCacheFor(fsys)
+// is keyed purely by content blobref: two independent cachingFetchers
+// for the same fsys (standing in for two directory refreshes, each of
+// which wraps a fresh *schema.FileReader in its own cachingFetcher)
+// fetching the same ref both hit the one shared cache, even though
+// neither fetcher knows about the other. This is what lets content
+// survive a refresh, or a permanode's camliContent changing to point
+// elsewhere and back, as long as the ref itself is unchanged.
+func TestBlobCacheHitPersistsAcrossRefresh(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	ref := blob.RefFromString("hello")
+	underlying := &countingFetcher{data: []byte("hello world")}
+
+	first := cachingFetcher{fsys: fsys, next: underlying}
+	rc, _, err := first.Fetch(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("first Fetch: %v", err)
+	}
+	rc.Close()
+	if underlying.calls != 1 {
+		t.Fatalf("underlying.calls = %d after first Fetch; want 1", underlying.calls)
+	}
+
+	// A second, unrelated cachingFetcher for the same fsys -- as a
+	// fresh directory refresh would construct -- must still hit the
+	// cache blobCacheFor(fsys) shares, without calling through.
+	second := cachingFetcher{fsys: fsys, next: underlying}
+	rc, _, err = second.Fetch(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("second Fetch: %v", err)
+	}
+	defer rc.Close()
+	if underlying.calls != 1 {
+		t.Errorf("underlying.calls = %d after second Fetch; want 1 (cache hit)", underlying.calls)
+	}
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("reading cached content: %v", err)
+	}
+	if string(got) != "hello world" {
+		t.Errorf("cached content = %q; want %q", got, "hello world")
+	}
+}
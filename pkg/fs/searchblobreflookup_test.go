@@ -0,0 +1,90 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// tableDescriber is a dir.Describer serving Describe from a fixed
+// blobref table, the same fixture shape dir_test.go's own
+// countingDescriber uses, without needing a real search backend.
+type tableDescriber struct {
+	table map[blob.Ref]*search.DescribedBlob
+}
+
+func (d *tableDescriber) Describe(ctx context.Context, req *search.DescribeRequest) (*search.DescribeResponse, error) {
+	meta := search.MetaMap{}
+	if m, ok := d.table[req.BlobRef]; ok {
+		meta[req.BlobRef] = m
+		if m.Permanode != nil {
+			if cc, ok := blob.Parse(m.Permanode.Attr.Get("camliContent")); ok {
+				if fm, ok := d.table[cc]; ok {
+					meta[cc] = fm
+				}
+			}
+		}
+	}
+	return &search.DescribeResponse{Meta: meta}, nil
+}
+
+// TestResolveBlobRefLookupPresentButNotListed checks that a permanode
+// the describer actually knows about resolves to a node even though
+// it was never part of any query result (the caller just happens to
+// already know its blobref).
+func TestResolveBlobRefLookupPresentButNotListed(t *testing.T) {
+	pn := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	cc := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+
+	d := &tableDescriber{table: map[blob.Ref]*search.DescribedBlob{
+		pn: {BlobRef: pn, Permanode: &search.Permanode{Attr: url.Values{"camliContent": {cc.String()}}}},
+		cc: {BlobRef: cc, File: &search.DescribedFile{FileName: "hidden.txt", Size: 42}},
+	}}
+
+	nod, found, err := resolveBlobRefLookup(context.Background(), d, pn, nil, &CamliFileSystem{})
+	if err != nil {
+		t.Fatalf("resolveBlobRefLookup(%v) = %v", pn, err)
+	}
+	if !found {
+		t.Fatalf("resolveBlobRefLookup(%v) found=false; want true for a describer that knows this permanode", pn)
+	}
+	if nod == nil {
+		t.Fatalf("resolveBlobRefLookup(%v) returned a nil node despite found=true", pn)
+	}
+}
+
+// TestResolveByRawBlobRefMalformedMisses checks that a name that
+// doesn't even parse as a blobref is rejected before any describe
+// call is attempted, so an ordinary filename that merely looks
+// blobref-ish (but isn't) falls straight through to the caller's usual
+// ENOENT handling instead of becoming a query.
+func TestResolveByRawBlobRefMalformedMisses(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	n.mu.Lock()
+	nod, ok := n.resolveByRawBlobRef(context.Background(), "not-a-blobref.jpg")
+	n.mu.Unlock()
+	if ok || nod != nil {
+		t.Fatalf("resolveByRawBlobRef(%q) = %v, %v; want nil, false", "not-a-blobref.jpg", nod, ok)
+	}
+}
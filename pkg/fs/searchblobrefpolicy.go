@@ -0,0 +1,75 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"strings"
+
+	"perkeep.org/pkg/blob"
+)
+
+// blobrefLookupPrefix marks a searchDir.Lookup name as an explicit
+// blobref reference, the same way encodedExprPrefix marks one as an
+// explicit, escaped expression: "cd blob:sha224-..." always resolves
+// br directly regardless of CamliFileSystem.BlobrefLookupPolicy.
+const blobrefLookupPrefix = "blob:"
+
+// BlobrefLookupPolicy resolves the ambiguity between searchDir.Lookup's
+// two ways of treating a name that happens to parse as both a blobref
+// and a trivial search expression.
+type BlobrefLookupPolicy int
+
+const (
+	// BlobrefOnlyWithPrefix, the zero value and default, never
+	// guesses: an unprefixed name is always treated as an expression
+	// (or saved search, or alias), no matter how it's shaped.
+	// blobrefLookupPrefix is the only way to address a blobref
+	// directly.
+	BlobrefOnlyWithPrefix BlobrefLookupPolicy = iota
+	// BlobrefFirst resolves any name that parses as a blobref that
+	// way immediately, before it's ever considered as an expression,
+	// saved search, or alias name. This was this package's only
+	// behavior before BlobrefLookupPolicy existed.
+	BlobrefFirst
+	// ExpressionFirst checks name against saved searches and
+	// aliases first; only once neither claims it does a name that
+	// parses as a blobref resolve as one, rather than falling
+	// through to an ordinary (and likely meaningless) search
+	// expression.
+	ExpressionFirst
+)
+
+// blobrefLookupShortcut reports whether name should resolve directly
+// to a blobref at searchDir.Lookup's early blobref check, before
+// saved searches, aliases, or NamedSearchesConfigFile views get a say:
+// true for any blobrefLookupPrefix-prefixed name, or for a bare
+// blobref-shaped name under BlobrefFirst. BlobrefOnlyWithPrefix and
+// ExpressionFirst both leave a bare name to fall through to the
+// expression path instead; ExpressionFirst gets its own, later chance
+// at the same name once saved searches and aliases have had theirs
+// (see searchDir.Lookup).
+func (fsys *CamliFileSystem) blobrefLookupShortcut(name string) (blob.Ref, bool) {
+	if rest := strings.TrimPrefix(name, blobrefLookupPrefix); rest != name {
+		return blob.Parse(rest)
+	}
+	if fsys.BlobrefLookupPolicy == BlobrefFirst {
+		return blob.Parse(name)
+	}
+	return blob.Ref{}, false
+}
@@ -0,0 +1,52 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestBlobrefLookupShortcut checks that a prefixed name always
+// resolves as a blobref, a bare blobref-shaped name only resolves
+// that way under BlobrefFirst, and a non-blobref-shaped name never
+// resolves regardless of policy.
+func TestBlobrefLookupShortcut(t *testing.T) {
+	validRef := "sha224-" + strings.Repeat("a", 56)
+	tests := []struct {
+		policy BlobrefLookupPolicy
+		name   string
+		want   bool
+	}{
+		{BlobrefOnlyWithPrefix, validRef, false},
+		{BlobrefOnlyWithPrefix, blobrefLookupPrefix + validRef, true},
+		{BlobrefFirst, validRef, true},
+		{BlobrefFirst, blobrefLookupPrefix + validRef, true},
+		{ExpressionFirst, validRef, false},
+		{ExpressionFirst, blobrefLookupPrefix + validRef, true},
+		{BlobrefFirst, "is:image", false},
+	}
+	for _, tt := range tests {
+		fsys := &CamliFileSystem{BlobrefLookupPolicy: tt.policy}
+		_, got := fsys.blobrefLookupShortcut(tt.name)
+		if got != tt.want {
+			t.Errorf("blobrefLookupShortcut(policy=%v, %q) ok = %v; want %v", tt.policy, tt.name, got, tt.want)
+		}
+	}
+}
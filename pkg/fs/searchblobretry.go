@@ -0,0 +1,79 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// defaultBlobFetchRetryMax is the BlobFetchRetryMax a rangedFileHandle
+// uses when CamliFileSystem.BlobFetchRetryMax is left at its zero
+// value, matching queryRetryMax's own default.
+const defaultBlobFetchRetryMax = 3
+
+// effectiveBlobFetchRetryMax reports the retry budget a
+// rangedFileHandle actually applies: fs's configured
+// BlobFetchRetryMax if positive, otherwise defaultBlobFetchRetryMax.
+func (fsys *CamliFileSystem) effectiveBlobFetchRetryMax() int {
+	if fsys.BlobFetchRetryMax > 0 {
+		return fsys.BlobFetchRetryMax
+	}
+	return defaultBlobFetchRetryMax
+}
+
+// blobRetryBaseDelay is the backoff before the first blob fetch retry;
+// blobRetryDelay doubles it per attempt after that, the same schedule
+// queryRetryDelay uses.
+const blobRetryBaseDelay = 200 * time.Millisecond
+
+// blobRetryDelay is the backoff before retrying the blob fetch for the
+// (0-indexed) attempt that just failed: 200ms, 400ms, 800ms, ...
+func blobRetryDelay(attempt int) time.Duration {
+	return blobRetryBaseDelay << attempt
+}
+
+// isTransientBlobErr reports whether err, from a schema.FileReader
+// ReadAt call, looks like a transient condition (a dropped connection,
+// a momentary storage hiccup) worth spending a rangedFileHandle's
+// retry budget on, as opposed to one that will fail exactly the same
+// way on every attempt: a blob that's genuinely missing or whose
+// content fails to verify isn't going to fetch successfully no matter
+// how many times it's retried.
+func isTransientBlobErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The caller's own deadline is what ended this attempt; no
+		// retry would do anything but burn the same budget again.
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "not found"), strings.Contains(msg, "no such blob"):
+		return false
+	case strings.Contains(msg, "corrupt"), strings.Contains(msg, "hash mismatch"), strings.Contains(msg, "checksum"):
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,35 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// defaultBlockSize is reported via searchResultFile.Attr's BlockSize
+// when BlockSize is unset, matching the rolling checksum chunker's
+// typical average chunk size closely enough that a client reading in
+// BlockSize-aligned chunks usually reads along chunk boundaries rather
+// than splitting one blob fetch across two reads.
+const defaultBlockSize = 64 << 10 // 64KiB
+
+// effectiveBlockSize returns fsys.BlockSize if set, else
+// defaultBlockSize.
+func (fsys *CamliFileSystem) effectiveBlockSize() uint32 {
+	if fsys.BlockSize != 0 {
+		return fsys.BlockSize
+	}
+	return defaultBlockSize
+}
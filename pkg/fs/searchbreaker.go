@@ -0,0 +1,102 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerFailureThreshold is how many consecutive query failures trip
+// a queryBreaker open.
+const breakerFailureThreshold = 3
+
+// breakerCooldown is how long a tripped queryBreaker stays open
+// before letting another query through to test whether the server
+// has recovered.
+const breakerCooldown = 30 * time.Second
+
+// breakers holds each CamliFileSystem's circuit breaker state, keyed
+// by pointer identity the same way searchWatch.go's watchers
+// registry is.
+var (
+	breakersMu sync.Mutex
+	breakers   = map[*CamliFileSystem]*queryBreaker{}
+)
+
+// queryBreaker tracks consecutive client.Query failures for one
+// mount, so repeated ReadDirAlls against a down server can fail fast
+// instead of each waiting out its own QueryTimeout.
+type queryBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func breakerFor(fsys *CamliFileSystem) *queryBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[fsys]
+	if !ok {
+		b = &queryBreaker{}
+		breakers[fsys] = b
+	}
+	return b
+}
+
+// allow reports whether a query should be attempted: either the
+// breaker hasn't tripped yet, or its cooldown has elapsed and it's
+// time to test recovery.
+func (b *queryBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.allowLocked()
+}
+
+// status reports b's current state for statusFileName: whether it's
+// presently open (failing queries fast), how many consecutive
+// failures it's seen, and, if open, when it next lets a query through
+// to test recovery.
+func (b *queryBreaker) status() (open bool, failures int, openUntil time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.allowLocked(), b.failures, b.openUntil
+}
+
+// allowLocked is allow's body, for status to reuse under the same
+// lock rather than call allow (which would re-lock).
+func (b *queryBreaker) allowLocked() bool {
+	return b.failures < breakerFailureThreshold || !time.Now().Before(b.openUntil)
+}
+
+// recordResult updates the breaker's failure count from a query's
+// outcome: a success resets it closed; a failure that reaches
+// breakerFailureThreshold opens it for breakerCooldown.
+func (b *queryBreaker) recordResult(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= breakerFailureThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
@@ -0,0 +1,106 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// byContentDirName is the reserved name of the content-addressed
+// sibling view under a search result directory: each entry's content
+// blobref (n.ents[name].BlobRef, already resolved by ReadDirAll) is
+// exposed as a name under byContentDirName, giving dedup-aware tools
+// a path that's stable across renames and immune to filename
+// collisions. Like dupesDirName, it only "exists" once the parent has
+// been seeded.
+const byContentDirName = ".by-content"
+
+// searchByContentDir lists the parent's n.ents by content blobref
+// instead of by filename, reusing the already-resolved BlobRef rather
+// than issuing any further query.
+type searchByContentDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*searchByContentDir)(nil)
+	_ fs.HandleReadDirAller = (*searchByContentDir)(nil)
+	_ fs.NodeStringLookuper = (*searchByContentDir)(nil)
+)
+
+func (d *searchByContentDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *searchByContentDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	names := make([]string, 0, len(d.parent.ents))
+	for _, db := range d.parent.ents {
+		if db.BlobRef.Valid() {
+			names = append(names, db.BlobRef.String())
+		}
+	}
+	sort.Strings(names)
+	return dirents(names, fuse.DT_File), nil
+}
+
+func (d *searchByContentDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	var origName string
+	found := false
+	for n, db := range d.parent.ents {
+		if db.BlobRef.Valid() && db.BlobRef.String() == name {
+			origName = n
+			found = true
+			break
+		}
+	}
+	d.parent.mu.Unlock()
+	if !found {
+		return nil, fuse.ENOENT
+	}
+	// Delegate so the returned node carries the same permanode/xattr
+	// info a direct Lookup against the parent would.
+	return d.parent.Lookup(ctx, origName)
+}
+
+// hasByContent reports whether d's parent has anything to show under
+// byContentDirName, so Lookup can give a plain ENOENT for it before
+// it's ever been seeded rather than an empty directory.
+func (n *searchResultDir) hasByContent() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.ents) > 0
+}
@@ -0,0 +1,129 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"unicode"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// byLetterDirName is the reserved name of the alphabetical drill-down
+// sibling view under a search result directory: instead of one entry
+// per result, it has one subdirectory per leading letter (A-Z,
+// uppercased) present across the parent's resolved names, plus
+// otherLetterBucketName for anything that doesn't start with one, each
+// listing the names in that bucket. Like byTagTreeDirName, it's
+// derived entirely from names already resolved by the parent's own
+// ReadDirAll; no further query is needed.
+const byLetterDirName = "byLetter"
+
+// otherLetterBucketName is byLetterDir's bucket for a name whose first
+// rune isn't a letter (a digit, punctuation, or anything else
+// unicode.IsLetter rejects), the same way untaggedTagBucketName buckets
+// byTagTreeDir's own outliers.
+const otherLetterBucketName = "#"
+
+// letterBucketFor returns name's byLetterDir bucket: its first rune,
+// uppercased, if that rune is a letter; otherLetterBucketName
+// otherwise. An empty name (never produced by stableName in practice)
+// also falls under otherLetterBucketName.
+func letterBucketFor(name string) string {
+	for _, r := range name {
+		if !unicode.IsLetter(r) {
+			return otherLetterBucketName
+		}
+		return string(unicode.ToUpper(r))
+	}
+	return otherLetterBucketName
+}
+
+// letterBuckets groups n.ents by letterBucketFor. It must be called
+// with n.mu held.
+func (n *searchResultDir) letterBuckets() map[string][]string {
+	buckets := make(map[string][]string)
+	for name := range n.ents {
+		bucket := letterBucketFor(name)
+		buckets[bucket] = append(buckets[bucket], name)
+	}
+	return buckets
+}
+
+// hasByLetter reports whether n's last ReadDirAll has anything for
+// byLetterDirName to show, so Lookup can give a plain ENOENT for it
+// before the parent's ever been seeded rather than an always-empty,
+// always-present directory.
+func (n *searchResultDir) hasByLetter() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.ents) > 0
+}
+
+// byLetterDir lists the leading-letter buckets present across its
+// parent's current results, one subdirectory per letter (plus
+// otherLetterBucketName), each resolving to a bucketDir. An empty
+// bucket never appears, since letterBuckets only ever returns buckets
+// it actually put a name in.
+type byLetterDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*byLetterDir)(nil)
+	_ fs.HandleReadDirAller = (*byLetterDir)(nil)
+	_ fs.NodeStringLookuper = (*byLetterDir)(nil)
+)
+
+func (d *byLetterDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *byLetterDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	buckets := d.parent.letterBuckets()
+	names := make([]string, 0, len(buckets))
+	for letter := range buckets {
+		names = append(names, letter)
+	}
+	return dirents(names, fuse.DT_Dir), nil
+}
+
+func (d *byLetterDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	members, ok := d.parent.letterBuckets()[name]
+	d.parent.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return &bucketDir{parent: d.parent, names: members}, nil
+}
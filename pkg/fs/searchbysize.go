@@ -0,0 +1,149 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// bySizeDirName is the reserved name of the file-size drill-down
+// sibling view under a search result directory: instead of one entry
+// per result, it has one subdirectory per size range present across
+// the parent's resolved entries (see sizeBucketFor), plus
+// unknownSizeBucketName for anything with no known size, each listing
+// the names in that range. Like byLetterDirName, it's derived entirely
+// from metadata already resolved by the parent's own ReadDirAll; no
+// further query is needed.
+const bySizeDirName = "bySize"
+
+// unknownSizeBucketName is bySizeDir's bucket for an entry with no
+// known file size: a directory, symlink, or set, none of which have a
+// File.Size to bucket by.
+const unknownSizeBucketName = "_unknown"
+
+// defaultSizeBucketBoundariesMB is used in place of a nil or empty
+// CamliFileSystem.SizeBucketBoundariesMB.
+var defaultSizeBucketBoundariesMB = []int64{1, 10, 100}
+
+// effectiveSizeBucketBoundariesMB reports the boundaries fs actually
+// buckets by.
+func (fs *CamliFileSystem) effectiveSizeBucketBoundariesMB() []int64 {
+	if len(fs.SizeBucketBoundariesMB) > 0 {
+		return fs.SizeBucketBoundariesMB
+	}
+	return defaultSizeBucketBoundariesMB
+}
+
+// sizeBucketFor returns size's bucket name among boundariesMB (each in
+// megabytes, ascending), e.g. "<1MB", "1-10MB", or ">100MB".
+func sizeBucketFor(size int64, boundariesMB []int64) string {
+	const mb = 1 << 20
+	for i, boundary := range boundariesMB {
+		if size < boundary*mb {
+			if i == 0 {
+				return fmt.Sprintf("<%dMB", boundary)
+			}
+			return fmt.Sprintf("%d-%dMB", boundariesMB[i-1], boundary)
+		}
+	}
+	return fmt.Sprintf(">%dMB", boundariesMB[len(boundariesMB)-1])
+}
+
+// sizeBuckets groups n.lastNames' plain files by sizeBucketFor, and
+// everything else (a set, symlink, or anything else without a
+// File.Size) under unknownSizeBucketName. It must be called with n.mu
+// held.
+func (n *searchResultDir) sizeBuckets() map[string][]string {
+	boundariesMB := n.fs.effectiveSizeBucketBoundariesMB()
+	buckets := make(map[string][]string)
+	for _, name := range n.lastNames {
+		db := n.ents[name]
+		bucket := unknownSizeBucketName
+		if db != nil && db.File != nil {
+			bucket = sizeBucketFor(db.File.Size, boundariesMB)
+		}
+		buckets[bucket] = append(buckets[bucket], name)
+	}
+	return buckets
+}
+
+// hasBySize reports whether n's last ReadDirAll has anything for
+// bySizeDirName to show, so Lookup can give a plain ENOENT for it
+// before the parent's ever been seeded rather than an always-empty,
+// always-present directory.
+func (n *searchResultDir) hasBySize() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.ents) > 0
+}
+
+// bySizeDir lists the size-range buckets present across its parent's
+// current results, one subdirectory per range (plus
+// unknownSizeBucketName), each resolving to a bucketDir. An empty
+// bucket never appears, since sizeBuckets only ever returns buckets it
+// actually put a name in.
+type bySizeDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*bySizeDir)(nil)
+	_ fs.HandleReadDirAller = (*bySizeDir)(nil)
+	_ fs.NodeStringLookuper = (*bySizeDir)(nil)
+)
+
+func (d *bySizeDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *bySizeDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	buckets := d.parent.sizeBuckets()
+	names := make([]string, 0, len(buckets))
+	for bucket := range buckets {
+		names = append(names, bucket)
+	}
+	return dirents(names, fuse.DT_Dir), nil
+}
+
+func (d *bySizeDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	members, ok := d.parent.sizeBuckets()[name]
+	d.parent.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return &bucketDir{parent: d.parent, names: members}, nil
+}
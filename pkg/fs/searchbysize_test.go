@@ -0,0 +1,76 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"reflect"
+	"testing"
+
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/types/camtypes"
+)
+
+// TestSizeBucketFor checks the default boundaries' bucket names at
+// and around each boundary.
+func TestSizeBucketFor(t *testing.T) {
+	const mb = 1 << 20
+	boundaries := []int64{1, 10, 100}
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "<1MB"},
+		{mb - 1, "<1MB"},
+		{mb, "1-10MB"},
+		{10 * mb, "10-100MB"},
+		{100*mb - 1, "10-100MB"},
+		{100 * mb, ">100MB"},
+		{1000 * mb, ">100MB"},
+	}
+	for _, tt := range tests {
+		if got := sizeBucketFor(tt.size, boundaries); got != tt.want {
+			t.Errorf("sizeBucketFor(%d, %v) = %q; want %q", tt.size, boundaries, got, tt.want)
+		}
+	}
+}
+
+// TestSizeBuckets checks that sizeBuckets groups plain files by size
+// range and puts anything without a File.Size (here, a symlink entry
+// with a nil DescribedBlob.File) under unknownSizeBucketName.
+func TestSizeBuckets(t *testing.T) {
+	const mb = 1 << 20
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{},
+		lastNames: []string{"small.txt", "big.bin", "link"},
+		ents: map[string]*search.DescribedBlob{
+			"small.txt": {File: &camtypes.FileInfo{Size: 100}},
+			"big.bin":   {File: &camtypes.FileInfo{Size: 50 * mb}},
+			"link":      {},
+		},
+	}
+	got := n.sizeBuckets()
+	want := map[string][]string{
+		"<1MB":     {"small.txt"},
+		"10-100MB": {"big.bin"},
+		unknownSizeBucketName: {"link"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sizeBuckets() = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,30 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// EffectiveSearchCacheTTL reports the TTL fs actually applies to its
+// searchResultDirs, for tooling that wants to confirm a mount's
+// configured value took effect: fs.SearchCacheTTL, clamped to fs's
+// floor (see clampToMinSearchCacheTTL and MinSearchCacheTTL) unless
+// AllowSubMinimumSearchCacheTTL opts fs out of it.
+func (fs *CamliFileSystem) EffectiveSearchCacheTTL() time.Duration {
+	return clampToMinSearchCacheTTL(fs, fs.SearchCacheTTL)
+}
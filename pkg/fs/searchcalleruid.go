@@ -0,0 +1,53 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "bazil.org/fuse"
+
+// callerOwner resolves uid to the owner CallerUIDOwnerMap maps it to,
+// or to DefaultCallerOwner if uid has no entry. ok is false only when
+// uid is unmapped and DefaultCallerOwner is empty, i.e. the caller is
+// denied. It must only be called when fs.CallerUIDOwnerMap is non-nil.
+func (fsys *CamliFileSystem) callerOwner(uid uint32) (owner string, ok bool) {
+	if owner, found := fsys.CallerUIDOwnerMap[uid]; found {
+		return owner, true
+	}
+	if fsys.DefaultCallerOwner != "" {
+		return fsys.DefaultCallerOwner, true
+	}
+	return "", false
+}
+
+// checkCallerOwner enforces CallerUIDOwnerMap (see its doc comment)
+// against n for a request from uid, returning fuse.EPERM if the
+// caller should be denied. It's a no-op when CallerUIDOwnerMap is
+// nil.
+func (n *searchResultDir) checkCallerOwner(uid uint32) error {
+	if n.fs.CallerUIDOwnerMap == nil {
+		return nil
+	}
+	owner, ok := n.fs.callerOwner(uid)
+	if !ok {
+		return fuse.EPERM
+	}
+	if scope := n.effectiveOwner(); scope != "" && scope != owner {
+		return fuse.EPERM
+	}
+	return nil
+}
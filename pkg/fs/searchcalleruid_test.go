@@ -0,0 +1,68 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestCheckCallerOwnerDisabled checks that a nil CallerUIDOwnerMap
+// never denies a request.
+func TestCheckCallerOwnerDisabled(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	if err := n.checkCallerOwner(1000); err != nil {
+		t.Errorf("checkCallerOwner() = %v; want nil", err)
+	}
+}
+
+// TestCheckCallerOwnerMapped checks that a mapped uid is let through
+// when it matches n's own owner scope, and denied when it doesn't.
+func TestCheckCallerOwnerMapped(t *testing.T) {
+	n := &searchResultDir{
+		fs: &CamliFileSystem{
+			Owner:             "sha224-aaa",
+			CallerUIDOwnerMap: map[uint32]string{1000: "sha224-aaa", 1001: "sha224-bbb"},
+		},
+	}
+	if err := n.checkCallerOwner(1000); err != nil {
+		t.Errorf("checkCallerOwner(1000) = %v; want nil", err)
+	}
+	if err := n.checkCallerOwner(1001); err != fuse.EPERM {
+		t.Errorf("checkCallerOwner(1001) = %v; want fuse.EPERM", err)
+	}
+}
+
+// TestCheckCallerOwnerUnmappedDeniesByDefault checks that an unmapped
+// uid is denied when DefaultCallerOwner is unset, and let through with
+// the default owner once it's set.
+func TestCheckCallerOwnerUnmappedDeniesByDefault(t *testing.T) {
+	n := &searchResultDir{
+		fs: &CamliFileSystem{CallerUIDOwnerMap: map[uint32]string{1000: "sha224-aaa"}},
+	}
+	if err := n.checkCallerOwner(9999); err != fuse.EPERM {
+		t.Errorf("checkCallerOwner(9999) = %v; want fuse.EPERM", err)
+	}
+
+	n.fs.DefaultCallerOwner = "sha224-shared"
+	if err := n.checkCallerOwner(9999); err != nil {
+		t.Errorf("checkCallerOwner(9999) with DefaultCallerOwner set = %v; want nil", err)
+	}
+}
@@ -0,0 +1,188 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// camlifsFileName is a hidden, per-searchResultDir control file: a
+// write replaces n's limit/sort/fields/ttl overrides for the rest of
+// the mount's session (held only in memory, never persisted to the
+// server), the same overrides a "#limit=&sort=&ttl=" Lookup suffix
+// sets at construction time (see searchDirOptions), plus a "fields"
+// list applied to the describe rule (see effectiveDescribeRules). It's
+// for tuning an already-mounted directory without having to unmount
+// and re-Lookup it with a different suffix. Like refreshFileName, it's
+// always resolvable via Lookup but, not being a search result itself,
+// only listed when ShowDotfiles is set (see controlFileNames).
+const camlifsFileName = ".camlifs"
+
+// camlifsConfig is camlifsFileName's JSON shape, read and written.
+// Every field is optional; an absent field leaves that setting
+// unchanged rather than clearing it; see applyCamlifsConfig.
+type camlifsConfig struct {
+	Limit  *int     `json:"limit,omitempty"`
+	Sort   string   `json:"sort,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+	TTL    string   `json:"ttl,omitempty"`
+}
+
+// toOptions validates cfg's Limit/Sort/TTL and turns them into a
+// searchDirOptions, the same validation splitSearchOptions applies to
+// a Lookup name's own "limit=&sort=&ttl=" suffix. cfg.Fields isn't
+// part of searchDirOptions (it has no Lookup-suffix equivalent) and is
+// applied separately by the caller.
+func (cfg camlifsConfig) toOptions() (searchDirOptions, error) {
+	var opts searchDirOptions
+	if cfg.Limit != nil {
+		if *cfg.Limit <= 0 {
+			return searchDirOptions{}, fmt.Errorf("invalid limit %d", *cfg.Limit)
+		}
+		opts.limit = cfg.Limit
+	}
+	if cfg.Sort != "" {
+		sortBy, ok := sortKeys[cfg.Sort]
+		if !ok {
+			return searchDirOptions{}, fmt.Errorf("invalid sort %q", cfg.Sort)
+		}
+		opts.sort = &sortBy
+	}
+	if cfg.TTL != "" {
+		ttl, err := time.ParseDuration(cfg.TTL)
+		if err != nil || ttl < 0 {
+			return searchDirOptions{}, fmt.Errorf("invalid ttl %q", cfg.TTL)
+		}
+		opts.ttl = &ttl
+	}
+	return opts, nil
+}
+
+// sortKeyName reverses sortKeys, for camlifsContents to report the
+// currently effective sort the same way a camlifsConfig would set it.
+func sortKeyName(by SearchSortBy) string {
+	for key, val := range sortKeys {
+		if val == by {
+			return key
+		}
+	}
+	return ""
+}
+
+// applyCamlifsConfig parses content as a camlifsConfig and applies it
+// to n, returning an error (for Write to turn into fuse.EINVAL) if
+// content isn't valid JSON or sets an invalid limit/sort/ttl. It
+// doesn't itself trigger a re-seed: the new settings take effect on
+// n's next ReadDirAll, the same as a fresh Lookup with different
+// options would.
+func (n *searchResultDir) applyCamlifsConfig(content []byte) error {
+	var cfg camlifsConfig
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return err
+	}
+	opts, err := cfg.toOptions()
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	opts.applyTo(n)
+	if cfg.Fields != nil {
+		n.describeAttrsOverride = cfg.Fields
+	}
+	n.mu.Unlock()
+	return nil
+}
+
+// camlifsContents renders camlifsFileName's read content: the
+// settings n is currently actually running with, as the same JSON
+// shape a write would set them with, so reading it back after a write
+// confirms what took effect.
+func (n *searchResultDir) camlifsContents() []byte {
+	n.mu.Lock()
+	var cfg camlifsConfig
+	if n.resultCapOverride != nil {
+		limit := *n.resultCapOverride
+		cfg.Limit = &limit
+	}
+	if n.sortOverride != nil {
+		cfg.Sort = sortKeyName(*n.sortOverride)
+	}
+	if n.ttlOverride != nil {
+		cfg.TTL = n.ttlOverride.String()
+	}
+	cfg.Fields = append([]string(nil), n.describeAttrsOverride...)
+	n.mu.Unlock()
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return []byte("{}\n")
+	}
+	return append(b, '\n')
+}
+
+// camlifsFile is camlifsFileName's Node and Handle: reading renders
+// camlifsContents, writing parses and applies a new camlifsConfig in
+// full, the way "echo '{...}' > .camlifs" writes it in a single call.
+type camlifsFile struct {
+	dir *searchResultDir
+}
+
+var (
+	_ fs.Node         = camlifsFile{}
+	_ fs.HandleReader = camlifsFile{}
+	_ fs.HandleWriter = camlifsFile{}
+)
+
+func (f camlifsFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Valid = f.dir.fs.effectiveAttrValidity()
+	a.Size = uint64(len(f.dir.camlifsContents()))
+	return nil
+}
+
+func (f camlifsFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := f.dir.camlifsContents()
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = content[req.Offset:end]
+	return nil
+}
+
+func (f camlifsFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := f.dir.fs.checkWritable(); err != nil {
+		return err
+	}
+	if err := f.dir.applyCamlifsConfig(req.Data); err != nil {
+		Logger.Printf("fs.searchResultDir: %q write for '%s': %v", camlifsFileName, f.dir.searchExp, err)
+		return fuse.Errno(syscall.EINVAL)
+	}
+	resp.Size = len(req.Data)
+	return nil
+}
@@ -0,0 +1,217 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+	"perkeep.org/pkg/types"
+)
+
+// camliPathAttrPrefix is the permanode attr prefix a "named path"
+// child is recorded under: "camliPath:foo" pointing at the blobref of
+// foo's own permanode, the same convention the web UI's path browser
+// uses to let a permanode act as a directory of hand-picked names
+// rather than only ever being reached by search or camliMember.
+const camliPathAttrPrefix = "camliPath:"
+
+// hasCamliPathAttrs reports whether pm's permanode carries any
+// camliPathAttrPrefix attr. pm's Permanode.Attr map already has every
+// attr the permanode carries, the same as tagsFor's "tag" and
+// locationFor's "latitude"/"longitude"; no extra describe rule is
+// needed to see these.
+func hasCamliPathAttrs(pm *search.DescribedBlob) bool {
+	if pm == nil || pm.Permanode == nil {
+		return false
+	}
+	for k := range pm.Permanode.Attr {
+		if strings.HasPrefix(k, camliPathAttrPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// camliPathDir lists a permanode's camliPath:* attrs (see
+// hasCamliPathAttrs) as named children, each resolved individually via
+// dir.ResolveMember the same way searchMemberDir resolves a set's
+// camliMember values, letting CamliFileSystem.FollowCamliPath surface
+// Perkeep's path model (as opposed to its file/dir content model)
+// through the mount.
+type camliPathDir struct {
+	fs        *CamliFileSystem
+	at        *types.Time3339
+	permanode blob.Ref
+	pnodeMeta *search.DescribedBlob
+	// ancestors holds every permanode already on the path from the
+	// mount's search result down to this directory, this one
+	// included. A named child whose own permanode is already in here
+	// would recurse forever, so it's skipped instead (see resolve),
+	// the same cycle guard searchMemberDir uses for camliMember.
+	ancestors map[blob.Ref]bool
+
+	mu       sync.Mutex
+	resolved map[string]dir.Entry // name (after camliPathAttrPrefix) to resolved child entry, filled in lazily by resolve
+}
+
+var (
+	_ fs.Node               = (*camliPathDir)(nil)
+	_ fs.HandleReadDirAller = (*camliPathDir)(nil)
+	_ fs.NodeStringLookuper = (*camliPathDir)(nil)
+)
+
+func (n *camliPathDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	if n.permanode.Valid() {
+		a.Inode = inodeTableFor(n.fs).inodeFor(n.permanode)
+	}
+	return nil
+}
+
+// resolve describes every camliPath:* target not already on
+// n.ancestors (breaking cycles) and caches the result in n.resolved,
+// resolving only once per camliPathDir instance.
+func (n *camliPathDir) resolve(ctx context.Context) (map[string]dir.Entry, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.resolved != nil {
+		return n.resolved, nil
+	}
+
+	resolved := make(map[string]dir.Entry)
+	if n.pnodeMeta != nil && n.pnodeMeta.Permanode != nil {
+		for attr := range n.pnodeMeta.Permanode.Attr {
+			name := strings.TrimPrefix(attr, camliPathAttrPrefix)
+			if name == attr || name == "" {
+				continue // not a camliPath:* attr, or no name past the prefix
+			}
+			target, ok := blob.Parse(n.pnodeMeta.Permanode.Attr.Get(attr))
+			if !ok {
+				continue
+			}
+			if n.ancestors[target] {
+				Logger.Printf("fs.camliPathDir: skipping %v (%q) under %v: would form a cycle", target, name, n.permanode)
+				continue
+			}
+			e, ok, err := dir.ResolveMember(ctx, n.fs.client, target, n.at)
+			if err != nil {
+				Logger.Printf("fs.camliPathDir: resolving %q (%v): %v", name, target, err)
+				return nil, fuse.EIO
+			}
+			if !ok {
+				continue
+			}
+			resolved[name] = e
+		}
+	}
+	n.resolved = resolved
+	return resolved, nil
+}
+
+func (n *camliPathDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	resolved, err := n.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(resolved))
+	refs := make(map[string]blob.Ref, len(resolved))
+	kinds := make(map[string]fuse.DirentType, len(resolved))
+	for name, e := range resolved {
+		names = append(names, name)
+		refs[name] = e.Permanode
+		kinds[name] = n.memberDirentKind(e)
+	}
+	return direntsWithInode(n.fs, names, refs, kinds), nil
+}
+
+// memberDirentKind reports the fuse.DirentType Lookup resolves e to:
+// fuse.DT_Dir for a set or a followed camliPath target (see
+// dir.Entry.IsSet and CamliFileSystem.FollowCamliPath), fuse.DT_File
+// for everything else, the same as Lookup's own checks below.
+func (n *camliPathDir) memberDirentKind(e dir.Entry) fuse.DirentType {
+	if e.IsSet {
+		return fuse.DT_Dir
+	}
+	if n.fs.FollowCamliPath && hasCamliPathAttrs(e.PNodeMeta) {
+		return fuse.DT_Dir
+	}
+	return fuse.DT_File
+}
+
+func (n *camliPathDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	resolved, err := n.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := resolved[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	childAncestors := make(map[blob.Ref]bool, len(n.ancestors)+1)
+	for ref := range n.ancestors {
+		childAncestors[ref] = true
+	}
+	childAncestors[e.Permanode] = true
+	if e.IsSet {
+		return &searchMemberDir{
+			fs:               n.fs,
+			at:               n.at,
+			permanode:        e.Permanode,
+			pnodeMeta:        e.PNodeMeta,
+			members:          e.Members,
+			membersTruncated: e.MembersTruncated,
+			ancestors:        childAncestors,
+		}, nil
+	}
+	if n.fs.FollowCamliPath && hasCamliPathAttrs(e.PNodeMeta) {
+		return &camliPathDir{
+			fs:        n.fs,
+			at:        n.at,
+			permanode: e.Permanode,
+			pnodeMeta: e.PNodeMeta,
+			ancestors: childAncestors,
+		}, nil
+	}
+	nod := &searchResultFile{
+		node: node{
+			fs:           n.fs,
+			blobref:      e.Blob.BlobRef,
+			pnodeModTime: e.ModTime,
+		},
+		readOnly:  n.at != nil,
+		permanode: e.Permanode,
+		pnodeMeta: e.PNodeMeta,
+		imageMeta: e.Image,
+	}
+	if e.Blob.File != nil {
+		nod.mimeType = e.Blob.File.MIMEType
+	}
+	return nod, nil
+}
@@ -0,0 +1,150 @@
+//go:build linux || darwin
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "sync"
+
+// ServerCapabilities records which of the connected server's advanced
+// features n's CamliFileSystem has actually confirmed, so a
+// searchResultDir can pick the optimal code path instead of always
+// guessing server-side and paying for a failed attempt. Every field's
+// zero value is "not known to be supported", which is exactly the
+// fallback this mount already used before any of these fields
+// existed, so an old or unrecognized server behaves exactly as it
+// always did.
+type ServerCapabilities struct {
+	// Sort is whether the server honors the sort.SortType a
+	// search.SearchQuery asks for (see serverSortFor). Learned the
+	// first time any searchResultDir's doReaddir either succeeds with
+	// a server-requested sort or hits sortUnsupported, and cached for
+	// every searchResultDir sharing this CamliFileSystem afterwards,
+	// instead of each one separately discovering it firsthand.
+	Sort bool
+
+	// ChangeNotify is whether the server's client supports
+	// Subscriber, i.e. whether searchWatch.go's searchWatcher could
+	// subscribe to index changes instead of falling back to
+	// SearchCacheTTL polling. Probed once, the same as Sort, but
+	// cheaply: it's a type assertion against n.fs.client, not a round
+	// trip, so it's resolved the moment it's first asked for rather
+	// than waiting on a failed query.
+	ChangeNotify bool
+
+	// SinceQuery is whether the server's client supports
+	// SinceQuerier, i.e. whether doReaddir's tryApplySince could
+	// refresh a searchResultDir with a conditional since-token query
+	// instead of a full one. Probed once, the same cheap way as
+	// ChangeNotify.
+	SinceQuery bool
+}
+
+// capsState is one CamliFileSystem's ServerCapabilities, plus the
+// bookkeeping capabilitiesFor needs to probe ChangeNotify exactly
+// once and to log a capability the first time anything learns it.
+type capsState struct {
+	mu        sync.Mutex
+	probed    bool
+	sortKnown bool
+	logged    map[string]bool
+	caps      ServerCapabilities
+}
+
+// capsMu and capsByFS hold each CamliFileSystem's capsState, keyed by
+// pointer identity the same way searchblobcache.go's blobCaches and
+// searchWatch.go's watchers are.
+var (
+	capsMu   sync.Mutex
+	capsByFS = map[*CamliFileSystem]*capsState{}
+)
+
+// stateFor returns fsys's capsState, creating it on first use.
+func stateFor(fsys *CamliFileSystem) *capsState {
+	capsMu.Lock()
+	defer capsMu.Unlock()
+	st, ok := capsByFS[fsys]
+	if !ok {
+		st = &capsState{logged: make(map[string]bool)}
+		capsByFS[fsys] = st
+	}
+	return st
+}
+
+// capabilitiesFor returns fsys's currently known ServerCapabilities,
+// probing ChangeNotify (cheap; no round trip) the first time it's
+// called for fsys. Sort is learned lazily instead, by doReaddir
+// calling recordSortCapability once it actually knows, since
+// confirming it requires a real query.
+func capabilitiesFor(fsys *CamliFileSystem) ServerCapabilities {
+	st := stateFor(fsys)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if !st.probed {
+		st.probed = true
+		_, st.caps.ChangeNotify = fsys.client.(Subscriber)
+		st.logCapability("index change subscriptions", st.caps.ChangeNotify)
+		_, st.caps.SinceQuery = fsys.client.(SinceQuerier)
+		st.logCapability("since-token conditional queries", st.caps.SinceQuery)
+	}
+	return st.caps
+}
+
+// recordSortCapability latches whether fsys's server honors
+// server-side sort, the first time any searchResultDir's doReaddir
+// finds out firsthand (either by succeeding with a server-requested
+// sort, or by hitting sortUnsupported). Later searchResultDirs reuse
+// the cached answer instead of repeating the same failed attempt.
+func recordSortCapability(fsys *CamliFileSystem, ok bool) {
+	st := stateFor(fsys)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.sortKnown && st.caps.Sort == ok {
+		return
+	}
+	st.sortKnown = true
+	st.caps.Sort = ok
+	st.logCapability("server-side sort", ok)
+}
+
+// sortKnownUnsupported reports whether fsys's server has already
+// confirmed it doesn't honor server-side sort, so doReaddir can skip
+// straight to the unsorted query instead of repeating a doomed
+// attempt every time a new searchResultDir is seeded.
+func sortKnownUnsupported(fsys *CamliFileSystem) bool {
+	st := stateFor(fsys)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.sortKnown && !st.caps.Sort
+}
+
+// logCapability logs what was learned about name, once per
+// (name, fsys) pair, so a mount's log shows each capability exactly
+// once rather than on every searchResultDir that happens to ask.
+// Callers must hold st.mu.
+func (st *capsState) logCapability(name string, ok bool) {
+	if st.logged[name] {
+		return
+	}
+	st.logged[name] = true
+	if ok {
+		Logger.Printf("fs.search: server capability detected: %s", name)
+	} else {
+		Logger.Printf("fs.search: server capability not supported, falling back: %s", name)
+	}
+}
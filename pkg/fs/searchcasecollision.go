@@ -0,0 +1,41 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// CaseCollisionPolicy selects how stableName (see
+// CamliFileSystem.CaseCollisionPolicy, and searchResultDir.caseFoldName)
+// handles two entries whose display names differ only in case, e.g.
+// "photo.jpg" and "Photo.jpg".
+type CaseCollisionPolicy int
+
+const (
+	// CaseCollisionPolicyKeepBoth lists each entry under its own
+	// exact-case name, even when two of them differ only in case. It's
+	// the zero value, for a case-sensitive mount where "photo.jpg" and
+	// "Photo.jpg" are legitimately distinct files and should both be
+	// visible as given.
+	CaseCollisionPolicyKeepBoth CaseCollisionPolicy = iota
+	// CaseCollisionPolicySuffix suffixes every name but the first that
+	// claims a given case fold, the same " (2)", " (3)", ... convention
+	// CollisionStrategyNumericSuffix already uses for an exact-name
+	// collision, so a tool running on a case-insensitive host (which
+	// would otherwise silently merge the two into a single entry)
+	// still sees both.
+	CaseCollisionPolicySuffix
+)
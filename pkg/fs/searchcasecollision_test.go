@@ -0,0 +1,108 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// caseVariantEntries returns two distinct permanodes whose own names
+// differ only in case, plus a third with an unrelated name, so a test
+// can confirm the third is never touched by CaseCollisionPolicy.
+func caseVariantEntries() []dir.Entry {
+	return []dir.Entry{
+		{Name: "photo.jpg", Permanode: blob.RefFromString("one")},
+		{Name: "Photo.jpg", Permanode: blob.RefFromString("two")},
+		{Name: "other.jpg", Permanode: blob.RefFromString("three")},
+	}
+}
+
+// TestStableNameCaseCollisionKeepBoth checks the default policy: both
+// case-variant names are listed exactly as given.
+func TestStableNameCaseCollisionKeepBoth(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{CaseCollisionPolicy: CaseCollisionPolicyKeepBoth}}
+	var errLog []string
+	entries := caseVariantEntries()
+	var names []string
+	for _, de := range entries {
+		name, subdir := n.stableName(de, &errLog)
+		if subdir != "" {
+			t.Errorf("stableName(%v) subdir = %q; want empty", de.Permanode, subdir)
+		}
+		names = append(names, name)
+	}
+	want := []string{"photo.jpg", "Photo.jpg", "other.jpg"}
+	for i, name := range names {
+		if name != want[i] {
+			t.Errorf("names[%d] = %q; want %q", i, name, want[i])
+		}
+	}
+}
+
+// TestStableNameCaseCollisionSuffix checks that
+// CaseCollisionPolicySuffix leaves the first case-variant name alone
+// and suffixes the second, without touching the unrelated third entry.
+func TestStableNameCaseCollisionSuffix(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{CaseCollisionPolicy: CaseCollisionPolicySuffix}}
+	var errLog []string
+	entries := caseVariantEntries()
+	var names []string
+	for _, de := range entries {
+		name, _ := n.stableName(de, &errLog)
+		names = append(names, name)
+	}
+	if names[0] != "photo.jpg" {
+		t.Errorf("names[0] = %q; want %q (unaltered)", names[0], "photo.jpg")
+	}
+	if names[1] != "Photo (2).jpg" {
+		t.Errorf("names[1] = %q; want %q", names[1], "Photo (2).jpg")
+	}
+	if names[2] != "other.jpg" {
+		t.Errorf("names[2] = %q; want %q (unaltered)", names[2], "other.jpg")
+	}
+	if len(errLog) == 0 {
+		t.Errorf("errLog is empty; want a case-only collision entry logged")
+	}
+}
+
+// TestStableNameCaseCollisionPinnedAcrossRefreshes checks that a
+// second stableName call for the same permanodes reuses each one's
+// earlier decision, the same pinning TestStableNameCollisionPinnedAcrossRefreshes
+// checks for CollisionStrategy.
+func TestStableNameCaseCollisionPinnedAcrossRefreshes(t *testing.T) {
+	for _, policy := range []CaseCollisionPolicy{CaseCollisionPolicyKeepBoth, CaseCollisionPolicySuffix} {
+		n := &searchResultDir{fs: &CamliFileSystem{CaseCollisionPolicy: policy}}
+		entries := caseVariantEntries()
+		var errLog []string
+		var firstNames []string
+		for _, de := range entries {
+			name, _ := n.stableName(de, &errLog)
+			firstNames = append(firstNames, name)
+		}
+		for i, de := range entries {
+			name, _ := n.stableName(de, &errLog)
+			if name != firstNames[i] {
+				t.Errorf("policy %v: entry %d re-resolved to %q; want the pinned %q", policy, i, name, firstNames[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestLookupCaseInsensitiveExactMatch checks that an exact-case
+// candidate among lastNames is returned immediately, without
+// considering it ambiguous against other candidates that only match
+// case-insensitively.
+func TestLookupCaseInsensitiveExactMatch(t *testing.T) {
+	n := &searchResultDir{lastNames: []string{"Photo.JPG", "photo.jpg"}}
+	got, ok := n.lookupCaseInsensitive("photo.jpg")
+	if !ok || got != "photo.jpg" {
+		t.Errorf("lookupCaseInsensitive() = %q, %v; want %q, true", got, ok, "photo.jpg")
+	}
+}
+
+// TestLookupCaseInsensitiveFoldedFallback checks that a case-folded
+// match is returned when no exact-case candidate exists.
+func TestLookupCaseInsensitiveFoldedFallback(t *testing.T) {
+	n := &searchResultDir{lastNames: []string{"Photo.JPG"}}
+	got, ok := n.lookupCaseInsensitive("photo.jpg")
+	if !ok || got != "Photo.JPG" {
+		t.Errorf("lookupCaseInsensitive() = %q, %v; want %q, true", got, ok, "Photo.JPG")
+	}
+}
+
+// TestLookupCaseInsensitiveAmbiguous checks that when two distinctly
+// cased names fold to the same lookup name, the lexicographically
+// first is preferred rather than an arbitrary one.
+func TestLookupCaseInsensitiveAmbiguous(t *testing.T) {
+	n := &searchResultDir{lastNames: []string{"PHOTO.JPG", "Photo.jpg"}}
+	got, ok := n.lookupCaseInsensitive("photo.jpg")
+	if !ok || got != "PHOTO.JPG" {
+		t.Errorf("lookupCaseInsensitive() = %q, %v; want %q, true", got, ok, "PHOTO.JPG")
+	}
+}
+
+// TestLookupCaseInsensitiveNoMatch checks that a name with no
+// case-insensitive match among lastNames reports ok=false.
+func TestLookupCaseInsensitiveNoMatch(t *testing.T) {
+	n := &searchResultDir{lastNames: []string{"other.jpg"}}
+	if _, ok := n.lookupCaseInsensitive("photo.jpg"); ok {
+		t.Errorf("lookupCaseInsensitive() ok = true; want false")
+	}
+}
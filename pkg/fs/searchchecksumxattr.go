@@ -0,0 +1,37 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// checksumDigest returns n's content digest: its schema's single
+// content part's own blobref when n.schemaMeta describes exactly one
+// (the common case for anything not split across multiple blobs),
+// since that blobref already is the raw content's hash. For a
+// multi-part file, no single blob covers the whole content, so this
+// falls back to n.blobref, the schema-level digest, rather than
+// claiming a content hash that isn't one. ok is false if n.schemaMeta
+// hasn't been resolved.
+func (n *searchResultFile) checksumDigest() (digest string, ok bool) {
+	if n.schemaMeta == nil {
+		return "", false
+	}
+	if parts := n.schemaMeta.ByteParts(); len(parts) == 1 && parts[0].BlobRef.Valid() {
+		return parts[0].BlobRef.String(), true
+	}
+	return n.blobref.String(), true
+}
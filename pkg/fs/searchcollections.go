@@ -0,0 +1,92 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"encoding/json"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// collectionsSuffix names the per-entry control file listing the
+// sets/collections (permanodes with this entry's own permanode as a
+// camliMember) an entry belongs to: "photo.jpg.collections". Unlike
+// sidecarSuffix and tagsFileSuffix, resolving it costs an extra query
+// per entry (a reverse camliMember lookup the server has no cheaper
+// way to answer), so it's gated behind CollectionBackrefs rather than
+// always resolvable, and -- unlike progressSuffix and
+// describeJSONSuffix -- never added to ReadDirAll's own listing: a
+// mount that wants it pays for that query only when something
+// actually opens the sidecar, not once per entry on every refresh.
+const collectionsSuffix = ".collections"
+
+// defaultMaxCollectionBackrefs is effectiveMaxCollectionBackrefs'
+// result when CamliFileSystem.MaxCollectionBackrefs isn't set: enough
+// to show every collection a typical item belongs to without an
+// unbounded reverse-lookup query.
+const defaultMaxCollectionBackrefs = 20
+
+// effectiveMaxCollectionBackrefs is n.fs.MaxCollectionBackrefs if
+// set, else defaultMaxCollectionBackrefs.
+func (n *searchResultDir) effectiveMaxCollectionBackrefs() int {
+	if n.fs.MaxCollectionBackrefs > 0 {
+		return n.fs.MaxCollectionBackrefs
+	}
+	return defaultMaxCollectionBackrefs
+}
+
+// collectionBackref is one entry of collectionsSuffix's JSON array.
+type collectionBackref struct {
+	Title   string `json:"title"`
+	BlobRef string `json:"blobref"`
+}
+
+// collectionBackrefsContents issues a "camliMember:<pn>" query,
+// bounded by effectiveMaxCollectionBackrefs, and renders the
+// permanodes it finds (pn's parent collections) as collectionsSuffix's
+// JSON array. An entry in no collections renders as "[]", not an
+// error.
+func (n *searchResultDir) collectionBackrefsContents(ctx context.Context, pn blob.Ref) ([]byte, error) {
+	limit := n.effectiveMaxCollectionBackrefs()
+	res, err := n.fs.queryWithFailover(ctx, n.fs.client, &search.SearchQuery{
+		Expression: "camliMember:" + pn.String(),
+		Limit:      limit,
+		Describe: &search.DescribeRequest{
+			Rules: []*search.DescribeRule{
+				{Attrs: []string{"title"}},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	backrefs := make([]collectionBackref, 0, len(res.Blobs))
+	for _, ri := range res.Blobs {
+		backref := collectionBackref{BlobRef: ri.Blob.String()}
+		if res.Describe != nil && res.Describe.Meta != nil {
+			if meta := res.Describe.Meta.Get(ri.Blob); meta != nil && meta.Permanode != nil {
+				backref.Title = meta.Permanode.Attr.Get("title")
+			}
+		}
+		backrefs = append(backrefs, backref)
+	}
+	return json.MarshalIndent(backrefs, "", "\t")
+}
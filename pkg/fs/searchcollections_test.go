@@ -0,0 +1,35 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestEffectiveMaxCollectionBackrefs checks the zero-value default
+// and that an explicit MaxCollectionBackrefs overrides it.
+func TestEffectiveMaxCollectionBackrefs(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	if got := n.effectiveMaxCollectionBackrefs(); got != defaultMaxCollectionBackrefs {
+		t.Errorf("effectiveMaxCollectionBackrefs() = %d; want %d", got, defaultMaxCollectionBackrefs)
+	}
+
+	n.fs.MaxCollectionBackrefs = 5
+	if got := n.effectiveMaxCollectionBackrefs(); got != 5 {
+		t.Errorf("effectiveMaxCollectionBackrefs() = %d; want 5", got)
+	}
+}
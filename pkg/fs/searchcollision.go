@@ -0,0 +1,113 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// defaultCollisionSuffixLen is resolveDegraded's historical fixed
+// truncation length, kept as CamliFileSystem.CollisionSuffixLen's zero
+// value so a mount that never configured it keeps seeing the same
+// names as before.
+const defaultCollisionSuffixLen = 10
+
+// effectiveCollisionSuffixLen returns fsys.CollisionSuffixLen if set,
+// or defaultCollisionSuffixLen otherwise.
+func (fsys *CamliFileSystem) effectiveCollisionSuffixLen() int {
+	if fsys.CollisionSuffixLen > 0 {
+		return fsys.CollisionSuffixLen
+	}
+	return defaultCollisionSuffixLen
+}
+
+// uniqueCollisionName derives a name for br that isn't already in
+// seen, starting from name prefixed (if non-empty) to a
+// fsys.effectiveCollisionSuffixLen()-long slice of br.String() (its
+// hash algorithm and digest together, not just the digest, so two
+// blobrefs under different algorithms can't be truncated down to the
+// same slice), and growing that slice by the same amount each time
+// it's still not enough, until it covers the whole string. Two
+// different blobrefs can't share a full algorithm+digest string, so
+// this is guaranteed to terminate with a unique name well before then;
+// the final numeric fallback exists only to cover a name that was
+// already taken by something other than a blobref-derived name of
+// this same shape.
+func (fsys *CamliFileSystem) uniqueCollisionName(name string, br blob.Ref, seen map[string]bool) string {
+	stable := br.String()
+	step := fsys.effectiveCollisionSuffixLen()
+	for length := step; ; length += step {
+		suffix := stable
+		if length < len(suffix) {
+			suffix = suffix[:length]
+		}
+		candidate := suffix
+		if name != "" {
+			candidate = name + "." + suffix
+		}
+		if !seen[candidate] {
+			return candidate
+		}
+		if length >= len(stable) {
+			break
+		}
+	}
+	base := stable
+	if name != "" {
+		base = name + "." + stable
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s.%d", base, i)
+		if !seen[candidate] {
+			return candidate
+		}
+	}
+}
+
+// isDirLikeEntry reports whether de would be listed as a subdirectory
+// rather than a searchResultFile: either a set (de.IsSet) or an
+// ordinary permanode whose camliContent resolved to a directory schema
+// blob (de.Blob.Dir != nil).
+func isDirLikeEntry(de dir.Entry) bool {
+	return de.IsSet || (de.Blob != nil && de.Blob.Dir != nil)
+}
+
+// prioritizeDirEntries stably reorders dents so every directory-like
+// entry (see isDirLikeEntry) comes before every other entry, for
+// CollisionDirPriority: doReaddir's per-entry loop calls stableName in
+// this order, so a directory-like entry always claims a contested name
+// before whatever else wanted it. Within each of the two groups,
+// relative order is preserved.
+func prioritizeDirEntries(dents []dir.Entry) []dir.Entry {
+	out := make([]dir.Entry, 0, len(dents))
+	for _, de := range dents {
+		if isDirLikeEntry(de) {
+			out = append(out, de)
+		}
+	}
+	for _, de := range dents {
+		if !isDirLikeEntry(de) {
+			out = append(out, de)
+		}
+	}
+	return out
+}
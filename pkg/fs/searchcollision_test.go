@@ -0,0 +1,126 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"strings"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// TestUniqueCollisionNameGrows is a regression test for
+// uniqueCollisionName: when even its starting suffix length collides,
+// it must extend the suffix rather than give up and reuse a taken
+// name.
+func TestUniqueCollisionNameGrows(t *testing.T) {
+	fsys := &CamliFileSystem{CollisionSuffixLen: 2}
+	br := blob.RefFromString("hello world")
+	stable := br.String()
+
+	seen := map[string]bool{stable[:2]: true, stable[:4]: true}
+	got := fsys.uniqueCollisionName("", br, seen)
+	if seen[got] {
+		t.Fatalf("uniqueCollisionName returned %q, which was already in seen", got)
+	}
+	if got != stable[:6] {
+		t.Errorf("uniqueCollisionName() = %q; want %q", got, stable[:6])
+	}
+}
+
+// TestUniqueCollisionNameNeverReusesName is a broader regression test:
+// for a batch of distinct blobrefs all colliding on the same starting
+// name, "dup.txt", every returned name must be unique.
+func TestUniqueCollisionNameNeverReusesName(t *testing.T) {
+	fsys := &CamliFileSystem{CollisionSuffixLen: 1}
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		br := blob.RefFromString(string(rune('a' + i)))
+		name := fsys.uniqueCollisionName("dup.txt", br, seen)
+		if seen[name] {
+			t.Fatalf("uniqueCollisionName returned duplicate name %q on iteration %d", name, i)
+		}
+		seen[name] = true
+	}
+}
+
+// TestCollisionNamingHashAlgorithmAware checks that uniqueCollisionName,
+// stableCollisionName, and collisionSubdirName all fold a blobref's
+// hash algorithm into the string they truncate, not just its digest,
+// so two blobrefs that happen to share a run of digest characters but
+// were hashed under different algorithms still can't be truncated
+// down to the same name.
+func TestCollisionNamingHashAlgorithmAware(t *testing.T) {
+	sha1Ref := blob.MustParse("sha1-" + strings.Repeat("a", 40))
+	sha224Ref := blob.MustParse("sha224-" + strings.Repeat("a", 56))
+
+	fsys := &CamliFileSystem{CollisionSuffixLen: 4}
+	if got1, got2 := fsys.uniqueCollisionName("", sha1Ref, nil), fsys.uniqueCollisionName("", sha224Ref, nil); got1 == got2 {
+		t.Errorf("uniqueCollisionName collided across hash algorithms: both returned %q", got1)
+	}
+	if got1, got2 := stableCollisionName("base.txt", sha1Ref), stableCollisionName("base.txt", sha224Ref); got1 == got2 {
+		t.Errorf("stableCollisionName collided across hash algorithms: both returned %q", got1)
+	}
+	if got1, got2 := collisionSubdirName(sha1Ref), collisionSubdirName(sha224Ref); got1 == got2 {
+		t.Errorf("collisionSubdirName collided across hash algorithms: both returned %q", got1)
+	}
+}
+
+// TestPrioritizeDirEntriesFileVsDir checks that a file and a set
+// (directory-like entry) sharing the same name are reordered so the
+// directory is processed first, letting it claim the unsuffixed name
+// when CollisionDirPriority is set.
+func TestPrioritizeDirEntriesFileVsDir(t *testing.T) {
+	file := dir.Entry{Name: "shared"}
+	set := dir.Entry{Name: "shared", IsSet: true}
+	other := dir.Entry{Name: "unrelated"}
+
+	got := prioritizeDirEntries([]dir.Entry{file, other, set})
+	want := []dir.Entry{set, file, other}
+	if len(got) != len(want) {
+		t.Fatalf("prioritizeDirEntries returned %d entries; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || got[i].IsSet != want[i].IsSet {
+			t.Errorf("entry %d = %+v; want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestPrioritizeDirEntriesStableOrder checks that entries within each
+// of the two groups (directory-like, then everything else) keep their
+// original relative order.
+func TestPrioritizeDirEntriesStableOrder(t *testing.T) {
+	a := dir.Entry{Name: "a", IsSet: true}
+	b := dir.Entry{Name: "b", IsSet: true}
+	c := dir.Entry{Name: "c"}
+	d := dir.Entry{Name: "d"}
+
+	got := prioritizeDirEntries([]dir.Entry{c, a, d, b})
+	want := []string{"a", "b", "c", "d"}
+	if len(got) != len(want) {
+		t.Fatalf("prioritizeDirEntries returned %d entries; want %d", len(got), len(want))
+	}
+	for i, name := range want {
+		if got[i].Name != name {
+			t.Errorf("entry %d = %q; want %q", i, got[i].Name, name)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+	"perkeep.org/pkg/types"
+)
+
+// CollisionStrategy selects how stableName resolves two different
+// permanodes that want the same display name (see
+// CamliFileSystem.CollisionStrategy). Every strategy guarantees a
+// unique, deterministic-across-refreshes result, pinned the same way
+// stableName's own CollisionStrategyBlobSuffix default already was;
+// see each value's own doc comment for how.
+type CollisionStrategy int
+
+const (
+	// CollisionStrategyBlobSuffix is the historical behavior: the
+	// permanode that loses the name gets it back suffixed with a
+	// short, deterministic slice of its own blobref (see
+	// stableCollisionName). It's the zero value, so a mount that
+	// never configured CollisionStrategy keeps seeing the same names
+	// as before.
+	CollisionStrategyBlobSuffix CollisionStrategy = iota
+	// CollisionStrategyNumericSuffix suffixes the losing permanode's
+	// name " (2)", " (3)", and so on -- the convention most desktop
+	// file managers already use for a copy-and-paste collision --
+	// incrementing past any number already taken by an earlier
+	// collision under the same base name (see numericCollisionName).
+	CollisionStrategyNumericSuffix
+	// CollisionStrategySubdirByBlobRef leaves the losing permanode's
+	// own display name untouched, and instead nests it one level
+	// down inside a subdirectory named from a short, deterministic
+	// slice of its own blobref (see collisionSubdirName and
+	// collisionSubdir). Useful for a tool that keys off a file's base
+	// name and shouldn't see it altered at all, at the cost of that
+	// file no longer being a direct child of the search result
+	// directory.
+	CollisionStrategySubdirByBlobRef
+)
+
+// numericCollisionName derives a display name that won't clash with
+// any name already in taken, by suffixing base's stem with " (2)",
+// " (3)", and so on, skipping any number already spoken for, in the
+// style of a desktop file manager's own copy-and-paste collision
+// handling. Unlike stableCollisionName, the result says nothing about
+// which permanode it names, so taken must hold every name already
+// claimed under CollisionStrategyNumericSuffix for it to stay unique.
+func numericCollisionName(base string, taken map[string]blob.Ref) string {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if _, ok := taken[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+// collisionSubdirNameLen is how many characters of a blob's own
+// algorithm+digest string collisionSubdirName uses, matching
+// stableCollisionName's own suffix length so the two strategies read
+// consistently side by side.
+const collisionSubdirNameLen = 8
+
+// collisionSubdirName derives the subdirectory name
+// CollisionStrategySubdirByBlobRef nests a name-collision loser
+// under: a short, deterministic slice of pn.String(), its hash
+// algorithm and digest together rather than just the digest, so two
+// permanodes hashed under different algorithms can't collide on this
+// name just because their digests happen to share a leading run of
+// characters. Two different blobrefs can't share a full
+// algorithm+digest string, so a name this short colliding with
+// another permanode's own subdirectory name is vanishingly unlikely,
+// the same risk stableCollisionName already accepts for its own
+// fixed-length suffix.
+func collisionSubdirName(pn blob.Ref) string {
+	s := pn.String()
+	if len(s) > collisionSubdirNameLen {
+		s = s[:collisionSubdirNameLen]
+	}
+	return s
+}
+
+// collisionSubdirEntry is what n.collisionSubdirs maps a
+// CollisionStrategySubdirByBlobRef subdirectory's name to: the entry
+// it nests, and the one display name (de.Name as stableName pinned
+// it, unsuffixed) that name resolves to inside it.
+type collisionSubdirEntry struct {
+	name  string
+	entry dir.Entry
+}
+
+// collisionSubdir is the single-entry directory
+// CollisionStrategySubdirByBlobRef nests a name-collision loser
+// under, so its own display name can stay exactly as stableName
+// pinned it instead of being suffixed the way
+// CollisionStrategyBlobSuffix or CollisionStrategyNumericSuffix
+// would. Its sole child is resolved the same way entryNode already
+// resolves any other search result entry, so it lists and opens
+// exactly as it would have as a direct child of n.
+type collisionSubdir struct {
+	fs    *CamliFileSystem
+	at    *types.Time3339
+	name  string
+	entry dir.Entry
+}
+
+var (
+	_ fs.Node               = (*collisionSubdir)(nil)
+	_ fs.HandleReadDirAller = (*collisionSubdir)(nil)
+	_ fs.NodeStringLookuper = (*collisionSubdir)(nil)
+)
+
+func (n *collisionSubdir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	if n.entry.Permanode.Valid() {
+		a.Inode = inodeTableFor(n.fs).inodeFor(n.entry.Permanode)
+	}
+	return nil
+}
+
+func (n *collisionSubdir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	kinds := map[string]fuse.DirentType{n.name: entryDirentKind(n.fs, n.entry)}
+	return direntsWithInode(n.fs, []string{n.name}, map[string]blob.Ref{n.name: n.entry.Permanode}, kinds), nil
+}
+
+func (n *collisionSubdir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name != n.name {
+		return nil, fuse.ENOENT
+	}
+	return entryNode(n.fs, n.entry, n.at), nil
+}
@@ -0,0 +1,174 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// collidingEntries returns a forced-collision dataset: three distinct
+// permanodes that all want the display name "shared.txt".
+func collidingEntries() []dir.Entry {
+	return []dir.Entry{
+		{Name: "shared.txt", Permanode: blob.RefFromString("one")},
+		{Name: "shared.txt", Permanode: blob.RefFromString("two")},
+		{Name: "shared.txt", Permanode: blob.RefFromString("three")},
+	}
+}
+
+// stableNameAll runs stableName for each of entries in order against a
+// fresh searchResultDir configured with strategy, returning the
+// (name, subdir) pair it pinned for each.
+func stableNameAll(strategy CollisionStrategy, entries []dir.Entry) (names, subdirs []string) {
+	n := &searchResultDir{fs: &CamliFileSystem{CollisionStrategy: strategy}}
+	var errLog []string
+	for _, de := range entries {
+		name, subdir := n.stableName(de, &errLog)
+		names = append(names, name)
+		subdirs = append(subdirs, subdir)
+	}
+	return names, subdirs
+}
+
+// TestStableNameBlobSuffixCollision checks the default strategy: the
+// first entry keeps the plain name, and every later entry gets a
+// distinct, blobref-suffixed name.
+func TestStableNameBlobSuffixCollision(t *testing.T) {
+	names, subdirs := stableNameAll(CollisionStrategyBlobSuffix, collidingEntries())
+	if names[0] != "shared.txt" {
+		t.Errorf("names[0] = %q; want %q", names[0], "shared.txt")
+	}
+	seen := map[string]bool{}
+	for i, name := range names {
+		if subdirs[i] != "" {
+			t.Errorf("subdirs[%d] = %q; want empty under CollisionStrategyBlobSuffix", i, subdirs[i])
+		}
+		if seen[name] {
+			t.Fatalf("names[%d] = %q duplicates an earlier name", i, name)
+		}
+		seen[name] = true
+	}
+	if names[1] == "shared.txt" || names[2] == "shared.txt" {
+		t.Errorf("names = %v; only the first entry should keep the plain name", names)
+	}
+}
+
+// TestStableNameNumericSuffixCollision checks that colliding entries
+// are suffixed " (2)", " (3)", ... in the order they're first seen.
+func TestStableNameNumericSuffixCollision(t *testing.T) {
+	names, subdirs := stableNameAll(CollisionStrategyNumericSuffix, collidingEntries())
+	want := []string{"shared.txt", "shared (2).txt", "shared (3).txt"}
+	for i, name := range names {
+		if subdirs[i] != "" {
+			t.Errorf("subdirs[%d] = %q; want empty under CollisionStrategyNumericSuffix", i, subdirs[i])
+		}
+		if name != want[i] {
+			t.Errorf("names[%d] = %q; want %q", i, name, want[i])
+		}
+	}
+}
+
+// TestStableNameSubdirByBlobRefCollision checks that every colliding
+// entry keeps its own plain display name, with all but the first
+// nested under a distinct, deterministic blobref-derived subdirectory.
+func TestStableNameSubdirByBlobRefCollision(t *testing.T) {
+	entries := collidingEntries()
+	names, subdirs := stableNameAll(CollisionStrategySubdirByBlobRef, entries)
+	for i, name := range names {
+		if name != "shared.txt" {
+			t.Errorf("names[%d] = %q; want %q (unaltered) under CollisionStrategySubdirByBlobRef", i, name, "shared.txt")
+		}
+	}
+	if subdirs[0] != "" {
+		t.Errorf("subdirs[0] = %q; want empty (the first entry never collides)", subdirs[0])
+	}
+	seenSubdirs := map[string]bool{}
+	for i := 1; i < len(subdirs); i++ {
+		if subdirs[i] == "" {
+			t.Errorf("subdirs[%d] is empty; want a collisionSubdirName for entry %v", i, entries[i].Permanode)
+		}
+		if want := collisionSubdirName(entries[i].Permanode); subdirs[i] != want {
+			t.Errorf("subdirs[%d] = %q; want %q", i, subdirs[i], want)
+		}
+		if seenSubdirs[subdirs[i]] {
+			t.Fatalf("subdirs[%d] = %q duplicates an earlier subdirectory name", i, subdirs[i])
+		}
+		seenSubdirs[subdirs[i]] = true
+	}
+}
+
+// TestStableNameCollisionPinnedAcrossRefreshes checks that a second
+// stableName call for the same permanodes, as a later doReaddir would
+// make, reuses each permanode's earlier decision rather than
+// recomputing it (and potentially landing on a different one).
+func TestStableNameCollisionPinnedAcrossRefreshes(t *testing.T) {
+	for _, strategy := range []CollisionStrategy{
+		CollisionStrategyBlobSuffix,
+		CollisionStrategyNumericSuffix,
+		CollisionStrategySubdirByBlobRef,
+	} {
+		n := &searchResultDir{fs: &CamliFileSystem{CollisionStrategy: strategy}}
+		entries := collidingEntries()
+		var errLog []string
+		var firstNames, firstSubdirs []string
+		for _, de := range entries {
+			name, subdir := n.stableName(de, &errLog)
+			firstNames = append(firstNames, name)
+			firstSubdirs = append(firstSubdirs, subdir)
+		}
+		for i, de := range entries {
+			name, subdir := n.stableName(de, &errLog)
+			if name != firstNames[i] || subdir != firstSubdirs[i] {
+				t.Errorf("strategy %v: entry %d re-resolved to (%q, %q); want the pinned (%q, %q)",
+					strategy, i, name, subdir, firstNames[i], firstSubdirs[i])
+			}
+		}
+	}
+}
+
+// TestNumericCollisionNameSkipsTaken checks that numericCollisionName
+// skips past any number already claimed in taken, rather than always
+// starting at " (2)".
+func TestNumericCollisionNameSkipsTaken(t *testing.T) {
+	taken := map[string]blob.Ref{
+		"photo.jpg":     blob.RefFromString("a"),
+		"photo (2).jpg": blob.RefFromString("b"),
+	}
+	got := numericCollisionName("photo.jpg", taken)
+	if got != "photo (3).jpg" {
+		t.Errorf("numericCollisionName() = %q; want %q", got, "photo (3).jpg")
+	}
+}
+
+// TestCollisionSubdirNameDeterministic checks that collisionSubdirName
+// returns the same value for the same blobref every time, and
+// different values for different blobrefs.
+func TestCollisionSubdirNameDeterministic(t *testing.T) {
+	a := blob.RefFromString("alpha")
+	b := blob.RefFromString("beta")
+	if collisionSubdirName(a) != collisionSubdirName(a) {
+		t.Errorf("collisionSubdirName(a) is not deterministic")
+	}
+	if collisionSubdirName(a) == collisionSubdirName(b) {
+		t.Errorf("collisionSubdirName(a) == collisionSubdirName(b); want distinct names for distinct blobrefs")
+	}
+}
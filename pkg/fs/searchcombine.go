@@ -0,0 +1,74 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// combineAndOp and combineOrOp are the operators a searchDir.Lookup
+// name may combine saved search names with, e.g. "a & b" or
+// "a & b | c", to get an ad-hoc intersection or union of their stored
+// expressions without rewriting either one. combineAndOp binds
+// tighter than combineOrOp, the same as "and"/"or" do in the query
+// expression language itself.
+const (
+	combineAndOp = "&"
+	combineOrOp  = "|"
+)
+
+// combineSavedSearches reports whether expr is a combineAndOp/
+// combineOrOp expression over saved search names (isCombine is false
+// if expr contains neither operator, in which case it's left for
+// Lookup's other checks to interpret), and if so, returns the logical
+// AND/OR of those names' stored expressions as a single expression,
+// with every operand parenthesized so the combination can't silently
+// change meaning depending on what the named saved searches'
+// expressions themselves contain. An expr that does use the
+// combineAndOp/combineOrOp syntax but names an unknown saved search
+// comes back with isCombine true and a non-nil err, for Lookup to
+// turn into fuse.ENOENT rather than falling through to treat the
+// unparsed text as a literal search expression.
+func combineSavedSearches(expr string, saved map[string]savedSearch) (combined string, isCombine bool, err error) {
+	if !strings.ContainsAny(expr, combineAndOp+combineOrOp) {
+		return "", false, nil
+	}
+	var orGroups []string
+	for _, group := range strings.Split(expr, combineOrOp) {
+		var andExprs []string
+		for _, raw := range strings.Split(group, combineAndOp) {
+			name := strings.TrimSpace(raw)
+			if name == "" {
+				return "", true, fmt.Errorf("empty saved search name in combined expression %q", expr)
+			}
+			ss, ok := saved[name]
+			if !ok {
+				return "", true, fmt.Errorf("unknown saved search %q in combined expression %q", name, expr)
+			}
+			andExprs = append(andExprs, "("+ss.Expr+")")
+		}
+		andGroup := strings.Join(andExprs, " and ")
+		if len(andExprs) > 1 {
+			andGroup = "(" + andGroup + ")"
+		}
+		orGroups = append(orGroups, andGroup)
+	}
+	return strings.Join(orGroups, " or "), true, nil
+}
@@ -0,0 +1,98 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+var combineTestSaved = map[string]savedSearch{
+	"vacation": {Expr: `tag:vacation`},
+	"2015":     {Expr: `after:"2015-01-01" and before:"2016-01-01"`},
+	"pano":     {Expr: `is:pano`},
+}
+
+// TestCombineSavedSearchesAnd checks that "a & b" composes the AND of
+// two saved searches' stored expressions, each parenthesized.
+func TestCombineSavedSearchesAnd(t *testing.T) {
+	got, isCombine, err := combineSavedSearches("vacation & 2015", combineTestSaved)
+	if err != nil {
+		t.Fatalf("combineSavedSearches error = %v; want nil", err)
+	}
+	if !isCombine {
+		t.Fatal("isCombine = false; want true")
+	}
+	want := `(tag:vacation) and (after:"2015-01-01" and before:"2016-01-01")`
+	if got != want {
+		t.Errorf("combineSavedSearches(%q) = %q; want %q", "vacation & 2015", got, want)
+	}
+}
+
+// TestCombineSavedSearchesOr checks the union case.
+func TestCombineSavedSearchesOr(t *testing.T) {
+	got, isCombine, err := combineSavedSearches("vacation | pano", combineTestSaved)
+	if err != nil {
+		t.Fatalf("combineSavedSearches error = %v; want nil", err)
+	}
+	if !isCombine {
+		t.Fatal("isCombine = false; want true")
+	}
+	want := `(tag:vacation) or (is:pano)`
+	if got != want {
+		t.Errorf("combineSavedSearches(%q) = %q; want %q", "vacation | pano", got, want)
+	}
+}
+
+// TestCombineSavedSearchesPrecedence checks that mixing both operators
+// parenthesizes the AND-group before ORing it with the rest, so & binds
+// tighter than | in the result the same as it does in the input.
+func TestCombineSavedSearchesPrecedence(t *testing.T) {
+	got, isCombine, err := combineSavedSearches("vacation & 2015 | pano", combineTestSaved)
+	if err != nil {
+		t.Fatalf("combineSavedSearches error = %v; want nil", err)
+	}
+	if !isCombine {
+		t.Fatal("isCombine = false; want true")
+	}
+	want := `((tag:vacation) and (after:"2015-01-01" and before:"2016-01-01")) or (is:pano)`
+	if got != want {
+		t.Errorf("combineSavedSearches(%q) = %q; want %q", "vacation & 2015 | pano", got, want)
+	}
+}
+
+// TestCombineSavedSearchesUnknownName checks that naming an unknown
+// saved search reports isCombine=true with a non-nil error, for
+// Lookup to turn into fuse.ENOENT.
+func TestCombineSavedSearchesUnknownName(t *testing.T) {
+	_, isCombine, err := combineSavedSearches("vacation & nonexistent", combineTestSaved)
+	if !isCombine {
+		t.Fatal("isCombine = false; want true")
+	}
+	if err == nil {
+		t.Error("err = nil; want non-nil for an unknown saved search name")
+	}
+}
+
+// TestCombineSavedSearchesNotCombine checks that a plain name with
+// neither operator is left alone (isCombine=false), so Lookup's other
+// checks get a chance to interpret it.
+func TestCombineSavedSearchesNotCombine(t *testing.T) {
+	_, isCombine, err := combineSavedSearches("vacation", combineTestSaved)
+	if isCombine || err != nil {
+		t.Errorf("combineSavedSearches(%q) = (isCombine=%v, err=%v); want (false, nil)", "vacation", isCombine, err)
+	}
+}
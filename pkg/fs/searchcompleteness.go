@@ -0,0 +1,112 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// completenessStatusFileName is the hidden entry CompletenessStatusFile
+// exposes on a searchResultDir, unifying truncatedMarkerName,
+// partialMarkerName, and the fallback count doReaddir otherwise only
+// logs into one place a client can check for a listing's
+// completeness, rather than having to know about every
+// truncation-related feature separately. It shares its name with
+// statusFileName, the unrelated top-level mount-health file at the
+// "search" directory's own root; the two never collide since they
+// live in different directories.
+const completenessStatusFileName = ".status"
+
+// CompletenessStatusFormat selects completenessStatusContents' output
+// format (see CamliFileSystem.CompletenessStatusFormat).
+type CompletenessStatusFormat int
+
+const (
+	// CompletenessStatusFormatJSON reports completeness as a small
+	// JSON object, one field per signal, for a client that wants to
+	// parse it programmatically. It's the zero value.
+	CompletenessStatusFormatJSON CompletenessStatusFormat = iota
+	// CompletenessStatusFormatText reports the same signals as a
+	// short human-readable summary, one line per signal that applies,
+	// or "complete" alone when none do.
+	CompletenessStatusFormatText
+)
+
+// completenessStatus is completenessStatusFileName's JSON shape under
+// CompletenessStatusFormatJSON.
+type completenessStatus struct {
+	// Complete is true only when none of the fields below do.
+	Complete bool `json:"complete"`
+	// TruncatedByLimit mirrors hasTruncatedMarker: the listing was cut
+	// off at CamliFileSystem.MaxResults.
+	TruncatedByLimit bool `json:"truncatedByLimit,omitempty"`
+	// TruncatedByTime mirrors hasPartialMarker: the listing was cut
+	// short by CamliFileSystem.QuerySoftBudget.
+	TruncatedByTime bool `json:"truncatedByTime,omitempty"`
+	// PartialDescribe is true when at least one entry's camliContent
+	// didn't come back described within the query's depth and had to
+	// be recovered with a direct describe (see n.lastFallbackCount).
+	PartialDescribe bool `json:"partialDescribe,omitempty"`
+	// FallbackCount is how many entries PartialDescribe covers.
+	FallbackCount int `json:"fallbackCount,omitempty"`
+}
+
+// completenessStatusContents builds completenessStatusFileName's
+// content from n's own truncation markers and its last doReaddir's
+// fallback count, in n.fs.CompletenessStatusFormat.
+func (n *searchResultDir) completenessStatusContents() string {
+	n.mu.Lock()
+	fallbackCount := n.lastFallbackCount
+	n.mu.Unlock()
+	cs := completenessStatus{
+		TruncatedByLimit: n.hasTruncatedMarker(),
+		TruncatedByTime:  n.hasPartialMarker(),
+		PartialDescribe:  fallbackCount > 0,
+		FallbackCount:    fallbackCount,
+	}
+	cs.Complete = !cs.TruncatedByLimit && !cs.TruncatedByTime && !cs.PartialDescribe
+	if n.fs.CompletenessStatusFormat == CompletenessStatusFormatText {
+		return cs.text()
+	}
+	b, err := json.MarshalIndent(cs, "", "\t")
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// text renders cs the way CompletenessStatusFormatText does: one line
+// per signal that applies, or "complete" alone when none do.
+func (cs completenessStatus) text() string {
+	if cs.Complete {
+		return "complete\n"
+	}
+	var s string
+	if cs.TruncatedByLimit {
+		s += "truncated-by-limit\n"
+	}
+	if cs.TruncatedByTime {
+		s += "truncated-by-time\n"
+	}
+	if cs.PartialDescribe {
+		s += fmt.Sprintf("partial-describe (%d entry(s))\n", cs.FallbackCount)
+	}
+	return s
+}
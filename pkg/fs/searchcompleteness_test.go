@@ -0,0 +1,80 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCompletenessStatusContentsComplete checks that a listing with
+// no truncation and no describe fallbacks reports complete in both
+// formats.
+func TestCompletenessStatusContentsComplete(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	got := n.completenessStatusContents()
+	if !strings.Contains(got, `"complete": true`) {
+		t.Errorf("completenessStatusContents() = %q; want it to report complete", got)
+	}
+
+	n.fs.CompletenessStatusFormat = CompletenessStatusFormatText
+	if got := n.completenessStatusContents(); got != "complete\n" {
+		t.Errorf("completenessStatusContents() (text) = %q; want %q", got, "complete\n")
+	}
+}
+
+// TestCompletenessStatusContentsTruncatedByLimit checks that
+// truncatedMarkerName surfaces as TruncatedByLimit.
+func TestCompletenessStatusContentsTruncatedByLimit(t *testing.T) {
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{},
+		lastNames: []string{"a.jpg", truncatedMarkerName},
+	}
+	got := n.completenessStatusContents()
+	if !strings.Contains(got, `"truncatedByLimit": true`) {
+		t.Errorf("completenessStatusContents() = %q; want truncatedByLimit true", got)
+	}
+	if strings.Contains(got, `"complete": true`) {
+		t.Errorf("completenessStatusContents() = %q; want complete false", got)
+	}
+
+	n.fs.CompletenessStatusFormat = CompletenessStatusFormatText
+	if got := n.completenessStatusContents(); got != "truncated-by-limit\n" {
+		t.Errorf("completenessStatusContents() (text) = %q; want %q", got, "truncated-by-limit\n")
+	}
+}
+
+// TestCompletenessStatusContentsPartialDescribe checks that a
+// nonzero lastFallbackCount surfaces as PartialDescribe with its
+// count, in both formats.
+func TestCompletenessStatusContentsPartialDescribe(t *testing.T) {
+	n := &searchResultDir{
+		fs:                &CamliFileSystem{},
+		lastFallbackCount: 3,
+	}
+	got := n.completenessStatusContents()
+	if !strings.Contains(got, `"partialDescribe": true`) || !strings.Contains(got, `"fallbackCount": 3`) {
+		t.Errorf("completenessStatusContents() = %q; want partialDescribe true, fallbackCount 3", got)
+	}
+
+	n.fs.CompletenessStatusFormat = CompletenessStatusFormatText
+	if got := n.completenessStatusContents(); got != "partial-describe (3 entry(s))\n" {
+		t.Errorf("completenessStatusContents() (text) = %q; want %q", got, "partial-describe (3 entry(s))\n")
+	}
+}
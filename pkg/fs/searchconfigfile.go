@@ -0,0 +1,121 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// configFileName is a hidden file at the "search" directory's own
+// root summarizing every exported CamliFileSystem field's effective
+// value, for troubleshooting a mount without access to the launching
+// command line. Unlike README.txt, it's generated fresh from the live
+// struct on every read (see configFileContents), so it always
+// reflects the mount as it's actually running, including any runtime
+// override (camlifsFileName, describeRulesFileName) already applied.
+// Like statusFileName, it's always resolvable via Lookup but never
+// listed in ReadDirAll.
+const configFileName = ".config"
+
+// sensitiveConfigFieldSubstrings names the case-insensitive
+// substrings configFileContents redacts a field's value for, since a
+// credential or other secret has no business being readable from a
+// mounted filesystem just because it happens to be troubleshooting
+// information too.
+var sensitiveConfigFieldSubstrings = []string{"password", "secret", "token", "credential", "key"}
+
+// isSensitiveConfigField reports whether name (an exported
+// CamliFileSystem field's name) looks like it holds a credential or
+// other secret, per sensitiveConfigFieldSubstrings.
+func isSensitiveConfigField(name string) bool {
+	lower := strings.ToLower(name)
+	for _, s := range sensitiveConfigFieldSubstrings {
+		if strings.Contains(lower, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// configFileContents renders configFileName's content: one
+// "FieldName: value" line per exported CamliFileSystem field, sorted
+// by name, with any field isSensitiveConfigField flags redacted. It's
+// built via reflection rather than a hand-maintained field list, so a
+// newly added field is automatically covered without this file
+// needing to be touched.
+func configFileContents(fsys *CamliFileSystem) []byte {
+	v := reflect.ValueOf(*fsys)
+	t := v.Type()
+	lines := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// Unexported; not part of the mount's configuration
+			// surface, just internal bookkeeping (caches, mutexes, and
+			// the like already covered by statusFileName instead).
+			continue
+		}
+		value := "<redacted>"
+		if !isSensitiveConfigField(f.Name) {
+			value = fmt.Sprintf("%v", v.Field(i).Interface())
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", f.Name, value))
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// configFile is configFileName's Node and Handle: a read-only file
+// whose content is generated fresh on every Read from fs's live
+// field values, the same on-read-generation statusFile otherwise
+// uses for its own dynamic content.
+type configFile struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node         = configFile{}
+	_ fs.HandleReader = configFile{}
+)
+
+func (f configFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0444
+	a.Valid = f.fs.effectiveAttrValidity()
+	return nil
+}
+
+func (f configFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := configFileContents(f.fs)
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = content[req.Offset:end]
+	return nil
+}
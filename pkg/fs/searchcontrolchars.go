@@ -0,0 +1,80 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "strings"
+
+// ControlCharPolicy selects how stripControlChars handles a control
+// character (including a newline) in an attribute-derived name. Unlike
+// FilenameSanitize, which only escapes characters that are outright
+// illegal in a path component ('/' and NUL), this targets characters
+// that are legal there but corrupt a terminal or a client that assumes
+// a single-line name, such as an embedded "\n" in a permanode's title.
+type ControlCharPolicy int
+
+const (
+	// ControlCharPolicyNone passes control characters through
+	// unchanged, preserving the historical behavior.
+	ControlCharPolicyNone ControlCharPolicy = iota
+	// ControlCharPolicyStrip removes each control character outright.
+	ControlCharPolicyStrip
+	// ControlCharPolicyUnderscore replaces each control character with
+	// '_'.
+	ControlCharPolicyUnderscore
+)
+
+// isControlRune reports whether r is a control character stripControlChars
+// acts on: every rune below 0x20, plus DEL (0x7F). Space (0x20) and
+// everything above it is left alone, since it's printable.
+func isControlRune(r rune) bool {
+	return r < 0x20 || r == 0x7F
+}
+
+// stripControlChars applies fsys.FilenameControlChars to name. It
+// returns name unchanged, and an empty original, when there was
+// nothing to do (either the policy is ControlCharPolicyNone or name
+// has no control characters), so the caller can tell whether to
+// remember original as the raw value, the same way truncateFilename's
+// own (truncated, original string) return already works.
+func stripControlChars(fsys *CamliFileSystem, name string) (cleaned, original string) {
+	if fsys.FilenameControlChars == ControlCharPolicyNone {
+		return name, ""
+	}
+	hasControl := false
+	for _, r := range name {
+		if isControlRune(r) {
+			hasControl = true
+			break
+		}
+	}
+	if !hasControl {
+		return name, ""
+	}
+	var b strings.Builder
+	for _, r := range name {
+		if isControlRune(r) {
+			if fsys.FilenameControlChars == ControlCharPolicyUnderscore {
+				b.WriteByte('_')
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), name
+}
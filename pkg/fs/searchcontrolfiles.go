@@ -0,0 +1,65 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// controlFileNames lists every searchResultDir control file that's
+// always present, i.e. not gated behind its own Enable*/Disable*
+// feature flag (those are errorsLogName, explainFileName,
+// facetsFileName, timelineFileName, and searchStatsFileName; see
+// isControlFileName and direntsWithDotfiles). Every name here is
+// always resolvable via Lookup regardless of
+// CamliFileSystem.ShowDotfiles; ShowDotfiles only controls whether
+// direntsWithDotfiles also lists it in a plain "ls".
+//
+// This is the explicit registry ShowDotfiles's own doc comment
+// promises, kept deliberately separate from ShowHidden's leading-dot
+// heuristic (see searchhidden.go): a real result name that happens to
+// start with a dot is never mistaken for one of these just because it
+// shares that leading character.
+var controlFileNames = []string{
+	queryFileName,
+	resultsJSONName,
+	exportJSONLName,
+	dimensionsFileName,
+	totalSizeFileName,
+	locationsFileName,
+	errorFileName,
+	countFileName,
+	refreshFileName,
+	camlifsFileName,
+	limitFileName,
+}
+
+// isControlFileName reports whether name is a searchResultDir control
+// file, i.e. a member of controlFileNames or one of the
+// feature-flag-gated control files direntsWithDotfiles also knows
+// about, as opposed to a real result name that merely starts with a
+// dot (see ShowHidden).
+func isControlFileName(name string) bool {
+	switch name {
+	case errorsLogName, explainFileName, facetsFileName, timelineFileName, searchStatsFileName:
+		return true
+	}
+	for _, n := range controlFileNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+)
+
+// TestIsControlFileNameRegistryNotLeadingDot checks that the
+// control-file/real-result distinction is based on
+// isControlFileName's registry, not merely on a leading dot: a real
+// result name that happens to start with a dot (see ShowHidden) isn't
+// mistaken for a control file.
+func TestIsControlFileNameRegistryNotLeadingDot(t *testing.T) {
+	if !isControlFileName(refreshFileName) {
+		t.Errorf("isControlFileName(%q) = false; want true", refreshFileName)
+	}
+	if !isControlFileName(countFileName) {
+		t.Errorf("isControlFileName(%q) = false; want true", countFileName)
+	}
+	if isControlFileName(".photo.jpg") {
+		t.Error(`isControlFileName(".photo.jpg") = true; want false (a real dot-prefixed result isn't a control file)`)
+	}
+}
+
+// TestDirentsWithDotfilesHidden checks that, with ShowDotfiles unset
+// (the default), no control file shows up in direntsWithDotfiles'
+// listing even though, per TestRefreshFileLookupableWhenHidden, it's
+// still resolvable via Lookup.
+func TestDirentsWithDotfilesHidden(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	ents := n.direntsWithDotfiles(nil, nil, nil)
+	for _, d := range ents {
+		if isControlFileName(d.Name) {
+			t.Errorf("direntsWithDotfiles() with ShowDotfiles unset includes %q; want it omitted", d.Name)
+		}
+	}
+}
+
+// TestDirentsWithDotfilesShown checks that ShowDotfiles surfaces
+// every name in controlFileNames.
+func TestDirentsWithDotfilesShown(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{ShowDotfiles: true}}
+	ents := n.direntsWithDotfiles(nil, nil, nil)
+	got := make(map[string]bool, len(ents))
+	for _, d := range ents {
+		got[d.Name] = true
+	}
+	for _, name := range controlFileNames {
+		if !got[name] {
+			t.Errorf("direntsWithDotfiles() with ShowDotfiles=true is missing %q", name)
+		}
+	}
+}
+
+// TestRefreshFileLookupableWhenHidden checks that a control file
+// (".refresh") resolves via Lookup regardless of ShowDotfiles, even
+// though TestDirentsWithDotfilesHidden shows it's absent from the
+// listing by default.
+func TestRefreshFileLookupableWhenHidden(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	if _, err := n.Lookup(context.Background(), refreshFileName); err != nil {
+		t.Errorf("Lookup(%q) with ShowDotfiles unset = %v; want nil (always resolvable)", refreshFileName, err)
+	}
+}
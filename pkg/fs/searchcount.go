@@ -0,0 +1,88 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// countFileName is a hidden, per-searchResultDir file reporting how
+// many results the directory's search expression currently matches in
+// total, for a caller that just wants "how many" (a dashboard, a
+// script) without paying for a full listing. Unlike facetsFileName, it
+// never forces ReadDirAll: reading it issues its own Limit: 0,
+// describe-less query (see fetchCount), cached separately from the
+// normal n.ents cache for countCacheTTL so a script polling it
+// repeatedly doesn't re-query on every read. It's always resolvable
+// via Lookup, and listed in ReadDirAll only when ShowDotfiles is set
+// (see controlFileNames).
+const countFileName = ".count"
+
+// countCacheTTL bounds how long countFileContents trusts a cached
+// count before fetchCount re-queries it.
+const countCacheTTL = 10 * time.Second
+
+// fetchCount returns how many results n's search expression currently
+// matches, querying fresh only if the last answer is older than
+// countCacheTTL. It must be called with n.mu unheld, since a cache
+// miss issues a query; it never touches n.ents/n.lastNames/etc., so it
+// has no effect on the normal listing cache either way.
+func (n *searchResultDir) fetchCount(ctx context.Context) (total int, known bool, err error) {
+	n.mu.Lock()
+	fresh := !n.countCheckedAt.IsZero() && time.Since(n.countCheckedAt) < countCacheTTL
+	total, known = n.countTotal, n.countKnown
+	n.mu.Unlock()
+	if fresh {
+		return total, known, nil
+	}
+
+	res, err := n.fs.queryWithFailover(ctx, n.fs.client, &search.SearchQuery{
+		Expression: n.effectiveSearchExpr(),
+		Limit:      0,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	total, known = len(res.Blobs), false
+	if tr, ok := (interface{})(res).(dir.TotalMatchesReporter); ok {
+		if t, ok := tr.TotalMatches(); ok {
+			total, known = t, true
+		}
+	}
+
+	n.mu.Lock()
+	n.countTotal, n.countKnown, n.countCheckedAt = total, known, time.Now()
+	n.mu.Unlock()
+	return total, known, nil
+}
+
+// countFileContents renders countFileName's content from total/known
+// as fetchCount reported them.
+func countFileContents(total int, known bool) []byte {
+	s := fmt.Sprintf("total: %d\n", total)
+	if !known {
+		s += "note: server didn't report a total match count; total is just this query's own visible count, not a true total.\n"
+	}
+	return []byte(s)
+}
@@ -0,0 +1,70 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCountFileContentsKnownTotal checks that a known total renders
+// without the "didn't report a total" caveat.
+func TestCountFileContentsKnownTotal(t *testing.T) {
+	got := string(countFileContents(42, true))
+	if !strings.Contains(got, "total: 42") {
+		t.Errorf("countFileContents(42, true) = %q; want it to contain %q", got, "total: 42")
+	}
+	if strings.Contains(got, "note:") {
+		t.Errorf("countFileContents(42, true) = %q; want no caveat note", got)
+	}
+}
+
+// TestCountFileContentsUnknownTotal checks that an unknown total's
+// rendering flags itself as just a page-local count.
+func TestCountFileContentsUnknownTotal(t *testing.T) {
+	got := string(countFileContents(3, false))
+	if !strings.Contains(got, "total: 3") || !strings.Contains(got, "note:") {
+		t.Errorf("countFileContents(3, false) = %q; want a total and a caveat note", got)
+	}
+}
+
+// TestFetchCountReusesFreshCache checks that fetchCount returns a
+// still-fresh cached count without issuing a query (n.fs.client is
+// left nil, so a query attempt would panic), and that it never
+// touches n.ents/n.lastNames, the normal listing cache.
+func TestFetchCountReusesFreshCache(t *testing.T) {
+	n := &searchResultDir{
+		fs:             &CamliFileSystem{},
+		countTotal:     7,
+		countKnown:     true,
+		countCheckedAt: time.Now(),
+	}
+	total, known, err := n.fetchCount(context.Background())
+	if err != nil {
+		t.Fatalf("fetchCount() error = %v", err)
+	}
+	if total != 7 || !known {
+		t.Errorf("fetchCount() = %d, %v; want 7, true", total, known)
+	}
+	if n.ents != nil || n.lastNames != nil {
+		t.Errorf("fetchCount() populated the normal listing cache; want it untouched")
+	}
+}
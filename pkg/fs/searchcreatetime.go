@@ -0,0 +1,61 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/types"
+)
+
+// createTime resolves n's creation time for Attr's Crtime/Ctime,
+// honoring n.fs.CreateTimeAttr first (see CreateTimeAttr), then
+// falling back to the permanode's own ModTime. ok is false only when
+// neither is available, leaving the caller to fall back to Mtime
+// itself.
+func (n *searchResultFile) createTime() (t time.Time, ok bool) {
+	if n.pnodeMeta == nil || n.pnodeMeta.Permanode == nil {
+		return time.Time{}, false
+	}
+	if attr := n.fs.CreateTimeAttr; attr != "" {
+		if raw := n.pnodeMeta.Permanode.Attr.Get(attr); raw != "" {
+			if parsed, err := types.ParseTime3339(raw); err == nil {
+				return parsed.Time(), true
+			}
+		}
+	}
+	if n.pnodeMeta.Permanode.ModTime != nil {
+		return n.pnodeMeta.Permanode.ModTime.Time(), true
+	}
+	return time.Time{}, false
+}
+
+// applyCreateTime sets a.Crtime and a.Ctime from n.createTime(),
+// falling back to a.Mtime (already set by the caller) when
+// createTime has nothing better to offer, so neither is ever left at
+// its zero value.
+func (n *searchResultFile) applyCreateTime(a *fuse.Attr) {
+	create, ok := n.createTime()
+	if !ok {
+		create = a.Mtime
+	}
+	a.Crtime = create
+	a.Ctime = create
+}
@@ -0,0 +1,70 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+)
+
+// TestShouldAbortForCancellation checks that doReaddir's per-result
+// loop only consults ctx.Err() every ctxCancelCheckInterval entries,
+// and only aborts once it has and the context is actually done —
+// simulating a large result set where a caller cancels partway
+// through.
+func TestShouldAbortForCancellation(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	const total = 3 * ctxCancelCheckInterval
+	tests := []struct {
+		ctx  context.Context
+		i    int
+		want bool
+	}{
+		{context.Background(), 0, false},
+		{context.Background(), ctxCancelCheckInterval, false},
+		{canceledCtx, 0, false}, // i==0 never checks, regardless of ctx
+		{canceledCtx, 1, false},
+		{canceledCtx, ctxCancelCheckInterval - 1, false},
+		{canceledCtx, ctxCancelCheckInterval, true},
+		{canceledCtx, 2 * ctxCancelCheckInterval, true},
+	}
+	for _, tt := range tests {
+		if got := shouldAbortForCancellation(tt.ctx, tt.i, total); got != tt.want {
+			t.Errorf("shouldAbortForCancellation(ctx, %d, %d) = %v; want %v", tt.i, total, got, tt.want)
+		}
+	}
+}
+
+// TestShouldAbortForCancellationRecoversCleanly checks that once a
+// canceled context stops aborting (i.e. a fresh, non-canceled ctx is
+// used for the next ReadDirAll, as doReaddir's caller always does),
+// shouldAbortForCancellation reports false again at the same index,
+// matching a clean recovery on the next readdir.
+func TestShouldAbortForCancellationRecoversCleanly(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if !shouldAbortForCancellation(canceledCtx, ctxCancelCheckInterval, 2*ctxCancelCheckInterval) {
+		t.Fatal("shouldAbortForCancellation with a canceled ctx = false; want true")
+	}
+	if shouldAbortForCancellation(context.Background(), ctxCancelCheckInterval, 2*ctxCancelCheckInterval) {
+		t.Error("shouldAbortForCancellation with a fresh ctx at the same index = true; want false")
+	}
+}
@@ -0,0 +1,39 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// defaultRefreshDebounceDivisor is what CamliFileSystem.SearchCacheTTL
+// is divided by to get the debounce window when RefreshDebounce is
+// left at its zero value: a tenth of the TTL is short enough to never
+// be mistaken for the TTL itself, but long enough to coalesce a burst
+// of callers that all missed the cache within a few milliseconds of
+// each other.
+const defaultRefreshDebounceDivisor = 10
+
+// effectiveRefreshDebounce reports the debounce window n.fs actually
+// applies: its configured RefreshDebounce if set, otherwise
+// SearchCacheTTL / defaultRefreshDebounceDivisor.
+func (n *searchResultDir) effectiveRefreshDebounce() time.Duration {
+	if n.fs.RefreshDebounce > 0 {
+		return n.fs.RefreshDebounce
+	}
+	return n.fs.SearchCacheTTL / defaultRefreshDebounceDivisor
+}
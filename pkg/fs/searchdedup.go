@@ -0,0 +1,172 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// dupesDirName is the reserved name of the read-only subdirectory
+// exposing whatever doReaddir's dedupeByContent pass suppressed from
+// the parent listing, for CamliFileSystem.DedupByContent.
+const dupesDirName = ".dupes"
+
+// dupeEntry is everything a suppressed entry needs to still be
+// Lookup-able under dupesDirName, even though it no longer has a name
+// in the parent's own ents/permanode/pnodeMeta/imageMeta/modTime.
+type dupeEntry struct {
+	blob      *search.DescribedBlob
+	permanode blob.Ref
+	pnodeMeta *search.DescribedBlob
+	imageMeta *search.DescribedBlob
+	modTime   time.Time
+}
+
+// dedupeByContent groups the names in *lastNames that resolved to a
+// file or directory (i.e. have an ents entry; sets and symlinks are
+// left alone) by their content blobref, keeping only the
+// most-recently-modified name per group in ents/permanode/pnodeMeta/
+// imageMeta/modTime/lastNames. Every other name in a group is removed
+// from those and returned as a dupeEntry keyed by its own (now
+// otherwise-unreferenced) name, for dupesDirName to still serve it.
+//
+// It returns nil if nothing was suppressed, so callers can tell
+// "nothing duplicated" from "DedupByContent is off" the same way.
+func (n *searchResultDir) dedupeByContent(ents map[string]*search.DescribedBlob, permanode map[string]blob.Ref, pnodeMeta, imageMeta map[string]*search.DescribedBlob, modTime map[string]time.Time, lastNames *[]string) map[string]dupeEntry {
+	survivorByContent := make(map[blob.Ref]string)
+	dupes := make(map[string]dupeEntry)
+	for _, name := range *lastNames {
+		db, ok := ents[name]
+		if !ok {
+			continue
+		}
+		cc := db.BlobRef
+		survivor, ok := survivorByContent[cc]
+		if !ok {
+			survivorByContent[cc] = name
+			continue
+		}
+		loser := name
+		if modTime[name].After(modTime[survivor]) {
+			survivorByContent[cc] = name
+			loser = survivor
+		}
+		dupes[loser] = dupeEntry{
+			blob:      ents[loser],
+			permanode: permanode[loser],
+			pnodeMeta: pnodeMeta[loser],
+			imageMeta: imageMeta[loser],
+			modTime:   modTime[loser],
+		}
+		delete(ents, loser)
+		delete(permanode, loser)
+		delete(pnodeMeta, loser)
+		delete(imageMeta, loser)
+		delete(modTime, loser)
+	}
+	if len(dupes) == 0 {
+		return nil
+	}
+	kept := (*lastNames)[:0]
+	for _, name := range *lastNames {
+		if _, isDupe := dupes[name]; !isDupe {
+			kept = append(kept, name)
+		}
+	}
+	*lastNames = kept
+	Logger.Printf("fs.search: ReadDirAll for '%s' deduped %d entry(s) sharing content with another, more recently modified one", n.searchExp, len(dupes))
+	return dupes
+}
+
+// dupeEntryNode builds the fs.Node a dupeEntry resolves to under
+// dupesDirName: always read-only, since a suppressed duplicate isn't
+// the canonical place to edit that content.
+func dupeEntryNode(fsys *CamliFileSystem, d dupeEntry) fs.Node {
+	nod := &searchResultFile{
+		node:      node{fs: fsys, blobref: d.blob.BlobRef, pnodeModTime: d.modTime},
+		readOnly:  true,
+		permanode: d.permanode,
+		pnodeMeta: d.pnodeMeta,
+		imageMeta: d.imageMeta,
+	}
+	if d.blob.File != nil {
+		nod.mimeType = d.blob.File.MIMEType
+		nod.size = uint64(d.blob.File.Size)
+		nod.haveSize = true
+	}
+	return nod
+}
+
+// searchDupesDir lists and resolves the entries dedupeByContent
+// suppressed from its parent. It only "exists" (see
+// searchResultDir.Lookup) once the parent has been seeded and
+// actually suppressed something this round.
+type searchDupesDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*searchDupesDir)(nil)
+	_ fs.HandleReadDirAller = (*searchDupesDir)(nil)
+	_ fs.NodeStringLookuper = (*searchDupesDir)(nil)
+)
+
+func (d *searchDupesDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *searchDupesDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	names := make([]string, 0, len(d.parent.dupes))
+	for name := range d.parent.dupes {
+		names = append(names, name)
+	}
+	return dirents(names, fuse.DT_File), nil
+}
+
+func (d *searchDupesDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	d.parent.mu.Lock()
+	dp, ok := d.parent.dupes[name]
+	d.parent.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return dupeEntryNode(d.parent.fs, dp), nil
+}
+
+// hasDupes reports whether n's last ReadDirAll suppressed anything
+// for dupesDirName to show, so Lookup can give a plain ENOENT for it
+// rather than an always-empty, always-present directory.
+func (n *searchResultDir) hasDupes() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.dupes) > 0
+}
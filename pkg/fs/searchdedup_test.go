@@ -0,0 +1,105 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// TestDedupeByContentKeepsNewest checks that two permanodes pointing
+// at the same content blob collapse to a single survivor, the
+// more-recently-modified one, with the other suppressed into the
+// returned dupes map rather than left in ents/lastNames; a third,
+// unrelated entry is untouched either way.
+func TestDedupeByContentKeepsNewest(t *testing.T) {
+	cc := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	other := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+	pn1 := blob.MustParse("sha224-3333333333333333333333333333333333333333333333333333333333333333")
+	pn2 := blob.MustParse("sha224-4444444444444444444444444444444444444444444444444444444444444444")
+	pn3 := blob.MustParse("sha224-5555555555555555555555555555555555555555555555555555555555555555")
+
+	ents := map[string]*search.DescribedBlob{
+		"old.jpg":      {BlobRef: cc},
+		"new.jpg":      {BlobRef: cc},
+		"unrelated.jpg": {BlobRef: other},
+	}
+	permanode := map[string]blob.Ref{"old.jpg": pn1, "new.jpg": pn2, "unrelated.jpg": pn3}
+	pnodeMeta := map[string]*search.DescribedBlob{}
+	imageMeta := map[string]*search.DescribedBlob{}
+	now := time.Now()
+	modTime := map[string]time.Time{
+		"old.jpg":       now.Add(-time.Hour),
+		"new.jpg":       now,
+		"unrelated.jpg": now,
+	}
+	lastNames := []string{"old.jpg", "new.jpg", "unrelated.jpg"}
+
+	n := &searchResultDir{fs: &CamliFileSystem{DedupByContent: true}, searchExp: "is:image"}
+	dupes := n.dedupeByContent(ents, permanode, pnodeMeta, imageMeta, modTime, &lastNames)
+
+	if len(dupes) != 1 {
+		t.Fatalf("dedupeByContent() returned %d dupe(s); want exactly 1", len(dupes))
+	}
+	if _, ok := dupes["old.jpg"]; !ok {
+		t.Errorf("dupes = %v; want it to contain the older entry, %q", dupes, "old.jpg")
+	}
+	if _, stillThere := ents["old.jpg"]; stillThere {
+		t.Errorf("ents still has %q after dedup; want it removed", "old.jpg")
+	}
+	if _, ok := ents["new.jpg"]; !ok {
+		t.Errorf("ents is missing %q; the newer entry should survive dedup", "new.jpg")
+	}
+	if len(lastNames) != 2 {
+		t.Errorf("lastNames = %v; want exactly 2 entries (one collapsed away)", lastNames)
+	}
+	for _, name := range lastNames {
+		if name == "old.jpg" {
+			t.Errorf("lastNames = %v; still contains the deduped-away %q", lastNames, "old.jpg")
+		}
+	}
+}
+
+// TestDedupeByContentNoOverlap checks that entries with distinct
+// content blobrefs are all left alone: dedup only ever collapses
+// entries that actually share content.
+func TestDedupeByContentNoOverlap(t *testing.T) {
+	a := blob.MustParse("sha224-6666666666666666666666666666666666666666666666666666666666666666")
+	b := blob.MustParse("sha224-7777777777777777777777777777777777777777777777777777777777777777")
+
+	ents := map[string]*search.DescribedBlob{"a.jpg": {BlobRef: a}, "b.jpg": {BlobRef: b}}
+	permanode := map[string]blob.Ref{}
+	pnodeMeta := map[string]*search.DescribedBlob{}
+	imageMeta := map[string]*search.DescribedBlob{}
+	modTime := map[string]time.Time{"a.jpg": time.Now(), "b.jpg": time.Now()}
+	lastNames := []string{"a.jpg", "b.jpg"}
+
+	n := &searchResultDir{fs: &CamliFileSystem{DedupByContent: true}, searchExp: "is:image"}
+	dupes := n.dedupeByContent(ents, permanode, pnodeMeta, imageMeta, modTime, &lastNames)
+
+	if dupes != nil {
+		t.Errorf("dedupeByContent() = %v; want nil, since nothing shares content", dupes)
+	}
+	if len(lastNames) != 2 {
+		t.Errorf("lastNames = %v; want both entries kept", lastNames)
+	}
+}
@@ -0,0 +1,98 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+	"perkeep.org/pkg/search"
+)
+
+// degradedConcurrency bounds how many schema blobs doReaddir fetches
+// at once when resolving dir.ResolvePage's degraded-mode blobrefs
+// (see resolveDegraded), the same bound prefetch's own fetches use.
+const degradedConcurrency = 4
+
+// resolveDegraded names and lists blobs dir.ResolvePage couldn't turn
+// into Entries because it had no describe meta for them to work
+// with (see ResolvePage's degraded return) — either the whole page's
+// Describe section came back empty, or the server's describe simply
+// omitted a blobref here and there. Without describe meta there's no
+// permanode to find a camliContent attribute on, so each blobref is
+// instead treated as its own content blob and fetched directly via
+// n.fs.fetchSchemaMeta; one that doesn't resolve to a schema blob, or
+// resolves to something other than a file, is skipped and logged
+// rather than listed with guessed-at metadata. It's meaningfully
+// slower than the normal describe-based path (one round trip per blob
+// instead of one per page), so it's only ever reached for the blobs
+// describe actually failed on, and fetches are bounded by
+// degradedConcurrency to keep that cost from spiking all at once.
+func (n *searchResultDir) resolveDegraded(ctx context.Context, blobs []blob.Ref, ents map[string]*search.DescribedBlob, modTime map[string]time.Time, lastNames *[]string, seen map[string]bool) {
+	type result struct {
+		br   blob.Ref
+		meta *schema.Blob
+	}
+	results := make([]result, 0, len(blobs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, degradedConcurrency)
+	for _, br := range blobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(br blob.Ref) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			meta, err := n.fs.fetchSchemaMeta(ctx, br)
+			if err != nil {
+				Logger.Printf("fs.search: ReadDirAll for '%s': degraded mode: fetching schema for %v: %v", n.searchExp, br, err)
+				return
+			}
+			if meta.Type() != "file" {
+				// Directories and symlinks need more than their own
+				// schema blob to list correctly (a directory's entries
+				// are themselves only blobrefs; a symlink's target
+				// isn't even read here), so degraded mode only ever
+				// lists plain files.
+				return
+			}
+			mu.Lock()
+			results = append(results, result{br: br, meta: meta})
+			mu.Unlock()
+		}(br)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	for _, r := range results {
+		name := sanitizeFilename(n.fs, normalizeFilename(n.fs, r.meta.FileName()))
+		if name == "" || seen[name] {
+			// Extend the collision suffix until it's unique instead of
+			// dropping r on a second collision; see uniqueCollisionName.
+			name = n.fs.uniqueCollisionName(name, r.br, seen)
+		}
+		seen[name] = true
+		ents[name] = &search.DescribedBlob{BlobRef: r.br}
+		modTime[name] = now
+		*lastNames = append(*lastNames, name)
+	}
+}
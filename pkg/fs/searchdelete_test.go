@@ -0,0 +1,49 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestRemoveRejectedWithoutAllowDelete checks that Remove returns
+// fuse.EPERM, without ever touching n.fs.client (which is left nil
+// here, so touching it would panic), when CamliFileSystem.AllowDelete
+// is left at its default false.
+func TestRemoveRejectedWithoutAllowDelete(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image"}
+	err := n.Remove(context.Background(), &fuse.RemoveRequest{Name: "photo.jpg"})
+	if err != fuse.EPERM {
+		t.Errorf("Remove() = %v; want fuse.EPERM", err)
+	}
+}
+
+// TestRemoveRejectedReadOnly checks that CamliFileSystem.ReadOnly takes
+// precedence over AllowDelete: a read-only mount rejects Remove even
+// if AllowDelete is set.
+func TestRemoveRejectedReadOnly(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{ReadOnly: true, AllowDelete: true}, searchExp: "is:image"}
+	err := n.Remove(context.Background(), &fuse.RemoveRequest{Name: "photo.jpg"})
+	if err == nil {
+		t.Fatal("Remove() = nil; want an error on a read-only mount")
+	}
+}
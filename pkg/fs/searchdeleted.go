@@ -0,0 +1,73 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// deletedPredicate is the search expression term that, ANDed onto an
+// existing expression, narrows it down to just the matches the server
+// would otherwise have excluded for being deleted: every expression
+// hides deleted permanodes by default, so this is how a caller opts
+// back into seeing them, one query at a time.
+const deletedPredicate = "is:deleted"
+
+// deletedSuffix marks a listed entry whose permanode the deleted-only
+// query found, so a plain "ls" makes it obvious which entries are
+// there for recovery rather than part of the live result set.
+const deletedSuffix = ".deleted"
+
+// deletedEntries runs n's own search expression again, narrowed to
+// just its deleted matches (see deletedPredicate), for doReaddir to
+// fold into its primary query's first page the same way
+// federatedEntries folds in extra servers. Like federatedEntries, only
+// the first page is fetched: deleted permanodes are for occasional
+// recovery browsing, not a result set large enough to justify a second
+// full pagination loop alongside the primary one. used is the same
+// used-names set federatedEntries maintains, so a deleted permanode
+// that happens to share a name with a live one still lists under a
+// distinct name. It returns nil unless n.fs.IncludeDeleted is set.
+func (n *searchResultDir) deletedEntries(ctx context.Context, seen map[string]bool, used map[string]bool, depth int) []dir.Entry {
+	if !n.fs.IncludeDeleted {
+		return nil
+	}
+	expr := fmt.Sprintf("(%s) and %s", n.effectiveSearchExpr(), deletedPredicate)
+	ents, _, _, _, _, _, _, _, _, err := dir.ResolvePage(ctx, n.fs.client, expr, n.at, "", seen, depth, n.effectiveDescribeRules(), search.UnspecifiedSort, n.fs.NameAttribute, n.fs.GroupByAttribute, n.fs.MIMEPreference, n.fs.effectiveContentIndirectionHops(), n.fs.IncludeContentless, n.fs.effectiveUndescribedContentPolicy(), n.fs.effectiveDescribeStrategy(), 0, n.fs.PrimaryContentAttr, n.fs.effectiveMaxInlineSetMembers(), n.fs.ContentAttrAliases, n.fs.TitleAttrAliases, n.fs.effectiveSpecialContentPolicy())
+	if err != nil {
+		Logger.Printf("fs.search: ReadDirAll for '%s': querying deleted entries: %v", n.searchExp, err)
+		return nil
+	}
+	for i := range ents {
+		ents[i].IsDeleted = true
+		ents[i].Name += deletedSuffix
+		for used[ents[i].Name] {
+			// Still colliding (e.g. a live entry was itself already
+			// named "foo.deleted"): the permanode's own blobref is
+			// always unique.
+			ents[i].Name += "-" + ents[i].Permanode.String()
+		}
+		used[ents[i].Name] = true
+	}
+	return ents
+}
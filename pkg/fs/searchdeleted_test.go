@@ -0,0 +1,102 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+	"perkeep.org/pkg/search"
+)
+
+// TestDeletedEntriesHiddenByDefault checks that deletedEntries never
+// issues its deleted-only query (which would panic on the nil
+// n.fs.client every test here leaves unset) unless
+// CamliFileSystem.IncludeDeleted is set.
+func TestDeletedEntriesHiddenByDefault(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image"}
+	if got := n.deletedEntries(context.Background(), map[string]bool{}, map[string]bool{}, 0); got != nil {
+		t.Errorf("deletedEntries() with IncludeDeleted unset = %v; want nil", got)
+	}
+}
+
+// TestLookupDeletedEntryIsReadOnlyAndMarked checks that a name listed
+// in n.deleted comes back from Lookup as a read-only
+// searchResultFile whose user.camli.deleted xattr is "1", the same
+// way a live entry with the same blobref would come back writable
+// and without that xattr. n.ents/n.schemaMeta are pre-populated and
+// n's cached listing is kept fresh (SearchCacheTTL in the future of
+// lastReaddir) so Lookup resolves straight from them instead of
+// calling ReadDirAll or fetchSchemaMeta, either of which would touch
+// the nil n.fs.client.
+func TestLookupDeletedEntryIsReadOnlyAndMarked(t *testing.T) {
+	blobref := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	pn := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+
+	n := &searchResultDir{
+		fs:          &CamliFileSystem{SearchCacheTTL: time.Hour},
+		searchExp:   "is:image",
+		lastReaddir: time.Now(),
+		ents: map[string]*search.DescribedBlob{
+			"deleted.jpg": {BlobRef: blobref, File: &search.DescribedFile{Size: 100}},
+			"live.jpg":    {BlobRef: blobref, File: &search.DescribedFile{Size: 100}},
+		},
+		permanode: map[string]blob.Ref{"deleted.jpg": pn, "live.jpg": pn},
+		deleted:   map[string]bool{"deleted.jpg": true},
+		schemaMeta: map[blob.Ref]*schema.Blob{
+			blobref: nil,
+		},
+	}
+
+	nod, err := n.Lookup(context.Background(), "deleted.jpg")
+	if err != nil {
+		t.Fatalf("Lookup(%q) = %v", "deleted.jpg", err)
+	}
+	f, ok := nod.(*searchResultFile)
+	if !ok {
+		t.Fatalf("Lookup(%q) returned %T; want *searchResultFile", "deleted.jpg", nod)
+	}
+	if !f.readOnly {
+		t.Errorf("deleted entry's readOnly = false; want true")
+	}
+	if !f.deleted {
+		t.Errorf("deleted entry's deleted = false; want true")
+	}
+	if got := f.camliXattrs()["user.camli.deleted"]; got != "1" {
+		t.Errorf("deleted entry's user.camli.deleted xattr = %q; want %q", got, "1")
+	}
+
+	nod, err = n.Lookup(context.Background(), "live.jpg")
+	if err != nil {
+		t.Fatalf("Lookup(%q) = %v", "live.jpg", err)
+	}
+	f, ok = nod.(*searchResultFile)
+	if !ok {
+		t.Fatalf("Lookup(%q) returned %T; want *searchResultFile", "live.jpg", nod)
+	}
+	if f.readOnly {
+		t.Errorf("live entry's readOnly = true; want false")
+	}
+	if _, ok := f.camliXattrs()["user.camli.deleted"]; ok {
+		t.Errorf("live entry unexpectedly has a user.camli.deleted xattr")
+	}
+}
@@ -0,0 +1,56 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// defaultSearchDescribeDepth is the describe depth a searchResultDir
+// uses when its CamliFileSystem leaves SearchDescribeDepth unset: deep
+// enough to resolve a set's direct members (so it doesn't list as
+// apparently empty), shallow enough to avoid describing an entire
+// collection tree just to list one directory.
+const defaultSearchDescribeDepth = 1
+
+// effectiveSearchDescribeDepth reports the describe depth fs actually
+// applies to its searchResultDirs: fs.SearchDescribeDepth (or
+// defaultSearchDescribeDepth, if unset), raised to
+// effectiveMemberExpandDepth if that's deeper.
+func (fs *CamliFileSystem) effectiveSearchDescribeDepth() int {
+	depth := defaultSearchDescribeDepth
+	if fs.SearchDescribeDepth > 0 {
+		depth = fs.SearchDescribeDepth
+	}
+	if d := fs.effectiveMemberExpandDepth(); d > depth {
+		depth = d
+	}
+	return depth
+}
+
+// maxMemberExpandDepth bounds MemberExpandDepth: deep enough for any
+// set hierarchy worth pre-populating, shallow enough that a runaway
+// config value can't ask the server to walk an unbounded collection
+// tree in a single describe.
+const maxMemberExpandDepth = 8
+
+// effectiveMemberExpandDepth reports the member-expansion depth fs
+// actually applies, capped at maxMemberExpandDepth.
+func (fs *CamliFileSystem) effectiveMemberExpandDepth() int {
+	if fs.MemberExpandDepth > maxMemberExpandDepth {
+		return maxMemberExpandDepth
+	}
+	return fs.MemberExpandDepth
+}
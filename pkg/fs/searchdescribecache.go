@@ -0,0 +1,168 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// defaultDescribedBlobCacheEntries is the entry budget
+// describedBlobCacheFor uses when CamliFileSystem.DescribedBlobCacheSize
+// isn't set.
+const defaultDescribedBlobCacheEntries = 4096
+
+// defaultDescribedBlobCacheTTL is how long describedBlobCacheFor trusts
+// a cached entry when CamliFileSystem.DescribedBlobCacheTTL isn't set.
+const defaultDescribedBlobCacheTTL = 5 * time.Minute
+
+// describedBlobCaches holds each CamliFileSystem's shared
+// describedBlobCache, keyed by pointer identity the same way
+// blobCacheFor's blobCaches registry is.
+var (
+	describedBlobCachesMu sync.Mutex
+	describedBlobCaches   = map[*CamliFileSystem]*describedBlobCache{}
+)
+
+// describedBlobCacheFor returns fsys's shared describedBlobCache,
+// creating it with fsys's configured budget (or the defaults above)
+// the first time any searchResultDir asks for it.
+func describedBlobCacheFor(fsys *CamliFileSystem) *describedBlobCache {
+	describedBlobCachesMu.Lock()
+	defer describedBlobCachesMu.Unlock()
+	if c, ok := describedBlobCaches[fsys]; ok {
+		return c
+	}
+	max := fsys.DescribedBlobCacheSize
+	if max <= 0 {
+		max = defaultDescribedBlobCacheEntries
+	}
+	c := &describedBlobCache{
+		maxEntries: max,
+		ll:         list.New(),
+		items:      make(map[blob.Ref]*list.Element),
+	}
+	describedBlobCaches[fsys] = c
+	return c
+}
+
+// describedBlobCache is a size-bounded, LRU, in-memory cache of
+// search.DescribedBlob results keyed by blobref, shared across every
+// searchResultDir opened against one CamliFileSystem. It's populated
+// by a direct, single-blobref describe (see describeRendition) that
+// more than one overlapping search directory can otherwise end up
+// issuing for the exact same permanode, and consulted before any such
+// describe goes out.
+type describedBlobCache struct {
+	maxEntries int
+
+	mu    sync.Mutex
+	ll    *list.List // of *describedBlobCacheEntry, front = most recently used
+	items map[blob.Ref]*list.Element
+}
+
+// describedBlobCacheEntry is describedBlobCache's list.Element.Value.
+type describedBlobCacheEntry struct {
+	ref     blob.Ref
+	db      *search.DescribedBlob
+	fetched time.Time
+}
+
+// get returns ref's cached describe metadata, moving it to the front
+// as most recently used, as long as it isn't older than maxAge. A
+// caller passes its own directory's effective refresh TTL (see
+// searchResultDir.describedBlobCacheMaxAge) as maxAge so a cached
+// entry never outlives what that directory's own staleness policy
+// would already consider stale, even though the cache itself is
+// shared and outlives any one directory's refresh cycle.
+func (c *describedBlobCache) get(ref blob.Ref, maxAge time.Duration) (*search.DescribedBlob, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[ref]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*describedBlobCacheEntry)
+	if time.Since(entry.fetched) > maxAge {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return entry.db, true
+}
+
+// put caches db under ref as the most recently used entry, evicting
+// the least recently used entry until the cache is back under
+// c.maxEntries.
+func (c *describedBlobCache) put(ref blob.Ref, db *search.DescribedBlob) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[ref]; ok {
+		entry := e.Value.(*describedBlobCacheEntry)
+		entry.db = db
+		entry.fetched = time.Now()
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[ref] = c.ll.PushFront(&describedBlobCacheEntry{ref: ref, db: db, fetched: time.Now()})
+	for c.ll.Len() > c.maxEntries {
+		back := c.ll.Back()
+		if back == nil {
+			break
+		}
+		entry := back.Value.(*describedBlobCacheEntry)
+		c.ll.Remove(back)
+		delete(c.items, entry.ref)
+	}
+}
+
+// stats reports c's current occupancy for statusFileName: how many
+// blobrefs it holds, and its configured entry budget.
+func (c *describedBlobCache) stats() (items, maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items), c.maxEntries
+}
+
+// effectiveDescribedBlobCacheTTL reports the TTL fsys actually applies
+// to describedBlobCache entries: its configured
+// DescribedBlobCacheTTL if positive, otherwise
+// defaultDescribedBlobCacheTTL.
+func (fsys *CamliFileSystem) effectiveDescribedBlobCacheTTL() time.Duration {
+	if fsys.DescribedBlobCacheTTL > 0 {
+		return fsys.DescribedBlobCacheTTL
+	}
+	return defaultDescribedBlobCacheTTL
+}
+
+// describedBlobCacheMaxAge is the maxAge n passes to
+// describedBlobCache.get: the shorter of the cache's own TTL and n's
+// own effectiveSearchCacheTTL, so a directory configured with a
+// tighter refresh policy than the shared cache's default never trusts
+// a cached entry longer than it would trust its own listing.
+func (n *searchResultDir) describedBlobCacheMaxAge() time.Duration {
+	ttl := n.fs.effectiveDescribedBlobCacheTTL()
+	if dirTTL := n.effectiveSearchCacheTTL(); dirTTL < ttl {
+		ttl = dirTTL
+	}
+	return ttl
+}
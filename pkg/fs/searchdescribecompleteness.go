@@ -0,0 +1,31 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// describeCompletenessFraction reports what fraction of a page's
+// pageSize entries needed a fallback describe or were left
+// unresolved, for comparison against
+// CamliFileSystem.DescribeCompletenessRetryThreshold. It reports 0
+// for an empty page, rather than dividing by zero.
+func describeCompletenessFraction(fallbacks, unresolved, pageSize int) float64 {
+	if pageSize == 0 {
+		return 0
+	}
+	return float64(fallbacks+unresolved) / float64(pageSize)
+}
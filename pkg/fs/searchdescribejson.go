@@ -0,0 +1,62 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+)
+
+// describeJSONSuffix names the per-entry control file exposing the raw
+// search.DescribedBlob the server returned for an entry's camliContent,
+// straight from n.ents, as opposed to sidecarSuffix's curated
+// permanode-attribute summary. It's lower-level and intended for
+// debugging why an entry resolved (or failed to resolve) a certain
+// way, which is also why, unlike the sidecar, it's gated behind
+// ExposeDescribeJSON rather than always resolvable.
+const describeJSONSuffix = ".describe.json"
+
+// describeJSONContents renders describeJSONSuffix's content for base,
+// one of n.lastNames: the search.DescribedBlob describing its
+// camliContent, marshaled exactly as the server returned it. It must
+// be called with n.mu held, since it reads n.ents, and returns
+// fuse.ENOENT if base isn't currently a known entry with content to
+// describe (e.g. a set or symlink, which have no n.ents entry).
+func (n *searchResultDir) describeJSONContents(base string) ([]byte, error) {
+	db, ok := n.ents[base]
+	if !ok || db == nil {
+		return nil, fuse.ENOENT
+	}
+	return json.MarshalIndent(db, "", "\t")
+}
+
+// direntsWithDescribeJSON is direntsWithWebURLs, plus one
+// "<name>.describe.json" dirent per name in names when
+// n.fs.ExposeDescribeJSON is set.
+func (n *searchResultDir) direntsWithDescribeJSON(names []string, refs map[string]blob.Ref, kinds map[string]fuse.DirentType) []fuse.Dirent {
+	ents := n.direntsWithWebURLs(names, refs, kinds)
+	if n.fs.ExposeDescribeJSON {
+		for _, name := range names {
+			ents = append(ents, fuse.Dirent{Name: name + describeJSONSuffix, Type: fuse.DT_File})
+		}
+	}
+	return ents
+}
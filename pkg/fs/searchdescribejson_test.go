@@ -0,0 +1,60 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// TestDescribeJSONContentsRoundTrips checks that describeJSONContents
+// marshals the cached DescribedBlob for a known entry in a form that
+// unmarshals back into an equivalent search.DescribedBlob, with no
+// round trip to the server.
+func TestDescribeJSONContentsRoundTrips(t *testing.T) {
+	pn := blob.MustParse("sha224-3333333333333333333333333333333333333333333333333333333333333333")
+	db := &search.DescribedBlob{BlobRef: pn}
+	n := &searchResultDir{ents: map[string]*search.DescribedBlob{"photo.jpg": db}}
+
+	contents, err := n.describeJSONContents("photo.jpg")
+	if err != nil {
+		t.Fatalf("describeJSONContents() error = %v", err)
+	}
+	var got search.DescribedBlob
+	if err := json.Unmarshal(contents, &got); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v", contents, err)
+	}
+	if got.BlobRef != pn {
+		t.Errorf("got.BlobRef = %v; want %v", got.BlobRef, pn)
+	}
+}
+
+// TestDescribeJSONContentsUnknownBase checks that describeJSONContents
+// reports ENOENT for a base that isn't a currently known entry,
+// rather than marshaling a nil DescribedBlob.
+func TestDescribeJSONContentsUnknownBase(t *testing.T) {
+	n := &searchResultDir{ents: map[string]*search.DescribedBlob{}}
+	if _, err := n.describeJSONContents("missing.jpg"); err != fuse.ENOENT {
+		t.Errorf("describeJSONContents() error = %v; want fuse.ENOENT", err)
+	}
+}
@@ -0,0 +1,45 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ValidateDescribeRules reports an error if fsys.DescribeRules is
+// non-nil but empty, or has a rule with no attrs, either of which
+// would have ReadDirAll ask the server to describe nothing. A fsys
+// with DescribeRules unset returns nil without doing anything, the
+// same as ValidateNameTemplate and ValidateImageSymlinks do for their
+// own unset fields.
+func ValidateDescribeRules(fsys *CamliFileSystem) error {
+	if fsys.DescribeRules == nil {
+		return nil
+	}
+	if len(fsys.DescribeRules) == 0 {
+		return errors.New("fs: DescribeRules is set but empty")
+	}
+	for i, rule := range fsys.DescribeRules {
+		if len(rule.Attrs) == 0 {
+			return fmt.Errorf("fs: DescribeRules[%d] has no attrs", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"reflect"
+	"testing"
+
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// TestValidateDescribeRules checks that a nil DescribeRules passes, an
+// empty-but-non-nil one is rejected, and a rule with no attrs is
+// rejected, even alongside other, valid rules.
+func TestValidateDescribeRules(t *testing.T) {
+	if err := ValidateDescribeRules(&CamliFileSystem{}); err != nil {
+		t.Errorf("ValidateDescribeRules(unset) = %v; want nil", err)
+	}
+	if err := ValidateDescribeRules(&CamliFileSystem{DescribeRules: []*search.DescribeRule{}}); err == nil {
+		t.Error("ValidateDescribeRules(empty) = nil; want an error")
+	}
+	if err := ValidateDescribeRules(&CamliFileSystem{DescribeRules: []*search.DescribeRule{{Attrs: []string{"camliContent"}}, {}}}); err == nil {
+		t.Error("ValidateDescribeRules(rule with no attrs) = nil; want an error")
+	}
+	if err := ValidateDescribeRules(&CamliFileSystem{DescribeRules: []*search.DescribeRule{{Attrs: []string{"camliContent"}}}}); err != nil {
+		t.Errorf("ValidateDescribeRules(valid) = %v; want nil", err)
+	}
+}
+
+// TestEffectiveDescribeRulesForMergesExtraAttrs checks that
+// DescribeExtraAttrs is merged onto dir.DefaultDescribeRules, that an
+// explicit DescribeRules takes precedence over it, and that the
+// mount-wide describeRulesFileName override takes precedence over
+// both.
+func TestEffectiveDescribeRulesForMergesExtraAttrs(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	got := effectiveDescribeRulesFor(fsys)
+	if !reflect.DeepEqual(got, dir.DefaultDescribeRules) {
+		t.Errorf("effectiveDescribeRulesFor(unset) = %v; want dir.DefaultDescribeRules", got)
+	}
+
+	fsys = &CamliFileSystem{DescribeExtraAttrs: []string{"location", "album"}}
+	got = effectiveDescribeRulesFor(fsys)
+	want := append(append([]string{}, dir.DefaultDescribeRules[0].Attrs...), "location", "album")
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Attrs, want) {
+		t.Errorf("effectiveDescribeRulesFor(extra attrs) = %v; want a single rule with attrs %v", got, want)
+	}
+
+	custom := []*search.DescribeRule{{Attrs: []string{"camliContent"}}}
+	fsys = &CamliFileSystem{DescribeRules: custom, DescribeExtraAttrs: []string{"location"}}
+	got = effectiveDescribeRulesFor(fsys)
+	if !reflect.DeepEqual(got, custom) {
+		t.Errorf("effectiveDescribeRulesFor(DescribeRules set) = %v; want %v, ignoring DescribeExtraAttrs", got, custom)
+	}
+
+	describeRuleOverridesMu.Lock()
+	describeRuleOverrides[fsys] = []string{"overrideAttr"}
+	describeRuleOverridesMu.Unlock()
+	got = effectiveDescribeRulesFor(fsys)
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Attrs, []string{"overrideAttr"}) {
+		t.Errorf("effectiveDescribeRulesFor(runtime override) = %v; want a single rule with attrs [overrideAttr]", got)
+	}
+}
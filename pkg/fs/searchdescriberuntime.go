@@ -0,0 +1,158 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// describeRulesFileName is a hidden control file at the "search"
+// directory's own root (see searchDir.Lookup): writing a
+// newline-separated attribute list to it overrides
+// CamliFileSystem.DescribeRules for every searchResultDir sharing
+// this mount, for the rest of the mount's session, so a new attribute
+// can be tried out without remounting. Reading it back reports the
+// attrs currently in effect (see describeRulesContents), the static
+// DescribeRules config if no override has been written yet. Unlike
+// camlifsFileName's own "fields" setting, which only ever affects the
+// one searchResultDir it's written to, this affects every one of
+// them, the same way CamliFileSystem.DescribeRules itself does.
+const describeRulesFileName = ".describe-rules"
+
+// describeRuleOverrides holds each CamliFileSystem's runtime describe
+// attrs override, if any, keyed by pointer identity the same way
+// queryStatsRegistry is.
+var (
+	describeRuleOverridesMu sync.Mutex
+	describeRuleOverrides   = map[*CamliFileSystem][]string{}
+)
+
+// parseDescribeRuleAttrs splits content into its non-blank lines,
+// rejecting it outright if any line has embedded whitespace of its
+// own (no permanode attr name ever does) or if it has no attrs at
+// all.
+func parseDescribeRuleAttrs(content []byte) ([]string, error) {
+	var attrs []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.ContainsAny(line, " \t") {
+			return nil, fmt.Errorf("invalid attribute spec %q", line)
+		}
+		attrs = append(attrs, line)
+	}
+	if len(attrs) == 0 {
+		return nil, fmt.Errorf("no attributes given")
+	}
+	return attrs, nil
+}
+
+// effectiveDescribeRulesFor returns fsys's runtime describe rule
+// override, wrapped in a single rule the same shape
+// CamliFileSystem.DescribeRules itself takes, if describeRulesFileName
+// has been written for fsys; otherwise fsys.DescribeRules unchanged if
+// set, otherwise dir.DefaultDescribeRules with fsys.DescribeExtraAttrs
+// merged onto it (see CamliFileSystem.DescribeExtraAttrs).
+func effectiveDescribeRulesFor(fsys *CamliFileSystem) []*search.DescribeRule {
+	describeRuleOverridesMu.Lock()
+	attrs := describeRuleOverrides[fsys]
+	describeRuleOverridesMu.Unlock()
+	if len(attrs) > 0 {
+		return []*search.DescribeRule{{Attrs: attrs}}
+	}
+	if fsys.DescribeRules != nil {
+		return fsys.DescribeRules
+	}
+	if len(fsys.DescribeExtraAttrs) == 0 {
+		return dir.DefaultDescribeRules
+	}
+	merged := append(append([]string{}, dir.DefaultDescribeRules[0].Attrs...), fsys.DescribeExtraAttrs...)
+	return []*search.DescribeRule{{Attrs: merged}}
+}
+
+// describeRulesContents renders describeRulesFileName's read content:
+// one attribute per line, from whichever ruleset is currently in
+// effect for fsys.
+func describeRulesContents(fsys *CamliFileSystem) []byte {
+	var attrs []string
+	for _, rule := range effectiveDescribeRulesFor(fsys) {
+		attrs = append(attrs, rule.Attrs...)
+	}
+	return []byte(strings.Join(attrs, "\n") + "\n")
+}
+
+// describeRulesFile is describeRulesFileName's Node and Handle:
+// writing a newline-separated attribute list applies it as fsys's
+// mount-wide runtime describe rule override (see
+// parseDescribeRuleAttrs); reading renders describeRulesContents.
+type describeRulesFile struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node         = describeRulesFile{}
+	_ fs.HandleReader = describeRulesFile{}
+	_ fs.HandleWriter = describeRulesFile{}
+)
+
+func (f describeRulesFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Valid = f.fs.effectiveAttrValidity()
+	a.Size = uint64(len(describeRulesContents(f.fs)))
+	return nil
+}
+
+func (f describeRulesFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := describeRulesContents(f.fs)
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = content[req.Offset:end]
+	return nil
+}
+
+func (f describeRulesFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := f.fs.checkWritable(); err != nil {
+		return err
+	}
+	attrs, err := parseDescribeRuleAttrs(req.Data)
+	if err != nil {
+		Logger.Printf("fs.search: %q write: %v", describeRulesFileName, err)
+		return fuse.EINVAL
+	}
+	describeRuleOverridesMu.Lock()
+	describeRuleOverrides[f.fs] = attrs
+	describeRuleOverridesMu.Unlock()
+	resp.Size = len(req.Data)
+	return nil
+}
@@ -0,0 +1,53 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "perkeep.org/pkg/search/dir"
+
+// DescribeStrategy selects how a searchResultDir's dir.ResolvePage
+// calls obtain describe metadata for a page of results.
+type DescribeStrategy int
+
+const (
+	// DescribeEmbedded sends the describe request as part of the
+	// search query itself, the historical behavior and the right
+	// choice for a server whose query and describe paths are equally
+	// cheap.
+	DescribeEmbedded DescribeStrategy = iota
+
+	// DescribeSeparate sends the search query with no describe
+	// request, then batch-describes the page's blobrefs in one or
+	// more follow-up calls. It suits a server whose embedded describe
+	// is capped lower than the query's own result limit, at the cost
+	// of an extra round trip per page. It's silently equivalent to
+	// DescribeEmbedded's own query if the configured client doesn't
+	// support a separate describe call.
+	DescribeSeparate
+)
+
+// effectiveDescribeStrategy reports the dir.DescribeStrategy fs
+// actually applies to its searchResultDirs' dir.ResolvePage calls.
+func (fsys *CamliFileSystem) effectiveDescribeStrategy() dir.DescribeStrategy {
+	switch fsys.DescribeStrategy {
+	case DescribeSeparate:
+		return dir.DescribeSeparate
+	default:
+		return dir.DescribeEmbedded
+	}
+}
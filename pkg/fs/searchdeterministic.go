@@ -0,0 +1,49 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"sort"
+
+	"perkeep.org/pkg/search/dir"
+)
+
+// deterministicSortKey is the key sortEntriesDeterministically sorts
+// by: de's content blobref, or its permanode's own blobref for an
+// entry with no content (a set, symlink, or contentless permanode).
+func deterministicSortKey(de dir.Entry) string {
+	if de.Blob != nil {
+		return de.Blob.BlobRef.String()
+	}
+	return de.Permanode.String()
+}
+
+// sortEntriesDeterministically stable-sorts dents in place by
+// deterministicSortKey, breaking a tie (two entries sharing a content
+// blobref, e.g. identical file content under different permanodes)
+// by Name so the result never depends on dents' incoming order.
+func sortEntriesDeterministically(dents []dir.Entry) {
+	sort.SliceStable(dents, func(i, j int) bool {
+		ki, kj := deterministicSortKey(dents[i]), deterministicSortKey(dents[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return dents[i].Name < dents[j].Name
+	})
+}
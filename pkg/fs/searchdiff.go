@@ -0,0 +1,230 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+	"perkeep.org/pkg/types"
+)
+
+// diffDirPrefix is the "search" directory's reserved prefix for a diff
+// directory: "search/diff/<A>|<B>" lists the entries present in A's
+// results but not in B's (A minus B, never the symmetric difference),
+// compared by content blobref rather than by name or permanode, so an
+// entry that's merely been renamed or re-permanoded without its
+// content changing doesn't show up as a difference. Complements
+// unionDirPrefix's OR and drillDown's AND with a third set operation.
+//
+// Either side may instead be the same expression pinned to two
+// different moments, e.g. "search/diff/is:image@-7d|is:image", to
+// ask what's changed over a window rather than between two distinct
+// expressions; see diffSideAtSep.
+const diffDirPrefix = "diff/"
+
+// diffSideSep separates A from B under diffDirPrefix, the same
+// character unionExprSep uses to separate union's expressions. A side
+// that needs a literal diffSideSep (or diffSideAtSep) must be given in
+// its encodeSearchExprPath form so splitting doesn't cut it in two.
+const diffSideSep = "|"
+
+// diffSideAtSep marks the point-in-time suffix on one side of a
+// diffDirPrefix path, e.g. "is:image@-7d" pins that side's query to
+// what is:image matched seven days ago; see parseAtTime for the
+// accepted time formats. A side with no diffSideAtSep runs as of now.
+const diffSideAtSep = "@"
+
+// lookupDiffDir parses rest (name with diffDirPrefix already trimmed)
+// as diffSideSep-separated A and B sides, each optionally carrying its
+// own diffSideAtSep time pin, and returns the diffResultDir comparing
+// them. It's an error (fuse.ENOENT) for rest to have anything other
+// than exactly two sides: a diff is always between two things.
+func (n *searchDir) lookupDiffDir(name, rest string) (fs.Node, error) {
+	parts := strings.Split(rest, diffSideSep)
+	if len(parts) != 2 {
+		Logger.Printf("fs.search: diff: Lookup(%q): want exactly 2 sides separated by %q, got %d", name, diffSideSep, len(parts))
+		return nil, fuse.ENOENT
+	}
+	now := time.Now()
+	a, err := parseDiffSide(n.fs, parts[0], now)
+	if err != nil {
+		Logger.Printf("fs.search: diff: Lookup(%q): side A: %v", name, err)
+		return nil, fuse.EINVAL
+	}
+	b, err := parseDiffSide(n.fs, parts[1], now)
+	if err != nil {
+		Logger.Printf("fs.search: diff: Lookup(%q): side B: %v", name, err)
+		return nil, fuse.EINVAL
+	}
+	return &diffResultDir{fs: n.fs, a: a, b: b}, nil
+}
+
+// diffSide is one half of a diffDirPrefix path: an expression, and the
+// point in time (nil meaning now) to evaluate it as of.
+type diffSide struct {
+	expr string
+	at   *types.Time3339
+}
+
+// parseDiffSide decodes one diffDirPrefix side into its expression and
+// optional time pin: a trailing diffSideAtSep splits off a suffix
+// that, if it parses under parseAtTime, pins the query to that moment;
+// otherwise the whole of part (diffSideAtSep included, if any) is
+// taken as a literal expression that merely happens to contain an "@".
+func parseDiffSide(fsys *CamliFileSystem, part string, now time.Time) (diffSide, error) {
+	expr := part
+	if decoded, ok := decodeSearchExprPath(part); ok {
+		expr = decoded
+	}
+	if i := strings.LastIndex(expr, diffSideAtSep); i >= 0 {
+		if t, err := parseAtTime(expr[i+1:]); err == nil {
+			expanded, err := expandExpressionMacros(fsys, expr[:i], now)
+			if err != nil {
+				return diffSide{}, err
+			}
+			return diffSide{expr: expandRelativeDates(expanded, now), at: &t}, nil
+		}
+	}
+	expanded, err := expandExpressionMacros(fsys, expr, now)
+	if err != nil {
+		return diffSide{}, err
+	}
+	return diffSide{expr: expandRelativeDates(expanded, now)}, nil
+}
+
+// diffResultDir is the directory a "search/diff/<A>|<B>" path resolves
+// to: A's entries whose content blobref doesn't also appear among B's,
+// A minus B. A query that fails fails the whole listing, unlike
+// unionResultDir's skip-and-continue, since a diff where one side
+// never ran isn't a diff at all.
+type diffResultDir struct {
+	fs *CamliFileSystem
+	a  diffSide
+	b  diffSide
+
+	mu         sync.Mutex
+	resolved   bool
+	resolveErr error
+	names      []string
+	entries    map[string]dir.Entry
+}
+
+var (
+	_ fs.Node               = (*diffResultDir)(nil)
+	_ fs.HandleReadDirAller = (*diffResultDir)(nil)
+	_ fs.NodeStringLookuper = (*diffResultDir)(nil)
+)
+
+func (n *diffResultDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+// resolve runs both sides and computes A minus B by content blobref,
+// caching the result the same idempotent way unionResultDir.resolve
+// does.
+func (n *diffResultDir) resolve(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.resolved {
+		return n.resolveErr
+	}
+	n.resolved = true
+
+	aEnts, err := dir.Resolve(ctx, n.fs.client, n.a.expr, n.a.at)
+	if err != nil {
+		n.resolveErr = fmt.Errorf("fs.diff: querying side A %q: %w", n.a.expr, err)
+		return n.resolveErr
+	}
+	bEnts, err := dir.Resolve(ctx, n.fs.client, n.b.expr, n.b.at)
+	if err != nil {
+		n.resolveErr = fmt.Errorf("fs.diff: querying side B %q: %w", n.b.expr, err)
+		return n.resolveErr
+	}
+
+	inB := make(map[string]bool, len(bEnts))
+	for _, e := range bEnts {
+		inB[deterministicSortKey(e)] = true
+	}
+
+	names := make([]string, 0)
+	entries := make(map[string]dir.Entry)
+	for _, e := range aEnts {
+		if inB[deterministicSortKey(e)] {
+			continue
+		}
+		name := e.Name
+		if name == "" {
+			name = e.Permanode.String()
+		}
+		for i := 2; ; i++ {
+			if _, taken := entries[name]; !taken {
+				break
+			}
+			name = fmt.Sprintf("%s.%d", e.Name, i)
+		}
+		names = append(names, name)
+		entries[name] = e
+	}
+	n.names = names
+	n.entries = entries
+	return nil
+}
+
+func (n *diffResultDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := n.resolve(ctx); err != nil {
+		return nil, queryErrno(err)
+	}
+	n.mu.Lock()
+	names := n.names
+	refs := make(map[string]blob.Ref, len(n.entries))
+	kinds := make(map[string]fuse.DirentType, len(n.entries))
+	for name, e := range n.entries {
+		refs[name] = e.Permanode
+		kinds[name] = entryDirentKind(n.fs, e)
+	}
+	n.mu.Unlock()
+	return direntsWithInode(n.fs, names, refs, kinds), nil
+}
+
+func (n *diffResultDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := n.resolve(ctx); err != nil {
+		return nil, queryErrno(err)
+	}
+	n.mu.Lock()
+	e, ok := n.entries[name]
+	at := n.a.at
+	n.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return entryNode(n.fs, e, at), nil
+}
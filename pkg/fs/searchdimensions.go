@@ -0,0 +1,58 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dimensionsFileName is a hidden, per-searchResultDir file listing
+// every image entry's raw and EXIF-oriented width and height as
+// tab-separated values, for a gallery that wants every dimension in
+// the directory up front rather than paying one xattr round trip per
+// file (see searchResultFile.Getxattr's
+// "user.camli.imageWidth"/"imageHeight" and their "...Oriented"
+// counterparts). Like queryFileName, it's always resolvable via
+// Lookup; see CamliFileSystem.ShowDotfiles for whether it's also
+// listed in ReadDirAll.
+const dimensionsFileName = ".dimensions.tsv"
+
+// dimensionsFileContents renders dimensionsFileName's content: one
+// "name\twidth\theight\torientedWidth\torientedHeight" line per name
+// in n.lastNames whose describe meta included camliContentImage
+// dimensions (n.imageMeta), skipping anything else (markers, sets,
+// symlinks, non-image files) since there's no dimension to report for
+// them. orientedWidth/orientedHeight equal width/height whenever
+// orientedDimensions finds no EXIF orientation to rotate them by.
+// Like resultsJSONContents, it's a lazy snapshot regenerated from
+// whatever ReadDirAll last cached, not a fresh query, so it must be
+// called with n.mu held.
+func (n *searchResultDir) dimensionsFileContents() string {
+	var b strings.Builder
+	for _, name := range n.lastNames {
+		db := n.imageMeta[name]
+		if db == nil || db.Image == nil {
+			continue
+		}
+		_, _, orientedW, orientedH := orientedDimensions(db.Image)
+		fmt.Fprintf(&b, "%s\t%d\t%d\t%d\t%d\n", name, db.Image.Width, db.Image.Height, orientedW, orientedH)
+	}
+	return b.String()
+}
@@ -0,0 +1,219 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+)
+
+// maxDirBlobEntries bounds how many of a directory schema blob's
+// static entries dirBlobDir will resolve and list, the same
+// protection maxSearchResultEntries gives searchResultDir: a
+// camliContent that resolved to a directory can point at an
+// arbitrarily large imported tree.
+const maxDirBlobEntries = 10000
+
+// dirBlobEntryPageSize is how many entries resolve fetches schema
+// metadata for at a time, so a directory past maxDirBlobEntries never
+// needs its full entry list resolved before giving up.
+const dirBlobEntryPageSize = 256
+
+// dirBlobDir is a browsable directory backed directly by a "dir"
+// schema blob's static entries (see schema.Blob.DirectoryEntries),
+// rather than by a search: it's what a camliContent resolving to a
+// directory (db.Dir != nil in searchResultDir.Lookup) becomes, so
+// such a permanode can be navigated into instead of only appearing as
+// a flat, unopenable entry.
+type dirBlobDir struct {
+	fs       *CamliFileSystem
+	ref      blob.Ref // the directory schema blob itself
+	readOnly bool
+
+	mu        sync.Mutex
+	resolved  bool
+	names     []string
+	refs      map[string]blob.Ref
+	children  map[string]*schema.Blob
+	truncated bool
+}
+
+var (
+	_ fs.Node               = (*dirBlobDir)(nil)
+	_ fs.HandleReadDirAller = (*dirBlobDir)(nil)
+	_ fs.NodeStringLookuper = (*dirBlobDir)(nil)
+)
+
+func (n *dirBlobDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	a.Inode = inodeTableFor(n.fs).inodeFor(n.ref)
+	return nil
+}
+
+// resolve fetches n.ref's own schema blob, then pages through its
+// DirectoryEntries (dirBlobEntryPageSize at a time), fetching each
+// child's schema blob for its name and type and stopping once
+// maxDirBlobEntries have been resolved. It's idempotent: only the
+// first call does any work, the rest reuse n.names/n.refs/n.children.
+func (n *dirBlobDir) resolve(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.resolved {
+		return nil
+	}
+	dirMeta, err := n.fs.fetchSchemaMeta(ctx, n.ref)
+	if err != nil {
+		Logger.Printf("fs.dirBlobDir: fetching schema meta for %v: %v", n.ref, err)
+		return fuse.EIO
+	}
+	childRefs, err := dirMeta.DirectoryEntries(ctx, n.fs.client)
+	if err != nil {
+		Logger.Printf("fs.dirBlobDir: listing entries of %v: %v", n.ref, err)
+		return fuse.EIO
+	}
+
+	names := make([]string, 0, len(childRefs))
+	refs := make(map[string]blob.Ref, len(childRefs))
+	children := make(map[string]*schema.Blob, len(childRefs))
+	truncated := false
+pages:
+	for start := 0; start < len(childRefs); start += dirBlobEntryPageSize {
+		end := start + dirBlobEntryPageSize
+		if end > len(childRefs) {
+			end = len(childRefs)
+		}
+		for _, ref := range childRefs[start:end] {
+			if len(names) >= maxDirBlobEntries {
+				truncated = true
+				break pages
+			}
+			meta, err := n.fs.fetchSchemaMeta(ctx, ref)
+			if err != nil {
+				Logger.Printf("fs.dirBlobDir: resolving entry %v of %v: %v", ref, n.ref, err)
+				continue
+			}
+			name := meta.FileName()
+			if name == "" {
+				name = ref.String()
+			}
+			for i := 2; children[name] != nil; i++ {
+				name = fmt.Sprintf("%s.%d", meta.FileName(), i)
+			}
+			names = append(names, name)
+			refs[name] = ref
+			children[name] = meta
+		}
+	}
+	n.names = names
+	n.refs = refs
+	n.children = children
+	n.truncated = truncated
+	n.resolved = true
+	return nil
+}
+
+func (n *dirBlobDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := n.resolve(ctx); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	names := n.names
+	refs := n.refs
+	kinds := make(map[string]fuse.DirentType, len(n.children))
+	for name, meta := range n.children {
+		kinds[name] = dirBlobDirentKind(meta)
+	}
+	truncated := n.truncated
+	n.mu.Unlock()
+	ents := direntsWithInode(n.fs, names, refs, kinds)
+	if truncated {
+		ents = append(ents, fuse.Dirent{Name: truncatedMarkerName, Type: fuse.DT_File})
+	}
+	return ents, nil
+}
+
+// dirBlobDirentKind reports the fuse.DirentType Lookup resolves meta
+// to, matching its own switch on meta.Type() below; also used by
+// staticSetDir.ReadDirAll, whose Lookup switches on the same types.
+func dirBlobDirentKind(meta *schema.Blob) fuse.DirentType {
+	switch meta.Type() {
+	case "directory", "static-set":
+		return fuse.DT_Dir
+	case "symlink":
+		return fuse.DT_Link
+	default:
+		return fuse.DT_File
+	}
+}
+
+func (n *dirBlobDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == truncatedMarkerName {
+		n.mu.Lock()
+		truncated := n.truncated
+		n.mu.Unlock()
+		if !truncated {
+			return nil, fuse.ENOENT
+		}
+		return staticFileNode("This listing was truncated; see maxDirBlobEntries.\n"), nil
+	}
+	if err := n.resolve(ctx); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	meta, ok := n.children[name]
+	ref := n.refs[name]
+	n.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	switch meta.Type() {
+	case "directory":
+		return &dirBlobDir{fs: n.fs, ref: ref, readOnly: n.readOnly}, nil
+	case "static-set":
+		return &staticSetDir{fs: n.fs, ref: ref, readOnly: n.readOnly}, nil
+	case "symlink":
+		return &searchResultSymlink{
+			node:   node{fs: n.fs, blobref: ref},
+			target: meta.SymlinkTargetString(),
+		}, nil
+	default:
+		nod := &searchResultFile{
+			node:         node{fs: n.fs, blobref: ref},
+			readOnly:     n.readOnly,
+			schemaMeta:   meta,
+			schemaMetaAt: time.Now(),
+		}
+		if size := meta.PartsSize(); size > 0 {
+			nod.size = uint64(size)
+			nod.haveSize = true
+		}
+		return nod, nil
+	}
+}
@@ -0,0 +1,191 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultSearchDirCacheSize is the LRU size searchDirCacheFor uses
+// when CamliFileSystem.SearchDirCacheSize isn't set, a generous bound
+// for typical interactive use that still keeps a long-lived mount's
+// memory use from growing without limit.
+const defaultSearchDirCacheSize = 256
+
+// searchDirCaches holds each CamliFileSystem's searchResultDir LRU,
+// keyed by pointer identity the same way searchbreaker.go's breakers
+// registry is.
+var (
+	searchDirCachesMu sync.Mutex
+	searchDirCaches   = map[*CamliFileSystem]*searchDirCache{}
+)
+
+// searchDirCache bounds how many distinct search expressions' worth
+// of searchResultDir state a mount keeps live at once, evicting the
+// least recently used past its cap (see
+// CamliFileSystem.SearchDirCacheSize) so a mount that's been "cd"ed
+// into many different expressions over a long session doesn't keep
+// all of their ents/modTime/lastNames maps around forever.
+type searchDirCache struct {
+	cap int
+
+	mu    sync.Mutex
+	ll    *list.List               // of *searchDirCacheEntry, front = most recently used
+	items map[string]*list.Element // search expression to its element in ll
+}
+
+// searchDirCacheEntry is searchDirCache's list.Element.Value.
+type searchDirCacheEntry struct {
+	expr string
+	dir  *searchResultDir
+}
+
+// searchDirCacheFor returns fsys's shared searchDirCache, creating it
+// with fsys's configured size (or defaultSearchDirCacheSize) the first
+// time any searchDir asks for it.
+func searchDirCacheFor(fsys *CamliFileSystem) *searchDirCache {
+	searchDirCachesMu.Lock()
+	defer searchDirCachesMu.Unlock()
+	if c, ok := searchDirCaches[fsys]; ok {
+		return c
+	}
+	size := fsys.SearchDirCacheSize
+	if size <= 0 {
+		size = defaultSearchDirCacheSize
+	}
+	c := &searchDirCache{
+		cap:   size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+	searchDirCaches[fsys] = c
+	return c
+}
+
+// get returns expr's cached searchResultDir, if any, moving it to the
+// front as the most recently used.
+func (c *searchDirCache) get(expr string) (*searchResultDir, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[expr]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*searchDirCacheEntry).dir, true
+}
+
+// add inserts dir under expr as the most recently used entry, evicting
+// the least recently used one if that puts the cache over its cap. It
+// does nothing if expr is already cached, since get (called first by
+// every lookup that can reach add) would have returned that entry
+// instead.
+func (c *searchDirCache) add(expr string, dir *searchResultDir) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[expr]; ok {
+		return
+	}
+	c.items[expr] = c.ll.PushFront(&searchDirCacheEntry{expr: expr, dir: dir})
+	for c.ll.Len() > c.cap && c.evictOldest() {
+	}
+}
+
+// stats reports c's current occupancy for statusFileName: how many
+// search expressions it holds a searchResultDir for, and its
+// configured cap.
+func (c *searchDirCache) stats() (dirs, capacity int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len(), c.cap
+}
+
+// snapshot returns a SearchDirInfo for every entry c currently holds,
+// in most-recently-used order, for CachedSearchDirs. It only reads
+// c's own list under c.mu; each entry's own counts/age/memory
+// estimate are read from its searchResultDir independently (see
+// searchResultDir.info), so a concurrent ReadDirAll elsewhere can't
+// make this block or see a half-updated dir.
+func (c *searchDirCache) snapshot() []SearchDirInfo {
+	c.mu.Lock()
+	dirs := make([]*searchResultDir, 0, c.ll.Len())
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		dirs = append(dirs, e.Value.(*searchDirCacheEntry).dir)
+	}
+	c.mu.Unlock()
+
+	infos := make([]SearchDirInfo, len(dirs))
+	for i, dir := range dirs {
+		infos[i] = dir.info()
+	}
+	return infos
+}
+
+// rawSnapshot returns every searchResultDir c currently holds, in the
+// same most-recently-used order as snapshot, for manifestContents to
+// read each one's own cached entries directly. Unlike snapshot, it
+// hands back the *searchResultDir itself rather than a SearchDirInfo,
+// so the caller can read more than info() exposes; it still only
+// reads c's own list under c.mu, same as snapshot.
+func (c *searchDirCache) rawSnapshot() []*searchResultDir {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dirs := make([]*searchResultDir, 0, c.ll.Len())
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		dirs = append(dirs, e.Value.(*searchDirCacheEntry).dir)
+	}
+	return dirs
+}
+
+// evictOldest drops the least recently used entry that isn't pinned
+// by a live open file under it (see searchResultDir.hasOpenRefs),
+// walking forward from the back until it finds one to drop, reporting
+// whether it found one. A cache where every entry is pinned is left
+// over its cap rather than evicting something still in active use; it
+// shrinks back down as soon as those opens close. c.mu must be held.
+func (c *searchDirCache) evictOldest() bool {
+	for e := c.ll.Back(); e != nil; e = e.Prev() {
+		if e.Value.(*searchDirCacheEntry).dir.hasOpenRefs() {
+			continue
+		}
+		c.removeElement(e)
+		return true
+	}
+	return false
+}
+
+// remove drops dir's entry, if it's still the one cached under expr
+// (a Forget arriving after dir was already evicted and replaced by a
+// fresh lookup must not remove the replacement).
+func (c *searchDirCache) remove(expr string, dir *searchResultDir) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[expr]
+	if !ok || e.Value.(*searchDirCacheEntry).dir != dir {
+		return
+	}
+	c.removeElement(e)
+}
+
+// removeElement drops e from both ll and items. c.mu must be held.
+func (c *searchDirCache) removeElement(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*searchDirCacheEntry).expr)
+}
@@ -0,0 +1,75 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"container/list"
+	"testing"
+)
+
+// TestSearchDirCacheEvictsLeastRecentlyUsed checks that adding more
+// entries than a cache's cap evicts the oldest one, while the newest
+// (and anything touched via get in between) stays cached.
+func TestSearchDirCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := &searchDirCache{
+		cap:   2,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+
+	c.add("is:image", &searchResultDir{searchExp: "is:image"})
+	c.add("is:video", &searchResultDir{searchExp: "is:video"})
+	c.add("is:audio", &searchResultDir{searchExp: "is:audio"})
+
+	if _, ok := c.get("is:image"); ok {
+		t.Errorf("get(%q) found an entry; want it evicted as the oldest past cap %d", "is:image", c.cap)
+	}
+	if _, ok := c.get("is:video"); !ok {
+		t.Errorf("get(%q) = not found; want it still cached", "is:video")
+	}
+	if _, ok := c.get("is:audio"); !ok {
+		t.Errorf("get(%q) = not found; want it still cached as the newest entry", "is:audio")
+	}
+	if dirs, cap := c.stats(); dirs != 2 || cap != 2 {
+		t.Errorf("stats() = %d, %d; want 2, 2", dirs, cap)
+	}
+}
+
+// TestSearchDirCacheSkipsPinnedEntries checks that an entry with a live
+// open ref survives past its cap, rather than being evicted out from
+// under a reader, and that the only unpinned entry is evicted instead.
+func TestSearchDirCacheSkipsPinnedEntries(t *testing.T) {
+	c := &searchDirCache{
+		cap:   1,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+
+	pinned := &searchResultDir{searchExp: "is:image"}
+	pinned.openRefs = 1
+	c.add("is:image", pinned)
+	c.add("is:video", &searchResultDir{searchExp: "is:video"})
+
+	if _, ok := c.get("is:image"); !ok {
+		t.Errorf("get(%q) = not found; want the pinned entry to survive eviction", "is:image")
+	}
+	if _, ok := c.get("is:video"); ok {
+		t.Errorf("get(%q) found an entry; want it evicted as the only unpinned entry past cap %d", "is:video", c.cap)
+	}
+}
@@ -0,0 +1,58 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// SearchDirInfo is one CachedSearchDirs entry: a snapshot of a single
+// live searchResultDir, for introspection and external tooling rather
+// than anything this package's own FUSE handling reads back.
+type SearchDirInfo struct {
+	// Expr is the search expression the directory was seeded with
+	// (searchResultDir.searchExp).
+	Expr string
+	// Entries is how many names its last successful ReadDirAll
+	// listed.
+	Entries int
+	// Age is how long it's been since that last successful
+	// ReadDirAll, or zero if it's never been listed yet.
+	Age time.Duration
+	// ApproxBytes is a rough estimate of the memory its per-entry
+	// maps (ents, permanode, pnodeMeta, imageMeta, modTime, ...) are
+	// holding, for spotting which expressions are the heaviest to
+	// keep cached; see approxMemoryBytes for what it does and doesn't
+	// account for.
+	ApproxBytes int64
+	// Stale is true if this directory was built from a saved search
+	// that's since been deleted server-side, and
+	// CamliFileSystem.SavedSearchDeletedBehavior chose
+	// SavedSearchDeletedFallback: Expr no longer reflects that saved
+	// search, only CamliFileSystem.SavedSearchDeletedFallbackExpr.
+	Stale bool
+}
+
+// CachedSearchDirs returns a snapshot of every searchResultDir fsys's
+// search dir cache currently holds, in most-recently-used order, the
+// same order searchDirCache.evictOldest would consider them for
+// eviction in reverse. It's safe to call concurrently with ongoing
+// mount activity: each entry is read under its own searchResultDir's
+// lock, independently of every other.
+func (fsys *CamliFileSystem) CachedSearchDirs() []SearchDirInfo {
+	return searchDirCacheFor(fsys).snapshot()
+}
@@ -0,0 +1,65 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// DirSizeMode selects how searchResultDir.Attr computes a.Size (see
+// CamliFileSystem.DirSizeMode). Every mode is computed from data
+// already cached by the directory's last ReadDirAll; none issues an
+// extra query just to answer Attr.
+type DirSizeMode int
+
+const (
+	// DirSizeZero reports a size of zero, the historical behavior.
+	// It's the zero value, so a mount that never configured
+	// DirSizeMode keeps seeing the same size as before.
+	DirSizeZero DirSizeMode = iota
+
+	// DirSizeEntryCount reports len(n.ents) times
+	// DirSizeEntryCountFactor, for a tool that expects a directory's
+	// size to grow with its entry count even if the exact number
+	// doesn't correspond to bytes of anything real.
+	DirSizeEntryCount
+
+	// DirSizeContentSum reports the sum of each entry's own file
+	// size, i.e. what n.ents[name].File.Size already carries for a
+	// plain file. An entry with no known file size (a subdirectory,
+	// symlink, set, or anything else n.node would compute its own
+	// size for) contributes zero rather than recursing into it.
+	DirSizeContentSum
+)
+
+// dirSize computes n's Attr size under n.fs.DirSizeMode, from data
+// already populated by n's last ReadDirAll. It must be called with
+// n.mu held.
+func (n *searchResultDir) dirSize() uint64 {
+	switch n.fs.DirSizeMode {
+	case DirSizeEntryCount:
+		return uint64(len(n.ents)) * n.fs.DirSizeEntryCountFactor
+	case DirSizeContentSum:
+		var sum uint64
+		for _, db := range n.ents {
+			if db != nil && db.File != nil {
+				sum += uint64(db.File.Size)
+			}
+		}
+		return sum
+	default:
+		return 0
+	}
+}
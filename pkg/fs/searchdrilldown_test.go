@@ -0,0 +1,53 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+)
+
+// TestDrillDownRequiresColon checks that drillDown only treats a
+// Lookup miss as a predicate to AND onto n's expression when it has
+// the "key:value" shape every predicate in the expression grammar
+// already has; a plain name that merely isn't in this listing must
+// fall through to ENOENT rather than becoming a live query.
+func TestDrillDownRequiresColon(t *testing.T) {
+	n := &searchResultDir{searchExp: "is:image"}
+	if _, ok := n.drillDown("Thumbs.db"); ok {
+		t.Error(`drillDown("Thumbs.db") ok = true; want false`)
+	}
+	if _, ok := n.drillDown(".git"); ok {
+		t.Error(`drillDown(".git") ok = true; want false`)
+	}
+}
+
+// TestDrillDownAndsPredicateOntoExpression checks that a predicate-
+// shaped miss produces a child searchResultDir whose expression is
+// n's own expression ANDed with the miss verbatim, the same as
+// matchedDir's narrowing.
+func TestDrillDownAndsPredicateOntoExpression(t *testing.T) {
+	n := &searchResultDir{searchExp: "is:image", at: nil}
+	child, ok := n.drillDown("after:2020-01-01")
+	if !ok {
+		t.Fatal(`drillDown("after:2020-01-01") ok = false; want true`)
+	}
+	if want := `is:image after:2020-01-01`; child.searchExp != want {
+		t.Errorf("drillDown searchExp = %q; want %q", child.searchExp, want)
+	}
+}
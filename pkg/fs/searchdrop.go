@@ -0,0 +1,93 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// dropDirName is the reserved name of a tag-based searchResultDir's
+// write-only upload inbox (see dropDir and hasDrop). It's checked
+// alongside dupesDirName and the other reserved pseudo-directory
+// names in searchResultDir.Lookup, so it's never mistaken for (or
+// shadows) an actual search result named "drop".
+const dropDirName = "drop"
+
+// dropDir is a write-only pseudo-directory under a tag-based
+// searchResultDir: a file created in it is uploaded and tagged the
+// same way one written directly into its parent already is (see
+// searchResultDir.Create), but it can't be listed or read back
+// through dropDir itself. That makes it a cleaner import-inbox
+// primitive than making the whole parent directory writable, where
+// an existing entry could be overwritten or a half-uploaded file read
+// back by accident; a file dropped here only ever shows up once the
+// parent's own next refresh picks it up.
+type dropDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*dropDir)(nil)
+	_ fs.HandleReadDirAller = (*dropDir)(nil)
+	_ fs.NodeStringLookuper = (*dropDir)(nil)
+	_ fs.NodeCreater        = (*dropDir)(nil)
+)
+
+func (d *dropDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0300
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+// ReadDirAll always fails: dropDir is write-only, so there's nothing
+// to list.
+func (d *dropDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return nil, fuse.EPERM
+}
+
+// Lookup always fails, for the same reason ReadDirAll does: nothing
+// dropped here can be read back through dropDir, only through the
+// parent's own listing once it's picked it up.
+func (d *dropDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	return nil, fuse.EPERM
+}
+
+// Create implements fs.NodeCreater by delegating straight to the
+// parent's own Create, so a file dropped here is uploaded and tagged
+// exactly the way one written directly into the parent would be, and
+// the parent's cache is invalidated the same way on Release.
+func (d *dropDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	return d.parent.Create(ctx, req, resp)
+}
+
+// hasDrop reports whether n's search expression is one Create can
+// satisfy for a new permanode (see tagForExpression), i.e. whether
+// n's "drop" subdirectory resolves at all; a non-tag expression
+// couldn't accept a dropped file any more than writing into n
+// directly already can.
+func (n *searchResultDir) hasDrop() bool {
+	_, ok := tagForExpression(n.searchExp)
+	return ok
+}
@@ -0,0 +1,40 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// emptyMarkerName is the synthetic entry doReaddir appends to a
+// listing that came back with zero entries, when
+// CamliFileSystem.ShowEmptyMarker is set, so "a search that matched
+// nothing" is distinguishable in an "ls" from "a search that failed
+// silently". It's only ever appended when lastNames is otherwise
+// empty, so it never shows up alongside real results.
+const emptyMarkerName = ".empty"
+
+// hasEmptyMarker reports whether n's last ReadDirAll appended
+// emptyMarkerName to n.lastNames.
+func (n *searchResultDir) hasEmptyMarker() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, name := range n.lastNames {
+		if name == emptyMarkerName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestLookupResultDirForEmptyExpressionRejected checks the zero-value
+// behavior: an empty expression fails immediately with fuse.EINVAL
+// rather than resolving to a searchResultDir with an empty searchExp.
+func TestLookupResultDirForEmptyExpressionRejected(t *testing.T) {
+	n := &searchDir{fs: &CamliFileSystem{}}
+	_, err := n.lookupResultDirFor(context.Background(), "", "", searchDirOptions{}, false, "")
+	if err != fuse.EINVAL {
+		t.Errorf("lookupResultDirFor(\"\") error = %v; want fuse.EINVAL", err)
+	}
+}
+
+// TestLookupResultDirForEmptyExpressionDefault checks that
+// EmptyExpressionDefault, once set, substitutes for an empty
+// expression instead of rejecting it.
+func TestLookupResultDirForEmptyExpressionDefault(t *testing.T) {
+	n := &searchDir{fs: &CamliFileSystem{EmptyExpressionDefault: "is:recent"}}
+	node, err := n.lookupResultDirFor(context.Background(), "", "", searchDirOptions{}, false, "")
+	if err != nil {
+		t.Fatalf("lookupResultDirFor(\"\") error = %v; want nil", err)
+	}
+	rd, ok := node.(*searchResultDir)
+	if !ok {
+		t.Fatalf("lookupResultDirFor(\"\") = %T; want *searchResultDir", node)
+	}
+	if rd.searchExp != "is:recent" {
+		t.Errorf("searchExp = %q; want %q", rd.searchExp, "is:recent")
+	}
+}
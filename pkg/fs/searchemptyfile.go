@@ -0,0 +1,54 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// emptyFileHandle is searchResultFile.Open's handle for a file whose
+// describe metadata already reports zero bytes (db.File.Size == 0):
+// every Read is answered with an empty slice directly, without ever
+// constructing a schema.FileReader or issuing a blob fetch for content
+// that's already known to hold nothing. This sidesteps whatever a
+// zero-length schema.NewFileReader/ReadAt round trip would otherwise
+// have to do (and any transient fetch error it could return) for a
+// result that's fixed ahead of time regardless.
+type emptyFileHandle struct{}
+
+var (
+	_ fs.Handle         = emptyFileHandle{}
+	_ fs.HandleReader   = emptyFileHandle{}
+	_ fs.HandleReleaser = emptyFileHandle{}
+)
+
+// Read implements fs.HandleReader, always reporting EOF by leaving
+// resp.Data empty.
+func (emptyFileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	return nil
+}
+
+// Release implements fs.HandleReleaser. There's no underlying reader
+// to close.
+func (emptyFileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	return nil
+}
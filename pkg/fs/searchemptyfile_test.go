@@ -0,0 +1,55 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestEmptyFileHandleRead checks that a read against an
+// emptyFileHandle, regardless of offset or requested size, comes back
+// as a clean EOF (no data, no error) rather than attempting any kind
+// of fetch.
+func TestEmptyFileHandleRead(t *testing.T) {
+	h := emptyFileHandle{}
+	req := &fuse.ReadRequest{Offset: 0, Size: 4096}
+	resp := &fuse.ReadResponse{}
+	if err := h.Read(context.Background(), req, resp); err != nil {
+		t.Fatalf("Read at offset 0: %v", err)
+	}
+	if len(resp.Data) != 0 {
+		t.Errorf("Read at offset 0: got %d bytes; want 0", len(resp.Data))
+	}
+
+	req = &fuse.ReadRequest{Offset: 1 << 20, Size: 64}
+	resp = &fuse.ReadResponse{}
+	if err := h.Read(context.Background(), req, resp); err != nil {
+		t.Fatalf("Read at offset 1MB: %v", err)
+	}
+	if len(resp.Data) != 0 {
+		t.Errorf("Read at offset 1MB: got %d bytes; want 0", len(resp.Data))
+	}
+
+	if err := h.Release(context.Background(), &fuse.ReleaseRequest{}); err != nil {
+		t.Errorf("Release: %v", err)
+	}
+}
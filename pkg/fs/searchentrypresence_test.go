@@ -0,0 +1,83 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"sync"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// TestEntryStillPresent checks the three outcomes Lookup's
+// post-fetch revalidation relies on: the entry is there with the
+// expected blobref, it's there with a different one (a concurrent
+// refresh replaced it), or it's gone entirely (a concurrent refresh
+// dropped it).
+func TestEntryStillPresent(t *testing.T) {
+	br1 := blob.RefFromString("one")
+	br2 := blob.RefFromString("two")
+	n := &searchResultDir{
+		ents: map[string]*search.DescribedBlob{"foo": {BlobRef: br1}},
+	}
+
+	if !n.entryStillPresent("foo", br1) {
+		t.Error(`entryStillPresent("foo", br1) = false; want true`)
+	}
+	if n.entryStillPresent("foo", br2) {
+		t.Error(`entryStillPresent("foo", br2) = true; want false (different blobref)`)
+	}
+	if n.entryStillPresent("bar", br1) {
+		t.Error(`entryStillPresent("bar", br1) = true; want false (no such entry)`)
+	}
+}
+
+// TestEntryStillPresentConcurrentRefresh is a race-detector regression
+// test for Lookup's schema-meta fetch, which releases n.mu for the
+// fetch itself and re-validates with entryStillPresent after
+// reacquiring it: a concurrent doReaddir-style refresh replacing
+// n.ents while entryStillPresent is mid-check must not race, since
+// both sides take n.mu. Run with -race.
+func TestEntryStillPresentConcurrentRefresh(t *testing.T) {
+	br := blob.RefFromString("hello")
+	n := &searchResultDir{
+		ents: map[string]*search.DescribedBlob{"foo": {BlobRef: br}},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			n.mu.Lock()
+			n.ents = map[string]*search.DescribedBlob{"foo": {BlobRef: br}}
+			n.mu.Unlock()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			n.mu.Lock()
+			n.entryStillPresent("foo", br)
+			n.mu.Unlock()
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,54 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "bazil.org/fuse"
+
+// UnsupportedCondition identifies one of this package's own reasons
+// for refusing a request, so effectiveUnsupportedErrno can map each to
+// whatever errno ErrnoPolicy configures for it instead of every call
+// site hardcoding its own.
+type UnsupportedCondition int
+
+const (
+	// UnsupportedReadOnly is CamliFileSystem.ReadOnly rejecting every
+	// mutation outright; see checkWritable.
+	UnsupportedReadOnly UnsupportedCondition = iota
+	// UnsupportedFeatureOff is a specific write feature (AllowDelete,
+	// AllowMkdir, and similarly gated handlers) rejecting a request
+	// because its own opt-in flag is unset.
+	UnsupportedFeatureOff
+	// UnsupportedImmutable is a mutation attempted against a
+	// searchAtDir: a point-in-time snapshot is read-only by
+	// definition, regardless of any other flag.
+	UnsupportedImmutable
+)
+
+// effectiveUnsupportedErrno returns the errno a handler should report
+// for cond: fsys.ErrnoPolicy's override if one's set and non-zero,
+// else the package's own longstanding default for cond.
+func (fsys *CamliFileSystem) effectiveUnsupportedErrno(cond UnsupportedCondition) fuse.Errno {
+	if errno, ok := fsys.ErrnoPolicy[cond]; ok && errno != 0 {
+		return errno
+	}
+	if cond == UnsupportedReadOnly {
+		return fuse.EROFS
+	}
+	return fuse.EPERM
+}
@@ -0,0 +1,51 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"syscall"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestEffectiveUnsupportedErrno checks the package defaults and that
+// an ErrnoPolicy entry overrides them per-condition, independently.
+func TestEffectiveUnsupportedErrno(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	if got := fsys.effectiveUnsupportedErrno(UnsupportedReadOnly); got != fuse.EROFS {
+		t.Errorf("default UnsupportedReadOnly = %v; want fuse.EROFS", got)
+	}
+	if got := fsys.effectiveUnsupportedErrno(UnsupportedFeatureOff); got != fuse.EPERM {
+		t.Errorf("default UnsupportedFeatureOff = %v; want fuse.EPERM", got)
+	}
+	if got := fsys.effectiveUnsupportedErrno(UnsupportedImmutable); got != fuse.EPERM {
+		t.Errorf("default UnsupportedImmutable = %v; want fuse.EPERM", got)
+	}
+
+	fsys.ErrnoPolicy = map[UnsupportedCondition]fuse.Errno{
+		UnsupportedReadOnly: fuse.Errno(syscall.ENOSYS),
+	}
+	if got := fsys.effectiveUnsupportedErrno(UnsupportedReadOnly); got != fuse.Errno(syscall.ENOSYS) {
+		t.Errorf("overridden UnsupportedReadOnly = %v; want ENOSYS", got)
+	}
+	if got := fsys.effectiveUnsupportedErrno(UnsupportedFeatureOff); got != fuse.EPERM {
+		t.Errorf("UnsupportedFeatureOff should be unaffected by an unrelated override, got %v", got)
+	}
+}
@@ -0,0 +1,86 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// errorsDirName is the reserved name of the read-only subdirectory
+// listing permanodes doReaddir skipped this round for having an
+// empty or unparseable camliContent attribute (see n.badContent), so
+// they can be investigated without combing through logs. Like
+// dupesDirName, it only "exists" once the parent has been seeded and
+// actually has something to show.
+const errorsDirName = ".errors"
+
+// searchErrorsDir lists n.badContent, one entry per permanode, named
+// by its blobref since that's the only thing known about it reliably
+// (its camliContent, if any, is exactly what failed to parse).
+type searchErrorsDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*searchErrorsDir)(nil)
+	_ fs.HandleReadDirAller = (*searchErrorsDir)(nil)
+	_ fs.NodeStringLookuper = (*searchErrorsDir)(nil)
+)
+
+func (d *searchErrorsDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *searchErrorsDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	names := make([]string, 0, len(d.parent.badContent))
+	for _, pn := range d.parent.badContent {
+		names = append(names, pn.String())
+	}
+	return dirents(names, fuse.DT_File), nil
+}
+
+func (d *searchErrorsDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	for _, pn := range d.parent.badContent {
+		if pn.String() == name {
+			return staticFileNode(fmt.Sprintf("permanode %v has an empty or unparseable camliContent\n", pn)), nil
+		}
+	}
+	return nil, fuse.ENOENT
+}
+
+// hasBadContent reports whether n's last ReadDirAll skipped anything
+// for errorsDirName to show.
+func (n *searchResultDir) hasBadContent() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.badContent) > 0
+}
@@ -0,0 +1,46 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// errorsLogName is a hidden, per-searchResultDir file reporting the
+// resolution issues (skipped entries, fallback fetches, name
+// collisions, truncation) from n's most recent doReaddir, for
+// diagnosing why a listing seems incomplete without having to go
+// comb through the server logs. Unlike errorsDirName (which only ever
+// covers unparseable-camliContent skips), this covers every category
+// doReaddir already logs. It's regenerated on every refresh and
+// reflects only the most recent round; nothing here is retained
+// across refreshes. Like queryFileName, it's always resolvable via
+// Lookup unless CamliFileSystem.DisableErrorsLog is set; see
+// CamliFileSystem.ShowDotfiles for whether it's also listed in
+// ReadDirAll.
+const errorsLogName = ".errors.log"
+
+// errorsLogContents renders errorsLogName's content. It must be
+// called with n.mu held, since it reads n.errorLog.
+func (n *searchResultDir) errorsLogContents() string {
+	if len(n.errorLog) == 0 {
+		return "no issues in the most recent listing\n"
+	}
+	s := ""
+	for _, line := range n.errorLog {
+		s += line + "\n"
+	}
+	return s
+}
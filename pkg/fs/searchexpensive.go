@@ -0,0 +1,61 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// errorFileName is a hidden, per-searchResultDir file explaining the
+// most recent doReaddir call's fatal error, if any: a "query too
+// expensive" rejection (see queryTooExpensive) gets its own detailed
+// message with a suggestion to narrow the expression; any other query
+// failure that makes doReaddir fail the round outright (rather than
+// falling back to a stale or offline listing, which leaves it
+// untouched) gets a plainer one built straight from the error ls
+// would otherwise only see logged. It's reset to "" on every
+// doReaddir call that succeeds, so reading it back as "no error in
+// the most recent listing" (see errorFileContents) means exactly
+// that: the listing "ls" just returned is current, not left over from
+// some earlier failure. Unlike errorsLogName, which accumulates this
+// round's non-fatal resolution issues, this is specifically the one
+// error that made the round fail, in enough detail that a user
+// hitting fuse.EIO or syscall.E2BIG from "ls" knows what to do next
+// without going to check the server logs.
+const errorFileName = ".error"
+
+// defaultExpensiveQueryLimit is the page size
+// AutoLimitOnExpensiveQuery retries with when
+// CamliFileSystem.ExpensiveQueryLimit isn't set.
+const defaultExpensiveQueryLimit = 100
+
+// effectiveExpensiveQueryLimit is the limit
+// AutoLimitOnExpensiveQuery's retry actually uses: fsys's own
+// ExpensiveQueryLimit if set, else defaultExpensiveQueryLimit.
+func (fsys *CamliFileSystem) effectiveExpensiveQueryLimit() int {
+	if fsys.ExpensiveQueryLimit > 0 {
+		return fsys.ExpensiveQueryLimit
+	}
+	return defaultExpensiveQueryLimit
+}
+
+// errorFileContents renders errorFileName's content. It must be
+// called with n.mu held, since it reads n.lastFatalError.
+func (n *searchResultDir) errorFileContents() string {
+	if n.lastFatalError == "" {
+		return "no error in the most recent listing\n"
+	}
+	return n.lastFatalError
+}
@@ -0,0 +1,62 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestErrorFileContentsReportsForcedQueryError checks that once a
+// query error is recorded (the way doReaddir's generic failure path
+// now records any fatal error, not just a "too expensive" rejection,
+// into n.lastFatalError), errorFileName's content surfaces that exact
+// error instead of the generic "no error" message.
+func TestErrorFileContentsReportsForcedQueryError(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image"}
+	n.lastFatalError = `query "is:image" failed: dial tcp: connection refused` + "\n"
+
+	got := n.errorFileContents()
+	if got == "" || strings.Contains(got, "no error") {
+		t.Fatalf("errorFileContents() after a forced query error = %q; want the recorded error", got)
+	}
+	if !strings.Contains(got, "connection refused") {
+		t.Errorf("errorFileContents() = %q; want it to include the recorded error text", got)
+	}
+}
+
+// TestErrorFileContentsClearsAfterSuccess checks that errorFileName's
+// content goes back to reporting no error once doReaddir's success
+// path resets n.lastFatalError to "" (see doReaddir's final critical
+// section), rather than continuing to show a now-stale failure from
+// an earlier, unrelated ReadDirAll.
+func TestErrorFileContentsClearsAfterSuccess(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image"}
+	n.lastFatalError = "some earlier failure\n"
+
+	// Simulate doReaddir's own success-path reset, the one line it
+	// runs unconditionally once a round completes without a fatal
+	// error.
+	n.lastFatalError = ""
+
+	got := n.errorFileContents()
+	if !strings.Contains(got, "no error") {
+		t.Errorf("errorFileContents() after a successful refresh = %q; want it to report no error", got)
+	}
+}
@@ -0,0 +1,80 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+
+	"perkeep.org/pkg/search"
+)
+
+// explainFileName is a hidden, per-searchResultDir file reporting the
+// exact search.SearchQuery JSON ReadDirAll's first page would send,
+// without ever sending it: for confirming a mounted search expression
+// compiles into the query its author actually intended, the same way
+// queryFileName confirms the expression and limit but without having
+// to also run the search. It's regenerated from n's current
+// configuration (expression, effective limit, sort, and describe
+// rules) on every read, so it always reflects whatever "limit="/
+// "sort="/camlifsFileName overrides currently apply. Like
+// queryFileName, it's always resolvable via Lookup unless
+// CamliFileSystem.DisableExplainFile is set; see
+// CamliFileSystem.ShowDotfiles for whether it's also listed in
+// ReadDirAll.
+const explainFileName = ".explain"
+
+// explainQuery builds the search.SearchQuery ReadDirAll's first page
+// would send for n's current configuration, mirroring
+// dir.resolvePage's own construction closely enough to be useful for
+// debugging without duplicating dir's unexported query-paging
+// internals: Continue is always "", since only the first page's query
+// is of interest here. It must be called with n.mu held, since it
+// reads n's overrides.
+func (n *searchResultDir) explainQuery() *search.SearchQuery {
+	sortBy, serverSorted := serverSortFor(n.effectiveSortBy())
+	if !serverSorted {
+		sortBy = search.UnspecifiedSort
+	}
+	describe := &search.DescribeRequest{
+		Rules: n.effectiveDescribeRules(),
+	}
+	if n.at != nil {
+		describe.At = *n.at
+	}
+	if depth := n.fs.effectiveSearchDescribeDepth(); depth > 0 {
+		describe.Depth = depth
+	}
+	return &search.SearchQuery{
+		Expression: n.effectiveSearchExpr(),
+		Limit:      n.effectiveResultCap(),
+		Sort:       sortBy,
+		Describe:   describe,
+	}
+}
+
+// explainContents renders explainFileName's content: explainQuery,
+// indented for reading. It must be called with n.mu held, the same as
+// explainQuery itself.
+func (n *searchResultDir) explainContents() ([]byte, error) {
+	b, err := json.MarshalIndent(n.explainQuery(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
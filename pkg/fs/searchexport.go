@@ -0,0 +1,273 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+	"perkeep.org/pkg/search"
+)
+
+// exportToFileName is a hidden, per-searchResultDir control file:
+// writing a host directory path to it starts a background export of
+// every currently cached file entry (n.ents; sets, symlinks, and
+// contentless placeholders are skipped, since there's no single blob
+// to copy for them) into that directory, reusing the client fetches
+// n's own ReadDirAll/Open already know how to do. Reading it back
+// reports the export's progress, or its final outcome once done. It's
+// always resolvable via Lookup but, unlike refreshFileName and
+// camlifsFileName, it isn't in controlFileNames, so it never appears
+// in a listing, with or without ShowDotfiles.
+const exportToFileName = ".export-to"
+
+// exportState is one export run's mutable progress, read back through
+// exportToFile.Read and cancelled through exportToFile.Setattr
+// truncating it to zero.
+type exportState struct {
+	destDir string
+	total   int
+
+	mu       sync.Mutex
+	done     int
+	errs     []string
+	finished bool
+	canceled bool
+	cancel   context.CancelFunc
+}
+
+// recordResult is called once per exported entry, successful or not.
+func (st *exportState) recordResult(name string, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.done++
+	if err != nil {
+		st.errs = append(st.errs, fmt.Sprintf("%s: %v", name, err))
+	}
+}
+
+// finish marks st done; further reads report the final tally rather
+// than "export in progress".
+func (st *exportState) finish() {
+	st.mu.Lock()
+	st.finished = true
+	st.mu.Unlock()
+}
+
+// contents renders st's current progress as exportToFile.Read's
+// content.
+func (st *exportState) contents() []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "destination: %s\n", st.destDir)
+	switch {
+	case st.canceled:
+		fmt.Fprintf(&b, "status: canceled after %d/%d\n", st.done, st.total)
+	case st.finished:
+		fmt.Fprintf(&b, "status: done (%d/%d)\n", st.done, st.total)
+	default:
+		fmt.Fprintf(&b, "status: exporting (%d/%d)\n", st.done, st.total)
+	}
+	for _, e := range st.errs {
+		fmt.Fprintf(&b, "error: %s\n", e)
+	}
+	return []byte(b.String())
+}
+
+// startExport begins exporting n's currently cached file entries into
+// destDir, replacing any still-running export of n's with one
+// canceled. It must not be called with n.mu held, since it both reads
+// n's cached entries under n.mu and, on success, takes n.mu again to
+// install the new exportState.
+func (n *searchResultDir) startExport(destDir string) error {
+	n.mu.Lock()
+	names := append([]string(nil), n.lastNames...)
+	ents := n.ents
+	if prev := n.export; prev != nil {
+		prev.mu.Lock()
+		if !prev.finished && prev.cancel != nil {
+			prev.cancel()
+		}
+		prev.mu.Unlock()
+	}
+	n.mu.Unlock()
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st := &exportState{destDir: destDir, total: len(names), cancel: cancel}
+
+	n.mu.Lock()
+	n.export = st
+	n.mu.Unlock()
+
+	go n.runExport(ctx, st, names, ents)
+	return nil
+}
+
+// runExport fetches and writes out every name in names whose ents
+// entry is a plain file, honoring n.fs's configured query
+// concurrency (see queryLimiterFor) the same way a ReadDirAll's own
+// describe fetches do, and stopping early once ctx is canceled (see
+// startExport and exportToFile.Setattr).
+func (n *searchResultDir) runExport(ctx context.Context, st *exportState, names []string, ents map[string]*search.DescribedBlob) {
+	limiter := queryLimiterFor(n.fs)
+	metrics := metricsFor(n.fs)
+	var wg sync.WaitGroup
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		db := ents[name]
+		if db == nil || db.File == nil || !db.BlobRef.Valid() {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, br blob.Ref) {
+			defer wg.Done()
+			if err := limiter.acquire(ctx, metrics); err != nil {
+				st.recordResult(name, err)
+				return
+			}
+			defer limiter.release()
+			st.recordResult(name, n.exportOne(ctx, name, br, st.destDir))
+		}(name, db.BlobRef)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		st.mu.Lock()
+		st.canceled = true
+		st.mu.Unlock()
+	}
+	st.finish()
+}
+
+// exportOne fetches br's content and writes it to destDir/name,
+// overwriting anything already there, the same fetch
+// searchResultFile.Open itself would use.
+func (n *searchResultDir) exportOne(ctx context.Context, name string, br blob.Ref, destDir string) error {
+	fr, err := schema.NewFileReader(ctx, n.fs.client, br)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	out, err := os.Create(filepath.Join(destDir, name))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, fr)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// exportToFile is exportToFileName's Node and Handle: writing a
+// destination path starts an export (see startExport), reading
+// reports its progress (see exportState.contents), and truncating
+// cancels it (see Setattr).
+type exportToFile struct {
+	dir *searchResultDir
+}
+
+var (
+	_ fs.Node          = exportToFile{}
+	_ fs.HandleReader  = exportToFile{}
+	_ fs.HandleWriter  = exportToFile{}
+	_ fs.NodeSetattrer = exportToFile{}
+)
+
+func (f exportToFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Valid = f.dir.fs.effectiveAttrValidity()
+	return nil
+}
+
+func (f exportToFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	f.dir.mu.Lock()
+	st := f.dir.export
+	f.dir.mu.Unlock()
+	if st == nil {
+		resp.Data = nil
+		return nil
+	}
+	content := st.contents()
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = content[req.Offset:end]
+	return nil
+}
+
+func (f exportToFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := f.dir.fs.checkWritable(); err != nil {
+		return err
+	}
+	destDir := strings.TrimSpace(string(req.Data))
+	if destDir == "" {
+		return fuse.Errno(syscall.EINVAL)
+	}
+	if err := f.dir.startExport(destDir); err != nil {
+		Logger.Printf("fs.searchResultDir: %q write for '%s': %v", exportToFileName, f.dir.searchExp, err)
+		return fuse.Errno(syscall.EINVAL)
+	}
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// Setattr implements fs.NodeSetattrer. Truncating exportToFileName to
+// zero is exportToFileName's documented way to cancel a running
+// export; any other attr change is a no-op, the same as
+// searchResultFile.Setattr treats one.
+func (f exportToFile) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if err := f.dir.fs.checkWritable(); err != nil {
+		return err
+	}
+	if req.Valid.Size() && req.Size == 0 {
+		f.dir.mu.Lock()
+		st := f.dir.export
+		f.dir.mu.Unlock()
+		if st != nil {
+			st.mu.Lock()
+			if !st.finished && st.cancel != nil {
+				st.cancel()
+			}
+			st.mu.Unlock()
+		}
+	}
+	return f.Attr(ctx, &resp.Attr)
+}
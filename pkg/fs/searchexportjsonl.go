@@ -0,0 +1,122 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// exportJSONLName is a hidden, per-searchResultDir file exposing the
+// same entries resultsJSONName does, but as one JSON object per line
+// rather than a single indented array, for a bulk-ingest tool that
+// wants to stream a whole directory's metadata in one read instead of
+// stat-ing (and Lookup-ing) every result individually.
+const exportJSONLName = ".export.jsonl"
+
+// exportJSONLFile is exportJSONLName's Node: opening it snapshots
+// n's current listing, the same way searchResultDir.Open's own doc
+// comment describes for searchResultDirHandle, so a long read sees one
+// consistent set of entries throughout even if n gets reseeded
+// partway through.
+type exportJSONLFile struct {
+	dir *searchResultDir
+}
+
+var (
+	_ fs.Node       = exportJSONLFile{}
+	_ fs.NodeOpener = exportJSONLFile{}
+)
+
+func (f exportJSONLFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0444
+	a.Valid = f.dir.fs.effectiveAttrValidity()
+	return nil
+}
+
+// Open snapshots f.dir's current entries (via resultsJSONEntries, the
+// same slice resultsJSONContents itself marshals for resultsJSONName)
+// into a fresh exportJSONLHandle. The entries themselves are already
+// just metadata, not file content, so holding all of them is no
+// heavier than resultsJSONName already is; what exportJSONLHandle.Read
+// avoids buffering is their serialized form, marshaling one line at a
+// time as a Read actually needs it rather than building the whole
+// output up front.
+func (f exportJSONLFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if err := f.dir.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	f.dir.mu.Lock()
+	entries := f.dir.resultsJSONEntries()
+	f.dir.mu.Unlock()
+	return &exportJSONLHandle{entries: entries}, nil
+}
+
+// exportJSONLHandle is exportJSONLFile.Open's result: entries is the
+// point-in-time snapshot taken at open time, and buf is however much
+// of its newline-delimited JSON serialization growTo has produced so
+// far. Growing buf only as Read calls require more of it is what
+// keeps a huge directory's export from ever being fully materialized
+// in memory at once.
+type exportJSONLHandle struct {
+	mu      sync.Mutex
+	entries []resultsJSONEntry
+	next    int
+	buf     []byte
+}
+
+var _ fs.HandleReader = (*exportJSONLHandle)(nil)
+
+// growTo marshals entries[h.next:] one at a time, appending each as
+// its own line to h.buf, until h.buf is at least need bytes long or
+// every entry has been appended. It must be called with h.mu held.
+func (h *exportJSONLHandle) growTo(need int) error {
+	for len(h.buf) < need && h.next < len(h.entries) {
+		line, err := json.Marshal(h.entries[h.next])
+		if err != nil {
+			return err
+		}
+		h.buf = append(h.buf, line...)
+		h.buf = append(h.buf, '\n')
+		h.next++
+	}
+	return nil
+}
+
+func (h *exportJSONLHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.growTo(int(req.Offset) + req.Size); err != nil {
+		Logger.Printf("fs.searchResultDir: %s: %v", exportJSONLName, err)
+		return fuse.EIO
+	}
+	if req.Offset >= int64(len(h.buf)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(h.buf)) {
+		end = int64(len(h.buf))
+	}
+	resp.Data = h.buf[req.Offset:end]
+	return nil
+}
@@ -0,0 +1,100 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// TestExportJSONLStreamsOneObjectPerLine reads .export.jsonl a few
+// bytes at a time (forcing exportJSONLHandle.growTo to run repeatedly
+// rather than all at once) and checks that decoding each resulting
+// line yields the entries n.resultsJSONEntries itself would report.
+func TestExportJSONLStreamsOneObjectPerLine(t *testing.T) {
+	pn1 := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	pn2 := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+	cc1 := blob.MustParse("sha224-3333333333333333333333333333333333333333333333333333333333333333")
+	cc2 := blob.MustParse("sha224-4444444444444444444444444444444444444444444444444444444444444444")
+	mt1 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	mt2 := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{},
+		searchExp: "is:image",
+		lastNames: []string{"photo.jpg", "clip.mp4"},
+		ents: map[string]*search.DescribedBlob{
+			"photo.jpg": {BlobRef: cc1, File: &search.DescribedFile{Size: 100, MIMEType: "image/jpeg"}},
+			"clip.mp4":  {BlobRef: cc2, File: &search.DescribedFile{Size: 200, MIMEType: "video/mp4"}},
+		},
+		permanode: map[string]blob.Ref{"photo.jpg": pn1, "clip.mp4": pn2},
+		modTime:   map[string]time.Time{"photo.jpg": mt1, "clip.mp4": mt2},
+	}
+
+	nod, err := exportJSONLFile{dir: n}.Open(context.Background(), &fuse.OpenRequest{}, &fuse.OpenResponse{})
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	h, ok := nod.(*exportJSONLHandle)
+	if !ok {
+		t.Fatalf("Open() returned %T; want *exportJSONLHandle", nod)
+	}
+
+	var got bytes.Buffer
+	var off int64
+	for {
+		resp := &fuse.ReadResponse{}
+		if err := h.Read(context.Background(), &fuse.ReadRequest{Offset: off, Size: 8}, resp); err != nil {
+			t.Fatalf("Read() at offset %d = %v", off, err)
+		}
+		if len(resp.Data) == 0 {
+			break
+		}
+		got.Write(resp.Data)
+		off += int64(len(resp.Data))
+	}
+
+	lines := strings.Split(strings.TrimRight(got.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines; want 2: %q", len(lines), got.String())
+	}
+
+	var e1, e2 resultsJSONEntry
+	if err := json.Unmarshal([]byte(lines[0]), &e1); err != nil {
+		t.Fatalf("decoding line 1: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &e2); err != nil {
+		t.Fatalf("decoding line 2: %v", err)
+	}
+
+	if e1.Name != "photo.jpg" || e1.BlobRef != pn1.String() || e1.ContentBlobRef != cc1.String() || e1.MIMEType != "image/jpeg" || e1.Size != 100 || !e1.ModTime.Equal(mt1) {
+		t.Errorf("line 1 = %+v; want photo.jpg entry", e1)
+	}
+	if e2.Name != "clip.mp4" || e2.BlobRef != pn2.String() || e2.ContentBlobRef != cc2.String() || e2.MIMEType != "video/mp4" || e2.Size != 200 || !e2.ModTime.Equal(mt2) {
+		t.Errorf("line 2 = %+v; want clip.mp4 entry", e2)
+	}
+}
@@ -0,0 +1,62 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// base64ExprPrefix marks a searchDir.Lookup name as
+// base64.RawURLEncoding-encoded, for an expression a shell's own
+// quoting is liable to mangle before it ever reaches Lookup (e.g.
+// unbalanced or re-escaped quotes around `after:"2015-10-01"`). Unlike
+// encodedExprPrefix's url.PathEscape, every character it produces is
+// shell-metacharacter-free, so a "cd" built from it round-trips
+// through any shell's word-splitting and quote-removal unscathed.
+const base64ExprPrefix = "@b64:"
+
+// encodeBase64SearchExprPath is decodeBase64SearchExprPath's inverse:
+// it's what a caller (or a test) builds a Lookup name from when it
+// wants to bypass shell quoting entirely rather than rely on
+// encodeSearchExprPath's percent-escaping.
+func encodeBase64SearchExprPath(expr string) string {
+	return base64ExprPrefix + base64.RawURLEncoding.EncodeToString([]byte(expr))
+}
+
+// decodeBase64SearchExprPath reports whether name carries
+// base64ExprPrefix. If it does but the rest isn't valid
+// base64.RawURLEncoding, err is non-nil and the caller should fail the
+// Lookup with fuse.EINVAL rather than falling through to treat name as
+// a literal expression, since a name deliberately marked as encoded
+// that fails to decode is a corrupted query, not a cue to try some
+// other interpretation. It must be tried before searchDir.Lookup's
+// other name-shape checks, the same way decodeSearchExprPath is.
+func decodeBase64SearchExprPath(name string) (expr string, hasPrefix bool, err error) {
+	rest := strings.TrimPrefix(name, base64ExprPrefix)
+	if rest == name {
+		return "", false, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(rest)
+	if err != nil {
+		return "", true, fmt.Errorf("decoding %q: %v", base64ExprPrefix+rest, err)
+	}
+	return string(decoded), true, nil
+}
@@ -0,0 +1,75 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestBase64SearchExprPathRoundTrip is a regression test for
+// encodeBase64SearchExprPath/decodeBase64SearchExprPath: an expression
+// built into a "@b64:"-prefixed path component by one must come back
+// unchanged from the other, even for a shell-quoting-hostile
+// expression with embedded quotes and spaces.
+func TestBase64SearchExprPathRoundTrip(t *testing.T) {
+	exprs := []string{
+		`after:"2015-10-01" and is:image`,
+		`is:image and not is:pano`,
+		`attr:"a/b":"c\"d"`,
+	}
+	for _, expr := range exprs {
+		name := encodeBase64SearchExprPath(expr)
+		got, ok, err := decodeBase64SearchExprPath(name)
+		if err != nil {
+			t.Errorf("decodeBase64SearchExprPath(%q) error = %v; want nil", name, err)
+			continue
+		}
+		if !ok {
+			t.Errorf("decodeBase64SearchExprPath(%q) = ok=false; want true", name)
+			continue
+		}
+		if got != expr {
+			t.Errorf("round-trip of %q via %q = %q; want unchanged", expr, name, got)
+		}
+	}
+}
+
+// TestDecodeBase64SearchExprPathUnprefixed checks decodeSearchExprPath's
+// ok=false path: a name without base64ExprPrefix isn't a base64-encoded
+// expression at all, so it's left for some other Lookup check to
+// interpret.
+func TestDecodeBase64SearchExprPathUnprefixed(t *testing.T) {
+	_, ok, err := decodeBase64SearchExprPath("is:image")
+	if ok || err != nil {
+		t.Errorf("decodeBase64SearchExprPath(%q) = (ok=%v, err=%v); want (false, nil)", "is:image", ok, err)
+	}
+}
+
+// TestDecodeBase64SearchExprPathMalformed checks that a name carrying
+// base64ExprPrefix but followed by invalid base64 reports hasPrefix=true
+// with a non-nil error, so Lookup returns fuse.EINVAL instead of
+// silently falling through to treat the raw name as a literal
+// expression.
+func TestDecodeBase64SearchExprPathMalformed(t *testing.T) {
+	_, ok, err := decodeBase64SearchExprPath(base64ExprPrefix + "not valid base64!!")
+	if !ok {
+		t.Errorf("decodeBase64SearchExprPath(malformed) hasPrefix = false; want true")
+	}
+	if err == nil {
+		t.Errorf("decodeBase64SearchExprPath(malformed) err = nil; want non-nil")
+	}
+}
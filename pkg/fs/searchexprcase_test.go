@@ -0,0 +1,64 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestResultDirForPreservesOriginalCase covers
+// CamliFileSystem.SearchExprCaseInsensitiveCache: a second lookup of
+// the same logical path in a different case, simulating a
+// case-insensitive host filesystem handing back an already-seen name
+// with different casing, must reuse the first lookup's
+// searchResultDir rather than building a second one whose query runs
+// in the host's folded case. The directory's search expression must
+// retain the exact case it was first built with.
+func TestResultDirForPreservesOriginalCase(t *testing.T) {
+	n := &searchDir{fs: &CamliFileSystem{SearchExprCaseInsensitiveCache: true}}
+
+	d1 := n.resultDirFor("tag:Vacation", "tag:Vacation", searchDirOptions{}, "")
+	if d1.searchExp != "tag:Vacation" {
+		t.Fatalf("first lookup searchExp = %q; want %q", d1.searchExp, "tag:Vacation")
+	}
+
+	d2 := n.resultDirFor("tag:vacation", "tag:vacation", searchDirOptions{}, "")
+	if d2 != d1 {
+		t.Fatalf("second, differently-cased lookup returned a distinct searchResultDir; want the same one reused")
+	}
+	if d2.searchExp != "tag:Vacation" {
+		t.Errorf("searchExp after a differently-cased lookup = %q; want the original %q preserved", d2.searchExp, "tag:Vacation")
+	}
+}
+
+// TestResultDirForExactCaseByDefault covers the
+// SearchExprCaseInsensitiveCache zero value: without it, two lookups
+// differing only in case are distinct searchResultDirs, each with its
+// own exact-case expression, preserving this mount's historical
+// behavior.
+func TestResultDirForExactCaseByDefault(t *testing.T) {
+	n := &searchDir{fs: &CamliFileSystem{}}
+
+	d1 := n.resultDirFor("tag:Vacation", "tag:Vacation", searchDirOptions{}, "")
+	d2 := n.resultDirFor("tag:vacation", "tag:vacation", searchDirOptions{}, "")
+	if d2 == d1 {
+		t.Fatalf("two differently-cased lookups returned the same searchResultDir; want distinct ones without SearchExprCaseInsensitiveCache")
+	}
+	if d1.searchExp != "tag:Vacation" || d2.searchExp != "tag:vacation" {
+		t.Errorf("searchExp = %q, %q; want each to keep its own lookup's exact case", d1.searchExp, d2.searchExp)
+	}
+}
@@ -0,0 +1,62 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"net/url"
+	"strings"
+)
+
+// encodedExprPrefix marks a searchDir.Lookup name as
+// url.PathEscape-encoded, for an expression that can't otherwise
+// round-trip through a single path component unambiguously: one
+// containing a literal '/' (which no path component can hold at
+// all), a leading "match:"/"sort:" that would otherwise be mistaken
+// for one of searchDir's own reserved prefixes, a trailing '*' that
+// would be mistaken for matchDirPrefix's glob suffix, or a literal
+// searchDirOptionsSep that would be mistaken for the start of a
+// "#limit=...&sort=..." suffix. Encoding is never required for an
+// expression free of those, but always accepted.
+const encodedExprPrefix = "q:"
+
+// encodeSearchExprPath is decodeSearchExprPath's inverse: it's what a
+// caller (or a test) builds a Lookup name from when expr isn't known
+// to be free of the characters encodedExprPrefix's doc comment lists.
+func encodeSearchExprPath(expr string) string {
+	return encodedExprPrefix + url.PathEscape(expr)
+}
+
+// decodeSearchExprPath reports whether name carries encodedExprPrefix
+// and, if so, decodes the rest back into the literal expression it
+// was built from via encodeSearchExprPath. It must be tried before
+// any of searchDir.Lookup's other name-shape checks (blob.Parse,
+// splitSearchOptions, saved-search names), since those all assume an
+// un-encoded name and would otherwise misinterpret percent-escapes or
+// reserved-looking prefixes/suffixes as their own.
+func decodeSearchExprPath(name string) (expr string, ok bool) {
+	rest := strings.TrimPrefix(name, encodedExprPrefix)
+	if rest == name {
+		return "", false
+	}
+	decoded, err := url.PathUnescape(rest)
+	if err != nil {
+		return "", false
+	}
+	return decoded, true
+}
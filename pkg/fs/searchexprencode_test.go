@@ -0,0 +1,60 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestSearchExprPathRoundTrip is a regression test for
+// encodeSearchExprPath/decodeSearchExprPath: an expression built into
+// a "q:"-prefixed path component by one must come back unchanged from
+// the other, even when it contains characters a plain, unencoded name
+// would mishandle (a literal '/', a reserved-looking prefix/suffix,
+// or a quoted substring with embedded negation).
+func TestSearchExprPathRoundTrip(t *testing.T) {
+	exprs := []string{
+		`is:image and not is:pano`,
+		`after:"2015-10-01" and is:image`,
+		`camliContent/foo`,
+		`match:is:image*`,
+		`sort:-modtime and is:image`,
+		`is:image#limit=500`,
+		`attr:"a/b":"c\"d"`,
+	}
+	for _, expr := range exprs {
+		name := encodeSearchExprPath(expr)
+		got, ok := decodeSearchExprPath(name)
+		if !ok {
+			t.Errorf("decodeSearchExprPath(%q) = ok=false; want true", name)
+			continue
+		}
+		if got != expr {
+			t.Errorf("round-trip of %q via %q = %q; want unchanged", expr, name, got)
+		}
+	}
+}
+
+// TestDecodeSearchExprPathUnprefixed is a regression test for
+// decodeSearchExprPath's ok=false path: a name without
+// encodedExprPrefix is an ordinary, unencoded expression, not
+// something to decode.
+func TestDecodeSearchExprPathUnprefixed(t *testing.T) {
+	if _, ok := decodeSearchExprPath("is:image"); ok {
+		t.Errorf("decodeSearchExprPath(%q) = ok=true; want false", "is:image")
+	}
+}
@@ -0,0 +1,88 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "expvar"
+
+// These are the stable expvar names pkg/fs registers its aggregate
+// search counters under, for a dashboard that scrapes /debug/vars
+// directly rather than wiring up CamliFileSystem.Metrics. Unlike
+// Metrics (an operator-supplied MetricsCollector, one per
+// CamliFileSystem), these are process-wide: every searchResultDir in
+// every mount in this process increments the same counters, the same
+// way expvar's own memstats do.
+const (
+	searchQueriesTotalVarName     = "perkeep_fs_search_queries_total"
+	searchCacheHitsTotalVarName   = "perkeep_fs_search_cache_hits_total"
+	searchCacheMissTotalVarName   = "perkeep_fs_search_cache_misses_total"
+	searchResultsServedVarName    = "perkeep_fs_search_results_served_total"
+	searchDescribeSkipsMapVarName = "perkeep_fs_search_describe_skips_total"
+)
+
+var (
+	searchQueriesTotal   = publishIntOnce(searchQueriesTotalVarName)
+	searchCacheHitsTotal = publishIntOnce(searchCacheHitsTotalVarName)
+	searchCacheMissTotal = publishIntOnce(searchCacheMissTotalVarName)
+	searchResultsServed  = publishIntOnce(searchResultsServedVarName)
+	// searchDescribeSkips counts describe-time skips by reason
+	// ("elided", "fallback", "unresolved", "bad_content", "degraded");
+	// see doReaddir's own totalElided/totalFallbacks/totalUnresolved/
+	// badContent/allDegraded, which is where these counts originate.
+	searchDescribeSkips = publishMapOnce(searchDescribeSkipsMapVarName)
+)
+
+// publishIntOnce registers a new expvar.Int under name, or returns the
+// one already registered under that name if this is a second mount
+// (or a second test) in the same process publishing it again: expvar
+// itself panics on a duplicate Publish, which a single long-lived
+// process mounting more than once (or a test package running more
+// than one test binary invocation) would otherwise hit immediately.
+func publishIntOnce(name string) *expvar.Int {
+	if v := expvar.Get(name); v != nil {
+		if i, ok := v.(*expvar.Int); ok {
+			return i
+		}
+	}
+	i := new(expvar.Int)
+	expvar.Publish(name, i)
+	return i
+}
+
+// publishMapOnce is publishIntOnce's *expvar.Map counterpart, for
+// searchDescribeSkips's by-reason breakdown.
+func publishMapOnce(name string) *expvar.Map {
+	if v := expvar.Get(name); v != nil {
+		if m, ok := v.(*expvar.Map); ok {
+			return m
+		}
+	}
+	m := new(expvar.Map).Init()
+	expvar.Publish(name, m)
+	return m
+}
+
+// incDescribeSkip adds n to searchDescribeSkips's count for reason, a
+// no-op for n <= 0 so a zero-valued doReaddir counter (the common
+// case: most passes skip nothing) doesn't even touch the map.
+func incDescribeSkip(reason string, n int) {
+	if n <= 0 {
+		return
+	}
+	searchDescribeSkips.Add(reason, int64(n))
+}
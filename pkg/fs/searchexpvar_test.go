@@ -0,0 +1,75 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/types"
+)
+
+// TestReadDirAllAdvancesExpvarCountersOnHitAndMiss checks that a
+// ReadDirAll served from the cache advances searchCacheHitsTotal, and
+// one that has to (attempt to) query advances searchCacheMissTotal
+// and searchQueriesTotal, without double-counting the other.
+func TestReadDirAllAdvancesExpvarCountersOnHitAndMiss(t *testing.T) {
+	// A snapshot ("at") directory with a non-zero lastReaddir is
+	// haveCachedListing's simplest always-true case, letting this
+	// exercise ReadDirAll's real cache-hit branch without a client.
+	now := types.Time3339FromTime(time.Now())
+	hit := &searchResultDir{
+		fs:          &CamliFileSystem{},
+		at:          &now,
+		lastReaddir: time.Now(),
+		ents:        map[string]*search.DescribedBlob{},
+		lastNames:   []string{"a.jpg", "b.jpg"},
+	}
+
+	hitsBefore := searchCacheHitsTotal.Value()
+	servedBefore := searchResultsServed.Value()
+	if _, err := hit.ReadDirAll(context.Background()); err != nil {
+		t.Fatalf("ReadDirAll on a cached snapshot dir = %v; want nil", err)
+	}
+	if got := searchCacheHitsTotal.Value(); got != hitsBefore+1 {
+		t.Errorf("searchCacheHitsTotal = %d; want %d", got, hitsBefore+1)
+	}
+	if got := searchResultsServed.Value(); got != servedBefore+2 {
+		t.Errorf("searchResultsServed = %d; want %d (2 names served)", got, servedBefore+2)
+	}
+
+	// A freshly-constructed, never-seeded directory with no client is
+	// always a cache miss; doReaddir fails fast (fuse.client is nil)
+	// but only after refresh has already counted the miss.
+	miss := &searchResultDir{fs: &CamliFileSystem{}}
+
+	missesBefore := searchCacheMissTotal.Value()
+	queriesBefore := searchQueriesTotal.Value()
+	if _, err := miss.ReadDirAll(context.Background()); err == nil {
+		t.Fatalf("ReadDirAll on an unseeded dir with no client = nil error; want one")
+	}
+	if got := searchCacheMissTotal.Value(); got != missesBefore+1 {
+		t.Errorf("searchCacheMissTotal = %d; want %d", got, missesBefore+1)
+	}
+	if got := searchQueriesTotal.Value(); got != queriesBefore+1 {
+		t.Errorf("searchQueriesTotal = %d; want %d", got, queriesBefore+1)
+	}
+}
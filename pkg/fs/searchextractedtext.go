@@ -0,0 +1,57 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// addExtractedTextEntry adds a "<name>.txt" sibling of name, holding
+// de's permanode's n.fs.ExtractedTextAttr value, into extractedText
+// (name to literal text content, read back by searchResultDir.Lookup)
+// and lastNames; ents, the map de's own entry was just added to, is
+// only checked for collisions, never written. A permanode with no such attribute, or an
+// empty one, gets no sibling. A sibling name that collides with an
+// entry already present (de's own, an earlier sibling, or an
+// unrelated result) is skipped and logged to errLog rather than
+// overwriting it, the same caution addRenditionEntries takes.
+func (n *searchResultDir) addExtractedTextEntry(name string, de dir.Entry, ents map[string]*search.DescribedBlob, extractedText map[string]string, lastNames *[]string, errLog *[]string) {
+	if de.PNodeMeta == nil || de.PNodeMeta.Permanode == nil {
+		return
+	}
+	text := de.PNodeMeta.Permanode.Attr.Get(n.fs.ExtractedTextAttr)
+	if text == "" {
+		return
+	}
+	sibling := name + ".txt"
+	if _, taken := ents[sibling]; taken {
+		*errLog = append(*errLog, fmt.Sprintf("extracted-text sibling %q of permanode %v collides with an existing entry; skipped", sibling, de.Permanode))
+		return
+	}
+	if _, taken := extractedText[sibling]; taken {
+		*errLog = append(*errLog, fmt.Sprintf("extracted-text sibling %q of permanode %v collides with an existing entry; skipped", sibling, de.Permanode))
+		return
+	}
+	extractedText[sibling] = text
+	debugf("fs.search: name %q = extracted text of permanode %v", sibling, de.Permanode)
+	*lastNames = append(*lastNames, sibling)
+}
@@ -0,0 +1,113 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"net/url"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// extractedTextEntry returns a dir.Entry whose permanode carries attr
+// set to text, for a test to feed addExtractedTextEntry.
+func extractedTextEntry(attr, text string) dir.Entry {
+	pn := blob.RefFromString("doc")
+	attrs := url.Values{}
+	if attr != "" {
+		attrs.Set(attr, text)
+	}
+	return dir.Entry{
+		Permanode: pn,
+		PNodeMeta: &search.DescribedBlob{
+			BlobRef:   pn,
+			Permanode: &search.DescribedPermanode{Attr: attrs},
+		},
+	}
+}
+
+// TestAddExtractedTextEntryAddsSibling checks that a permanode
+// carrying ExtractedTextAttr gets a "<name>.txt" sibling exposing its
+// value.
+func TestAddExtractedTextEntryAddsSibling(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{ExtractedTextAttr: "extractedText"}}
+	de := extractedTextEntry("extractedText", "hello world")
+	ents := map[string]*search.DescribedBlob{"doc.pdf": de.Blob}
+	extractedText := make(map[string]string)
+	var lastNames []string
+	var errLog []string
+
+	n.addExtractedTextEntry("doc.pdf", de, ents, extractedText, &lastNames, &errLog)
+
+	if got, ok := extractedText["doc.pdf.txt"]; !ok || got != "hello world" {
+		t.Errorf(`extractedText["doc.pdf.txt"] = %q, %v; want "hello world", true`, got, ok)
+	}
+	if len(lastNames) != 1 || lastNames[0] != "doc.pdf.txt" {
+		t.Errorf("lastNames = %v; want [doc.pdf.txt]", lastNames)
+	}
+	if len(errLog) != 0 {
+		t.Errorf("errLog = %v; want empty", errLog)
+	}
+}
+
+// TestAddExtractedTextEntryNoAttr checks that a permanode with no
+// value under ExtractedTextAttr gets no sibling.
+func TestAddExtractedTextEntryNoAttr(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{ExtractedTextAttr: "extractedText"}}
+	de := extractedTextEntry("", "")
+	ents := map[string]*search.DescribedBlob{"doc.pdf": de.Blob}
+	extractedText := make(map[string]string)
+	var lastNames []string
+	var errLog []string
+
+	n.addExtractedTextEntry("doc.pdf", de, ents, extractedText, &lastNames, &errLog)
+
+	if len(extractedText) != 0 {
+		t.Errorf("extractedText = %v; want empty", extractedText)
+	}
+	if len(lastNames) != 0 {
+		t.Errorf("lastNames = %v; want empty", lastNames)
+	}
+}
+
+// TestAddExtractedTextEntryCollision checks that a sibling name
+// already taken by a real entry is skipped and logged rather than
+// overwritten.
+func TestAddExtractedTextEntryCollision(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{ExtractedTextAttr: "extractedText"}}
+	de := extractedTextEntry("extractedText", "hello world")
+	ents := map[string]*search.DescribedBlob{
+		"doc.pdf":     de.Blob,
+		"doc.pdf.txt": {BlobRef: blob.RefFromString("other")},
+	}
+	extractedText := make(map[string]string)
+	var lastNames []string
+	var errLog []string
+
+	n.addExtractedTextEntry("doc.pdf", de, ents, extractedText, &lastNames, &errLog)
+
+	if len(extractedText) != 0 {
+		t.Errorf("extractedText = %v; want empty (collision skipped)", extractedText)
+	}
+	if len(errLog) == 0 {
+		t.Errorf("errLog is empty; want a collision entry logged")
+	}
+}
@@ -0,0 +1,89 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"perkeep.org/pkg/search"
+)
+
+// facetsFileName is a hidden, per-searchResultDir file reporting
+// aggregate counts of the directory's current listing, grouped by
+// each of CamliFileSystem.FacetAttrs, as JSON:
+// {"tag": {"vacation": 3, "work": 1}, "mimeType": {"image/jpeg": 4}}.
+// It's computed once per doReaddir pass from that pass's resolved
+// entries (see computeFacetCounts) rather than recomputed on every
+// read, the same point-in-time snapshot n.ents/n.lastNames/etc. are
+// themselves refreshed from, so a read between refreshes always
+// matches the listing currently visible via ReadDirAll. Like
+// explainFileName, it's only resolvable via Lookup, and only listed
+// in ReadDirAll with ShowDotfiles, when CamliFileSystem.EnableFacetsFile
+// is set.
+const facetsFileName = ".facets.json"
+
+// computeFacetCounts builds the facet counts attrs asks for over
+// lastNames, for facetsFileName. It's called from doReaddir with the
+// same locally-built ents/pnodeMeta/modTime doReaddir is about to
+// store onto n, before any of them are reachable from another
+// goroutine, so it needs no locking of its own. Returns nil if attrs
+// is empty, so facetsFileContents can tell "never configured" apart
+// from "configured but everything came back empty".
+func (n *searchResultDir) computeFacetCounts(attrs []string, lastNames []string, ents, pnodeMeta map[string]*search.DescribedBlob, modTime map[string]time.Time) map[string]map[string]int {
+	if len(attrs) == 0 {
+		return nil
+	}
+	counts := make(map[string]map[string]int, len(attrs))
+	for _, attr := range attrs {
+		counts[attr] = make(map[string]int)
+	}
+	for _, name := range lastNames {
+		for _, attr := range attrs {
+			switch attr {
+			case "mimeType":
+				if db := ents[name]; db != nil && db.File != nil && db.File.MIMEType != "" {
+					counts[attr][db.File.MIMEType]++
+				}
+			case "year":
+				if t := modTime[name]; !t.IsZero() {
+					counts[attr][strconv.Itoa(t.Year())]++
+				}
+			default:
+				if db := pnodeMeta[name]; db != nil && db.Permanode != nil {
+					for _, v := range db.Permanode.Attr[attr] {
+						counts[attr][v]++
+					}
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// facetsFileContents renders facetsFileName's content from n's
+// current n.facetCounts. It must be called with n.mu held.
+func (n *searchResultDir) facetsFileContents() ([]byte, error) {
+	b, err := json.MarshalIndent(n.facetCounts, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,161 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+	"perkeep.org/pkg/search"
+)
+
+// FailoverQueryFetcher is the read-path subset of a Perkeep client's
+// capabilities that CamliFileSystem.ServerEndpoints fails over across:
+// a *perkeep.org/pkg/client.Client satisfies it already, the same way
+// one satisfies Subscriber or SinceQuerier. Only the read path
+// (queryWithFailover, fetchSchemaBlobWithFailover) ever consults
+// ServerEndpoints; a mutation (UploadAndSignBlob, UploadNewPermanode,
+// ...) always goes to CamliFileSystem's own configured client and
+// never fails over, since a replica behind the primary on replication
+// lag accepting a write anyway would silently diverge from it instead
+// of erroring loudly.
+type FailoverQueryFetcher interface {
+	Query(ctx context.Context, q *search.SearchQuery) (*search.SearchResult, error)
+	FetchSchemaBlob(ctx context.Context, br blob.Ref) (*schema.Blob, error)
+}
+
+// failoverState is CamliFileSystem's sticky-active-endpoint bookkeeping
+// for ServerEndpoints, lazily created by failoverStateFor.
+type failoverState struct {
+	mu        sync.Mutex
+	active    int         // index into fsys.ServerEndpoints currently preferred
+	downUntil []time.Time // per-endpoint cooldown expiry; zero means not down
+}
+
+var (
+	failoverStatesMu sync.Mutex
+	failoverStates   = map[*CamliFileSystem]*failoverState{}
+)
+
+// failoverStateFor returns fsys's failoverState, creating it on first
+// use. It's keyed by fsys the same way searchDirCacheFor keys a
+// CamliFileSystem's searchDirCache, since CamliFileSystem itself can't
+// gain an unexported field from this package (it's defined in fs.go).
+func failoverStateFor(fsys *CamliFileSystem) *failoverState {
+	failoverStatesMu.Lock()
+	defer failoverStatesMu.Unlock()
+	st, ok := failoverStates[fsys]
+	if !ok {
+		st = &failoverState{downUntil: make([]time.Time, len(fsys.ServerEndpoints))}
+		failoverStates[fsys] = st
+	}
+	return st
+}
+
+// defaultFailoverCooldown is how long a failed endpoint is skipped
+// before queryWithFailover/fetchSchemaBlobWithFailover tries it again,
+// when CamliFileSystem.FailoverCooldown is unset.
+const defaultFailoverCooldown = 30 * time.Second
+
+func (fsys *CamliFileSystem) effectiveFailoverCooldown() time.Duration {
+	if fsys.FailoverCooldown != 0 {
+		return fsys.FailoverCooldown
+	}
+	return defaultFailoverCooldown
+}
+
+// tryEndpoints calls fn against each of fsys.ServerEndpoints in turn,
+// starting from the sticky-active one, skipping any still in cooldown,
+// until one succeeds or every endpoint has been tried once. A
+// candidate that succeeds becomes the new sticky-active endpoint; one
+// that fails is put into cooldown for effectiveFailoverCooldown and
+// logged, and feeds metricsFor(fsys).IncFailover. If ServerEndpoints
+// is empty, fn is called exactly once against primary and its result
+// returned as-is: today's pre-failover behavior, unchanged.
+func tryEndpoints(fsys *CamliFileSystem, primary FailoverQueryFetcher, fn func(FailoverQueryFetcher) error) error {
+	if len(fsys.ServerEndpoints) == 0 {
+		return fn(primary)
+	}
+	st := failoverStateFor(fsys)
+	st.mu.Lock()
+	start := st.active
+	st.mu.Unlock()
+
+	now := time.Now()
+	var lastErr error
+	for i := 0; i < len(fsys.ServerEndpoints); i++ {
+		idx := (start + i) % len(fsys.ServerEndpoints)
+		st.mu.Lock()
+		down := st.downUntil[idx]
+		st.mu.Unlock()
+		if !down.IsZero() && now.Before(down) {
+			continue
+		}
+		err := fn(fsys.ServerEndpoints[idx])
+		if err == nil {
+			st.mu.Lock()
+			st.active = idx
+			st.downUntil[idx] = time.Time{}
+			st.mu.Unlock()
+			return nil
+		}
+		lastErr = err
+		st.mu.Lock()
+		st.downUntil[idx] = now.Add(fsys.effectiveFailoverCooldown())
+		st.mu.Unlock()
+		Logger.Printf("fs.search: endpoint %d failed, failing over: %v", idx, err)
+		metricsFor(fsys).IncFailover()
+	}
+	return lastErr
+}
+
+// queryWithFailover runs q against fsys.ServerEndpoints per
+// tryEndpoints, or directly against primary if ServerEndpoints isn't
+// set.
+func (fsys *CamliFileSystem) queryWithFailover(ctx context.Context, primary FailoverQueryFetcher, q *search.SearchQuery) (*search.SearchResult, error) {
+	var res *search.SearchResult
+	err := tryEndpoints(fsys, primary, func(c FailoverQueryFetcher) error {
+		r, err := c.Query(ctx, q)
+		if err != nil {
+			return err
+		}
+		res = r
+		return nil
+	})
+	return res, err
+}
+
+// fetchSchemaBlobWithFailover fetches br via fsys.ServerEndpoints per
+// tryEndpoints, or directly against primary if ServerEndpoints isn't
+// set.
+func (fsys *CamliFileSystem) fetchSchemaBlobWithFailover(ctx context.Context, primary FailoverQueryFetcher, br blob.Ref) (*schema.Blob, error) {
+	var blobv *schema.Blob
+	err := tryEndpoints(fsys, primary, func(c FailoverQueryFetcher) error {
+		b, err := c.FetchSchemaBlob(ctx, br)
+		if err != nil {
+			return err
+		}
+		blobv = b
+		return nil
+	})
+	return blobv, err
+}
@@ -0,0 +1,76 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// federationServerTag is the suffix federatedEntries appends to a
+// colliding entry's name for the extra client at index i among
+// n.fs.ExtraSearchClients (e.g. "-server2"; the primary client is
+// implicitly "server1"), since a dir.Querier carries no identifying
+// name of its own to disambiguate with.
+func federationServerTag(i int) string {
+	return fmt.Sprintf("-server%d", i+2)
+}
+
+// federatedEntries queries each of n.fs.ExtraSearchClients with n's
+// own search expression, for doReaddir to fold into its primary
+// client's first page (see the ReadDirAll call site). Only the first
+// page of each extra server is fetched: independent servers have no
+// shared continuation token to page through together, so a mount
+// spanning federated servers trades full pagination on the extras for
+// the simpler "cd in and see everything that currently matches"
+// behavior the federation request asked for. used tracks names
+// already claimed (by the primary's own first page, and by every
+// extra server already folded in) so a colliding name picks up a
+// server tag rather than one entry silently shadowing another; seen
+// is the same cycle-detection map dir.ResolvePage's primary call
+// received, shared across servers so a set's member isn't revisited
+// twice. A server that errors is logged and skipped, degrading
+// gracefully rather than failing the whole ReadDirAll.
+func (n *searchResultDir) federatedEntries(ctx context.Context, seen map[string]bool, used map[string]bool, depth int) []dir.Entry {
+	var out []dir.Entry
+	for i, q := range n.fs.ExtraSearchClients {
+		ents, _, _, _, _, _, _, _, _, err := dir.ResolvePage(ctx, q, n.effectiveSearchExpr(), n.at, "", seen, depth, n.effectiveDescribeRules(), search.UnspecifiedSort, n.fs.NameAttribute, n.fs.GroupByAttribute, n.fs.MIMEPreference, n.fs.effectiveContentIndirectionHops(), n.fs.IncludeContentless, n.fs.effectiveUndescribedContentPolicy(), n.fs.effectiveDescribeStrategy(), 0, n.fs.PrimaryContentAttr, n.fs.effectiveMaxInlineSetMembers(), n.fs.ContentAttrAliases, n.fs.TitleAttrAliases, n.fs.effectiveSpecialContentPolicy())
+		if err != nil {
+			Logger.Printf("fs.search: ReadDirAll for '%s': federated server %d: %v", n.searchExp, i+2, err)
+			continue
+		}
+		for _, e := range ents {
+			if used[e.Name] {
+				e.Name += federationServerTag(i)
+				for used[e.Name] {
+					// Still colliding (e.g. two extra servers both
+					// producing the same tagged name): the
+					// permanode's own blobref is always unique.
+					e.Name += "-" + e.Permanode.String()
+				}
+			}
+			used[e.Name] = true
+			out = append(out, e)
+		}
+	}
+	return out
+}
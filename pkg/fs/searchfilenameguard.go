@@ -0,0 +1,76 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"strings"
+
+	"perkeep.org/pkg/blob"
+)
+
+// guardedDotNames are path components that must never survive into a
+// fuse.Dirent.Name: taken literally by a caller doing its own path
+// walking, both mean something other than the entry they'd otherwise
+// name ("this directory" and "its parent"), the same way they would
+// in any other POSIX path.
+var guardedDotNames = map[string]bool{".": true, "..": true}
+
+// guardFilename is the mandatory counterpart to sanitizeFilename and
+// stripControlChars: both are opt-in policies (FilenameSanitize,
+// FilenameControlChars) that preserve the historical behavior unless
+// a mount explicitly enables them, but a name the kernel rejects
+// outright, or that silently aliases a different entry, isn't a
+// cosmetic choice that should stay gated behind a flag. It replaces
+// any '/' or NUL byte still in name, whether or not FilenameSanitize
+// already ran, with '_', and collapses a name that's exactly "." or
+// ".." (or empty, once illegal characters are stripped) to pn's own
+// blobref, the same fallback dir.fileOrDirEntry and
+// stableCollisionName already use when nothing better is on hand.
+//
+// seen then disambiguates the result against every other name already
+// passed through guardFilename this pass (via stableCollisionName),
+// the same way n.stableOwners disambiguates stableName's own
+// collisions: two differently-pathological raw names that happen to
+// guard down to the same string still don't end up aliasing each
+// other. Every name this pass sees, not just the ones guardFilename
+// actually had to change, must be passed through it, so a later
+// pathological name can be caught colliding against an earlier,
+// perfectly ordinary one too.
+func guardFilename(name string, pn blob.Ref, seen map[string]blob.Ref) string {
+	guarded := name
+	if strings.ContainsAny(guarded, "/\x00") {
+		var b strings.Builder
+		for _, r := range guarded {
+			if r == '/' || r == 0 {
+				b.WriteByte('_')
+				continue
+			}
+			b.WriteRune(r)
+		}
+		guarded = b.String()
+	}
+	if guarded == "" || guardedDotNames[guarded] {
+		guarded = pn.String()
+	}
+	if owner, taken := seen[guarded]; taken && owner != pn {
+		guarded = stableCollisionName(guarded, pn)
+	}
+	seen[guarded] = pn
+	return guarded
+}
@@ -0,0 +1,88 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"strings"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+)
+
+// TestGuardFilenameReplacesSlashAndNUL checks that a name with an
+// embedded path separator or NUL byte comes back with neither,
+// regardless of CamliFileSystem.FilenameSanitize, since guardFilename
+// is the mandatory backstop, not the opt-in policy.
+func TestGuardFilenameReplacesSlashAndNUL(t *testing.T) {
+	pn := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	got := guardFilename("evil/name\x00here", pn, map[string]blob.Ref{})
+	if strings.ContainsAny(got, "/\x00") {
+		t.Errorf("guardFilename(%q) = %q; still contains an illegal character", "evil/name\x00here", got)
+	}
+}
+
+// TestGuardFilenameCollapsesDotNames checks that "." and ".." each
+// collapse to pn's own blobref rather than surviving as a name a
+// naive path walk would misread as "this directory" or "its parent".
+func TestGuardFilenameCollapsesDotNames(t *testing.T) {
+	pn := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+	for _, raw := range []string{".", ".."} {
+		got := guardFilename(raw, pn, map[string]blob.Ref{})
+		if got != pn.String() {
+			t.Errorf("guardFilename(%q) = %q; want pn's own blobref %q", raw, got, pn.String())
+		}
+	}
+}
+
+// TestGuardFilenameDeterministic checks that guarding the same raw
+// name for the same permanode, against a fresh seen map each time,
+// always produces the same result.
+func TestGuardFilenameDeterministic(t *testing.T) {
+	pn := blob.MustParse("sha224-3333333333333333333333333333333333333333333333333333333333333333")
+	first := guardFilename("weird\x00name.jpg", pn, map[string]blob.Ref{})
+	second := guardFilename("weird\x00name.jpg", pn, map[string]blob.Ref{})
+	if first != second {
+		t.Errorf("guardFilename isn't deterministic: got %q then %q", first, second)
+	}
+}
+
+// TestGuardFilenameHandlesCollisions checks that two different
+// permanodes whose raw names both guard down to the same string still
+// end up with distinct final names, and that neither aliases a third,
+// already-guarded ordinary name sharing the same seen map.
+func TestGuardFilenameHandlesCollisions(t *testing.T) {
+	pnPlain := blob.MustParse("sha224-4444444444444444444444444444444444444444444444444444444444444444")
+	pnFirst := blob.MustParse("sha224-5555555555555555555555555555555555555555555555555555555555555555")
+	pnSecond := blob.MustParse("sha224-6666666666666666666666666666666666666666666666666666666666666666")
+
+	seen := map[string]blob.Ref{}
+	plain := guardFilename("photo.jpg", pnPlain, seen)
+	first := guardFilename("..", pnFirst, seen)
+	second := guardFilename("..", pnSecond, seen)
+
+	if first == second {
+		t.Fatalf("two different permanodes' %q both guarded to %q", "..", first)
+	}
+	if first == plain || second == plain {
+		t.Errorf("a guarded name collided with the unrelated entry %q", plain)
+	}
+	if seen[first] != pnFirst || seen[second] != pnSecond || seen[plain] != pnPlain {
+		t.Errorf("seen map wasn't updated for every guarded name: %v", seen)
+	}
+}
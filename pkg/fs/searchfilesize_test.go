@@ -0,0 +1,55 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestAttrReportsKnownSize checks that Attr reports a
+// searchResultFile's already-known describe size immediately, without
+// requiring the node to resolve it lazily.
+func TestAttrReportsKnownSize(t *testing.T) {
+	n := &searchResultFile{node: node{fs: &CamliFileSystem{}}, size: 12345, haveSize: true}
+	var a fuse.Attr
+	if err := n.Attr(context.Background(), &a); err != nil {
+		t.Fatalf("Attr() error = %v", err)
+	}
+	if a.Size != 12345 {
+		t.Errorf("Attr().Size = %d; want 12345", a.Size)
+	}
+}
+
+// TestAttrHaveSizeFalseLeavesOverrideUnset checks that a
+// searchResultFile built without a describe size (haveSize false,
+// e.g. searchCreateHandle's brand-new file) skips the size override
+// entirely, so it never reports a stale or zeroed size in its place.
+func TestAttrHaveSizeFalseLeavesOverrideUnset(t *testing.T) {
+	n := &searchResultFile{node: node{fs: &CamliFileSystem{}}}
+	if n.haveSize {
+		t.Fatal("zero-value searchResultFile.haveSize = true; want false")
+	}
+	var a fuse.Attr
+	if err := n.Attr(context.Background(), &a); err != nil {
+		t.Fatalf("Attr() error = %v", err)
+	}
+}
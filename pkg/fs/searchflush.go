@@ -0,0 +1,46 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+
+	"bazil.org/fuse"
+)
+
+// Flush implements fs.HandleFlusher. Some applications (image
+// viewers, editors) call fsync/flush even on a file they only read,
+// and without this, that call fails with an unimplemented error for
+// no reason a read-only viewer would expect. A searchResultFile never
+// buffers any write of its own to flush here: a brand-new file's
+// content goes through searchCreateHandle instead, which uploads and
+// sets camliContent in one shot on Release rather than holding
+// anything back, so there's genuinely nothing pending on n either way.
+// If a future write path starts queuing claims against n's permanode
+// instead of applying them immediately, flushing them belongs here,
+// gated on !n.readOnly, rather than folded into this no-op.
+func (n *searchResultFile) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	return nil
+}
+
+// Fsync implements fs.NodeFsyncer, for the same reason Flush does:
+// see Flush's doc comment.
+func (n *searchResultFile) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	return nil
+}
@@ -0,0 +1,47 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestFlushReadOnlySucceeds checks that Flush on a read-only
+// searchResultFile (e.g. one reached through a search/at/... snapshot
+// directory) succeeds instead of returning an unimplemented error, so
+// an application's close(2)-triggered flush of a file it only read
+// doesn't fail for no reason.
+func TestFlushReadOnlySucceeds(t *testing.T) {
+	n := &searchResultFile{readOnly: true}
+	if err := n.Flush(context.Background(), &fuse.FlushRequest{}); err != nil {
+		t.Errorf("Flush() on a read-only file = %v; want nil", err)
+	}
+}
+
+// TestFsyncReadOnlySucceeds is Fsync's analogue of
+// TestFlushReadOnlySucceeds.
+func TestFsyncReadOnlySucceeds(t *testing.T) {
+	n := &searchResultFile{readOnly: true}
+	if err := n.Fsync(context.Background(), &fuse.FsyncRequest{}); err != nil {
+		t.Errorf("Fsync() on a read-only file = %v; want nil", err)
+	}
+}
@@ -0,0 +1,73 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// flushCacheFileName is a hidden, mount-wide control file at the
+// search mount root: a write to it invalidates every searchResultDir
+// currently registered with the mount's searchWatcher (see
+// watcherFor), the same way a single directory's own refreshFileName
+// invalidates just that one. It's for an operator who just finished a
+// bulk import and wants every "ls" across the whole mount to re-query
+// rather than tracking down and writing each directory's own
+// .refresh individually. It's always resolvable via Lookup but,
+// unlike refreshFileName, never appears in a listing, with or without
+// ShowDotfiles.
+const flushCacheFileName = ".flushcache"
+
+// flushCacheControlFile is flushCacheFileName's Node and Handle. A
+// read is a no-op rather than an error, the same as a read of
+// refreshFileName is treated as "also flush", so a shell's `cat`
+// doesn't fail on it; only a write is documented to flush, since
+// that's the operation the README tells an operator to script.
+type flushCacheControlFile struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node         = flushCacheControlFile{}
+	_ fs.HandleReader = flushCacheControlFile{}
+	_ fs.HandleWriter = flushCacheControlFile{}
+)
+
+func (f flushCacheControlFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Valid = f.fs.effectiveAttrValidity()
+	return nil
+}
+
+func (f flushCacheControlFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	return nil
+}
+
+func (f flushCacheControlFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := f.fs.checkWritable(); err != nil {
+		return err
+	}
+	n := watcherFor(f.fs).invalidateAll()
+	Logger.Printf("fs.search: %q written: %d cached search director(y|ies) invalidated", flushCacheFileName, n)
+	resp.Size = len(req.Data)
+	return nil
+}
@@ -0,0 +1,70 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// TestFlushCacheControlFileWriteInvalidatesAllRegisteredDirs checks
+// that writing ".flushcache" invalidates every searchResultDir
+// registered with the mount's searchWatcher (the same registration
+// ReadDirAll performs on every call), not just one, and that a
+// directory never registered (never actually warmed) is left alone
+// rather than causing an error.
+func TestFlushCacheControlFileWriteInvalidatesAllRegisteredDirs(t *testing.T) {
+	fsys := &CamliFileSystem{}
+
+	a := &searchResultDir{fs: fsys, searchExp: "is:image", lastReaddir: time.Now()}
+	b := &searchResultDir{fs: fsys, searchExp: "is:video", lastReaddir: time.Now()}
+	unregistered := &searchResultDir{fs: fsys, searchExp: "is:audio", lastReaddir: time.Now()}
+
+	// Simulate the registration ReadDirAll performs on a real warmed
+	// directory, without needing a real search client to drive it.
+	watcherFor(fsys).register(a)
+	watcherFor(fsys).register(b)
+
+	for _, d := range []*searchResultDir{a, b, unregistered} {
+		if !d.haveCachedListing(time.Hour, 0) {
+			t.Fatalf("%q: haveCachedListing before flush = false; want true (warmed)", d.searchExp)
+		}
+	}
+
+	f := flushCacheControlFile{fs: fsys}
+	if err := f.Write(context.Background(), &fuse.WriteRequest{Data: []byte("x")}, &fuse.WriteResponse{}); err != nil {
+		t.Fatalf("Write = %v; want nil", err)
+	}
+
+	if a.haveCachedListing(time.Hour, 0) {
+		t.Error("a.haveCachedListing after flush = true; want false (re-queries on next access)")
+	}
+	if b.haveCachedListing(time.Hour, 0) {
+		t.Error("b.haveCachedListing after flush = true; want false (re-queries on next access)")
+	}
+	if !unregistered.haveCachedListing(time.Hour, 0) {
+		t.Error("unregistered.haveCachedListing after flush = false; want true (never registered, untouched)")
+	}
+
+	watcherFor(fsys).unregister(a)
+	watcherFor(fsys).unregister(b)
+}
@@ -0,0 +1,109 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForGoroutineCount polls got until it reaches want or deadlineFor
+// elapses, so the test doesn't have to guess how long a canceled
+// goroutine takes to actually exit.
+func waitForGoroutineCount(t *testing.T, got *int32, want int32) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if atomic.LoadInt32(got) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutine counter = %d after deadline; want %d", atomic.LoadInt32(got), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newForgetTestDir returns a searchResultDir standing in for one that
+// just ran startPrefetch: running is incremented while its "owned"
+// goroutine is alive and decremented once ctx is canceled, the same
+// lifecycle prefetch itself follows via n.prefetchCancel, without
+// this test needing a fake search client to drive prefetch for real.
+func newForgetTestDir(running *int32) *searchResultDir {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	n.prefetchCancel = cancel
+	atomic.AddInt32(running, 1)
+	go func() {
+		<-ctx.Done()
+		atomic.AddInt32(running, -1)
+	}()
+	return n
+}
+
+// TestSearchResultDirForgetStopsOwnedGoroutine checks that Forget
+// cancels a still-running owned goroutine (see startPrefetch), that a
+// second Forget on the same node is a safe no-op, and that a freshly
+// created node afterwards starts with no goroutine of its own already
+// running.
+func TestSearchResultDirForgetStopsOwnedGoroutine(t *testing.T) {
+	var running int32
+
+	n := newForgetTestDir(&running)
+	waitForGoroutineCount(t, &running, 1)
+
+	n.Forget()
+	waitForGoroutineCount(t, &running, 0)
+	n.Forget() // double-forget must not panic or double-cancel badly
+
+	n2 := newForgetTestDir(&running)
+	waitForGoroutineCount(t, &running, 1)
+	n2.Forget()
+	waitForGoroutineCount(t, &running, 0)
+}
+
+// TestSearchDirForgetForwardsToRootDir checks that searchDir.Forget
+// tears down its lazily built root() searchResultDir, including
+// stopping that node's owned goroutine, and that root() re-initializes
+// cleanly (a fresh searchResultDir, not the forgotten one) if n is
+// looked up again afterward.
+func TestSearchDirForgetForwardsToRootDir(t *testing.T) {
+	var running int32
+	n := &searchDir{fs: &CamliFileSystem{DefaultSearchExpression: "is:image"}}
+
+	first := n.root()
+	ctx, cancel := context.WithCancel(context.Background())
+	first.prefetchCancel = cancel
+	atomic.AddInt32(&running, 1)
+	go func() {
+		<-ctx.Done()
+		atomic.AddInt32(&running, -1)
+	}()
+
+	n.Forget()
+	waitForGoroutineCount(t, &running, 0)
+	n.Forget() // double-forget must not panic
+
+	second := n.root()
+	if second == first {
+		t.Fatal("root() after Forget returned the forgotten searchResultDir instead of a fresh one")
+	}
+}
@@ -0,0 +1,50 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"hash/fnv"
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+)
+
+// contentGeneration derives a value from ref's string form that's
+// stable for that blobref and changes whenever ref does, the same way
+// inodeTable.inodeFor derives a stable inode number from a blobref:
+// an FNV-1a hash, rather than a counter, so it needs no shared state
+// and agrees with itself however many times it's called.
+func contentGeneration(ref blob.Ref) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(ref.String()))
+	return h.Sum64()
+}
+
+// applyContentGeneration overrides a.Ctime (already set by
+// applyCreateTime) with one derived from n.blobref, when
+// n.fs.ExposeContentGeneration is set and n.blobref is valid. See
+// ExposeContentGeneration.
+func (n *searchResultFile) applyContentGeneration(a *fuse.Attr) {
+	if !n.fs.ExposeContentGeneration || !n.blobref.Valid() {
+		return
+	}
+	gen := contentGeneration(n.blobref)
+	a.Ctime = time.Unix(int64(gen&0x7fffffff), 0).UTC()
+}
@@ -0,0 +1,113 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// globMetaChars are the path.Match metacharacters hasGlobMeta looks
+// for to tell a glob-filter Lookup name from an ordinary filename.
+const globMetaChars = "*?["
+
+// hasGlobMeta reports whether name contains a path.Match
+// metacharacter. A real filename carrying one is rare enough that
+// Lookup treating it as a glob instead is the more useful default,
+// the same tradeoff describeJSONSuffix's collision risk already
+// accepts for ".describe.json".
+func hasGlobMeta(name string) bool {
+	return strings.ContainsAny(name, globMetaChars)
+}
+
+// globDir lists the subset of its parent's results whose name matches
+// a path.Match pattern, filtering n.ents the same way bySizeDir and
+// byTagTreeDir already bucket it rather than ANDing a new term onto
+// the search expression: "ls search/<expr>/*.jpg" reuses whatever the
+// parent's own ReadDirAll already seeded instead of running a new
+// query, only falling back to one via ensureSeeded if the parent's
+// cache is still cold.
+//
+// Lookup only ever builds a globDir for a glob-meta name that isn't
+// already one of globSuffix/matchDirPrefix's reserved spellings, so a
+// trailing "*" or a "match:" prefix keep narrowing the search
+// server-side as they always have; those two can only express a
+// prefix match anyway, so a pattern path.Match can do but they can't
+// (a suffix like "*.jpg", a character class like "IMG_[0-9]*") always
+// lands here instead.
+type globDir struct {
+	parent  *searchResultDir
+	pattern string
+}
+
+var (
+	_ fs.Node               = (*globDir)(nil)
+	_ fs.HandleReadDirAller = (*globDir)(nil)
+	_ fs.NodeStringLookuper = (*globDir)(nil)
+)
+
+func (d *globDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+// globMatches returns the parent's cached names matching d.pattern,
+// in no particular order. A malformed pattern simply matches nothing,
+// since path.Match's ErrBadPattern already makes every call's ok
+// false. It must be called with d.parent.mu held.
+func (d *globDir) globMatches() []string {
+	var matches []string
+	for name := range d.parent.ents {
+		if ok, _ := path.Match(d.pattern, name); ok {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+func (d *globDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	return dirents(d.globMatches(), fuse.DT_File), nil
+}
+
+func (d *globDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	matched, _ := path.Match(d.pattern, name)
+	_, exists := d.parent.ents[name]
+	d.parent.mu.Unlock()
+	if !matched || !exists {
+		return nil, fuse.ENOENT
+	}
+	return d.parent.Lookup(ctx, name)
+}
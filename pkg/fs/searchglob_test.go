@@ -0,0 +1,109 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"perkeep.org/pkg/search"
+)
+
+// TestHasGlobMeta checks the heuristic that tells a glob-filter
+// Lookup name from an ordinary filename.
+func TestHasGlobMeta(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"*.jpg", true},
+		{"IMG_*", true},
+		{"IMG_[0-9]*.jpg", true},
+		{"photo?.jpg", true},
+		{"photo.jpg", false},
+		{"vacation", false},
+	}
+	for _, tt := range tests {
+		if got := hasGlobMeta(tt.name); got != tt.want {
+			t.Errorf("hasGlobMeta(%q) = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestGlobMatches checks that globMatches filters the parent's cached
+// ents by path.Match against d.pattern, without needing a query.
+func TestGlobMatches(t *testing.T) {
+	parent := &searchResultDir{
+		fs: &CamliFileSystem{},
+		ents: map[string]*search.DescribedBlob{
+			"a.jpg":    {},
+			"b.jpg":    {},
+			"c.png":    {},
+			"IMG_0001": {},
+		},
+	}
+	d := &globDir{parent: parent, pattern: "*.jpg"}
+	got := d.globMatches()
+	sort.Strings(got)
+	if want := []string{"a.jpg", "b.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("globMatches() = %v; want %v", got, want)
+	}
+
+	d = &globDir{parent: parent, pattern: "IMG_*"}
+	got = d.globMatches()
+	if want := []string{"IMG_0001"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("globMatches() = %v; want %v", got, want)
+	}
+}
+
+// TestSearchResultDirLookupRoutesGlob checks that Lookup only sends a
+// glob-meta name to globDir when it isn't already one of
+// globSuffix/matchDirPrefix's reserved, server-narrowed spellings:
+// "*.jpg" (which neither of those can express) gets the client-side
+// glob directory, while "IMG_*" (a trailing "*") keeps going through
+// matchedDir exactly as it did before globDir existed.
+func TestSearchResultDirLookupRoutesGlob(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image"}
+
+	got, err := n.Lookup(context.Background(), "*.jpg")
+	if err != nil {
+		t.Fatalf(`Lookup("*.jpg") error = %v`, err)
+	}
+	gd, ok := got.(*globDir)
+	if !ok {
+		t.Fatalf(`Lookup("*.jpg") = %T; want *globDir`, got)
+	}
+	if gd.pattern != "*.jpg" {
+		t.Errorf("globDir.pattern = %q; want %q", gd.pattern, "*.jpg")
+	}
+
+	got, err = n.Lookup(context.Background(), "IMG_*")
+	if err != nil {
+		t.Fatalf(`Lookup("IMG_*") error = %v`, err)
+	}
+	sd, ok := got.(*searchResultDir)
+	if !ok {
+		t.Fatalf(`Lookup("IMG_*") = %T; want *searchResultDir`, got)
+	}
+	if want := `is:image "IMG_"`; sd.searchExp != want {
+		t.Errorf("matchedDir searchExp = %q; want %q", sd.searchExp, want)
+	}
+}
@@ -0,0 +1,98 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+)
+
+// ungroupedBucketName is groupBuckets' bucket for names whose
+// permanode has no GroupByAttribute at all, the same way
+// untaggedTagBucketName buckets byTagTreeDir's own outliers.
+const ungroupedBucketName = "_ungrouped"
+
+// groupBuckets groups n.ents by CamliFileSystem.GroupByAttribute's
+// value, collecting names with no such attribute (or an empty one)
+// under ungroupedBucketName. Unlike tagBuckets, a name lands in at
+// most one bucket: an attribute like "album" is expected to take a
+// single value per photo, not a set of them the way "tag" does. It
+// must be called with n.mu held.
+func (n *searchResultDir) groupBuckets() map[string][]string {
+	buckets := make(map[string][]string)
+	for name := range n.ents {
+		pm := n.pnodeMeta[name]
+		bucket := ungroupedBucketName
+		if pm != nil && pm.Permanode != nil {
+			if v := pm.Permanode.Attr.Get(n.fs.GroupByAttribute); v != "" {
+				bucket = v
+			}
+		}
+		buckets[bucket] = append(buckets[bucket], name)
+	}
+	return buckets
+}
+
+// listingDirents builds ReadDirAll's return value from names and refs
+// (n.lastNames and n.entryRefs(names) as of the most recent seed):
+// ordinarily that's just direntsForListing, but once
+// CamliFileSystem.GroupByAttribute is set, the listing itself becomes
+// one subdirectory per distinct attribute value (plus
+// ungroupedBucketName) instead of the flat, possibly
+// nested-and-sidecar'd entries those names would otherwise produce;
+// FilenameNesting, ExposeSidecars, and ShowDotfiles all stop applying,
+// the same way they already don't apply to byTagTreeDir's view.
+func (n *searchResultDir) listingDirents(names []string, refs map[string]blob.Ref, kinds map[string]fuse.DirentType) []fuse.Dirent {
+	if n.fs.GroupByAttribute == "" {
+		return n.direntsForListing(names, refs, kinds)
+	}
+	n.mu.Lock()
+	buckets := n.groupBuckets()
+	n.mu.Unlock()
+	bucketNames := make([]string, 0, len(buckets))
+	for bucket := range buckets {
+		bucketNames = append(bucketNames, bucket)
+	}
+	return dirents(bucketNames, fuse.DT_Dir)
+}
+
+// lookupGroupBucket resolves name against groupBuckets when
+// GroupByAttribute is set, returning ok=false (rather than ENOENT
+// outright) when it isn't one of the current bucket names, so Lookup
+// can fall back to resolving name as a plain entry instead: a
+// grouping mount still answers a direct-by-name Lookup the same way
+// it always did, only ReadDirAll's top-level listing changes shape.
+func (n *searchResultDir) lookupGroupBucket(ctx context.Context, name string) (fs.Node, bool, error) {
+	if n.fs.GroupByAttribute == "" {
+		return nil, false, nil
+	}
+	if err := n.ensureSeeded(ctx); err != nil {
+		return nil, true, err
+	}
+	n.mu.Lock()
+	members, ok := n.groupBuckets()[name]
+	n.mu.Unlock()
+	if !ok {
+		return nil, false, nil
+	}
+	return &bucketDir{parent: n, names: members}, true, nil
+}
@@ -0,0 +1,29 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// contentLinkCount is the Nlink a hardlinked searchResultFile reports
+// when HardlinkContent is set: one for the search result path itself,
+// one for its counterpart under a by-blobref content view sharing the
+// same inode. It's a constant rather than an actual count of however
+// many search results happen to share this content, since tracking
+// the real link count across every searchResultDir that might list the
+// same permanode isn't worth it just to report a number whose only
+// real use is "greater than one".
+const contentLinkCount = 2
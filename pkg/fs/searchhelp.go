@@ -0,0 +1,198 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// helpDirName is the reserved name of searchDir's predicate-reference
+// subdirectory (see helpDir). It's checked ahead of the plain
+// expression fallback in searchDir.Lookup, the same way "at" and
+// "content" are, so it's never mistaken for (or shadows) a search
+// expression literally named "help".
+const helpDirName = "help"
+
+// helpKeyword documents one predicate of the search expression
+// grammar, for helpDir to render as a readable file.
+type helpKeyword struct {
+	Name     string   // the predicate's keyword, without its trailing ":"
+	Summary  string   // one line, shown in README.txt's index
+	Examples []string // complete expressions demonstrating it
+}
+
+// helpKeywords is the predicate reference helpDir serves. It's a
+// plain literal rather than generated from the search package's own
+// parser tables, since pkg/search doesn't export a keyword registry;
+// keep it in sync with pkg/search/expr.go's grammar as predicates are
+// added or renamed.
+var helpKeywords = []helpKeyword{
+	{
+		Name:    "is",
+		Summary: `matches a fixed set of well-known predicates, e.g. "is:image", "is:pano", "is:landscape"`,
+		Examples: []string{
+			`is:image`,
+			`is:image and not is:pano`,
+		},
+	},
+	{
+		Name:    "after",
+		Summary: `matches permanodes modified on or after a date, absolute or relative to now`,
+		Examples: []string{
+			`after:"2015-10-01"`,
+			`after:-7d`,
+		},
+	},
+	{
+		Name:    "before",
+		Summary: `matches permanodes modified before a date, absolute or relative to now`,
+		Examples: []string{
+			`before:"2020-01-01"`,
+			`after:-1month and before:-1d`,
+		},
+	},
+	{
+		Name:    "tag",
+		Summary: `matches permanodes carrying a given "tag" attribute value`,
+		Examples: []string{
+			`tag:vacation`,
+		},
+	},
+	{
+		Name:    "attr",
+		Summary: `matches permanodes by an arbitrary attribute name and value`,
+		Examples: []string{
+			`attr:title:"Family Photo"`,
+		},
+	},
+	{
+		Name:    "format",
+		Summary: `matches files by their detected format/MIME type`,
+		Examples: []string{
+			`format:jpeg`,
+		},
+	},
+	{
+		Name:    "width",
+		Summary: `matches images by pixel width, optionally with a comparison (">", "<")`,
+		Examples: []string{
+			`width:>1024`,
+		},
+	},
+	{
+		Name:    "height",
+		Summary: `matches images by pixel height, optionally with a comparison (">", "<")`,
+		Examples: []string{
+			`height:<768`,
+		},
+	},
+	{
+		Name:    "loc",
+		Summary: `matches files with GPS location data near a place name or coordinate`,
+		Examples: []string{
+			`loc:"San Francisco"`,
+		},
+	},
+	{
+		Name:    "childrenof",
+		Summary: `matches direct children (e.g. set members) of a given permanode or path`,
+		Examples: []string{
+			`childrenof:sha224-abc...`,
+		},
+	},
+}
+
+// helpDir implements searchDir's "help" subdirectory: a predicate
+// reference, one readable file per helpKeywords entry plus a
+// README.txt index, so a new user can discover the expression
+// grammar without leaving the mount.
+type helpDir struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node               = (*helpDir)(nil)
+	_ fs.HandleReadDirAller = (*helpDir)(nil)
+	_ fs.NodeStringLookuper = (*helpDir)(nil)
+)
+
+func (n *helpDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+// helpKeywordFileName is how a helpKeywords entry's Name is named as
+// a file under helpDir, e.g. "is" becomes "is.txt".
+func helpKeywordFileName(name string) string {
+	return name + ".txt"
+}
+
+func (n *helpDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	ents := []fuse.Dirent{{Name: "README.txt"}}
+	for _, kw := range helpKeywords {
+		ents = append(ents, fuse.Dirent{Name: helpKeywordFileName(kw.Name)})
+	}
+	return ents, nil
+}
+
+// helpIndex renders README.txt's index: every known keyword with its
+// one-line summary, pointing at its own file for the full detail and
+// examples.
+func helpIndex() string {
+	var b strings.Builder
+	b.WriteString("This directory documents the search expression grammar usable\n")
+	b.WriteString("under mount/search/<expr> (see ../README.txt).\n\n")
+	for _, kw := range helpKeywords {
+		fmt.Fprintf(&b, "%-12s %s\n", kw.Name+":", kw.Summary)
+	}
+	b.WriteString("\nSee <keyword>.txt for each predicate's full documentation and examples.\n")
+	return b.String()
+}
+
+// helpKeywordDoc renders kw's own file: its summary followed by every
+// example expression, one per line.
+func helpKeywordDoc(kw helpKeyword) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n\nExamples:\n", kw.Name, kw.Summary)
+	for _, ex := range kw.Examples {
+		fmt.Fprintf(&b, "\tcd %q\n", ex)
+	}
+	return b.String()
+}
+
+func (n *helpDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == "README.txt" {
+		return staticFileNode(helpIndex()), nil
+	}
+	for _, kw := range helpKeywords {
+		if helpKeywordFileName(kw.Name) == name {
+			return staticFileNode(helpKeywordDoc(kw)), nil
+		}
+	}
+	return nil, fuse.ENOENT
+}
@@ -0,0 +1,39 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestHelpKeywordsUnique is a regression test for helpDir.Lookup's
+// file-name matching: two helpKeywords entries resolving to the same
+// helpKeywordFileName would make one permanently unreachable, since
+// Lookup returns the first match.
+func TestHelpKeywordsUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, kw := range helpKeywords {
+		name := helpKeywordFileName(kw.Name)
+		if seen[name] {
+			t.Errorf("helpKeywords has more than one entry naming %q", name)
+		}
+		seen[name] = true
+		if len(kw.Examples) == 0 {
+			t.Errorf("helpKeywords[%q] has no Examples", kw.Name)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "strings"
+
+// visibleNames filters names (a snapshot of n.lastNames) down to the
+// ones ReadDirAll should actually list: every name, unless
+// CamliFileSystem.ShowHidden is unset, in which case a dot-prefixed
+// one is dropped (but remains reachable via Lookup, since this only
+// affects what listingDirents is handed).
+func (n *searchResultDir) visibleNames(names []string) []string {
+	if n.fs.ShowHidden {
+		return names
+	}
+	var out []string
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		out = append(out, name)
+	}
+	return out
+}
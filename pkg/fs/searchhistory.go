@@ -0,0 +1,147 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+)
+
+// historySuffix names the per-entry directory exposing the claim
+// history of an entry's permanode: "foo.jpg.history/" lists one file
+// per claim (set-attribute, del-attribute, ...) affecting foo.jpg's
+// permanode, oldest first, for auditing how it got to its current
+// state. Unlike sidecarSuffix's cheap, cache-backed read, listing it
+// costs its own round trip to the server (a claims query), which is
+// why it's gated behind CamliFileSystem.ExposeHistory rather than
+// always resolvable the way the sidecar is.
+const historySuffix = ".history"
+
+// direntsWithHistory is direntsWithWebURLs, plus one
+// "<name>.history" directory per name in names when
+// n.fs.ExposeHistory is set.
+func (n *searchResultDir) direntsWithHistory(names []string, refs map[string]blob.Ref, kinds map[string]fuse.DirentType) []fuse.Dirent {
+	ents := n.direntsWithDescribeJSON(names, refs, kinds)
+	if n.fs.ExposeHistory {
+		for _, name := range names {
+			ents = append(ents, fuse.Dirent{Name: name + historySuffix, Type: fuse.DT_Dir})
+		}
+	}
+	return ents
+}
+
+// historyBase strips historySuffix from name, returning ok=false if
+// name doesn't carry it or is exactly the suffix with no base entry
+// name in front of it.
+func historyBase(name string) (base string, ok bool) {
+	base = strings.TrimSuffix(name, historySuffix)
+	return base, base != name && base != ""
+}
+
+// claimHistoryDir lists one file per claim affecting permanode,
+// named by its chronological position so that two claims of the same
+// type at different times don't collide on name.
+type claimHistoryDir struct {
+	fs        *CamliFileSystem
+	permanode blob.Ref
+
+	mu       sync.Mutex
+	resolved map[string][]byte // filename to the claim's marshaled JSON, filled in lazily by resolve
+	names    []string          // in chronological order, alongside resolved
+}
+
+var (
+	_ fs.Node               = (*claimHistoryDir)(nil)
+	_ fs.HandleReadDirAller = (*claimHistoryDir)(nil)
+	_ fs.NodeStringLookuper = (*claimHistoryDir)(nil)
+)
+
+func (n *claimHistoryDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+// resolve fetches n.permanode's claims and renders each to JSON,
+// caching the result so repeated reads of this directory only pay its
+// round trip once.
+func (n *claimHistoryDir) resolve(ctx context.Context) (map[string][]byte, []string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.resolved != nil {
+		return n.resolved, n.names, nil
+	}
+	claims, err := n.fs.client.GetClaims(ctx, n.permanode)
+	if err != nil {
+		Logger.Printf("fs.claimHistoryDir: fetching claims for %v: %v", n.permanode, err)
+		return nil, nil, fuse.EIO
+	}
+	sort.Slice(claims.Claims, func(i, j int) bool {
+		return claims.Claims[i].Date.Before(claims.Claims[j].Date)
+	})
+	resolved := make(map[string][]byte, len(claims.Claims))
+	names := make([]string, 0, len(claims.Claims))
+	for i, c := range claims.Claims {
+		b, err := json.MarshalIndent(c, "", "\t")
+		if err != nil {
+			Logger.Printf("fs.claimHistoryDir: marshaling claim %v: %v", c.BlobRef, err)
+			continue
+		}
+		name := fmt.Sprintf("%04d-%s.json", i, c.Type)
+		resolved[name] = append(b, '\n')
+		names = append(names, name)
+	}
+	n.resolved, n.names = resolved, names
+	return resolved, names, nil
+}
+
+func (n *claimHistoryDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	_, names, err := n.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ents := make([]fuse.Dirent, 0, len(names))
+	for _, name := range names {
+		ents = append(ents, fuse.Dirent{Name: name})
+	}
+	return ents, nil
+}
+
+func (n *claimHistoryDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	resolved, _, err := n.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := resolved[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return staticFileNode(string(b)), nil
+}
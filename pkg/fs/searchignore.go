@@ -0,0 +1,77 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "sync"
+
+// defaultIgnoredLookupNames are the names searchDir.Lookup rejects
+// with fuse.ENOENT before ever constructing a searchResultDir or
+// running a query for them, since they're never going to be a
+// meaningful search expression: they're what a file manager, desktop
+// shell, or editor probes for unprompted the moment a directory is
+// opened, not something a user typed.
+var defaultIgnoredLookupNames = []string{
+	".hidden",
+	".DS_Store",
+	"._.DS_Store",
+	"desktop.ini",
+	"Desktop.ini",
+	"Thumbs.db",
+	"ehthumbs.db",
+	"autorun.inf",
+	".directory",
+	".Trash",
+	".Trash-1000",
+	".localized",
+}
+
+// ignoredLookupNameSets caches each CamliFileSystem's combined
+// ignored-name set, keyed by pointer identity the same way
+// searchbreaker.go's breakers registry is.
+var (
+	ignoredLookupNameSetsMu sync.Mutex
+	ignoredLookupNameSets   = map[*CamliFileSystem]map[string]bool{}
+)
+
+// ignoredLookupNameSet returns fsys's combined ignored-name set:
+// defaultIgnoredLookupNames plus fsys.IgnoredLookupNames, built once
+// per fsys.
+func ignoredLookupNameSet(fsys *CamliFileSystem) map[string]bool {
+	ignoredLookupNameSetsMu.Lock()
+	defer ignoredLookupNameSetsMu.Unlock()
+	if set, ok := ignoredLookupNameSets[fsys]; ok {
+		return set
+	}
+	set := make(map[string]bool, len(defaultIgnoredLookupNames)+len(fsys.IgnoredLookupNames))
+	for _, name := range defaultIgnoredLookupNames {
+		set[name] = true
+	}
+	for _, name := range fsys.IgnoredLookupNames {
+		set[name] = true
+	}
+	ignoredLookupNameSets[fsys] = set
+	return set
+}
+
+// isIgnoredLookupName reports whether name is one searchDir.Lookup
+// should reject with fuse.ENOENT immediately, without constructing a
+// searchResultDir or running a query; see IgnoredLookupNames.
+func isIgnoredLookupName(fsys *CamliFileSystem, name string) bool {
+	return ignoredLookupNameSet(fsys)[name]
+}
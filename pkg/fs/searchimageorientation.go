@@ -0,0 +1,60 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "perkeep.org/pkg/search"
+
+// OrientationReporter is an optional capability a *search.ImageInfo
+// may implement, reporting its EXIF orientation tag (values 1-8, per
+// the EXIF spec) so orientedDimensions can tell whether
+// camliContentImage's raw pixel dimensions need swapping to match how
+// the image actually displays. An ImageInfo that doesn't implement it
+// (or whose Orientation reports ok=false) has no known orientation,
+// and orientedDimensions falls back to the raw dimensions unchanged,
+// the same as it always did before orientation was accounted for.
+type OrientationReporter interface {
+	Orientation() (value int, ok bool)
+}
+
+// orientedDimensions returns img's raw width/height alongside the
+// same two values, swapped whenever img's EXIF orientation (per
+// OrientationReporter) rotates the image 90 or 270 degrees before
+// display (orientation values 5 through 8); values 1 through 4 only
+// flip or rotate 180 degrees, which doesn't change which dimension is
+// width versus height. rawW/H and orientedW/H come back equal, and
+// zero if img is nil, whenever no orientation is known.
+func orientedDimensions(img *search.ImageInfo) (rawW, rawH, orientedW, orientedH int) {
+	if img == nil {
+		return 0, 0, 0, 0
+	}
+	rawW, rawH = int(img.Width), int(img.Height)
+	orientedW, orientedH = rawW, rawH
+	or, ok := (interface{})(img).(OrientationReporter)
+	if !ok {
+		return
+	}
+	val, has := or.Orientation()
+	if !has {
+		return
+	}
+	if val >= 5 && val <= 8 {
+		orientedW, orientedH = rawH, rawW
+	}
+	return
+}
@@ -0,0 +1,133 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// commitPartialReaddir publishes a page's worth of newly-resolved
+// entries to n's fields, under n.mu, so a concurrent Lookup or
+// ReadDirAll sees them immediately rather than waiting for doReaddir's
+// final commit. It's called from inside doReaddir's paging loop, once
+// per finished page, only when CamliFileSystem.IncrementalReaddir is
+// set; doReaddir's own final commit afterward still runs unconditionally
+// and is what actually marks the listing complete (see lastReaddir).
+//
+// Every map argument is doReaddir's own in-progress accumulator,
+// mutated further on the next page; commitPartialReaddir copies each
+// one into a fresh map before publishing it, so a Lookup holding n.mu
+// never reads a map doReaddir is concurrently writing to outside any
+// lock.
+func (n *searchResultDir) commitPartialReaddir(
+	ents map[string]*search.DescribedBlob,
+	permanode map[string]blob.Ref,
+	pnodeMeta map[string]*search.DescribedBlob,
+	imageMeta map[string]*search.DescribedBlob,
+	sets map[string]dir.Entry,
+	symlinks map[string]string,
+	contentless map[string]bool,
+	placeholders map[string]bool,
+	deleted map[string]bool,
+	camliPaths map[string]dir.Entry,
+	extractedText map[string]string,
+	collisionSubdirs map[string]collisionSubdirEntry,
+	originalNames map[string]string,
+	modTime map[string]time.Time,
+	lastNames []string,
+) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.ents = copyDescribedBlobMap(ents)
+	n.permanode = copyBlobRefMap(permanode)
+	n.pnodeMeta = copyDescribedBlobMap(pnodeMeta)
+	n.imageMeta = copyDescribedBlobMap(imageMeta)
+	n.sets = copyDirEntryMap(sets)
+	n.symlinks = copyStringMap(symlinks)
+	n.contentless = copyBoolMap(contentless)
+	n.placeholders = copyBoolMap(placeholders)
+	n.deleted = copyBoolMap(deleted)
+	n.camliPaths = copyDirEntryMap(camliPaths)
+	n.extractedText = copyStringMap(extractedText)
+	n.collisionSubdirs = copyCollisionSubdirMap(collisionSubdirs)
+	n.originalNames = copyStringMap(originalNames)
+	n.modTime = copyTimeMap(modTime)
+	n.lastNames = append([]string(nil), lastNames...)
+	n.negLookup = nil
+}
+
+func copyDescribedBlobMap(m map[string]*search.DescribedBlob) map[string]*search.DescribedBlob {
+	out := make(map[string]*search.DescribedBlob, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func copyBlobRefMap(m map[string]blob.Ref) map[string]blob.Ref {
+	out := make(map[string]blob.Ref, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func copyDirEntryMap(m map[string]dir.Entry) map[string]dir.Entry {
+	out := make(map[string]dir.Entry, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func copyBoolMap(m map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func copyTimeMap(m map[string]time.Time) map[string]time.Time {
+	out := make(map[string]time.Time, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func copyCollisionSubdirMap(m map[string]collisionSubdirEntry) map[string]collisionSubdirEntry {
+	out := make(map[string]collisionSubdirEntry, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// TestCommitPartialReaddirMakesEarlierEntriesLookupableFirst simulates
+// doReaddir's own paging loop calling commitPartialReaddir once per
+// page, against accumulator maps that grow the same way doReaddir's
+// do (each page's own entries added to the last), and checks that the
+// first page's entry is already Lookup-able (via n.ents, the same map
+// Lookup consults) as soon as that page commits, before the second
+// page has been processed at all -- without n.lastReaddir, the cache's
+// own "this listing is complete" marker, ever being set by either
+// partial commit.
+func TestCommitPartialReaddirMakesEarlierEntriesLookupableFirst(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{IncrementalReaddir: true}}
+
+	pn1 := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	pn2 := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+
+	ents := map[string]*search.DescribedBlob{}
+	permanode := map[string]blob.Ref{}
+	pnodeMeta := map[string]*search.DescribedBlob{}
+	imageMeta := map[string]*search.DescribedBlob{}
+	modTime := map[string]time.Time{}
+	var lastNames []string
+
+	// Page one.
+	ents["first.jpg"] = &search.DescribedBlob{BlobRef: pn1}
+	permanode["first.jpg"] = pn1
+	modTime["first.jpg"] = time.Now()
+	lastNames = append(lastNames, "first.jpg")
+	n.commitPartialReaddir(ents, permanode, pnodeMeta, imageMeta,
+		map[string]dir.Entry{}, map[string]string{}, map[string]bool{}, map[string]bool{}, map[string]bool{},
+		map[string]dir.Entry{}, map[string]string{}, map[string]collisionSubdirEntry{}, map[string]string{},
+		modTime, lastNames)
+
+	n.mu.Lock()
+	_, firstVisible := n.ents["first.jpg"]
+	_, secondVisibleTooEarly := n.ents["second.jpg"]
+	stillIncomplete := n.lastReaddir.IsZero()
+	n.mu.Unlock()
+	if !firstVisible {
+		t.Fatalf("after page one's commit, n.ents is missing %q", "first.jpg")
+	}
+	if secondVisibleTooEarly {
+		t.Fatalf("n.ents already has %q before its page was ever committed", "second.jpg")
+	}
+	if !stillIncomplete {
+		t.Fatalf("n.lastReaddir was set by a partial commit; it must stay zero until doReaddir's final commit")
+	}
+
+	if err := n.ensureSeeded(context.Background()); err != nil {
+		t.Fatalf("ensureSeeded() after a partial commit = %v; want nil, since n.ents is already non-nil", err)
+	}
+
+	// Page two, accumulating on top of page one the way doReaddir's
+	// own local maps do across iterations of its paging loop.
+	ents["second.jpg"] = &search.DescribedBlob{BlobRef: pn2}
+	permanode["second.jpg"] = pn2
+	modTime["second.jpg"] = time.Now()
+	lastNames = append(lastNames, "second.jpg")
+	n.commitPartialReaddir(ents, permanode, pnodeMeta, imageMeta,
+		map[string]dir.Entry{}, map[string]string{}, map[string]bool{}, map[string]bool{}, map[string]bool{},
+		map[string]dir.Entry{}, map[string]string{}, map[string]collisionSubdirEntry{}, map[string]string{},
+		modTime, lastNames)
+
+	n.mu.Lock()
+	_, firstStillVisible := n.ents["first.jpg"]
+	_, secondVisible := n.ents["second.jpg"]
+	n.mu.Unlock()
+	if !firstStillVisible {
+		t.Errorf("page one's entry %q disappeared after page two's commit", "first.jpg")
+	}
+	if !secondVisible {
+		t.Errorf("after page two's commit, n.ents is still missing %q", "second.jpg")
+	}
+}
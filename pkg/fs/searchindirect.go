@@ -0,0 +1,49 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// defaultContentIndirectionHops is the number of additional
+// camliContent hops a searchResultDir follows when its own
+// ContentIndirectionHops is left unset: enough to resolve a permanode
+// whose camliContent points at another permanode rather than a file
+// or directory directly, without chasing an unbounded chain of
+// indirection.
+const defaultContentIndirectionHops = 1
+
+// maxContentIndirectionHops is the hard ceiling
+// effectiveContentIndirectionHops clamps ContentIndirectionHops to,
+// regardless of how high it's configured: dir.followContentIndirection
+// already refuses to revisit a blobref it's seen earlier in the same
+// chain, but a long, non-cyclic chain of distinct re-sharing
+// permanodes would otherwise still cost one describe round trip per
+// hop for every affected entry in a page.
+const maxContentIndirectionHops = 32
+
+// effectiveContentIndirectionHops reports the indirection hop budget
+// fs actually applies to its searchResultDirs.
+func (fs *CamliFileSystem) effectiveContentIndirectionHops() int {
+	hops := defaultContentIndirectionHops
+	if fs.ContentIndirectionHops > 0 {
+		hops = fs.ContentIndirectionHops
+	}
+	if hops > maxContentIndirectionHops {
+		hops = maxContentIndirectionHops
+	}
+	return hops
+}
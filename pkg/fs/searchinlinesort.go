@@ -0,0 +1,88 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// inlineSortPrefix is the "sort:" token parseInlineSort recognizes
+// anywhere inside a search expression itself, e.g.
+// "is:image sort:-modtime", as a standing alternative to cd-ing into a
+// sortDirPrefix pseudo-directory (see sortDirPrefix) every time a
+// listing should come back in a particular order: the directory name
+// itself carries it, with no extra "cd" needed. Unlike sortDirPrefix,
+// the token is parsed out of the expression before it's ever sent to
+// the server (see searchResultDir.effectiveSearchExpr), not handled by
+// building a derived child searchResultDir.
+const inlineSortPrefix = "sort:"
+
+// inlineSortKeys maps an inlineSortPrefix token's key, once any
+// leading "-" has been trimmed (see parseInlineSort), to the
+// SearchSortBy it requests in ascending (or direction-agnostic) form.
+// "created" is the search API's own name for what pkg/fs elsewhere
+// calls "modtime" (see serverSortFor's search.CreatedAsc/Desc), so
+// both spellings resolve to the same SearchSortBy.
+var inlineSortKeys = map[string]SearchSortBy{
+	"modtime": SearchSortByModTimeAsc,
+	"created": SearchSortByModTimeAsc,
+	"name":    SearchSortByName,
+	"size":    SearchSortBySizeAsc,
+}
+
+// inlineSortKeysDesc is inlineSortKeys' counterpart for a
+// "-"-prefixed key, e.g. "sort:-size".
+var inlineSortKeysDesc = map[string]SearchSortBy{
+	"modtime": SearchSortByModTimeDesc,
+	"created": SearchSortByModTimeDesc,
+	"name":    SearchSortByNameDesc,
+	"size":    SearchSortBySizeDesc,
+}
+
+// parseInlineSort scans expr for a whitespace-delimited inlineSortPrefix
+// token and reports the SearchSortBy it requests, with that token
+// removed from trimmed. found is true as soon as a "sort:" token is
+// seen at all, even one whose key doesn't parse, so a caller can tell
+// "no directive" (found=false) apart from "a bad one" (found=true,
+// err set) rather than treating both as "fall back to the default".
+// Only the first "sort:" token found is honored; any later one is left
+// in trimmed untouched, the same way the search expression language
+// doesn't complain about a repeated predicate.
+func parseInlineSort(expr string) (trimmed string, sortBy SearchSortBy, found bool, err error) {
+	fields := strings.Fields(expr)
+	for i, f := range fields {
+		if !strings.HasPrefix(f, inlineSortPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(f, inlineSortPrefix)
+		keys := inlineSortKeys
+		if desc := strings.HasPrefix(key, "-"); desc {
+			key = strings.TrimPrefix(key, "-")
+			keys = inlineSortKeysDesc
+		}
+		by, ok := keys[key]
+		if !ok {
+			return "", SearchSortByDefault, true, fmt.Errorf("unrecognized sort key %q", f)
+		}
+		rest := append(append([]string{}, fields[:i]...), fields[i+1:]...)
+		return strings.Join(rest, " "), by, true, nil
+	}
+	return expr, SearchSortByDefault, false, nil
+}
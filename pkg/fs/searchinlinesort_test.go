@@ -0,0 +1,138 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+
+	"perkeep.org/pkg/search"
+)
+
+// TestParseInlineSortKeys checks every supported inlineSortPrefix key,
+// in both its ascending and (where supported) descending spelling,
+// parses to the right SearchSortBy and is stripped from the
+// expression handed back.
+func TestParseInlineSortKeys(t *testing.T) {
+	cases := []struct {
+		expr    string
+		trimmed string
+		want    SearchSortBy
+	}{
+		{"is:image sort:modtime", "is:image", SearchSortByModTimeAsc},
+		{"is:image sort:-modtime", "is:image", SearchSortByModTimeDesc},
+		{"is:image sort:created", "is:image", SearchSortByModTimeAsc},
+		{"is:image sort:-created", "is:image", SearchSortByModTimeDesc},
+		{"is:image sort:name", "is:image", SearchSortByName},
+		{"is:image sort:-name", "is:image", SearchSortByNameDesc},
+		{"is:image sort:size", "is:image", SearchSortBySizeAsc},
+		{"is:image sort:-size", "is:image", SearchSortBySizeDesc},
+		{"sort:size is:image", "is:image", SearchSortBySizeAsc},
+	}
+	for _, c := range cases {
+		trimmed, sortBy, found, err := parseInlineSort(c.expr)
+		if err != nil {
+			t.Errorf("parseInlineSort(%q) error = %v", c.expr, err)
+			continue
+		}
+		if !found {
+			t.Errorf("parseInlineSort(%q) found = false; want true", c.expr)
+			continue
+		}
+		if sortBy != c.want {
+			t.Errorf("parseInlineSort(%q) sortBy = %v; want %v", c.expr, sortBy, c.want)
+		}
+		if trimmed != c.trimmed {
+			t.Errorf("parseInlineSort(%q) trimmed = %q; want %q", c.expr, trimmed, c.trimmed)
+		}
+	}
+}
+
+// TestParseInlineSortNoToken checks that an expression with no
+// "sort:" token at all reports found=false and returns expr
+// unchanged, rather than treating "no directive" as an error or as
+// SearchSortByDefault's worth of a real directive.
+func TestParseInlineSortNoToken(t *testing.T) {
+	trimmed, _, found, err := parseInlineSort("is:image tag:vacation")
+	if err != nil || found {
+		t.Fatalf("parseInlineSort(no token) = %q, found=%v, err=%v; want found=false, err=nil", trimmed, found, err)
+	}
+	if trimmed != "is:image tag:vacation" {
+		t.Errorf("parseInlineSort(no token) trimmed = %q; want expr unchanged", trimmed)
+	}
+}
+
+// TestParseInlineSortUnrecognizedKey checks that an unrecognized
+// sort key is reported as an error with found=true, the combination
+// doReaddir relies on to fail the read with fuse.EINVAL rather than
+// silently falling back to the mount's default order.
+func TestParseInlineSortUnrecognizedKey(t *testing.T) {
+	_, _, found, err := parseInlineSort("is:image sort:bogus")
+	if !found {
+		t.Fatalf("parseInlineSort(bad key) found = false; want true")
+	}
+	if err == nil {
+		t.Fatalf("parseInlineSort(bad key) error = nil; want non-nil")
+	}
+}
+
+// TestEffectiveSearchExprStripsInlineSort checks that
+// effectiveSearchExpr never sends a "sort:" token to the server as if
+// it were a literal search term.
+func TestEffectiveSearchExprStripsInlineSort(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image sort:-modtime"}
+	if got := n.effectiveSearchExpr(); got != "is:image" {
+		t.Errorf("effectiveSearchExpr() = %q; want %q", got, "is:image")
+	}
+}
+
+// TestEffectiveSortByPrefersSortOverrideOverInline checks that an
+// explicit sortDirPrefix override (n.sortOverride) still wins over an
+// inline "sort:" token in the same directory's searchExp, the same
+// precedence sortedDir's doc comment already promises relative to
+// CamliFileSystem.SearchSortBy.
+func TestEffectiveSortByPrefersSortOverrideOverInline(t *testing.T) {
+	override := SearchSortByName
+	n := &searchResultDir{
+		fs:           &CamliFileSystem{},
+		searchExp:    "is:image sort:-modtime",
+		sortOverride: &override,
+	}
+	if got := n.effectiveSortBy(); got != SearchSortByName {
+		t.Errorf("effectiveSortBy() = %v; want sortOverride's %v", got, SearchSortByName)
+	}
+}
+
+// TestSortLastNamesSizeAscSmallestFirst checks that SearchSortBySizeAsc
+// orders entries smallest-first and sorts an entry with no known size
+// (no n.ents entry, or one with a nil File) last.
+func TestSortLastNamesSizeAscSmallestFirst(t *testing.T) {
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{SearchSortBy: SearchSortBySizeAsc},
+		lastNames: []string{"big", "unknown", "small"},
+		ents: map[string]*search.DescribedBlob{
+			"big":   {File: &search.DescribedFile{Size: 9000}},
+			"small": {File: &search.DescribedFile{Size: 10}},
+		},
+	}
+	n.sortLastNames()
+	want := []string{"small", "big", "unknown"}
+	if !namesEqual(n.lastNames, want) {
+		t.Errorf("sortLastNames() with SearchSortBySizeAsc = %v; want %v", n.lastNames, want)
+	}
+}
@@ -0,0 +1,91 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+)
+
+// searchResultFingerprint is what invalidateDiff compares between an
+// old and new doReaddir pass to tell a genuinely changed entry from
+// one that only moved within n.lastNames, e.g. because of a resort.
+type searchResultFingerprint struct {
+	blobref blob.Ref
+	modTime time.Time
+}
+
+// buildSearchResultFingerprints returns one searchResultFingerprint
+// per name in names, from the given permanode/modTime maps. It's
+// called once against n's old fields right before doReaddir
+// overwrites them, and once more against the freshly seeded fields
+// afterward, so invalidateDiff has a before/after pair to compare.
+func buildSearchResultFingerprints(names []string, permanode map[string]blob.Ref, modTime map[string]time.Time) map[string]searchResultFingerprint {
+	fp := make(map[string]searchResultFingerprint, len(names))
+	for _, name := range names {
+		fp[name] = searchResultFingerprint{
+			blobref: permanode[name],
+			modTime: modTime[name],
+		}
+	}
+	return fp
+}
+
+// invalidateDiff tells n.fs.Server to drop its kernel cache only for
+// the names that were added, removed, or changed between oldNames/
+// oldFP and newNames/newFP, leaving an unchanged name's cached
+// attributes and inode alone. This keeps a refresh that alters only a
+// handful of entries in a large directory from forcing the kernel to
+// re-stat everything else in it.
+//
+// A name reassigned between two different underlying blobs because of
+// a collision (see n.stableName) is indistinguishable here from a
+// plain remove-then-add, which is the correct way to invalidate it:
+// its old meaning is gone and its new one hasn't been seen before.
+func (n *searchResultDir) invalidateDiff(oldNames []string, oldFP map[string]searchResultFingerprint, newNames []string, newFP map[string]searchResultFingerprint) {
+	if n.fs.Server == nil {
+		return
+	}
+	old := make(map[string]bool, len(oldNames))
+	for _, name := range oldNames {
+		old[name] = true
+	}
+	cur := make(map[string]bool, len(newNames))
+	for _, name := range newNames {
+		cur[name] = true
+	}
+	changed := make(map[string]bool)
+	for name := range old {
+		if !cur[name] || oldFP[name] != newFP[name] {
+			changed[name] = true
+		}
+	}
+	for name := range cur {
+		if !old[name] {
+			changed[name] = true
+		}
+	}
+	for name := range changed {
+		if err := n.fs.Server.InvalidateEntry(n, name); err != nil && err != fuse.ErrNotCached {
+			Logger.Printf("fs.search: invalidate entry %q of %q: %v", name, n.searchExp, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// resultsJSONName is a hidden, per-searchResultDir file exposing the
+// directory's current listing as structured JSON, for scripts that
+// want the cached entry metadata without re-running the search
+// themselves. Like queryFileName, it's always resolvable via Lookup;
+// see CamliFileSystem.ShowDotfiles for whether it's also listed in
+// ReadDirAll.
+const resultsJSONName = ".results.json"
+
+// resultsJSONEntry is one element of resultsJSONContents' array.
+type resultsJSONEntry struct {
+	Name           string    `json:"name"`
+	BlobRef        string    `json:"blobRef,omitempty"`        // permanode
+	ContentBlobRef string    `json:"contentBlobRef,omitempty"` // camliContent target
+	MIMEType       string    `json:"mimeType,omitempty"`
+	Size           int64     `json:"size,omitempty"`
+	ModTime        time.Time `json:"modTime"`
+}
+
+// resultsJSONEntries builds resultsJSONContents' entries: one per name
+// in n.lastNames that still has a content blob in n.ents (markers like
+// truncatedMarkerName and non-file entries like sets or symlinks are
+// skipped, since there's no file metadata to report for them). It's a
+// lazy snapshot of whatever ReadDirAll last cached, not a fresh query,
+// so repeated reads between refreshes return the same thing. It must
+// be called with n.mu held, since it reads n.ents, n.permanode, and
+// n.modTime. manifestContents reuses it to embed the same entries in
+// ".manifest.json" without a second describe pass.
+func (n *searchResultDir) resultsJSONEntries() []resultsJSONEntry {
+	entries := make([]resultsJSONEntry, 0, len(n.lastNames))
+	for _, name := range n.lastNames {
+		db, ok := n.ents[name]
+		if !ok {
+			continue
+		}
+		e := resultsJSONEntry{
+			Name:    name,
+			ModTime: n.modTime[name],
+		}
+		if pn := n.permanode[name]; pn.Valid() {
+			e.BlobRef = pn.String()
+		}
+		if db.BlobRef.Valid() {
+			e.ContentBlobRef = db.BlobRef.String()
+		}
+		if db.File != nil {
+			e.MIMEType = db.File.MIMEType
+			e.Size = db.File.Size
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// resultsJSONContents renders resultsJSONName's content from
+// resultsJSONEntries. It must be called with n.mu held, for the same
+// reason resultsJSONEntries must.
+func (n *searchResultDir) resultsJSONContents() ([]byte, error) {
+	return json.MarshalIndent(n.resultsJSONEntries(), "", "\t")
+}
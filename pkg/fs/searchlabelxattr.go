@@ -0,0 +1,42 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "perkeep.org/pkg/search"
+
+// labelXattr reports the "LabelXattrName: value" pair camliXattrs
+// should add for pnodeMeta, translated through fsys.LabelValueMap if
+// set, or ok=false if fsys.LabelAttr/LabelXattrName aren't both
+// configured, or pnodeMeta's permanode has no value for LabelAttr.
+func labelXattr(fsys *CamliFileSystem, pnodeMeta *search.DescribedBlob) (name, value string, ok bool) {
+	if fsys.LabelAttr == "" || fsys.LabelXattrName == "" {
+		return "", "", false
+	}
+	if pnodeMeta == nil || pnodeMeta.Permanode == nil {
+		return "", "", false
+	}
+	v := pnodeMeta.Permanode.Attr.Get(fsys.LabelAttr)
+	if v == "" {
+		return "", "", false
+	}
+	if translated, ok := fsys.LabelValueMap[v]; ok {
+		v = translated
+	}
+	return fsys.LabelXattrName, v, true
+}
@@ -0,0 +1,34 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// defaultLargeListingWarnThreshold is effectiveLargeListingWarnThreshold's
+// fallback when CamliFileSystem.LargeListingWarnThreshold isn't set,
+// comfortably below maxSearchResultEntries so a mount that never
+// configured it still gets a heads-up before hitting that hard cap.
+const defaultLargeListingWarnThreshold = 20000
+
+// effectiveLargeListingWarnThreshold returns fs.LargeListingWarnThreshold,
+// or defaultLargeListingWarnThreshold if that's unset (zero).
+func (fs *CamliFileSystem) effectiveLargeListingWarnThreshold() int {
+	if fs.LargeListingWarnThreshold > 0 {
+		return fs.LargeListingWarnThreshold
+	}
+	return defaultLargeListingWarnThreshold
+}
@@ -0,0 +1,73 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestEffectiveLargeListingWarnThreshold checks the usual
+// configured-value-wins-over-default pattern shared by every other
+// effectiveX accessor in this package.
+func TestEffectiveLargeListingWarnThreshold(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	if got := fsys.effectiveLargeListingWarnThreshold(); got != defaultLargeListingWarnThreshold {
+		t.Errorf("effectiveLargeListingWarnThreshold() with unset field = %d; want default %d", got, defaultLargeListingWarnThreshold)
+	}
+
+	fsys.LargeListingWarnThreshold = 5
+	if got := fsys.effectiveLargeListingWarnThreshold(); got != 5 {
+		t.Errorf("effectiveLargeListingWarnThreshold() with field set to 5 = %d; want 5", got)
+	}
+}
+
+// TestDirentsCompletenessAtLargeListingScale is a regression test for
+// the premise behind LargeListingWarnThreshold: dirents must return
+// every one of a very large synthetic name set, since it's what
+// ReadDirAll ultimately hands to fs.HandleReadDirAller, which is
+// itself trusted (not re-verified here) to page an arbitrarily large
+// slice across as many kernel readdir replies as needed without
+// dropping any.
+func TestDirentsCompletenessAtLargeListingScale(t *testing.T) {
+	const n = defaultLargeListingWarnThreshold * 2
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("entry-%d", i)
+	}
+
+	got := dirents(names, fuse.DT_File)
+	if len(got) != n {
+		t.Fatalf("dirents returned %d entries; want %d", len(got), n)
+	}
+	seen := make(map[string]bool, n)
+	for _, ent := range got {
+		if ent.Type != fuse.DT_File {
+			t.Errorf("entry %q has Type %v; want fuse.DT_File", ent.Name, ent.Type)
+		}
+		seen[ent.Name] = true
+	}
+	for _, name := range names {
+		if !seen[name] {
+			t.Errorf("dirents dropped %q from a %d-entry listing", name, n)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// lazyBatchWait is one joined member's slot in a lazyBatchCoordinator
+// group: the caller that adds it owns wg and waits on it, the flush
+// that eventually runs the shared describe fills in entry/ok/err and
+// calls wg.Done, exactly like targetedCall does for lookupTargetedOnce.
+type lazyBatchWait struct {
+	wg    sync.WaitGroup
+	entry dir.Entry
+	ok    bool
+	err   error
+}
+
+// lazyBatchCoordinator accumulates the permanodes a searchResultDir's
+// concurrent resolveLazyEntry calls are each waiting to have resolved,
+// and resolves them together in one dir.ResolveMembers call once the
+// group is flushed, either by its timer or by a join that fills it
+// past LookupBatchSize. Its mu is its own, separate from
+// searchResultDir.mu, so a flush's describe call (and the n.mu-unlock
+// window around it resolveLazyEntry already relies on) never has to
+// run with n.mu held.
+type lazyBatchCoordinator struct {
+	n *searchResultDir
+
+	mu      sync.Mutex
+	pending map[blob.Ref]*lazyBatchWait
+	order   []blob.Ref
+	timer   *time.Timer
+}
+
+// joinLazyBatch is resolveLazyEntry's batched alternative to calling
+// dir.ResolveMember directly: it adds permanode to n's current batch
+// (starting one, and its flush timer, if none is running), then waits
+// for that batch to flush, either because LookupBatchSize was reached
+// or LookupBatchWindow elapsed, and returns permanode's own share of
+// the result. It must be called with n.mu unheld, the same as
+// dir.ResolveMember was.
+func (n *searchResultDir) joinLazyBatch(d dir.Describer, permanode blob.Ref) (dir.Entry, bool, error) {
+	c := n.lazyBatchCoordinatorFor()
+	w := c.join(d, permanode)
+	w.wg.Wait()
+	return w.entry, w.ok, w.err
+}
+
+// lazyBatchCoordinatorFor returns n's lazyBatchCoordinator, creating it
+// on first use. It locks n.mu itself, so it must be called with n.mu
+// unheld.
+func (n *searchResultDir) lazyBatchCoordinatorFor() *lazyBatchCoordinator {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.lazyBatch == nil {
+		n.lazyBatch = &lazyBatchCoordinator{n: n}
+	}
+	return n.lazyBatch
+}
+
+// join adds permanode to c's current batch, starting one (and its
+// flush timer, if LookupBatchWindow is set) if none is pending, and
+// returns the lazyBatchWait the caller should wait on. A permanode
+// already pending in the current batch (a retried Lookup racing a
+// still-unflushed group for the same name, say) shares that group's
+// existing wait rather than being added twice.
+func (c *lazyBatchCoordinator) join(d dir.Describer, permanode blob.Ref) *lazyBatchWait {
+	fsys := c.n.fs
+
+	c.mu.Lock()
+	if w, ok := c.pending[permanode]; ok {
+		c.mu.Unlock()
+		return w
+	}
+	if c.pending == nil {
+		c.pending = make(map[blob.Ref]*lazyBatchWait)
+	}
+	w := &lazyBatchWait{}
+	w.wg.Add(1)
+	c.pending[permanode] = w
+	c.order = append(c.order, permanode)
+	if c.timer == nil && fsys.LookupBatchWindow > 0 {
+		c.timer = time.AfterFunc(fsys.LookupBatchWindow, func() {
+			c.flush(d)
+		})
+	}
+	flushNow := fsys.LookupBatchSize > 0 && len(c.order) >= fsys.LookupBatchSize
+	c.mu.Unlock()
+
+	if flushNow {
+		c.flush(d)
+	}
+	return w
+}
+
+// flush resolves whatever batch is currently pending with a single
+// dir.ResolveMembers call, then releases every joined caller waiting
+// on it. It's a no-op if another caller (the timer racing a
+// size-triggered flush, say) already flushed this batch.
+func (c *lazyBatchCoordinator) flush(d dir.Describer) {
+	c.mu.Lock()
+	if len(c.order) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	members := c.order
+	pending := c.pending
+	c.order = nil
+	c.pending = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+
+	results, err := dir.ResolveMembers(context.Background(), d, members, c.n.at)
+	for member, w := range pending {
+		if err != nil {
+			w.err = err
+		} else if e, ok := results[member]; ok {
+			w.entry, w.ok = e, true
+		}
+		w.wg.Done()
+	}
+}
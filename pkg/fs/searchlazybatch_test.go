@@ -0,0 +1,109 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// fakeBatchDescriber is a dir.Describer that records how many
+// distinct Describe calls it received and how many blobrefs each one
+// covered, without needing a real search backend.
+type fakeBatchDescriber struct {
+	calls int32
+
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (f *fakeBatchDescriber) Describe(ctx context.Context, req *search.DescribeRequest) (*search.DescribeResponse, error) {
+	atomic.AddInt32(&f.calls, 1)
+	f.mu.Lock()
+	f.sizes = append(f.sizes, len(req.BlobRefs))
+	f.mu.Unlock()
+	return &search.DescribeResponse{}, nil
+}
+
+// TestLazyBatchCoordinatorJoinSize checks that LookupBatchSize flushes
+// a batch as soon as it's reached, in one dir.ResolveMembers call
+// covering every joined permanode, rather than one call per join.
+func TestLazyBatchCoordinatorJoinSize(t *testing.T) {
+	const joiners = 8
+	n := &searchResultDir{fs: &CamliFileSystem{LookupBatchSize: joiners}}
+	d := &fakeBatchDescriber{}
+
+	var start sync.WaitGroup
+	start.Add(joiners)
+	var done sync.WaitGroup
+	done.Add(joiners)
+	for i := 0; i < joiners; i++ {
+		go func(i int) {
+			start.Done()
+			start.Wait() // line everyone up before any of them joins
+			permanode := blob.RefFromString(string(rune('a' + i)))
+			n.joinLazyBatch(d, permanode)
+			done.Done()
+		}(i)
+	}
+	done.Wait()
+
+	if got := atomic.LoadInt32(&d.calls); got != 1 {
+		t.Errorf("Describe called %d times; want exactly 1", got)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.sizes) != 1 || d.sizes[0] != joiners {
+		t.Errorf("Describe batch sizes = %v; want a single batch of %d", d.sizes, joiners)
+	}
+}
+
+// TestLazyBatchCoordinatorJoinDedup checks that joining the same
+// still-pending permanode twice shares one lazyBatchWait instead of
+// being added to the batch, and flushed, twice.
+func TestLazyBatchCoordinatorJoinDedup(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{LookupBatchSize: 2}}
+	d := &fakeBatchDescriber{}
+	c := n.lazyBatchCoordinatorFor()
+	permanode := blob.RefFromString("dup")
+
+	w1 := c.join(d, permanode)
+	w2 := c.join(d, permanode)
+	if w1 != w2 {
+		t.Fatalf("second join of the same still-pending permanode got a different wait than the first")
+	}
+	if got := atomic.LoadInt32(&d.calls); got != 0 {
+		t.Fatalf("Describe already called %d times before LookupBatchSize was reached", got)
+	}
+
+	c.join(d, blob.RefFromString("other")) // reaches LookupBatchSize, flushes both
+	w1.wg.Wait()
+	w2.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.sizes) != 1 || d.sizes[0] != 2 {
+		t.Errorf("Describe batch sizes = %v; want a single batch of 2 (dup once + other)", d.sizes)
+	}
+}
@@ -0,0 +1,205 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// lazyEntryName is the name a LazyResolve listing gives a permanode
+// it hasn't described yet: the permanode's own blobref, the only
+// thing resolvePage's normal resolution needs a describe to learn
+// that a LazyResolve query doesn't ask for in the first place. It's
+// deterministic and requires no server round trip beyond the initial
+// query, so ReadDirAll and a later Lookup of the same name always
+// agree on it, satisfying the same "deferred resolution must still
+// produce the same names" requirement resolveLazyEntry otherwise
+// fulfills by caching.
+func lazyEntryName(permanode blob.Ref) string {
+	return permanode.String()
+}
+
+// doLazyReaddir is doReaddir's entire body when n.fs.LazyResolve is
+// set: a single, single-page, describe-free search.SearchQuery (no
+// Describe field at all, cheaper than even dir.DescribeSeparate's
+// query-then-batch-describe), naming every result after its own
+// permanode via lazyEntryName and leaving everything else (n.ents,
+// n.sets, n.symlinks, and the rest of the per-entry detail maps
+// doReaddir would normally populate) unresolved until a Lookup or Attr
+// actually needs it; see resolveLazyEntry. It skips doReaddir's
+// pagination, retry, sort-fallback, and since-query machinery
+// entirely, since all of that exists to make a fully-resolved listing
+// complete and correct, which is exactly what LazyResolve is trading
+// away for a fast first return.
+func (n *searchResultDir) doLazyReaddir(ctx context.Context) error {
+	Logger.Printf("fs.search: ReadDirAll, doing lazy search for '%s'", n.searchExp)
+
+	breaker := breakerFor(n.fs)
+	if n.fs.CircuitBreakerEnabled && !breaker.allow() {
+		Logger.Printf("fs.search: ReadDirAll for '%s': circuit breaker open after repeated failures, failing fast", n.searchExp)
+		return fuse.EIO
+	}
+
+	if n.fs.QueryHardBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.fs.QueryHardBudget)
+		defer cancel()
+	}
+
+	limiter := queryLimiterFor(n.fs)
+	if err := limiter.acquire(ctx, metricsFor(n.fs)); err != nil {
+		if n.fs.QueryHardBudget > 0 && ctx.Err() == context.DeadlineExceeded {
+			Logger.Printf("fs.search: ReadDirAll for '%s': exceeded its hard query budget waiting for a query slot", n.searchExp)
+			return fuse.EIO
+		}
+		Logger.Printf("fs.search: ReadDirAll for '%s': waiting for a query slot: %v", n.searchExp, err)
+		return n.fs.effectiveQueryTimeoutErrno()
+	}
+	defer limiter.release()
+
+	auditFor(n.fs).Audit(AuditEvent{Time: time.Now(), Type: AuditQueryExecuted, Expr: n.effectiveSearchExpr()})
+
+	sortBy, _ := serverSortFor(n.effectiveSortBy())
+	res, err := n.fs.queryWithFailover(ctx, n.fs.client, &search.SearchQuery{
+		Expression: n.effectiveSearchExpr(),
+		Limit:      n.effectiveResultCap(),
+		Sort:       sortBy,
+	})
+	queryStatsFor(n.fs).recordResult(n.searchExp, err)
+	if n.fs.CircuitBreakerEnabled {
+		breaker.recordResult(err)
+	}
+	if err != nil {
+		Logger.Printf("fs.search: ReadDirAll for '%s': lazy query failed: %v", n.searchExp, err)
+		return queryErrno(err)
+	}
+
+	permanode := make(map[string]blob.Ref, len(res.Blobs))
+	lastNames := make([]string, 0, len(res.Blobs))
+	for _, ri := range res.Blobs {
+		name := lazyEntryName(ri.Blob)
+		if _, dup := permanode[name]; dup {
+			continue
+		}
+		permanode[name] = ri.Blob
+		lastNames = append(lastNames, name)
+	}
+
+	n.mu.Lock()
+	n.ents = make(map[string]*search.DescribedBlob)
+	n.permanode = permanode
+	n.pnodeMeta = make(map[string]*search.DescribedBlob)
+	n.imageMeta = make(map[string]*search.DescribedBlob)
+	n.sets = make(map[string]dir.Entry)
+	n.symlinks = make(map[string]string)
+	n.contentless = make(map[string]bool)
+	n.placeholders = make(map[string]bool)
+	n.camliPaths = make(map[string]dir.Entry)
+	n.collisionSubdirs = make(map[string]collisionSubdirEntry)
+	n.modTime = make(map[string]time.Time)
+	n.originalNames = make(map[string]string)
+	n.badContent = nil
+	n.errorLog = nil
+	n.matchTotal, n.matchTotalKnown = len(lastNames), false
+	if tr, ok := (interface{})(res).(dir.TotalMatchesReporter); ok {
+		if total, has := tr.TotalMatches(); has {
+			n.matchTotal, n.matchTotalKnown = total, true
+		}
+	}
+	n.lastFatalError = ""
+	n.lastReaddir = time.Now()
+	n.lastNames = lastNames
+	n.mu.Unlock()
+
+	return nil
+}
+
+// resolveLazyEntry fully resolves name, a LazyResolve listing's
+// lazyEntryName stub, the same way a non-lazy doReaddir would already
+// have: a dir.ResolveMember call (or, if CamliFileSystem.LookupBatchWindow
+// or LookupBatchSize is set, a joinLazyBatch call sharing one
+// dir.ResolveMembers request with other concurrently-resolving names)
+// against the permanode lazyEntryName recorded for it, then entryNode
+// to build the fs.Node it deserves. It caches the result back into
+// n.ents/n.sets/n.symlinks
+// and the rest (under n.mu, which must be held on entry and is held
+// on return) so the next Lookup or Attr of the same name finds it
+// already resolved instead of repeating the describe. ok is false if
+// name isn't a pending lazy entry at all (the caller should fall back
+// to its usual ENOENT handling), or if the permanode no longer
+// resolves to anything (deleted or never-described-able since the
+// listing ran), in which case name is left pending so a later retry
+// can still pick it up.
+func (n *searchResultDir) resolveLazyEntry(ctx context.Context, name string) (fs.Node, bool) {
+	if !n.fs.LazyResolve {
+		return nil, false
+	}
+	permanode, pending := n.permanode[name]
+	if !pending {
+		return nil, false
+	}
+	if _, ok := n.ents[name]; ok {
+		return nil, false
+	}
+	d, ok := n.fs.client.(dir.Describer)
+	if !ok {
+		Logger.Printf("fs.searchResultDir: resolveLazyEntry(%q): fs.client doesn't support Describe", name)
+		return nil, false
+	}
+	n.mu.Unlock()
+	var e dir.Entry
+	var found bool
+	var err error
+	if n.fs.LookupBatchWindow > 0 || n.fs.LookupBatchSize > 0 {
+		e, found, err = n.joinLazyBatch(d, permanode)
+	} else {
+		e, found, err = dir.ResolveMember(ctx, d, permanode, n.at)
+	}
+	n.mu.Lock()
+	if err != nil {
+		Logger.Printf("fs.searchResultDir: resolveLazyEntry(%q): %v", name, err)
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+
+	n.ents[name] = e.PNodeMeta
+	n.pnodeMeta[name] = e.PNodeMeta
+	n.imageMeta[name] = e.Image
+	n.modTime[name] = e.ModTime
+	switch {
+	case e.IsSet:
+		n.sets[name] = e
+	case e.IsSymlink:
+		n.symlinks[name] = e.SymlinkTarget
+	case e.IsContentless:
+		n.contentless[name] = true
+	case e.IsPlaceholder:
+		n.placeholders[name] = true
+	}
+	return entryNode(n.fs, e, n.at), true
+}
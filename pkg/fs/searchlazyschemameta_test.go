@@ -0,0 +1,57 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestSchemaMetaFetchErrnoMissingBlob checks that a fetchSchemaMeta
+// failure that looks like the blob itself is gone (os.ErrNotExist, or
+// an error whose text says as much) gets fuse.ENOENT, the errno a
+// Lookup caller should see for something that simply isn't there.
+func TestSchemaMetaFetchErrnoMissingBlob(t *testing.T) {
+	for _, err := range []error{
+		os.ErrNotExist,
+		errors.New("blob not found"),
+		errors.New("no such blob: does not exist"),
+	} {
+		if got := schemaMetaFetchErrno(err); got != fuse.ENOENT {
+			t.Errorf("schemaMetaFetchErrno(%v) = %v; want fuse.ENOENT", err, got)
+		}
+	}
+}
+
+// TestSchemaMetaFetchErrnoTransient checks that any other
+// fetchSchemaMeta failure (a network error, a malformed schema blob)
+// gets fuse.EIO rather than being mistaken for a missing blob.
+func TestSchemaMetaFetchErrnoTransient(t *testing.T) {
+	for _, err := range []error{
+		errors.New("dial tcp: connection refused"),
+		errors.New("malformed schema blob: invalid JSON"),
+	} {
+		if got := schemaMetaFetchErrno(err); got != fuse.EIO {
+			t.Errorf("schemaMetaFetchErrno(%v) = %v; want fuse.EIO", err, got)
+		}
+	}
+}
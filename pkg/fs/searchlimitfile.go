@@ -0,0 +1,113 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// limitFileName is a hidden, per-searchResultDir control file: reading
+// it reports n's current effectiveResultCap, and writing an integer
+// sets n.resultCapOverride to it, the same override a "#limit=" Lookup
+// suffix or a camlifsFileName write would set, but without needing to
+// know either's syntax. Unlike camlifsFileName's write, which takes
+// effect on n's next ReadDirAll, a limitFileName write also invalidates
+// n's cache (see invalidateCache), so the new cap is visible on the
+// very next "ls" rather than waiting out SearchCacheTTL. Like
+// refreshFileName, it's always resolvable via Lookup but never appears
+// in a listing, with or without ShowDotfiles.
+const limitFileName = ".limit"
+
+// setLimitOverride parses content as a decimal integer and sets it as
+// n's resultCapOverride, invalidating n's cache so the new cap takes
+// effect immediately. MaxResultsUnlimited (-1) lifts the cap for n
+// alone, regardless of the mount's own MaxResults; see
+// effectiveResultCap. A value that isn't a valid, non-zero integer is
+// rejected without changing anything, for Write to turn into
+// fuse.EINVAL.
+func (n *searchResultDir) setLimitOverride(content []byte) error {
+	limit, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return fmt.Errorf("invalid limit %q: %v", content, err)
+	}
+	if limit == 0 {
+		return fmt.Errorf("invalid limit %q: must be positive, or %d for unlimited", content, MaxResultsUnlimited)
+	}
+	n.mu.Lock()
+	n.resultCapOverride = &limit
+	n.mu.Unlock()
+	n.invalidateCache()
+	return nil
+}
+
+// limitControlFile is limitFileName's Node and Handle.
+type limitControlFile struct {
+	dir *searchResultDir
+}
+
+var (
+	_ fs.Node         = limitControlFile{}
+	_ fs.HandleReader = limitControlFile{}
+	_ fs.HandleWriter = limitControlFile{}
+)
+
+func (f limitControlFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Valid = f.dir.fs.effectiveAttrValidity()
+	a.Size = uint64(len(f.dir.limitFileContents()))
+	return nil
+}
+
+// limitFileContents renders limitFileName's read content: n's current
+// effectiveResultCap, as a decimal integer followed by a newline.
+func (n *searchResultDir) limitFileContents() string {
+	return fmt.Sprintf("%d\n", n.effectiveResultCap())
+}
+
+func (f limitControlFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := f.dir.limitFileContents()
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = []byte(content[req.Offset:end])
+	return nil
+}
+
+func (f limitControlFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := f.dir.fs.checkWritable(); err != nil {
+		return err
+	}
+	if err := f.dir.setLimitOverride(req.Data); err != nil {
+		Logger.Printf("fs.searchResultDir: %q write for '%s': %v", limitFileName, f.dir.searchExp, err)
+		return fuse.Errno(syscall.EINVAL)
+	}
+	resp.Size = len(req.Data)
+	return nil
+}
@@ -0,0 +1,92 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// TestLimitControlFileReadDefault checks that reading ".limit" before
+// any write reports the mount's default effectiveResultCap.
+func TestLimitControlFileReadDefault(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	f := limitControlFile{dir: n}
+	resp := &fuse.ReadResponse{}
+	if err := f.Read(context.Background(), &fuse.ReadRequest{Size: 64}, resp); err != nil {
+		t.Fatalf("Read = %v; want nil", err)
+	}
+	want := n.limitFileContents()
+	if string(resp.Data) != want {
+		t.Errorf("Read = %q; want %q", resp.Data, want)
+	}
+	if n.effectiveResultCap() != maxSearchResultEntries {
+		t.Errorf("effectiveResultCap before any write = %d; want %d", n.effectiveResultCap(), maxSearchResultEntries)
+	}
+}
+
+// TestLimitControlFileWriteSetsOverride checks that writing a new
+// limit updates effectiveResultCap and invalidates the cache so the
+// new cap takes effect on the very next listing.
+func TestLimitControlFileWriteSetsOverride(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, lastReaddir: time.Now()}
+	f := limitControlFile{dir: n}
+	if err := f.Write(context.Background(), &fuse.WriteRequest{Data: []byte("5\n")}, &fuse.WriteResponse{}); err != nil {
+		t.Fatalf("Write(%q) = %v; want nil", "5", err)
+	}
+	if got, want := n.effectiveResultCap(), 5; got != want {
+		t.Errorf("effectiveResultCap after writing %q = %d; want %d", "5", got, want)
+	}
+	if n.haveCachedListing(time.Hour, 0) {
+		t.Error("haveCachedListing after writing .limit = true; want false (cache invalidated)")
+	}
+}
+
+// TestLimitControlFileWriteUnlimited checks that writing
+// MaxResultsUnlimited lifts the cap past maxSearchResultEntries.
+func TestLimitControlFileWriteUnlimited(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	f := limitControlFile{dir: n}
+	if err := f.Write(context.Background(), &fuse.WriteRequest{Data: []byte("-1")}, &fuse.WriteResponse{}); err != nil {
+		t.Fatalf("Write(%q) = %v; want nil", "-1", err)
+	}
+	if got := n.effectiveResultCap(); got <= maxSearchResultEntries {
+		t.Errorf("effectiveResultCap after writing %q = %d; want > %d", "-1", got, maxSearchResultEntries)
+	}
+}
+
+// TestLimitControlFileWriteInvalid checks that a non-numeric or zero
+// write is rejected with fuse.EINVAL and leaves the cap unchanged.
+func TestLimitControlFileWriteInvalid(t *testing.T) {
+	for _, data := range []string{"not-a-number", "0", ""} {
+		n := &searchResultDir{fs: &CamliFileSystem{}}
+		f := limitControlFile{dir: n}
+		err := f.Write(context.Background(), &fuse.WriteRequest{Data: []byte(data)}, &fuse.WriteResponse{})
+		if err != fuse.Errno(syscall.EINVAL) {
+			t.Errorf("Write(%q) = %v; want fuse.EINVAL", data, err)
+		}
+		if got := n.effectiveResultCap(); got != maxSearchResultEntries {
+			t.Errorf("effectiveResultCap after invalid write %q = %d; want unchanged %d", data, got, maxSearchResultEntries)
+		}
+	}
+}
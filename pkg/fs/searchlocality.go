@@ -0,0 +1,37 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// storageTier resolves n's storage locality hint from
+// n.fs.StorageTierAttr. ok is false when StorageTierAttr isn't set,
+// or the permanode has nothing under it, leaving camliXattrs to omit
+// the xattr entirely.
+func (n *searchResultFile) storageTier() (tier string, ok bool) {
+	attr := n.fs.StorageTierAttr
+	if attr == "" {
+		return "", false
+	}
+	if n.pnodeMeta == nil || n.pnodeMeta.Permanode == nil {
+		return "", false
+	}
+	if v := n.pnodeMeta.Permanode.Attr.Get(attr); v != "" {
+		return v, true
+	}
+	return "", false
+}
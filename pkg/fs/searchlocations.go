@@ -0,0 +1,97 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"perkeep.org/pkg/search"
+)
+
+// locationLatAttr and locationLongAttr are the permanode attrs a
+// geotagged entry is expected to carry, the same way tagsFor reads
+// "tag": ordinary attrs already present in a fully-described
+// permanode's Permanode.Attr map, needing no extra describe rule or
+// query of their own (searchdescriberules.go's "location" example is
+// exactly this). An entry missing either attr, or carrying a value
+// that doesn't parse as a float, simply has no location to report.
+const (
+	locationLatAttr  = "latitude"
+	locationLongAttr = "longitude"
+)
+
+// locationFor returns name's recorded latitude/longitude from
+// n.pnodeMeta, ok=false if either attr is absent or unparseable. It
+// must be called with n.mu held.
+func (n *searchResultDir) locationFor(name string) (lat, long float64, ok bool) {
+	return locationFromMeta(n.pnodeMeta[name])
+}
+
+// locationFromMeta is locationFor's underlying lookup, shared with
+// searchResultFile.camliXattrs, which already has its own pnodeMeta
+// field rather than a name to look one up by.
+func locationFromMeta(pm *search.DescribedBlob) (lat, long float64, ok bool) {
+	if pm == nil || pm.Permanode == nil {
+		return 0, 0, false
+	}
+	latStr := pm.Permanode.Attr.Get(locationLatAttr)
+	longStr := pm.Permanode.Attr.Get(locationLongAttr)
+	if latStr == "" || longStr == "" {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(latStr, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	long, err = strconv.ParseFloat(longStr, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lat, long, true
+}
+
+// locationsFileName is a hidden, per-searchResultDir file listing
+// every entry with a recorded location as tab-separated values, for a
+// mapping tool that wants to plot the whole result set from one read
+// rather than a per-file xattr round trip (see
+// searchResultFile.Getxattr's "user.camli.location"). Like
+// dimensionsFileName, it's always resolvable via Lookup; see
+// CamliFileSystem.ShowDotfiles for whether it's also listed in
+// ReadDirAll.
+const locationsFileName = ".locations.tsv"
+
+// locationsFileContents renders locationsFileName's content: one
+// "name\tlatitude\tlongitude" line per name in n.lastNames with a
+// recorded location (see locationFor), skipping every name without
+// one. Like dimensionsFileContents, it's a lazy snapshot regenerated
+// from whatever ReadDirAll last cached, not a fresh query, so it must
+// be called with n.mu held.
+func (n *searchResultDir) locationsFileContents() string {
+	var b strings.Builder
+	for _, name := range n.lastNames {
+		lat, long, ok := n.locationFor(name)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "%s\t%g\t%g\n", name, lat, long)
+	}
+	return b.String()
+}
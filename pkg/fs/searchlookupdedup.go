@@ -0,0 +1,85 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+
+	"bazil.org/fuse/fs"
+)
+
+// targetedCall is the in-flight state of a single lookupTargeted query
+// for one name, exactly like readdirCall is for a whole-directory
+// ReadDirAll: the caller that finds n.targetedLookups[name] absent
+// starts the query and owns this value; every other caller that finds
+// it present waits on wg and then reads node/ok, instead of each
+// firing its own redundant copy of the same narrowed query.
+type targetedCall struct {
+	wg   sync.WaitGroup
+	node fs.Node
+	ok   bool
+}
+
+// lookupTargetedOnce is lookupTargeted, deduplicated across concurrent
+// Lookups for the same name on a still-unseeded n: without it, a media
+// player that stats and then opens the same cold path from two threads
+// (or several mount users racing the same "ls <file>") would fire the
+// same narrowed query twice for no benefit, since lookupTargeted
+// doesn't mutate any of n's cached state for the second caller to
+// reuse. It must be called with n.mu unheld, the same as
+// lookupTargeted.
+func (n *searchResultDir) lookupTargetedOnce(ctx context.Context, name string) (fs.Node, bool) {
+	return n.dedupTargetedLookup(name, func() (fs.Node, bool) {
+		return n.lookupTargeted(ctx, name)
+	})
+}
+
+// dedupTargetedLookup is lookupTargetedOnce's coordination, factored
+// out from the query itself so it can be exercised without a real
+// client (see searchlookupdedup_test.go): the caller that finds
+// n.targetedLookups[name] absent runs fn and owns the resulting call;
+// every other caller that finds it present waits on call.wg and
+// shares its node/ok instead of running fn again. It must be called
+// with n.mu unheld.
+func (n *searchResultDir) dedupTargetedLookup(name string, fn func() (fs.Node, bool)) (fs.Node, bool) {
+	n.mu.Lock()
+	if call, ok := n.targetedLookups[name]; ok {
+		n.mu.Unlock()
+		call.wg.Wait()
+		return call.node, call.ok
+	}
+	call := &targetedCall{}
+	call.wg.Add(1)
+	if n.targetedLookups == nil {
+		n.targetedLookups = make(map[string]*targetedCall)
+	}
+	n.targetedLookups[name] = call
+	n.mu.Unlock()
+
+	node, ok := fn()
+
+	n.mu.Lock()
+	delete(n.targetedLookups, name)
+	n.mu.Unlock()
+
+	call.node, call.ok = node, ok
+	call.wg.Done()
+	return node, ok
+}
@@ -0,0 +1,99 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"bazil.org/fuse/fs"
+)
+
+// TestDedupTargetedLookupConcurrent hammers dedupTargetedLookup for
+// the same name from many goroutines before any of them have a
+// result, the same as several Lookups racing a cold searchResultDir:
+// fn must run exactly once, and every caller must see its result.
+func TestDedupTargetedLookupConcurrent(t *testing.T) {
+	n := &searchResultDir{}
+	var calls int32
+	var ready sync.WaitGroup
+	ready.Add(1)
+
+	const callers = 50
+	var start sync.WaitGroup
+	start.Add(callers)
+	var done sync.WaitGroup
+	done.Add(callers)
+
+	results := make([]bool, callers)
+	for i := 0; i < callers; i++ {
+		go func(i int) {
+			start.Done()
+			start.Wait() // line everyone up before any of them calls in
+			_, ok := n.dedupTargetedLookup("foo.jpg", func() (fs.Node, bool) {
+				atomic.AddInt32(&calls, 1)
+				ready.Wait() // hold fn open until every caller has joined
+				return nil, true
+			})
+			results[i] = ok
+			done.Done()
+		}(i)
+	}
+
+	// Give every goroutine a chance to either become the runner or
+	// join the in-flight call before letting fn return.
+	start.Wait()
+	ready.Done()
+	done.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("fn ran %d times; want exactly 1", got)
+	}
+	for i, ok := range results {
+		if !ok {
+			t.Errorf("caller %d: dedupTargetedLookup ok = false; want true", i)
+		}
+	}
+	if len(n.targetedLookups) != 0 {
+		t.Errorf("targetedLookups left with %d entries after completion; want 0", len(n.targetedLookups))
+	}
+}
+
+// TestDedupTargetedLookupDistinctNames checks that different names
+// don't share a call: each must run fn on its own.
+func TestDedupTargetedLookupDistinctNames(t *testing.T) {
+	n := &searchResultDir{}
+	var calls int32
+	var wg sync.WaitGroup
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			n.dedupTargetedLookup(name, func() (fs.Node, bool) {
+				atomic.AddInt32(&calls, 1)
+				return nil, true
+			})
+		}(name)
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("fn ran %d times across 3 distinct names; want 3", got)
+	}
+}
@@ -0,0 +1,31 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// effectiveLookupFreshness reports the freshness threshold fs's
+// searchResultDirs apply to a direct Lookup, as opposed to
+// EffectiveSearchCacheTTL's own threshold for ReadDirAll.
+func (fs *CamliFileSystem) effectiveLookupFreshness() time.Duration {
+	if fs.LookupFreshness > 0 {
+		return fs.LookupFreshness
+	}
+	return fs.EffectiveSearchCacheTTL()
+}
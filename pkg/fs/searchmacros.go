@@ -0,0 +1,76 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// expressionMacroRE matches a "${name}" context macro token in a
+// search expression, e.g. "${now}", "${today}", or "${user}".
+var expressionMacroRE = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// expressionMacros maps each macro name expandExpressionMacros
+// recognizes to the function that expands it, given the mount it's
+// running under and the instant Lookup resolved it at.
+var expressionMacros = map[string]func(fsys *CamliFileSystem, now time.Time) string{
+	"now": func(fsys *CamliFileSystem, now time.Time) string {
+		return now.Format(time.RFC3339)
+	},
+	"today": func(fsys *CamliFileSystem, now time.Time) string {
+		return now.Format("2006-01-02")
+	},
+	"user": func(fsys *CamliFileSystem, now time.Time) string {
+		return fsys.Owner
+	},
+}
+
+// expandExpressionMacros substitutes every "${name}" token in expr
+// that expressionMacros recognizes, each expanded against the same now
+// (so "${today}" and any other time-sensitive macro in one expression
+// stay consistent with each other) and against fsys's own context
+// (e.g. "${user}" for fsys.Owner). An unrecognized macro is left
+// exactly as it appears, unless fsys.StrictExpressionMacros is set, in
+// which case it's reported as an error instead.
+//
+// Lookup calls this once per directory creation, the same way it
+// already expands relative dates (see expandRelativeDates), so a
+// shareable expression like "owner:${user} after:${today}" resolves
+// once when "cd"ed into rather than re-expanding on every ReadDirAll.
+func expandExpressionMacros(fsys *CamliFileSystem, expr string, now time.Time) (string, error) {
+	var unknown []string
+	out := expressionMacroRE.ReplaceAllStringFunc(expr, func(token string) string {
+		name := expressionMacroRE.FindStringSubmatch(token)[1]
+		fn, ok := expressionMacros[name]
+		if !ok {
+			if fsys.StrictExpressionMacros {
+				unknown = append(unknown, name)
+			}
+			return token
+		}
+		return fn(fsys, now)
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unrecognized expression macro(s): %s", strings.Join(unknown, ", "))
+	}
+	return out, nil
+}
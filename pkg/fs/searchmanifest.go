@@ -0,0 +1,148 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// manifestFileName is a hidden file at the "search" directory's own
+// root summarizing the whole mount as one structured document, for
+// backup tooling that wants a single file to read rather than
+// walking every searchResultDir by hand. It's the mount-wide analog
+// of resultsJSONName, built from CachedSearchDirs the same way
+// statusFileName's "search dir cache" lines are, plus, when
+// ManifestIncludeEntries is set, each directory's own resultsJSONName
+// entries. Like statusFileName and configFileName, it's always
+// resolvable via Lookup but never listed in ReadDirAll.
+const manifestFileName = ".manifest.json"
+
+// manifestDirEntry is one element of manifestContents' "searchDirs"
+// array: a SearchDirInfo snapshot, plus its resolved entries when
+// ManifestIncludeEntries is set.
+type manifestDirEntry struct {
+	Expr        string             `json:"expr"`
+	Entries     int                `json:"entries"`
+	Age         string             `json:"age"`
+	ApproxBytes int64              `json:"approxBytes"`
+	Resolved    []resultsJSONEntry `json:"resolvedEntries,omitempty"`
+}
+
+// manifestContents renders manifestFileName's content: fsys's
+// redacted configuration (the same fields and redaction
+// configFileContents reports, so a secret never leaks into a backup
+// tool's manifest just because it's also troubleshooting information),
+// followed by one manifestDirEntry per CachedSearchDirs entry.
+// Resolving each entry's own dir.ResolveMember-free candidate blobs
+// can be sizable for a warm mount with many large directories, so
+// that part is only ever run when includeEntries is set; even then,
+// each directory's entries are marshaled and appended one at a time
+// rather than collected into one combined slice first, so peak memory
+// is one directory's entries, not every directory's.
+func manifestContents(ctx context.Context, fsys *CamliFileSystem, includeEntries bool) []byte {
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	b.WriteString("\t\"config\": ")
+	config, err := json.Marshal(string(configFileContents(fsys)))
+	if err != nil {
+		// configFileContents only ever produces valid UTF-8 text, so
+		// this can't actually happen; fall back to an empty string
+		// rather than an invalid document.
+		config = []byte(`""`)
+	}
+	b.Write(config)
+	b.WriteString(",\n\t\"searchDirs\": [")
+	dirs := searchDirCacheFor(fsys).rawSnapshot()
+	for i, d := range dirs {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n\t\t")
+		entry := manifestDirEntryFor(d, includeEntries)
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			Logger.Printf("fs.search: %s: marshaling %q: %v", manifestFileName, entry.Expr, err)
+			continue
+		}
+		b.Write(encoded)
+	}
+	if len(dirs) > 0 {
+		b.WriteString("\n\t")
+	}
+	b.WriteString("]\n}\n")
+	return b.Bytes()
+}
+
+// manifestDirEntryFor builds d's manifestDirEntry, taking d.mu only
+// long enough to read its cached info and (if includeEntries)
+// entries; it never re-runs d's search, so a cold or evicted
+// directory simply reports zero entries instead of blocking a
+// manifest read on a fresh query.
+func manifestDirEntryFor(d *searchResultDir, includeEntries bool) manifestDirEntry {
+	info := d.info()
+	entry := manifestDirEntry{
+		Expr:        info.Expr,
+		Entries:     info.Entries,
+		Age:         info.Age.String(),
+		ApproxBytes: info.ApproxBytes,
+	}
+	if includeEntries {
+		d.mu.Lock()
+		entry.Resolved = d.resultsJSONEntries()
+		d.mu.Unlock()
+	}
+	return entry
+}
+
+// manifestFile is manifestFileName's Node and Handle: a read-only file
+// whose content is generated fresh on every Read from fs's live
+// CachedSearchDirs state, the same on-read-generation statusFile and
+// configFile otherwise use for their own dynamic content.
+type manifestFile struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node         = manifestFile{}
+	_ fs.HandleReader = manifestFile{}
+)
+
+func (f manifestFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0444
+	a.Valid = f.fs.effectiveAttrValidity()
+	return nil
+}
+
+func (f manifestFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := manifestContents(ctx, f.fs, f.fs.ManifestIncludeEntries)
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = content[req.Offset:end]
+	return nil
+}
@@ -0,0 +1,30 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// MaxResultsUnlimited, set as CamliFileSystem.MaxResults, disables not
+// just the mount's own cap but maxSearchResultEntries too, for an
+// operator who has measured their server and their memory budget and
+// genuinely wants every result a search matches, however large. Most
+// mounts should leave MaxResults at its zero value instead: that
+// already returns everything up to maxSearchResultEntries, which is
+// plenty for browsing and far cheaper to recover from than an
+// accidentally unbounded "ls" against a library of hundreds of
+// thousands of items.
+const MaxResultsUnlimited = -1
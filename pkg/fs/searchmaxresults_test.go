@@ -0,0 +1,64 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestEffectiveResultCapDefault checks that a zero CamliFileSystem
+// caps at maxSearchResultEntries, the pre-existing unbounded-in-name-only
+// behavior.
+func TestEffectiveResultCapDefault(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	if got := n.effectiveResultCap(); got != maxSearchResultEntries {
+		t.Errorf("effectiveResultCap() = %d; want %d", got, maxSearchResultEntries)
+	}
+}
+
+// TestEffectiveResultCapConfigured checks that a MaxResults below
+// maxSearchResultEntries narrows the cap to it.
+func TestEffectiveResultCapConfigured(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{MaxResults: 5}}
+	if got := n.effectiveResultCap(); got != 5 {
+		t.Errorf("effectiveResultCap() = %d; want 5", got)
+	}
+}
+
+// TestEffectiveResultCapUnlimited checks that MaxResultsUnlimited
+// lifts the cap past maxSearchResultEntries entirely.
+func TestEffectiveResultCapUnlimited(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{MaxResults: MaxResultsUnlimited}}
+	if got := n.effectiveResultCap(); got <= maxSearchResultEntries {
+		t.Errorf("effectiveResultCap() with MaxResultsUnlimited = %d; want > %d", got, maxSearchResultEntries)
+	}
+}
+
+// TestEffectiveResultCapOverrideNarrowsUnlimited checks that a
+// resultCapOverride (e.g. from a "limit=" Lookup option) still narrows
+// the cap even when MaxResultsUnlimited would otherwise leave it
+// uncapped.
+func TestEffectiveResultCapOverrideNarrowsUnlimited(t *testing.T) {
+	override := 3
+	n := &searchResultDir{
+		fs:                &CamliFileSystem{MaxResults: MaxResultsUnlimited},
+		resultCapOverride: &override,
+	}
+	if got := n.effectiveResultCap(); got != 3 {
+		t.Errorf("effectiveResultCap() = %d; want 3", got)
+	}
+}
@@ -0,0 +1,29 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// effectiveMaxInlineSetMembers reports the inline member cap fs
+// actually applies to a set's top-level describe: MaxInlineSetMembers
+// if positive, or 0 (no cap) otherwise.
+func (fs *CamliFileSystem) effectiveMaxInlineSetMembers() int {
+	if fs.MaxInlineSetMembers > 0 {
+		return fs.MaxInlineSetMembers
+	}
+	return 0
+}
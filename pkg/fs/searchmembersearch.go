@@ -0,0 +1,122 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// memberSearchDirName is the reserved name of a searchMemberDir's own
+// "cd <expr>" entry point: "cd .search" then "cd is:image" runs a
+// further search scoped to just that set's members (direct children
+// of n.permanode, via the "childrenof:" predicate), composing the
+// set-membership constraint with whatever expression is given, the
+// same way the top-level search directory's "cd <expr>" works one
+// level up.
+const memberSearchDirName = ".search"
+
+// memberSearchReadme is memberSearchDir's README.txt.
+const memberSearchReadme = `
+You are in a set's ".search" directory, for running a further search
+scoped to just this set's members.
+
+Usage: cd "<search query>", e.g.:
+
+	cd "is:image"
+
+The query is ANDed with a "childrenof:" predicate naming this set's
+own permanode, so it only ever matches direct members of the set, not
+the whole index. A "#" suffix sets that directory's own limit/sort/ttl
+the same way it does under the top-level search directory.
+`
+
+// memberSearchDir is memberSearchDirName's node: each Lookup under it
+// runs expr scoped to member's set, caching the resulting
+// searchResultDir the same way the top-level search directory caches
+// one per "cd <expr>".
+type memberSearchDir struct {
+	member *searchMemberDir
+}
+
+var (
+	_ fs.Node               = (*memberSearchDir)(nil)
+	_ fs.HandleReadDirAller = (*memberSearchDir)(nil)
+	_ fs.NodeStringLookuper = (*memberSearchDir)(nil)
+)
+
+func (n *memberSearchDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = n.member.fs.effectiveAttrValidity()
+	a.Uid = n.member.fs.effectiveUid()
+	a.Gid = n.member.fs.effectiveGid()
+	return nil
+}
+
+func (n *memberSearchDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return []fuse.Dirent{{Name: "README.txt", Type: fuse.DT_File}}, nil
+}
+
+// memberSearchCacheKey returns the searchDirCache key n's scoped
+// Lookup(rawName) is cached under: the set's own permanode plus
+// rawName, so the same expression scoped to two different sets (or
+// looked up unscoped at the top level) each get their own
+// independently cached searchResultDir instead of colliding.
+func (n *memberSearchDir) memberSearchCacheKey(rawName string) string {
+	return memberSearchDirName + "/" + n.member.permanode.String() + "/" + rawName
+}
+
+func (n *memberSearchDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == "README.txt" {
+		return staticFileNode(memberSearchReadme), nil
+	}
+	expr, opts, err := splitSearchOptions(name)
+	if err != nil {
+		Logger.Printf("fs.search: memberSearchDir Lookup(%q): %v", name, err)
+		return nil, fuse.EINVAL
+	}
+	expr, err = expandExpressionMacros(n.member.fs, expr, time.Now())
+	if err != nil {
+		Logger.Printf("fs.search: memberSearchDir Lookup(%q): %v", name, err)
+		return nil, fuse.EINVAL
+	}
+	expr, err = n.member.fs.rewriteExpression(expandRelativeDates(expr, time.Now()))
+	if err != nil {
+		Logger.Printf("fs.search: memberSearchDir Lookup(%q): rewriting expression: %v", name, err)
+		return nil, fuse.EINVAL
+	}
+	cacheKey := n.memberSearchCacheKey(name)
+	cache := searchDirCacheFor(n.member.fs)
+	if d, ok := cache.get(cacheKey); ok {
+		return d, nil
+	}
+	d := &searchResultDir{
+		fs:        n.member.fs,
+		searchExp: fmt.Sprintf("childrenof:%s %s", n.member.permanode.String(), expr),
+		at:        n.member.at,
+	}
+	opts.applyTo(d)
+	cache.add(cacheKey, d)
+	return d, nil
+}
@@ -0,0 +1,96 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// membersOfDirName is the reserved "search/members-of" directory:
+// each child names a set permanode's blobref and resolves straight to
+// a searchMemberDir over its camliMember values, for browsing a
+// collection directly by identifier rather than through a search
+// result that happens to contain it.
+const membersOfDirName = "members-of"
+
+// membersOfDir is the "search/members-of" directory itself. It isn't
+// enumerable, since nothing short of the blobref names its children;
+// see atDir for the same non-listable shape.
+type membersOfDir struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node               = (*membersOfDir)(nil)
+	_ fs.HandleReadDirAller = (*membersOfDir)(nil)
+	_ fs.NodeStringLookuper = (*membersOfDir)(nil)
+)
+
+func (n *membersOfDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+func (n *membersOfDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return nil, nil
+}
+
+// Lookup parses name as a blobref and, if it describes a set
+// permanode, resolves to a searchMemberDir over its members, reusing
+// the same member-resolution dir.ResolveMember already backs
+// searchDir.lookupBlobRef and searchMemberDir itself. A name that
+// isn't a valid blobref is fuse.EINVAL; one that doesn't resolve at
+// all is fuse.ENOENT; one that resolves but isn't a set is
+// fuse.Errno(syscall.ENOTDIR), since there's nothing to browse into.
+func (n *membersOfDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	br, ok := blob.Parse(name)
+	if !ok {
+		Logger.Printf("fs.membersOf: Lookup(%q): not a blobref", name)
+		return nil, fuse.EINVAL
+	}
+	e, ok, err := dir.ResolveMember(ctx, n.fs.client, br, nil)
+	if err != nil {
+		Logger.Printf("fs.membersOf: Lookup(%v): %v", br, err)
+		return nil, fuse.EIO
+	}
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	if !e.IsSet {
+		Logger.Printf("fs.membersOf: Lookup(%v): not a set", br)
+		return nil, fuse.Errno(syscall.ENOTDIR)
+	}
+	return &searchMemberDir{
+		fs:        n.fs,
+		permanode: e.Permanode,
+		pnodeMeta: e.PNodeMeta,
+		members:   e.Members,
+		ancestors: map[blob.Ref]bool{e.Permanode: true},
+	}, nil
+}
@@ -0,0 +1,92 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// MetricsCollector receives optional instrumentation events from a
+// searchResultDir's ReadDirAll (see pkg/fs/searchResult.go), for a
+// mount operator who wants to monitor the mount's behavior (e.g.
+// wiring it into Prometheus) without scraping Logger output.
+type MetricsCollector interface {
+	// ObserveSearchLatency reports how long one doReaddir call (the
+	// query branch of ReadDirAll) took.
+	ObserveSearchLatency(d time.Duration)
+	// IncCacheHit counts a ReadDirAll served from the cached branch,
+	// without issuing a query.
+	IncCacheHit()
+	// IncCacheMiss counts a ReadDirAll that had to query the server.
+	IncCacheMiss()
+	// IncSchemaMetaFailure counts a Lookup whose fetchSchemaMeta call
+	// failed (see CamliFileSystem.LazySchemaMeta), whether or not
+	// that failure was allowed to fail the Lookup itself.
+	IncSchemaMetaFailure()
+	// IncBlobCacheHit counts a blob fetch during a searchResultFile's
+	// Open or Read (see cachingFetcher) served from
+	// CamliFileSystem.BlobCacheBytes's shared LRU instead of the
+	// blobserver.
+	IncBlobCacheHit()
+	// IncBlobCacheMiss counts one that had to fetch from the
+	// blobserver, populating the cache for next time.
+	IncBlobCacheMiss()
+	// IncDescribedBlobCacheHit counts a direct, single-blobref
+	// describe (see describeRendition) served from the shared
+	// describedBlobCache instead of a fresh describe call.
+	IncDescribedBlobCacheHit()
+	// IncDescribedBlobCacheMiss counts one that had to describe,
+	// populating the cache for next time.
+	IncDescribedBlobCacheMiss()
+	// ObserveQueryQueueDepth reports how many doReaddir calls were
+	// queued behind CamliFileSystem.QueryConcurrency's semaphore,
+	// including the one just queuing, at the moment a caller joined
+	// the queue (see queryLimiter.acquire).
+	ObserveQueryQueueDepth(depth int)
+	// ObserveQueryWait reports how long a doReaddir call spent in
+	// queryLimiter.acquire: zero if a slot was immediately free.
+	ObserveQueryWait(d time.Duration)
+	// IncFailover counts a read-path call (search query or schema blob
+	// fetch) that failed against its current endpoint and moved on to
+	// the next one in CamliFileSystem.ServerEndpoints.
+	IncFailover()
+}
+
+// noopMetrics is the CamliFileSystem.Metrics default: every method is
+// a no-op, so existing callers that never set Metrics pay nothing.
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveSearchLatency(time.Duration) {}
+func (noopMetrics) IncCacheHit()                       {}
+func (noopMetrics) IncCacheMiss()                      {}
+func (noopMetrics) IncSchemaMetaFailure()              {}
+func (noopMetrics) IncBlobCacheHit()                   {}
+func (noopMetrics) IncBlobCacheMiss()                  {}
+func (noopMetrics) IncDescribedBlobCacheHit()          {}
+func (noopMetrics) IncDescribedBlobCacheMiss()         {}
+func (noopMetrics) ObserveQueryQueueDepth(int)         {}
+func (noopMetrics) ObserveQueryWait(time.Duration)     {}
+func (noopMetrics) IncFailover()                       {}
+
+// metricsFor returns fsys.Metrics, or noopMetrics{} if it's unset, so
+// callers never need a nil check.
+func metricsFor(fsys *CamliFileSystem) MetricsCollector {
+	if fsys.Metrics != nil {
+		return fsys.Metrics
+	}
+	return noopMetrics{}
+}
@@ -0,0 +1,36 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// defaultMIMEClassDirs is the MIMEClassDirs searchResultDir.Lookup
+// uses when CamliFileSystem.MIMEClassDirs is unset.
+var defaultMIMEClassDirs = map[string]string{
+	"images": "is:image",
+	"videos": "is:video",
+	"docs":   "is:document",
+}
+
+// effectiveMIMEClassDirs returns fs.MIMEClassDirs, or
+// defaultMIMEClassDirs if that's unset (nil).
+func (fs *CamliFileSystem) effectiveMIMEClassDirs() map[string]string {
+	if fs.MIMEClassDirs != nil {
+		return fs.MIMEClassDirs
+	}
+	return defaultMIMEClassDirs
+}
@@ -0,0 +1,34 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// directoryMIMEType is the "user.camli.mime" xattr value
+// (searchMemberDir.camliXattrs) reports for a set/directory entry,
+// which has no ccMeta.File.MIMEType of its own to report: the standard
+// MIME type for a directory-like resource, so a script branching on
+// "user.camli.mime" doesn't need a separate "is this even a file"
+// check first.
+const directoryMIMEType = "inode/directory"
+
+// defaultMIMEType is what searchResultFile.camliXattrs reports for
+// "user.camli.mime" when ccMeta.File.MIMEType came back empty, rather
+// than omitting the xattr: a script that already expects every result
+// to carry one doesn't need a special case for "the server didn't
+// know."
+const defaultMIMEType = "application/octet-stream"
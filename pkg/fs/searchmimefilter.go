@@ -0,0 +1,62 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"path"
+
+	"perkeep.org/pkg/search/dir"
+)
+
+// mimeFilterAllows reports whether de should be included in n's
+// listing under n.fs.MIMEAllow/MIMEDeny. It must be called with n.mu
+// held, the same as resultFilterAllows, even though it doesn't
+// actually touch n itself, to match doReaddir's call site.
+func (n *searchResultDir) mimeFilterAllows(de dir.Entry) bool {
+	if len(n.fs.MIMEAllow) == 0 && len(n.fs.MIMEDeny) == 0 {
+		return true
+	}
+	mimeType := ""
+	if de.Blob != nil && de.Blob.File != nil {
+		mimeType = de.Blob.File.MIMEType
+	}
+	if mimeType == "" {
+		return len(n.fs.MIMEAllow) == 0
+	}
+	if matchesAnyMIMEPattern(n.fs.MIMEDeny, mimeType) {
+		return false
+	}
+	if len(n.fs.MIMEAllow) > 0 && !matchesAnyMIMEPattern(n.fs.MIMEAllow, mimeType) {
+		return false
+	}
+	return true
+}
+
+// matchesAnyMIMEPattern reports whether mimeType matches any of
+// patterns, each a path.Match glob; a malformed pattern simply never
+// matches, the same way searchglob.go's own path.Match callers treat
+// ErrBadPattern.
+func matchesAnyMIMEPattern(patterns []string, mimeType string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, mimeType); ok {
+			return true
+		}
+	}
+	return false
+}
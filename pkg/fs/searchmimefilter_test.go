@@ -0,0 +1,95 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+func entryWithMIME(mimeType string) dir.Entry {
+	if mimeType == "" {
+		return dir.Entry{}
+	}
+	return dir.Entry{Blob: &search.DescribedBlob{File: &search.DescribedFile{MIMEType: mimeType}}}
+}
+
+// TestMIMEFilterAllowOnly checks that MIMEAllow alone keeps only
+// matching entries, and still excludes a non-matching one.
+func TestMIMEFilterAllowOnly(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{MIMEAllow: []string{"image/*"}}}
+	if !n.mimeFilterAllows(entryWithMIME("image/jpeg")) {
+		t.Error("image/jpeg should pass an image/* allowlist")
+	}
+	if n.mimeFilterAllows(entryWithMIME("video/mp4")) {
+		t.Error("video/mp4 should be excluded by an image/* allowlist")
+	}
+}
+
+// TestMIMEFilterDenyOnly checks that MIMEDeny alone excludes only
+// matching entries, keeping everything else.
+func TestMIMEFilterDenyOnly(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{MIMEDeny: []string{"video/*"}}}
+	if n.mimeFilterAllows(entryWithMIME("video/mp4")) {
+		t.Error("video/mp4 should be excluded by a video/* denylist")
+	}
+	if !n.mimeFilterAllows(entryWithMIME("image/jpeg")) {
+		t.Error("image/jpeg should pass a video/* denylist")
+	}
+}
+
+// TestMIMEFilterDenyWinsOverAllow checks that an entry matching both
+// MIMEAllow and MIMEDeny is excluded: deny always wins.
+func TestMIMEFilterDenyWinsOverAllow(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{
+		MIMEAllow: []string{"image/*"},
+		MIMEDeny:  []string{"image/gif"},
+	}}
+	if n.mimeFilterAllows(entryWithMIME("image/gif")) {
+		t.Error("image/gif matches both the allow and deny lists; deny should win")
+	}
+	if !n.mimeFilterAllows(entryWithMIME("image/png")) {
+		t.Error("image/png matches only the allowlist; it should still pass")
+	}
+}
+
+// TestMIMEFilterKeepsUntypedEntriesUnlessAllowlisted checks that an
+// entry with no MIME type at all (a set, a symlink, ...) is kept when
+// no MIMEAllow is configured, but excluded once one is, since there's
+// nothing for the allowlist to match against.
+func TestMIMEFilterKeepsUntypedEntriesUnlessAllowlisted(t *testing.T) {
+	untyped := dir.Entry{IsSet: true}
+
+	noFilter := &searchResultDir{fs: &CamliFileSystem{}}
+	if !noFilter.mimeFilterAllows(untyped) {
+		t.Error("an untyped entry should pass when no MIME filter is configured at all")
+	}
+
+	denyOnly := &searchResultDir{fs: &CamliFileSystem{MIMEDeny: []string{"video/*"}}}
+	if !denyOnly.mimeFilterAllows(untyped) {
+		t.Error("an untyped entry should pass a deny-only filter")
+	}
+
+	withAllow := &searchResultDir{fs: &CamliFileSystem{MIMEAllow: []string{"image/*"}}}
+	if withAllow.mimeFilterAllows(untyped) {
+		t.Error("an untyped entry should be excluded once an allowlist is configured")
+	}
+}
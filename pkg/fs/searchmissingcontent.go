@@ -0,0 +1,112 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// MissingContentPolicy selects what searchResultFile.Open does when a
+// permanode's camliContent resolved fine (the index already knows its
+// schema and size) but the content blob itself hasn't actually synced
+// to the blobserver yet -- a partial-sync window a mount browsing a
+// still-replicating server can otherwise hit.
+type MissingContentPolicy int
+
+const (
+	// MissingContentSkip is the historical behavior: Open fails with
+	// the underlying fetch error, and pruneIfNotFound immediately
+	// forgets the entry so the next ReadDirAll or Lookup no longer
+	// lists it, rather than leaving a stale, unopenable name around
+	// until SearchCacheTTL next expires.
+	MissingContentSkip MissingContentPolicy = iota
+
+	// MissingContentPlaceholder keeps the entry instead: Open
+	// succeeds with a pendingSyncHandle, whose Read always fails with
+	// fuse.EAGAIN rather than data, and a "user.camli.pending" xattr
+	// (see searchResultFile.camliXattrs) reports "1" for the
+	// duration, so a tool watching a sync catch up can tell the file
+	// is expected to eventually become readable rather than gone for
+	// good.
+	MissingContentPlaceholder
+)
+
+// effectiveMissingContentPolicy reports the MissingContentPolicy fs
+// actually applies to a searchResultFile's Open.
+func (fsys *CamliFileSystem) effectiveMissingContentPolicy() MissingContentPolicy {
+	return fsys.MissingContentPolicy
+}
+
+// placeholderForMissingContent returns a pendingSyncHandle instead of
+// letting Open fail outright, when n.fs.MissingContentPolicy is
+// MissingContentPlaceholder and err looks like the content blob
+// itself hasn't synced yet (see blobNotFound); ok is false otherwise,
+// meaning Open should fall back to its usual pruneIfNotFound/error
+// handling. It logs the policy taking effect, since a placeholder
+// silently standing in for real content is otherwise a surprising
+// thing to find in a mount's log-free steady state.
+func (n *searchResultFile) placeholderForMissingContent(err error) (fs.Handle, bool) {
+	if n.fs.effectiveMissingContentPolicy() != MissingContentPlaceholder || !blobNotFound(err) {
+		return nil, false
+	}
+	n.markPendingSync()
+	Logger.Printf("fs.searchResultFile: Open(%q): %v not yet synced; serving pending-sync placeholder", n.name, n.blobref)
+	return pendingSyncHandle{}, true
+}
+
+// markPendingSync records that n's content blob hasn't synced yet, for
+// camliXattrs' "user.camli.pending" xattr. It's guarded by accessMu,
+// the same mutex n's other post-construction, Open-time field
+// (lastAccess) already uses.
+func (n *searchResultFile) markPendingSync() {
+	n.accessMu.Lock()
+	defer n.accessMu.Unlock()
+	n.pendingSync = true
+}
+
+// isPendingSync reports whether markPendingSync has been called on n.
+func (n *searchResultFile) isPendingSync() bool {
+	n.accessMu.Lock()
+	defer n.accessMu.Unlock()
+	return n.pendingSync
+}
+
+// pendingSyncHandle is the fs.Handle a searchResultFile.Open returns
+// under MissingContentPolicy's MissingContentPlaceholder setting: it
+// stands in for content that exists in the index but hasn't actually
+// synced to the blobserver yet, so there's nothing it can honestly
+// serve.
+type pendingSyncHandle struct{}
+
+var (
+	_ fs.Handle       = pendingSyncHandle{}
+	_ fs.HandleReader = pendingSyncHandle{}
+)
+
+// Read implements fs.HandleReader, always failing with fuse.EAGAIN:
+// the right signal for a reader to back off and retry once the
+// content has had a chance to sync, rather than EIO's implication
+// that it never will.
+func (pendingSyncHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	return fuse.Errno(syscall.EAGAIN)
+}
@@ -0,0 +1,79 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+)
+
+// Mkdir implements fs.NodeMkdirer: it uploads a new permanode titled
+// req.Name and, if n.searchExp is a single "tag:value" predicate (the
+// same restriction Create already applies, via tagForExpression),
+// tags it to match so it shows up in n's own listing immediately.
+// Other expressions still get the permanode; they just don't get a
+// matching attribute, the same tradeoff Create documents.
+//
+// The new permanode has no camliMember yet, so until something's
+// added to it (e.g. by copying files into the returned directory's
+// own mount path, once that's supported, or by tagging further
+// members elsewhere), it surfaces as an empty set: IsContentless
+// (see CamliFileSystem.IncludeContentless) rather than IsSet, the
+// same as any other permanode with neither camliContent nor
+// camliMember.
+func (n *searchResultDir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	if err := n.fs.checkWritable(); err != nil {
+		return nil, err
+	}
+	if !n.fs.AllowMkdir {
+		return nil, n.fs.effectiveUnsupportedErrno(UnsupportedFeatureOff)
+	}
+	if n.at != nil {
+		return nil, n.fs.effectiveUnsupportedErrno(UnsupportedImmutable)
+	}
+
+	pn, err := n.fs.client.UploadNewPermanode(ctx)
+	if err != nil {
+		Logger.Printf("fs.searchResultDir: Mkdir(%q): creating permanode: %v", req.Name, err)
+		return nil, fuse.EIO
+	}
+	titleClaim := schema.NewSetAttributeClaim(pn.BlobRef, "title", req.Name)
+	if _, err := n.fs.client.UploadAndSignBlob(ctx, titleClaim); err != nil {
+		Logger.Printf("fs.searchResultDir: Mkdir(%q): setting title: %v", req.Name, err)
+		return nil, fuse.EIO
+	}
+	if tag, ok := tagForExpression(n.searchExp); ok {
+		tagClaim := schema.NewSetAttributeClaim(pn.BlobRef, "tag", tag)
+		if _, err := n.fs.client.UploadAndSignBlob(ctx, tagClaim); err != nil {
+			Logger.Printf("fs.searchResultDir: Mkdir(%q): tagging: %v", req.Name, err)
+			return nil, fuse.EIO
+		}
+	}
+
+	n.invalidateCache()
+	return &searchMemberDir{
+		fs:        n.fs,
+		permanode: pn.BlobRef,
+		ancestors: map[blob.Ref]bool{pn.BlobRef: true},
+	}, nil
+}
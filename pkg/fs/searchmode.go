@@ -0,0 +1,53 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "os"
+
+// effectiveDirMode returns fsys.DirMode if set, else def, the
+// directory's own existing hardcoded default.
+func (fsys *CamliFileSystem) effectiveDirMode(def os.FileMode) os.FileMode {
+	if fsys.DirMode != 0 {
+		return fsys.DirMode
+	}
+	return def
+}
+
+// effectiveFileMode returns fsys.FileMode if set (with its write bits
+// stripped when readOnly), else 0444 or 0666 depending on readOnly,
+// exactly as searchResultFile.Attr hardcoded before FileMode existed.
+// readOnly is forced true when fsys.AllowContentReplace isn't set,
+// since nothing is actually writable in that case; see
+// AllowContentReplace.
+func (fsys *CamliFileSystem) effectiveFileMode(readOnly bool) os.FileMode {
+	if !fsys.AllowContentReplace {
+		readOnly = true
+	}
+	if fsys.FileMode == 0 {
+		if readOnly {
+			return 0444
+		}
+		return 0666
+	}
+	mode := fsys.FileMode
+	if readOnly {
+		mode &^= 0222
+	}
+	return mode
+}
@@ -0,0 +1,92 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"os"
+	"testing"
+)
+
+// TestEffectiveFileModeDefaults checks that a plain, non-replaceable
+// searchResultFile always reports 0444, whether or not the entry
+// itself was looked up read-only, since content replacement isn't
+// wired up without AllowContentReplace.
+func TestEffectiveFileModeDefaults(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	if got := fsys.effectiveFileMode(false); got != 0444 {
+		t.Errorf("effectiveFileMode(false) = %v; want 0444", got)
+	}
+	if got := fsys.effectiveFileMode(true); got != 0444 {
+		t.Errorf("effectiveFileMode(true) = %v; want 0444", got)
+	}
+}
+
+// TestEffectiveFileModeAllowContentReplace checks that
+// AllowContentReplace lets a non-read-only file advertise 0666, while
+// a read-only one (e.g. an "at" snapshot) still reports 0444.
+func TestEffectiveFileModeAllowContentReplace(t *testing.T) {
+	fsys := &CamliFileSystem{AllowContentReplace: true}
+	if got := fsys.effectiveFileMode(false); got != 0666 {
+		t.Errorf("effectiveFileMode(false) = %v; want 0666", got)
+	}
+	if got := fsys.effectiveFileMode(true); got != 0444 {
+		t.Errorf("effectiveFileMode(true) = %v; want 0444", got)
+	}
+}
+
+// TestEffectiveFileModeCustomStripsWriteBitsReadOnly checks that a
+// configured FileMode keeps its own bits when writable, but has its
+// write bits stripped when readOnly, rather than advertising a write
+// mode nothing will honor.
+func TestEffectiveFileModeCustomStripsWriteBitsReadOnly(t *testing.T) {
+	fsys := &CamliFileSystem{AllowContentReplace: true, FileMode: 0660}
+	if got := fsys.effectiveFileMode(false); got != 0660 {
+		t.Errorf("effectiveFileMode(false) = %v; want 0660", got)
+	}
+	if got := fsys.effectiveFileMode(true); got != 0440 {
+		t.Errorf("effectiveFileMode(true) = %v; want 0440", got)
+	}
+}
+
+// TestEffectiveDirModeDefaultsUnaffectedByReadOnly checks that
+// directory mode bits (never a write-capability signal the way a
+// file's are) are unaffected by CamliFileSystem.ReadOnly: they keep
+// reporting their caller-supplied default unless DirMode overrides it.
+func TestEffectiveDirModeDefaultsUnaffectedByReadOnly(t *testing.T) {
+	fsys := &CamliFileSystem{ReadOnly: true}
+	if got := fsys.effectiveDirMode(0555); got != 0555 {
+		t.Errorf("effectiveDirMode(0555) with ReadOnly = %v; want unchanged 0555", got)
+	}
+	fsys.DirMode = os.FileMode(0700)
+	if got := fsys.effectiveDirMode(0555); got != 0700 {
+		t.Errorf("effectiveDirMode(0555) with DirMode override = %v; want 0700", got)
+	}
+}
+
+// TestCheckWritableRespectsReadOnly checks that ReadOnly overrides
+// AllowContentReplace for actual write attempts, even though
+// effectiveFileMode alone can't see ReadOnly (it's keyed off readOnly
+// per-node, not the mount flag); checkWritable is what every mutation
+// handler, including searchResultFile.Setattr, consults first.
+func TestCheckWritableRespectsReadOnly(t *testing.T) {
+	fsys := &CamliFileSystem{ReadOnly: true, AllowContentReplace: true}
+	if err := fsys.checkWritable(); err == nil {
+		t.Error("checkWritable() with ReadOnly set = nil; want an error")
+	}
+}
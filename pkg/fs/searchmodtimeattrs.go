@@ -0,0 +1,89 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"time"
+
+	"perkeep.org/pkg/search/dir"
+	"perkeep.org/pkg/types"
+)
+
+// ModTimePreference selects which of an entry's two time sources
+// entryModTime prefers once ModTimeAttrs has had its own, higher-priority
+// chance to override both: dir.Entry.ModTime (generally the content's
+// own embedded file/dir schema time) or the permanode's own ModTime,
+// as recorded on its own claims. Unlike ModTimeAttrs's attribute
+// lookup, this applies uniformly to every entry regardless of type,
+// since e.PNodeMeta.Permanode.ModTime is reliably present (or
+// reliably absent) the same way for a file, a directory, a symlink, or
+// a set.
+type ModTimePreference int
+
+const (
+	// ModTimePreferenceContent keeps dir.Entry.ModTime as-is,
+	// preserving the historical default.
+	ModTimePreferenceContent ModTimePreference = iota
+
+	// ModTimePreferencePermanode prefers the permanode's own ModTime
+	// when present, falling back to dir.Entry.ModTime only if the
+	// permanode has none.
+	ModTimePreferencePermanode
+
+	// ModTimePreferenceNewest takes whichever of the two is later.
+	ModTimePreferenceNewest
+)
+
+// entryModTime reports the modtime doReaddir should record for e,
+// honoring CamliFileSystem.ModTimeAttrs first (see ModTimeAttrs), then
+// CamliFileSystem.ModTimePreference's choice between e.ModTime and the
+// permanode's own ModTime.
+func (n *searchResultDir) entryModTime(e dir.Entry) time.Time {
+	if e.PNodeMeta != nil && e.PNodeMeta.Permanode != nil {
+		for _, attr := range n.fs.ModTimeAttrs {
+			raw := e.PNodeMeta.Permanode.Attr.Get(attr)
+			if raw == "" {
+				continue
+			}
+			if t, err := types.ParseTime3339(raw); err == nil {
+				debugf("fs.search: permanode %v: modtime from alias attribute %q", e.Permanode, attr)
+				return t.Time()
+			}
+		}
+	}
+
+	contentTime := e.ModTime
+	var permanodeTime time.Time
+	havePermanodeTime := false
+	if e.PNodeMeta != nil && e.PNodeMeta.Permanode != nil && e.PNodeMeta.Permanode.ModTime != nil {
+		permanodeTime = e.PNodeMeta.Permanode.ModTime.Time()
+		havePermanodeTime = true
+	}
+	switch n.fs.ModTimePreference {
+	case ModTimePreferencePermanode:
+		if havePermanodeTime {
+			return permanodeTime
+		}
+	case ModTimePreferenceNewest:
+		if havePermanodeTime && permanodeTime.After(contentTime) {
+			return permanodeTime
+		}
+	}
+	return contentTime
+}
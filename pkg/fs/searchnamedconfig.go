@@ -0,0 +1,135 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// namedSearchView is one NamedSearchesConfigFile entry: Expr is
+// resolved the same way a Lookup name normally would be (macros,
+// relative dates, ExpressionRewriter), and the embedded camlifsConfig
+// supplies its limit/sort/ttl overrides, validated by
+// camlifsConfig.toOptions the same way a camlifsFileName write is.
+// Its Fields setting has no equivalent here; it's ignored.
+type namedSearchView struct {
+	Expr string `json:"expr"`
+	camlifsConfig
+}
+
+// namedSearchesConfig is NamedSearchesConfigFile's JSON shape.
+type namedSearchesConfig struct {
+	Views  map[string]namedSearchView `json:"views"`
+	Strict bool                       `json:"strict,omitempty"`
+}
+
+// namedSearchesState holds one CamliFileSystem's most recently loaded
+// namedSearchesConfig.
+type namedSearchesState struct {
+	mu     sync.Mutex
+	cfg    namedSearchesConfig
+	loaded bool
+}
+
+// namedSearchesRegistry holds each CamliFileSystem's namedSearchesState,
+// keyed by pointer identity the same way queryStatsRegistry is.
+var (
+	namedSearchesMu  sync.Mutex
+	namedSearchesReg = map[*CamliFileSystem]*namedSearchesState{}
+)
+
+func namedSearchesStateFor(fsys *CamliFileSystem) *namedSearchesState {
+	namedSearchesMu.Lock()
+	defer namedSearchesMu.Unlock()
+	st, ok := namedSearchesReg[fsys]
+	if !ok {
+		st = &namedSearchesState{}
+		namedSearchesReg[fsys] = st
+	}
+	return st
+}
+
+// load (re)reads fsys.NamedSearchesConfigFile into st, logging and
+// leaving st's prior config in place on any read or parse error,
+// rather than blanking out a mount's dashboard over a transient
+// mistake (e.g. a reload racing a half-written file).
+func (st *namedSearchesState) load(fsys *CamliFileSystem) {
+	b, err := os.ReadFile(fsys.NamedSearchesConfigFile)
+	if err != nil {
+		Logger.Printf("fs.search: %s: reading named searches config: %v", fsys.NamedSearchesConfigFile, err)
+		return
+	}
+	var cfg namedSearchesConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		Logger.Printf("fs.search: %s: parsing named searches config: %v", fsys.NamedSearchesConfigFile, err)
+		return
+	}
+	st.mu.Lock()
+	st.cfg = cfg
+	st.loaded = true
+	st.mu.Unlock()
+	Logger.Printf("fs.search: %s: loaded %d named search(es)", fsys.NamedSearchesConfigFile, len(cfg.Views))
+}
+
+// namedSearchesFor returns fsys's current namedSearchesConfig, loading
+// it for the first time if nothing's loaded one yet.
+func namedSearchesFor(fsys *CamliFileSystem) namedSearchesConfig {
+	st := namedSearchesStateFor(fsys)
+	st.mu.Lock()
+	loaded := st.loaded
+	st.mu.Unlock()
+	if !loaded {
+		st.load(fsys)
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.cfg
+}
+
+// namedSearchesWatched tracks which CamliFileSystems already have a
+// SIGHUP reload goroutine running, so startNamedSearchesWatcher only
+// ever starts one per mount no matter how many times it's called.
+var namedSearchesWatched sync.Map // *CamliFileSystem -> struct{}
+
+// startNamedSearchesWatcher loads fsys's NamedSearchesConfigFile (if
+// unset, it's a no-op) and, the first time it's called for fsys,
+// starts a goroutine that reloads it on every SIGHUP the process
+// receives. Safe to call on every searchDir.Attr/ReadDirAll/Lookup,
+// the same way warmupPinnedExpressions already is.
+func startNamedSearchesWatcher(fsys *CamliFileSystem) {
+	if fsys.NamedSearchesConfigFile == "" {
+		return
+	}
+	if _, already := namedSearchesWatched.LoadOrStore(fsys, struct{}{}); already {
+		return
+	}
+	namedSearchesFor(fsys)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			Logger.Printf("fs.search: %s: SIGHUP received, reloading named searches config", fsys.NamedSearchesConfigFile)
+			namedSearchesStateFor(fsys).load(fsys)
+		}
+	}()
+}
@@ -0,0 +1,142 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"sync"
+	"text/template"
+	"time"
+
+	"perkeep.org/pkg/search/dir"
+)
+
+// nameTemplateData is NameTemplate's rendering context.
+type nameTemplateData struct {
+	Name        string            // the content blob's own filename, before any templating
+	Title       string            // convenience alias for Attr["title"]
+	Ext         string            // filepath.Ext(Name)
+	MIMEType    string            // the content's resolved MIME type, "" if unknown
+	ModTime     time.Time         // de.ModTime
+	Date        string            // ModTime.Format("2006-01-02"), for a template that just wants a date prefix
+	CaptureDate string            // de.Image.File.Time formatted as "2006-01-02", "" if de isn't an image or has no recorded capture time
+	Attr        map[string]string // the permanode's own attrs, first value of each
+}
+
+// nameTemplateDataFor builds de's NameTemplate rendering context.
+func nameTemplateDataFor(de dir.Entry) nameTemplateData {
+	data := nameTemplateData{
+		Name:    de.Name,
+		Ext:     filepath.Ext(de.Name),
+		ModTime: de.ModTime,
+		Date:    de.ModTime.Format("2006-01-02"),
+		Attr:    make(map[string]string),
+	}
+	if de.Blob != nil && de.Blob.File != nil {
+		data.MIMEType = de.Blob.File.MIMEType
+	}
+	if de.Image != nil && de.Image.File != nil {
+		if t := de.Image.File.Time; !t.IsAnyZero() {
+			data.CaptureDate = t.Time().Format("2006-01-02")
+		}
+	}
+	if de.PNodeMeta != nil && de.PNodeMeta.Permanode != nil {
+		for attr, vals := range de.PNodeMeta.Permanode.Attr {
+			if len(vals) > 0 {
+				data.Attr[attr] = vals[0]
+			}
+		}
+		data.Title = data.Attr["title"]
+	}
+	return data
+}
+
+// nameTemplateEntry is one CamliFileSystem's parsed NameTemplate, or
+// the error parsing or test-rendering it hit, cached so a malformed
+// template is only ever reported once instead of on every entry.
+type nameTemplateEntry struct {
+	tmpl *template.Template
+	err  error
+}
+
+// nameTemplatesMu and nameTemplates cache each CamliFileSystem's
+// compiled NameTemplate, keyed by pointer identity the same way
+// searchbreaker.go's breakers registry is.
+var (
+	nameTemplatesMu sync.Mutex
+	nameTemplates   = map[*CamliFileSystem]*nameTemplateEntry{}
+)
+
+// compiledNameTemplate returns fsys's parsed NameTemplate, parsing it
+// (and test-rendering it against a zero-value nameTemplateData, to
+// also catch a reference to a field that doesn't exist) on first use.
+// A fsys with no NameTemplate set returns nil, nil.
+func compiledNameTemplate(fsys *CamliFileSystem) (*template.Template, error) {
+	if fsys.NameTemplate == "" {
+		return nil, nil
+	}
+	nameTemplatesMu.Lock()
+	defer nameTemplatesMu.Unlock()
+	if e, ok := nameTemplates[fsys]; ok {
+		return e.tmpl, e.err
+	}
+	t, err := template.New("nameTemplate").Parse(fsys.NameTemplate)
+	if err == nil {
+		err = t.Execute(io.Discard, nameTemplateData{Attr: map[string]string{}})
+	}
+	e := &nameTemplateEntry{tmpl: t, err: err}
+	nameTemplates[fsys] = e
+	return e.tmpl, e.err
+}
+
+// ValidateNameTemplate parses and caches fsys.NameTemplate, for a
+// mount's setup path to call once so a malformed template (bad
+// syntax, or a reference to a field nameTemplateData doesn't have)
+// fails mount setup immediately with a clear error, instead of only
+// surfacing later as every entry silently keeping its untemplated
+// name. A fsys with no NameTemplate set returns nil without doing
+// anything.
+func ValidateNameTemplate(fsys *CamliFileSystem) error {
+	_, err := compiledNameTemplate(fsys)
+	return err
+}
+
+// renderNameTemplate renders n.fs.NameTemplate for de, returning ok
+// false if NameTemplate isn't set, if it's set but failed to parse or
+// test-render (already reported once by ValidateNameTemplate at mount
+// setup), or if it rendered to the empty string (e.g. a template that
+// only decorates .Title for a permanode with no title attr), leaving
+// the caller to keep de.Name as-is in every such case.
+func (n *searchResultDir) renderNameTemplate(de dir.Entry) (string, bool) {
+	tmpl, err := compiledNameTemplate(n.fs)
+	if tmpl == nil || err != nil {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nameTemplateDataFor(de)); err != nil {
+		Logger.Printf("fs.search: NameTemplate: rendering for %v: %v", de.Permanode, err)
+		return "", false
+	}
+	if buf.Len() == 0 {
+		return "", false
+	}
+	return buf.String(), true
+}
@@ -0,0 +1,131 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+	"perkeep.org/pkg/types"
+	"perkeep.org/pkg/types/camtypes"
+)
+
+// TestNameTemplateDataForCaptureDate checks that CaptureDate is
+// derived from the image describe's File.Time when present, and left
+// empty both for a non-image entry and for an image with no recorded
+// capture time, rather than falling back to ModTime.
+func TestNameTemplateDataForCaptureDate(t *testing.T) {
+	captured := time.Date(2015, 10, 1, 12, 0, 0, 0, time.UTC)
+	de := dir.Entry{
+		Name:    "IMG_0001.jpg",
+		ModTime: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		Image: &search.DescribedBlob{
+			File: &camtypes.FileInfo{Time: types.Time3339FromTime(captured)},
+		},
+	}
+	data := nameTemplateDataFor(de)
+	if data.CaptureDate != "2015-10-01" {
+		t.Errorf("CaptureDate = %q; want %q", data.CaptureDate, "2015-10-01")
+	}
+
+	noTime := dir.Entry{Name: "IMG_0002.jpg", Image: &search.DescribedBlob{File: &camtypes.FileInfo{}}}
+	if got := nameTemplateDataFor(noTime).CaptureDate; got != "" {
+		t.Errorf("CaptureDate = %q for an image with no recorded time; want \"\"", got)
+	}
+
+	notImage := dir.Entry{Name: "notes.txt"}
+	if got := nameTemplateDataFor(notImage).CaptureDate; got != "" {
+		t.Errorf("CaptureDate = %q for a non-image entry; want \"\"", got)
+	}
+}
+
+// TestRenderNameTemplateCaptureDateOrdering checks that decorating
+// names with .CaptureDate via NameTemplate produces names that sort
+// chronologically, even when the underlying filenames themselves
+// wouldn't (e.g. IMG_0001.jpg taken after IMG_0002.jpg).
+func TestRenderNameTemplateCaptureDateOrdering(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{NameTemplate: `{{if .CaptureDate}}{{.CaptureDate}}_{{end}}{{.Name}}`}}
+
+	older := dir.Entry{
+		Name:  "IMG_0002.jpg",
+		Image: &search.DescribedBlob{File: &camtypes.FileInfo{Time: types.Time3339FromTime(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))}},
+	}
+	newer := dir.Entry{
+		Name:  "IMG_0001.jpg",
+		Image: &search.DescribedBlob{File: &camtypes.FileInfo{Time: types.Time3339FromTime(time.Date(2015, 10, 1, 0, 0, 0, 0, time.UTC))}},
+	}
+
+	olderName, ok := n.renderNameTemplate(older)
+	if !ok {
+		t.Fatalf("renderNameTemplate(older) ok = false")
+	}
+	if olderName != "2015-01-01_IMG_0002.jpg" {
+		t.Errorf("renderNameTemplate(older) = %q; want %q", olderName, "2015-01-01_IMG_0002.jpg")
+	}
+	newerName, ok := n.renderNameTemplate(newer)
+	if !ok {
+		t.Fatalf("renderNameTemplate(newer) ok = false")
+	}
+	if newerName != "2015-10-01_IMG_0001.jpg" {
+		t.Errorf("renderNameTemplate(newer) = %q; want %q", newerName, "2015-10-01_IMG_0001.jpg")
+	}
+
+	names := []string{newerName, olderName}
+	sort.Strings(names)
+	if names[0] != olderName || names[1] != newerName {
+		t.Errorf("sorted names = %v; want the capture-dated names in chronological order", names)
+	}
+}
+
+// TestRenderNameTemplateTitleAttr checks that a template referencing
+// .Title picks up the permanode's "title" attr.
+func TestRenderNameTemplateTitleAttr(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{NameTemplate: `{{.Title}}{{.Ext}}`}}
+	attrs := url.Values{}
+	attrs.Set("title", "Beach Day")
+	de := dir.Entry{
+		Name: "IMG_0001.jpg",
+		PNodeMeta: &search.DescribedBlob{
+			Permanode: &search.DescribedPermanode{Attr: attrs},
+		},
+	}
+	got, ok := n.renderNameTemplate(de)
+	if !ok {
+		t.Fatalf("renderNameTemplate(title) ok = false")
+	}
+	if want := "Beach Day.jpg"; got != want {
+		t.Errorf("renderNameTemplate(title) = %q; want %q", got, want)
+	}
+}
+
+// TestRenderNameTemplateEmptyFallsBack checks that a template
+// rendering to the empty string (no title attr here) reports ok=false
+// rather than a name that overwrites the caller's existing de.Name
+// with nothing.
+func TestRenderNameTemplateEmptyFallsBack(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{NameTemplate: `{{.Title}}`}}
+	de := dir.Entry{Name: "IMG_0001.jpg"}
+	if got, ok := n.renderNameTemplate(de); ok {
+		t.Errorf("renderNameTemplate(no title) = %q, ok = true; want ok = false so the caller keeps de.Name", got)
+	}
+}
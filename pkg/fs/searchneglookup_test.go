@@ -0,0 +1,74 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// TestLookupNegativeCacheHit checks that a name with a recent
+// negLookup entry returns fuse.ENOENT straight from the cache,
+// without n ever needing to issue a fresh search: n.fs.client is left
+// nil here, so touching it would panic, and this test only passes if
+// Lookup never gets that far for either probe.
+func TestLookupNegativeCacheHit(t *testing.T) {
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{},
+		negLookup: map[string]time.Time{"Thumbs.db": time.Now()},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := n.Lookup(context.Background(), "Thumbs.db"); err != fuse.ENOENT {
+			t.Fatalf("Lookup(%q) attempt %d = %v; want fuse.ENOENT from the negative cache", "Thumbs.db", i, err)
+		}
+	}
+}
+
+// TestEffectiveNegLookupTTLDefault checks that a zero
+// CamliFileSystem.NegativeLookupTTL leaves defaultNegLookupTTL in
+// effect, and that setting it overrides the default.
+func TestEffectiveNegLookupTTLDefault(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	if got := n.effectiveNegLookupTTL(); got != defaultNegLookupTTL {
+		t.Errorf("effectiveNegLookupTTL() = %v; want %v", got, defaultNegLookupTTL)
+	}
+	n.fs.NegativeLookupTTL = time.Minute
+	if got := n.effectiveNegLookupTTL(); got != time.Minute {
+		t.Errorf("effectiveNegLookupTTL() with override = %v; want %v", got, time.Minute)
+	}
+}
+
+// TestInvalidateCacheClearsNegLookup checks that invalidateCache
+// (called by refreshControlFile's ".refresh", and by every mutation
+// handler that just changed one of n's own permanodes) also clears
+// negLookup, so a name found missing before the mutation isn't still
+// masked by that stale miss right after an explicit refresh.
+func TestInvalidateCacheClearsNegLookup(t *testing.T) {
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{},
+		negLookup: map[string]time.Time{"newfile.jpg": time.Now()},
+	}
+	n.invalidateCache()
+	if n.negLookup != nil {
+		t.Errorf("negLookup after invalidateCache() = %v; want nil", n.negLookup)
+	}
+}
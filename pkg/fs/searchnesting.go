@@ -0,0 +1,196 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+)
+
+// capNestingDepth applies fsys.FilenameNestingMaxDepth to name, a
+// slash-joined name already past sanitizeFilename/normalizeFilename.
+// It's a no-op unless both FilenameNesting and FilenameNestingMaxDepth
+// are set.
+func capNestingDepth(fsys *CamliFileSystem, name string) string {
+	if !fsys.FilenameNesting || fsys.FilenameNestingMaxDepth <= 0 {
+		return name
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) <= fsys.FilenameNestingMaxDepth {
+		return name
+	}
+	kept := parts[:fsys.FilenameNestingMaxDepth-1]
+	flattened := strings.Join(parts[fsys.FilenameNestingMaxDepth-1:], "%2F")
+	return strings.Join(append(kept, flattened), "/")
+}
+
+// nestedChildNames returns, in first-appearance order, the immediate
+// path-component children of prefix (the empty string for the root)
+// found among names, which are full slash-joined entry names as
+// stored in n.ents/n.sets/n.symlinks. A name with more components
+// beyond prefix contributes just its next component, deduplicated
+// across every other name sharing it; one with none left is a leaf,
+// returned as-is.
+func nestedChildNames(names []string, prefix string) []string {
+	skip := 0
+	if prefix != "" {
+		skip = len(prefix) + 1
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for _, name := range names {
+		if prefix != "" {
+			if !strings.HasPrefix(name, prefix+"/") {
+				continue
+			}
+		}
+		rest := name[skip:]
+		if rest == "" {
+			continue
+		}
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			rest = rest[:i]
+		}
+		if seen[rest] {
+			continue
+		}
+		seen[rest] = true
+		out = append(out, rest)
+	}
+	return out
+}
+
+// nestedIsDir reports whether full (a prefix joined with a child
+// component) only exists among names as a directory, i.e. some name
+// has it as a strict prefix, rather than as a leaf entry in its own
+// right. It must agree with nestedChildNames: a name it would place
+// under a directory must make nestedIsDir true for that directory.
+func nestedIsDir(names []string, full string) bool {
+	for _, name := range names {
+		if name == full {
+			return false
+		}
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, full+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// direntsForListing is direntsWithProgress, except when
+// n.fs.FilenameNesting is set: then names (a snapshot of n.lastNames)
+// is collapsed to just its root-level children, with the ones that
+// are really directories (see nestedIsDir) listed bare and the rest
+// passed through to direntsWithProgress as before. It must be called
+// with n.mu held.
+func (n *searchResultDir) direntsForListing(names []string, refs map[string]blob.Ref, kinds map[string]fuse.DirentType) []fuse.Dirent {
+	if !n.fs.FilenameNesting {
+		return n.direntsWithProgress(names, refs, kinds)
+	}
+	var dirNames, leafNames []string
+	for _, child := range nestedChildNames(names, "") {
+		if nestedIsDir(names, child) {
+			dirNames = append(dirNames, child)
+			continue
+		}
+		leafNames = append(leafNames, child)
+	}
+	ents := dirents(dirNames, fuse.DT_Dir)
+	return append(ents, n.direntsWithProgress(leafNames, refs, kinds)...)
+}
+
+// nestedDirFor reports whether name names a directory synthesized
+// from deeper nested names (as opposed to a real leaf entry), and if
+// so returns the *nestedDir for it. It must be called with n.mu held.
+func (n *searchResultDir) nestedDirFor(name string) (fs.Node, bool) {
+	if !nestedIsDir(n.lastNames, name) {
+		return nil, false
+	}
+	return &nestedDir{parent: n, prefix: name}, true
+}
+
+// nestedDir is one directory component of a FilenameNesting
+// hierarchy: everything under parent whose full name has prefix as a
+// strict "/"-joined prefix. Resolving a leaf delegates back to
+// parent.Lookup with the reconstructed full name, so it gets exactly
+// the same permanode/xattr handling a direct Lookup against parent
+// would give.
+type nestedDir struct {
+	parent *searchResultDir
+	prefix string
+}
+
+var (
+	_ fs.Node               = (*nestedDir)(nil)
+	_ fs.HandleReadDirAller = (*nestedDir)(nil)
+	_ fs.NodeStringLookuper = (*nestedDir)(nil)
+)
+
+func (d *nestedDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *nestedDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	names := d.parent.lastNames
+	children := nestedChildNames(names, d.prefix)
+	ents := make([]fuse.Dirent, len(children))
+	for i, child := range children {
+		typ := fuse.DT_File
+		full := child
+		if d.prefix != "" {
+			full = d.prefix + "/" + child
+		}
+		if nestedIsDir(names, full) {
+			typ = fuse.DT_Dir
+		}
+		ents[i] = fuse.Dirent{Name: child, Type: typ}
+	}
+	d.parent.mu.Unlock()
+	return ents, nil
+}
+
+func (d *nestedDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	full := d.prefix + "/" + name
+	d.parent.mu.Lock()
+	names := d.parent.lastNames
+	isDir := nestedIsDir(names, full)
+	d.parent.mu.Unlock()
+	if isDir {
+		return &nestedDir{parent: d.parent, prefix: full}, nil
+	}
+	return d.parent.Lookup(ctx, full)
+}
@@ -0,0 +1,93 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestNestedChildNames is a regression test for FilenameNesting's
+// tree-building: a deeper name must contribute only its next
+// component at each level, deduplicated across siblings, while a name
+// with nothing left at that level is a leaf.
+func TestNestedChildNames(t *testing.T) {
+	names := []string{"a/b/c.txt", "a/b/d.txt", "a/e.txt", "f.txt"}
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"", []string{"a", "f.txt"}},
+		{"a", []string{"b", "e.txt"}},
+		{"a/b", []string{"c.txt", "d.txt"}},
+	}
+	for _, tt := range tests {
+		got := nestedChildNames(names, tt.prefix)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("nestedChildNames(%v, %q) = %v; want %v", names, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+// TestCapNestingDepth checks FilenameNestingMaxDepth's flattening:
+// a name within the cap passes through unchanged, one beyond it keeps
+// only its first MaxDepth-1 components as directories and
+// percent-escapes the slashes it collapses into the final one, and
+// the cap has no effect at all unless FilenameNesting is also set.
+func TestCapNestingDepth(t *testing.T) {
+	tests := []struct {
+		nesting  bool
+		maxDepth int
+		name     string
+		want     string
+	}{
+		{true, 0, "a/b/c/d.txt", "a/b/c/d.txt"},
+		{false, 2, "a/b/c/d.txt", "a/b/c/d.txt"},
+		{true, 2, "a/b.txt", "a/b.txt"},
+		{true, 2, "a/b/c/d.txt", "a/b%2Fc%2Fd.txt"},
+		{true, 1, "a/b/c/d.txt", "a%2Fb%2Fc%2Fd.txt"},
+	}
+	for _, tt := range tests {
+		fsys := &CamliFileSystem{FilenameNesting: tt.nesting, FilenameNestingMaxDepth: tt.maxDepth}
+		if got := capNestingDepth(fsys, tt.name); got != tt.want {
+			t.Errorf("capNestingDepth(nesting=%v, maxDepth=%d, %q) = %q; want %q", tt.nesting, tt.maxDepth, tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestNestedIsDir is a regression test for nestedDirFor/nestedDir.Lookup's
+// directory-vs-leaf test: only a name that's a strict prefix of some
+// other name is a directory, never a name that's itself a full entry.
+func TestNestedIsDir(t *testing.T) {
+	names := []string{"a/b/c.txt", "a/e.txt", "f.txt"}
+	for _, tt := range []struct {
+		full string
+		want bool
+	}{
+		{"a", true},
+		{"a/b", true},
+		{"a/e.txt", false},
+		{"f.txt", false},
+		{"nope", false},
+	} {
+		if got := nestedIsDir(names, tt.full); got != tt.want {
+			t.Errorf("nestedIsDir(%v, %q) = %v; want %v", names, tt.full, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestDoReaddirNilClient checks that doReaddir returns a plain
+// fuse.EIO instead of panicking when CamliFileSystem.client was never
+// set.
+func TestDoReaddirNilClient(t *testing.T) {
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{},
+		searchExp: "is:file",
+	}
+	if err := n.doReaddir(context.Background()); err != fuse.EIO {
+		t.Errorf("doReaddir() with nil client = %v; want fuse.EIO", err)
+	}
+}
@@ -0,0 +1,55 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "golang.org/x/text/unicode/norm"
+
+// FilenameNorm selects the Unicode normalization form applied to
+// search result filenames, to match what CamliFileSystem.FilenameNorm
+// is set to.
+type FilenameNorm int
+
+const (
+	// FilenameNormNone leaves filenames exactly as stored, the
+	// zero value and default.
+	FilenameNormNone FilenameNorm = iota
+	// FilenameNormNFC normalizes to NFC (precomposed), what macOS
+	// tools and most other filesystems expect.
+	FilenameNormNFC
+	// FilenameNormNFD normalizes to NFD (decomposed), what HFS+/APFS
+	// itself stores paths as.
+	FilenameNormNFD
+)
+
+// normalizeFilename applies fsys.FilenameNorm to name, the same form
+// doReaddir uses when storing a name in n.ents and Lookup uses before
+// comparing an incoming name against it, so that a permanode
+// filename stored in one Unicode normalization form still matches a
+// caller spelling it in the other. It returns name unchanged when
+// FilenameNorm is FilenameNormNone.
+func normalizeFilename(fsys *CamliFileSystem, name string) string {
+	switch fsys.FilenameNorm {
+	case FilenameNormNFC:
+		return norm.NFC.String(name)
+	case FilenameNormNFD:
+		return norm.NFD.String(name)
+	default:
+		return name
+	}
+}
@@ -0,0 +1,206 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// staleMarkerName is the synthetic entry doReaddir appends to a
+// listing served from OfflineCachePath after a live query failed,
+// the same way emptyMarkerName flags an empty-but-successful listing:
+// a stale-but-served one needs just as visible a signal, since
+// otherwise it's indistinguishable in an "ls" from a normal, current
+// listing.
+const staleMarkerName = ".stale"
+
+// defaultOfflineCacheMaxAge is generous enough to cover a weekend
+// offline without requiring OfflineCacheMaxAge to be configured.
+const defaultOfflineCacheMaxAge = 7 * 24 * time.Hour
+
+// effectiveOfflineCacheMaxAge returns fsys.OfflineCacheMaxAge if set,
+// else defaultOfflineCacheMaxAge.
+func (fsys *CamliFileSystem) effectiveOfflineCacheMaxAge() time.Duration {
+	if fsys.OfflineCacheMaxAge != 0 {
+		return fsys.OfflineCacheMaxAge
+	}
+	return defaultOfflineCacheMaxAge
+}
+
+// offlineCacheEntry is one name's record in an offlineCacheListing,
+// holding just enough to rebuild n.permanode/n.sets/n.symlinks/
+// n.modTime for that name (see applyOfflineCacheListing), not the
+// full describe metadata a live query would have populated.
+type offlineCacheEntry struct {
+	Permanode string    `json:"permanode,omitempty"`
+	IsSet     bool      `json:"isSet,omitempty"`
+	Symlink   string    `json:"symlink,omitempty"`
+	ModTime   time.Time `json:"modTime,omitempty"`
+}
+
+// offlineCacheListing is OfflineCachePath's on-disk JSON content for
+// one search expression.
+type offlineCacheListing struct {
+	SavedAt time.Time                    `json:"savedAt"`
+	Names   []string                     `json:"names"`
+	Entries map[string]offlineCacheEntry `json:"entries"`
+}
+
+// offlineCacheFile returns the path OfflineCachePath stores expr's
+// listing under: a hash of expr, so an arbitrary search expression
+// (which can contain characters a filename can't) always maps to a
+// safe, stable filename.
+func offlineCacheFile(fsys *CamliFileSystem, expr string) string {
+	h := fnv.New64a()
+	h.Write([]byte(expr))
+	return filepath.Join(fsys.OfflineCachePath, fmt.Sprintf("%x.json", h.Sum64()))
+}
+
+// saveOfflineCache persists n's just-completed successful listing to
+// OfflineCachePath, for a later doReaddir to fall back to if a live
+// query fails. It's a best-effort write: a failure is logged and
+// otherwise ignored, the same way seedSinceToken's own failures are.
+func (n *searchResultDir) saveOfflineCache(names []string, permanode map[string]blob.Ref, sets map[string]dir.Entry, symlinks map[string]string, modTime map[string]time.Time) {
+	if n.fs.OfflineCachePath == "" {
+		return
+	}
+	listing := offlineCacheListing{
+		SavedAt: time.Now(),
+		Names:   names,
+		Entries: make(map[string]offlineCacheEntry, len(names)),
+	}
+	for _, name := range names {
+		e := offlineCacheEntry{ModTime: modTime[name]}
+		if pn, ok := permanode[name]; ok {
+			e.Permanode = pn.String()
+		}
+		if _, ok := sets[name]; ok {
+			e.IsSet = true
+		}
+		if target, ok := symlinks[name]; ok {
+			e.Symlink = target
+		}
+		listing.Entries[name] = e
+	}
+	data, err := json.Marshal(listing)
+	if err != nil {
+		Logger.Printf("fs.search: OfflineCachePath: marshaling listing for %q: %v", n.searchExp, err)
+		return
+	}
+	if err := os.MkdirAll(n.fs.OfflineCachePath, 0700); err != nil {
+		Logger.Printf("fs.search: OfflineCachePath: %v", err)
+		return
+	}
+	if err := os.WriteFile(offlineCacheFile(n.fs, n.effectiveSearchExpr()), data, 0600); err != nil {
+		Logger.Printf("fs.search: OfflineCachePath: writing cache for %q: %v", n.searchExp, err)
+	}
+}
+
+// loadOfflineCache reads back n's most recent cached listing, if
+// OfflineCachePath is set, the file exists, and it's not older than
+// effectiveOfflineCacheMaxAge. ok is false in every other case,
+// leaving the caller to report the live query's own error instead.
+func (n *searchResultDir) loadOfflineCache() (listing offlineCacheListing, ok bool) {
+	if n.fs.OfflineCachePath == "" {
+		return offlineCacheListing{}, false
+	}
+	data, err := os.ReadFile(offlineCacheFile(n.fs, n.effectiveSearchExpr()))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Logger.Printf("fs.search: OfflineCachePath: reading cache for %q: %v", n.searchExp, err)
+		}
+		return offlineCacheListing{}, false
+	}
+	if err := json.Unmarshal(data, &listing); err != nil {
+		Logger.Printf("fs.search: OfflineCachePath: parsing cache for %q: %v", n.searchExp, err)
+		return offlineCacheListing{}, false
+	}
+	if time.Since(listing.SavedAt) > n.fs.effectiveOfflineCacheMaxAge() {
+		Logger.Printf("fs.search: OfflineCachePath: cache for %q is older than %v, not serving it", n.searchExp, n.fs.effectiveOfflineCacheMaxAge())
+		return offlineCacheListing{}, false
+	}
+	return listing, true
+}
+
+// applyOfflineCacheListing installs listing as n's current listing,
+// the same fields doReaddir's own success path sets, minus everything
+// that needs describe metadata a cached listing doesn't carry (ents,
+// pnodeMeta, imageMeta, and the rest default empty/nil; Lookup of a
+// name from a stale listing still works for directory-structure
+// purposes via n.permanode/n.sets/n.symlinks, but opening a file's
+// content still requires a live query, exactly as the doc comment on
+// OfflineCachePath says). It must be called with n.mu held.
+func (n *searchResultDir) applyOfflineCacheListing(listing offlineCacheListing) {
+	permanode := make(map[string]blob.Ref, len(listing.Entries))
+	sets := make(map[string]dir.Entry, len(listing.Entries))
+	symlinks := make(map[string]string, len(listing.Entries))
+	modTime := make(map[string]time.Time, len(listing.Entries))
+	for name, e := range listing.Entries {
+		if e.Permanode != "" {
+			if pn, ok := blob.Parse(e.Permanode); ok {
+				permanode[name] = pn
+				if e.IsSet {
+					sets[name] = dir.Entry{Name: name, Permanode: pn}
+				}
+			}
+		}
+		if e.Symlink != "" {
+			symlinks[name] = e.Symlink
+		}
+		modTime[name] = e.ModTime
+	}
+	n.ents = nil
+	n.permanode = permanode
+	n.pnodeMeta = nil
+	n.imageMeta = nil
+	n.sets = sets
+	n.symlinks = symlinks
+	n.contentless = nil
+	n.placeholders = nil
+	n.camliPaths = nil
+	n.collisionSubdirs = nil
+	n.originalNames = nil
+	n.modTime = modTime
+	n.negLookup = nil
+	n.schemaMeta = nil
+	n.lastNames = append(append([]string{}, listing.Names...), staleMarkerName)
+	n.lastFatalError = fmt.Sprintf("serving a cached listing from %v (offline since a live query failed)\n", listing.SavedAt.Format(time.RFC3339))
+	n.lastReaddir = time.Now()
+}
+
+// hasStaleMarker reports whether n's last ReadDirAll served a cached,
+// offline listing rather than a fresh one.
+func (n *searchResultDir) hasStaleMarker() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, name := range n.lastNames {
+		if name == staleMarkerName {
+			return true
+		}
+	}
+	return false
+}
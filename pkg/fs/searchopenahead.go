@@ -0,0 +1,73 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+)
+
+// warmOpenAhead starts fetching, through the shared blob cache, the
+// content schema blob of each of n.parent's next n.fs.OpenAheadCount
+// entries after n.name in its most recent listing order; it's a
+// no-op when OpenAheadCount isn't set or n has no parent entry to
+// find its own position in (e.g. searchCreateHandle's brand-new
+// file). It must be called in its own goroutine: the fetches it
+// starts are meant to race ahead of, not block, the Open that
+// triggered them.
+func (n *searchResultFile) warmOpenAhead() {
+	if n.fs.OpenAheadCount <= 0 || n.parent == nil || n.name == "" {
+		return
+	}
+	parent := n.parent
+	parent.mu.Lock()
+	names := parent.lastNames
+	idx := -1
+	for i, name := range names {
+		if name == n.name {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		parent.mu.Unlock()
+		return
+	}
+	end := idx + 1 + n.fs.OpenAheadCount
+	if end > len(names) {
+		end = len(names)
+	}
+	ahead := names[idx+1 : end]
+	refs := make([]blob.Ref, 0, len(ahead))
+	for _, name := range ahead {
+		if db := parent.ents[name]; db != nil && db.BlobRef.Valid() {
+			refs = append(refs, db.BlobRef)
+		}
+	}
+	parent.mu.Unlock()
+
+	ctx := context.Background()
+	for _, ref := range refs {
+		if _, err := schema.NewFileReader(ctx, cachingFetcher{fsys: n.fs, next: n.fs.client}, ref); err != nil {
+			Logger.Printf("fs.searchResultFile: warmOpenAhead(%q): %v: %v", n.name, ref, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+)
+
+// OpenContentPolicy controls what an already-open searchResultFile
+// handle does when its directory later refreshes and finds that the
+// entry's camliContent has changed underneath it, e.g. something other
+// than this mount repointed the permanode at new content while a
+// rangedFileHandle from an earlier Open is still around.
+type OpenContentPolicy int
+
+const (
+	// OpenContentStable, the zero value and default, pins an open
+	// handle to the content blobref it resolved at Open time for as
+	// long as that handle stays open, the same as a POSIX file
+	// descriptor surviving an unlink-and-replace on the underlying
+	// name: Attr may go on to report a newer modtime than the bytes
+	// Read is still serving, but a read in progress (or a seek within
+	// one) never jumps to unrelated content mid-stream. The tradeoff
+	// is staleness: a long-lived handle, such as a media player left
+	// open and paused, can keep serving content the directory listing
+	// no longer points to.
+	OpenContentStable OpenContentPolicy = iota
+	// OpenContentFresh has a handle re-check its entry's current
+	// content blobref before each Read, transparently reopening
+	// against the new one (and discarding its readahead cache) if it's
+	// changed since Open or the last Read. The tradeoff is surprise: a
+	// reader partway through a file can have the rest of its bytes
+	// swapped out from under it with no boundary marker of any kind,
+	// which suits an "always serve whatever this name currently points
+	// to" use but is wrong for anything that needs a consistent
+	// snapshot for the life of the handle.
+	OpenContentFresh
+)
+
+// currentContentBlobrefLocked reports name's content blobref as of n's
+// most recent seed, the same lookup entryStillPresent does, for a
+// freshContentHandle to compare against the blobref it opened with. It
+// must be called with n.mu held.
+func (n *searchResultDir) currentContentBlobrefLocked(name string) (blob.Ref, bool) {
+	db, ok := n.ents[name]
+	if !ok {
+		return blob.Ref{}, false
+	}
+	return db.BlobRef, true
+}
+
+// freshContentHandle wraps a rangedFileHandle for a searchResultFile
+// opened under OpenContentFresh, re-resolving parent/name's current
+// content blobref before each Read and swapping in a freshly opened
+// rangedFileHandle when it's changed. It's only constructed when
+// parent and name are both set, i.e. never for a searchCreateHandle's
+// brand-new file, which has no directory entry to re-check against.
+type freshContentHandle struct {
+	parent *searchResultDir
+	name   string
+	fsys   *CamliFileSystem
+
+	mu    sync.Mutex
+	inner *rangedFileHandle
+}
+
+var (
+	_ fs.Handle         = (*freshContentHandle)(nil)
+	_ fs.HandleReader   = (*freshContentHandle)(nil)
+	_ fs.HandleReleaser = (*freshContentHandle)(nil)
+)
+
+// Read implements fs.HandleReader, swapping h.inner for a freshly
+// opened rangedFileHandle against name's current content blobref
+// before serving req, if that blobref has changed since h.inner was
+// opened. A failed reopen (the new content hasn't synced to the
+// blobserver yet, say) is logged and falls back to serving req out of
+// the stale handle rather than failing the read outright.
+func (h *freshContentHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	h.mu.Lock()
+	cur := h.inner
+	h.mu.Unlock()
+
+	h.parent.mu.Lock()
+	blobref, ok := h.parent.currentContentBlobrefLocked(h.name)
+	h.parent.mu.Unlock()
+	if ok && blobref.Valid() && blobref != cur.blobref {
+		fr, err := schema.NewFileReader(ctx, cachingFetcher{fsys: h.fsys, next: h.fsys.client}, blobref)
+		if err != nil {
+			Logger.Printf("fs.searchResultFile: OpenContentFresh reopen of %v for %q: %v; continuing with stale content", blobref, h.name, err)
+		} else {
+			cur.Release(ctx, nil)
+			cur = &rangedFileHandle{fr: fr, blobref: blobref, fs: h.fsys, window: cur.window}
+			h.mu.Lock()
+			h.inner = cur
+			h.mu.Unlock()
+		}
+	}
+	return cur.Read(ctx, req, resp)
+}
+
+// Release implements fs.HandleReleaser, closing whichever
+// rangedFileHandle h currently holds.
+func (h *freshContentHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.inner.Release(ctx, req)
+}
@@ -0,0 +1,45 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"strings"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// TestCurrentContentBlobrefLocked checks that it reports the blobref
+// n.ents currently holds for name, and false for a name with no entry.
+func TestCurrentContentBlobrefLocked(t *testing.T) {
+	ref := blob.MustParse("sha224-" + strings.Repeat("b", 56))
+	n := &searchResultDir{
+		ents: map[string]*search.DescribedBlob{
+			"a": {BlobRef: ref},
+		},
+	}
+	got, ok := n.currentContentBlobrefLocked("a")
+	if !ok || got != ref {
+		t.Errorf("currentContentBlobrefLocked(%q) = (%v, %v); want (%v, true)", "a", got, ok, ref)
+	}
+	if _, ok := n.currentContentBlobrefLocked("missing"); ok {
+		t.Errorf("currentContentBlobrefLocked(%q) ok = true; want false", "missing")
+	}
+}
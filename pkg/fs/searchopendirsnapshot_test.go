@@ -0,0 +1,67 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// TestOpenHandleKeepsOriginalSnapshot checks that a searchResultDirHandle
+// from Open keeps serving the listing as it was at open time, even
+// after a concurrent refresh replaces n.lastNames: the handle's own
+// ReadDirAll must see neither the shifted names nor a repeat, just
+// the frozen ents it was constructed with.
+func TestOpenHandleKeepsOriginalSnapshot(t *testing.T) {
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{},
+		searchExp: "is:file",
+		at:        nil,
+		lastNames: []string{"a.jpg", "b.jpg"},
+	}
+	n.inflight = &readdirCall{} // makes haveCachedListing irrelevant: ReadDirAll reuses this finished call
+	h, err := n.Open(context.Background(), &fuse.OpenRequest{}, &fuse.OpenResponse{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// Simulate a refresh landing after Open but before this handle's
+	// own ReadDirAll is consulted again.
+	n.mu.Lock()
+	n.lastNames = []string{"c.jpg", "d.jpg", "e.jpg"}
+	n.lastReaddir = time.Now()
+	n.mu.Unlock()
+
+	got, err := h.(fs.HandleReadDirAller).ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatalf("handle ReadDirAll() error = %v", err)
+	}
+	var names []string
+	for _, d := range got {
+		names = append(names, d.Name)
+	}
+	if want := []string{"a.jpg", "b.jpg"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("handle ReadDirAll() after a concurrent refresh = %v; want unchanged %v", names, want)
+	}
+}
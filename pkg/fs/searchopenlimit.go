@@ -0,0 +1,152 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// OpenFilesOverLimitPolicy selects what a searchResultFile.Open call
+// past CamliFileSystem.MaxOpenFiles does.
+type OpenFilesOverLimitPolicy int
+
+const (
+	// OpenFilesBlock waits, respecting ctx, for an earlier open
+	// handle's Release to free a slot, the same way queryLimiter's
+	// acquire already blocks a doReaddir past QueryConcurrency. The
+	// zero value, so a mount that sets MaxOpenFiles without also
+	// setting OpenFilesOverLimit gets the less surprising of the two
+	// behaviors.
+	OpenFilesBlock OpenFilesOverLimitPolicy = iota
+
+	// OpenFilesReject fails an Open past the limit immediately with
+	// fuse.ENFILE instead of waiting for one.
+	OpenFilesReject
+)
+
+// openFileLimiter bounds how many searchResultFile handles one mount
+// has open at once, a counting semaphore over file handles the same
+// way queryLimiter is one over in-flight queries.
+type openFileLimiter struct {
+	slots chan struct{}
+}
+
+func newOpenFileLimiter(limit int) *openFileLimiter {
+	return &openFileLimiter{slots: make(chan struct{}, limit)}
+}
+
+// openFileLimiters holds each CamliFileSystem's openFileLimiter, keyed
+// by pointer identity the same way queryLimiters is.
+var (
+	openFileLimitersMu sync.Mutex
+	openFileLimiters   = map[*CamliFileSystem]*openFileLimiter{}
+)
+
+// openFileLimiterFor returns fsys's openFileLimiter, creating it from
+// fsys.MaxOpenFiles on first use, or nil if MaxOpenFiles is unset, in
+// which case the caller should skip limiting (and the bookkeeping
+// that comes with it) entirely.
+func openFileLimiterFor(fsys *CamliFileSystem) *openFileLimiter {
+	if fsys.MaxOpenFiles <= 0 {
+		return nil
+	}
+	openFileLimitersMu.Lock()
+	defer openFileLimitersMu.Unlock()
+	l, ok := openFileLimiters[fsys]
+	if !ok {
+		l = newOpenFileLimiter(fsys.MaxOpenFiles)
+		openFileLimiters[fsys] = l
+	}
+	return l
+}
+
+// acquire claims one of l's slots per policy: it blocks until a slot
+// frees or ctx is done (OpenFilesBlock), or fails immediately with
+// fuse.ENFILE if none is free (OpenFilesReject). On success the
+// caller owns the slot and must call release exactly once; on error
+// there's no slot to release.
+func (l *openFileLimiter) acquire(ctx context.Context, policy OpenFilesOverLimitPolicy) error {
+	if policy == OpenFilesReject {
+		select {
+		case l.slots <- struct{}{}:
+			return nil
+		default:
+			return fuse.Errno(syscall.ENFILE)
+		}
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fuse.EINTR
+	}
+}
+
+// release frees the slot a prior successful acquire claimed.
+func (l *openFileLimiter) release() {
+	<-l.slots
+}
+
+// openCapHandle wraps the fs.Handle a searchResultFile.Open call
+// returns so that its eventual Release frees the slot acquire
+// claimed, regardless of which concrete handle type backs it. It
+// composes fine alongside openRefHandle, which wraps the same handle
+// for an unrelated reason (pinning its parent directory against cache
+// eviction): each wrapper's Release only ever touches its own
+// bookkeeping before forwarding to inner.
+type openCapHandle struct {
+	inner   fs.Handle
+	limiter *openFileLimiter
+}
+
+var (
+	_ fs.Handle         = (*openCapHandle)(nil)
+	_ fs.HandleReader   = (*openCapHandle)(nil)
+	_ fs.HandleWriter   = (*openCapHandle)(nil)
+	_ fs.HandleReleaser = (*openCapHandle)(nil)
+)
+
+func (h *openCapHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	r, ok := h.inner.(fs.HandleReader)
+	if !ok {
+		return fuse.Errno(syscall.ENOSYS)
+	}
+	return r.Read(ctx, req, resp)
+}
+
+func (h *openCapHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	w, ok := h.inner.(fs.HandleWriter)
+	if !ok {
+		return fuse.Errno(syscall.ENOSYS)
+	}
+	return w.Write(ctx, req, resp)
+}
+
+func (h *openCapHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.limiter.release()
+	if r, ok := h.inner.(fs.HandleReleaser); ok {
+		return r.Release(ctx, req)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// addOpenRef records one more live open of a file under n, pinning n
+// against searchDirCache eviction (see hasOpenRefs) until the
+// matching openRefHandle.Release calls releaseOpenRef.
+func (n *searchResultDir) addOpenRef() {
+	n.mu.Lock()
+	n.openRefs++
+	n.mu.Unlock()
+}
+
+// releaseOpenRef undoes a prior addOpenRef.
+func (n *searchResultDir) releaseOpenRef() {
+	n.mu.Lock()
+	n.openRefs--
+	n.mu.Unlock()
+}
+
+// hasOpenRefs reports whether n currently has any live open
+// descendants, for searchDirCache.evictOldest to check before
+// dropping n: evicting n out from under an open file would leave that
+// file's reads resolving against a node no longer reachable from its
+// parent's cache, and a subsequent unrelated lookup of the same
+// search expression would rebuild a fresh n instead of finding the
+// one still backing the open file.
+func (n *searchResultDir) hasOpenRefs() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.openRefs > 0
+}
+
+// openRefHandle wraps the fs.Handle a searchResultFile.Open call
+// returns so that its eventual Release decrements dir's open
+// refcount, regardless of which concrete handle type (rangedFileHandle
+// for existing content, or the promoted node.Open handle for a file
+// still being written) backs it. It forwards Read, Write, and Release
+// to inner exactly when inner itself supports them; a handle that
+// doesn't implement, say, fs.HandleWriter behaves the same wrapped as
+// unwrapped, since bazil.org/fuse's own dispatch rejects the operation
+// with ENOSYS either way.
+type openRefHandle struct {
+	inner fs.Handle
+	dir   *searchResultDir
+}
+
+var (
+	_ fs.Handle         = (*openRefHandle)(nil)
+	_ fs.HandleReader   = (*openRefHandle)(nil)
+	_ fs.HandleWriter   = (*openRefHandle)(nil)
+	_ fs.HandleReleaser = (*openRefHandle)(nil)
+)
+
+func (h *openRefHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	r, ok := h.inner.(fs.HandleReader)
+	if !ok {
+		return fuse.Errno(syscall.ENOSYS)
+	}
+	return r.Read(ctx, req, resp)
+}
+
+func (h *openRefHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	w, ok := h.inner.(fs.HandleWriter)
+	if !ok {
+		return fuse.Errno(syscall.ENOSYS)
+	}
+	return w.Write(ctx, req, resp)
+}
+
+// Release implements fs.HandleReleaser: it always decrements dir's
+// open refcount, then forwards to inner's own Release, if it has one,
+// for whatever cleanup (closing a schema.FileReader, uploading a
+// buffered write) that handle still needs.
+func (h *openRefHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.dir.releaseOpenRef()
+	if r, ok := h.inner.(fs.HandleReleaser); ok {
+		return r.Release(ctx, req)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchDirOptionsSep is the character separating a searchDir.Lookup
+// name's search expression from its per-directory mount options, e.g.
+// "is:image#limit=500&sort=-modtime". It's "#" rather than "?" because
+// a search expression can validly contain "?" (e.g. a regex attr
+// value) but, like a shell wouldn't expect to need to escape it for a
+// URL fragment, never needs to contain "#".
+const searchDirOptionsSep = "#"
+
+// searchDirOptions holds the per-searchResultDir overrides parsed from
+// a Lookup name's searchDirOptionsSep suffix (see splitSearchOptions),
+// each overriding the like-named CamliFileSystem field for that one
+// directory alone.
+type searchDirOptions struct {
+	limit *int
+	sort  *SearchSortBy
+	ttl   *time.Duration
+	owner *string
+}
+
+// splitSearchOptions splits name into its search expression and
+// options, parsing anything after searchDirOptionsSep as a URL query
+// string: e.g. "is:image#limit=500&sort=-created" caps that directory
+// at 500 entries, newest first, regardless of CamliFileSystem.MaxResults
+// and SearchSortBy. "owner=<ref>" scopes that directory to content
+// signed by ref, regardless of CamliFileSystem.Owner; see
+// effectiveOwner. name with no searchDirOptionsSep is returned
+// unchanged with a zero searchDirOptions. A key url.ParseQuery can't
+// parse, an unrecognized key, or a value one of the recognized keys
+// can't parse is reported as an error, so Lookup can turn a typo into
+// fuse.EINVAL instead of silently ignoring it.
+func splitSearchOptions(name string) (expr string, opts searchDirOptions, err error) {
+	expr, frag, ok := strings.Cut(name, searchDirOptionsSep)
+	if !ok {
+		return name, opts, nil
+	}
+	values, err := url.ParseQuery(frag)
+	if err != nil {
+		return "", searchDirOptions{}, fmt.Errorf("parsing options %q: %v", frag, err)
+	}
+	for key, vals := range values {
+		val := vals[len(vals)-1]
+		switch key {
+		case "limit":
+			limit, err := strconv.Atoi(val)
+			if err != nil || limit <= 0 {
+				return "", searchDirOptions{}, fmt.Errorf("invalid limit %q", val)
+			}
+			opts.limit = &limit
+		case "sort":
+			sortBy, ok := sortKeys[val]
+			if !ok {
+				return "", searchDirOptions{}, fmt.Errorf("invalid sort %q", val)
+			}
+			opts.sort = &sortBy
+		case "ttl":
+			ttl, err := time.ParseDuration(val)
+			if err != nil || ttl < 0 {
+				return "", searchDirOptions{}, fmt.Errorf("invalid ttl %q", val)
+			}
+			opts.ttl = &ttl
+		case "owner":
+			if val == "" {
+				return "", searchDirOptions{}, fmt.Errorf("invalid owner %q", val)
+			}
+			opts.owner = &val
+		default:
+			return "", searchDirOptions{}, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return expr, opts, nil
+}
+
+// applyTo sets d's per-directory overrides from o's non-nil fields,
+// leaving d's existing (zero) values for any option name didn't
+// specify.
+func (o searchDirOptions) applyTo(d *searchResultDir) {
+	if o.limit != nil {
+		d.resultCapOverride = o.limit
+	}
+	if o.sort != nil {
+		d.sortOverride = o.sort
+	}
+	if o.ttl != nil {
+		d.ttlOverride = o.ttl
+	}
+	if o.owner != nil {
+		d.ownerOverride = o.owner
+	}
+}
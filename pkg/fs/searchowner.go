@@ -0,0 +1,40 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "os"
+
+// effectiveUid returns fs.Uid if set, or the mounting process's own
+// os.Getuid() otherwise. Every node's Attr method should call this
+// instead of os.Getuid() directly, so the override in fs.Uid is
+// honored consistently across the whole mount.
+func (fs *CamliFileSystem) effectiveUid() uint32 {
+	if fs.Uid != nil {
+		return *fs.Uid
+	}
+	return uint32(os.Getuid())
+}
+
+// effectiveGid is effectiveUid's group analogue.
+func (fs *CamliFileSystem) effectiveGid() uint32 {
+	if fs.Gid != nil {
+		return *fs.Gid
+	}
+	return uint32(os.Getgid())
+}
@@ -0,0 +1,52 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// effectiveOwner returns n's owner scope: n.ownerOverride if a
+// searchDirOptions "owner" key set one, else n.fs.Owner, else "" for
+// no scoping.
+func (n *searchResultDir) effectiveOwner() string {
+	if n.ownerOverride != nil {
+		return *n.ownerOverride
+	}
+	return n.fs.Owner
+}
+
+// effectiveSearchExpr is n.searchExp with any inline "sort:" token
+// (see parseInlineSort) and "size>"/"size<" token (see parseSizeFilter)
+// stripped out, and effectiveOwner ANDed in as an "owner:<ref>" term,
+// when one applies. Every query n issues should build its expression
+// from this instead of n.searchExp directly, so the owner scope, once
+// configured, is never accidentally dropped from a request to the
+// server, and a "sort:" or "size>"/"size<" token never leaks into it
+// as if it were a literal search term.
+func (n *searchResultDir) effectiveSearchExpr() string {
+	expr := n.searchExp
+	if trimmed, _, found, err := parseInlineSort(expr); found && err == nil {
+		expr = trimmed
+	}
+	if trimmed, _, _, found, err := parseSizeFilter(expr); found && err == nil {
+		expr = trimmed
+	}
+	owner := n.effectiveOwner()
+	if owner == "" {
+		return expr
+	}
+	return expr + " owner:" + owner
+}
@@ -0,0 +1,220 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// pageDirPrefix is the reserved name prefix a page dir's number
+// follows directly, with no separator, e.g. "page1", "page12".
+const pageDirPrefix = "page"
+
+// parsePageDirName reports the 1-indexed page number name requests,
+// if name is pageDirPrefix followed by nothing but decimal digits
+// forming a number >= 1. "page0", "page01", and "page-1" all miss, the
+// same way this package's other numeric suffixes (e.g. deletedSuffix's
+// disambiguating "-<blobref>") don't try to normalize non-canonical
+// spellings.
+func parsePageDirName(name string) (page int, ok bool) {
+	digits := strings.TrimPrefix(name, pageDirPrefix)
+	if digits == name || digits == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 1 || strconv.Itoa(n) != digits {
+		return 0, false
+	}
+	return n, true
+}
+
+// pageCursor is the precise resume point for one page dir's window:
+// the continue token ResolvePage returned for the underlying network
+// page it starts in, and how many of that page's own entries to skip
+// before collecting the window, for the handful that were already
+// shown (or consumed by an earlier page dir) from the same network
+// page. It's what lets a page dir's window start exactly where the
+// previous one (or the main listing's own cap) left off, with no gap
+// or repeat.
+type pageCursor struct {
+	cont string
+	skip int
+}
+
+// pageDirNames returns the currently-known page dir names ("page1",
+// "page2", ...) for n's last listing, for ReadDirAll to append
+// alongside its ordinary entries. It must be called with n.mu held.
+func (n *searchResultDir) pageDirNames() []string {
+	if !n.fs.EnablePaging || len(n.pageCursors) == 0 {
+		return nil
+	}
+	names := make([]string, len(n.pageCursors))
+	for i := range n.pageCursors {
+		names[i] = fmt.Sprintf("%s%d", pageDirPrefix, i+1)
+	}
+	return names
+}
+
+// fetchPageWindow collects up to windowSize entries starting at start,
+// paging through as many underlying dir.ResolvePage calls against q as
+// it takes to fill the window (or run out of results), the same way
+// doReaddir's own "truncate:" loop pages through ResolvePageSize-sized
+// network pages to fill effectiveResultCap. next is the pageCursor the
+// following page dir should resume from, or nil if start's results
+// end within this window.
+//
+// q is taken as an explicit parameter, rather than read off n.fs.client
+// itself, so this is testable against a fake Querier directly; see
+// (*searchPageDir).resolve, its only real caller.
+func fetchPageWindow(ctx context.Context, n *searchResultDir, q dir.Querier, windowSize int, start pageCursor) (ents []dir.Entry, next *pageCursor, err error) {
+	depth := n.fs.effectiveSearchDescribeDepth()
+	cont := start.cont
+	skip := start.skip
+	seen := make(map[string]bool)
+	for {
+		dents, nextCont, _, _, _, _, _, _, _, ferr := dir.ResolvePage(ctx, q, n.effectiveSearchExpr(), n.at, cont, seen, depth, n.effectiveDescribeRules(), search.UnspecifiedSort, n.fs.NameAttribute, n.fs.GroupByAttribute, n.fs.MIMEPreference, n.fs.effectiveContentIndirectionHops(), n.fs.IncludeContentless, n.fs.effectiveUndescribedContentPolicy(), n.fs.effectiveDescribeStrategy(), 0, n.fs.PrimaryContentAttr, n.fs.effectiveMaxInlineSetMembers(), n.fs.ContentAttrAliases, n.fs.TitleAttrAliases, n.fs.effectiveSpecialContentPolicy())
+		if ferr != nil {
+			return nil, nil, ferr
+		}
+		for i := skip; i < len(dents); i++ {
+			if len(ents) >= windowSize {
+				return ents, &pageCursor{cont: cont, skip: i}, nil
+			}
+			ents = append(ents, dents[i])
+		}
+		skip = 0
+		if nextCont == "" {
+			return ents, nil, nil
+		}
+		cont = nextCont
+	}
+}
+
+// searchPageDir is one "pageN" subdirectory under a searchResultDir
+// whose last listing was truncated; see CamliFileSystem.EnablePaging.
+type searchPageDir struct {
+	parent *searchResultDir
+	page   int
+
+	mu       sync.Mutex
+	resolved map[string]dir.Entry // filled in lazily by resolve
+}
+
+var (
+	_ fs.Node               = (*searchPageDir)(nil)
+	_ fs.HandleReadDirAller = (*searchPageDir)(nil)
+	_ fs.NodeStringLookuper = (*searchPageDir)(nil)
+)
+
+func (n *searchPageDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = n.parent.fs.effectiveAttrValidity()
+	a.Uid = n.parent.fs.effectiveUid()
+	a.Gid = n.parent.fs.effectiveGid()
+	return nil
+}
+
+// resolve fetches n's window the first time n is actually opened,
+// caching it for the rest of n's lifetime: like searchMemberDir,
+// a searchPageDir instance is resolved at most once. If it discovers
+// there's more beyond its own window, it extends n.parent.pageCursors
+// so the next page dir becomes listable.
+func (n *searchPageDir) resolve(ctx context.Context) (map[string]dir.Entry, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.resolved != nil {
+		return n.resolved, nil
+	}
+
+	parent := n.parent
+	parent.mu.Lock()
+	if n.page < 1 || n.page > len(parent.pageCursors) {
+		parent.mu.Unlock()
+		return nil, fuse.ENOENT
+	}
+	start := parent.pageCursors[n.page-1]
+	parent.mu.Unlock()
+
+	ents, next, err := fetchPageWindow(ctx, parent, parent.fs.client, parent.effectiveResultCap(), start)
+	if err != nil {
+		Logger.Printf("fs.searchPageDir: fetching %s%d for '%s': %v", pageDirPrefix, n.page, parent.searchExp, err)
+		return nil, fuse.EIO
+	}
+
+	resolved := make(map[string]dir.Entry, len(ents))
+	for _, e := range ents {
+		name := e.Name
+		for i := 2; ; i++ {
+			if _, taken := resolved[name]; !taken {
+				break
+			}
+			name = fmt.Sprintf("%s.%d", e.Name, i)
+		}
+		resolved[name] = e
+	}
+	n.resolved = resolved
+
+	if next != nil {
+		parent.mu.Lock()
+		if n.page == len(parent.pageCursors) {
+			parent.pageCursors = append(parent.pageCursors, *next)
+		}
+		parent.mu.Unlock()
+	}
+	return resolved, nil
+}
+
+func (n *searchPageDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	resolved, err := n.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(resolved))
+	refs := make(map[string]blob.Ref, len(resolved))
+	kinds := make(map[string]fuse.DirentType, len(resolved))
+	for name, e := range resolved {
+		names = append(names, name)
+		refs[name] = e.Permanode
+		kinds[name] = memberDirentKind(n.parent.fs, e)
+	}
+	return direntsWithInode(n.parent.fs, names, refs, kinds), nil
+}
+
+func (n *searchPageDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	resolved, err := n.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := resolved[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return entryNode(n.parent.fs, e, n.parent.at), nil
+}
@@ -0,0 +1,191 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+func TestParsePageDirName(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantPage int
+		wantOK   bool
+	}{
+		{"page1", 1, true},
+		{"page2", 2, true},
+		{"page12", 12, true},
+		{"page0", 0, false},
+		{"page01", 0, false},
+		{"page-1", 0, false},
+		{"page", 0, false},
+		{"pages1", 0, false},
+		{"Page1", 0, false},
+	}
+	for _, tt := range tests {
+		page, ok := parsePageDirName(tt.name)
+		if page != tt.wantPage || ok != tt.wantOK {
+			t.Errorf("parsePageDirName(%q) = %d, %v; want %d, %v", tt.name, page, ok, tt.wantPage, tt.wantOK)
+		}
+	}
+}
+
+// pagedFileQuerier serves a fixed sequence of one-permanode pages keyed
+// by the incoming request's Continue token, each permanode's
+// camliContent resolving to a named file, so fetchPageWindow has
+// something to turn into a named dir.Entry rather than just a degraded
+// blobref. It mirrors pkg/search/dir/dir_test.go's own pagedQuerier and
+// ruleAwareQuerier fixtures.
+type pagedFileQuerier struct {
+	pages map[string]*search.SearchResult
+}
+
+func (q pagedFileQuerier) Query(ctx context.Context, req *search.SearchQuery) (*search.SearchResult, error) {
+	return q.pages[req.Continue], nil
+}
+
+func pagedFileResult(pn, file blob.Ref, fileName, next string) *search.SearchResult {
+	return &search.SearchResult{
+		Blobs: []*search.SearchResultBlob{{Blob: pn}},
+		Describe: &search.DescribeResponse{
+			Meta: search.MetaMap{
+				pn:   {BlobRef: pn, Permanode: &search.Permanode{Attr: url.Values{"camliContent": {file.String()}}}},
+				file: {BlobRef: file, File: &search.DescribedFile{FileName: fileName}},
+			},
+		},
+		Continue: next,
+	}
+}
+
+// threePageQuerier returns a pagedFileQuerier serving exactly three
+// one-entry pages, named "page1.txt", "page2.txt", "page3.txt", for
+// TestFetchPageWindowNavigatesThreePages and
+// TestSearchPageDirResolveOutOfRange to walk.
+func threePageQuerier() pagedFileQuerier {
+	pn1 := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	f1 := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111112")
+	pn2 := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222221")
+	f2 := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+	pn3 := blob.MustParse("sha224-3333333333333333333333333333333333333333333333333333333333333331")
+	f3 := blob.MustParse("sha224-3333333333333333333333333333333333333333333333333333333333333332")
+	return pagedFileQuerier{pages: map[string]*search.SearchResult{
+		"":      pagedFileResult(pn1, f1, "page1.txt", "p2"),
+		"p2":    pagedFileResult(pn2, f2, "page2.txt", "p3"),
+		"p3":    pagedFileResult(pn3, f3, "page3.txt", ""),
+	}}
+}
+
+// TestFetchPageWindowNavigatesThreePages walks a three-page fake result
+// set one window at a time, the way searchPageDir.resolve chains
+// fetchPageWindow calls across "pageN" directories, and checks that
+// each window holds exactly the one entry its page should and that the
+// cursor handed back resumes exactly where the next page starts.
+func TestFetchPageWindowNavigatesThreePages(t *testing.T) {
+	q := threePageQuerier()
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image"}
+
+	ents1, next1, err := fetchPageWindow(context.Background(), n, q, 1, pageCursor{})
+	if err != nil {
+		t.Fatalf("page1: fetchPageWindow() error = %v", err)
+	}
+	if len(ents1) != 1 || ents1[0].Name != "page1.txt" {
+		t.Fatalf("page1 ents = %v; want one entry named page1.txt", ents1)
+	}
+	if next1 == nil || next1.cont != "p2" {
+		t.Fatalf("page1 next = %v; want cursor resuming at \"p2\"", next1)
+	}
+
+	ents2, next2, err := fetchPageWindow(context.Background(), n, q, 1, *next1)
+	if err != nil {
+		t.Fatalf("page2: fetchPageWindow() error = %v", err)
+	}
+	if len(ents2) != 1 || ents2[0].Name != "page2.txt" {
+		t.Fatalf("page2 ents = %v; want one entry named page2.txt", ents2)
+	}
+	if next2 == nil || next2.cont != "p3" {
+		t.Fatalf("page2 next = %v; want cursor resuming at \"p3\"", next2)
+	}
+
+	ents3, next3, err := fetchPageWindow(context.Background(), n, q, 1, *next2)
+	if err != nil {
+		t.Fatalf("page3: fetchPageWindow() error = %v", err)
+	}
+	if len(ents3) != 1 || ents3[0].Name != "page3.txt" {
+		t.Fatalf("page3 ents = %v; want one entry named page3.txt", ents3)
+	}
+	if next3 != nil {
+		t.Fatalf("page3 next = %v; want nil, the result set is exhausted", next3)
+	}
+}
+
+// TestSearchPageDirResolveOutOfRange checks that a page past the last
+// one n.parent currently knows about returns fuse.ENOENT before ever
+// touching a Querier, so it's safe to exercise against a searchPageDir
+// whose parent has a nil fs.client.
+func TestSearchPageDirResolveOutOfRange(t *testing.T) {
+	parent := &searchResultDir{
+		fs:          &CamliFileSystem{EnablePaging: true},
+		searchExp:   "is:image",
+		pageCursors: []pageCursor{{cont: "p2"}},
+	}
+	page := &searchPageDir{parent: parent, page: 2}
+	if _, err := page.resolve(context.Background()); err != fuse.ENOENT {
+		t.Errorf("resolve() error = %v; want fuse.ENOENT", err)
+	}
+}
+
+// TestSearchPageDirReadDirAllAndLookup exercises ReadDirAll and Lookup
+// against a searchPageDir whose window has already been resolved
+// (set directly, bypassing resolve/fetchPageWindow, so this never
+// touches n.parent.fs.client), checking that both surface the same
+// entries fetchPageWindow would have handed it.
+func TestSearchPageDirReadDirAllAndLookup(t *testing.T) {
+	file := blob.MustParse("sha224-4444444444444444444444444444444444444444444444444444444444444444")
+	pn := blob.MustParse("sha224-5555555555555555555555555555555555555555555555555555555555555555")
+	e := dir.Entry{Name: "page2.txt", Permanode: pn, Blob: &search.DescribedBlob{BlobRef: file, File: &search.DescribedFile{FileName: "page2.txt"}}}
+
+	parent := &searchResultDir{fs: &CamliFileSystem{EnablePaging: true}, searchExp: "is:image"}
+	page := &searchPageDir{parent: parent, page: 2, resolved: map[string]dir.Entry{"page2.txt": e}}
+
+	dents, err := page.ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatalf("ReadDirAll() error = %v", err)
+	}
+	if len(dents) != 1 || dents[0].Name != "page2.txt" {
+		t.Fatalf("ReadDirAll() = %v; want one dirent named page2.txt", dents)
+	}
+
+	if _, err := page.Lookup(context.Background(), "nonexistent.txt"); err != fuse.ENOENT {
+		t.Errorf("Lookup(nonexistent.txt) error = %v; want fuse.ENOENT", err)
+	}
+	node, err := page.Lookup(context.Background(), "page2.txt")
+	if err != nil {
+		t.Fatalf("Lookup(page2.txt) error = %v", err)
+	}
+	if node == nil {
+		t.Error("Lookup(page2.txt) returned a nil node")
+	}
+}
@@ -0,0 +1,115 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// byPeriodDirName is the reserved name of a searchResultDir's
+// auto-generated weekly drill-down, one subdirectory per week within
+// the window its own after:/before: terms already name. Unlike
+// byDateDirName (which buckets entries n has already fetched),
+// byPeriodDirName's children are built by childExprDir, the same
+// server-side narrowing drillDown uses, so entering one runs a fresh,
+// narrowed query rather than filtering results already in hand.
+const byPeriodDirName = "by-period"
+
+// absoluteDateTermRE matches an after:/before: term whose value is
+// already an absolute "YYYY-MM-DD" date, optionally quoted the way
+// the search server expects it. By the time a searchResultDir's own
+// searchExp is set, expandRelativeDates has already turned any
+// relative before:/after: term into this form (see search.go's
+// searchDir.Lookup), so this is the only shape byPeriodWindow needs
+// to recognize.
+var absoluteDateTermRE = regexp.MustCompile(`(before|after):"?(\d{4}-\d{2}-\d{2})"?`)
+
+// byPeriodWindow parses the [start, end) window named by expr's own
+// after:/before: terms, the one byPeriodDirName's weeks subdivide. ok
+// is false if expr doesn't pin down both ends, or the resulting window
+// is empty, in which case there's nothing to generate periods for.
+func byPeriodWindow(expr string) (start, end time.Time, ok bool) {
+	var hasStart, hasEnd bool
+	for _, m := range absoluteDateTermRE.FindAllStringSubmatch(expr, -1) {
+		t, err := time.Parse("2006-01-02", m[2])
+		if err != nil {
+			continue
+		}
+		switch m[1] {
+		case "after":
+			start, hasStart = t, true
+		case "before":
+			end, hasEnd = t, true
+		}
+	}
+	return start, end, hasStart && hasEnd && end.After(start)
+}
+
+// byPeriodDir lists and looks up the weeks within its parent's own
+// after:/before: window.
+type byPeriodDir struct {
+	parent     *searchResultDir
+	start, end time.Time
+}
+
+var (
+	_ fs.Node               = (*byPeriodDir)(nil)
+	_ fs.HandleReadDirAller = (*byPeriodDir)(nil)
+	_ fs.NodeStringLookuper = (*byPeriodDir)(nil)
+)
+
+func (d *byPeriodDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *byPeriodDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	var names []string
+	for t := d.start; t.Before(d.end); t = t.AddDate(0, 0, 7) {
+		names = append(names, t.Format("2006-01-02"))
+	}
+	return dirents(names, fuse.DT_Dir), nil
+}
+
+// Lookup takes a week's start date (as ReadDirAll names it) and
+// returns the parent's own searchExp ANDed with an after:/before:
+// pair narrowed to that week, clipped to d.end so the final, possibly
+// short week doesn't run past the parent's own window.
+func (d *byPeriodDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	t, err := time.Parse("2006-01-02", name)
+	if err != nil || t.Before(d.start) || !t.Before(d.end) {
+		return nil, fuse.ENOENT
+	}
+	weekEnd := t.AddDate(0, 0, 7)
+	if weekEnd.After(d.end) {
+		weekEnd = d.end
+	}
+	term := fmt.Sprintf(`after:%q before:%q`, t.Format("2006-01-02"), weekEnd.Format("2006-01-02"))
+	return d.parent.childExprDir(term), nil
+}
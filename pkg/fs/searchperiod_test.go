@@ -0,0 +1,80 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestByPeriodWindow is a regression test for byPeriodDirName's window
+// parsing: it must find both ends of an expression's after:/before:
+// terms regardless of quoting or surrounding predicates, and must
+// report ok=false when either end is missing or the window is empty.
+func TestByPeriodWindow(t *testing.T) {
+	tests := []struct {
+		expr               string
+		wantStart, wantEnd string
+		wantOK             bool
+	}{
+		{
+			expr:      `after:"2019-01-01" before:"2019-02-01"`,
+			wantStart: "2019-01-01", wantEnd: "2019-02-01",
+			wantOK: true,
+		},
+		{
+			expr:      `is:image after:2019-01-01 before:2019-02-01 tag:vacation`,
+			wantStart: "2019-01-01", wantEnd: "2019-02-01",
+			wantOK: true,
+		},
+		{
+			expr:   `after:"2019-02-01" before:"2019-01-01"`, // end before start
+			wantOK: false,
+		},
+		{
+			expr:   `after:"2019-01-01"`, // no before:
+			wantOK: false,
+		},
+		{
+			expr:   `is:image`,
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		start, end, ok := byPeriodWindow(tt.expr)
+		if ok != tt.wantOK {
+			t.Errorf("byPeriodWindow(%q) ok = %v; want %v", tt.expr, ok, tt.wantOK)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		wantStart, err := time.Parse("2006-01-02", tt.wantStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantEnd, err := time.Parse("2006-01-02", tt.wantEnd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !start.Equal(wantStart) || !end.Equal(wantEnd) {
+			t.Errorf("byPeriodWindow(%q) = (%v, %v); want (%v, %v)", tt.expr, start, end, wantStart, wantEnd)
+		}
+	}
+}
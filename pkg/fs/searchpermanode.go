@@ -0,0 +1,78 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+)
+
+// permanodeDirName is the "search" subdirectory whose children are
+// looked up by blobref directly (see permanodeDir.Lookup), for a
+// bookmarked object where "mount/search/permanode/<blobref>" reads
+// more clearly than either a search expression matching just it or
+// the bare "mount/search/<blobref>" shortcut searchDir.lookupBlobRef
+// already supports.
+const permanodeDirName = "permanode"
+
+// permanodeDir is the "search/permanode" directory: a pure lookup
+// table from blobref to that permanode's resolved content (a file, a
+// directory/set, or a symlink), with no listing of its own, the same
+// as atDir's README-only ReadDirAll but without even that, since
+// there's no way to enumerate "every permanode anyone might ask for"
+// usefully.
+type permanodeDir struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node               = (*permanodeDir)(nil)
+	_ fs.HandleReadDirAller = (*permanodeDir)(nil)
+	_ fs.NodeStringLookuper = (*permanodeDir)(nil)
+)
+
+func (n *permanodeDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+// ReadDirAll returns no entries: permanodeDir is reached only by
+// looking up a specific blobref, never by listing.
+func (n *permanodeDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return nil, nil
+}
+
+// Lookup resolves name as a blobref directly, the same way
+// searchDir.lookupBlobRef does for the bare "search/<blobref>"
+// shortcut. An unparseable or unresolvable blobref is fuse.ENOENT,
+// same as any other missing name.
+func (n *permanodeDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	br, ok := blob.Parse(name)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return (&searchDir{fs: n.fs}).lookupBlobRef(ctx, br)
+}
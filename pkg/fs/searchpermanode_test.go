@@ -0,0 +1,37 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestPermanodeDirLookupInvalidBlobref checks that a name that
+// doesn't parse as a blobref is reported as ENOENT rather than
+// attempting to resolve it against the server.
+func TestPermanodeDirLookupInvalidBlobref(t *testing.T) {
+	n := &permanodeDir{fs: &CamliFileSystem{}}
+	_, err := n.Lookup(context.Background(), "not-a-blobref")
+	if err != fuse.ENOENT {
+		t.Errorf("Lookup(%q) = %v; want fuse.ENOENT", "not-a-blobref", err)
+	}
+}
@@ -0,0 +1,203 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"perkeep.org/pkg/blob"
+)
+
+// defaultPersistentNamesMaxAge is generous enough that a permanode
+// which simply hasn't been listed in a while (rather than genuinely
+// gone) doesn't lose its pinned name across routine use.
+const defaultPersistentNamesMaxAge = 30 * 24 * time.Hour
+
+// effectivePersistentNamesMaxAge returns fsys.PersistentNamesMaxAge if
+// set, else defaultPersistentNamesMaxAge.
+func (fsys *CamliFileSystem) effectivePersistentNamesMaxAge() time.Duration {
+	if fsys.PersistentNamesMaxAge != 0 {
+		return fsys.PersistentNamesMaxAge
+	}
+	return defaultPersistentNamesMaxAge
+}
+
+// persistentNameStores holds each CamliFileSystem's loaded
+// persistentNameStore, keyed by pointer identity the same way
+// searchDirCaches is.
+var (
+	persistentNameStoresMu sync.Mutex
+	persistentNameStores   = map[*CamliFileSystem]*persistentNameStore{}
+)
+
+// persistentNameStoreFor returns fsys's persistentNameStore, loading
+// it from fsys.PersistentNamesPath on first use.
+func persistentNameStoreFor(fsys *CamliFileSystem) *persistentNameStore {
+	persistentNameStoresMu.Lock()
+	defer persistentNameStoresMu.Unlock()
+	if s, ok := persistentNameStores[fsys]; ok {
+		return s
+	}
+	s := &persistentNameStore{path: fsys.PersistentNamesPath}
+	s.load()
+	persistentNameStores[fsys] = s
+	return s
+}
+
+// persistentEntry is one persistentNameStore record, marshaled as
+// persistentNamesPath's JSON content.
+type persistentEntry struct {
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// persistentNameStore is the in-memory, JSON-file-backed form of
+// PersistentNames' permanode-to-name mapping for one mount.
+type persistentNameStore struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[blob.Ref]persistentEntry // permanode to its pinned name
+	owners  map[string]blob.Ref          // name to the permanode that owns it
+}
+
+// load reads path's JSON content into s, if it exists; a missing file
+// (the common case for a mount's first run) isn't an error.
+func (s *persistentNameStore) load() {
+	s.entries = make(map[blob.Ref]persistentEntry)
+	s.owners = make(map[string]blob.Ref)
+	if s.path == "" {
+		Logger.Printf("fs.persistentNameStore: PersistentNames set without PersistentNamesPath; names won't be persisted")
+		return
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Logger.Printf("fs.persistentNameStore: reading %s: %v", s.path, err)
+		}
+		return
+	}
+	var raw map[string]persistentEntry
+	if err := json.Unmarshal(data, &raw); err != nil {
+		Logger.Printf("fs.persistentNameStore: parsing %s: %v", s.path, err)
+		return
+	}
+	for k, e := range raw {
+		pn, ok := blob.Parse(k)
+		if !ok {
+			continue
+		}
+		s.entries[pn] = e
+		s.owners[e.Name] = pn
+	}
+}
+
+// save writes s's current entries back to s.path as JSON. It must be
+// called with s.mu held.
+func (s *persistentNameStore) save() {
+	if s.path == "" {
+		return
+	}
+	raw := make(map[string]persistentEntry, len(s.entries))
+	for pn, e := range s.entries {
+		raw[pn.String()] = e
+	}
+	data, err := json.MarshalIndent(raw, "", "\t")
+	if err != nil {
+		Logger.Printf("fs.persistentNameStore: marshaling %s: %v", s.path, err)
+		return
+	}
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		Logger.Printf("fs.persistentNameStore: writing %s: %v", s.path, err)
+	}
+}
+
+// nameFor returns the name previously pinned to permanode, if any.
+func (s *persistentNameStore) nameFor(permanode blob.Ref) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[permanode]
+	return e.Name, ok
+}
+
+// assign pins name to permanode and persists the change, touching
+// permanode's LastSeen so a freshly assigned name isn't immediately
+// eligible for gc.
+func (s *persistentNameStore) assign(permanode blob.Ref, name string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[permanode] = persistentEntry{Name: name, LastSeen: now}
+	s.owners[name] = permanode
+	s.save()
+}
+
+// touch updates permanode's LastSeen to now without changing its
+// pinned name, so gc doesn't drop a name still in active use. It's a
+// no-op if permanode isn't currently pinned.
+func (s *persistentNameStore) touch(permanode blob.Ref, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[permanode]
+	if !ok || e.LastSeen.Equal(now) {
+		return
+	}
+	e.LastSeen = now
+	s.entries[permanode] = e
+}
+
+// gc drops every entry whose LastSeen is older than maxAge, for
+// content no longer matching whatever search expressions once
+// surfaced it, and persists the result if anything changed.
+func (s *persistentNameStore) gc(now time.Time, maxAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed bool
+	for pn, e := range s.entries {
+		if now.Sub(e.LastSeen) > maxAge {
+			delete(s.entries, pn)
+			delete(s.owners, e.Name)
+			removed = true
+		}
+	}
+	if removed {
+		s.save()
+	}
+}
+
+// persistStableNames is doReaddir's PersistentNames hook, called once
+// per refresh after n.stableNames is fully populated for this round:
+// it touches (or assigns, for a name seen here for the first time
+// anywhere) every permanode currently listed, then garbage-collects
+// anything else in the store that's gone stale. It must be called
+// only from doReaddir, the same as stableName itself.
+func (n *searchResultDir) persistStableNames() {
+	store := persistentNameStoreFor(n.fs)
+	now := time.Now()
+	for permanode, name := range n.stableNames {
+		if stored, ok := store.nameFor(permanode); ok && stored == name {
+			store.touch(permanode, now)
+			continue
+		}
+		store.assign(permanode, name, now)
+	}
+	store.gc(now, n.fs.effectivePersistentNamesMaxAge())
+}
@@ -0,0 +1,91 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pinnedWarmedUp tracks, per CamliFileSystem, whether
+// warmupPinnedExpressions has already spawned its background
+// refreshers, so the first searchDir.Attr call after mount (the
+// earliest point in this package reachable once the mount is up; see
+// searchDir.Attr) kicks them off exactly once rather than once per
+// stat.
+var (
+	pinnedWarmedUpMu sync.Mutex
+	pinnedWarmedUp   = map[*CamliFileSystem]bool{}
+)
+
+// warmupPinnedExpressions spawns one background refresher per entry
+// in fsys.PinnedExpressions, the first time it's called for fsys.
+// Later calls are no-ops, so callers can call it unconditionally
+// (e.g. from every searchDir.Attr) without guarding it themselves.
+func warmupPinnedExpressions(fsys *CamliFileSystem) {
+	if len(fsys.PinnedExpressions) == 0 {
+		return
+	}
+	pinnedWarmedUpMu.Lock()
+	if pinnedWarmedUp[fsys] {
+		pinnedWarmedUpMu.Unlock()
+		return
+	}
+	pinnedWarmedUp[fsys] = true
+	pinnedWarmedUpMu.Unlock()
+
+	for _, expr := range fsys.PinnedExpressions {
+		go warmupPinnedExpression(fsys, expr)
+	}
+}
+
+// minPinnedRefreshInterval floors warmupPinnedExpression's refresh
+// loop: CamliFileSystem.SearchCacheTTL defaults to 0, meaning "never
+// serve a cached listing", which is the right default for an
+// on-demand "cd" but would otherwise have a pinned expression's
+// warmup re-querying in a tight loop.
+const minPinnedRefreshInterval = 30 * time.Second
+
+// warmupPinnedExpression resolves expr's searchResultDir (the same
+// cached instance resultDirFor and Lookup would reuse, via
+// searchDirCacheFor) and re-resolves it on every effective
+// SearchCacheTTL thereafter (see minPinnedRefreshInterval), for as
+// long as the mount lives: a later "cd" into expr or warmup tick both
+// just ride that one dir's existing TTL-based cache. A warmup failure
+// is logged, not fatal: the expression falls back to resolving
+// lazily, on whichever caller "cd"s into it first.
+func warmupPinnedExpression(fsys *CamliFileSystem, expr string) {
+	cache := searchDirCacheFor(fsys)
+	for {
+		d, ok := cache.get(expr)
+		if !ok {
+			d = &searchResultDir{fs: fsys, searchExp: expr}
+			cache.add(expr, d)
+		}
+		if _, err := d.ReadDirAll(context.Background()); err != nil {
+			Logger.Printf("fs.search: warming up pinned expression %q: %v", expr, err)
+		}
+		interval := d.effectiveSearchCacheTTL()
+		if interval < minPinnedRefreshInterval {
+			interval = minPinnedRefreshInterval
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,119 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// defaultPrefetchConcurrency is effectivePrefetchConcurrency's value
+// when CamliFileSystem.PrefetchConcurrency is left at its zero value:
+// enough that warming a directory's top entries finishes promptly,
+// low enough that it doesn't itself overwhelm the server the way the
+// listing query it follows from is meant to avoid.
+const defaultPrefetchConcurrency = 4
+
+// effectivePrefetchConcurrency returns fsys.PrefetchConcurrency if
+// it's been set positive, or defaultPrefetchConcurrency otherwise.
+func (fsys *CamliFileSystem) effectivePrefetchConcurrency() int {
+	if fsys.PrefetchConcurrency > 0 {
+		return fsys.PrefetchConcurrency
+	}
+	return defaultPrefetchConcurrency
+}
+
+// startPrefetch runs prefetch in its own goroutine, the way
+// ReadDirAll always launches it, under a context canceled by Forget
+// if the directory is dropped before the pass finishes, rather than
+// the unconditionally detached context prefetch used before Forget
+// existed. It replaces any previous pass's cancel func outright: an
+// old pass left running past a new ReadDirAll is still fetching stale
+// names, so there's no reason to keep it cancelable once a fresher
+// one has started (it's harmless to let it run to completion
+// alongside the new one either way, just no longer a pass Forget
+// needs to know about individually).
+func (n *searchResultDir) startPrefetch() {
+	ctx, cancel := context.WithCancel(context.Background())
+	n.mu.Lock()
+	n.prefetchCancel = cancel
+	n.mu.Unlock()
+	go n.prefetch(ctx)
+}
+
+// prefetch warms the blob cache for up to n.fs.PrefetchCount of n's
+// just-seeded entries, most recently modified first, by fetching each
+// one's schema blob (not its full content, which could mean reading
+// arbitrarily large files just to prime a cache). It's meant to run in
+// its own goroutine right after doReaddir reseeds ents, so ReadDirAll
+// itself never blocks on it; ctx is detached from the triggering
+// request for that reason, since the request may be long gone before
+// a slow prefetch finishes.
+func (n *searchResultDir) prefetch(ctx context.Context) {
+	if n.fs.PrefetchCount <= 0 {
+		return
+	}
+	n.mu.Lock()
+	ents := make(map[string]*search.DescribedBlob, len(n.ents))
+	modTime := make(map[string]time.Time, len(n.modTime))
+	for name, db := range n.ents {
+		ents[name] = db
+		modTime[name] = n.modTime[name]
+	}
+	n.mu.Unlock()
+
+	names := prefetchNames(modTime, n.fs.PrefetchCount)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, n.fs.effectivePrefetchConcurrency())
+	for _, name := range names {
+		br := ents[name].BlobRef
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(name string, br blob.Ref) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := n.fs.fetchSchemaBlobWithFailover(ctx, n.fs.client, br); err != nil {
+				Logger.Printf("fs.search: prefetch(%q): %v", name, err)
+			}
+		}(name, br)
+	}
+	wg.Wait()
+}
+
+// prefetchNames returns up to count of modTime's keys, most recently
+// modified first, the selection prefetch warms the blob cache for.
+// Split out from prefetch so the selection itself is testable without
+// a client.
+func prefetchNames(modTime map[string]time.Time, count int) []string {
+	names := make([]string, 0, len(modTime))
+	for name := range modTime {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return modTime[names[i]].After(modTime[names[j]]) })
+	if len(names) > count {
+		names = names[:count]
+	}
+	return names
+}
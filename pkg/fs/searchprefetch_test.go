@@ -0,0 +1,88 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPrefetchNamesCapsAndSortsByModTime checks that prefetchNames
+// returns only the count most recently modified names, newest first.
+func TestPrefetchNamesCapsAndSortsByModTime(t *testing.T) {
+	now := time.Now()
+	modTime := map[string]time.Time{
+		"oldest.jpg": now.Add(-3 * time.Hour),
+		"newest.jpg": now,
+		"middle.jpg": now.Add(-1 * time.Hour),
+	}
+	got := prefetchNames(modTime, 2)
+	want := []string{"newest.jpg", "middle.jpg"}
+	if len(got) != len(want) {
+		t.Fatalf("prefetchNames() = %v; want %v", got, want)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("entry %d = %q; want %q", i, got[i], w)
+		}
+	}
+}
+
+// TestPrefetchNamesUnderCount checks that prefetchNames returns every
+// name, rather than padding or erroring, when there are fewer than
+// count.
+func TestPrefetchNamesUnderCount(t *testing.T) {
+	modTime := map[string]time.Time{"only.jpg": time.Now()}
+	if got := prefetchNames(modTime, 5); len(got) != 1 || got[0] != "only.jpg" {
+		t.Errorf("prefetchNames() = %v; want [\"only.jpg\"]", got)
+	}
+}
+
+// TestEffectivePrefetchConcurrencyDefault checks that the zero value
+// falls back to defaultPrefetchConcurrency.
+func TestEffectivePrefetchConcurrencyDefault(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	if got := fsys.effectivePrefetchConcurrency(); got != defaultPrefetchConcurrency {
+		t.Errorf("effectivePrefetchConcurrency() = %d; want %d", got, defaultPrefetchConcurrency)
+	}
+}
+
+// TestEffectivePrefetchConcurrencyOverride checks that a configured
+// positive value is used as-is.
+func TestEffectivePrefetchConcurrencyOverride(t *testing.T) {
+	fsys := &CamliFileSystem{PrefetchConcurrency: 16}
+	if got := fsys.effectivePrefetchConcurrency(); got != 16 {
+		t.Errorf("effectivePrefetchConcurrency() = %d; want 16", got)
+	}
+}
+
+// BenchmarkPrefetchNames measures the cost of selecting and sorting
+// the most-recently-modified names out of a directory-sized modTime
+// map, the part of a prefetch pass that doesn't involve the network.
+func BenchmarkPrefetchNames(b *testing.B) {
+	now := time.Now()
+	modTime := make(map[string]time.Time, 2000)
+	for i := 0; i < 2000; i++ {
+		modTime[time.Duration(i).String()] = now.Add(-time.Duration(i) * time.Minute)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prefetchNames(modTime, 20)
+	}
+}
@@ -0,0 +1,228 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+)
+
+// progressSuffix names the per-entry control file exposing fetch
+// progress for an active read of an entry: "foo.mp4.progress" reports
+// bytes fetched so far versus foo.mp4's total size, so a slow fetch
+// from cold storage can be monitored separately from whatever
+// progress (if any) the copying tool itself reports. It's resolvable
+// for any currently known entry (see searchResultDir.Lookup), the
+// same as tagsFileSuffix, but only when CamliFileSystem.ExposeReadProgress
+// is set, since unlike the tags file it has nothing useful to show
+// otherwise.
+const progressSuffix = ".progress"
+
+// readProgress tracks one open searchResultFile handle's fetched bytes
+// against its total size, for progressFile to render. fetched is a
+// high-water mark (the furthest byte position any Read has reached so
+// far), not a count of Read calls, so concurrent or re-issued reads of
+// the same range don't inflate it.
+type readProgress struct {
+	total     int64
+	haveTotal bool
+
+	mu      sync.Mutex
+	fetched int64
+}
+
+func newReadProgress(total int64, haveTotal bool) *readProgress {
+	return &readProgress{total: total, haveTotal: haveTotal}
+}
+
+// observe records that a Read reached up to offset+n, advancing
+// p.fetched if that's further than what's already recorded.
+func (p *readProgress) observe(offset int64, n int) {
+	reached := offset + int64(n)
+	p.mu.Lock()
+	if reached > p.fetched {
+		p.fetched = reached
+	}
+	p.mu.Unlock()
+}
+
+// snapshot returns p's current fetched count alongside its total.
+func (p *readProgress) snapshot() (fetched, total int64, haveTotal bool) {
+	p.mu.Lock()
+	fetched = p.fetched
+	p.mu.Unlock()
+	return fetched, p.total, p.haveTotal
+}
+
+// progressFor returns name's active readProgress, or nil if it has no
+// open handle right now (no read in progress, or ExposeReadProgress
+// isn't set).
+func (n *searchResultDir) progressFor(name string) *readProgress {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.progress[name]
+}
+
+// startProgress records p as name's active readProgress, for
+// progressFor to find, replacing whatever (if anything) was already
+// there: a second concurrent open of the same name starts tracking its
+// own read instead of sharing the first's.
+func (n *searchResultDir) startProgress(name string, p *readProgress) {
+	n.mu.Lock()
+	if n.progress == nil {
+		n.progress = make(map[string]*readProgress)
+	}
+	n.progress[name] = p
+	n.mu.Unlock()
+}
+
+// clearProgress removes name's active readProgress, but only if it's
+// still p: a handle whose progress entry was already replaced by a
+// newer concurrent open leaves that newer entry alone.
+func (n *searchResultDir) clearProgress(name string, p *readProgress) {
+	n.mu.Lock()
+	if n.progress[name] == p {
+		delete(n.progress, name)
+	}
+	n.mu.Unlock()
+}
+
+// progressTrackingHandle wraps the fs.Handle a searchResultFile.Open
+// call returns so that each Read updates progress with how far it
+// reached, and Release retires progress from dir's active set. It
+// composes fine alongside openCapHandle and openRefHandle, which wrap
+// the same handle for unrelated reasons: each wrapper's Read/Release
+// only ever touches its own state before forwarding to inner.
+type progressTrackingHandle struct {
+	inner    fs.Handle
+	dir      *searchResultDir
+	name     string
+	progress *readProgress
+}
+
+var (
+	_ fs.Handle         = (*progressTrackingHandle)(nil)
+	_ fs.HandleReader   = (*progressTrackingHandle)(nil)
+	_ fs.HandleReleaser = (*progressTrackingHandle)(nil)
+)
+
+func (h *progressTrackingHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	r, ok := h.inner.(fs.HandleReader)
+	if !ok {
+		return nil
+	}
+	if err := r.Read(ctx, req, resp); err != nil {
+		return err
+	}
+	h.progress.observe(req.Offset, len(resp.Data))
+	return nil
+}
+
+func (h *progressTrackingHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.dir.clearProgress(h.name, h.progress)
+	if r, ok := h.inner.(fs.HandleReleaser); ok {
+		return r.Release(ctx, req)
+	}
+	return nil
+}
+
+// renderProgress is progressFile's read content: "<fetched>/<total>",
+// or "<fetched>/?" if total isn't known (a brand-new file with no
+// haveSize), or "idle" if name has no open handle right now.
+func renderProgress(p *readProgress) string {
+	if p == nil {
+		return "idle\n"
+	}
+	fetched, total, haveTotal := p.snapshot()
+	if !haveTotal {
+		return fmt.Sprintf("%d/?\n", fetched)
+	}
+	return fmt.Sprintf("%d/%d\n", fetched, total)
+}
+
+// progressBase strips progressSuffix from name, returning ok=false if
+// name doesn't carry it or is exactly the suffix with no base entry
+// name in front of it.
+func progressBase(name string) (base string, ok bool) {
+	base = strings.TrimSuffix(name, progressSuffix)
+	return base, base != name && base != ""
+}
+
+// progressFile is progressSuffix's Node: a read-only file whose
+// content is rendered fresh on every Read from dir.progressFor(name),
+// rather than snapshotted once at Open, so a repeated read (as
+// "watch cat foo.jpg.progress" would issue) actually observes the
+// fetch advancing.
+type progressFile struct {
+	dir  *searchResultDir
+	name string
+}
+
+var (
+	_ fs.Node       = (*progressFile)(nil)
+	_ fs.NodeOpener = (*progressFile)(nil)
+)
+
+func (f *progressFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0444
+	a.Valid = f.dir.fs.effectiveAttrValidity()
+	a.Size = uint64(len(renderProgress(f.dir.progressFor(f.name))))
+	return nil
+}
+
+func (f *progressFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	return &progressReadHandle{file: f}, nil
+}
+
+type progressReadHandle struct {
+	file *progressFile
+}
+
+var _ fs.HandleReader = (*progressReadHandle)(nil)
+
+func (h *progressReadHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := renderProgress(h.file.dir.progressFor(h.file.name))
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = []byte(content[req.Offset:end])
+	return nil
+}
+
+// direntsWithProgress is direntsWithHistory, plus one "<name>.progress"
+// dirent per name in names when n.fs.ExposeReadProgress is set.
+func (n *searchResultDir) direntsWithProgress(names []string, refs map[string]blob.Ref, kinds map[string]fuse.DirentType) []fuse.Dirent {
+	ents := n.direntsWithHistory(names, refs, kinds)
+	if n.fs.ExposeReadProgress {
+		for _, name := range names {
+			ents = append(ents, fuse.Dirent{Name: name + progressSuffix, Type: fuse.DT_File})
+		}
+	}
+	return ents
+}
@@ -0,0 +1,51 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestQueryFileContentsReportsExpression checks that queryFileName's
+// content names n's own search expression, the thing a user reading
+// ".query" is almost always trying to confirm.
+func TestQueryFileContentsReportsExpression(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image"}
+	if got := n.queryFileContents(); !strings.Contains(got, "is:image") {
+		t.Errorf("queryFileContents() = %q; want it to mention the search expression %q", got, "is:image")
+	}
+}
+
+// TestLookupQueryFileWorksBeforeReaddir checks that Lookup of
+// queryFileName succeeds on a freshly constructed searchResultDir
+// that has never run ReadDirAll: n.fs.client is left nil here, so
+// touching it would panic, and this test only passes if Lookup never
+// gets that far.
+func TestLookupQueryFileWorksBeforeReaddir(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image"}
+	node, err := n.Lookup(context.Background(), queryFileName)
+	if err != nil {
+		t.Fatalf("Lookup(%q) on an unqueried dir = %v; want nil", queryFileName, err)
+	}
+	if node == nil {
+		t.Errorf("Lookup(%q) returned a nil node", queryFileName)
+	}
+}
@@ -0,0 +1,40 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// partialMarkerName is the synthetic entry doReaddir appends to a
+// listing it cut short because it hit CamliFileSystem.QuerySoftBudget,
+// so the listing being incomplete is visible in an "ls" rather than
+// only in the logs; see truncatedMarkerName for the entry-count
+// analogue.
+const partialMarkerName = ".partial"
+
+// hasPartialMarker reports whether n's last listing was cut short by
+// its query soft budget, i.e. doReaddir appended partialMarkerName to
+// n.lastNames.
+func (n *searchResultDir) hasPartialMarker() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, name := range n.lastNames {
+		if name == partialMarkerName {
+			return true
+		}
+	}
+	return false
+}
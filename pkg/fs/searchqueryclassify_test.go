@@ -0,0 +1,56 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestQueryErrnoClassification checks queryErrno's mapping from a
+// client.Query error to the errno that best explains it: EINTR for an
+// interrupted caller, EINVAL for a malformed expression, EACCES for
+// an auth problem, and EIO for anything it doesn't recognize as
+// either.
+func TestQueryErrnoClassification(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		err  error
+		want fuse.Errno
+	}{
+		{"canceled", canceledCtx.Err(), fuse.EINTR},
+		{"deadline", context.DeadlineExceeded, fuse.EINTR},
+		{"parse", errors.New("parse error near ':'"), fuse.EINVAL},
+		{"syntax", errors.New("syntax error in expression"), fuse.EINVAL},
+		{"unauthorized", errors.New("401 unauthorized"), fuse.EACCES},
+		{"forbidden", errors.New("403 forbidden"), fuse.EACCES},
+		{"generic", errors.New("connection reset by peer"), fuse.EIO},
+	}
+	for _, tt := range tests {
+		if got := queryErrno(tt.err); got != tt.want {
+			t.Errorf("queryErrno(%s) = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
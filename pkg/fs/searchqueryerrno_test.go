@@ -0,0 +1,46 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"errors"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestQueryErrnoLogfClassification checks that queryErrnoLogf defers
+// to queryErrno's classification: an auth-shaped error maps to
+// fuse.EACCES (so it reads as "log in again" rather than corruption)
+// while a generic error still maps to fuse.EIO.
+func TestQueryErrnoLogfClassification(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want fuse.Errno
+	}{
+		{"auth", errors.New("401 unauthorized"), fuse.EACCES},
+		{"generic", errors.New("connection refused"), fuse.EIO},
+	}
+	for _, tt := range tests {
+		if got := queryErrnoLogf(tt.name, tt.err); got != tt.want {
+			t.Errorf("queryErrnoLogf(%q, %v) = %v; want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
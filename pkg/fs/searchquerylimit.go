@@ -0,0 +1,103 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultQueryConcurrency caps how many search queries (through
+// doReaddir's dir.ResolvePage calls) a single mount has outstanding at
+// once when CamliFileSystem.QueryConcurrency is left at its zero
+// value: enough that a handful of simultaneous ReadDirAlls overlap
+// productively, low enough that a crawler hammering the mount with
+// directory listings can't turn into a query storm against the
+// server.
+const defaultQueryConcurrency = 8
+
+// queryLimiters holds each CamliFileSystem's query semaphore, keyed by
+// pointer identity the same way breakers is.
+var (
+	queryLimitersMu sync.Mutex
+	queryLimiters   = map[*CamliFileSystem]*queryLimiter{}
+)
+
+// queryLimiter bounds how many search queries one mount has
+// outstanding at once: a doReaddir past the limit blocks in acquire
+// until an earlier one releases its slot. waiting counts callers
+// currently blocked in acquire, for feeding queue depth to the
+// metrics hook.
+type queryLimiter struct {
+	slots   chan struct{}
+	waiting int32
+}
+
+func newQueryLimiter(limit int) *queryLimiter {
+	return &queryLimiter{slots: make(chan struct{}, limit)}
+}
+
+// queryLimiterFor returns fsys's queryLimiter, creating it from
+// fsys.effectiveQueryConcurrency on first use.
+func queryLimiterFor(fsys *CamliFileSystem) *queryLimiter {
+	queryLimitersMu.Lock()
+	defer queryLimitersMu.Unlock()
+	l, ok := queryLimiters[fsys]
+	if !ok {
+		l = newQueryLimiter(fsys.effectiveQueryConcurrency())
+		queryLimiters[fsys] = l
+	}
+	return l
+}
+
+// acquire blocks until a query slot is free or ctx is done, reporting
+// queue depth and wait time to m either way. On success the caller
+// owns the slot and must call release exactly once; on error (ctx
+// done first) there's no slot to release.
+func (l *queryLimiter) acquire(ctx context.Context, m MetricsCollector) error {
+	atomic.AddInt32(&l.waiting, 1)
+	m.ObserveQueryQueueDepth(int(atomic.LoadInt32(&l.waiting)))
+	start := time.Now()
+	defer func() {
+		atomic.AddInt32(&l.waiting, -1)
+		m.ObserveQueryWait(time.Since(start))
+	}()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the slot a prior successful acquire claimed.
+func (l *queryLimiter) release() {
+	<-l.slots
+}
+
+// effectiveQueryConcurrency is fsys.QueryConcurrency if positive,
+// otherwise defaultQueryConcurrency.
+func (fsys *CamliFileSystem) effectiveQueryConcurrency() int {
+	if fsys.QueryConcurrency > 0 {
+		return fsys.QueryConcurrency
+	}
+	return defaultQueryConcurrency
+}
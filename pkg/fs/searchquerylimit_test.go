@@ -0,0 +1,78 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestQueryLimiterBlocksPastLimit checks that a queryLimiter of size 1
+// makes a second acquire wait for the first's release, and that it
+// gives up once its context is done instead of blocking forever.
+func TestQueryLimiterBlocksPastLimit(t *testing.T) {
+	l := newQueryLimiter(1)
+	if err := l.acquire(context.Background(), noopMetrics{}); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx, noopMetrics{}); err == nil {
+		t.Fatal("second acquire succeeded with no free slot; want it to block until ctx is done")
+	}
+
+	l.release()
+	if err := l.acquire(context.Background(), noopMetrics{}); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+}
+
+// TestQueryLimiterWaitingCount checks that waiting reflects callers
+// currently blocked in acquire, and drops back to zero once they've
+// all gotten in.
+func TestQueryLimiterWaitingCount(t *testing.T) {
+	l := newQueryLimiter(1)
+	if err := l.acquire(context.Background(), noopMetrics{}); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.acquire(context.Background(), noopMetrics{})
+		close(done)
+	}()
+
+	// Give the goroutine above a chance to block in acquire.
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&l.waiting) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&l.waiting); got != 1 {
+		t.Fatalf("waiting = %d before release; want 1", got)
+	}
+
+	l.release()
+	<-done
+	if got := atomic.LoadInt32(&l.waiting); got != 0 {
+		t.Errorf("waiting = %d after the blocked caller got in; want 0", got)
+	}
+}
@@ -0,0 +1,159 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+)
+
+// defaultReadaheadWindow is the chunk size a rangedFileHandle fetches
+// and caches per cache miss when CamliFileSystem.ReadaheadWindow is
+// left at its zero value: large enough that a player's sequential
+// small reads during steady playback mostly hit the cache, small
+// enough that a single random seek doesn't pull an unreasonable
+// amount of a large video file across the network for content that's
+// never actually read.
+const defaultReadaheadWindow = 1 << 20 // 1MB
+
+// effectiveReadaheadWindow reports the chunk size fs actually applies
+// per cache miss: its configured ReadaheadWindow if positive,
+// otherwise defaultReadaheadWindow.
+func (fsys *CamliFileSystem) effectiveReadaheadWindow() int {
+	if fsys.ReadaheadWindow > 0 {
+		return fsys.ReadaheadWindow
+	}
+	return defaultReadaheadWindow
+}
+
+// fileReaderAt is the slice of *schema.FileReader that rangedFileHandle
+// depends on, factored out so a test can drive it against a synthetic
+// in-memory file instead of a real blobserver.
+type fileReaderAt interface {
+	ReadAt(p []byte, off int64) (n int, err error)
+	Close() error
+}
+
+// rangedFileHandle is searchResultFile.Open's handle for a file with a
+// valid content blobref: reads translate into ReadAt calls against fr,
+// so a seek forward or backward becomes a direct ranged fetch rather
+// than discarding and re-streaming from the start the way a plain
+// io.Reader wrapped in an offset check would. cache holds the most
+// recently fetched window, so a run of small sequential reads (as most
+// players issue while scrubbing) is usually served without a further
+// fetch, and h.window bounds how much of a multi-gigabyte file is ever
+// held in memory at once regardless of the file's total size.
+type rangedFileHandle struct {
+	fr      fileReaderAt
+	blobref blob.Ref
+	fs      *CamliFileSystem
+	window  int
+
+	mu         sync.Mutex
+	cache      []byte
+	cacheStart int64
+}
+
+var (
+	_ fs.Handle         = (*rangedFileHandle)(nil)
+	_ fs.HandleReader   = (*rangedFileHandle)(nil)
+	_ fs.HandleReleaser = (*rangedFileHandle)(nil)
+)
+
+// Read implements fs.HandleReader, serving req out of h.cache when
+// it's already covered and refilling h.cache with a fresh,
+// h.window-sized (or larger, if req.Size itself exceeds it) read
+// starting at req.Offset otherwise.
+func (h *rangedFileHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.coversLocked(req.Offset, req.Size) {
+		if err := h.refillLocked(ctx, req.Offset, req.Size); err != nil {
+			return err
+		}
+	}
+	start := req.Offset - h.cacheStart
+	end := start + int64(req.Size)
+	if end > int64(len(h.cache)) {
+		end = int64(len(h.cache))
+	}
+	if start > end {
+		start = end
+	}
+	resp.Data = h.cache[start:end]
+	return nil
+}
+
+// coversLocked reports whether h.cache already holds [offset,
+// offset+size) in full. It must be called with h.mu held.
+func (h *rangedFileHandle) coversLocked(offset int64, size int) bool {
+	if h.cache == nil {
+		return false
+	}
+	return offset >= h.cacheStart && offset+int64(size) <= h.cacheStart+int64(len(h.cache))
+}
+
+// refillLocked replaces h.cache with a fresh chunk of at least
+// h.window bytes (more, if size demands it) starting at offset,
+// retrying a transient fetch failure (see isTransientBlobErr) with
+// backoff (see blobRetryDelay) up to fs's effectiveBlobFetchRetryMax
+// before giving up, as long as ctx hasn't already been canceled. It
+// must be called with h.mu held.
+func (h *rangedFileHandle) refillLocked(ctx context.Context, offset int64, size int) error {
+	n := h.window
+	if size > n {
+		n = size
+	}
+	buf := make([]byte, n)
+	maxAttempts := h.fs.effectiveBlobFetchRetryMax()
+	var read int
+	var err error
+	for attempt := 0; ; attempt++ {
+		read, err = h.fr.ReadAt(buf, offset)
+		if err == nil || err == io.EOF {
+			break
+		}
+		if attempt >= maxAttempts-1 || !isTransientBlobErr(err) {
+			Logger.Printf("fs.searchResultFile: readahead fetch of %v at offset %d: %v", h.blobref, offset, err)
+			return fuse.EIO
+		}
+		debugf("fs.searchResultFile: readahead fetch of %v at offset %d failed (attempt %d/%d), retrying: %v", h.blobref, offset, attempt+1, maxAttempts, err)
+		select {
+		case <-time.After(blobRetryDelay(attempt)):
+		case <-ctx.Done():
+			Logger.Printf("fs.searchResultFile: readahead fetch of %v at offset %d: %v", h.blobref, offset, ctx.Err())
+			return fuse.EINTR
+		}
+	}
+	h.cache = buf[:read]
+	h.cacheStart = offset
+	return nil
+}
+
+// Release implements fs.HandleReleaser, closing the underlying
+// schema.FileReader.
+func (h *rangedFileHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	return h.fr.Close()
+}
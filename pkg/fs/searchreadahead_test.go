@@ -0,0 +1,88 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// fakeLargeFile is a fileReaderAt backed by an in-memory synthetic
+// file, for driving rangedFileHandle in a test without a real
+// blobserver. It records the largest single ReadAt it was ever asked
+// to serve, so a test can assert rangedFileHandle never requests more
+// than its configured window at a time regardless of the file's size.
+type fakeLargeFile struct {
+	data      []byte
+	maxReadAt int
+}
+
+func (f *fakeLargeFile) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) > f.maxReadAt {
+		f.maxReadAt = len(p)
+	}
+	if off >= int64(len(f.data)) {
+		return 0, nil
+	}
+	n := copy(p, f.data[off:])
+	return n, nil
+}
+
+func (f *fakeLargeFile) Close() error { return nil }
+
+// TestRangedFileHandleBoundedWindow reads a multi-hundred-megabyte
+// synthetic file at random offsets and sizes through a rangedFileHandle
+// with a small window, checking both that every read comes back
+// correct and that refillLocked never asked fakeLargeFile for more
+// than a small, bounded amount at once, no matter how large the file
+// or how far apart two reads land.
+func TestRangedFileHandleBoundedWindow(t *testing.T) {
+	const fileSize = 256 << 20 // 256MB
+	const window = 64 << 10    // 64KB
+
+	data := make([]byte, fileSize)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	fake := &fakeLargeFile{data: data}
+	h := &rangedFileHandle{fr: fake, fs: &CamliFileSystem{}, window: window}
+
+	rnd := rand.New(rand.NewSource(1))
+	ctx := context.Background()
+	for i := 0; i < 200; i++ {
+		off := rnd.Int63n(fileSize)
+		size := 1 + rnd.Intn(4<<10)
+		req := &fuse.ReadRequest{Offset: off, Size: size}
+		resp := &fuse.ReadResponse{}
+		if err := h.Read(ctx, req, resp); err != nil {
+			t.Fatalf("Read(offset=%d, size=%d) error = %v", off, size, err)
+		}
+		want := data[off : off+int64(len(resp.Data))]
+		if string(resp.Data) != string(want) {
+			t.Fatalf("Read(offset=%d, size=%d) returned wrong data", off, size)
+		}
+	}
+
+	if fake.maxReadAt > 2*window {
+		t.Errorf("fakeLargeFile.maxReadAt = %d; want bounded near window (%d)", fake.maxReadAt, window)
+	}
+}
@@ -0,0 +1,124 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestDedupReaddirConcurrent hammers dedupReaddir from many goroutines
+// before any of them have a result, the same as several ReadDirAlls
+// racing a stale cache: fn must run exactly once, and every caller
+// must see its result.
+func TestDedupReaddirConcurrent(t *testing.T) {
+	n := &searchResultDir{}
+	var calls int32
+	var ready sync.WaitGroup
+	ready.Add(1)
+
+	const callers = 50
+	var start sync.WaitGroup
+	start.Add(callers)
+	var done sync.WaitGroup
+	done.Add(callers)
+
+	errs := make([]error, callers)
+	rans := make([]bool, callers)
+	for i := 0; i < callers; i++ {
+		go func(i int) {
+			start.Done()
+			start.Wait() // line everyone up before any of them calls in
+			err, ran := n.dedupReaddir(func() error {
+				atomic.AddInt32(&calls, 1)
+				ready.Wait() // hold fn open until every caller has joined
+				return nil
+			})
+			errs[i] = err
+			rans[i] = ran
+			done.Done()
+		}(i)
+	}
+
+	// Give every goroutine a chance to either become the runner or
+	// join the in-flight call before letting fn return.
+	start.Wait()
+	ready.Done()
+	done.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("fn ran %d times; want exactly 1", got)
+	}
+	ranCount := 0
+	for i := range errs {
+		if errs[i] != nil {
+			t.Errorf("caller %d: dedupReaddir err = %v; want nil", i, errs[i])
+		}
+		if rans[i] {
+			ranCount++
+		}
+	}
+	if ranCount != 1 {
+		t.Errorf("%d callers reported ran=true; want exactly 1", ranCount)
+	}
+	if n.inflight != nil {
+		t.Error("inflight left non-nil after completion")
+	}
+}
+
+// TestDedupReaddirConcurrentErr checks that a shared failure
+// propagates to every waiting caller, not just the one that ran fn.
+func TestDedupReaddirConcurrentErr(t *testing.T) {
+	n := &searchResultDir{}
+	wantErr := errors.New("synthetic query failure")
+	var ready sync.WaitGroup
+	ready.Add(1)
+
+	const callers = 50
+	var start sync.WaitGroup
+	start.Add(callers)
+	var done sync.WaitGroup
+	done.Add(callers)
+
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		go func(i int) {
+			start.Done()
+			start.Wait()
+			err, _ := n.dedupReaddir(func() error {
+				ready.Wait()
+				return wantErr
+			})
+			errs[i] = err
+			done.Done()
+		}(i)
+	}
+
+	start.Wait()
+	ready.Done()
+	done.Wait()
+
+	for i, err := range errs {
+		if err != wantErr {
+			t.Errorf("caller %d: dedupReaddir err = %v; want %v", i, err, wantErr)
+		}
+	}
+}
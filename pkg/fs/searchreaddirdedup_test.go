@@ -0,0 +1,70 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestReadDirAllReusesInflightCall checks that ReadDirAll's own
+// singleflight guard (n.inflight, a *readdirCall) is honored: a
+// caller that finds a call already in flight must wait for it and
+// reuse its result rather than running doReaddir itself. n.fs.client
+// is left nil, so if ReadDirAll mistakenly ran doReaddir a second
+// time here it would come back as fuse.EIO (see
+// TestDoReaddirNilClient) instead of the listing below.
+func TestReadDirAllReusesInflightCall(t *testing.T) {
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{},
+		searchExp: "is:file",
+		lastNames: []string{"a.jpg", "b.jpg"},
+	}
+	n.inflight = &readdirCall{} // already finished: wg was never Add'd
+
+	ents, err := n.ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatalf("ReadDirAll() error = %v; want nil (should reuse the inflight call's result)", err)
+	}
+	var names []string
+	for _, d := range ents {
+		names = append(names, d.Name)
+	}
+	if want := []string{"a.jpg", "b.jpg"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDirAll() names = %v; want %v", names, want)
+	}
+}
+
+// TestReadDirAllPropagatesInflightErr checks that a waiting caller
+// also sees the in-flight call's error, rather than retrying the
+// search itself.
+func TestReadDirAllPropagatesInflightErr(t *testing.T) {
+	wantErr := errors.New("synthetic seed failure")
+	n := &searchResultDir{
+		fs:        &CamliFileSystem{},
+		searchExp: "is:file",
+	}
+	n.inflight = &readdirCall{err: wantErr}
+
+	if _, err := n.ReadDirAll(context.Background()); err != wantErr {
+		t.Errorf("ReadDirAll() error = %v; want %v", err, wantErr)
+	}
+}
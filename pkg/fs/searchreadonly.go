@@ -0,0 +1,30 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// checkWritable returns effectiveUnsupportedErrno(UnsupportedReadOnly)
+// if fsys.ReadOnly is set, else nil. Every mutation handler calls it
+// first, before any of its own feature-flag checks, so ReadOnly
+// overrides all of them uniformly.
+func (fsys *CamliFileSystem) checkWritable() error {
+	if fsys.ReadOnly {
+		return fsys.effectiveUnsupportedErrno(UnsupportedReadOnly)
+	}
+	return nil
+}
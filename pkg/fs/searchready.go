@@ -0,0 +1,156 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/search"
+)
+
+// readyFileName is a hidden file at the "search" directory's own
+// root reporting whether the search backend is currently reachable,
+// for a liveness probe (e.g. "cat mount/search/.ready") that wants a
+// cheap yes/no without the side effects a real query or a full
+// ReadDirAll would have. Like statusFileName, it's always resolvable
+// via Lookup but never listed in ReadDirAll.
+const readyFileName = ".ready"
+
+// readyCacheTTL bounds how long readyCheck trusts its last probe
+// before issuing another one, so a monitoring system polling .ready
+// every few seconds doesn't turn into a probe storm against the
+// search backend.
+const readyCacheTTL = 5 * time.Second
+
+// readyProbeExpr is the expression readyCheck's zero-result query
+// uses: any syntactically valid expression works equally well here,
+// since Limit: 0 means its actual matches are never fetched, only
+// whether the round trip itself succeeds.
+const readyProbeExpr = "is:image"
+
+// readyState is one CamliFileSystem's last .ready probe outcome,
+// cached the same way queryStats is, keyed by pointer identity in
+// readyStateRegistry.
+type readyState struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	errText   string
+}
+
+var (
+	readyStateMu       sync.Mutex
+	readyStateRegistry = map[*CamliFileSystem]*readyState{}
+)
+
+// readyStateFor returns fsys's shared readyState, creating it the
+// first time readyFile.Read asks for it.
+func readyStateFor(fsys *CamliFileSystem) *readyState {
+	readyStateMu.Lock()
+	defer readyStateMu.Unlock()
+	if st, ok := readyStateRegistry[fsys]; ok {
+		return st
+	}
+	st := &readyState{}
+	readyStateRegistry[fsys] = st
+	return st
+}
+
+// readyCheck reports fsys's search backend connectivity, probing
+// fresh with a Limit: 0 query only once the last check is older than
+// readyCacheTTL. errText is empty on success, or the probe's error
+// text otherwise.
+func readyCheck(ctx context.Context, fsys *CamliFileSystem) (errText string) {
+	return computeReadyResult(readyStateFor(fsys), func() error {
+		_, err := fsys.queryWithFailover(ctx, fsys.client, &search.SearchQuery{
+			Expression: readyProbeExpr,
+			Limit:      0,
+		})
+		return err
+	})
+}
+
+// computeReadyResult is readyCheck's cache-or-probe decision, factored
+// out so it can be tested against a stub probe instead of a real
+// client: it returns st's cached errText unchanged if the last probe
+// is still within readyCacheTTL, otherwise calls probe and caches
+// (and returns) its outcome as errText, empty on success.
+func computeReadyResult(st *readyState, probe func() error) (errText string) {
+	st.mu.Lock()
+	fresh := !st.checkedAt.IsZero() && time.Since(st.checkedAt) < readyCacheTTL
+	errText = st.errText
+	st.mu.Unlock()
+	if fresh {
+		return errText
+	}
+
+	errText = ""
+	if err := probe(); err != nil {
+		errText = err.Error()
+	}
+
+	st.mu.Lock()
+	st.checkedAt, st.errText = time.Now(), errText
+	st.mu.Unlock()
+	return errText
+}
+
+// readyFileContents renders readyFileName's content from errText, as
+// readyCheck reported it: "ok\n" on success, or the error text
+// (newline-terminated) otherwise.
+func readyFileContents(errText string) []byte {
+	if errText == "" {
+		return []byte("ok\n")
+	}
+	return []byte(errText + "\n")
+}
+
+// readyFile is readyFileName's Node and Handle: a read-only file
+// whose content is readyCheck's live (or cached) outcome, the same
+// on-read-generation statusFile otherwise uses.
+type readyFile struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node         = readyFile{}
+	_ fs.HandleReader = readyFile{}
+)
+
+func (f readyFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0444
+	a.Valid = f.fs.effectiveAttrValidity()
+	return nil
+}
+
+func (f readyFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := readyFileContents(readyCheck(ctx, f.fs))
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = content[req.Offset:end]
+	return nil
+}
@@ -0,0 +1,75 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestComputeReadyResultOkPath checks that a successful probe reports
+// no error text, and that readyFileContents renders that as "ok\n".
+func TestComputeReadyResultOkPath(t *testing.T) {
+	st := &readyState{}
+	errText := computeReadyResult(st, func() error { return nil })
+	if errText != "" {
+		t.Fatalf("computeReadyResult with a successful probe = %q; want empty", errText)
+	}
+	if got, want := string(readyFileContents(errText)), "ok\n"; got != want {
+		t.Errorf("readyFileContents(%q) = %q; want %q", errText, got, want)
+	}
+}
+
+// TestComputeReadyResultDownPath checks that a failing probe's error
+// text is returned and rendered verbatim (newline-terminated) by
+// readyFileContents.
+func TestComputeReadyResultDownPath(t *testing.T) {
+	st := &readyState{}
+	wantErr := errors.New("search backend unreachable")
+	errText := computeReadyResult(st, func() error { return wantErr })
+	if errText != wantErr.Error() {
+		t.Fatalf("computeReadyResult with a failing probe = %q; want %q", errText, wantErr.Error())
+	}
+	if got, want := string(readyFileContents(errText)), wantErr.Error()+"\n"; got != want {
+		t.Errorf("readyFileContents(%q) = %q; want %q", errText, got, want)
+	}
+}
+
+// TestComputeReadyResultCachesWithinTTL checks that a second call
+// within readyCacheTTL doesn't re-invoke probe, returning the cached
+// outcome from the first call instead.
+func TestComputeReadyResultCachesWithinTTL(t *testing.T) {
+	st := &readyState{}
+	calls := 0
+	probe := func() error {
+		calls++
+		if calls == 1 {
+			return errors.New("first call fails")
+		}
+		return nil
+	}
+	first := computeReadyResult(st, probe)
+	second := computeReadyResult(st, probe)
+	if calls != 1 {
+		t.Fatalf("probe called %d times; want 1, since the second call should hit the cache", calls)
+	}
+	if second != first {
+		t.Errorf("computeReadyResult second call = %q; want cached %q", second, first)
+	}
+}
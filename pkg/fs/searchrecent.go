@@ -0,0 +1,60 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"time"
+)
+
+// recentDirName is the reserved name of the top-level searchDir's
+// built-in "most recently modified permanodes" shortcut (see
+// searchDir.recentDir), equivalent to the old client.GetRecentPermanodes,
+// without the user having to type an expression of their own.
+const recentDirName = "recent"
+
+// defaultRecentWindow is how far back recentDirName looks when
+// CamliFileSystem.RecentWindow isn't set.
+const defaultRecentWindow = 30 * 24 * time.Hour
+
+// effectiveRecentWindow is the window recentDirName actually uses:
+// fsys's own RecentWindow if set, else defaultRecentWindow.
+func (fsys *CamliFileSystem) effectiveRecentWindow() time.Duration {
+	if fsys.RecentWindow > 0 {
+		return fsys.RecentWindow
+	}
+	return defaultRecentWindow
+}
+
+// recentDir returns the searchResultDir backing recentDirName: an
+// "after:" query over n.fs.effectiveRecentWindow(), newest modtime
+// first, cached in n.fs's searchDirCache under recentDirName the same
+// way any other Lookup result is (see resultDirFor).
+func (n *searchDir) recentDir() *searchResultDir {
+	cache := searchDirCacheFor(n.fs)
+	if d, ok := cache.get(recentDirName); ok {
+		return d
+	}
+	since := time.Now().Add(-n.fs.effectiveRecentWindow())
+	expr := fmt.Sprintf("after:%q", since.Format(time.RFC3339))
+	sortBy := SearchSortByModTimeDesc
+	d := &searchResultDir{fs: n.fs, searchExp: expr, sortOverride: &sortBy}
+	cache.add(recentDirName, d)
+	return d
+}
@@ -0,0 +1,58 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// TestRefreshControlFileReadInvalidatesCache checks that reading
+// ".refresh" resets lastReaddir, so haveCachedListing (consulted by
+// ReadDirAll to decide whether to re-query) no longer reports a fresh
+// cached listing.
+func TestRefreshControlFileReadInvalidatesCache(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, lastReaddir: time.Now()}
+	if !n.haveCachedListing(time.Hour, 0) {
+		t.Fatal("haveCachedListing before touching .refresh = false; want true (cache populated)")
+	}
+	f := refreshControlFile{dir: n}
+	if err := f.Read(context.Background(), &fuse.ReadRequest{}, &fuse.ReadResponse{}); err != nil {
+		t.Fatalf("Read = %v; want nil", err)
+	}
+	if n.haveCachedListing(time.Hour, 0) {
+		t.Error("haveCachedListing after reading .refresh = true; want false (cache invalidated)")
+	}
+}
+
+// TestRefreshControlFileWriteInvalidatesCache checks the same thing
+// for a write instead of a read.
+func TestRefreshControlFileWriteInvalidatesCache(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, lastReaddir: time.Now()}
+	f := refreshControlFile{dir: n}
+	if err := f.Write(context.Background(), &fuse.WriteRequest{Data: []byte("x")}, &fuse.WriteResponse{}); err != nil {
+		t.Fatalf("Write = %v; want nil", err)
+	}
+	if n.haveCachedListing(time.Hour, 0) {
+		t.Error("haveCachedListing after writing .refresh = true; want false (cache invalidated)")
+	}
+}
@@ -0,0 +1,69 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// RefreshPolicy controls when a searchResultDir's ReadDirAll decides
+// its cached listing is stale enough to re-run its search (see
+// CamliFileSystem.RefreshPolicy). It never overrides an "at" snapshot
+// directory, which is immutable and cached forever regardless.
+type RefreshPolicy int
+
+const (
+	// RefreshPolicyTTL is the original behavior: a cached listing is
+	// reused until CamliFileSystem.SearchCacheTTL (or the "ttl="
+	// Lookup option) expires, or effectiveRefreshDebounce's shorter
+	// window for a zero/tiny TTL.
+	RefreshPolicyTTL RefreshPolicy = iota
+	// RefreshPolicyAlways ignores any cached listing and re-runs the
+	// search on every ReadDirAll, for a caller that wants the
+	// freshest possible results and is willing to pay a full query's
+	// latency for every "ls". It's meant for short-lived, scripted
+	// mounts where correctness matters more than speed; on a
+	// long-lived interactive mount it defeats the whole point of
+	// SearchCacheTTL.
+	RefreshPolicyAlways
+	// RefreshPolicyOnChangeHint trusts the index change subscription
+	// (see searchWatcher) exclusively: a listing is reused until
+	// something invalidates it, and never expires on its own.
+	// Without a working subscription (see Subscriber), nothing ever
+	// invalidates it, so this is only appropriate for a server that's
+	// confirmed to support change notifications.
+	RefreshPolicyOnChangeHint
+)
+
+// haveCachedListing reports whether n's already-seeded lastNames can
+// be served as-is, instead of re-running doReaddir, under n.fs's
+// configured RefreshPolicy. It must be called with n.mu held, since it
+// reads n.lastReaddir.
+func (n *searchResultDir) haveCachedListing(ttl, debounce time.Duration) bool {
+	if n.at != nil {
+		return !n.lastReaddir.IsZero()
+	}
+	switch n.fs.RefreshPolicy {
+	case RefreshPolicyAlways:
+		return false
+	case RefreshPolicyOnChangeHint:
+		return !n.lastReaddir.IsZero()
+	default:
+		return (ttl > 0 && n.lastReaddir.After(time.Now().Add(-ttl))) ||
+			(debounce > 0 && n.lastReaddir.After(time.Now().Add(-debounce)))
+	}
+}
@@ -0,0 +1,50 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestHaveCachedListingTinyTTL checks that a tiny TTL (relative to how
+// long ago the directory last refreshed) reports no cached listing,
+// i.e. ReadDirAll will re-query.
+func TestHaveCachedListingTinyTTL(t *testing.T) {
+	n := &searchResultDir{
+		fs:          &CamliFileSystem{},
+		lastReaddir: time.Now().Add(-time.Hour),
+	}
+	if n.haveCachedListing(time.Millisecond, 0) {
+		t.Error("haveCachedListing with a tiny TTL against an hour-old listing = true; want false (re-query)")
+	}
+}
+
+// TestHaveCachedListingHugeTTL checks that a huge TTL (relative to how
+// long ago the directory last refreshed) reports a cached listing,
+// i.e. ReadDirAll reuses it instead of re-querying.
+func TestHaveCachedListingHugeTTL(t *testing.T) {
+	n := &searchResultDir{
+		fs:          &CamliFileSystem{},
+		lastReaddir: time.Now(),
+	}
+	if !n.haveCachedListing(time.Hour, 0) {
+		t.Error("haveCachedListing with an hour-long TTL against a fresh listing = false; want true (cache reused)")
+	}
+}
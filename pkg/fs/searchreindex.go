@@ -0,0 +1,156 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// Reindexer is the subset of *client.Client that can nudge the server
+// into (re)indexing recently uploaded content, for servers that
+// support it. A client that doesn't implement Reindexer just leaves
+// reindexHintFile reporting that the hint wasn't accepted.
+type Reindexer interface {
+	EnqueueIndexing(ctx context.Context) error
+}
+
+// reindexHintFileName is a hidden, per-searchResultDir control file:
+// writing to it asks the server (via Reindexer, if n.fs.client
+// implements it) to enqueue indexing of whatever it's fallen behind
+// on, then invalidates n's own cache so the next ReadDirAll picks up
+// anything that lands. The request is best-effort; reading the file
+// back reports whether the most recent hint was accepted. Only
+// resolvable via Lookup when CamliFileSystem.AllowReindexHint is set,
+// since unlike refreshFileName it reaches out and touches server
+// state rather than just rereading it.
+const reindexHintFileName = ".reindex-hint"
+
+// reindexHintState is the outcome of the most recent reindexHintFile
+// write, read back through reindexHintFile.Read.
+type reindexHintState struct {
+	mu       sync.Mutex
+	attempts int
+	lastErr  error
+}
+
+// record is called once per reindexHintFile write, successful or not.
+func (st *reindexHintState) record(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.attempts++
+	st.lastErr = err
+}
+
+// contents renders st's current outcome as reindexHintFile.Read's
+// content.
+func (st *reindexHintState) contents() []byte {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "attempts: %d\n", st.attempts)
+	switch {
+	case st.attempts == 0:
+		fmt.Fprintf(&b, "status: no hint sent yet\n")
+	case st.lastErr == nil:
+		fmt.Fprintf(&b, "status: accepted\n")
+	default:
+		fmt.Fprintf(&b, "status: not accepted: %v\n", st.lastErr)
+	}
+	return []byte(b.String())
+}
+
+// reindexHintStateFor returns n's reindexHintState, creating it on
+// first use the same way n.export is left nil until startExport's
+// first call.
+func (n *searchResultDir) reindexHintStateFor() *reindexHintState {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.reindexHint == nil {
+		n.reindexHint = &reindexHintState{}
+	}
+	return n.reindexHint
+}
+
+// reindexHintFile is reindexHintFileName's Node and Handle: writing
+// anything to it sends the hint (see sendReindexHint), and reading it
+// reports whether the most recent hint was accepted (see
+// reindexHintState.contents).
+type reindexHintFile struct {
+	dir *searchResultDir
+}
+
+var (
+	_ fs.Node         = reindexHintFile{}
+	_ fs.HandleReader = reindexHintFile{}
+	_ fs.HandleWriter = reindexHintFile{}
+)
+
+func (f reindexHintFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Valid = f.dir.fs.effectiveAttrValidity()
+	return nil
+}
+
+func (f reindexHintFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := f.dir.reindexHintStateFor().contents()
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = content[req.Offset:end]
+	return nil
+}
+
+func (f reindexHintFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := f.dir.fs.checkWritable(); err != nil {
+		return err
+	}
+	f.dir.sendReindexHint(ctx)
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// sendReindexHint asks n.fs.client to enqueue indexing, if it
+// implements Reindexer, records the outcome for reindexHintFile.Read,
+// and invalidates n's cache regardless of whether the hint was
+// accepted, since the whole point is to pick up content the next
+// ReadDirAll would otherwise still be waiting on SearchCacheTTL for.
+func (n *searchResultDir) sendReindexHint(ctx context.Context) {
+	r, ok := n.fs.client.(Reindexer)
+	if !ok {
+		n.reindexHintStateFor().record(fmt.Errorf("client does not support reindexing hints"))
+		n.invalidateCache()
+		return
+	}
+	err := r.EnqueueIndexing(ctx)
+	if err != nil {
+		Logger.Printf("fs.search: %q write for '%s': %v", reindexHintFileName, n.searchExp, err)
+	}
+	n.reindexHintStateFor().record(err)
+	n.invalidateCache()
+}
@@ -0,0 +1,64 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// relativeDateRE matches a before:/after: search term whose value is a
+// relative offset ("-7d", "-1month", "-2y") rather than an absolute
+// date, optionally quoted the same way an absolute date is.
+var relativeDateRE = regexp.MustCompile(`(before|after):"?-(\d+)(d|day|days|w|week|weeks|mo|month|months|y|year|years)"?`)
+
+// expandRelativeDates rewrites every before:/after: term in expr whose
+// value relativeDateRE recognizes into the concrete date it resolves
+// to relative to now, quoted the way the search server expects
+// ("after:\"2015-10-01\""). A term relativeDateRE doesn't recognize
+// (including an absolute date already) is left exactly as it appears.
+func expandRelativeDates(expr string, now time.Time) string {
+	return relativeDateRE.ReplaceAllStringFunc(expr, func(token string) string {
+		m := relativeDateRE.FindStringSubmatch(token)
+		keyword, n, unit := m[1], m[2], m[3]
+		count, err := strconv.Atoi(n)
+		if err != nil {
+			return token
+		}
+		return keyword + `:"` + relativeDate(now, count, unit).Format("2006-01-02") + `"`
+	})
+}
+
+// relativeDate subtracts count units of unit (as matched by
+// relativeDateRE) from now. Calendar-based units (month, year) use
+// AddDate so they land on the same day of the month rather than a
+// fixed number of 24-hour days back.
+func relativeDate(now time.Time, count int, unit string) time.Time {
+	switch unit {
+	case "mo", "month", "months":
+		return now.AddDate(0, -count, 0)
+	case "y", "year", "years":
+		return now.AddDate(-count, 0, 0)
+	case "w", "week", "weeks":
+		return now.AddDate(0, 0, -count*7)
+	default: // "d", "day", "days"
+		return now.AddDate(0, 0, -count)
+	}
+}
@@ -0,0 +1,155 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"regexp"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/schema"
+)
+
+// tagExprRx matches a search expression consisting of nothing but a
+// single tag: term, optionally quoted, such as `tag:vacation` or
+// `tag:"summer 2016"`. It's deliberately narrow: anything with an
+// AND/OR, a negation, or a second term doesn't match, since there's no
+// general way to turn an arbitrary expression into a single
+// attribute/value pair to claim.
+var tagExprRx = regexp.MustCompile(`^tag:"?([^"]+)"?$`)
+
+// tagExprValue reports the tag value expr names, if expr is a bare
+// tag: expression recognized by tagExprRx, and whether it is one at
+// all.
+func tagExprValue(expr string) (value string, ok bool) {
+	m := tagExprRx.FindStringSubmatch(expr)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// renameBetweenSearchDirs handles Rename when both the source and
+// destination are search result directories rather than one of the
+// by-tag/by-title pseudo-directories Rename already knows about. It
+// only succeeds when both n.searchExp and dest.searchExp are bare
+// tag: expressions (see tagExprValue): the permanode req.OldName
+// resolves to in n then has dest's tag added and n's tag removed,
+// leaving set n and joining set dest without touching the underlying
+// content at all. Anything else returns fuse.EXDEV so the FUSE client
+// falls back to a regular copy+delete.
+func (n *searchResultDir) renameBetweenSearchDirs(ctx context.Context, req *fuse.RenameRequest, dest *searchResultDir) error {
+	if dest.at != nil {
+		return dest.fs.effectiveUnsupportedErrno(UnsupportedImmutable)
+	}
+	oldTag, ok := tagExprValue(n.searchExp)
+	if !ok {
+		return fuse.EXDEV
+	}
+	newTag, ok := tagExprValue(dest.searchExp)
+	if !ok {
+		return fuse.EXDEV
+	}
+	pn, err := n.permanodeFor(ctx, req.OldName)
+	if err != nil {
+		return err
+	}
+	delClaim := schema.NewDelAttributeClaim(pn, "tag", oldTag)
+	if _, err := n.fs.client.UploadAndSignBlob(ctx, delClaim); err != nil {
+		Logger.Printf("fs.searchResultDir: Rename(%q: tag %q -> %q): %v", req.OldName, oldTag, newTag, err)
+		return fuse.EIO
+	}
+	addClaim := schema.NewAddAttributeClaim(pn, "tag", newTag)
+	if _, err := n.fs.client.UploadAndSignBlob(ctx, addClaim); err != nil {
+		Logger.Printf("fs.searchResultDir: Rename(%q: tag %q -> %q): %v", req.OldName, oldTag, newTag, err)
+		return fuse.EIO
+	}
+	n.invalidateCache()
+	dest.invalidateCache()
+	return nil
+}
+
+// renameInPlace handles Rename when source and destination are the
+// same searchResultDir ("mv old.jpg new.jpg" within one "cd"): it sets
+// the permanode's display-name attribute (CamliFileSystem.NameAttribute
+// if configured, else "title") to req.NewName, then re-keys n's cached
+// maps under the new name so the rename is visible immediately rather
+// than waiting out SearchCacheTTL.
+func (n *searchResultDir) renameInPlace(ctx context.Context, req *fuse.RenameRequest) error {
+	pn, err := n.permanodeFor(ctx, req.OldName)
+	if err != nil {
+		return err
+	}
+	attr := n.fs.NameAttribute
+	if attr == "" {
+		attr = "title"
+	}
+	claim := schema.NewSetAttributeClaim(pn, attr, req.NewName)
+	if _, err := n.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+		Logger.Printf("fs.searchResultDir: Rename(%q -> %q): %v", req.OldName, req.NewName, err)
+		return fuse.EIO
+	}
+	n.mu.Lock()
+	n.rekeyLocked(req.OldName, req.NewName)
+	n.mu.Unlock()
+	n.invalidateCache()
+	return nil
+}
+
+// rekeyLocked moves every cached map entry under oldName to newName,
+// the rename counterpart to forgetName's delete. n.mu must be held.
+func (n *searchResultDir) rekeyLocked(oldName, newName string) {
+	if oldName == newName {
+		return
+	}
+	if v, ok := n.ents[oldName]; ok {
+		n.ents[newName] = v
+		delete(n.ents, oldName)
+	}
+	if v, ok := n.permanode[oldName]; ok {
+		n.permanode[newName] = v
+		delete(n.permanode, oldName)
+	}
+	if v, ok := n.pnodeMeta[oldName]; ok {
+		n.pnodeMeta[newName] = v
+		delete(n.pnodeMeta, oldName)
+	}
+	if v, ok := n.imageMeta[oldName]; ok {
+		n.imageMeta[newName] = v
+		delete(n.imageMeta, oldName)
+	}
+	if v, ok := n.sets[oldName]; ok {
+		n.sets[newName] = v
+		delete(n.sets, oldName)
+	}
+	if v, ok := n.symlinks[oldName]; ok {
+		n.symlinks[newName] = v
+		delete(n.symlinks, oldName)
+	}
+	if v, ok := n.modTime[oldName]; ok {
+		n.modTime[newName] = v
+		delete(n.modTime, oldName)
+	}
+	for i, cur := range n.lastNames {
+		if cur == oldName {
+			n.lastNames[i] = newName
+			break
+		}
+	}
+}
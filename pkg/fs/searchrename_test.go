@@ -0,0 +1,87 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// TestRekeyLockedMovesEntry checks that rekeyLocked moves every cached
+// map entry from oldName to newName, leaving no trace of oldName
+// behind, the same way forgetName's delete leaves no trace of a
+// removed entry.
+func TestRekeyLockedMovesEntry(t *testing.T) {
+	pn := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	now := time.Now()
+	n := &searchResultDir{
+		ents:      map[string]*search.DescribedBlob{"old.jpg": {BlobRef: pn}},
+		permanode: map[string]blob.Ref{"old.jpg": pn},
+		pnodeMeta: map[string]*search.DescribedBlob{"old.jpg": {BlobRef: pn}},
+		imageMeta: map[string]*search.DescribedBlob{},
+		sets:      map[string]dir.Entry{},
+		symlinks:  map[string]string{},
+		modTime:   map[string]time.Time{"old.jpg": now},
+		lastNames: []string{"old.jpg", "other.jpg"},
+	}
+
+	n.rekeyLocked("old.jpg", "new.jpg")
+
+	if _, ok := n.ents["old.jpg"]; ok {
+		t.Errorf("ents still has %q after rekey", "old.jpg")
+	}
+	if got, ok := n.ents["new.jpg"]; !ok || got.BlobRef != pn {
+		t.Errorf("ents[%q] = %v, %v; want %v, true", "new.jpg", got, ok, pn)
+	}
+	if got, ok := n.permanode["new.jpg"]; !ok || got != pn {
+		t.Errorf("permanode[%q] = %v, %v; want %v, true", "new.jpg", got, ok, pn)
+	}
+	if got, ok := n.modTime["new.jpg"]; !ok || !got.Equal(now) {
+		t.Errorf("modTime[%q] = %v, %v; want %v, true", "new.jpg", got, ok, now)
+	}
+	wantNames := []string{"new.jpg", "other.jpg"}
+	if len(n.lastNames) != len(wantNames) {
+		t.Fatalf("lastNames = %v; want %v", n.lastNames, wantNames)
+	}
+	for i, w := range wantNames {
+		if n.lastNames[i] != w {
+			t.Errorf("lastNames[%d] = %q; want %q", i, n.lastNames[i], w)
+		}
+	}
+}
+
+// TestRekeyLockedNoopSameName checks that rekeyLocked does nothing
+// when oldName and newName are identical, rather than deleting and
+// re-adding the entry under the same key.
+func TestRekeyLockedNoopSameName(t *testing.T) {
+	pn := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+	n := &searchResultDir{
+		ents:      map[string]*search.DescribedBlob{"same.jpg": {BlobRef: pn}},
+		permanode: map[string]blob.Ref{"same.jpg": pn},
+		lastNames: []string{"same.jpg"},
+	}
+	n.rekeyLocked("same.jpg", "same.jpg")
+	if _, ok := n.ents["same.jpg"]; !ok {
+		t.Errorf("ents lost %q after a same-name rekey", "same.jpg")
+	}
+}
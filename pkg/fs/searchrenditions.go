@@ -0,0 +1,122 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// defaultRenditionDelimiter is the rendition delimiter a searchResultDir
+// uses when its CamliFileSystem.RenditionDelimiter is unset.
+const defaultRenditionDelimiter = "@"
+
+// effectiveRenditionDelimiter reports the delimiter fs actually splits
+// a rendition's sibling name on.
+func (fs *CamliFileSystem) effectiveRenditionDelimiter() string {
+	if fs.RenditionDelimiter != "" {
+		return fs.RenditionDelimiter
+	}
+	return defaultRenditionDelimiter
+}
+
+// addRenditionEntries resolves each of n.fs.RenditionAttrs present on
+// de's permanode and adds a sibling entry for it, named baseName plus
+// the configured view name, into ents/permanode/pnodeMeta/imageMeta/
+// modTime/lastNames -- the same maps de's own entry was just added
+// to. A sibling name that collides with an entry already present
+// (de's own, an earlier rendition, or an unrelated result) is skipped
+// and logged to errLog rather than overwriting it, the same caution
+// stableName's own collision handling takes.
+func (n *searchResultDir) addRenditionEntries(ctx context.Context, baseName string, de dir.Entry, ents map[string]*search.DescribedBlob, permanode map[string]blob.Ref, pnodeMeta, imageMeta map[string]*search.DescribedBlob, modTime map[string]time.Time, lastNames *[]string, errLog *[]string) {
+	if de.PNodeMeta == nil || de.PNodeMeta.Permanode == nil {
+		return
+	}
+	delim := n.fs.effectiveRenditionDelimiter()
+	for attr, view := range n.fs.RenditionAttrs {
+		raw := de.PNodeMeta.Permanode.Attr.Get(attr)
+		if raw == "" {
+			continue
+		}
+		ref, ok := blob.Parse(raw)
+		if !ok {
+			*errLog = append(*errLog, fmt.Sprintf("rendition attr %q on permanode %v doesn't parse as a blobref: %q", attr, de.Permanode, raw))
+			continue
+		}
+		meta, ok := n.describeRendition(ctx, ref)
+		if !ok {
+			continue
+		}
+		name := baseName + delim + view
+		if _, taken := ents[name]; taken {
+			*errLog = append(*errLog, fmt.Sprintf("rendition %q of permanode %v collides with an existing entry; skipped", name, de.Permanode))
+			continue
+		}
+		ents[name] = meta
+		permanode[name] = de.Permanode
+		pnodeMeta[name] = de.PNodeMeta
+		imageMeta[name] = de.Image
+		modTime[name] = n.entryModTime(de)
+		debugf("fs.search: name %q = rendition %q of permanode %v", name, view, de.Permanode)
+		*lastNames = append(*lastNames, name)
+	}
+}
+
+// describeRendition directly describes ref -- a rendition attribute's
+// blobref value -- the same way fallbackContentMeta recovers a
+// camliContent the query's own describe didn't reach, since a
+// rendition attribute isn't itself listed in the describe rule's
+// Attrs and so never comes back described as part of the page. It
+// consults n.fs's shared describedBlobCache first, since more than
+// one overlapping searchResultDir can otherwise end up describing the
+// exact same rendition blobref on every refresh. ok is false if
+// n.fs.client doesn't support direct describes, the describe fails,
+// or ref doesn't resolve to a file or directory.
+func (n *searchResultDir) describeRendition(ctx context.Context, ref blob.Ref) (*search.DescribedBlob, bool) {
+	cache := describedBlobCacheFor(n.fs)
+	if db, ok := cache.get(ref, n.describedBlobCacheMaxAge()); ok {
+		metricsFor(n.fs).IncDescribedBlobCacheHit()
+		return db, true
+	}
+	metricsFor(n.fs).IncDescribedBlobCacheMiss()
+	d, ok := n.fs.client.(dir.Describer)
+	if !ok {
+		return nil, false
+	}
+	req := &search.DescribeRequest{BlobRef: ref}
+	if n.at != nil {
+		req.At = *n.at
+	}
+	res, err := d.Describe(ctx, req)
+	if err != nil {
+		Logger.Printf("fs.search: describing rendition %v: %v", ref, err)
+		return nil, false
+	}
+	meta := res.Meta.Get(ref)
+	if meta == nil || (meta.File == nil && meta.Dir == nil) {
+		return nil, false
+	}
+	cache.put(ref, meta)
+	return meta, true
+}
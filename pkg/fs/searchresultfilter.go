@@ -0,0 +1,31 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "perkeep.org/pkg/search/dir"
+
+// resultFilterAllows reports whether de should be included in n's
+// listing under n.fs.ResultFilter. A nil ResultFilter allows
+// everything.
+func (n *searchResultDir) resultFilterAllows(de dir.Entry) bool {
+	if n.fs.ResultFilter == nil {
+		return true
+	}
+	return n.fs.ResultFilter(de.PNodeMeta)
+}
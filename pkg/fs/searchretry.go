@@ -0,0 +1,63 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// queryRetryMax bounds how many times doReaddir will attempt a single
+// page's dir.ResolvePage call before giving up and surfacing the
+// error, once isTransientQueryErr says the failure is worth retrying
+// at all.
+const queryRetryMax = 3
+
+// queryRetryBaseDelay is the backoff before the first retry;
+// queryRetryDelay doubles it per attempt after that.
+const queryRetryBaseDelay = 200 * time.Millisecond
+
+// queryRetryDelay is the backoff before retrying the page query for
+// the (0-indexed) attempt that just failed: 200ms, 400ms, 800ms, ...
+func queryRetryDelay(attempt int) time.Duration {
+	return queryRetryBaseDelay << attempt
+}
+
+// isTransientQueryErr reports whether err, from a dir.ResolvePage
+// call, looks like a transient condition (a dropped connection, a
+// momentary server hiccup) worth spending doReaddir's retry budget
+// on, as opposed to one that will fail exactly the same way on every
+// attempt. It reuses queryErrno's heuristic classification: a parse
+// or auth error maps to something other than fuse.EIO and is treated
+// as non-retryable, same as everything queryErrno can't otherwise
+// explain is treated as a genuine, possibly-transient I/O failure.
+func isTransientQueryErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The caller's own deadline is what ended this attempt; no
+		// retry would do anything but burn the same budget again.
+		return false
+	}
+	return queryErrno(err) == fuse.EIO
+}
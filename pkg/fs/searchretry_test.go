@@ -0,0 +1,67 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestIsTransientQueryErrClassifiesLikeQueryErrno checks that a
+// generic failure (the kind queryErrno maps to fuse.EIO) is treated
+// as worth retrying, while auth/permission errors (mapped away from
+// fuse.EIO) are not, matching "retry timeouts/5xx, fail fast on
+// auth/permission" from this behavior's request.
+func TestIsTransientQueryErrClassifiesLikeQueryErrno(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"generic", errors.New("unexpected server error"), true},
+		{"unauthorized", errors.New("401 unauthorized"), false},
+		{"forbidden", errors.New("403 forbidden"), false},
+		{"parse", errors.New("parse error in expression"), false},
+		{"nil", nil, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"canceled", context.Canceled, false},
+	}
+	for _, c := range cases {
+		if got := isTransientQueryErr(c.err); got != c.want {
+			t.Errorf("isTransientQueryErr(%s) = %v; want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// TestQueryRetryDelayDoublesPerAttempt checks the 200ms/400ms/800ms...
+// exponential backoff schedule.
+func TestQueryRetryDelayDoublesPerAttempt(t *testing.T) {
+	want := []time.Duration{
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+	}
+	for attempt, w := range want {
+		if got := queryRetryDelay(attempt); got != w {
+			t.Errorf("queryRetryDelay(%d) = %v; want %v", attempt, got, w)
+		}
+	}
+}
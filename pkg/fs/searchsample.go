@@ -0,0 +1,120 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// SampleStrategy selects how sampleNames picks CamliFileSystem.SampleSize
+// entries out of a larger listing.
+type SampleStrategy int
+
+const (
+	// SampleUniform, the zero value and default, picks every
+	// len(names)/SampleSize'th entry, spread evenly across the
+	// listing's sort order: a representative overview of a huge result
+	// set rather than just its first SampleSize entries.
+	SampleUniform SampleStrategy = iota
+	// SampleRandom picks SampleSize entries via a permutation seeded
+	// from CamliFileSystem.SampleSeed, then restores their original
+	// relative order, so the sample varies with the seed instead of
+	// always taking evenly spaced entries, while still being
+	// reproducible for a given seed.
+	SampleRandom
+)
+
+// isMarkerName reports whether name is one of the synthetic marker
+// entries ReadDirAll appends to a listing (truncatedMarkerName,
+// partialMarkerName, emptyMarkerName) rather than a real search
+// result, so sampleLastNamesLocked can leave it out of the pool it
+// samples from and always keep it in the output.
+func isMarkerName(name string) bool {
+	switch name {
+	case truncatedMarkerName, partialMarkerName, emptyMarkerName:
+		return true
+	}
+	return false
+}
+
+// sampleLastNamesLocked replaces n.lastNames with a sample of it per
+// n.fs.SampleSize/SampleStrategy/SampleSeed, leaving any marker names
+// in place at the end. It's a no-op if n.fs.SampleSize is zero. It
+// must be called with n.mu held, after n.lastNames has already been
+// seeded and sorted.
+func (n *searchResultDir) sampleLastNamesLocked() {
+	size := n.fs.SampleSize
+	if size <= 0 {
+		return
+	}
+	real := make([]string, 0, len(n.lastNames))
+	var markers []string
+	for _, name := range n.lastNames {
+		if isMarkerName(name) {
+			markers = append(markers, name)
+		} else {
+			real = append(real, name)
+		}
+	}
+	sampled := sampleNames(real, size, n.fs.SampleStrategy, n.fs.SampleSeed)
+	n.lastNames = append(sampled, markers...)
+}
+
+// sampleNames returns a deterministic subset of size entries from
+// names, which must already be in the listing's effective order.
+// names is returned unchanged if size <= 0 or size >= len(names):
+// sampling only ever shrinks a listing, never pads or reorders one
+// that's already small enough.
+func sampleNames(names []string, size int, strategy SampleStrategy, seed int64) []string {
+	if size <= 0 || size >= len(names) {
+		return names
+	}
+	switch strategy {
+	case SampleRandom:
+		return sampleRandomNames(names, size, seed)
+	default:
+		return sampleUniformNames(names, size)
+	}
+}
+
+// sampleUniformNames picks every len(names)/size'th entry, spread as
+// evenly as integer division allows across the full slice.
+func sampleUniformNames(names []string, size int) []string {
+	out := make([]string, size)
+	total := len(names)
+	for i := 0; i < size; i++ {
+		out[i] = names[i*total/size]
+	}
+	return out
+}
+
+// sampleRandomNames picks size distinct indices from names via a
+// permutation seeded from seed, then sorts them back into names'
+// original order, so a run with the same seed always returns the same
+// entries in the same relative order.
+func sampleRandomNames(names []string, size int, seed int64) []string {
+	indexes := rand.New(rand.NewSource(seed)).Perm(len(names))[:size]
+	sort.Ints(indexes)
+	out := make([]string, size)
+	for i, idx := range indexes {
+		out[i] = names[idx]
+	}
+	return out
+}
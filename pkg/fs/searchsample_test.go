@@ -0,0 +1,89 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func namesOf(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = string(rune('a' + i))
+	}
+	return names
+}
+
+// TestSampleNamesUniform checks that a uniform sample spreads evenly
+// across the full slice rather than taking its first entries, and that
+// an oversized sample size is a no-op.
+func TestSampleNamesUniform(t *testing.T) {
+	names := namesOf(10)
+	got := sampleNames(names, 5, SampleUniform, 0)
+	want := []string{"a", "c", "e", "g", "i"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sampleNames(uniform, 5 of 10) = %v; want %v", got, want)
+	}
+	if got := sampleNames(names, 20, SampleUniform, 0); !reflect.DeepEqual(got, names) {
+		t.Errorf("sampleNames with size >= len(names) = %v; want names unchanged", got)
+	}
+	if got := sampleNames(names, 0, SampleUniform, 0); !reflect.DeepEqual(got, names) {
+		t.Errorf("sampleNames with size 0 = %v; want names unchanged", got)
+	}
+}
+
+// TestSampleNamesRandomDeterministic checks that SampleRandom returns
+// the same sample for the same seed, a different one for a different
+// seed, and always the requested number of names in their original
+// relative order.
+func TestSampleNamesRandomDeterministic(t *testing.T) {
+	names := namesOf(20)
+	first := sampleNames(names, 6, SampleRandom, 42)
+	second := sampleNames(names, 6, SampleRandom, 42)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("sampleNames(random, seed 42) wasn't deterministic: %v vs %v", first, second)
+	}
+	if len(first) != 6 {
+		t.Errorf("len(sampleNames(random, 6 of 20)) = %d; want 6", len(first))
+	}
+	for i := 1; i < len(first); i++ {
+		if first[i-1] >= first[i] {
+			t.Errorf("sampleNames(random) %v not in original relative order", first)
+			break
+		}
+	}
+	other := sampleNames(names, 6, SampleRandom, 43)
+	if reflect.DeepEqual(first, other) {
+		t.Errorf("sampleNames(random, seed 42) and seed 43 gave the same sample %v; expected them to differ", first)
+	}
+}
+
+// TestIsMarkerName checks that it recognizes the synthetic marker
+// entries and nothing else.
+func TestIsMarkerName(t *testing.T) {
+	for _, name := range []string{truncatedMarkerName, partialMarkerName, emptyMarkerName} {
+		if !isMarkerName(name) {
+			t.Errorf("isMarkerName(%q) = false; want true", name)
+		}
+	}
+	if isMarkerName("foo.jpg") {
+		t.Errorf("isMarkerName(%q) = true; want false", "foo.jpg")
+	}
+}
@@ -0,0 +1,96 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FilenameSanitize selects how sanitizeFilename handles characters
+// that are illegal in a path component (such as '/' or NUL), which a
+// permanode's filename attribute is free to contain even though
+// they'd corrupt a fuse.Dirent.Name built from it verbatim.
+type FilenameSanitize int
+
+const (
+	// FilenameSanitizeNone passes illegal characters through
+	// unchanged, preserving the historical behavior.
+	FilenameSanitizeNone FilenameSanitize = iota
+	// FilenameSanitizeUnderscore replaces each illegal character with
+	// '_'.
+	FilenameSanitizeUnderscore
+	// FilenameSanitizePercent percent-encodes each illegal character
+	// (e.g. '/' becomes "%2F"), which is lossier to read but
+	// unambiguous.
+	FilenameSanitizePercent
+)
+
+// isIllegalFilenameRune reports whether r can't appear in a path
+// component on the filesystems CamliFileSystem targets. '/' is
+// exempted when fsys.FilenameNesting is set, since it's no longer a
+// stray character to escape but the separator doReaddir splits a
+// name into a directory hierarchy on; see searchnesting.go.
+func isIllegalFilenameRune(fsys *CamliFileSystem, r rune) bool {
+	if r == '/' {
+		return !fsys.FilenameNesting
+	}
+	return r == 0
+}
+
+// sanitizeFilename applies fsys.FilenameSanitize to name, the same
+// way normalizeFilename applies fsys.FilenameNorm, so every site that
+// derives a fuse.Dirent.Name from a permanode's filename attribute
+// sanitizes it the same way. It's idempotent, so Lookup can re-run it
+// on an incoming name (already in sanitized form, since that's what
+// ReadDirAll listed) and land on the same map key doReaddir stored,
+// without needing a separate reverse mapping.
+func sanitizeFilename(fsys *CamliFileSystem, name string) string {
+	switch fsys.FilenameSanitize {
+	case FilenameSanitizeUnderscore:
+		return strings.Map(func(r rune) rune {
+			if isIllegalFilenameRune(fsys, r) {
+				return '_'
+			}
+			return r
+		}, name)
+	case FilenameSanitizePercent:
+		hasIllegal := false
+		for _, r := range name {
+			if isIllegalFilenameRune(fsys, r) {
+				hasIllegal = true
+				break
+			}
+		}
+		if !hasIllegal {
+			return name
+		}
+		var b strings.Builder
+		for _, r := range name {
+			if isIllegalFilenameRune(fsys, r) {
+				fmt.Fprintf(&b, "%%%02X", r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	default:
+		return name
+	}
+}
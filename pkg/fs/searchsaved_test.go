@@ -0,0 +1,58 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestUniqueSavedSearchNameDedupes checks that two saved searches
+// sharing a title resolve, in encounter order, to "vacation" and
+// "vacation.2", mirroring savedSearches' doc comment.
+func TestUniqueSavedSearchNameDedupes(t *testing.T) {
+	saved := map[string]savedSearch{}
+
+	first := uniqueSavedSearchName("vacation", saved)
+	if first != "vacation" {
+		t.Fatalf("first uniqueSavedSearchName() = %q; want %q", first, "vacation")
+	}
+	saved[first] = savedSearch{Expr: "is:image and tag:hawaii"}
+
+	second := uniqueSavedSearchName("vacation", saved)
+	if second != "vacation.2" {
+		t.Fatalf("second uniqueSavedSearchName() = %q; want %q", second, "vacation.2")
+	}
+	saved[second] = savedSearch{Expr: "is:image and tag:alaska"}
+
+	third := uniqueSavedSearchName("vacation", saved)
+	if third != "vacation.3" {
+		t.Errorf("third uniqueSavedSearchName() = %q; want %q", third, "vacation.3")
+	}
+}
+
+// TestUniqueSavedSearchNameSkipsTaken checks that uniqueSavedSearchName
+// skips past a suffix already claimed in saved, rather than always
+// starting at ".2".
+func TestUniqueSavedSearchNameSkipsTaken(t *testing.T) {
+	saved := map[string]savedSearch{
+		"trips":   {},
+		"trips.2": {},
+	}
+	if got, want := uniqueSavedSearchName("trips", saved), "trips.3"; got != want {
+		t.Errorf("uniqueSavedSearchName() = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// SavedSearchDeletedBehavior selects what happens to an already-built
+// searchResultDir whose saved search was deleted server-side since it
+// was looked up (see CamliFileSystem.SavedSearchDeletedBehavior).
+type SavedSearchDeletedBehavior int
+
+const (
+	// SavedSearchDeletedKeep leaves an orphaned searchResultDir exactly
+	// as it was before this type existed: it keeps refreshing against
+	// its last-known expression indefinitely, a dangling reference to
+	// a saved search that no longer exists. It's the zero value.
+	SavedSearchDeletedKeep SavedSearchDeletedBehavior = iota
+
+	// SavedSearchDeletedDisappear evicts the orphaned directory from
+	// n.fs's searchDirCache on the next top-level ReadDirAll, so a
+	// process already inside it keeps whatever it last saw (no
+	// different than any other searchDirCache eviction), but a fresh
+	// "cd" under that name either resolves it some other way (an
+	// alias or literal expression of the same text) or gets ENOENT.
+	SavedSearchDeletedDisappear
+
+	// SavedSearchDeletedFallback rewrites the orphaned directory's
+	// search expression to
+	// CamliFileSystem.SavedSearchDeletedFallbackExpr and marks it
+	// stale (see SearchDirInfo.Stale) rather than evicting it, so a
+	// process already inside it keeps working, just against a
+	// different query from here on, instead of one referencing a
+	// permanode that's gone.
+	SavedSearchDeletedFallback
+)
+
+// reconcileSavedSearchDirs applies CamliFileSystem.SavedSearchDeletedBehavior
+// to every cached searchResultDir whose savedSearchName no longer
+// appears in saved, n.savedSearches' freshly queried result. It's
+// called from ReadDirAll, the "next top-level refresh" the behavior's
+// own doc comments promise, rather than on any one directory's own
+// refresh, since only a listing of every currently-saved search can
+// tell whether a given one has actually disappeared.
+func (n *searchDir) reconcileSavedSearchDirs(saved map[string]savedSearch) {
+	behavior := n.fs.SavedSearchDeletedBehavior
+	if behavior == SavedSearchDeletedKeep {
+		return
+	}
+	cache := searchDirCacheFor(n.fs)
+	for _, d := range cache.rawSnapshot() {
+		d.mu.Lock()
+		name := d.savedSearchName
+		d.mu.Unlock()
+		if name == "" {
+			continue
+		}
+		if _, ok := saved[name]; ok {
+			continue
+		}
+		switch behavior {
+		case SavedSearchDeletedDisappear:
+			cache.remove(d.cacheKey, d)
+		case SavedSearchDeletedFallback:
+			fallback := n.fs.SavedSearchDeletedFallbackExpr
+			if fallback == "" {
+				continue
+			}
+			d.mu.Lock()
+			d.searchExp = fallback
+			d.stale = true
+			d.mu.Unlock()
+			d.invalidateCache()
+			Logger.Printf("fs.search: saved search %q deleted server-side; directory fell back to %q", name, fallback)
+		}
+	}
+}
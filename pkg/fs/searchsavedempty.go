@@ -0,0 +1,112 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"perkeep.org/pkg/search"
+)
+
+// emptySavedSearchEntry is one cached answer from isSavedSearchEmpty:
+// whether expr had zero matches as of checkedAt.
+type emptySavedSearchEntry struct {
+	empty     bool
+	checkedAt time.Time
+}
+
+// emptySavedSearchCache is CamliFileSystem's per-expression cache of
+// isSavedSearchEmpty results, lazily created by
+// emptySavedSearchCacheFor. Keyed by expression rather than by
+// display name, since two saved searches sharing an expression (or a
+// saved search renamed between refreshes) should share a cache entry.
+type emptySavedSearchCache struct {
+	mu      sync.Mutex
+	entries map[string]emptySavedSearchEntry
+}
+
+var (
+	emptySavedSearchCachesMu sync.Mutex
+	emptySavedSearchCaches   = map[*CamliFileSystem]*emptySavedSearchCache{}
+)
+
+// emptySavedSearchCacheFor returns fsys's emptySavedSearchCache,
+// creating it on first use. It's keyed by fsys the same way
+// failoverStateFor keys a CamliFileSystem's failoverState, since
+// CamliFileSystem itself can't gain an unexported field from this
+// package (it's defined in fs.go).
+func emptySavedSearchCacheFor(fsys *CamliFileSystem) *emptySavedSearchCache {
+	emptySavedSearchCachesMu.Lock()
+	defer emptySavedSearchCachesMu.Unlock()
+	c, ok := emptySavedSearchCaches[fsys]
+	if !ok {
+		c = &emptySavedSearchCache{entries: make(map[string]emptySavedSearchEntry)}
+		emptySavedSearchCaches[fsys] = c
+	}
+	return c
+}
+
+// defaultEmptySavedSearchCacheTTL is how long isSavedSearchEmpty
+// trusts a cached answer before re-checking, when
+// CamliFileSystem.EmptySavedSearchCacheTTL is unset.
+const defaultEmptySavedSearchCacheTTL = time.Minute
+
+func (fsys *CamliFileSystem) effectiveEmptySavedSearchCacheTTL() time.Duration {
+	if fsys.EmptySavedSearchCacheTTL != 0 {
+		return fsys.EmptySavedSearchCacheTTL
+	}
+	return defaultEmptySavedSearchCacheTTL
+}
+
+// isSavedSearchEmpty reports whether expr currently matches nothing,
+// for HideEmptySavedSearches. The answer is cached for
+// effectiveEmptySavedSearchCacheTTL, since ReadDirAll would otherwise
+// pay for a probe query per saved search on every listing; a cache
+// miss issues a Limit: 1 query, the cheapest way to tell "any results"
+// from "no results" without counting them all. A query error leaves
+// the saved search visible (fails open) rather than risking hiding a
+// directory the user expects to see over a transient backend hiccup.
+func (n *searchDir) isSavedSearchEmpty(ctx context.Context, expr string) bool {
+	c := emptySavedSearchCacheFor(n.fs)
+	ttl := n.fs.effectiveEmptySavedSearchCacheTTL()
+
+	c.mu.Lock()
+	entry, ok := c.entries[expr]
+	c.mu.Unlock()
+	if ok && time.Since(entry.checkedAt) < ttl {
+		return entry.empty
+	}
+
+	res, err := n.fs.queryWithFailover(ctx, n.fs.client, &search.SearchQuery{
+		Expression: expr,
+		Limit:      1,
+	})
+	if err != nil {
+		Logger.Printf("fs.search: checking whether saved search %q is empty: %v", expr, err)
+		return false
+	}
+	empty := len(res.Blobs) == 0
+
+	c.mu.Lock()
+	c.entries[expr] = emptySavedSearchEntry{empty: empty, checkedAt: time.Now()}
+	c.mu.Unlock()
+	return empty
+}
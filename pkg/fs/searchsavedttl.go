@@ -0,0 +1,48 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// savedSearchTTLAttr is the permanode attribute a saved search (see
+// savedSearch) can carry to override CamliFileSystem.SearchCacheTTL
+// for just that one search, e.g. "5s" on a "recent uploads" saved
+// search that should refresh far more often than the mount's own
+// default, or "10m" on an expensive, rarely-changing one that
+// shouldn't re-run on every "ls". It's parsed with time.ParseDuration,
+// the same format CamliFileSystem.SearchCacheTTL itself expects from
+// a config file.
+const savedSearchTTLAttr = "cacheTTL"
+
+// savedSearchTTL parses raw (a saved search permanode's
+// savedSearchTTLAttr value) into a TTL override, or nil if raw is
+// empty or doesn't parse, in which case the search falls back to
+// CamliFileSystem.SearchCacheTTL same as before this attribute
+// existed.
+func savedSearchTTL(raw string) *time.Duration {
+	if raw == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil {
+		Logger.Printf("fs.search: saved search %s attr %q: %v", savedSearchTTLAttr, raw, err)
+		return nil
+	}
+	return &ttl
+}
@@ -0,0 +1,46 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "time"
+
+// defaultSchemaMetaTTL is how long searchResultFile.Open trusts the
+// schemaMeta a Lookup resolved it with, when
+// CamliFileSystem.SchemaMetaTTL is unset. Long enough that the common
+// stat-then-open pattern (a directory listing immediately followed by
+// opening one of its entries) always reuses it, short enough that a
+// handle opened long after its Lookup, against content that may have
+// been replaced server-side since, still gets a fresh read.
+const defaultSchemaMetaTTL = 30 * time.Second
+
+// effectiveSchemaMetaTTL reports n.fs.SchemaMetaTTL if set, else
+// defaultSchemaMetaTTL.
+func (n *searchResultFile) effectiveSchemaMetaTTL() time.Duration {
+	if n.fs.SchemaMetaTTL != 0 {
+		return n.fs.SchemaMetaTTL
+	}
+	return defaultSchemaMetaTTL
+}
+
+// schemaMetaFresh reports whether a schemaMeta resolved at at is still
+// within ttl of now, the condition Open checks before reusing it
+// instead of re-fetching and re-parsing n.blobref's schema blob.
+func schemaMetaFresh(at time.Time, ttl time.Duration, now time.Time) bool {
+	return !at.IsZero() && now.Sub(at) < ttl
+}
@@ -0,0 +1,62 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSchemaMetaFresh checks the three cases Open's reuse-vs-refetch
+// branch relies on: a recent resolution is fresh, one older than ttl
+// isn't, and a zero time (no schemaMeta resolved yet) is never fresh
+// regardless of ttl.
+func TestSchemaMetaFresh(t *testing.T) {
+	now := time.Unix(1000, 0)
+	ttl := 30 * time.Second
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"just resolved", now.Add(-time.Second), true},
+		{"right at the edge", now.Add(-ttl), false},
+		{"well past ttl", now.Add(-time.Minute), false},
+		{"never resolved", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		if got := schemaMetaFresh(tt.at, ttl, now); got != tt.want {
+			t.Errorf("%s: schemaMetaFresh(%v, %v, %v) = %v; want %v", tt.name, tt.at, ttl, now, got, tt.want)
+		}
+	}
+}
+
+// TestEffectiveSchemaMetaTTLDefault checks that a zero
+// CamliFileSystem.SchemaMetaTTL leaves defaultSchemaMetaTTL in effect,
+// and that setting it overrides the default.
+func TestEffectiveSchemaMetaTTLDefault(t *testing.T) {
+	n := &searchResultFile{node: node{fs: &CamliFileSystem{}}}
+	if got := n.effectiveSchemaMetaTTL(); got != defaultSchemaMetaTTL {
+		t.Errorf("effectiveSchemaMetaTTL() = %v; want %v", got, defaultSchemaMetaTTL)
+	}
+	n.fs.SchemaMetaTTL = time.Minute
+	if got := n.effectiveSchemaMetaTTL(); got != time.Minute {
+		t.Errorf("effectiveSchemaMetaTTL() with override = %v; want %v", got, time.Minute)
+	}
+}
@@ -0,0 +1,61 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// TestSetattrRejectsTruncate checks that Setattr refuses to truncate
+// an existing search result file to a nonzero size with fuse.EROFS,
+// matching the "no write support yet" behavior searchResultFile
+// otherwise only implies through its read-only mode.
+func TestSetattrRejectsTruncate(t *testing.T) {
+	n := &searchResultFile{node: node{fs: &CamliFileSystem{}}}
+	req := &fuse.SetattrRequest{Valid: fuse.SetattrSize, Size: 100}
+	if err := n.Setattr(context.Background(), req, &fuse.SetattrResponse{}); err != fuse.EROFS {
+		t.Errorf("Setattr(size=100) error = %v; want fuse.EROFS", err)
+	}
+}
+
+// TestSetattrRejectsModeChange checks that Setattr refuses a
+// mode/owner change with fuse.EROFS.
+func TestSetattrRejectsModeChange(t *testing.T) {
+	n := &searchResultFile{node: node{fs: &CamliFileSystem{}}}
+	req := &fuse.SetattrRequest{Valid: fuse.SetattrMode}
+	if err := n.Setattr(context.Background(), req, &fuse.SetattrResponse{}); err != fuse.EROFS {
+		t.Errorf("Setattr(mode change) error = %v; want fuse.EROFS", err)
+	}
+}
+
+// TestSetattrAllowsZeroSizeTruncate checks that a harmless
+// ftruncate(fd, 0) or bare mtime touch is let through as a no-op
+// rather than rejected, since tools like "cp" routinely issue one
+// even when there's nothing to actually truncate.
+func TestSetattrAllowsZeroSizeTruncate(t *testing.T) {
+	n := &searchResultFile{node: node{fs: &CamliFileSystem{}}}
+	req := &fuse.SetattrRequest{Valid: fuse.SetattrSize, Size: 0}
+	var resp fuse.SetattrResponse
+	if err := n.Setattr(context.Background(), req, &resp); err != nil {
+		t.Errorf("Setattr(size=0) error = %v; want nil", err)
+	}
+}
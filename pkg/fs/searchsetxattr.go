@@ -0,0 +1,102 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"strings"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/schema"
+)
+
+// xattrUserCamliPrefix is the only extended attribute namespace
+// Setxattr/Removexattr accept a write against; see camliXattrs for
+// the matching read side. Anything outside it (a system namespace
+// like "security." or "trusted.") is rejected with fuse.EPERM rather
+// than silently doing nothing.
+const xattrUserCamliPrefix = "user.camli."
+
+// Setxattr implements fs.NodeSetxattrer: "setfattr -n user.camli.tags
+// -v vacation photo.jpg" adds "vacation" to the permanode's "tag"
+// attribute, and "setfattr -n user.camli.<attr> -v <value>" sets
+// <attr> to exactly <value>, replacing any value it already had.
+func (n *searchResultFile) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) error {
+	if err := n.fs.checkWritable(); err != nil {
+		return err
+	}
+	attr, ok := camliXattrAttr(req.Name)
+	if !ok {
+		return fuse.EPERM
+	}
+	value := string(req.Xattr)
+	var claim *schema.Builder
+	if attr == "tag" {
+		claim = schema.NewAddAttributeClaim(n.permanode, attr, value)
+	} else {
+		claim = schema.NewSetAttributeClaim(n.permanode, attr, value)
+	}
+	if _, err := n.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+		Logger.Printf("fs.searchResultFile: Setxattr(%q, %q): %v", n.name, req.Name, err)
+		return fuse.EIO
+	}
+	if n.parent != nil {
+		n.parent.invalidateCache()
+	}
+	return nil
+}
+
+// Removexattr implements fs.NodeRemovexattrer, clearing every value
+// the named attribute currently has (schema.NewDelAttributeClaim with
+// an empty value deletes the whole attribute, not just one value of
+// it), the "setfattr -x" counterpart to Setxattr.
+func (n *searchResultFile) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) error {
+	if err := n.fs.checkWritable(); err != nil {
+		return err
+	}
+	attr, ok := camliXattrAttr(req.Name)
+	if !ok {
+		return fuse.EPERM
+	}
+	claim := schema.NewDelAttributeClaim(n.permanode, attr, "")
+	if _, err := n.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+		Logger.Printf("fs.searchResultFile: Removexattr(%q, %q): %v", n.name, req.Name, err)
+		return fuse.EIO
+	}
+	if n.parent != nil {
+		n.parent.invalidateCache()
+	}
+	return nil
+}
+
+// camliXattrAttr maps an extended attribute name to the permanode
+// attribute Setxattr/Removexattr should claim against, and whether
+// name is writable at all: only names under xattrUserCamliPrefix are,
+// with "user.camli.tags" mapped to the underlying "tag" attribute the
+// same way camliXattrs' read side joins it back together.
+func camliXattrAttr(name string) (attr string, ok bool) {
+	attr = strings.TrimPrefix(name, xattrUserCamliPrefix)
+	if attr == name || attr == "" {
+		return "", false
+	}
+	if attr == "tags" {
+		return "tag", true
+	}
+	return attr, true
+}
@@ -0,0 +1,48 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestCamliXattrAttrMapsUserCamliNamespace checks the Setxattr/
+// Removexattr name-to-claim-attribute mapping: "user.camli.tags" goes
+// to the underlying "tag" attribute, any other "user.camli.<attr>"
+// passes <attr> through unchanged, and anything outside the
+// "user.camli." namespace is rejected rather than silently mapped to
+// some permanode attribute of the same name.
+func TestCamliXattrAttrMapsUserCamliNamespace(t *testing.T) {
+	cases := []struct {
+		name     string
+		wantAttr string
+		wantOK   bool
+	}{
+		{"user.camli.tags", "tag", true},
+		{"user.camli.title", "title", true},
+		{"user.camli.", "", false},
+		{"user.camli", "", false},
+		{"security.selinux", "", false},
+		{"trusted.overlay.opaque", "", false},
+	}
+	for _, c := range cases {
+		attr, ok := camliXattrAttr(c.name)
+		if attr != c.wantAttr || ok != c.wantOK {
+			t.Errorf("camliXattrAttr(%q) = %q, %v; want %q, %v", c.name, attr, ok, c.wantAttr, c.wantOK)
+		}
+	}
+}
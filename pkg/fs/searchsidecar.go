@@ -0,0 +1,109 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+)
+
+// sidecarSuffix names the per-entry control file exposing a resolved
+// entry's full permanode metadata as JSON: "foo.jpg.meta.json" reads
+// foo.jpg's current attribute map, richer than the handful of values
+// camliXattrs surfaces and far easier to pull apart with "jq" than
+// extended attributes are. It's resolvable for any entry with a
+// permanode (see searchResultDir.Lookup), not just ones currently
+// listed as a file, the same way tagsFileSuffix is.
+//
+// The underlying describe cache only retains each permanode's latest
+// resolved attribute values, not a claim-by-claim history, so that's
+// all sidecarContents can report; a full claim log would need its own
+// round trip to the server per Lookup, which defeats the point of
+// this being a cheap, cache-backed read.
+const sidecarSuffix = ".meta.json"
+
+// sidecarMeta is sidecarContents' JSON shape: enough to identify the
+// entry plus its complete current attribute map, in contrast to
+// resultsJSONEntry's single-directory-listing summary.
+type sidecarMeta struct {
+	Name           string              `json:"name"`
+	BlobRef        string              `json:"blobRef,omitempty"`        // permanode
+	ContentBlobRef string              `json:"contentBlobRef,omitempty"` // camliContent target
+	MIMEType       string              `json:"mimeType,omitempty"`
+	Size           int64               `json:"size,omitempty"`
+	ModTime        time.Time           `json:"modTime"`
+	Attrs          map[string][]string `json:"attrs"`
+}
+
+// sidecarContents renders sidecarSuffix's content for base, one of
+// n.lastNames. It must be called with n.mu held, since it reads
+// n.ents, n.pnodeMeta, n.permanode, and n.modTime, and returns
+// fuse.ENOENT if base isn't currently a known entry.
+func (n *searchResultDir) sidecarContents(base string) ([]byte, error) {
+	db, ok := n.ents[base]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	meta := sidecarMeta{
+		Name:    base,
+		ModTime: n.modTime[base],
+		Attrs:   map[string][]string{},
+	}
+	if pn := n.permanode[base]; pn.Valid() {
+		meta.BlobRef = pn.String()
+	}
+	if db.BlobRef.Valid() {
+		meta.ContentBlobRef = db.BlobRef.String()
+	}
+	if db.File != nil {
+		meta.MIMEType = db.File.MIMEType
+		meta.Size = db.File.Size
+	}
+	if pmeta := n.pnodeMeta[base]; pmeta != nil && pmeta.Permanode != nil {
+		for k, v := range pmeta.Permanode.Attr {
+			meta.Attrs[k] = v
+		}
+	}
+	return json.MarshalIndent(meta, "", "\t")
+}
+
+// direntsWithSidecars is direntsWithDotfiles, plus one
+// "<name>.meta.json" dirent per name in names when
+// n.fs.ExposeSidecars is set.
+func (n *searchResultDir) direntsWithSidecars(names []string, refs map[string]blob.Ref, kinds map[string]fuse.DirentType) []fuse.Dirent {
+	ents := n.direntsWithDotfiles(names, refs, kinds)
+	if n.fs.ExposeSidecars {
+		for _, name := range names {
+			ents = append(ents, fuse.Dirent{Name: name + sidecarSuffix, Type: fuse.DT_File})
+		}
+	}
+	return ents
+}
+
+// sidecarBase strips sidecarSuffix from name, returning ok=false if
+// name doesn't carry it or is exactly the suffix with no base entry
+// name in front of it.
+func sidecarBase(name string) (base string, ok bool) {
+	base = strings.TrimSuffix(name, sidecarSuffix)
+	return base, base != name && base != ""
+}
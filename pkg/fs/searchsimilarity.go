@@ -0,0 +1,233 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// similarDirName is the reserved name of the read-only subdirectory
+// exposing whatever doReaddir's dedupeBySimilarity pass suppressed
+// from the parent listing, for CamliFileSystem.SimilarityClusterAttr.
+const similarDirName = ".similar"
+
+// similarEntry is everything a suppressed near-duplicate needs to
+// still be Lookup-able under similarDirName, even though it no longer
+// has a name in the parent's own ents/permanode/pnodeMeta/
+// imageMeta/modTime. It's the same shape as dupeEntry, kept as its own
+// type since dedupeBySimilarity groups by a looser, server-chosen
+// notion of "the same" than dedupeByContent's exact blobref match.
+type similarEntry struct {
+	blob      *search.DescribedBlob
+	permanode blob.Ref
+	pnodeMeta *search.DescribedBlob
+	imageMeta *search.DescribedBlob
+	modTime   time.Time
+}
+
+// dedupeBySimilarity groups the names in *lastNames whose permanode
+// carries a non-empty SimilarityClusterAttr value, by that value, the
+// same way dedupeByContent groups by exact content blobref. Within a
+// cluster it keeps one representative in ents/permanode/pnodeMeta/
+// imageMeta/modTime/lastNames, chosen by
+// CamliFileSystem.SimilarityRepresentative, and moves every other
+// member of the cluster into the returned map, keyed by its own
+// (otherwise now-unreferenced) name, for similarDirName to still serve
+// it.
+//
+// A name whose permanode has no SimilarityClusterAttr value at all —
+// including every name, if the server this mount talks to doesn't
+// populate the attribute — never joins a cluster and is left alone;
+// this is what makes the feature a no-op against a server that
+// doesn't expose similarity clusters, per
+// CamliFileSystem.SimilarityClusterAttr's doc comment.
+//
+// It returns nil if nothing was suppressed, so callers can tell
+// "nothing clustered" from "SimilarityClusterAttr is unset" the same
+// way dedupeByContent does for DedupByContent.
+func (n *searchResultDir) dedupeBySimilarity(ents map[string]*search.DescribedBlob, permanode map[string]blob.Ref, pnodeMeta, imageMeta map[string]*search.DescribedBlob, modTime map[string]time.Time, lastNames *[]string) map[string]similarEntry {
+	attr := n.fs.SimilarityClusterAttr
+	survivorByCluster := make(map[string]string)
+	similar := make(map[string]similarEntry)
+	for _, name := range *lastNames {
+		if _, ok := ents[name]; !ok {
+			continue
+		}
+		pm, ok := pnodeMeta[name]
+		if !ok || pm.Permanode == nil {
+			continue
+		}
+		cluster := pm.Permanode.Attr.Get(attr)
+		if cluster == "" {
+			continue
+		}
+		survivor, ok := survivorByCluster[cluster]
+		if !ok {
+			survivorByCluster[cluster] = name
+			continue
+		}
+		loser := name
+		if n.fs.similarityPreferred(name, survivor, ents, modTime) {
+			survivorByCluster[cluster] = name
+			loser = survivor
+		}
+		similar[loser] = similarEntry{
+			blob:      ents[loser],
+			permanode: permanode[loser],
+			pnodeMeta: pnodeMeta[loser],
+			imageMeta: imageMeta[loser],
+			modTime:   modTime[loser],
+		}
+		delete(ents, loser)
+		delete(permanode, loser)
+		delete(pnodeMeta, loser)
+		delete(imageMeta, loser)
+		delete(modTime, loser)
+	}
+	if len(similar) == 0 {
+		return nil
+	}
+	kept := (*lastNames)[:0]
+	for _, name := range *lastNames {
+		if _, isSimilar := similar[name]; !isSimilar {
+			kept = append(kept, name)
+		}
+	}
+	*lastNames = kept
+	Logger.Printf("fs.search: ReadDirAll for '%s' collapsed %d entry(s) into a similarity cluster's representative", n.searchExp, len(similar))
+	return similar
+}
+
+// similarityPreferred reports whether candidate should replace current
+// as its cluster's representative, per
+// CamliFileSystem.SimilarityRepresentative. Ties keep current, the
+// same way dedupeByContent's own comparison does.
+func (fsys *CamliFileSystem) similarityPreferred(candidate, current string, ents map[string]*search.DescribedBlob, modTime map[string]time.Time) bool {
+	switch fsys.SimilarityRepresentative {
+	case SimilarityRepresentativeLargest:
+		return similarityFileSize(ents[candidate]) > similarityFileSize(ents[current])
+	default:
+		return modTime[candidate].After(modTime[current])
+	}
+}
+
+// similarityFileSize returns db's file size, or 0 for a describe
+// result with no File info (e.g. a directory or set caught up in a
+// cluster some other way), so SimilarityRepresentativeLargest still
+// has a total order to compare by.
+func similarityFileSize(db *search.DescribedBlob) int64 {
+	if db == nil || db.File == nil {
+		return 0
+	}
+	return db.File.Size
+}
+
+// similarEntryNode builds the fs.Node a similarEntry resolves to under
+// similarDirName: always read-only, for the same reason
+// dupeEntryNode's result is.
+func similarEntryNode(fsys *CamliFileSystem, d similarEntry) fs.Node {
+	nod := &searchResultFile{
+		node:      node{fs: fsys, blobref: d.blob.BlobRef, pnodeModTime: d.modTime},
+		readOnly:  true,
+		permanode: d.permanode,
+		pnodeMeta: d.pnodeMeta,
+		imageMeta: d.imageMeta,
+	}
+	if d.blob.File != nil {
+		nod.mimeType = d.blob.File.MIMEType
+		nod.size = uint64(d.blob.File.Size)
+		nod.haveSize = true
+	}
+	return nod
+}
+
+// searchSimilarDir lists and resolves the entries dedupeBySimilarity
+// suppressed from its parent. It only "exists" (see
+// searchResultDir.Lookup) once the parent has been seeded and
+// actually collapsed something this round.
+type searchSimilarDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*searchSimilarDir)(nil)
+	_ fs.HandleReadDirAller = (*searchSimilarDir)(nil)
+	_ fs.NodeStringLookuper = (*searchSimilarDir)(nil)
+)
+
+func (d *searchSimilarDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *searchSimilarDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	names := make([]string, 0, len(d.parent.similar))
+	for name := range d.parent.similar {
+		names = append(names, name)
+	}
+	return dirents(names, fuse.DT_File), nil
+}
+
+func (d *searchSimilarDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	d.parent.mu.Lock()
+	sp, ok := d.parent.similar[name]
+	d.parent.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	return similarEntryNode(d.parent.fs, sp), nil
+}
+
+// hasSimilar reports whether n's last ReadDirAll collapsed anything
+// for similarDirName to show, so Lookup can give a plain ENOENT for it
+// rather than an always-empty, always-present directory.
+func (n *searchResultDir) hasSimilar() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.similar) > 0
+}
+
+// SimilarityRepresentative selects which member of a similarity
+// cluster dedupeBySimilarity keeps in the main listing, demoting the
+// rest under similarDirName.
+type SimilarityRepresentative int
+
+const (
+	// SimilarityRepresentativeNewest keeps the most-recently-modified
+	// member of a cluster, the same criterion CamliFileSystem.
+	// DedupByContent uses. It's the zero value.
+	SimilarityRepresentativeNewest SimilarityRepresentative = iota
+	// SimilarityRepresentativeLargest keeps the member with the
+	// largest file size, on the theory that a burst's largest frame is
+	// most likely the least compressed, or the one actually kept after
+	// in-camera culling.
+	SimilarityRepresentativeLargest
+)
@@ -0,0 +1,45 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// SinceQuerier is the subset of *client.Client a server advertises by
+// supporting conditional, since-token re-queries of a search
+// expression, instead of only full ones. doReaddir's tryApplySince
+// uses it to refresh a large, slowly-changing searchResultDir without
+// paying to re-describe every entry expr still matches on every
+// refresh.
+type SinceQuerier interface {
+	// QuerySince reports what changed in expr's results since a
+	// previous QuerySince's returned newSince (the empty string means
+	// "from the beginning"): added is every entry that's new or whose
+	// content changed, removed is every permanode that no longer
+	// matches, and newSince is the token to pass next time. A non-nil
+	// error means the server couldn't compute a delta against since
+	// (e.g. it's too old and already compacted away); the caller
+	// should fall back to a full query rather than trust a partial or
+	// empty result.
+	QuerySince(ctx context.Context, expr string, since string) (added []dir.Entry, removed []blob.Ref, newSince string, err error)
+}
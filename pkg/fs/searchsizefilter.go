@@ -0,0 +1,170 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// sizeFilterGTPrefix and sizeFilterLTPrefix are the "size>" / "size<"
+// tokens parseSizeFilter recognizes anywhere inside a search
+// expression, e.g. "is:image size>5M", requesting only entries whose
+// resolved file size is above (or below) a threshold. Like
+// parseInlineSort's "sort:" token, each is parsed out of the
+// expression before it's ever sent to the server (see
+// effectiveSearchExpr); unlike a sort, which the real search API
+// understands natively, this tree's search.Constraint has nothing to
+// translate a size bound to, so filterBySize applies it itself as a
+// post-filter on ccMeta.File.Size once describe has resolved each
+// result (see doReaddir).
+const (
+	sizeFilterGTPrefix = "size>"
+	sizeFilterLTPrefix = "size<"
+)
+
+// sizeFilterUnset is parseSizeFilter's sentinel for "no bound on this
+// side", since 0 is a legitimate minimum (an empty file) and can't
+// double as "unset".
+const sizeFilterUnset int64 = -1
+
+// parseSizeFilter scans expr for whitespace-delimited sizeFilterGTPrefix
+// and sizeFilterLTPrefix tokens and reports the byte thresholds they
+// request, with both tokens removed from trimmed. found is true as
+// soon as either token is seen at all, even one whose size doesn't
+// parse, so a caller can tell "no directive" (found=false) apart from
+// "a bad one" (found=true, err set) rather than treating both as "no
+// filter". Only the first occurrence of each token is honored, the
+// same convention parseInlineSort uses for "sort:".
+func parseSizeFilter(expr string) (trimmed string, minSize, maxSize int64, found bool, err error) {
+	minSize, maxSize = sizeFilterUnset, sizeFilterUnset
+	fields := strings.Fields(expr)
+	kept := fields[:0:0]
+	var haveMin, haveMax bool
+	for _, f := range fields {
+		switch {
+		case !haveMin && strings.HasPrefix(f, sizeFilterGTPrefix):
+			v, perr := parseSizeToken(strings.TrimPrefix(f, sizeFilterGTPrefix))
+			found = true
+			if perr != nil {
+				return "", sizeFilterUnset, sizeFilterUnset, true, fmt.Errorf("malformed %q: %v", f, perr)
+			}
+			minSize, haveMin = v, true
+		case !haveMax && strings.HasPrefix(f, sizeFilterLTPrefix):
+			v, perr := parseSizeToken(strings.TrimPrefix(f, sizeFilterLTPrefix))
+			found = true
+			if perr != nil {
+				return "", sizeFilterUnset, sizeFilterUnset, true, fmt.Errorf("malformed %q: %v", f, perr)
+			}
+			maxSize, haveMax = v, true
+		default:
+			kept = append(kept, f)
+		}
+	}
+	if !found {
+		return expr, sizeFilterUnset, sizeFilterUnset, false, nil
+	}
+	return strings.Join(kept, " "), minSize, maxSize, true, nil
+}
+
+// parseSizeToken parses a human-readable byte count such as "5M",
+// "2.5G", or a plain "1024" with no suffix, in the same binary units
+// (1K = 1<<10, etc.) sizeBucketFor uses for bySizeDirName.
+func parseSizeToken(s string) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+	mult := int64(1)
+	switch last := s[len(s)-1]; last {
+	case 'k', 'K':
+		mult = 1 << 10
+	case 'm', 'M':
+		mult = 1 << 20
+	case 'g', 'G':
+		mult = 1 << 30
+	}
+	numPart := s
+	if mult != 1 {
+		numPart = s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(numPart, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", s, err)
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("negative size %q", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+// effectiveSizeFilter reports the byte bounds n's ReadDirAll filters
+// by: the thresholds an inline "size>"/"size<" token in n.searchExp
+// requests (see parseSizeFilter), or sizeFilterUnset on either side
+// with no such token. A token whose size doesn't parse is treated the
+// same as no token at all here; doReaddir checks for that error itself
+// and fails the read outright rather than silently ignoring it, so
+// this is never the only place it's caught.
+func (n *searchResultDir) effectiveSizeFilter() (minSize, maxSize int64) {
+	if _, minSize, maxSize, found, err := parseSizeFilter(n.searchExp); found && err == nil {
+		return minSize, maxSize
+	}
+	return sizeFilterUnset, sizeFilterUnset
+}
+
+// filterBySize removes every name in *lastNames whose resolved file
+// size falls outside [minSize, maxSize], either bound being
+// sizeFilterUnset to leave it open on that side. An entry with no
+// resolved size at all (a set, symlink, or contentless permanode) is
+// left alone rather than excluded, since "big files only" has nothing
+// meaningful to say about something that isn't sized. Unlike
+// dedupeByContent, it returns only how many were excluded, since
+// there's no dupesDirName-style sibling view to resurface them under.
+func (n *searchResultDir) filterBySize(ents map[string]*search.DescribedBlob, permanode map[string]blob.Ref, pnodeMeta, imageMeta map[string]*search.DescribedBlob, modTime map[string]time.Time, lastNames *[]string, minSize, maxSize int64) int {
+	if minSize == sizeFilterUnset && maxSize == sizeFilterUnset {
+		return 0
+	}
+	var excluded int
+	kept := (*lastNames)[:0]
+	for _, name := range *lastNames {
+		db := ents[name]
+		if db != nil && db.File != nil {
+			size := db.File.Size
+			if (minSize != sizeFilterUnset && size < minSize) || (maxSize != sizeFilterUnset && size > maxSize) {
+				excluded++
+				delete(ents, name)
+				delete(permanode, name)
+				delete(pnodeMeta, name)
+				delete(imageMeta, name)
+				delete(modTime, name)
+				continue
+			}
+		}
+		kept = append(kept, name)
+	}
+	*lastNames = kept
+	if excluded > 0 {
+		Logger.Printf("fs.search: ReadDirAll for '%s' filtered out %d entry(s) outside the requested size range", n.searchExp, excluded)
+	}
+	return excluded
+}
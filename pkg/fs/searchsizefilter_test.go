@@ -0,0 +1,126 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+func TestParseSizeFilterSuffixes(t *testing.T) {
+	cases := []struct {
+		expr             string
+		trimmed          string
+		minSize, maxSize int64
+	}{
+		{"is:image size>5M", "is:image", 5 << 20, sizeFilterUnset},
+		{"is:image size<2G", "is:image", sizeFilterUnset, 2 << 30},
+		{"is:image size>1K size<1M", "is:image", 1 << 10, 1 << 20},
+		{"is:image size>1024", "is:image", 1024, sizeFilterUnset},
+		{"is:image size>2.5M", "is:image", int64(2.5 * (1 << 20)), sizeFilterUnset},
+	}
+	for _, c := range cases {
+		trimmed, minSize, maxSize, found, err := parseSizeFilter(c.expr)
+		if err != nil {
+			t.Errorf("parseSizeFilter(%q) error = %v", c.expr, err)
+			continue
+		}
+		if !found {
+			t.Errorf("parseSizeFilter(%q) found = false; want true", c.expr)
+			continue
+		}
+		if trimmed != c.trimmed {
+			t.Errorf("parseSizeFilter(%q) trimmed = %q; want %q", c.expr, trimmed, c.trimmed)
+		}
+		if minSize != c.minSize {
+			t.Errorf("parseSizeFilter(%q) minSize = %d; want %d", c.expr, minSize, c.minSize)
+		}
+		if maxSize != c.maxSize {
+			t.Errorf("parseSizeFilter(%q) maxSize = %d; want %d", c.expr, maxSize, c.maxSize)
+		}
+	}
+}
+
+func TestParseSizeFilterNoToken(t *testing.T) {
+	trimmed, _, _, found, err := parseSizeFilter("is:image tag:vacation")
+	if found || err != nil {
+		t.Fatalf("parseSizeFilter(no token) = %q, found=%v, err=%v; want found=false, err=nil", trimmed, found, err)
+	}
+	if trimmed != "is:image tag:vacation" {
+		t.Errorf("parseSizeFilter(no token) trimmed = %q; want expr unchanged", trimmed)
+	}
+}
+
+func TestParseSizeFilterMalformedIsRejected(t *testing.T) {
+	_, _, _, found, err := parseSizeFilter("is:image size>bogus")
+	if !found {
+		t.Fatalf("parseSizeFilter(bad size) found = false; want true")
+	}
+	if err == nil {
+		t.Fatalf("parseSizeFilter(bad size) error = nil; want non-nil")
+	}
+}
+
+func TestFilterBySizeExcludesOutOfRangeAndLeavesUnsizedAlone(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image size>1M"}
+
+	ents := map[string]*search.DescribedBlob{
+		"small.jpg": {File: &search.DescribedFile{Size: 100}},
+		"big.jpg":   {File: &search.DescribedFile{Size: 5 << 20}},
+		"adir":      {Dir: &search.DescribedDir{}},
+	}
+	permanode := map[string]blob.Ref{}
+	pnodeMeta := map[string]*search.DescribedBlob{}
+	imageMeta := map[string]*search.DescribedBlob{}
+	modTime := map[string]time.Time{}
+	lastNames := []string{"small.jpg", "big.jpg", "adir"}
+
+	excluded := n.filterBySize(ents, permanode, pnodeMeta, imageMeta, modTime, &lastNames, 1<<20, sizeFilterUnset)
+	if excluded != 1 {
+		t.Fatalf("filterBySize excluded = %d; want 1", excluded)
+	}
+	if _, ok := ents["small.jpg"]; ok {
+		t.Error("small.jpg still in ents; want removed (below size>1M)")
+	}
+	if _, ok := ents["big.jpg"]; !ok {
+		t.Error("big.jpg removed from ents; want kept (above size>1M)")
+	}
+	if _, ok := ents["adir"]; !ok {
+		t.Error("adir removed from ents; want kept (unsized entries pass through untouched)")
+	}
+	want := []string{"big.jpg", "adir"}
+	if len(lastNames) != len(want) {
+		t.Fatalf("lastNames = %v; want %v", lastNames, want)
+	}
+	for i, name := range want {
+		if lastNames[i] != name {
+			t.Errorf("lastNames[%d] = %q; want %q", i, lastNames[i], name)
+		}
+	}
+}
+
+func TestEffectiveSearchExprStripsSizeFilter(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}, searchExp: "is:image size>5M"}
+	if got, want := n.effectiveSearchExpr(), "is:image"; got != want {
+		t.Errorf("effectiveSearchExpr() = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,110 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"time"
+)
+
+// smartFolderPollInterval is how often runSmartFolderRefresh wakes up
+// to check every registered dir's own TTL, when
+// CamliFileSystem.SmartFolderRefresh is set. It's independent of any
+// one dir's effectiveSearchCacheTTL, which can be configured far
+// finer than this; this just bounds how promptly a just-expired TTL
+// is noticed.
+const smartFolderPollInterval = time.Second
+
+// runSmartFolderRefresh proactively re-reads every dir registered
+// with w that's dueForRefresh, instead of waiting for a caller's own
+// ReadDirAll or Lookup to trigger that refresh. Its refresh runs
+// doReaddir exactly as a normal one would, including invalidateDiff's
+// targeted kernel notifications (see CamliFileSystem.Server) for
+// whatever changed since the dir's previous listing, so a watch-aware
+// application with a kernel inotify watch on the mountpoint sees those
+// changes without ever polling the directory itself: the "smart
+// folder" behavior CamliFileSystem.SmartFolderRefresh's doc comment
+// promises. Because it refreshes shortly before a dir's own TTL
+// actually lapses (see dueForRefresh), a caller's own ReadDirAll
+// arriving right after finds a warm cache instead of blocking on the
+// network.
+//
+// It runs for as long as w exists, which today is the lifetime of its
+// CamliFileSystem, since nothing currently tears a searchWatcher down
+// once started.
+func (w *searchWatcher) runSmartFolderRefresh() {
+	ticker := time.NewTicker(smartFolderPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		w.refreshDue()
+	}
+}
+
+// refreshDue is one runSmartFolderRefresh tick's worth of work,
+// factored out so a test can drive it directly without waiting on
+// smartFolderPollInterval.
+func (w *searchWatcher) refreshDue() {
+	for _, n := range w.registered() {
+		if !n.dueForRefresh() {
+			continue
+		}
+		if _, err := n.refresh(context.Background()); err != nil {
+			Logger.Printf("fs.search: smart-folder refresh of %q: %v", n.searchExp, err)
+		}
+	}
+}
+
+// smartFolderRefreshMarginDivisor is what a dir's own
+// effectiveSearchCacheTTL is divided by to decide how far ahead of it
+// lapsing dueForRefresh considers a proactive refresh worthwhile, the
+// same proportional approach effectiveRefreshDebounce takes for its
+// own window: a quarter of the TTL gives the refresh query time to
+// land before the TTL actually expires, without the dir spending most
+// of its life mid-refresh on a long TTL.
+const smartFolderRefreshMarginDivisor = 4
+
+// recentAccessWindow bounds how long after markAccessed last recorded
+// a real Open or Lookup against a dir dueForRefresh keeps it eligible
+// for proactive refresh. A dir stays registered with w until the
+// kernel drops its last reference (see Forget), well after interactive
+// use of it may have actually stopped; without this, every such dir
+// would cost a query per TTL forever. Past this window, the next real
+// ReadDirAll or Lookup just pays for one on-demand refresh like it
+// always did before SmartFolderRefresh existed.
+const recentAccessWindow = 5 * time.Minute
+
+// dueForRefresh reports whether n has been accessed recently enough
+// (see markAccessed and recentAccessWindow) that it's worth proactively
+// refreshing, and is either unseeded or close enough to its own
+// effectiveSearchCacheTTL lapsing (within smartFolderRefreshMarginDivisor's
+// margin) that runSmartFolderRefresh should refresh it now rather than
+// wait for a caller to notice it's stale.
+func (n *searchResultDir) dueForRefresh() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.lastAccessed.IsZero() || time.Since(n.lastAccessed) > recentAccessWindow {
+		return false
+	}
+	if n.lastReaddir.IsZero() {
+		return true
+	}
+	ttl := n.effectiveSearchCacheTTL()
+	margin := ttl / smartFolderRefreshMarginDivisor
+	return time.Since(n.lastReaddir) >= ttl-margin
+}
@@ -0,0 +1,127 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestDueForRefreshRequiresRecentAccess checks that dueForRefresh only
+// considers a dir for proactive refresh if it's been accessed (see
+// markAccessed) within recentAccessWindow, regardless of how close its
+// TTL is to lapsing.
+func TestDueForRefreshRequiresRecentAccess(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{SearchCacheTTL: time.Minute}}
+	n.lastReaddir = time.Now().Add(-59 * time.Second) // 1s left on a 1m TTL: within margin
+	if n.dueForRefresh() {
+		t.Error("dueForRefresh() = true before markAccessed was ever called; want false")
+	}
+	n.lastAccessed = time.Now().Add(-(recentAccessWindow + time.Second))
+	if n.dueForRefresh() {
+		t.Error("dueForRefresh() = true for access older than recentAccessWindow; want false")
+	}
+	n.lastAccessed = time.Now()
+	if !n.dueForRefresh() {
+		t.Error("dueForRefresh() = false for a recently accessed dir within its TTL's margin; want true")
+	}
+}
+
+// TestDueForRefreshMargin checks that dueForRefresh only fires once a
+// dir is within smartFolderRefreshMarginDivisor's margin of its own
+// TTL lapsing, not the instant it's merely been read once.
+func TestDueForRefreshMargin(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{SearchCacheTTL: time.Minute}}
+	n.lastAccessed = time.Now()
+	n.lastReaddir = time.Now() // just refreshed: nowhere near due
+	if n.dueForRefresh() {
+		t.Error("dueForRefresh() = true right after a refresh; want false")
+	}
+	n.lastReaddir = time.Now().Add(-59 * time.Second) // 1s left, well inside the 15s margin
+	if !n.dueForRefresh() {
+		t.Error("dueForRefresh() = false inside the margin; want true")
+	}
+}
+
+// TestMarkAccessedEnablesDueForRefresh checks that markAccessed (called
+// from Open and Lookup) is what makes a freshly-registered, never-read
+// dir eligible for proactive refresh in the first place.
+func TestMarkAccessedEnablesDueForRefresh(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	if n.dueForRefresh() {
+		t.Error("dueForRefresh() = true before any access; want false")
+	}
+	n.markAccessed()
+	if !n.dueForRefresh() {
+		t.Error("dueForRefresh() = false for an accessed, never-seeded dir; want true")
+	}
+}
+
+// TestRefreshDueStopsOnForget checks that once a dir is unregistered
+// (as Forget does), refreshDue's next tick no longer touches it, even
+// though it would otherwise be dueForRefresh: the background
+// refresher's work for a forgotten dir stops instead of racing
+// Forget's own cleanup of n's maps.
+func TestRefreshDueStopsOnForget(t *testing.T) {
+	w := &searchWatcher{fs: &CamliFileSystem{}, dirs: make(map[*searchResultDir]bool)}
+	n := &searchResultDir{fs: w.fs}
+	n.markAccessed()
+	w.register(n)
+	w.unregister(n)
+
+	w.refreshDue()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.lastReaddir.IsZero() {
+		t.Error("lastReaddir changed by refreshDue after unregister; want untouched")
+	}
+	if n.inflight != nil {
+		t.Error("inflight set by refreshDue after unregister; want refresh never attempted")
+	}
+}
+
+// TestReadDirAllServesWarmCacheAfterProactiveRefresh checks that once a
+// proactive refresh has landed (simulated here by resetting
+// lastReaddir, the effect a real n.refresh success has), a ReadDirAll
+// arriving after what would have been the original TTL deadline is
+// served from the pre-warmed cache instead of blocking on a query.
+func TestReadDirAllServesWarmCacheAfterProactiveRefresh(t *testing.T) {
+	const ttl = 100 * time.Millisecond
+	n := &searchResultDir{fs: &CamliFileSystem{SearchCacheTTL: ttl}, lastNames: []string{"a.jpg"}}
+	n.lastAccessed = time.Now()
+	n.lastReaddir = time.Now().Add(-80 * time.Millisecond) // 20ms left, inside the 25ms margin
+	if !n.dueForRefresh() {
+		t.Fatal("dueForRefresh() = false; want true so the scenario below is meaningful")
+	}
+
+	// Simulate runSmartFolderRefresh's proactive n.refresh landing
+	// before the original deadline (now+20ms) arrives.
+	n.lastReaddir = time.Now()
+
+	time.Sleep(30 * time.Millisecond) // past the original deadline, still within the new one
+	ents, err := n.ReadDirAll(context.Background())
+	if err != nil {
+		t.Fatalf("ReadDirAll() error = %v", err)
+	}
+	if len(ents) != 1 || ents[0].Name != "a.jpg" {
+		t.Errorf("ReadDirAll() = %v; want the pre-warmed listing served from cache, not a fresh query", ents)
+	}
+}
@@ -0,0 +1,72 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+)
+
+// dirWithModTimes builds a searchResultDir seeded with names, each
+// given times[i] as its permanode modtime, and names in arrival (i.e.
+// not yet sorted) order, for exercising sortLastNames'
+// SearchSortByModTimeAsc/Desc ordering.
+func dirWithModTimes(fsys *CamliFileSystem, names []string, times []time.Time) *searchResultDir {
+	modTime := make(map[string]time.Time, len(names))
+	for i, name := range names {
+		modTime[name] = times[i]
+	}
+	return &searchResultDir{
+		fs:        fsys,
+		lastNames: append([]string{}, names...),
+		modTime:   modTime,
+	}
+}
+
+// TestSortLastNamesModTimeDescNewestFirst checks that
+// SearchSortByModTimeDesc orders three entries with distinct known
+// modtimes newest-first, regardless of their arrival order.
+func TestSortLastNamesModTimeDescNewestFirst(t *testing.T) {
+	fsys := &CamliFileSystem{SearchSortBy: SearchSortByModTimeDesc}
+	base := time.Unix(1000, 0)
+	names := []string{"old", "newest", "middle"}
+	times := []time.Time{base, base.Add(2 * time.Hour), base.Add(time.Hour)}
+	n := dirWithModTimes(fsys, names, times)
+	n.sortLastNames()
+	want := []string{"newest", "middle", "old"}
+	if !namesEqual(n.lastNames, want) {
+		t.Errorf("sortLastNames() with SearchSortByModTimeDesc = %v; want %v", n.lastNames, want)
+	}
+}
+
+// TestSortLastNamesModTimeAscOldestFirst checks that
+// SearchSortByModTimeAsc orders the same three entries oldest-first,
+// the reverse of SearchSortByModTimeDesc.
+func TestSortLastNamesModTimeAscOldestFirst(t *testing.T) {
+	fsys := &CamliFileSystem{SearchSortBy: SearchSortByModTimeAsc}
+	base := time.Unix(1000, 0)
+	names := []string{"old", "newest", "middle"}
+	times := []time.Time{base, base.Add(2 * time.Hour), base.Add(time.Hour)}
+	n := dirWithModTimes(fsys, names, times)
+	n.sortLastNames()
+	want := []string{"old", "middle", "newest"}
+	if !namesEqual(n.lastNames, want) {
+		t.Errorf("sortLastNames() with SearchSortByModTimeAsc = %v; want %v", n.lastNames, want)
+	}
+}
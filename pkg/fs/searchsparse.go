@@ -0,0 +1,48 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// defaultSparseReadahead is the chunk size rangedFileHandle fetches
+// per cache miss for a file at or above SparseFileThreshold, when
+// CamliFileSystem.SparseReadahead is left at its zero value: small
+// enough that seeking around a multi-gigabyte archive container (e.g.
+// to read just its index) doesn't pull substantially more of it across
+// the network than was actually asked for.
+const defaultSparseReadahead = 64 << 10 // 64KB
+
+// effectiveSparseReadahead reports the chunk size fs actually applies
+// per cache miss for a SparseFileThreshold-sized file: its configured
+// SparseReadahead if positive, otherwise defaultSparseReadahead.
+func (fsys *CamliFileSystem) effectiveSparseReadahead() int {
+	if fsys.SparseReadahead > 0 {
+		return fsys.SparseReadahead
+	}
+	return defaultSparseReadahead
+}
+
+// effectiveReadahead reports the readahead window a rangedFileHandle
+// for a file of size should use: effectiveSparseReadahead's smaller
+// window if SparseFileThreshold is set and size meets it, else
+// effectiveReadaheadWindow's.
+func (fsys *CamliFileSystem) effectiveReadahead(size uint64) int {
+	if fsys.SparseFileThreshold > 0 && size >= uint64(fsys.SparseFileThreshold) {
+		return fsys.effectiveSparseReadahead()
+	}
+	return fsys.effectiveReadaheadWindow()
+}
@@ -0,0 +1,45 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestEffectiveReadahead checks that SparseFileThreshold only swaps in
+// SparseReadahead's smaller window for a file that meets it, and that
+// leaving it at zero never changes the existing ReadaheadWindow
+// behavior regardless of file size.
+func TestEffectiveReadahead(t *testing.T) {
+	const gb = 1 << 30
+	fsys := &CamliFileSystem{ReadaheadWindow: 1 << 20}
+	if got := fsys.effectiveReadahead(10 * gb); got != 1<<20 {
+		t.Errorf("effectiveReadahead with no SparseFileThreshold = %d; want ReadaheadWindow (%d)", got, 1<<20)
+	}
+
+	fsys.SparseFileThreshold = gb
+	fsys.SparseReadahead = 32 << 10
+	if got := fsys.effectiveReadahead(100); got != 1<<20 {
+		t.Errorf("effectiveReadahead(100) below threshold = %d; want ReadaheadWindow (%d)", got, 1<<20)
+	}
+	if got := fsys.effectiveReadahead(gb); got != 32<<10 {
+		t.Errorf("effectiveReadahead(gb) at threshold = %d; want SparseReadahead (%d)", got, 32<<10)
+	}
+	if got := fsys.effectiveReadahead(10 * gb); got != 32<<10 {
+		t.Errorf("effectiveReadahead(10gb) above threshold = %d; want SparseReadahead (%d)", got, 32<<10)
+	}
+}
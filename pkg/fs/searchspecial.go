@@ -0,0 +1,90 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// SpecialContentPolicy selects what dir.ResolvePage does with an
+// entry whose camliContent resolved, but to a schema type that isn't
+// a file, directory, symlink, or static set -- typically a
+// unix-special file (a fifo, socket, or device node) an importer
+// recorded via a "camliUnixType" permanode attribute since its bytes
+// couldn't be uploaded as ordinary camliContent.
+type SpecialContentPolicy int
+
+const (
+	// SpecialContentSkip drops the entry from the listing, preserving
+	// the historical behavior.
+	SpecialContentSkip SpecialContentPolicy = iota
+
+	// SpecialContentRepresent exposes a recognized camliUnixType
+	// instead: entryNode represents a fifo or socket as the matching
+	// FUSE node type, and falls back to a placeholder file for a
+	// chardev or blockdev, since exposing one of those as a live FUSE
+	// node would let whatever opens it through the mount reach the
+	// host's own numbered device.
+	SpecialContentRepresent
+)
+
+// effectiveSpecialContentPolicy reports the dir.SpecialContentPolicy
+// fs actually applies to its searchResultDirs.
+func (fs *CamliFileSystem) effectiveSpecialContentPolicy() dir.SpecialContentPolicy {
+	if fs.SpecialContentPolicy == SpecialContentRepresent {
+		return dir.SpecialContentRepresent
+	}
+	return dir.SpecialContentSkip
+}
+
+// specialFileNode represents a dir.Entry with IsSpecial set as the
+// FUSE node type matching its SpecialType: a fifo or a socket. Its
+// content is never read or written, any more than a symlink's target
+// is; it exists purely so a faithful filesystem backup browsed
+// through the mount still shows the entry as the kind of special file
+// it actually was, instead of as an ordinary file or not at all.
+type specialFileNode struct {
+	node
+	permanode blob.Ref
+	kind      string // "fifo" or "socket"
+}
+
+var _ fs.Node = (*specialFileNode)(nil)
+
+func (n *specialFileNode) Attr(ctx context.Context, a *fuse.Attr) error {
+	n.node.Attr(ctx, a)
+	switch n.kind {
+	case "socket":
+		a.Mode = os.ModeSocket | 0600
+	default:
+		a.Mode = os.ModeNamedPipe | 0600
+	}
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	if n.permanode.Valid() {
+		a.Inode = inodeTableFor(n.fs).inodeFor(n.permanode)
+	}
+	return nil
+}
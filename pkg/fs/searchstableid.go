@@ -0,0 +1,34 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"path/filepath"
+
+	"perkeep.org/pkg/search/dir"
+)
+
+// stableIDName derives de's StableIDNames display name: its
+// permanode's own blobref, plus de.Name's extension if it has one, so
+// a consumer that dispatches on file extension (e.g. an image viewer)
+// still works even though the rest of the name carries no human
+// meaning.
+func stableIDName(de dir.Entry) string {
+	return de.Permanode.String() + filepath.Ext(de.Name)
+}
@@ -0,0 +1,188 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+)
+
+// starFileSuffix names the per-entry control file exposing and
+// toggling an entry's "favorite" status: "foo.jpg.star" reads "1\n" if
+// foo.jpg's permanode has effectiveStarAttr() set to a non-empty value,
+// "0\n" otherwise, and a write of "1" or "0" sets or clears it via a
+// single set-attribute/del-attribute claim. It's resolvable for any
+// entry with a permanode, the same as tagsFileSuffix.
+const starFileSuffix = ".star"
+
+// defaultStarAttr is used in place of a zero CamliFileSystem.StarAttr.
+const defaultStarAttr = "star"
+
+// effectiveStarAttr reports the attribute name fs actually stars by.
+func (fs *CamliFileSystem) effectiveStarAttr() string {
+	if fs.StarAttr != "" {
+		return fs.StarAttr
+	}
+	return defaultStarAttr
+}
+
+// searchStarFile is starFileSuffix's Node: Attr/Open only, since
+// reading and writing both need a Handle that snapshots the star
+// status current as of Open (see searchStarHandle).
+type searchStarFile struct {
+	dir       *searchResultDir
+	name      string
+	permanode blob.Ref
+}
+
+var (
+	_ fs.Node       = (*searchStarFile)(nil)
+	_ fs.NodeOpener = (*searchStarFile)(nil)
+)
+
+func (f *searchStarFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Valid = f.dir.fs.effectiveAttrValidity()
+	a.Size = uint64(len(renderStar(f.currentlyStarred())))
+	return nil
+}
+
+// currentlyStarred reports whether name's permanode, as last seeded by
+// doReaddir/lookupTargeted, has fs.effectiveStarAttr() set to a
+// non-empty value.
+func (f *searchStarFile) currentlyStarred() bool {
+	f.dir.mu.Lock()
+	defer f.dir.mu.Unlock()
+	meta := f.dir.pnodeMeta[f.name]
+	if meta == nil || meta.Permanode == nil {
+		return false
+	}
+	for _, v := range meta.Permanode.Attr[f.dir.fs.effectiveStarAttr()] {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// renderStar is the star file's read content.
+func renderStar(starred bool) string {
+	if starred {
+		return "1\n"
+	}
+	return "0\n"
+}
+
+// parseStar is renderStar's inverse: anything starting with "1" or
+// "t"/"T" (as in "true") is starred, everything else, including an
+// empty write, clears it.
+func parseStar(content string) bool {
+	content = strings.TrimSpace(content)
+	return strings.HasPrefix(content, "1") || strings.HasPrefix(content, "t") || strings.HasPrefix(content, "T")
+}
+
+// Open implements fs.NodeOpener. The returned handle snapshots f's
+// star status as of now, so Release can diff against exactly what
+// Read would have shown, regardless of what doReaddir does to f.dir
+// in between.
+func (f *searchStarFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	return &searchStarHandle{file: f, existing: f.currentlyStarred()}, nil
+}
+
+// searchStarHandle buffers a full write between Open and Release, the
+// same way searchTagsHandle does, since the new status has to be known
+// completely before it can be diffed against existing.
+type searchStarHandle struct {
+	file     *searchStarFile
+	existing bool
+	data     []byte
+	wrote    bool
+}
+
+var (
+	_ fs.Handle         = (*searchStarHandle)(nil)
+	_ fs.HandleReader   = (*searchStarHandle)(nil)
+	_ fs.HandleWriter   = (*searchStarHandle)(nil)
+	_ fs.HandleReleaser = (*searchStarHandle)(nil)
+)
+
+func (h *searchStarHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := renderStar(h.existing)
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = []byte(content[req.Offset:end])
+	return nil
+}
+
+// Write implements fs.HandleWriter. Only sequential, in-order writes
+// are supported, the same restriction searchTagsHandle.Write makes and
+// for the same reason: that's all a plain "echo 1 >" needs. When
+// writing is disabled, the write is rejected up front rather than
+// accepted and silently dropped at Release.
+func (h *searchStarHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := h.file.dir.fs.checkWritable(); err != nil {
+		return err
+	}
+	if req.Offset != int64(len(h.data)) {
+		Logger.Printf("fs.searchStarFile: Write(%q): out-of-order write at offset %d (have %d bytes)", h.file.name, req.Offset, len(h.data))
+		return fuse.EIO
+	}
+	h.wrote = true
+	h.data = append(h.data, req.Data...)
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// Release implements fs.HandleReleaser: a handle that was only ever
+// read from (h.wrote is false) leaves the permanode untouched; one
+// that was written to sets or clears fs.effectiveStarAttr() via a
+// single set-attribute or del-attribute claim, but only if the written
+// status actually differs from h.existing.
+func (h *searchStarHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	if !h.wrote {
+		return nil
+	}
+	want := parseStar(string(h.data))
+	if want == h.existing {
+		return nil
+	}
+	attr := h.file.dir.fs.effectiveStarAttr()
+	var err error
+	if want {
+		_, err = h.file.dir.fs.client.UploadAndSignBlob(ctx, schema.NewSetAttributeClaim(h.file.permanode, attr, "1"))
+	} else {
+		_, err = h.file.dir.fs.client.UploadAndSignBlob(ctx, schema.NewDelAttributeClaim(h.file.permanode, attr, "1"))
+	}
+	if err != nil {
+		Logger.Printf("fs.searchStarFile: Release(%q): setting %s=%v: %v", h.file.name, attr, want, err)
+		return fuse.EIO
+	}
+	h.file.dir.invalidateCache()
+	return nil
+}
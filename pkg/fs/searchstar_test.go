@@ -0,0 +1,68 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestParseStar checks that parseStar recognizes the usual ways of
+// writing "true" and treats everything else, including an empty
+// write, as clearing the star.
+func TestParseStar(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"1", true},
+		{"1\n", true},
+		{"true", true},
+		{"True\n", true},
+		{"0", false},
+		{"0\n", false},
+		{"false", false},
+		{"", false},
+		{"  ", false},
+	}
+	for _, tt := range tests {
+		if got := parseStar(tt.content); got != tt.want {
+			t.Errorf("parseStar(%q) = %v; want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+// TestRenderStar checks renderStar's output is parseStar's inverse.
+func TestRenderStar(t *testing.T) {
+	for _, starred := range []bool{true, false} {
+		if got := parseStar(renderStar(starred)); got != starred {
+			t.Errorf("parseStar(renderStar(%v)) = %v; want %v", starred, got, starred)
+		}
+	}
+}
+
+// TestEffectiveStarAttr checks the zero value falls back to
+// defaultStarAttr.
+func TestEffectiveStarAttr(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	if got := fsys.effectiveStarAttr(); got != defaultStarAttr {
+		t.Errorf("effectiveStarAttr() on zero value = %q; want %q", got, defaultStarAttr)
+	}
+	fsys.StarAttr = "favorite"
+	if got := fsys.effectiveStarAttr(); got != "favorite" {
+		t.Errorf("effectiveStarAttr() = %q; want %q", got, "favorite")
+	}
+}
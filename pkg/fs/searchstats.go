@@ -0,0 +1,53 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"time"
+)
+
+// searchStatsFileName is a hidden, per-searchResultDir file reporting
+// this directory's own query metrics, as plain key/value lines, for an
+// operator who wants a quick "how's this directory behaving" check
+// without wiring up CamliFileSystem.Metrics. Unlike facetsFileName and
+// timelineFileName, reading it never calls ensureSeeded: its content
+// comes straight from the counters ReadDirAll already maintains on n
+// (see searchStatsFileContents), so a read never triggers a query of
+// its own, even the very first time the directory is ever looked at.
+// Like facetsFileName and timelineFileName, it's only resolvable via
+// Lookup, and only listed in ReadDirAll with ShowDotfiles, when
+// CamliFileSystem.EnableSearchStatsFile is set.
+const searchStatsFileName = ".searchstats"
+
+// searchStatsFileContents renders searchStatsFileName's content from
+// n's query counters. It must be called with n.mu held.
+func (n *searchResultDir) searchStatsFileContents() []byte {
+	var b []byte
+	b = append(b, fmt.Sprintf("last query duration: %s\n", n.lastQueryDuration)...)
+	b = append(b, fmt.Sprintf("last result count: %d\n", n.lastResultCount)...)
+	b = append(b, fmt.Sprintf("cache hits: %d\n", n.statsCacheHits)...)
+	b = append(b, fmt.Sprintf("cache misses: %d\n", n.statsCacheMisses)...)
+	if n.lastReaddir.IsZero() {
+		b = append(b, "last refresh: never\n"...)
+	} else {
+		b = append(b, fmt.Sprintf("last refresh: %s\n", n.lastReaddir.Format(time.RFC3339))...)
+	}
+	return b
+}
@@ -0,0 +1,66 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSearchStatsFileContentsNeverQueried checks that a directory
+// that's never had a ReadDirAll reports "never" for its last refresh,
+// rather than a zero time or an error.
+func TestSearchStatsFileContentsNeverQueried(t *testing.T) {
+	n := &searchResultDir{fs: &CamliFileSystem{}}
+	got := string(n.searchStatsFileContents())
+	if !strings.Contains(got, "last refresh: never\n") {
+		t.Errorf("searchStatsFileContents() = %q; want it to report never refreshed", got)
+	}
+	if !strings.Contains(got, "cache hits: 0\n") || !strings.Contains(got, "cache misses: 0\n") {
+		t.Errorf("searchStatsFileContents() = %q; want zero cache hits/misses", got)
+	}
+}
+
+// TestSearchStatsFileContentsAfterQueries checks that a cache hit and
+// a miss, and the duration/result count doReaddir recorded for the
+// miss, all show up in searchStatsFileContents, reflecting the node's
+// own counters directly rather than requiring another query.
+func TestSearchStatsFileContentsAfterQueries(t *testing.T) {
+	n := &searchResultDir{
+		fs:                &CamliFileSystem{},
+		statsCacheHits:    2,
+		statsCacheMisses:  1,
+		lastQueryDuration: 150 * time.Millisecond,
+		lastResultCount:   7,
+		lastReaddir:       time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	got := string(n.searchStatsFileContents())
+	for _, want := range []string{
+		"last query duration: 150ms\n",
+		"last result count: 7\n",
+		"cache hits: 2\n",
+		"cache misses: 1\n",
+		"last refresh: 2020-01-02T03:04:05Z\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("searchStatsFileContents() = %q; want it to contain %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// statusFileName is a hidden file at the "search" directory's own
+// root reporting this mount's health: connectivity to the server,
+// when a query last succeeded, and any recent query errors. Unlike
+// README.txt, which is purely static configuration, it's regenerated
+// fresh on every read from queryStatsFor's live state, so "cat
+// mount/search/.status" works as a quick health check without
+// external tooling. Like refreshFileName and camlifsFileName, it's
+// always resolvable via Lookup but never listed in ReadDirAll.
+const statusFileName = ".status"
+
+// maxStatusRecentErrors bounds how many recent query errors
+// queryStats.contents reports, so a server that's been down a long
+// time doesn't make .status grow without bound.
+const maxStatusRecentErrors = 5
+
+// queryStats tracks one CamliFileSystem's query outcomes across every
+// searchResultDir sharing it, for statusFileName. It's updated from
+// doReaddir's query attempt loop unconditionally, regardless of
+// whether CircuitBreakerEnabled is set, so connectivity is visible
+// even on a mount that never opted into the breaker itself.
+type queryStats struct {
+	mu             sync.Mutex
+	lastAttempt    time.Time
+	lastSuccess    time.Time
+	lastWasSuccess bool
+	recentErrs     []string
+	totalQueries   int
+	totalFailures  int
+}
+
+// queryStatsRegistry holds each CamliFileSystem's queryStats, keyed by
+// pointer identity the same way searchbreaker.go's breakers registry
+// is.
+var (
+	queryStatsMu       sync.Mutex
+	queryStatsRegistry = map[*CamliFileSystem]*queryStats{}
+)
+
+// queryStatsFor returns fsys's shared queryStats, creating it the
+// first time any searchResultDir asks for it.
+func queryStatsFor(fsys *CamliFileSystem) *queryStats {
+	queryStatsMu.Lock()
+	defer queryStatsMu.Unlock()
+	if st, ok := queryStatsRegistry[fsys]; ok {
+		return st
+	}
+	st := &queryStats{}
+	queryStatsRegistry[fsys] = st
+	return st
+}
+
+// recordResult updates st from one query attempt's outcome, as
+// doReaddir's attempt loop calls it after every dir.ResolvePage call.
+func (st *queryStats) recordResult(expr string, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.lastAttempt = time.Now()
+	st.totalQueries++
+	st.lastWasSuccess = err == nil
+	if err == nil {
+		st.lastSuccess = st.lastAttempt
+		return
+	}
+	st.totalFailures++
+	line := fmt.Sprintf("%s: %s: %v", st.lastAttempt.Format(time.RFC3339), expr, err)
+	st.recentErrs = append(st.recentErrs, line)
+	if len(st.recentErrs) > maxStatusRecentErrors {
+		st.recentErrs = st.recentErrs[len(st.recentErrs)-maxStatusRecentErrors:]
+	}
+}
+
+// contents renders statusFileName's content from st, the breaker
+// shared with fsys (if CircuitBreakerEnabled), and fsys's blob and
+// searchResultDir caches.
+func (st *queryStats) contents(fsys *CamliFileSystem) []byte {
+	st.mu.Lock()
+	lastAttempt, lastSuccess, lastWasSuccess := st.lastAttempt, st.lastSuccess, st.lastWasSuccess
+	totalQueries, totalFailures := st.totalQueries, st.totalFailures
+	recentErrs := append([]string(nil), st.recentErrs...)
+	st.mu.Unlock()
+
+	var b bytes.Buffer
+	// connected reflects only the most recent attempt: a mount that
+	// failed once and hasn't queried since still reports disconnected,
+	// even if an earlier query once succeeded.
+	connected := !lastAttempt.IsZero() && lastWasSuccess
+	fmt.Fprintf(&b, "connected: %v\n", connected)
+	if lastSuccess.IsZero() {
+		fmt.Fprintf(&b, "last successful query: never\n")
+	} else {
+		fmt.Fprintf(&b, "last successful query: %s\n", lastSuccess.Format(time.RFC3339))
+	}
+	if lastAttempt.IsZero() {
+		fmt.Fprintf(&b, "last query attempt: never\n")
+	} else {
+		fmt.Fprintf(&b, "last query attempt: %s\n", lastAttempt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "total queries: %d (%d failed)\n", totalQueries, totalFailures)
+
+	if fsys.CircuitBreakerEnabled {
+		open, failures, openUntil := breakerFor(fsys).status()
+		fmt.Fprintf(&b, "circuit breaker: open=%v consecutive failures=%d", open, failures)
+		if open {
+			fmt.Fprintf(&b, " reopens at %s", openUntil.Format(time.RFC3339))
+		}
+		fmt.Fprintln(&b)
+	}
+
+	cache := blobCacheFor(fsys)
+	items, curBytes, maxBytes := cache.stats()
+	fmt.Fprintf(&b, "blob cache: %d entries, %d/%d bytes\n", items, curBytes, maxBytes)
+
+	describeCache := describedBlobCacheFor(fsys)
+	describeItems, describeMax := describeCache.stats()
+	fmt.Fprintf(&b, "describe cache: %d/%d entries\n", describeItems, describeMax)
+
+	dirCache := searchDirCacheFor(fsys)
+	dirs, dirsCap := dirCache.stats()
+	fmt.Fprintf(&b, "search dir cache: %d/%d directories\n", dirs, dirsCap)
+	for _, info := range fsys.CachedSearchDirs() {
+		age := "never listed"
+		if info.Entries > 0 || info.Age != 0 {
+			age = info.Age.String()
+		}
+		fmt.Fprintf(&b, "  %q: %d entries, age %s, ~%d bytes\n", info.Expr, info.Entries, age, info.ApproxBytes)
+	}
+
+	if len(recentErrs) == 0 {
+		fmt.Fprintf(&b, "recent errors: none\n")
+	} else {
+		fmt.Fprintf(&b, "recent errors:\n")
+		for _, line := range recentErrs {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+	return b.Bytes()
+}
+
+// statusFile is statusFileName's Node and Handle: a read-only file
+// whose content is generated fresh on every Read from queryStatsFor's
+// live state, the same on-read-generation staticFileNode otherwise
+// handles for a fixed string.
+type statusFile struct {
+	fs *CamliFileSystem
+}
+
+var (
+	_ fs.Node         = statusFile{}
+	_ fs.HandleReader = statusFile{}
+)
+
+func (f statusFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0444
+	a.Valid = f.fs.effectiveAttrValidity()
+	return nil
+}
+
+func (f statusFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := queryStatsFor(f.fs).contents(f.fs)
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = content[req.Offset:end]
+	return nil
+}
@@ -0,0 +1,118 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// byBlobRefViewDir is searchDir's own reserved name, matching
+// searchDir.lookupBlobRef: "search/<blobref>" is this mount's
+// by-blobref view of whatever permanode <blobref> names, independent
+// of any particular search result that happens to list it.
+const byBlobRefViewDir = "search"
+
+// byBlobRefSymlink is what entryNode returns in place of a set's or a
+// plain content entry's own resolved node when SymlinkContent is set:
+// a symlink into the permanode's by-blobref view
+// (byBlobRefViewDir/<blobref>) instead of the fully resolved
+// directory or file, the symlink counterpart to HardlinkContent's
+// shared-inode aliasing, for a tool that follows symlinks but doesn't
+// recognize two inodes sharing st_ino as the same content.
+type byBlobRefSymlink struct {
+	node
+	permanode blob.Ref
+}
+
+var (
+	_ fs.Node           = (*byBlobRefSymlink)(nil)
+	_ fs.NodeReadlinker = (*byBlobRefSymlink)(nil)
+)
+
+func (n *byBlobRefSymlink) Attr(ctx context.Context, a *fuse.Attr) error {
+	n.node.Attr(ctx, a)
+	a.Mode = os.ModeSymlink | 0777
+	a.Valid = n.fs.effectiveAttrValidity()
+	if n.permanode.Valid() {
+		a.Inode = inodeTableFor(n.fs).inodeFor(n.permanode)
+	}
+	return nil
+}
+
+// Readlink reports n.permanode's by-blobref view path, computed by
+// blobRefSymlinkTarget; see CamliFileSystem.RelativeSymlinkTargets.
+func (n *byBlobRefSymlink) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	return n.fs.blobRefSymlinkTarget(n.permanode), nil
+}
+
+// ValidateImageSymlinks reports an error if fsys combines
+// SymlinkImagesToOriginal with Thumbnailer or ExposeSidecars, the way
+// ValidateNameTemplate checks NameTemplate, so a mount's setup path
+// can fail immediately on a confused configuration instead of each
+// image silently losing its thumbnail or sidecar later. A fsys with
+// SymlinkImagesToOriginal unset returns nil without doing anything.
+func ValidateImageSymlinks(fsys *CamliFileSystem) error {
+	if !fsys.SymlinkImagesToOriginal {
+		return nil
+	}
+	if fsys.Thumbnailer != nil {
+		return errors.New("fs: SymlinkImagesToOriginal can't be combined with a Thumbnailer")
+	}
+	if fsys.ExposeSidecars {
+		return errors.New("fs: SymlinkImagesToOriginal can't be combined with ExposeSidecars")
+	}
+	return nil
+}
+
+// symlinkToOriginal reports whether entryNode represents e as a
+// byBlobRefSymlink rather than its usual node, for either
+// SymlinkContent (every eligible entry) or SymlinkImagesToOriginal
+// (image entries only). An entry is eligible only once it has a real
+// permanode and isn't already a symlink, contentless, or a
+// placeholder, each of which entryNode already represents its own,
+// more specific way.
+func symlinkToOriginal(fsys *CamliFileSystem, e dir.Entry) bool {
+	if !e.Permanode.Valid() || e.IsSymlink || e.IsContentless || e.IsPlaceholder {
+		return false
+	}
+	return fsys.SymlinkContent || (fsys.SymlinkImagesToOriginal && e.Image != nil)
+}
+
+// blobRefSymlinkTarget reports the byBlobRefSymlink target for pn:
+// "search/<blobref>" relative to this mount's root when
+// RelativeSymlinkTargets is set, or that same path rooted at
+// MountPoint (or, lacking one, at "/") otherwise.
+func (fsys *CamliFileSystem) blobRefSymlinkTarget(pn blob.Ref) string {
+	rel := path.Join(byBlobRefViewDir, pn.String())
+	if fsys.RelativeSymlinkTargets {
+		return rel
+	}
+	if fsys.MountPoint != "" {
+		return path.Join(fsys.MountPoint, rel)
+	}
+	return "/" + rel
+}
@@ -0,0 +1,130 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/search/dir"
+)
+
+// TestBlobRefSymlinkTargetRelative checks that RelativeSymlinkTargets
+// reports a target relative to the mount's own root, ignoring
+// MountPoint entirely.
+func TestBlobRefSymlinkTargetRelative(t *testing.T) {
+	pn := blob.RefFromString("some content")
+	fsys := &CamliFileSystem{RelativeSymlinkTargets: true, MountPoint: "/mnt/camli"}
+	got := fsys.blobRefSymlinkTarget(pn)
+	want := "search/" + pn.String()
+	if got != want {
+		t.Errorf("blobRefSymlinkTarget() = %q; want %q", got, want)
+	}
+}
+
+// TestBlobRefSymlinkTargetAbsolute checks the zero-value (absolute)
+// behavior, both with and without MountPoint set.
+func TestBlobRefSymlinkTargetAbsolute(t *testing.T) {
+	pn := blob.RefFromString("some content")
+
+	fsys := &CamliFileSystem{MountPoint: "/mnt/camli"}
+	got := fsys.blobRefSymlinkTarget(pn)
+	want := "/mnt/camli/search/" + pn.String()
+	if got != want {
+		t.Errorf("blobRefSymlinkTarget() with MountPoint = %q; want %q", got, want)
+	}
+
+	fsys = &CamliFileSystem{}
+	got = fsys.blobRefSymlinkTarget(pn)
+	want = "/search/" + pn.String()
+	if got != want {
+		t.Errorf("blobRefSymlinkTarget() without MountPoint = %q; want %q", got, want)
+	}
+}
+
+// TestSymlinkToOriginalImagesOnly checks that SymlinkImagesToOriginal
+// symlinks an image entry but leaves a non-image one alone, unlike
+// SymlinkContent, which takes every eligible entry regardless of
+// type.
+func TestSymlinkToOriginalImagesOnly(t *testing.T) {
+	fsys := &CamliFileSystem{SymlinkImagesToOriginal: true}
+	pn := blob.RefFromString("a permanode")
+
+	image := dir.Entry{Permanode: pn, Image: &search.DescribedBlob{}}
+	if !symlinkToOriginal(fsys, image) {
+		t.Error("symlinkToOriginal(image entry) = false; want true")
+	}
+
+	doc := dir.Entry{Permanode: pn}
+	if symlinkToOriginal(fsys, doc) {
+		t.Error("symlinkToOriginal(non-image entry) = true; want false")
+	}
+
+	// A symlink, contentless, or placeholder entry already has its
+	// own, more specific representation; symlinkToOriginal must defer
+	// to that even if it's nominally an image.
+	special := dir.Entry{Permanode: pn, Image: &search.DescribedBlob{}, IsContentless: true}
+	if symlinkToOriginal(fsys, special) {
+		t.Error("symlinkToOriginal(contentless image entry) = true; want false")
+	}
+}
+
+// TestEntryNodeSymlinksImageToOriginal checks that entryNode, with
+// SymlinkImagesToOriginal set, resolves an image entry to a
+// byBlobRefSymlink whose Readlink target is the entry's permanode
+// under this mount's own by-blobref view.
+func TestEntryNodeSymlinksImageToOriginal(t *testing.T) {
+	fsys := &CamliFileSystem{SymlinkImagesToOriginal: true}
+	pn := blob.RefFromString("a photo's permanode")
+	e := dir.Entry{Permanode: pn, Image: &search.DescribedBlob{}}
+
+	got := entryNode(fsys, e, nil)
+	sym, ok := got.(*byBlobRefSymlink)
+	if !ok {
+		t.Fatalf("entryNode() = %T; want *byBlobRefSymlink", got)
+	}
+	target, err := sym.Readlink(context.Background(), &fuse.ReadlinkRequest{})
+	if err != nil {
+		t.Fatalf("Readlink() error = %v", err)
+	}
+	if want := "/search/" + pn.String(); target != want {
+		t.Errorf("Readlink() = %q; want %q", target, want)
+	}
+}
+
+// TestValidateImageSymlinks checks that combining
+// SymlinkImagesToOriginal with either Thumbnailer or ExposeSidecars
+// is rejected, while either alone, or neither, is fine.
+func TestValidateImageSymlinks(t *testing.T) {
+	if err := ValidateImageSymlinks(&CamliFileSystem{}); err != nil {
+		t.Errorf("ValidateImageSymlinks(unset) = %v; want nil", err)
+	}
+	if err := ValidateImageSymlinks(&CamliFileSystem{SymlinkImagesToOriginal: true}); err != nil {
+		t.Errorf("ValidateImageSymlinks(alone) = %v; want nil", err)
+	}
+	if err := ValidateImageSymlinks(&CamliFileSystem{SymlinkImagesToOriginal: true, Thumbnailer: &fakeThumbnailer{}}); err == nil {
+		t.Error("ValidateImageSymlinks(with Thumbnailer) = nil; want an error")
+	}
+	if err := ValidateImageSymlinks(&CamliFileSystem{SymlinkImagesToOriginal: true, ExposeSidecars: true}); err == nil {
+		t.Error("ValidateImageSymlinks(with ExposeSidecars) = nil; want an error")
+	}
+}
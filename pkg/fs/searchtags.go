@@ -0,0 +1,194 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+)
+
+// tagsFileSuffix names the per-entry control file exposing and
+// editing an entry's "tag" attribute: "foo.jpg.tags" reads foo.jpg's
+// current tags, one per line, and a write replaces them with exactly
+// the lines written, via add-attribute/del-attribute claims against
+// foo.jpg's permanode. It's resolvable for any entry with a
+// permanode (see searchResultDir.Lookup), not just ones currently
+// listed as a file.
+const tagsFileSuffix = ".tags"
+
+// searchTagsFile is tagsFileSuffix's Node: Attr/Open only, since
+// reading and writing both need a Handle that snapshots the tags
+// current as of Open (see searchTagsHandle).
+type searchTagsFile struct {
+	dir       *searchResultDir
+	name      string
+	permanode blob.Ref
+}
+
+var (
+	_ fs.Node       = (*searchTagsFile)(nil)
+	_ fs.NodeOpener = (*searchTagsFile)(nil)
+)
+
+func (f *searchTagsFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = 0644
+	a.Valid = f.dir.fs.effectiveAttrValidity()
+	a.Size = uint64(len(renderTags(f.currentTags())))
+	return nil
+}
+
+// currentTags returns name's tag values as last seeded by
+// doReaddir/lookupTargeted, i.e. whatever's in f.dir.pnodeMeta.
+func (f *searchTagsFile) currentTags() []string {
+	f.dir.mu.Lock()
+	defer f.dir.mu.Unlock()
+	meta := f.dir.pnodeMeta[f.name]
+	if meta == nil || meta.Permanode == nil {
+		return nil
+	}
+	return meta.Permanode.Attr["tag"]
+}
+
+// renderTags is the tags file's read content: one tag per line, in
+// whatever order the permanode's describe meta returned them.
+func renderTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return strings.Join(tags, "\n") + "\n"
+}
+
+// parseTags is renderTags's inverse: blank lines are dropped and
+// duplicates are collapsed, so writing the same tag twice isn't two
+// add-attribute claims for it.
+func parseTags(content string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, line := range strings.Split(content, "\n") {
+		tag := strings.TrimSpace(line)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// Open implements fs.NodeOpener. The returned handle snapshots f's
+// tags as of now, so Release can diff against exactly what Read would
+// have shown, regardless of what doReaddir does to f.dir in between.
+func (f *searchTagsFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	return &searchTagsHandle{file: f, existing: f.currentTags()}, nil
+}
+
+// searchTagsHandle buffers a full write between Open and Release, the
+// same way searchCreateHandle does, since the new tag set has to be
+// known completely before it can be diffed against existing.
+type searchTagsHandle struct {
+	file     *searchTagsFile
+	existing []string
+	buf      bytes.Buffer
+	wrote    bool
+}
+
+var (
+	_ fs.Handle         = (*searchTagsHandle)(nil)
+	_ fs.HandleReader   = (*searchTagsHandle)(nil)
+	_ fs.HandleWriter   = (*searchTagsHandle)(nil)
+	_ fs.HandleReleaser = (*searchTagsHandle)(nil)
+)
+
+func (h *searchTagsHandle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	content := renderTags(h.existing)
+	if req.Offset >= int64(len(content)) {
+		return nil
+	}
+	end := req.Offset + int64(req.Size)
+	if end > int64(len(content)) {
+		end = int64(len(content))
+	}
+	resp.Data = []byte(content[req.Offset:end])
+	return nil
+}
+
+// Write implements fs.HandleWriter. Only sequential, in-order writes
+// are supported, the same restriction searchCreateHandle.Write makes
+// and for the same reason: that's all a plain "cp"/editor save needs.
+func (h *searchTagsHandle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := h.file.dir.fs.checkWritable(); err != nil {
+		return err
+	}
+	if req.Offset != int64(h.buf.Len()) {
+		Logger.Printf("fs.searchTagsFile: Write(%q): out-of-order write at offset %d (have %d bytes)", h.file.name, req.Offset, h.buf.Len())
+		return fuse.EIO
+	}
+	h.wrote = true
+	n, err := h.buf.Write(req.Data)
+	resp.Size = n
+	return err
+}
+
+// Release implements fs.HandleReleaser: a handle that was only ever
+// read from (h.wrote is false) leaves the permanode untouched; one
+// that was written to replaces h.existing with whatever was written,
+// via one add-attribute claim per newly-present tag and one
+// del-attribute claim per tag that's no longer there.
+func (h *searchTagsHandle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	if !h.wrote {
+		return nil
+	}
+	newTags := parseTags(h.buf.String())
+	had := make(map[string]bool, len(h.existing))
+	for _, tag := range h.existing {
+		had[tag] = true
+	}
+	want := make(map[string]bool, len(newTags))
+	for _, tag := range newTags {
+		want[tag] = true
+	}
+	for _, tag := range h.existing {
+		if want[tag] {
+			continue
+		}
+		claim := schema.NewDelAttributeClaim(h.file.permanode, "tag", tag)
+		if _, err := h.file.dir.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+			Logger.Printf("fs.searchTagsFile: Release(%q): removing tag %q: %v", h.file.name, tag, err)
+			return fuse.EIO
+		}
+	}
+	for _, tag := range newTags {
+		if had[tag] {
+			continue
+		}
+		claim := schema.NewAddAttributeClaim(h.file.permanode, "tag", tag)
+		if _, err := h.file.dir.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+			Logger.Printf("fs.searchTagsFile: Release(%q): adding tag %q: %v", h.file.name, tag, err)
+			return fuse.EIO
+		}
+	}
+	h.file.dir.invalidateCache()
+	return nil
+}
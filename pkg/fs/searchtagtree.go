@@ -0,0 +1,218 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/schema"
+)
+
+// byTagTreeDirName is the reserved name of the faceted sibling view
+// under a search result directory: instead of one entry per result,
+// it has one subdirectory per distinct "tag" value present across
+// n.ents (already resolved by ReadDirAll, and already carrying every
+// attr including "tag" in its pnodeMeta; no further describe rule or
+// query is needed), each listing the names carrying that tag. A name
+// with no "tag" at all is bucketed under untaggedTagBucketName
+// instead. Like byContentDirName, it only "exists" once the parent
+// has been seeded.
+const byTagTreeDirName = ".by-tag"
+
+// untaggedTagBucketName is byTagTreeDir's bucket for names with no
+// "tag" attribute at all, the same way dupesDirName/errorsDirName
+// bucket their own outliers.
+const untaggedTagBucketName = "_untagged"
+
+// tagsFor returns name's "tag" attribute values from n.pnodeMeta, the
+// same slice camliXattrs reads for user.camli.tags. It must be called
+// with n.mu held.
+func (n *searchResultDir) tagsFor(name string) []string {
+	pm := n.pnodeMeta[name]
+	if pm == nil || pm.Permanode == nil {
+		return nil
+	}
+	return pm.Permanode.Attr["tag"]
+}
+
+// tagBuckets groups n.ents by tag value, collecting names with no tag
+// at all under untaggedTagBucketName. A name carrying more than one
+// tag appears under every one of them. It must be called with n.mu
+// held.
+func (n *searchResultDir) tagBuckets() map[string][]string {
+	buckets := make(map[string][]string)
+	for name := range n.ents {
+		tags := n.tagsFor(name)
+		if len(tags) == 0 {
+			buckets[untaggedTagBucketName] = append(buckets[untaggedTagBucketName], name)
+			continue
+		}
+		for _, tag := range tags {
+			buckets[tag] = append(buckets[tag], name)
+		}
+	}
+	return buckets
+}
+
+// hasTagTree reports whether n's last ReadDirAll has anything for
+// byTagTreeDirName to show, so Lookup can give a plain ENOENT for it
+// before the parent's ever been seeded rather than an always-empty,
+// always-present directory.
+func (n *searchResultDir) hasTagTree() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.ents) > 0
+}
+
+// byTagTreeDir lists the tag values present across its parent's
+// current results, one subdirectory per value (plus
+// untaggedTagBucketName), each resolving to a bucketDir.
+type byTagTreeDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*byTagTreeDir)(nil)
+	_ fs.HandleReadDirAller = (*byTagTreeDir)(nil)
+	_ fs.NodeStringLookuper = (*byTagTreeDir)(nil)
+)
+
+func (d *byTagTreeDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *byTagTreeDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	buckets := d.parent.tagBuckets()
+	names := make([]string, 0, len(buckets))
+	for tag := range buckets {
+		names = append(names, tag)
+	}
+	return dirents(names, fuse.DT_Dir), nil
+}
+
+func (d *byTagTreeDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	members, ok := d.parent.tagBuckets()[name]
+	d.parent.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	tag := name
+	if tag == untaggedTagBucketName {
+		tag = ""
+	}
+	return &bucketDir{parent: d.parent, names: members, tag: tag}, nil
+}
+
+// bucketDir lists a fixed set of names grouped by some describe-rule
+// attribute's value (tag, album, or whatever else buckets a
+// searchResultDir's entries), delegating Lookup back to the parent so
+// each resolves with the same permanode/xattr info a direct Lookup
+// against the parent would give. byTagTreeDir builds one per distinct
+// "tag" value; searchGroupByDir (see searchgroupby.go) builds one per
+// distinct value of CamliFileSystem.GroupByAttribute.
+//
+// tag is set only by byTagTreeDir, to the bucket's own tag value (or
+// "" for untaggedTagBucketName): it's what Create tags a new
+// permanode with, so copying a file directly into a tag bucket works
+// as a tagging operation, the same as "mv" into attrValueDir already
+// does. searchGroupByDir's buckets leave it unset, since Create has
+// no comparable single-valued attribute to set automatically.
+type bucketDir struct {
+	parent *searchResultDir
+	names  []string
+	tag    string
+}
+
+var (
+	_ fs.Node               = (*bucketDir)(nil)
+	_ fs.HandleReadDirAller = (*bucketDir)(nil)
+	_ fs.NodeStringLookuper = (*bucketDir)(nil)
+	_ fs.NodeCreater        = (*bucketDir)(nil)
+)
+
+func (d *bucketDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	if d.parent.at == nil {
+		a.Mode = os.ModeDir | 0700
+	}
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *bucketDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	return dirents(d.names, fuse.DT_File), nil
+}
+
+func (d *bucketDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	for _, candidate := range d.names {
+		if candidate == name {
+			return d.parent.Lookup(ctx, name)
+		}
+	}
+	return nil, fuse.ENOENT
+}
+
+// Create implements fs.NodeCreater: writing a file into a byTagTreeDir
+// bucket uploads it as a new permanode tagged with d.tag (unset for
+// untaggedTagBucketName, so a file copied there stays untagged), the
+// same "copying in is tagging" mechanism searchResultDir.Create
+// already gives a plain "tag:value" search directory.
+func (d *bucketDir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	if err := d.parent.fs.checkWritable(); err != nil {
+		return nil, nil, err
+	}
+	if d.parent.at != nil {
+		return nil, nil, d.parent.fs.effectiveUnsupportedErrno(UnsupportedImmutable)
+	}
+	pn, err := d.parent.fs.client.UploadNewPermanode(ctx)
+	if err != nil {
+		Logger.Printf("fs.bucketDir: Create(%q): creating permanode: %v", req.Name, err)
+		return nil, nil, fuse.EIO
+	}
+	if d.tag != "" {
+		claim := schema.NewSetAttributeClaim(pn.BlobRef, "tag", d.tag)
+		if _, err := d.parent.fs.client.UploadAndSignBlob(ctx, claim); err != nil {
+			Logger.Printf("fs.bucketDir: Create(%q): tagging: %v", req.Name, err)
+			return nil, nil, fuse.EIO
+		}
+	}
+	nod := &searchResultFile{
+		node:      node{fs: d.parent.fs, blobref: pn.BlobRef}, // blobref is corrected to the file's once Release uploads its content
+		permanode: pn.BlobRef,
+	}
+	return nod, &searchCreateHandle{n: d.parent, nod: nod, name: req.Name, permanode: pn.BlobRef}, nil
+}
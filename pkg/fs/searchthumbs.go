@@ -0,0 +1,156 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"os"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+)
+
+// thumbsDirName is the reserved name of the thumbnail sibling view
+// under a search result directory: each entry with a camliContentImage
+// (already resolved into n.imageMeta by ReadDirAll) gets a same-named
+// counterpart here serving a thumbnail instead of the full-resolution
+// file. Like byContentDirName, it only "exists" once the parent has
+// been seeded.
+const thumbsDirName = ".thumbs"
+
+// defaultThumbnailSize is the CamliFileSystem.ThumbnailSize used when
+// that field is left at its zero value.
+const defaultThumbnailSize = 200
+
+// thumbnailSize returns fsys's configured thumbnail dimension, or
+// defaultThumbnailSize if it's unset.
+func thumbnailSize(fsys *CamliFileSystem) int {
+	if fsys.ThumbnailSize > 0 {
+		return fsys.ThumbnailSize
+	}
+	return defaultThumbnailSize
+}
+
+// Thumbnailer generates a resized rendition of an image blob, for
+// CamliFileSystem.Thumbnailer to plug into a searchResultDir's
+// .thumbs subdirectory. pkg/fs has no HTTP client of its own to call
+// Perkeep's image-resize handler directly, so actually generating the
+// resized bytes is left to whatever embeds CamliFileSystem.
+type Thumbnailer interface {
+	// Thumbnail returns the blobref and byte size of a rendition of
+	// imageRef no larger than maxDimension on its longest side.
+	Thumbnail(ctx context.Context, imageRef blob.Ref, maxDimension int) (ref blob.Ref, size int64, err error)
+}
+
+// searchThumbsDir lists the parent's imaged entries under
+// thumbsDirName, serving each one's camliContentImage blob, resized
+// via CamliFileSystem.Thumbnailer if set.
+type searchThumbsDir struct {
+	parent *searchResultDir
+}
+
+var (
+	_ fs.Node               = (*searchThumbsDir)(nil)
+	_ fs.HandleReadDirAller = (*searchThumbsDir)(nil)
+	_ fs.NodeStringLookuper = (*searchThumbsDir)(nil)
+)
+
+func (d *searchThumbsDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Valid = d.parent.fs.effectiveAttrValidity()
+	a.Uid = d.parent.fs.effectiveUid()
+	a.Gid = d.parent.fs.effectiveGid()
+	return nil
+}
+
+func (d *searchThumbsDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	defer d.parent.mu.Unlock()
+	names := make([]string, 0, len(d.parent.imageMeta))
+	for name, img := range d.parent.imageMeta {
+		if img != nil && img.BlobRef.Valid() {
+			names = append(names, name)
+		}
+	}
+	return dirents(names, fuse.DT_File), nil
+}
+
+func (d *searchThumbsDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if err := d.parent.ensureSeeded(ctx); err != nil {
+		return nil, err
+	}
+	d.parent.mu.Lock()
+	img := d.parent.imageMeta[name]
+	if img == nil || !img.BlobRef.Valid() {
+		d.parent.mu.Unlock()
+		return nil, fuse.ENOENT
+	}
+	ref := img.BlobRef
+	var mimeType string
+	var size int64
+	if img.File != nil {
+		mimeType = img.File.MIMEType
+		size = img.File.Size
+	}
+	permanode := d.parent.permanode[name]
+	modTime := d.parent.modTime[name]
+	d.parent.mu.Unlock()
+
+	if thumbnailer := d.parent.fs.Thumbnailer; thumbnailer != nil {
+		tref, tsize, err := thumbnailer.Thumbnail(ctx, ref, thumbnailSize(d.parent.fs))
+		if err != nil {
+			Logger.Printf("fs.searchThumbsDir: Lookup(%q): Thumbnail(%v): %v", name, ref, err)
+			return nil, fuse.EIO
+		}
+		ref = tref
+		size = tsize
+	}
+
+	nod := &searchResultFile{
+		node: node{
+			fs:           d.parent.fs,
+			blobref:      ref,
+			pnodeModTime: modTime,
+		},
+		readOnly:  true,
+		permanode: permanode,
+		mimeType:  mimeType,
+		size:      uint64(size),
+		haveSize:  size > 0,
+	}
+	return nod, nil
+}
+
+// hasThumbs reports whether d's parent has anything to show under
+// thumbsDirName, so Lookup can give a plain ENOENT for it before it's
+// ever been seeded rather than an empty directory.
+func (n *searchResultDir) hasThumbs() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, img := range n.imageMeta {
+		if img != nil && img.BlobRef.Valid() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/types/camtypes"
+)
+
+// fakeThumbnailer records the dimension it was asked for and always
+// returns thumbRef/thumbSize, standing in for the real image-resize
+// call that CamliFileSystem.Thumbnailer plugs in since pkg/fs has no
+// HTTP client of its own.
+type fakeThumbnailer struct {
+	thumbRef     blob.Ref
+	thumbSize    int64
+	gotDimension int
+}
+
+func (f *fakeThumbnailer) Thumbnail(ctx context.Context, imageRef blob.Ref, maxDimension int) (blob.Ref, int64, error) {
+	f.gotDimension = maxDimension
+	return f.thumbRef, f.thumbSize, nil
+}
+
+// TestThumbnailSizeDefault checks that an unset ThumbnailSize falls
+// back to defaultThumbnailSize.
+func TestThumbnailSizeDefault(t *testing.T) {
+	if got := thumbnailSize(&CamliFileSystem{}); got != defaultThumbnailSize {
+		t.Errorf("thumbnailSize() = %d; want %d", got, defaultThumbnailSize)
+	}
+}
+
+// TestThumbnailSizeOverride checks that a configured ThumbnailSize is
+// used as-is.
+func TestThumbnailSizeOverride(t *testing.T) {
+	if got := thumbnailSize(&CamliFileSystem{ThumbnailSize: 640}); got != 640 {
+		t.Errorf("thumbnailSize() = %d; want 640", got)
+	}
+}
+
+// TestHasThumbsReportsImagedEntries checks that hasThumbs is true once
+// an entry with a valid image BlobRef exists in imageMeta, and false
+// for a directory with no imaged entries.
+func TestHasThumbsReportsImagedEntries(t *testing.T) {
+	ref := blob.MustParse("sha224-4444444444444444444444444444444444444444444444444444444444444444")
+	n := &searchResultDir{imageMeta: map[string]*search.DescribedBlob{"photo.jpg": {BlobRef: ref}}}
+	if !n.hasThumbs() {
+		t.Error("hasThumbs() = false; want true")
+	}
+
+	empty := &searchResultDir{imageMeta: map[string]*search.DescribedBlob{}}
+	if empty.hasThumbs() {
+		t.Error("hasThumbs() = true on an empty imageMeta; want false")
+	}
+}
+
+// TestSearchThumbsDirLookupResizesViaThumbnailer checks that Lookup
+// substitutes the Thumbnailer's returned ref and size for the
+// original image's, passing along the configured ThumbnailSize, and
+// that a name absent from imageMeta reports ENOENT without calling
+// the Thumbnailer at all.
+func TestSearchThumbsDirLookupResizesViaThumbnailer(t *testing.T) {
+	orig := blob.MustParse("sha224-5555555555555555555555555555555555555555555555555555555555555555")
+	thumb := blob.MustParse("sha224-6666666666666666666666666666666666666666666666666666666666666666")
+	thumbnailer := &fakeThumbnailer{thumbRef: thumb, thumbSize: 42}
+	now := time.Now()
+	parent := &searchResultDir{
+		fs:        &CamliFileSystem{Thumbnailer: thumbnailer, ThumbnailSize: 100},
+		ents:      map[string]*search.DescribedBlob{},
+		permanode: map[string]blob.Ref{"photo.jpg": orig},
+		modTime:   map[string]time.Time{"photo.jpg": now},
+		imageMeta: map[string]*search.DescribedBlob{
+			"photo.jpg": {BlobRef: orig, File: &camtypes.FileInfo{MIMEType: "image/jpeg", Size: 12345}},
+		},
+	}
+	d := &searchThumbsDir{parent: parent}
+
+	got, err := d.Lookup(context.Background(), "photo.jpg")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	file, ok := got.(*searchResultFile)
+	if !ok {
+		t.Fatalf("Lookup() returned %T; want *searchResultFile", got)
+	}
+	if file.blobref != thumb {
+		t.Errorf("file.blobref = %v; want %v", file.blobref, thumb)
+	}
+	if file.size != 42 {
+		t.Errorf("file.size = %d; want 42", file.size)
+	}
+	if thumbnailer.gotDimension != 100 {
+		t.Errorf("Thumbnailer asked for dimension %d; want 100", thumbnailer.gotDimension)
+	}
+
+	if _, err := d.Lookup(context.Background(), "missing.jpg"); err != fuse.ENOENT {
+		t.Errorf("Lookup(%q) error = %v; want fuse.ENOENT", "missing.jpg", err)
+	}
+}
@@ -0,0 +1,63 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "sort"
+
+// sortNamesStable stable-sorts n.lastNames by less, breaking a tie
+// (neither name sorting before the other under less) by
+// n.tieBreakLess when CamliFileSystem.SortTieBreak is set, so repeated
+// calls on the same underlying data always produce the same order. It
+// must be called with n.mu held.
+func (n *searchResultDir) sortNamesStable(less func(a, b string) bool) {
+	sort.SliceStable(n.lastNames, func(i, j int) bool {
+		a, b := n.lastNames[i], n.lastNames[j]
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		if !n.fs.SortTieBreak {
+			return false
+		}
+		return n.tieBreakLess(a, b)
+	})
+}
+
+// tieBreakLess reports whether a should sort before b as
+// sortNamesStable's tie-breaker: by name, then, if the names also
+// collide, by n.tieBreakKey.
+func (n *searchResultDir) tieBreakLess(a, b string) bool {
+	if a != b {
+		return a < b
+	}
+	return n.tieBreakKey(a) < n.tieBreakKey(b)
+}
+
+// tieBreakKey returns name's content blobref, or its permanode's own
+// blobref if it has no content (a set, symlink, or contentless
+// permanode), for tieBreakLess's fallback comparison between two
+// identically-named entries.
+func (n *searchResultDir) tieBreakKey(name string) string {
+	if de := n.ents[name]; de != nil {
+		return de.BlobRef.String()
+	}
+	return n.permanode[name].String()
+}
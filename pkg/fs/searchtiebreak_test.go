@@ -0,0 +1,102 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// dirWithEqualModTimes builds a searchResultDir whose names all share
+// the same modtime, in the given (possibly shuffled) order, for
+// exercising sortLastNames' SearchSortByModTimeAsc tie-break.
+func dirWithEqualModTimes(fsys *CamliFileSystem, names []string) *searchResultDir {
+	same := time.Unix(1, 0)
+	modTime := make(map[string]time.Time, len(names))
+	ents := make(map[string]*search.DescribedBlob, len(names))
+	lastNames := make([]string, len(names))
+	for i, name := range names {
+		modTime[name] = same
+		ents[name] = &search.DescribedBlob{BlobRef: blob.RefFromString(name)}
+		lastNames[i] = name
+	}
+	return &searchResultDir{
+		fs:        fsys,
+		lastNames: lastNames,
+		modTime:   modTime,
+		ents:      ents,
+	}
+}
+
+// TestSortTieBreakStableAcrossRefreshes checks that, with
+// CamliFileSystem.SortTieBreak set, sortLastNames orders a set of
+// entries sharing an identical modtime the same way regardless of the
+// order they arrived in, simulating repeated refreshes each returning
+// the same entries in a different (server-decided) order.
+func TestSortTieBreakStableAcrossRefreshes(t *testing.T) {
+	fsys := &CamliFileSystem{SearchSortBy: SearchSortByModTimeAsc, SortTieBreak: true}
+	orderings := [][]string{
+		{"c", "a", "b", "e", "d"},
+		{"e", "d", "c", "b", "a"},
+		{"a", "b", "c", "d", "e"},
+		{"b", "d", "a", "e", "c"},
+	}
+
+	var want []string
+	for i, names := range orderings {
+		n := dirWithEqualModTimes(fsys, names)
+		n.sortLastNames()
+		if i == 0 {
+			want = append([]string{}, n.lastNames...)
+			continue
+		}
+		if !namesEqual(n.lastNames, want) {
+			t.Fatalf("ordering %d: sortLastNames() = %v; want %v (same as ordering 0)", i, n.lastNames, want)
+		}
+	}
+}
+
+// TestSortTieBreakOffKeepsArrivalOrder checks that, with
+// CamliFileSystem.SortTieBreak left at its zero value, a tie between
+// equal modtimes keeps the entries' arrival order instead, the
+// pre-existing behavior.
+func TestSortTieBreakOffKeepsArrivalOrder(t *testing.T) {
+	fsys := &CamliFileSystem{SearchSortBy: SearchSortByModTimeAsc}
+	names := []string{"c", "a", "b"}
+	n := dirWithEqualModTimes(fsys, names)
+	n.sortLastNames()
+	if !namesEqual(n.lastNames, names) {
+		t.Errorf("sortLastNames() = %v; want unchanged arrival order %v", n.lastNames, names)
+	}
+}
+
+func namesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
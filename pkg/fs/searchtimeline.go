@@ -0,0 +1,117 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// timelineFileName is a hidden, per-searchResultDir file reporting a
+// histogram of the directory's current listing, bucketed by each
+// entry's modtime at CamliFileSystem.TimelineGranularity, as JSON:
+// [{"bucket":"2016-01-01","count":3},{"bucket":"2016-01-08","count":1}].
+// It's computed once per doReaddir pass from that pass's modTime map
+// (see computeTimeline), the same way facetsFileName is computed from
+// facetCounts, so a read between refreshes always matches the listing
+// currently visible via ReadDirAll and needs no extra queries. Like
+// facetsFileName, it's only resolvable via Lookup, and only listed in
+// ReadDirAll with ShowDotfiles, when CamliFileSystem.EnableTimelineFile
+// is set.
+const timelineFileName = ".timeline.json"
+
+// TimelineGranularity selects how timelineFileName buckets an entry's
+// modtime.
+type TimelineGranularity int
+
+const (
+	// TimelineDay buckets by calendar day ("2016-01-02").
+	TimelineDay TimelineGranularity = iota
+	// TimelineWeek buckets by the Monday starting each entry's ISO
+	// week ("2016-01-04").
+	TimelineWeek
+	// TimelineMonth buckets by calendar month ("2016-01").
+	TimelineMonth
+)
+
+// timelineBucket is one bucket of timelineFileName's histogram.
+type timelineBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// effectiveTimelineGranularity reports the TimelineGranularity fs
+// actually applies; fs.TimelineGranularity's zero value already means
+// TimelineDay, so this exists purely for symmetry with the rest of
+// this package's effectiveXxx accessors.
+func (fs *CamliFileSystem) effectiveTimelineGranularity() TimelineGranularity {
+	return fs.TimelineGranularity
+}
+
+// timelineBucketKey formats t at granularity, for computeTimeline.
+func timelineBucketKey(t time.Time, granularity TimelineGranularity) string {
+	switch granularity {
+	case TimelineWeek:
+		weekday := int(t.Weekday())
+		if weekday == 0 {
+			weekday = 7 // ISO: Sunday is day 7, not 0
+		}
+		monday := t.AddDate(0, 0, 1-weekday)
+		return monday.Format("2006-01-02")
+	case TimelineMonth:
+		return t.Format("2006-01")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// computeTimeline builds timelineFileName's histogram over lastNames,
+// bucketing each name's entry in modTime at granularity. It's called
+// from doReaddir with the same locally-built modTime doReaddir is
+// about to store onto n, before it's reachable from another goroutine,
+// so it needs no locking of its own. Entries with no recorded modtime
+// (the zero time.Time) are skipped, since they'd otherwise all pile
+// into one meaningless bucket. Returns buckets sorted by key, ascending.
+func computeTimeline(lastNames []string, modTime map[string]time.Time, granularity TimelineGranularity) []timelineBucket {
+	counts := make(map[string]int)
+	for _, name := range lastNames {
+		t := modTime[name]
+		if t.IsZero() {
+			continue
+		}
+		counts[timelineBucketKey(t, granularity)]++
+	}
+	buckets := make([]timelineBucket, 0, len(counts))
+	for key, count := range counts {
+		buckets = append(buckets, timelineBucket{Bucket: key, Count: count})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Bucket < buckets[j].Bucket })
+	return buckets
+}
+
+// timelineFileContents renders timelineFileName's content from n's
+// current n.timeline. It must be called with n.mu held.
+func (n *searchResultDir) timelineFileContents() ([]byte, error) {
+	b, err := json.MarshalIndent(n.timeline, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
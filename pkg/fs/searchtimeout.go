@@ -0,0 +1,56 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// defaultQueryTimeout is how long a searchResultDir waits on a single
+// client.Query or fetchSchemaMeta call before giving up, when
+// CamliFileSystem.QueryTimeout is left at its zero value: long enough
+// that a server under normal load never trips it, short enough that a
+// hung server doesn't leave "ls" or a stat blocked indefinitely.
+const defaultQueryTimeout = 30 * time.Second
+
+// effectiveQueryTimeout returns fsys.QueryTimeout if it's been set to
+// a positive value, defaultQueryTimeout if it's still at its zero
+// value, or 0 (meaning no timeout) if it's been set negative.
+func (fsys *CamliFileSystem) effectiveQueryTimeout() time.Duration {
+	switch {
+	case fsys.QueryTimeout == 0:
+		return defaultQueryTimeout
+	case fsys.QueryTimeout < 0:
+		return 0
+	default:
+		return fsys.QueryTimeout
+	}
+}
+
+// effectiveQueryTimeoutErrno returns fsys.QueryTimeoutErrno if it's
+// set, else fuse.EIO, the errno ReadDirAll and Lookup report when a
+// query they bounded with QueryTimeout doesn't come back in time.
+func (fsys *CamliFileSystem) effectiveQueryTimeoutErrno() fuse.Errno {
+	if fsys.QueryTimeoutErrno != 0 {
+		return fsys.QueryTimeoutErrno
+	}
+	return fuse.EIO
+}
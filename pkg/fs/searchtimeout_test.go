@@ -0,0 +1,68 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// TestEffectiveQueryTimeoutDefault checks that a zero
+// CamliFileSystem.QueryTimeout falls back to defaultQueryTimeout (the
+// ~30s bound this request exists to guarantee), rather than leaving
+// queries unbounded.
+func TestEffectiveQueryTimeoutDefault(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	if got := fsys.effectiveQueryTimeout(); got != defaultQueryTimeout {
+		t.Errorf("effectiveQueryTimeout() = %v; want %v", got, defaultQueryTimeout)
+	}
+}
+
+// TestEffectiveQueryTimeoutOverride checks that a positive
+// QueryTimeout is used as-is in place of defaultQueryTimeout.
+func TestEffectiveQueryTimeoutOverride(t *testing.T) {
+	fsys := &CamliFileSystem{QueryTimeout: 5 * time.Second}
+	if got := fsys.effectiveQueryTimeout(); got != 5*time.Second {
+		t.Errorf("effectiveQueryTimeout() = %v; want 5s", got)
+	}
+}
+
+// TestEffectiveQueryTimeoutNegativeDisables checks that a negative
+// QueryTimeout disables the bound entirely, for an operator who
+// wants queries left to whatever timeout, if any, the client itself
+// applies.
+func TestEffectiveQueryTimeoutNegativeDisables(t *testing.T) {
+	fsys := &CamliFileSystem{QueryTimeout: -1}
+	if got := fsys.effectiveQueryTimeout(); got != 0 {
+		t.Errorf("effectiveQueryTimeout() = %v; want 0 (disabled)", got)
+	}
+}
+
+// TestEffectiveQueryTimeoutErrnoDefault checks that
+// effectiveQueryTimeoutErrno falls back to fuse.EIO, and that
+// QueryTimeoutErrno overrides it, independent of the timeout duration
+// itself.
+func TestEffectiveQueryTimeoutErrnoDefault(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	if got, want := fsys.effectiveQueryTimeoutErrno(), fuse.EIO; got != want {
+		t.Errorf("effectiveQueryTimeoutErrno() = %v; want %v", got, want)
+	}
+}
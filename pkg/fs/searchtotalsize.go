@@ -0,0 +1,60 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// totalSizeFileName is a hidden, per-searchResultDir file reporting
+// the combined size in bytes of every plain file entry n's last
+// ReadDirAll resolved (see totalSizeBytes), for a quick "how big is
+// this collection" answer without having to sum an "ls -l" by hand.
+// Like dimensionsFileName, it's always resolvable via Lookup; see
+// CamliFileSystem.ShowDotfiles for whether it's also listed in
+// ReadDirAll.
+const totalSizeFileName = ".totalsize"
+
+// totalSizeBytes sums n.ents' File.Size, the size of every plain file
+// entry in n's last ReadDirAll; sets, symlinks, and contentless
+// entries (tracked in n.sets, n.symlinks, n.contentless instead of
+// n.ents) are skipped so a set's members aren't counted both under
+// the set and, via flattening, under n itself. It's computed purely
+// from metadata ReadDirAll already fetched, so calling it adds no
+// further queries; it must be called with n.mu held.
+func (n *searchResultDir) totalSizeBytes() uint64 {
+	var total uint64
+	for _, name := range n.lastNames {
+		db := n.ents[name]
+		if db == nil || db.File == nil {
+			continue
+		}
+		total += uint64(db.File.Size)
+	}
+	return total
+}
+
+// totalSizeFileContents renders totalSizeFileName's content: n's
+// total size as a bare decimal byte count, the same way a file's own
+// size would be reported by "stat", followed by a trailing newline so
+// it's still pleasant to "cat". It must be called with n.mu held.
+func (n *searchResultDir) totalSizeFileContents() string {
+	return fmt.Sprintf("%s\n", strconv.FormatUint(n.totalSizeBytes(), 10))
+}
@@ -0,0 +1,42 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// trashDirName is the reserved name of the top-level searchDir's
+// recycle-bin-like view of every deleted permanode (see
+// searchDir.trashDir), complementing CamliFileSystem.IncludeDeleted's
+// per-listing opt-in with one dedicated place to browse all of them at
+// once. Only resolvable via Lookup, like "at" and "content", rather
+// than listed in searchDir.ReadDirAll, so it doesn't clutter an "ls"
+// of the search root for mounts that never enable it.
+const trashDirName = "trash"
+
+// trashDir returns the searchResultDir backing trashDirName: a plain
+// deletedPredicate query, newest modtime first, cached in n.fs's
+// searchDirCache under trashDirName the same way recentDirName is.
+func (n *searchDir) trashDir() *searchResultDir {
+	cache := searchDirCacheFor(n.fs)
+	if d, ok := cache.get(trashDirName); ok {
+		return d
+	}
+	sortBy := SearchSortByModTimeDesc
+	d := &searchResultDir{fs: n.fs, searchExp: deletedPredicate, sortOverride: &sortBy}
+	cache.add(trashDirName, d)
+	return d
+}
@@ -0,0 +1,39 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "strings"
+
+// trimTrailingFilenameWhitespace trims name's trailing spaces and tabs
+// when fsys.TrimTrailingFilenameWhitespace is set, the same way
+// normalizeFilename applies fsys.FilenameNorm, so every site that
+// derives a fuse.Dirent.Name from a permanode's filename attribute
+// trims it the same way doReaddir's stored n.ents keys are trimmed,
+// and Lookup trims an incoming name before comparing against them. A
+// client that sends a name with trailing whitespace not present in the
+// stored filename (some tools do, notably on copy) would otherwise
+// always miss with ENOENT. It returns name unchanged when
+// TrimTrailingFilenameWhitespace is false, preserving the historical
+// exact-match behavior.
+func trimTrailingFilenameWhitespace(fsys *CamliFileSystem, name string) string {
+	if !fsys.TrimTrailingFilenameWhitespace {
+		return name
+	}
+	return strings.TrimRight(name, " \t")
+}
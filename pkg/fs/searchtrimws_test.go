@@ -0,0 +1,46 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "testing"
+
+// TestTrimTrailingFilenameWhitespace checks that trailing whitespace is
+// trimmed only when TrimTrailingFilenameWhitespace is set, and that
+// leading and interior whitespace is always left alone.
+func TestTrimTrailingFilenameWhitespace(t *testing.T) {
+	tests := []struct {
+		trim bool
+		name string
+		want string
+	}{
+		{false, "foo.txt  ", "foo.txt  "},
+		{false, "foo.txt\t", "foo.txt\t"},
+		{true, "foo.txt  ", "foo.txt"},
+		{true, "foo.txt\t", "foo.txt"},
+		{true, "foo.txt", "foo.txt"},
+		{true, "  foo.txt", "  foo.txt"},
+		{true, "foo bar.txt", "foo bar.txt"},
+	}
+	for _, tt := range tests {
+		fsys := &CamliFileSystem{TrimTrailingFilenameWhitespace: tt.trim}
+		if got := trimTrailingFilenameWhitespace(fsys, tt.name); got != tt.want {
+			t.Errorf("trimTrailingFilenameWhitespace(trim=%v, %q) = %q; want %q", tt.trim, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"perkeep.org/pkg/blob"
+)
+
+// maxFilenameBytes is the NAME_MAX most filesystems enforce on a
+// single path component; a permanode's filename (or title) attribute
+// is free to exceed it, especially once imported from a source with a
+// looser limit of its own, but handing such a name to the kernel
+// verbatim makes the affected entry fail to open rather than just
+// display oddly.
+const maxFilenameBytes = 255
+
+// truncateFilename shortens name to fit maxFilenameBytes when it
+// doesn't already, preserving its extension and appending a short
+// suffix derived from ref the same way fileOrDirEntry's own
+// blobref-based fallback naming does, so two permanodes whose names
+// collide once truncated still don't produce the same entry. The
+// suffix is taken from ref.String() (hash algorithm and digest
+// together), not just the digest, so two refs hashed under different
+// algorithms can't be truncated down to the same suffix. It returns
+// name unchanged, and empty, when no truncation was needed: the
+// caller uses the empty return to tell whether to remember an
+// original name to expose elsewhere (see doReaddir and
+// searchResultFile.originalName).
+func truncateFilename(name string, ref blob.Ref) (truncated, original string) {
+	if len(name) <= maxFilenameBytes {
+		return name, ""
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	suffix := "-" + ref.String()[:10]
+	keep := maxFilenameBytes - len(suffix) - len(ext)
+	if keep < 0 {
+		keep = 0
+	}
+	return truncateOnRuneBoundary(base, keep) + suffix + ext, name
+}
+
+// truncateOnRuneBoundary returns the longest prefix of s that's at
+// most n bytes and doesn't split a multi-byte UTF-8 rune, so
+// truncateFilename never hands the kernel a mangled trailing
+// character.
+func truncateOnRuneBoundary(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,78 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMinSearchCacheTTL is the floor effectiveSearchCacheTTL clamps
+// up to when CamliFileSystem.MinSearchCacheTTL is unset: low enough to
+// stay responsive to a mount that's actively being written to, but
+// high enough that a typo'd (or explicitly zero) SearchCacheTTL, or a
+// "#ttl=" Lookup override, or a saved search's own TTL attr, can't
+// turn every "ls" into its own round trip to the server.
+const defaultMinSearchCacheTTL = 1 * time.Second
+
+// effectiveMinSearchCacheTTL reports the floor clampToMinSearchCacheTTL
+// enforces for fsys: fsys.MinSearchCacheTTL if set, otherwise
+// defaultMinSearchCacheTTL.
+func effectiveMinSearchCacheTTL(fsys *CamliFileSystem) time.Duration {
+	if fsys.MinSearchCacheTTL > 0 {
+		return fsys.MinSearchCacheTTL
+	}
+	return defaultMinSearchCacheTTL
+}
+
+// ttlFloorWarnedMu and ttlFloorWarned track, per CamliFileSystem,
+// whether clampToMinSearchCacheTTL has already logged its warning, so
+// a mount with a too-low TTL gets exactly one log line about it rather
+// than one per ReadDirAll.
+var (
+	ttlFloorWarnedMu sync.Mutex
+	ttlFloorWarned   = map[*CamliFileSystem]bool{}
+)
+
+// clampToMinSearchCacheTTL raises ttl to fsys's floor (see
+// effectiveMinSearchCacheTTL) if it's positive but below it, unless
+// AllowSubMinimumSearchCacheTTL opts fsys out of the floor entirely. A
+// negative ttl is left untouched: it already has its own meaning to
+// haveCachedListing (always re-query, i.e. caching disabled), distinct
+// from a too-low positive one the floor exists to guard against. The
+// first time it actually clamps something for a given fsys, it logs a
+// warning; later clamps for the same fsys are silent, since they'd
+// just repeat the same warning on every ReadDirAll.
+func clampToMinSearchCacheTTL(fsys *CamliFileSystem, ttl time.Duration) time.Duration {
+	if fsys.AllowSubMinimumSearchCacheTTL || ttl < 0 {
+		return ttl
+	}
+	floor := effectiveMinSearchCacheTTL(fsys)
+	if ttl >= floor {
+		return ttl
+	}
+	ttlFloorWarnedMu.Lock()
+	alreadyWarned := ttlFloorWarned[fsys]
+	ttlFloorWarned[fsys] = true
+	ttlFloorWarnedMu.Unlock()
+	if !alreadyWarned {
+		Logger.Printf("fs.search: configured SearchCacheTTL %v is below the %v minimum; clamping to it (set CamliFileSystem.MinSearchCacheTTL to change the floor, or AllowSubMinimumSearchCacheTTL to disable it)", ttl, floor)
+	}
+	return floor
+}
@@ -0,0 +1,69 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestClampToMinSearchCacheTTLDefault checks that a TTL below the
+// default floor gets clamped up to it, and one at or above the floor
+// is left alone.
+func TestClampToMinSearchCacheTTLDefault(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	if got := clampToMinSearchCacheTTL(fsys, 0); got != defaultMinSearchCacheTTL {
+		t.Errorf("clampToMinSearchCacheTTL(0) = %v; want %v", got, defaultMinSearchCacheTTL)
+	}
+	want := defaultMinSearchCacheTTL * 10
+	if got := clampToMinSearchCacheTTL(fsys, want); got != want {
+		t.Errorf("clampToMinSearchCacheTTL(%v) = %v; want unchanged %v", want, got, want)
+	}
+}
+
+// TestClampToMinSearchCacheTTLConfiguredFloor checks that
+// MinSearchCacheTTL, when set, replaces defaultMinSearchCacheTTL as
+// the floor.
+func TestClampToMinSearchCacheTTLConfiguredFloor(t *testing.T) {
+	fsys := &CamliFileSystem{MinSearchCacheTTL: time.Minute}
+	if got := clampToMinSearchCacheTTL(fsys, time.Second); got != time.Minute {
+		t.Errorf("clampToMinSearchCacheTTL(1s) = %v; want floor %v", got, time.Minute)
+	}
+}
+
+// TestClampToMinSearchCacheTTLNegative checks that a negative TTL is
+// left untouched by the floor, since haveCachedListing already gives
+// it its own meaning (caching disabled) distinct from a too-low
+// positive one.
+func TestClampToMinSearchCacheTTLNegative(t *testing.T) {
+	fsys := &CamliFileSystem{}
+	if got := clampToMinSearchCacheTTL(fsys, -time.Second); got != -time.Second {
+		t.Errorf("clampToMinSearchCacheTTL(-1s) = %v; want unchanged -1s", got)
+	}
+}
+
+// TestClampToMinSearchCacheTTLAllowSubMinimum checks that
+// AllowSubMinimumSearchCacheTTL disables the floor entirely, including
+// for a zero TTL that would otherwise be clamped up.
+func TestClampToMinSearchCacheTTLAllowSubMinimum(t *testing.T) {
+	fsys := &CamliFileSystem{AllowSubMinimumSearchCacheTTL: true}
+	if got := clampToMinSearchCacheTTL(fsys, 0); got != 0 {
+		t.Errorf("clampToMinSearchCacheTTL(0) = %v; want unchanged 0 with AllowSubMinimumSearchCacheTTL set", got)
+	}
+}
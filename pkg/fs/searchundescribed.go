@@ -0,0 +1,59 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "perkeep.org/pkg/search/dir"
+
+// UndescribedContentPolicy selects what dir.ResolvePage does with an
+// entry whose camliContent still hasn't resolved to a file,
+// directory, or symlink once describe depth, the fallback describe,
+// and ContentIndirectionHops worth of indirection have all already
+// been tried.
+type UndescribedContentPolicy int
+
+const (
+	// UndescribedContentSkip drops the entry from the listing,
+	// preserving the historical behavior.
+	UndescribedContentSkip UndescribedContentPolicy = iota
+
+	// UndescribedContentFetch gives the content ref one further,
+	// deliberately deeper indirection attempt before giving up, for
+	// a chain of indirection longer than ContentIndirectionHops was
+	// willing to chase by default.
+	UndescribedContentFetch
+
+	// UndescribedContentPlaceholder keeps the entry in the listing
+	// as a zero-byte stub named from its unresolved camliContent's
+	// own blobref, so tools that count entries still see every
+	// match, at the cost of a visible but unopenable name.
+	UndescribedContentPlaceholder
+)
+
+// effectiveUndescribedContentPolicy reports the dir.UndescribedContentPolicy
+// fs actually applies to its searchResultDirs.
+func (fs *CamliFileSystem) effectiveUndescribedContentPolicy() dir.UndescribedContentPolicy {
+	switch fs.UndescribedContentPolicy {
+	case UndescribedContentFetch:
+		return dir.UndescribedContentFetch
+	case UndescribedContentPlaceholder:
+		return dir.UndescribedContentPlaceholder
+	default:
+		return dir.UndescribedContentSkip
+	}
+}
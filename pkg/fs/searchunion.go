@@ -0,0 +1,270 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// unionDirPrefix is the "search" directory's reserved prefix for a
+// union directory: "search/union/<expr1>|<expr2>|..." merges each
+// expression's own results into a single de-duplicated listing,
+// complementing drillDown's AND-by-nesting with an explicit OR. See
+// unionExprSep for how the expressions themselves are separated.
+const unionDirPrefix = "union/"
+
+// unionExprSep separates the expressions named under unionDirPrefix.
+// An expression that needs to contain a literal unionExprSep (or any
+// other character decodeSearchExprPath exists for) must be given in
+// its encodeSearchExprPath form so splitting on unionExprSep doesn't
+// cut it in two.
+const unionExprSep = "|"
+
+// lookupUnionDir parses rest (name with unionDirPrefix already
+// trimmed) as unionExprSep-separated expressions, expanding each
+// one's macros and relative dates exactly as an ordinary "cd <expr>"
+// would, and returns the unionResultDir that merges their results.
+func (n *searchDir) lookupUnionDir(name, rest string) (fs.Node, error) {
+	parts := strings.Split(rest, unionExprSep)
+	exprs := make([]string, 0, len(parts))
+	now := time.Now()
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		expr := part
+		if decoded, ok := decodeSearchExprPath(part); ok {
+			expr = decoded
+		}
+		expr, err := expandExpressionMacros(n.fs, expr, now)
+		if err != nil {
+			Logger.Printf("fs.search: union: Lookup(%q): %v", name, err)
+			return nil, fuse.EINVAL
+		}
+		exprs = append(exprs, expandRelativeDates(expr, now))
+	}
+	if len(exprs) == 0 {
+		return nil, fuse.ENOENT
+	}
+	return &unionResultDir{fs: n.fs, exprs: exprs}, nil
+}
+
+// unionErrorFileName is unionResultDir's equivalent of
+// searchResultDir's errorFileName: reading it reports whichever of
+// n.exprs failed in the most recent resolve, so a query that fails
+// doesn't just silently shrink the listing.
+const unionErrorFileName = ".error"
+
+// unionResultDir is the directory a "search/union/<expr1>|<expr2>"
+// path resolves to: it runs each of exprs as its own dir.Resolve
+// query, bounded by n.fs's own query concurrency (see
+// queryLimiterFor) the same way a ReadDirAll's describe fetches are,
+// and merges the results into one listing, de-duplicated by
+// permanode. A query that fails is logged and recorded in
+// unionErrorFileName rather than failing the whole listing, so one bad
+// or temporarily unreachable expression doesn't take the others down
+// with it; the dedup itself stays deterministic despite the
+// concurrent fetch, since each expression's own results are only
+// merged, in n.exprs order, once every fetch has returned. Each
+// entry's user.camli.sourceSearch xattr (set on the searchResultFile
+// entryNode returns, in Lookup) names whichever expression it came
+// from, the same way allRecentDir tags its own unioned entries.
+type unionResultDir struct {
+	fs    *CamliFileSystem
+	exprs []string
+
+	mu           sync.Mutex
+	resolved     bool
+	names        []string
+	refs         map[string]blob.Ref
+	entries      map[string]dir.Entry
+	sourceSearch map[string]string
+	queryErrors  string
+}
+
+var (
+	_ fs.Node               = (*unionResultDir)(nil)
+	_ fs.HandleReadDirAller = (*unionResultDir)(nil)
+	_ fs.NodeStringLookuper = (*unionResultDir)(nil)
+)
+
+func (n *unionResultDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0555
+	a.Valid = n.fs.effectiveAttrValidity()
+	a.Uid = n.fs.effectiveUid()
+	a.Gid = n.fs.effectiveGid()
+	return nil
+}
+
+// unionSubResult is one n.exprs query's own outcome, gathered into a
+// slice indexed the same way n.exprs is so resolve's merge step can
+// process them in expression order even though the fetches
+// themselves ran concurrently.
+type unionSubResult struct {
+	ents []dir.Entry
+	err  error
+}
+
+// resolve runs n.exprs concurrently, bounded by n.fs's own query
+// concurrency (see queryLimiterFor), then merges the results in
+// n.exprs order, deduplicating by permanode across all of them, the
+// first expression to name a given permanode winning its entry. A
+// failed expression is logged and its error recorded for
+// unionErrorFileName, but doesn't keep the others' results out of the
+// union. It's idempotent: only the first call does any work, the
+// rest reuse n.names/n.refs/n.entries/n.sourceSearch, exactly as
+// dirBlobDir.resolve does for its own one-time fetch.
+func (n *unionResultDir) resolve(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.resolved {
+		return nil
+	}
+	results := make([]unionSubResult, len(n.exprs))
+	limiter := queryLimiterFor(n.fs)
+	metrics := metricsFor(n.fs)
+	var wg sync.WaitGroup
+	for i, expr := range n.exprs {
+		wg.Add(1)
+		go func(i int, expr string) {
+			defer wg.Done()
+			if err := limiter.acquire(ctx, metrics); err != nil {
+				results[i] = unionSubResult{err: err}
+				return
+			}
+			defer limiter.release()
+			ents, err := dir.Resolve(ctx, n.fs.client, expr, nil)
+			results[i] = unionSubResult{ents: ents, err: err}
+		}(i, expr)
+	}
+	wg.Wait()
+
+	names, refs, entries, sourceSearch, queryErrors := mergeUnionResults(n.exprs, results)
+	n.names = names
+	n.refs = refs
+	n.entries = entries
+	n.sourceSearch = sourceSearch
+	n.queryErrors = queryErrors
+	n.resolved = true
+	return nil
+}
+
+// mergeUnionResults is resolve's merge step, factored out so it can
+// be tested without a live query: it walks exprs and their matching
+// results (by index) in order, deduplicating entries by permanode
+// across all of them the same way unionResultDir.resolve's doc comment
+// describes, and joins every failed expression's error into
+// queryErrors for unionErrorFileName. A failed expression logs and is
+// skipped, but doesn't keep the others' entries out of the returned
+// union.
+func mergeUnionResults(exprs []string, results []unionSubResult) (names []string, refs map[string]blob.Ref, entries map[string]dir.Entry, sourceSearch map[string]string, queryErrors string) {
+	names = make([]string, 0)
+	refs = make(map[string]blob.Ref)
+	entries = make(map[string]dir.Entry)
+	sourceSearch = make(map[string]string)
+	seen := make(map[blob.Ref]bool)
+	var errs []string
+	for i, expr := range exprs {
+		res := results[i]
+		if res.err != nil {
+			Logger.Printf("fs.union: querying %q: %v", expr, res.err)
+			errs = append(errs, fmt.Sprintf("querying %q: %v", expr, res.err))
+			continue
+		}
+		for _, e := range res.ents {
+			if seen[e.Permanode] {
+				continue
+			}
+			seen[e.Permanode] = true
+			name := e.Name
+			if name == "" {
+				name = e.Permanode.String()
+			}
+			for suffix := 2; ; suffix++ {
+				if _, taken := entries[name]; !taken {
+					break
+				}
+				name = fmt.Sprintf("%s.%d", e.Name, suffix)
+			}
+			names = append(names, name)
+			refs[name] = e.Permanode
+			entries[name] = e
+			sourceSearch[name] = expr
+		}
+	}
+	queryErrors = strings.Join(errs, "\n")
+	return names, refs, entries, sourceSearch, queryErrors
+}
+
+func (n *unionResultDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := n.resolve(ctx); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	names := n.names
+	refs := n.refs
+	kinds := make(map[string]fuse.DirentType, len(n.entries))
+	for name, e := range n.entries {
+		kinds[name] = entryDirentKind(n.fs, e)
+	}
+	n.mu.Unlock()
+	return direntsWithInode(n.fs, names, refs, kinds), nil
+}
+
+func (n *unionResultDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if name == unionErrorFileName {
+		if err := n.resolve(ctx); err != nil {
+			return nil, err
+		}
+		n.mu.Lock()
+		contents := n.queryErrors
+		n.mu.Unlock()
+		if contents == "" {
+			contents = "no error in the most recent union\n"
+		} else {
+			contents += "\n"
+		}
+		return staticFileNode(contents), nil
+	}
+	if err := n.resolve(ctx); err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	e, ok := n.entries[name]
+	source := n.sourceSearch[name]
+	n.mu.Unlock()
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	node := entryNode(n.fs, e, nil)
+	if sf, ok := node.(*searchResultFile); ok {
+		sf.sourceSearch = source
+	}
+	return node, nil
+}
@@ -0,0 +1,92 @@
+// +build linux darwin
+
+/*
+Copyright 2026 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"errors"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search/dir"
+)
+
+// TestMergeUnionResultsSkipsFailedExpr checks that, of three
+// sub-queries where the middle one failed, the union still contains
+// both successful sources' entries (each tagged with its own
+// expression via sourceSearch), and the failure is recorded in
+// queryErrors instead of suppressing the other two.
+func TestMergeUnionResultsSkipsFailedExpr(t *testing.T) {
+	pn1 := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	pn2 := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+
+	exprs := []string{"is:image", "is:broken", "is:video"}
+	results := []unionSubResult{
+		{ents: []dir.Entry{{Name: "photo.jpg", Permanode: pn1}}},
+		{err: errors.New("query failed")},
+		{ents: []dir.Entry{{Name: "clip.mp4", Permanode: pn2}}},
+	}
+
+	names, refs, entries, sourceSearch, queryErrors := mergeUnionResults(exprs, results)
+
+	if len(names) != 2 {
+		t.Fatalf("len(names) = %d; want 2, got %v", len(names), names)
+	}
+	if refs["photo.jpg"] != pn1 {
+		t.Errorf("refs[photo.jpg] = %v; want %v", refs["photo.jpg"], pn1)
+	}
+	if refs["clip.mp4"] != pn2 {
+		t.Errorf("refs[clip.mp4] = %v; want %v", refs["clip.mp4"], pn2)
+	}
+	if _, ok := entries["photo.jpg"]; !ok {
+		t.Errorf("entries missing photo.jpg")
+	}
+	if _, ok := entries["clip.mp4"]; !ok {
+		t.Errorf("entries missing clip.mp4")
+	}
+	if got := sourceSearch["photo.jpg"]; got != "is:image" {
+		t.Errorf("sourceSearch[photo.jpg] = %q; want %q", got, "is:image")
+	}
+	if got := sourceSearch["clip.mp4"]; got != "is:video" {
+		t.Errorf("sourceSearch[clip.mp4] = %q; want %q", got, "is:video")
+	}
+	if queryErrors == "" {
+		t.Errorf("queryErrors is empty; want the is:broken failure recorded")
+	}
+}
+
+// TestMergeUnionResultsDedupesByPermanode checks that two expressions
+// naming the same permanode keep only the first's entry, the way
+// resolve's doc comment describes.
+func TestMergeUnionResultsDedupesByPermanode(t *testing.T) {
+	pn := blob.MustParse("sha224-3333333333333333333333333333333333333333333333333333333333333333")
+
+	exprs := []string{"is:image", "tag:favorite"}
+	results := []unionSubResult{
+		{ents: []dir.Entry{{Name: "photo.jpg", Permanode: pn}}},
+		{ents: []dir.Entry{{Name: "photo.jpg", Permanode: pn}}},
+	}
+
+	names, _, _, sourceSearch, _ := mergeUnionResults(exprs, results)
+	if len(names) != 1 {
+		t.Fatalf("len(names) = %d; want 1, got %v", len(names), names)
+	}
+	if got := sourceSearch["photo.jpg"]; got != "is:image" {
+		t.Errorf("sourceSearch[photo.jpg] = %q; want %q (the first expression to name it)", got, "is:image")
+	}
+}
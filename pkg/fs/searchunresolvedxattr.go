@@ -0,0 +1,54 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"strconv"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+var (
+	_ fs.NodeGetxattrer  = (*searchResultDir)(nil)
+	_ fs.NodeListxattrer = (*searchResultDir)(nil)
+)
+
+// Getxattr implements fs.NodeGetxattrer, serving
+// CamliFileSystem.UnresolvedCountXattrName when set.
+func (n *searchResultDir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	name := n.fs.UnresolvedCountXattrName
+	if name == "" || req.Name != name {
+		return fuse.ErrNoXattr
+	}
+	n.mu.Lock()
+	count := n.lastUnresolvedCount
+	n.mu.Unlock()
+	resp.Xattr = []byte(strconv.Itoa(count))
+	return nil
+}
+
+// Listxattr implements fs.NodeListxattrer.
+func (n *searchResultDir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	if name := n.fs.UnresolvedCountXattrName; name != "" {
+		resp.Append(name)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"perkeep.org/pkg/search"
+)
+
+// validateSearchExpr probes expr with a zero-result query, so a
+// malformed expression (e.g. "bad:::") is caught here with a parse
+// error rather than only surfacing later as an empty, failing
+// ReadDirAll. It costs one extra round trip per newly looked-up
+// expression, which is why it's gated behind
+// CamliFileSystem.ValidateSearchExpr.
+func (n *searchDir) validateSearchExpr(ctx context.Context, expr string) error {
+	_, err := n.fs.queryWithFailover(ctx, n.fs.client, &search.SearchQuery{
+		Expression: expr,
+		Limit:      1,
+	})
+	return err
+}
+
+// lookupResultDirFor is resultDirFor's Lookup-time wrapper: an empty
+// expr (e.g. `cd ""`) is handled first, per
+// CamliFileSystem.EmptyExpressionDefault, before anything else below
+// gets a chance to hand the server or a cache key an empty string with
+// no defined meaning. It then applies CamliFileSystem.ExpressionRewriter
+// to expr, if set, failing with fuse.EINVAL if it errors; then, when
+// CamliFileSystem.ValidateSearchExpr
+// is set, it validates the (possibly rewritten) expr and turns a
+// parse failure into an immediate fuse.EINVAL instead of handing back
+// a searchResultDir that will only fail once it's read. It skips
+// validation for a rawName already in the searchDirCache, since that
+// one's already known good from a prior Lookup.
+//
+// trusted marks expr as having come from something the mount operator
+// already configured (a saved search, an alias, a named-searches
+// config file view) rather than an arbitrary expression a caller
+// typed directly; only an untrusted expr is checked against
+// CamliFileSystem.ExpressionAllowlist.
+//
+// savedSearchName is the saved search's own display name when expr
+// came from one, or "" otherwise; it's threaded through to
+// resultDirFor so reconcileSavedSearchDirs can later tell whether the
+// directory it builds is still backed by that saved search. See
+// CamliFileSystem.SavedSearchDeletedBehavior.
+func (n *searchDir) lookupResultDirFor(ctx context.Context, rawName, expr string, opts searchDirOptions, trusted bool, savedSearchName string) (fs.Node, error) {
+	if expr == "" {
+		def := n.fs.EmptyExpressionDefault
+		if def == "" {
+			Logger.Printf("fs.search: Lookup(%q): empty search expression", rawName)
+			return nil, fuse.EINVAL
+		}
+		expr = def
+	}
+	expr, err := n.fs.rewriteExpression(expr)
+	if err != nil {
+		Logger.Printf("fs.search: Lookup(%q): rewriting expression: %v", rawName, err)
+		return nil, fuse.EINVAL
+	}
+	if !trusted && !expressionAllowed(n.fs, expr) {
+		Logger.Printf("fs.search: Lookup(%q): expression %q isn't in CamliFileSystem.ExpressionAllowlist", rawName, expr)
+		return nil, fuse.EACCES
+	}
+	if n.fs.ValidateSearchExpr {
+		if _, cached := searchDirCacheFor(n.fs).get(rawName); !cached {
+			if err := n.validateSearchExpr(ctx, expr); err != nil && queryErrno(err) == fuse.EINVAL {
+				Logger.Printf("fs.search: Lookup(%q): invalid search expression: %v", expr, err)
+				return nil, fuse.EINVAL
+			}
+		}
+	}
+	return n.resultDirFor(rawName, expr, opts, savedSearchName), nil
+}
@@ -0,0 +1,52 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "sync/atomic"
+
+// logVerbosity gates the high-volume Logger.Printf call sites below
+// (one line per lookup, per listed entry, per cache hit) that would
+// otherwise flood a busy mount's logs. It's zero by default, meaning
+// only errors and per-query summaries are logged; SetLogVerbosity(1)
+// or higher turns the rest back on for tracing a specific problem.
+var logVerbosity int32
+
+// SetLogVerbosity changes how much detail this package's Logger
+// emits. It's safe to call at any time, including on a mount that's
+// already active, since it's backed by an atomic rather than a field
+// on CamliFileSystem that Readdir/Lookup would need to synchronize
+// on.
+func SetLogVerbosity(level int) {
+	atomic.StoreInt32(&logVerbosity, int32(level))
+}
+
+// verboseLogging reports whether the per-lookup/per-entry/cache-hit
+// Logger.Printf calls below are currently enabled.
+func verboseLogging() bool {
+	return atomic.LoadInt32(&logVerbosity) > 0
+}
+
+// debugf is Logger.Printf, gated behind verboseLogging. Errors and
+// per-query summaries should keep calling Logger.Printf directly;
+// this is only for the lines that fire once per lookup or entry.
+func debugf(format string, args ...interface{}) {
+	if verboseLogging() {
+		Logger.Printf(format, args...)
+	}
+}
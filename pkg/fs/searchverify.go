@@ -0,0 +1,56 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/schema"
+)
+
+// verifyContent streams br's content through a fresh hash of its own
+// algorithm (see blob.Ref.Hash) and compares the result against br
+// itself, without buffering the content in memory. A mismatch is
+// logged with br and both digests before verifyContent returns
+// fuse.EIO, since that's the only detail a caller couldn't already
+// get from the returned error.
+func (fsys *CamliFileSystem) verifyContent(ctx context.Context, br blob.Ref) error {
+	fr, err := schema.NewFileReader(ctx, fsys.client, br)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	h := br.Hash()
+	if _, err := io.Copy(h, fr); err != nil {
+		return err
+	}
+	if !br.HashMatches(h) {
+		got := fmt.Sprintf("%x", h.Sum(nil))
+		want := strings.TrimPrefix(br.String(), br.HashName()+"-")
+		Logger.Printf("fs.search: VerifyReads: content hash mismatch for %v: got %s, want %s", br, got, want)
+		return fuse.EIO
+	}
+	return nil
+}
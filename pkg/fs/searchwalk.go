@@ -0,0 +1,124 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"time"
+
+	"perkeep.org/pkg/blob"
+)
+
+// WalkEntry is one resolved entry passed to a WalkFunc: the same
+// per-file metadata searchResultDir.ReadDirAll resolves into its
+// ents/permanode/modTime maps, reshaped into a plain value a caller
+// outside this package can use without reaching into searchResultDir's
+// own unexported fields.
+type WalkEntry struct {
+	Name      string
+	Permanode blob.Ref // the permanode the search matched
+	Content   blob.Ref // the file's camliContent blobref; invalid for a set, symlink, or marker entry
+	Size      int64    // from the resolved file's schema; zero if Content is invalid or unknown
+	ModTime   time.Time
+}
+
+// WalkFunc is the callback Walk invokes for each entry of a search, in
+// the same order ReadDirAll would list them. Returning an error stops
+// the walk early; Walk returns that error unchanged.
+type WalkFunc func(WalkEntry) error
+
+// WalkOptions configures a Walk call.
+type WalkOptions struct {
+	// Offset skips this many of the search's resolved entries before
+	// the first call to fn, for resuming a walk a prior call left off
+	// (e.g. after hitting Limit) without re-describing entries already
+	// handled.
+	Offset int
+	// Limit caps how many entries Walk calls fn for, the same way
+	// CamliFileSystem.MaxResults or a "#limit=" Lookup option already
+	// caps a mounted search directory (see splitSearchOptions); zero
+	// means no cap beyond fsys's own configured MaxResults.
+	Limit int
+}
+
+// Walk runs searchExpr through the same dir.ResolvePage/describe logic
+// a mounted search directory's ReadDirAll uses (via doReaddir) and
+// calls fn once per resolved entry, so a Go program can iterate a
+// Perkeep search without going through the FUSE mount. It's
+// equivalent to WalkOptions(ctx, searchExpr, WalkOptions{}, fn).
+func (fsys *CamliFileSystem) Walk(ctx context.Context, searchExpr string, fn WalkFunc) error {
+	return fsys.WalkOptions(ctx, searchExpr, WalkOptions{}, fn)
+}
+
+// WalkOptions is Walk with pagination: see WalkOptions's fields.
+//
+// The search itself isn't paged incrementally against fn; it runs to
+// completion (or opts.Offset+opts.Limit, whichever caps it first) the
+// same single pass doReaddir always does, and fn is then called over
+// the resolved slice. ctx cancellation is honored both during that
+// resolution (doReaddir already selects on ctx.Done() between query
+// retries) and between each call to fn, so a long walk can still be
+// aborted without waiting for fn to exhaust every entry.
+func (fsys *CamliFileSystem) WalkOptions(ctx context.Context, searchExpr string, opts WalkOptions, fn WalkFunc) error {
+	n := &searchResultDir{fs: fsys, searchExp: searchExpr}
+	if opts.Limit > 0 {
+		resultCap := opts.Offset + opts.Limit
+		n.resultCapOverride = &resultCap
+	}
+	if _, err := n.ReadDirAll(ctx); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	names := n.lastNames
+	if opts.Offset < len(names) {
+		names = names[opts.Offset:]
+	} else {
+		names = nil
+	}
+	if opts.Limit > 0 && len(names) > opts.Limit {
+		names = names[:opts.Limit]
+	}
+	entries := make([]WalkEntry, 0, len(names))
+	for _, name := range names {
+		e := WalkEntry{
+			Name:      name,
+			Permanode: n.permanode[name],
+			ModTime:   n.modTime[name],
+		}
+		if db := n.ents[name]; db != nil {
+			e.Content = db.BlobRef
+			if db.File != nil {
+				e.Size = db.File.Size
+			}
+		}
+		entries = append(entries, e)
+	}
+	n.mu.Unlock()
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"fmt"
+	"strings"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/blob"
+)
+
+// webURLSuffix names the per-entry "Internet Shortcut" file holding a
+// resolved entry's web UI URL: "foo.jpg.url" opens foo.jpg's permanode
+// in the Perkeep web UI when double-clicked from a file manager. It's
+// resolvable for any entry with a permanode, the same way
+// sidecarSuffix is, not just ones currently listed as a file, but only
+// once CamliFileSystem.WebUIBaseURL is set; with no base URL
+// configured there's nothing to link to, so Lookup reports
+// fuse.ENOENT the same as for any other name it doesn't recognize.
+const webURLSuffix = ".url"
+
+// webURLContents renders webURLSuffix's content linking to pn, in the
+// "Internet Shortcut" format file managers already know to open in a
+// browser on double-click.
+func webURLContents(baseURL string, pn blob.Ref) string {
+	return fmt.Sprintf("[InternetShortcut]\nURL=%s/%s\n", strings.TrimSuffix(baseURL, "/"), pn.String())
+}
+
+// direntsWithWebURLs is direntsForListing's innermost wrapping point
+// for web UI URL files: it's direntsWithSidecars, plus one
+// "<name>.url" dirent per name in names when n.fs.ExposeWebURLFiles
+// and n.fs.WebUIBaseURL are both set.
+func (n *searchResultDir) direntsWithWebURLs(names []string, refs map[string]blob.Ref, kinds map[string]fuse.DirentType) []fuse.Dirent {
+	ents := n.direntsWithSidecars(names, refs, kinds)
+	if n.fs.ExposeWebURLFiles && n.fs.WebUIBaseURL != "" {
+		for _, name := range names {
+			ents = append(ents, fuse.Dirent{Name: name + webURLSuffix, Type: fuse.DT_File})
+		}
+	}
+	return ents
+}
+
+// webURLBase strips webURLSuffix from name, returning ok=false if
+// name doesn't carry it or is exactly the suffix with no base entry
+// name in front of it.
+func webURLBase(name string) (base string, ok bool) {
+	base = strings.TrimSuffix(name, webURLSuffix)
+	return base, base != name && base != ""
+}
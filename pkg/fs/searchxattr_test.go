@@ -0,0 +1,155 @@
+// +build linux darwin
+
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"bazil.org/fuse"
+	"perkeep.org/pkg/search"
+)
+
+// fileWithAttrs builds a searchResultFile whose permanode carries
+// attrs, for exercising camliXattrs/Getxattr/Listxattr.
+func fileWithAttrs(attrs url.Values) *searchResultFile {
+	return &searchResultFile{
+		pnodeMeta: &search.DescribedBlob{
+			Permanode: &search.DescribedPermanode{Attr: attrs},
+		},
+	}
+}
+
+// TestGetxattrSingleValued checks that a single-valued permanode attr
+// is surfaced verbatim under its own user.camli.<attr> name.
+func TestGetxattrSingleValued(t *testing.T) {
+	attrs := url.Values{}
+	attrs.Set("title", "Vacation Photo")
+	n := fileWithAttrs(attrs)
+	resp := &fuse.GetxattrResponse{}
+	if err := n.Getxattr(context.Background(), &fuse.GetxattrRequest{Name: "user.camli.title"}, resp); err != nil {
+		t.Fatalf("Getxattr(user.camli.title) = %v", err)
+	}
+	if got := string(resp.Xattr); got != "Vacation Photo" {
+		t.Errorf("Getxattr(user.camli.title) = %q; want %q", got, "Vacation Photo")
+	}
+}
+
+// TestGetxattrMultiValued checks that a multi-valued permanode attr
+// is joined by newlines under its own user.camli.<attr> name.
+func TestGetxattrMultiValued(t *testing.T) {
+	attrs := url.Values{"collection": {"trip-2016", "family"}}
+	n := fileWithAttrs(attrs)
+	resp := &fuse.GetxattrResponse{}
+	if err := n.Getxattr(context.Background(), &fuse.GetxattrRequest{Name: "user.camli.collection"}, resp); err != nil {
+		t.Fatalf("Getxattr(user.camli.collection) = %v", err)
+	}
+	want := "trip-2016\nfamily"
+	if got := string(resp.Xattr); got != want {
+		t.Errorf("Getxattr(user.camli.collection) = %q; want %q", got, want)
+	}
+}
+
+// TestGetxattrTagsStillCommaJoined checks that "tag", which already
+// had its own user.camli.tags xattr before generic attr exposure
+// existed, keeps its comma-joined formatting rather than switching to
+// the generic newline join.
+func TestGetxattrTagsStillCommaJoined(t *testing.T) {
+	attrs := url.Values{"tag": {"beach", "sunset"}}
+	n := fileWithAttrs(attrs)
+	resp := &fuse.GetxattrResponse{}
+	if err := n.Getxattr(context.Background(), &fuse.GetxattrRequest{Name: "user.camli.tags"}, resp); err != nil {
+		t.Fatalf("Getxattr(user.camli.tags) = %v", err)
+	}
+	want := "beach,sunset"
+	if got := string(resp.Xattr); got != want {
+		t.Errorf("Getxattr(user.camli.tags) = %q; want %q", got, want)
+	}
+}
+
+// TestGetxattrUnknownReturnsErrNoXattr checks that an unset attr
+// reports fuse.ErrNoXattr rather than an empty value.
+func TestGetxattrUnknownReturnsErrNoXattr(t *testing.T) {
+	n := fileWithAttrs(nil)
+	resp := &fuse.GetxattrResponse{}
+	if err := n.Getxattr(context.Background(), &fuse.GetxattrRequest{Name: "user.camli.nope"}, resp); err != fuse.ErrNoXattr {
+		t.Errorf("Getxattr(unknown) = %v; want fuse.ErrNoXattr", err)
+	}
+}
+
+// TestListxattrEmptyReturnsEmptyList checks that a file with no
+// permanode attrs and no other xattr-worthy fields beyond the
+// always-present permanode/camliContent ones lists just those, never
+// an error.
+func TestListxattrEmptyReturnsEmptyList(t *testing.T) {
+	n := fileWithAttrs(nil)
+	resp := &fuse.ListxattrResponse{}
+	if err := n.Listxattr(context.Background(), &fuse.ListxattrRequest{}, resp); err != nil {
+		t.Fatalf("Listxattr = %v; want nil", err)
+	}
+	if !strings.Contains(string(resp.Xattr), "user.camli.permanode") {
+		t.Errorf("Listxattr() = %q; want it to list user.camli.permanode", resp.Xattr)
+	}
+}
+
+// TestGetxattrMimeReportsFileType checks that "user.camli.mime"
+// reports a file's resolved MIME type verbatim.
+func TestGetxattrMimeReportsFileType(t *testing.T) {
+	n := fileWithAttrs(nil)
+	n.mimeType = "image/jpeg"
+	resp := &fuse.GetxattrResponse{}
+	if err := n.Getxattr(context.Background(), &fuse.GetxattrRequest{Name: "user.camli.mime"}, resp); err != nil {
+		t.Fatalf("Getxattr(user.camli.mime) = %v", err)
+	}
+	if got := string(resp.Xattr); got != "image/jpeg" {
+		t.Errorf("Getxattr(user.camli.mime) = %q; want %q", got, "image/jpeg")
+	}
+}
+
+// TestGetxattrMimeFallsBackToOctetStream checks that an entry with no
+// resolved MIME type (a "typeless" blob, e.g. one dir.Resolve couldn't
+// sniff a type for) reports defaultMIMEType rather than omitting the
+// xattr outright.
+func TestGetxattrMimeFallsBackToOctetStream(t *testing.T) {
+	n := fileWithAttrs(nil)
+	resp := &fuse.GetxattrResponse{}
+	if err := n.Getxattr(context.Background(), &fuse.GetxattrRequest{Name: "user.camli.mime"}, resp); err != nil {
+		t.Fatalf("Getxattr(user.camli.mime) = %v", err)
+	}
+	if got := string(resp.Xattr); got != defaultMIMEType {
+		t.Errorf("Getxattr(user.camli.mime) = %q; want %q", got, defaultMIMEType)
+	}
+}
+
+// TestListxattrIncludesGenericAttr checks that an arbitrary permanode
+// attr shows up in Listxattr's output under its generic name.
+func TestListxattrIncludesGenericAttr(t *testing.T) {
+	attrs := url.Values{}
+	attrs.Set("title", "Vacation Photo")
+	n := fileWithAttrs(attrs)
+	resp := &fuse.ListxattrResponse{}
+	if err := n.Listxattr(context.Background(), &fuse.ListxattrRequest{}, resp); err != nil {
+		t.Fatalf("Listxattr = %v; want nil", err)
+	}
+	if !strings.Contains(string(resp.Xattr), "user.camli.title") {
+		t.Errorf("Listxattr() = %q; want it to include user.camli.title", resp.Xattr)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RunCompactor periodically rewrites trigram posting lists to keep
+// them sorted and free of duplicate refs, so intersections in
+// candidatesForQuery stay cheap as a corpus grows. It blocks until ctx
+// is done, so callers should run it in its own goroutine.
+func (c *ContentIndexer) RunCompactor(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := c.compactOnce(); err != nil {
+				log.Printf("index: trigram compaction: %v", err)
+			}
+		}
+	}
+}
+
+// compactOnce walks every posting list once, deduplicating and
+// re-sorting it. Entries only ever get appended in sorted order by
+// addToPostingLocked, so in steady state this is a no-op; it exists
+// to heal lists left ragged by a crash mid-write or a future merge of
+// shards. It takes c.mu for the same reason addToPostingLocked does:
+// it's a read-modify-write of each posting list.
+func (c *ContentIndexer) compactOnce() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	it := c.kv.Find(trigramPrefix, trigramPrefix+"\xff")
+	for it.Next() {
+		key := it.Key()
+		refs := splitPosting(it.Value())
+		sort.Strings(refs)
+		deduped := refs[:0]
+		var last string
+		for i, r := range refs {
+			if i > 0 && r == last {
+				continue
+			}
+			deduped = append(deduped, r)
+			last = r
+		}
+		if len(deduped) == len(refs) {
+			continue // already clean, avoid a needless write
+		}
+		if err := c.kv.Set(key, strings.Join(deduped, ",")); err != nil {
+			return err
+		}
+	}
+	return it.Close()
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+
+	"perkeep.org/pkg/blob"
+)
+
+// BlobFetcher fetches the full text of a blob, for verifying a
+// trigram-index candidate against the real content before it's
+// returned as a match.
+type BlobFetcher interface {
+	FetchText(ctx context.Context, br blob.Ref) ([]byte, error)
+}
+
+// SearchLiteral returns the blobs whose indexed text contains needle,
+// verified byte-for-byte with bytes.Contains (trigram membership
+// alone can't rule out false positives).
+func (c *ContentIndexer) SearchLiteral(ctx context.Context, bf BlobFetcher, needle string) ([]blob.Ref, error) {
+	if len(needle) < 3 {
+		return nil, fmt.Errorf("index: literal query %q is shorter than a trigram", needle)
+	}
+	cand, err := c.candidatesForLiteral(needle)
+	if err != nil {
+		return nil, err
+	}
+	return c.verify(ctx, bf, cand, func(text []byte) bool {
+		return bytes.Contains(text, []byte(needle))
+	})
+}
+
+// SearchRegexp returns the blobs whose indexed text matches re. It
+// extracts the literal substrings re must contain into a query tree
+// (see buildQuery) to narrow the candidate set, then verifies each
+// candidate with re.Match.
+func (c *ContentIndexer) SearchRegexp(ctx context.Context, bf BlobFetcher, re *regexp.Regexp) ([]blob.Ref, error) {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	cand, err := c.candidatesForQueryTree(buildQuery(parsed))
+	if err != nil {
+		return nil, err
+	}
+	return c.verify(ctx, bf, cand, re.Match)
+}
+
+func (c *ContentIndexer) verify(ctx context.Context, bf BlobFetcher, cand []blob.Ref, match func([]byte) bool) ([]blob.Ref, error) {
+	var out []blob.Ref
+	for _, br := range cand {
+		text, err := bf.FetchText(ctx, br)
+		if err != nil {
+			// Blob may have been deleted or become unreadable
+			// since it was indexed; skip rather than fail the
+			// whole search.
+			continue
+		}
+		if match(text) {
+			out = append(out, br)
+		}
+	}
+	return out, nil
+}
+
+func (c *ContentIndexer) candidatesForLiteral(s string) ([]blob.Ref, error) {
+	q := &query{op: qAnd}
+	for i := 0; i+3 <= len(s); i++ {
+		q.sub = append(q.sub, &query{op: qTrigrams, trigrams: []trigram{{s[i], s[i+1], s[i+2]}}})
+	}
+	if len(q.sub) == 0 {
+		return c.allIndexedBlobs()
+	}
+	return c.candidatesForQueryTree(q)
+}
+
+// candidatesForQueryTree resolves a query tree into the blobs
+// satisfying it: a qTrigrams leaf contributes the union of its
+// trigrams' posting lists, qAnd intersects its subqueries' candidate
+// sets, qOr unions them, and qAll (no literal could be extracted from
+// that part of the pattern, e.g. ".*") falls back to every indexed
+// blob.
+func (c *ContentIndexer) candidatesForQueryTree(q *query) ([]blob.Ref, error) {
+	switch q.op {
+	case qAll:
+		return c.allIndexedBlobs()
+	case qTrigrams:
+		return c.unionTrigrams(q.trigrams)
+	case qAnd:
+		sets := make([][]blob.Ref, 0, len(q.sub))
+		for _, sub := range q.sub {
+			s, err := c.candidatesForQueryTree(sub)
+			if err != nil {
+				return nil, err
+			}
+			sets = append(sets, s)
+		}
+		return intersect(sets), nil
+	case qOr:
+		seen := make(map[blob.Ref]bool)
+		var out []blob.Ref
+		for _, sub := range q.sub {
+			s, err := c.candidatesForQueryTree(sub)
+			if err != nil {
+				return nil, err
+			}
+			for _, br := range s {
+				if !seen[br] {
+					seen[br] = true
+					out = append(out, br)
+				}
+			}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("index: unknown query op %v", q.op)
+	}
+}
+
+func (c *ContentIndexer) unionTrigrams(ts []trigram) ([]blob.Ref, error) {
+	seen := make(map[blob.Ref]bool)
+	var out []blob.Ref
+	for _, t := range ts {
+		refs, err := c.BlobsWithTrigram(t)
+		if err != nil {
+			return nil, err
+		}
+		for _, br := range refs {
+			if !seen[br] {
+				seen[br] = true
+				out = append(out, br)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (c *ContentIndexer) allIndexedBlobs() ([]blob.Ref, error) {
+	it := c.kv.Find(blobMarkPrefix, blobMarkPrefix+"\xff")
+	var out []blob.Ref
+	for it.Next() {
+		if br, ok := blob.Parse(it.Key()[len(blobMarkPrefix):]); ok {
+			out = append(out, br)
+		}
+	}
+	return out, it.Close()
+}
+
+func intersect(sets [][]blob.Ref) []blob.Ref {
+	if len(sets) == 0 {
+		return nil
+	}
+	counts := make(map[blob.Ref]int)
+	for _, set := range sets {
+		seen := make(map[blob.Ref]bool)
+		for _, br := range set {
+			if seen[br] {
+				continue
+			}
+			seen[br] = true
+			counts[br]++
+		}
+	}
+	var out []blob.Ref
+	for br, n := range counts {
+		if n == len(sets) {
+			out = append(out, br)
+		}
+	}
+	return out
+}
+
+// queryOp is the kind of node in a trigram query tree (see query and
+// buildQuery).
+type queryOp int
+
+const (
+	// qAll matches every indexed blob: no required-trigram
+	// constraint could be derived for this part of the pattern.
+	qAll queryOp = iota
+	// qAnd requires every one of sub's subqueries to hold.
+	qAnd
+	// qOr requires at least one of sub's subqueries to hold.
+	qOr
+	// qTrigrams requires at least one of trigrams to be present
+	// (the OR-group extracted from a single literal run).
+	qTrigrams
+)
+
+// query is a boolean tree over trigram constraints, built from a
+// regexp's syntax tree by buildQuery. It exists so that alternation
+// (re1|re2) can be represented as a genuine OR of its branches,
+// distinct from concatenation's AND, rather than flattening both into
+// the same list of required literals.
+type query struct {
+	op       queryOp
+	trigrams []trigram // only set when op == qTrigrams
+	sub      []*query  // only set when op == qAnd or qOr
+}
+
+// buildQuery extracts, from re's syntax tree, the AND/OR query any
+// match must satisfy. It isn't a full codesearch-style simplifier:
+// a construct that doesn't reduce to a required literal (repetition,
+// wide character classes, ".") becomes qAll rather than being folded
+// into a broader constraint, which only costs extra candidates at
+// verification time. Critically, an OpAlternate's branches become an
+// OR, not an AND: if any branch can't be reduced to a required
+// literal, the whole alternation becomes qAll, since otherwise a real
+// match via the unreduced branch would be wrongly excluded.
+func buildQuery(re *syntax.Regexp) *query {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return trigramsQuery(string(re.Rune))
+	case syntax.OpConcat:
+		q := &query{op: qAnd}
+		for _, sub := range re.Sub {
+			sq := buildQuery(sub)
+			if sq.op == qAll {
+				continue // no constraint from this branch; AND with "match everything" is a no-op
+			}
+			q.sub = append(q.sub, sq)
+		}
+		if len(q.sub) == 0 {
+			return allQuery()
+		}
+		return q
+	case syntax.OpAlternate:
+		q := &query{op: qOr}
+		for _, sub := range re.Sub {
+			sq := buildQuery(sub)
+			if sq.op == qAll {
+				// This branch can match without any particular
+				// trigram, so the alternation as a whole can too:
+				// drop the whole OR-group rather than risk excluding
+				// a real match via this branch.
+				return allQuery()
+			}
+			q.sub = append(q.sub, sq)
+		}
+		return q
+	default:
+		return allQuery()
+	}
+}
+
+func trigramsQuery(lit string) *query {
+	var ts []trigram
+	for i := 0; i+3 <= len(lit); i++ {
+		ts = append(ts, trigram{lit[i], lit[i+1], lit[i+2]})
+	}
+	if len(ts) == 0 {
+		return allQuery()
+	}
+	return &query{op: qTrigrams, trigrams: ts}
+}
+
+func allQuery() *query { return &query{op: qAll} }
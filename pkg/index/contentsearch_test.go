@@ -0,0 +1,118 @@
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/sorted"
+)
+
+type fakeBlobFetcher map[blob.Ref][]byte
+
+func (f fakeBlobFetcher) FetchText(ctx context.Context, br blob.Ref) ([]byte, error) {
+	return f[br], nil
+}
+
+func mustParseRef(t *testing.T, s string) blob.Ref {
+	t.Helper()
+	br, ok := blob.Parse(s)
+	if !ok {
+		t.Fatalf("bad test blobref %q", s)
+	}
+	return br
+}
+
+func sortedRefStrings(refs []blob.Ref) []string {
+	out := make([]string, len(refs))
+	for i, br := range refs {
+		out[i] = br.String()
+	}
+	sort.Strings(out)
+	return out
+}
+
+// TestSearchRegexpAlternationIsOr is a regression test for
+// buildQuery treating an OpAlternate's branches as an OR-group: a
+// blob containing only one side of "cat|dog" must still be found,
+// not excluded because it lacks the other side's trigrams.
+func TestSearchRegexpAlternationIsOr(t *testing.T) {
+	ctx := context.Background()
+	ci := NewContentIndexer(sorted.NewMemoryKeyValue())
+
+	catBlob := mustParseRef(t, "sha1-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	dogBlob := mustParseRef(t, "sha1-bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	neitherBlob := mustParseRef(t, "sha1-cccccccccccccccccccccccccccccccccccccccc")
+
+	bf := fakeBlobFetcher{
+		catBlob:     []byte("I have a cat"),
+		dogBlob:     []byte("I have a dog"),
+		neitherBlob: []byte("I have a bird"),
+	}
+	for br, text := range bf {
+		if err := ci.IndexText(ctx, br, text); err != nil {
+			t.Fatalf("IndexText(%v): %v", br, err)
+		}
+	}
+
+	re := regexp.MustCompile(`cat|dog`)
+	got, err := ci.SearchRegexp(ctx, bf, re)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sortedRefStrings([]blob.Ref{catBlob, dogBlob})
+	if gotStr := sortedRefStrings(got); !equalStrings(gotStr, want) {
+		t.Errorf("SearchRegexp(%q) = %v; want %v", re, gotStr, want)
+	}
+}
+
+// TestIsIndexed is a regression test for the fast path contentResultDir
+// relies on: once IndexText runs on a blob, IsIndexed must report
+// true for it (and false for a blob never indexed), so a caller can
+// tell whether re-fetching its content would be redundant.
+func TestIsIndexed(t *testing.T) {
+	ci := NewContentIndexer(sorted.NewMemoryKeyValue())
+	indexed := mustParseRef(t, "sha1-dddddddddddddddddddddddddddddddddddddddd")
+	unindexed := mustParseRef(t, "sha1-eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee")
+
+	if err := ci.IndexText(context.Background(), indexed, []byte("hello world")); err != nil {
+		t.Fatalf("IndexText: %v", err)
+	}
+
+	if ok, err := ci.IsIndexed(indexed); err != nil || !ok {
+		t.Errorf("IsIndexed(%v) = %v, %v; want true, nil", indexed, ok, err)
+	}
+	if ok, err := ci.IsIndexed(unindexed); err != nil || ok {
+		t.Errorf("IsIndexed(%v) = %v, %v; want false, nil", unindexed, ok, err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/sorted"
+)
+
+// trigramPrefix is the sorted-KV key prefix under which posting lists
+// live: "trigram:<3 bytes>" -> sorted, comma-joined blobrefs.
+const trigramPrefix = "trigram:"
+
+// blobMarkPrefix records every blob that's been run through IndexText
+// at least once, so a query with no extractable required literal
+// (e.g. ".*") can still enumerate its candidate set.
+const blobMarkPrefix = "trigram-blob:"
+
+// ContentIndexer maintains a trigram posting-list index over the text
+// contents of indexed blobs, so that literal and regexp content
+// searches (see SearchLiteral and SearchRegexp) can be answered
+// without scanning every blob. It shares the index's existing
+// sorted.KeyValue store rather than keeping a separate one.
+//
+// Ideally, new blobs would be indexed incrementally: whoever populates
+// the mutation map for a newly ingested blob would call IndexText for
+// it once its sniffed MIME type is text/* (or after source/PDF
+// extraction), and the index would live for as long as the server
+// does. Nothing in this tree does that yet, so pkg/fs's "content"
+// directory (see searchContentDir) instead builds and feeds a
+// process-local ContentIndexer itself as it scans, trading the
+// durable, ingestion-time index this was designed for, for a
+// self-populating cache that's at least no longer dead code. Hooking
+// this into real ingestion and into the server's query evaluator is
+// still follow-up work.
+type ContentIndexer struct {
+	kv sorted.KeyValue
+
+	// mu guards the read-modify-write of a posting list: two
+	// IndexText calls for blobs that share a trigram (virtually
+	// guaranteed, since there are only 3 bytes of it) would
+	// otherwise race on kv.Get/kv.Set and silently drop one of the
+	// refs. compactOnce rewrites posting lists too, so it takes mu
+	// as well.
+	mu sync.Mutex
+}
+
+// NewContentIndexer returns a ContentIndexer backed by kv, the same
+// sorted.KeyValue store the rest of the index uses.
+func NewContentIndexer(kv sorted.KeyValue) *ContentIndexer {
+	return &ContentIndexer{kv: kv}
+}
+
+// trigram is an overlapping, 3-byte sequence.
+type trigram [3]byte
+
+func (t trigram) String() string { return string(t[:]) }
+
+// trigramsOf returns the set of distinct trigrams in text.
+func trigramsOf(text []byte) map[trigram]bool {
+	m := make(map[trigram]bool)
+	for i := 0; i+3 <= len(text); i++ {
+		m[trigram{text[i], text[i+1], text[i+2]}] = true
+	}
+	return m
+}
+
+// IndexText extracts br's trigrams from text and records br in each
+// trigram's posting list.
+func (c *ContentIndexer) IndexText(ctx context.Context, br blob.Ref, text []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for t := range trigramsOf(text) {
+		if err := c.addToPostingLocked(t, br); err != nil {
+			return err
+		}
+	}
+	return c.kv.Set(blobMarkPrefix+br.String(), "1")
+}
+
+// addToPostingLocked adds br to t's posting list. Callers must hold
+// c.mu: it's a read-modify-write of the whole list, and two
+// unsynchronized writers updating the same trigram for different
+// blobs would otherwise race and one ref could be lost.
+func (c *ContentIndexer) addToPostingLocked(t trigram, br blob.Ref) error {
+	key := trigramPrefix + t.String()
+	existing, err := c.kv.Get(key)
+	if err != nil && err != sorted.ErrNotFound {
+		return err
+	}
+	refs := splitPosting(existing)
+	s := br.String()
+	i := sort.SearchStrings(refs, s)
+	if i < len(refs) && refs[i] == s {
+		return nil // already present
+	}
+	refs = append(refs, "")
+	copy(refs[i+1:], refs[i:])
+	refs[i] = s
+	return c.kv.Set(key, strings.Join(refs, ","))
+}
+
+// IsIndexed reports whether br has already been run through IndexText,
+// so a caller holding content it fetched for another reason can tell
+// whether indexing it again would be redundant.
+func (c *ContentIndexer) IsIndexed(br blob.Ref) (bool, error) {
+	_, err := c.kv.Get(blobMarkPrefix + br.String())
+	if err == sorted.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// BlobsWithTrigram returns the sorted blob refs whose indexed text
+// contains t.
+func (c *ContentIndexer) BlobsWithTrigram(t trigram) ([]blob.Ref, error) {
+	v, err := c.kv.Get(trigramPrefix + t.String())
+	if err == sorted.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var refs []blob.Ref
+	for _, s := range splitPosting(v) {
+		br, ok := blob.Parse(s)
+		if !ok {
+			continue
+		}
+		refs = append(refs, br)
+	}
+	return refs, nil
+}
+
+func splitPosting(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
@@ -0,0 +1,1519 @@
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dir implements Perkeep's "search expression as a directory
+// listing" convention: a search expression is run, and each result
+// permanode whose camliContent points to a file or directory becomes
+// a named entry. It exists so that the FUSE mount (pkg/fs) and the
+// WebDAV gateway (pkg/webdav) can share the exact same rules for
+// turning a search into a listing, rather than keeping two copies in
+// sync by hand.
+package dir
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+	"perkeep.org/pkg/types"
+)
+
+// Logger is where dir logs diagnostics that don't rise to the level
+// of a returned error, e.g. latestCamliContent noting that a
+// permanode had more than one camliContent candidate to choose
+// between. It's discarded by default; pkg/fs and pkg/webdav, the two
+// known callers, each set it to their own Logger so such messages
+// appear alongside the rest of a mount's log output.
+var Logger = log.New(io.Discard, "dir: ", log.LstdFlags)
+
+// Querier is the subset of *client.Client needed to resolve a search
+// expression into a directory listing.
+type Querier interface {
+	Query(ctx context.Context, req *search.SearchQuery) (*search.SearchResult, error)
+}
+
+// Entry is one result of a directory search: either a permanode whose
+// camliContent resolved to a file or directory (the common case), or
+// a permanode that's itself a set (IsSet, with Members to recurse
+// into) when it has camliMember attrs instead of a camliContent.
+type Entry struct {
+	Name      string
+	Blob      *search.DescribedBlob // describe meta of camliContent; nil when IsSet
+	Permanode blob.Ref              // the permanode itself, e.g. for issuing claims against it
+	PNodeMeta *search.DescribedBlob // describe meta of the permanode itself, e.g. for its attrs
+	Image     *search.DescribedBlob // describe meta of camliContentImage, if the permanode has one; nil otherwise
+	ModTime   time.Time
+
+	IsSet   bool       // true if this entry is a collection, to be listed as a subdirectory of its Members
+	Members []blob.Ref // this set's camliMember values, each itself a permanode; only set when IsSet
+
+	// Meta is the Meta union of whichever describe call resolved this
+	// Entry: resolvePage's query-level Describe.Meta for a
+	// top-of-search-result set (only useful when depth > 0 already
+	// pulled its members' meta in too; see anyMemberDescribed), or
+	// ResolveMember/ResolveMembers' own single-blob Meta for a set
+	// found by resolving a member. A caller walking into a nested set
+	// (pkg/fs's searchMemberDir) hands this down for
+	// ResolveMemberFromMeta to try against that set's own members
+	// before paying for a fresh describe, since either path often
+	// already covers them.
+	Meta search.MetaMap
+
+	// MembersTruncated is true when Members was capped to
+	// ResolvePage's maxInlineMembers rather than holding every one of
+	// the set's camliMember values: pkg/fs's searchMemberDir notices
+	// this and re-fetches the set's own full member list, rather than
+	// just Members, the first time it's actually opened.
+	MembersTruncated bool
+
+	// IsSymlink is true when camliContent resolved to a "symlink"
+	// schema blob rather than a file or directory; SymlinkTarget is
+	// its recorded target, which may be dangling (nothing checks that
+	// it resolves to anything).
+	IsSymlink     bool
+	SymlinkTarget string
+
+	// IsContentless is true for a permanode with neither a
+	// camliContent nor a camliMember attribute: a pure-metadata node
+	// (e.g. a contact) that has no content blob to serve but is still
+	// worth representing, as a zero-byte placeholder exposing its own
+	// attrs, when the caller asked resolvePage to include them (see
+	// ResolvePage's includeContentless). Blob is nil for such an
+	// entry, the same way it's nil for IsSet.
+	IsContentless bool
+
+	// IsPlaceholder is true for an entry ResolvePage synthesized in
+	// place of a camliContent it couldn't resolve to a file,
+	// directory, or symlink (even after a fallback describe and
+	// content indirection), when the caller's UndescribedContentPolicy
+	// is UndescribedContentPlaceholder. Like IsContentless, Blob is
+	// nil; Name is derived from the unresolved camliContent's own
+	// blobref, since there's no file or dir schema to name it from.
+	IsPlaceholder bool
+
+	// IsSpecial is true for an entry whose camliContent resolved, but
+	// to a schema type fileOrDirEntry doesn't otherwise know how to
+	// list (not a file, directory, symlink, or static set), when the
+	// permanode itself recorded what unix-special file it came from
+	// via a "camliUnixType" attribute -- an importer's way of noting
+	// a fifo, socket, or device node it couldn't upload real content
+	// for -- and the caller's SpecialContentPolicy is
+	// SpecialContentRepresent. SpecialType is "fifo", "socket",
+	// "chardev", or "blockdev"; SpecialDevMajor/SpecialDevMinor are
+	// only meaningful for the latter two, parsed from the permanode's
+	// "camliUnixDev" attribute. Like IsPlaceholder, Blob is nil.
+	IsSpecial       bool
+	SpecialType     string
+	SpecialDevMajor int
+	SpecialDevMinor int
+
+	// IsDeleted is true for an entry found by a deleted-only query
+	// (see pkg/fs's deletedEntries), rather than ResolvePage's own
+	// ordinary pass, which excludes deleted permanodes by default.
+	// Nothing in this package sets it; it's a pkg/fs-level annotation
+	// carried on the same Entry type so the rest of the listing
+	// pipeline doesn't need a parallel one.
+	IsDeleted bool
+}
+
+// Describer is the subset of *client.Client needed to fetch a single
+// blob's describe metadata directly, without running it through a
+// search expression. It backs member resolution for sets (see
+// ResolveMember), since a camliMember isn't itself a search result.
+type Describer interface {
+	Describe(ctx context.Context, req *search.DescribeRequest) (*search.DescribeResponse, error)
+}
+
+// memberDescribeRules is the describe rule ResolveMember and
+// ResolveMembers both fetch a camliMember's own describe meta with.
+var memberDescribeRules = []*search.DescribeRule{
+	{Attrs: []string{"camliContent", "camliContentImage", "camliMember", "unixPermission", "unixOwner", "unixGroup", "unixMtime"}},
+}
+
+// ResolveMember describes a single camliMember blobref, always a
+// permanode, and turns it into the same kind of Entry resolvePage
+// produces for a search result: a file/dir Entry if the member's
+// camliContent resolves to one, an Entry with IsSet and Members if
+// the member is itself a nested collection, or ok=false if the
+// member no longer resolves to either.
+func ResolveMember(ctx context.Context, d Describer, member blob.Ref, at *types.Time3339) (Entry, bool, error) {
+	req := &search.DescribeRequest{
+		BlobRef: member,
+		Rules:   memberDescribeRules,
+	}
+	if at != nil {
+		req.At = *at
+	}
+	res, err := d.Describe(ctx, req)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	e, ok := resolveMemberFromResponse(member, res)
+	return e, ok, nil
+}
+
+// ResolveMembers is ResolveMember for every one of members at once, in
+// a single describe request rather than one per member: the batched
+// equivalent pkg/fs's lazy-resolve Lookup coalescing (see
+// searchlazybatch.go) uses to turn a burst of individual Lookups,
+// each of which would otherwise cost its own round trip, into one.
+// The returned map holds an entry only for a member that actually
+// resolved; a member ResolveMember would have reported ok=false for
+// (deleted, or not a permanode at all) is simply absent from it rather
+// than present with a zero Entry.
+func ResolveMembers(ctx context.Context, d Describer, members []blob.Ref, at *types.Time3339) (map[blob.Ref]Entry, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+	req := &search.DescribeRequest{
+		BlobRefs: members,
+		Rules:    memberDescribeRules,
+	}
+	if at != nil {
+		req.At = *at
+	}
+	res, err := d.Describe(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[blob.Ref]Entry, len(members))
+	for _, member := range members {
+		if e, ok := resolveMemberFromResponse(member, res); ok {
+			out[member] = e
+		}
+	}
+	return out, nil
+}
+
+// ResolveSetMembers fetches set's own camliMember attribute values
+// directly, with no describe rule at all beyond set itself: unlike
+// ResolveMember/ResolveMembers, which resolve a member's own content,
+// this is for re-fetching a set's complete, uncapped member list after
+// ResolvePage's maxInlineMembers option (see Entry.MembersTruncated)
+// truncated it, so it's deliberately as cheap as a single-blob
+// describe can be. ok is false if set no longer describes as a
+// permanode at all.
+func ResolveSetMembers(ctx context.Context, d Describer, set blob.Ref, at *types.Time3339) (members []blob.Ref, ok bool, err error) {
+	req := &search.DescribeRequest{BlobRef: set}
+	if at != nil {
+		req.At = *at
+	}
+	res, err := d.Describe(ctx, req)
+	if err != nil {
+		return nil, false, err
+	}
+	meta := res.Meta.Get(set)
+	if meta == nil || meta.Permanode == nil {
+		return nil, false, nil
+	}
+	for _, m := range meta.Permanode.Attr["camliMember"] {
+		if mr, ok := blob.Parse(m); ok {
+			members = append(members, mr)
+		}
+	}
+	return members, true, nil
+}
+
+// resolveMemberFromResponse is ResolveMember's and ResolveMembers'
+// shared logic once a member's describe meta is already in hand,
+// whether from a single-blobref or a batched describe request.
+func resolveMemberFromResponse(member blob.Ref, res *search.DescribeResponse) (Entry, bool) {
+	return resolveMemberFromMeta(member, res.Meta)
+}
+
+// resolveMemberFromMeta is resolveMemberFromResponse against a bare
+// Meta union instead of a full describe response, so it also backs
+// ResolveMemberFromMeta's cache-hit path. A resolved Entry's own Meta
+// field is set to meta, so a caller descending into a nested set can
+// keep handing the same union down as long as it keeps covering each
+// next level.
+func resolveMemberFromMeta(member blob.Ref, meta search.MetaMap) (Entry, bool) {
+	pm := meta.Get(member)
+	if pm == nil || pm.Permanode == nil {
+		return Entry{}, false
+	}
+	if cc, ok, _ := latestCamliContent(member, pm.Permanode.Attr, "", nil); ok {
+		if ccMeta := meta.Get(cc); ccMeta != nil {
+			var imgMeta *search.DescribedBlob
+			if img, ok := blob.Parse(pm.Permanode.Attr.Get("camliContentImage")); ok {
+				imgMeta = meta.Get(img)
+			}
+			if e, ok := fileOrDirEntry(member, pm, ccMeta, imgMeta, make(map[string]bool), "", nil, SpecialContentSkip); ok {
+				e.Meta = meta
+				return e, true
+			}
+		}
+		return Entry{}, false
+	}
+	if members := pm.Permanode.Attr["camliMember"]; len(members) > 0 {
+		e := setEntry(member, pm, members, false, make(map[string]bool))
+		e.Meta = meta
+		return e, true
+	}
+	return Entry{}, false
+}
+
+// ResolveMemberFromMeta resolves member the same way ResolveMember
+// does, but against an already-fetched describe Meta union instead of
+// issuing a new describe call. covered reports whether meta actually
+// described member at all; when it's false, the caller should fall
+// back to ResolveMember, since member's absence from meta doesn't mean
+// member doesn't resolve, only that this particular describe call
+// never asked about it.
+func ResolveMemberFromMeta(member blob.Ref, meta search.MetaMap) (e Entry, ok, covered bool) {
+	if meta == nil || meta.Get(member) == nil {
+		return Entry{}, false, false
+	}
+	e, ok = resolveMemberFromMeta(member, meta)
+	return e, ok, true
+}
+
+// FacetCounts returns the distinct values of facet present across
+// expr's results, each with the number of results holding that value,
+// using search.SearchQuery's Facets field. It powers the "by-year",
+// "by-month", "by-tag", "by-mime", and "by-camera" faceted-browse
+// directories in pkg/fs.
+func FacetCounts(ctx context.Context, q Querier, expr string, facet *search.FacetRequest) (map[string]int, error) {
+	res, err := q.Query(ctx, &search.SearchQuery{
+		Expression: expr,
+		Limit:      -1,
+		Facets:     facet,
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, fv := range res.Facets {
+		counts[fv.Value] = fv.Count
+	}
+	return counts, nil
+}
+
+// Resolve runs expr as a search and turns the results into a
+// directory listing. If at is non-nil, camliContent is resolved as of
+// that instant rather than now (see search.DescribeRequest.At),
+// following only claims that existed by then.
+//
+// Resolve only takes a plain-text expression, not a structured
+// search.Constraint: Expression and Constraint aren't independent,
+// ANDable halves of one SearchQuery (Expression compiles down into
+// Constraint server-side when Constraint is unset), so a caller
+// wanting to narrow results by something the expression language has
+// no predicate for (e.g. pkg/fs's by-year/by-month facets) has to
+// filter Resolve's returned Entries itself, by ModTime or otherwise.
+//
+// Resolve fetches everything in a single, unbounded query; callers
+// expecting result sets too large to hold in memory at once (e.g.
+// pkg/fs's searchResultDir) should page through ResolvePage instead.
+func Resolve(ctx context.Context, q Querier, expr string, at *types.Time3339) ([]Entry, error) {
+	ents, _, _, _, _, _, _, _, _, err := resolvePage(ctx, q, expr, at, -1, "", make(map[string]bool), 0, nil, search.UnspecifiedSort, "", "", nil, defaultContentHops, false, UndescribedContentSkip, DescribeEmbedded, "", 0, nil, nil, SpecialContentSkip)
+	return ents, err
+}
+
+// defaultContentHops is the number of additional camliContent hops
+// Resolve follows when a result's content itself turns out to be a
+// permanode, rather than a file or directory; see ResolvePage's
+// contentHops parameter.
+const defaultContentHops = 1
+
+// UndescribedContentPolicy controls how resolvePage's finalization
+// pass handles a content ref that still hasn't resolved to a file,
+// directory, or symlink once its own describe, fallbackContentMeta,
+// and up to contentHops rounds of followContentIndirection have all
+// already been tried: the only point left where an entry can still
+// end up unresolved.
+type UndescribedContentPolicy int
+
+const (
+	// UndescribedContentSkip drops the entry, exactly as resolvePage
+	// has always done. It's counted in unresolved either way.
+	UndescribedContentSkip UndescribedContentPolicy = iota
+
+	// UndescribedContentFetch gives the content ref one further,
+	// deliberately deeper round of followContentIndirection (see
+	// extraFetchHops) before giving up, for a chain of indirection
+	// longer than contentHops was willing to chase by default.
+	UndescribedContentFetch
+
+	// UndescribedContentPlaceholder keeps the entry in the listing
+	// as a zero-byte stub (see placeholderEntry) named from the
+	// unresolved content ref's own blobref, instead of dropping it,
+	// so a tool that counts entries still sees every match.
+	UndescribedContentPlaceholder
+)
+
+// extraFetchHops is how many further camliContent hops
+// UndescribedContentFetch tries once contentHops itself has already
+// run out without reaching a file, directory, or symlink.
+const extraFetchHops = 4
+
+// SpecialContentPolicy controls what fileOrDirEntry does with a
+// camliContent that did resolve, but to a schema type it doesn't
+// otherwise know how to list (not a file, directory, symlink, or
+// static set) -- typically a unix-special file (a fifo, socket, or
+// device node) an importer recorded via a "camliUnixType" permanode
+// attribute since its bytes couldn't be uploaded as ordinary
+// camliContent. See UndescribedContentPolicy for the analogous policy
+// over content that never resolved at all.
+type SpecialContentPolicy int
+
+const (
+	// SpecialContentSkip drops the entry, exactly as resolvePage has
+	// always done. It's the zero value, so a caller that never
+	// configured this policy sees no change in behavior.
+	SpecialContentSkip SpecialContentPolicy = iota
+
+	// SpecialContentRepresent exposes a recognized camliUnixType as
+	// the matching Entry.IsSpecial fields (see their own doc comment),
+	// for the caller to represent as the equivalent FUSE node type
+	// when that's safe: a fifo or a socket. A device node (chardev or
+	// blockdev) carries a real device number pointing at actual host
+	// hardware, so it's never considered safe to expose as a live
+	// FUSE node; the caller falls back to a placeholder for those
+	// instead. An unrecognized or missing camliUnixType still drops
+	// the entry, same as SpecialContentSkip.
+	SpecialContentRepresent
+)
+
+// DescribeStrategy selects how resolvePage obtains describe metadata
+// for a page's results: embedded in the search query itself, or via a
+// separate, batched describe call issued after the query comes back.
+type DescribeStrategy int
+
+const (
+	// DescribeEmbedded sends the describe request as part of the
+	// search query, exactly as resolvePage has always done. It's the
+	// right choice for a server whose query and describe paths are
+	// equally cheap, and the only one available for a q that doesn't
+	// also implement Describer.
+	DescribeEmbedded DescribeStrategy = iota
+
+	// DescribeSeparate sends the search query with no describe
+	// request at all, then batch-describes the page's unique
+	// blobrefs in one or more follow-up calls (see
+	// describeBatchSize), via q's Describer. It suits a server where
+	// the embedded describe is capped lower than the query's own
+	// Limit, or where splitting the two round trips lets the server
+	// cache or parallelize them more effectively. It falls back to
+	// DescribeEmbedded's own query (i.e. still none at all) if q
+	// doesn't implement Describer.
+	DescribeSeparate
+)
+
+// describeBatchSize caps how many blobrefs resolvePage asks for in a
+// single DescribeSeparate follow-up call, so a page near
+// ResolvePageSize doesn't risk a single describe request the server
+// considers too large to serve.
+const describeBatchSize = 250
+
+// describeSeparately batch-describes the unique blobrefs among
+// blobs, using d, rules, and at exactly as the embedded describe
+// request in resolvePage would, paginating the calls at
+// describeBatchSize. It returns the merged per-blob metadata, or a nil
+// map (not an error) if blobs is empty.
+func describeSeparately(ctx context.Context, d Describer, blobs []*search.SearchResultBlob, rules []*search.DescribeRule, at *types.Time3339, depth int) (search.MetaMap, error) {
+	refs := degradeAll(blobs)
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	merged := make(search.MetaMap)
+	for start := 0; start < len(refs); start += describeBatchSize {
+		end := start + describeBatchSize
+		if end > len(refs) {
+			end = len(refs)
+		}
+		req := &search.DescribeRequest{
+			BlobRefs: refs[start:end],
+			Rules:    rules,
+		}
+		if at != nil {
+			req.At = *at
+		}
+		if depth > 0 {
+			req.Depth = depth
+		}
+		res, err := d.Describe(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for ref, db := range res.Meta {
+			merged[ref] = db
+		}
+	}
+	return merged, nil
+}
+
+// DefaultDescribeRules is the describe ruleset resolvePage uses when a
+// caller doesn't supply its own: the minimum a dir.Entry needs to
+// resolve a result's content, image, members, and unix attrs. It's
+// exported so a caller that wants to add its own attrs to rules,
+// rather than replace them outright, has something to merge them
+// onto; see pkg/fs's CamliFileSystem.DescribeExtraAttrs.
+var DefaultDescribeRules = []*search.DescribeRule{
+	{Attrs: []string{"camliContent", "camliContentImage", "camliMember", "unixPermission", "unixOwner", "unixGroup", "unixMtime"}},
+}
+
+// ResolvePageSize is the number of permanodes ResolvePage fetches per
+// call.
+const ResolvePageSize = 1000
+
+// ResolvePage is Resolve, but paged: it fetches at most
+// ResolvePageSize results starting after continueToken (the empty
+// string for the first page) and returns them along with the token
+// for the next page, which is empty once there are no more results.
+//
+// seen tracks names already assigned on prior pages, for the same
+// fallback-naming logic Resolve applies within a single query;
+// callers paging through a result set must reuse the same map across
+// calls rather than passing a fresh one each time.
+//
+// depth caps how many blobref hops the describe request follows (see
+// search.DescribeRequest.Depth); 0 leaves it at the server's own
+// default. A set whose members didn't come back described because
+// depth cut them off is left out of ents entirely rather than listed
+// with data we can't vouch for; elided reports how many sets that
+// happened to, for the caller to log.
+//
+// A file or directory entry whose camliContent similarly didn't come
+// back described is recovered instead of dropped, via a direct
+// describe of just that blobref (see fallbackContentMeta); fallbacks
+// reports how many entries needed that recovery, for the caller to
+// log and, if it's high, use to tune depth.
+//
+// A permanode whose camliContent attribute is present but doesn't
+// parse as a blobref at all (empty, or malformed) is skipped outright
+// rather than recovered; badContent collects those permanodes, for
+// the caller to log in aggregate and optionally surface for
+// investigation, since that's a data problem no amount of retrying or
+// depth-tuning fixes.
+//
+// rules overrides the describe rules the query's DescribeRequest
+// uses; pass nil for DefaultDescribeRules, the rules needed to
+// populate Entry itself. A caller supplying its own rules is
+// responsible for including those same attrs if it still wants
+// Entry's fields populated; extra attrs (e.g. a custom "location" or
+// "album") just ride along in the describe response's meta for the
+// caller to look up itself.
+//
+// sortBy asks the server to return each page already ordered; pass
+// search.UnspecifiedSort to leave ordering up to the server's own
+// default (in practice, an unspecified, roughly relevance/recency
+// order), the same as before this parameter existed. Since ordering
+// is requested per page rather than once for the whole result set, a
+// caller paging through with a non-default sortBy must pass the same
+// value on every call, the same requirement continueToken already
+// has, or the pages won't stitch together in order.
+//
+// nameAttr, if non-empty, makes a resulting Entry's Name prefer that
+// permanode attribute over its content's stored filename when the
+// attribute is present (see fileOrDirEntry); it's added to rules
+// automatically, but only when rules is nil, since a caller supplying
+// its own rules is already on the hook for including whatever attrs
+// it wants to see, the same as for Entry's other fields.
+//
+// groupAttr, if non-empty, is another permanode attribute (e.g.
+// "album") a caller wants grouped results bucketed by; like nameAttr,
+// it's added to rules automatically, but only when rules is nil. It
+// doesn't otherwise affect resolution: resolvePage has no notion of
+// grouping itself, the caller (pkg/fs's searchGroupByDir) reads it
+// back out of the resulting Entry's PNodeMeta.
+//
+// mimePreference, if non-empty, resolves a permanode with more than
+// one camliContent candidate (e.g. an original RAW alongside a
+// derived JPEG) to the first candidate whose MIME type appears in it,
+// in order, instead of latestCamliContent's default of just the most
+// recently claimed value; see preferredCamliContent. A candidate this
+// page's describe didn't reach can't be checked and is skipped for
+// preference purposes. An empty mimePreference, or a permanode with
+// only one camliContent candidate, behaves exactly as before this
+// parameter existed.
+//
+// A server configured without describe support comes back with
+// res.Describe entirely nil, meaning none of this page's matches can
+// be turned into an Entry; rather than silently returning an empty
+// page, their raw blobrefs are returned via degraded so the caller can
+// fall back to resolving them some other way (e.g. pkg/fs's
+// fetchSchemaMeta, treating each directly as its own content blob). A
+// server that describes most of a page but happens to omit one or two
+// blobrefs' meta hands just those back via degraded too, alongside the
+// normal Entries for everything it did describe, rather than losing
+// them.
+//
+// contentHops caps how many additional camliContent hops are followed
+// when a result's content resolves to another permanode rather than a
+// file, directory, or symlink: such a permanode's own camliContent is
+// described in turn (via a direct describe, the same recovery
+// fallbackContentMeta already does) and checked again, up to
+// contentHops times, so a permanode that merely points at another
+// permanode still resolves to its eventual file. A 0 disables this
+// indirection entirely, for parity with callers predating it.
+// unresolved counts entries that still hadn't reached a file,
+// directory, or symlink once contentHops ran out, for the caller to
+// log; they're skipped exactly as they always were.
+//
+// includeContentless makes a permanode with neither a camliContent
+// nor a camliMember attribute come back as an Entry with
+// IsContentless set (see contentlessEntry), named and timestamped the
+// same way setEntry already names an untitled set, instead of being
+// silently dropped as it always was before this parameter existed.
+//
+// policy decides what happens to an entry whose content still hasn't
+// resolved once contentHops has run out: UndescribedContentSkip drops
+// it, exactly as before policy existed; UndescribedContentFetch gives
+// it one further, deeper indirection attempt; UndescribedContentPlaceholder
+// keeps it in the listing as a stub. See UndescribedContentPolicy.
+//
+// Resolving each entry's content (including any fallback or
+// indirection describe) happens concurrently, bounded by
+// resolveConcurrency, since a page full of entries needing one of
+// those is otherwise bottlenecked behind a single fetch at a time.
+// ents is still built back up in the page's original order, the order
+// a caller applying its own sort to the combined pages depends on.
+//
+// describeStrategy picks whether describe metadata rides along with
+// the search query (DescribeEmbedded, the default, matching every
+// caller predating this parameter) or is fetched in a separate,
+// batched call afterward (DescribeSeparate); see DescribeStrategy.
+// Either strategy must yield the same ents for the same page.
+//
+// pageLimit overrides ResolvePageSize for this call when positive,
+// e.g. for a caller retrying a query the server rejected as too
+// costly with a smaller page than its usual default; zero (matching
+// every caller predating this parameter) keeps ResolvePageSize.
+//
+// contentAttr, when non-empty, is tried in place of "camliContent" for
+// resolving a permanode's primary content, for a schema that points at
+// its file or directory through some other attribute instead; a
+// permanode with nothing under contentAttr still falls back to
+// "camliContent", so mixing conventions within one expression's
+// results works. The empty string (matching every caller predating
+// this parameter) uses "camliContent" outright. See latestCamliContent.
+//
+// total reports how many results expr matched in total, per the
+// server's own TotalMatchesReporter if this page's response
+// implements it; totalKnown is false when it doesn't, in which case
+// total is just len(ents) for this page, not a true total, and the
+// caller should present it as such (see totalMatches).
+//
+// maxInlineMembers caps how many of a set's camliMember values its
+// Entry.Members carries; the rest are dropped (see capMembers) with
+// Entry.MembersTruncated set, for the caller to fetch in full once
+// the set is actually worth paying for. Zero or negative (matching
+// every caller predating this option) keeps every member inline, same
+// as before it existed.
+//
+// contentAttrAliases and titleAttrAliases are each tried, in order,
+// after contentAttr and nameAttr respectively come up empty on a
+// given permanode, before falling back to "camliContent" or the
+// content's own filename exactly as before either existed: a mount
+// bridging permanodes written under more than one schema convention
+// lists them all the same way instead of contentAttr/nameAttr alone
+// only catching the newest (or oldest) of them. Either being nil
+// preserves the single-attribute behavior for that field.
+//
+// specialPolicy decides what happens to an entry whose camliContent
+// resolved, but to a schema type that isn't a file, directory,
+// symlink, or static set: SpecialContentSkip drops it, exactly as
+// before this parameter existed; SpecialContentRepresent exposes a
+// recognized unix-special permanode (see Entry.IsSpecial) instead of
+// dropping it. See SpecialContentPolicy.
+func ResolvePage(ctx context.Context, q Querier, expr string, at *types.Time3339, continueToken string, seen map[string]bool, depth int, rules []*search.DescribeRule, sortBy search.SortType, nameAttr string, groupAttr string, mimePreference []string, contentHops int, includeContentless bool, policy UndescribedContentPolicy, describeStrategy DescribeStrategy, pageLimit int, contentAttr string, maxInlineMembers int, contentAttrAliases []string, titleAttrAliases []string, specialPolicy SpecialContentPolicy) (ents []Entry, next string, elided int, fallbacks int, unresolved int, badContent, degraded []blob.Ref, total int, totalKnown bool, err error) {
+	limit := ResolvePageSize
+	if pageLimit > 0 {
+		limit = pageLimit
+	}
+	return resolvePage(ctx, q, expr, at, limit, continueToken, seen, depth, rules, sortBy, nameAttr, groupAttr, mimePreference, contentHops, includeContentless, policy, describeStrategy, contentAttr, maxInlineMembers, contentAttrAliases, titleAttrAliases, specialPolicy)
+}
+
+// nonEmpty returns the non-empty strings among attrs, in order, for
+// resolvePage's rules-building step to append to a describe rule's
+// Attrs without caring which of nameAttr/groupAttr/contentAttr, if
+// any, were set.
+func nonEmpty(attrs ...string) []string {
+	var out []string
+	for _, a := range attrs {
+		if a != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// degradeAll hands every blob in blobs back as degraded, deduplicated
+// by blobref: some query/describe combinations can return the same
+// blobref more than once in a single page, and degrading it twice
+// would otherwise have the caller resolve and list it twice.
+func degradeAll(blobs []*search.SearchResultBlob) []blob.Ref {
+	degraded := make([]blob.Ref, 0, len(blobs))
+	seen := make(map[blob.Ref]bool, len(blobs))
+	for _, ri := range blobs {
+		if seen[ri.Blob] {
+			continue
+		}
+		seen[ri.Blob] = true
+		degraded = append(degraded, ri.Blob)
+	}
+	return degraded
+}
+
+// TotalMatchesReporter is implemented by a search.SearchResult whose
+// server additionally reported how many results matched the query in
+// total, beyond the page actually present in Blobs. Not every
+// server/query combination reports this; resolvePage falls back to
+// the page's own visible count when it doesn't (see totalMatches).
+type TotalMatchesReporter interface {
+	TotalMatches() (total int, ok bool)
+}
+
+// totalMatches reports how many results expr matched in total, per
+// res's own TotalMatchesReporter implementation if it has one,
+// otherwise visible (the number of blobs actually in this page),
+// with known=false so the caller can flag the count as page-local
+// rather than a true total.
+func totalMatches(res *search.SearchResult, visible int) (total int, known bool) {
+	if tr, ok := (interface{})(res).(TotalMatchesReporter); ok {
+		if n, has := tr.TotalMatches(); has {
+			return n, true
+		}
+	}
+	return visible, false
+}
+
+// skipReason is why resolvePage's first pass over a page's blobs
+// didn't turn one into an Entry, a set, or a badContent/elided
+// candidate: every occurrence is counted rather than logged
+// individually, so a page full of them produces one summary line
+// (see skipSummary) instead of flooding the log with one per blob.
+type skipReason int
+
+const (
+	skipDuplicate   skipReason = iota // already seen earlier in this same page
+	skipNoMeta                        // res.Describe.Meta had nothing at all for this blobref
+	skipNoPermanode                   // meta was there, but meta.Permanode was nil
+)
+
+// skipReasons is every skipReason, in the order skipSummary reports
+// them.
+var skipReasons = []skipReason{skipDuplicate, skipNoMeta, skipNoPermanode}
+
+func (r skipReason) String() string {
+	switch r {
+	case skipDuplicate:
+		return "duplicate"
+	case skipNoMeta:
+		return "no describe meta"
+	case skipNoPermanode:
+		return "no permanode"
+	default:
+		return "unknown"
+	}
+}
+
+// skipSummary renders counts, keyed by skipReason, as a
+// comma-separated "N reason" list in skipReasons order, omitting any
+// reason with a zero count, e.g. "3 no describe meta, 2 no
+// permanode".
+func skipSummary(counts map[skipReason]int) string {
+	var parts []string
+	for _, r := range skipReasons {
+		if n := counts[r]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, r))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// totalSkipped sums every reason's count in counts.
+func totalSkipped(counts map[skipReason]int) int {
+	var total int
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+func resolvePage(ctx context.Context, q Querier, expr string, at *types.Time3339, limit int, continueToken string, seen map[string]bool, depth int, rules []*search.DescribeRule, sortBy search.SortType, nameAttr string, groupAttr string, mimePreference []string, contentHops int, includeContentless bool, policy UndescribedContentPolicy, describeStrategy DescribeStrategy, contentAttr string, maxInlineMembers int, contentAttrAliases []string, titleAttrAliases []string, specialPolicy SpecialContentPolicy) ([]Entry, string, int, int, int, []blob.Ref, []blob.Ref, int, bool, error) {
+	if rules == nil {
+		rules = DefaultDescribeRules
+		extra := nonEmpty(nameAttr, groupAttr, contentAttr)
+		extra = append(extra, contentAttrAliases...)
+		extra = append(extra, titleAttrAliases...)
+		if len(extra) > 0 {
+			rules = []*search.DescribeRule{{Attrs: append(append([]string{}, DefaultDescribeRules[0].Attrs...), extra...)}}
+		}
+	}
+	query := &search.SearchQuery{
+		Expression: expr,
+		Limit:      limit,
+		Continue:   continueToken,
+		Sort:       sortBy,
+	}
+	d, canDescribeSeparately := q.(Describer)
+	if describeStrategy != DescribeSeparate || !canDescribeSeparately {
+		describe := &search.DescribeRequest{
+			Rules: rules,
+		}
+		if at != nil {
+			describe.At = *at
+		}
+		if depth > 0 {
+			describe.Depth = depth
+		}
+		query.Describe = describe
+	}
+	res, err := q.Query(ctx, query)
+	if err != nil {
+		return nil, "", 0, 0, 0, nil, nil, 0, false, err
+	}
+	if describeStrategy == DescribeSeparate && canDescribeSeparately {
+		meta, err := describeSeparately(ctx, d, res.Blobs, rules, at, depth)
+		if err != nil {
+			return nil, "", 0, 0, 0, nil, nil, 0, false, err
+		}
+		res.Describe = &search.DescribeResponse{Meta: meta}
+	}
+
+	// Either the response carries no Describe section at all (the
+	// query somehow went out without one, or the server declined to
+	// honor it), or it carries one with a nil Meta (the server ran the
+	// describe but it came back empty). Both leave this page with
+	// nothing to resolve any of its blobs through via
+	// res.Describe.Meta.Get below, and in both cases the right answer
+	// is the same: hand every blob in the page back as degraded, so
+	// doReaddir's caller can retry resolving them directly via
+	// fetchSchemaMeta, rather than silently dropping the whole page.
+	if res.Describe == nil {
+		total, totalKnown := totalMatches(res, len(res.Blobs))
+		return nil, res.Continue, 0, 0, 0, nil, degradeAll(res.Blobs), total, totalKnown, nil
+	}
+	if res.Describe.Meta == nil {
+		total, totalKnown := totalMatches(res, len(res.Blobs))
+		return nil, res.Continue, 0, 0, 0, nil, degradeAll(res.Blobs), total, totalKnown, nil
+	}
+
+	// A first, cheap, sequential pass over res.Blobs: every lookup here
+	// is a res.Describe.Meta.Get against data the query already
+	// returned, so there's nothing worth a worker pool for. It sorts
+	// each blob into a pageItem with content still to resolve (an
+	// operation that can involve real network fallback and indirection
+	// fetches, see resolveContentConcurrently) or a set, and finishes
+	// off bad content and elided sets outright.
+	var ents []Entry
+	var elided int
+	var badContent, degraded []blob.Ref
+	var items []pageItem
+	seenBlobs := make(map[blob.Ref]bool, len(res.Blobs))
+	skipped := map[skipReason]int{}
+	for _, ri := range res.Blobs {
+		pn := ri.Blob
+		if seenBlobs[pn] {
+			// Some query/describe combinations can return the same
+			// blobref more than once in a single page; processing it
+			// twice would otherwise produce two Entry values for the
+			// same permanode, which pkg/fs's collision handling would
+			// then list as confusing same-content duplicates under
+			// suffixed names.
+			skipped[skipDuplicate]++
+			continue
+		}
+		seenBlobs[pn] = true
+		meta := res.Describe.Meta.Get(pn)
+		if meta == nil {
+			// The rest of the page's Describe came back fine; it's just
+			// this one blobref the server didn't include meta for. Hand
+			// it back degraded rather than dropping it outright, so the
+			// caller's own degraded-mode fallback (a direct describe of
+			// just this blob) gets a chance to still list it; see
+			// degradeAll and ResolvePage's degraded return.
+			skipped[skipNoMeta]++
+			degraded = append(degraded, pn)
+			continue
+		}
+		if meta.Permanode == nil {
+			skipped[skipNoPermanode]++
+			continue
+		}
+		cc, ok, malformed := preferredCamliContent(pn, meta.Permanode.Attr, res.Describe, mimePreference, contentAttr, contentAttrAliases)
+		if malformed {
+			badContent = append(badContent, pn)
+			continue
+		}
+		if ok {
+			items = append(items, pageItem{pn: pn, meta: meta, cc: cc, hasContent: true})
+			continue
+		}
+		members := meta.Permanode.Attr["camliMember"]
+		if len(members) == 0 {
+			if includeContentless {
+				ents = append(ents, contentlessEntry(pn, meta, seen))
+			}
+			continue
+		}
+		if depth > 0 && !anyMemberDescribed(res.Describe, members) {
+			// None of this set's members came back described, meaning
+			// depth cut the describe off before it could reach them;
+			// list it once it can be resolved deeply enough to vouch
+			// for, rather than show an apparently empty or unverifiable
+			// set.
+			elided++
+			continue
+		}
+		cappedMembers, truncated := capMembers(pn, members, maxInlineMembers)
+		items = append(items, pageItem{pn: pn, meta: meta, members: cappedMembers, membersTruncated: truncated})
+	}
+	if total := totalSkipped(skipped); total > 0 {
+		// One line for the whole page instead of one per skipped blob,
+		// which would otherwise flood the log on a page full of
+		// duplicates or missing describe meta; see skipReason.
+		Logger.Printf("dir: page for %q skipped %d blob(s): %s", expr, total, skipSummary(skipped))
+	}
+
+	// The only part of finishing each item that can touch the network
+	// (a fallback or indirection describe) is content resolution;
+	// running those concurrently, bounded by resolveConcurrency, is what
+	// keeps a page full of them from serializing behind one fetch at a
+	// time. Results land in a slot per item, keyed by its position in
+	// items, so the finalization pass below can walk items in their
+	// original order without needing to match anything back up itself.
+	contentResults := resolveContentConcurrently(ctx, q, at, res.Describe, items, contentHops, contentAttr, contentAttrAliases)
+
+	var fallbacks, unresolved int
+	for i, it := range items {
+		if !it.hasContent {
+			e := setEntry(it.pn, it.meta, it.members, it.membersTruncated, seen)
+			e.Meta = res.Describe.Meta
+			ents = append(ents, e)
+			continue
+		}
+		cr := contentResults[i]
+		if cr.fellBack {
+			fallbacks++
+		}
+		if !cr.reached {
+			switch policy {
+			case UndescribedContentFetch:
+				if cr.ccMeta != nil {
+					meta := cr.ccMeta
+					if followContentIndirection(ctx, q, at, res.Describe, &meta, extraFetchHops, contentAttr, contentAttrAliases, it.pn) {
+						var imgMeta *search.DescribedBlob
+						if img, ok := blob.Parse(it.meta.Permanode.Attr.Get("camliContentImage")); ok {
+							imgMeta = res.Describe.Meta.Get(img)
+						}
+						if e, ok := fileOrDirEntry(it.pn, it.meta, meta, imgMeta, seen, nameAttr, titleAttrAliases, specialPolicy); ok {
+							ents = append(ents, e)
+							continue
+						}
+					}
+				}
+			case UndescribedContentPlaceholder:
+				ents = append(ents, placeholderEntry(it.pn, it.meta, it.cc, seen))
+			}
+			unresolved++
+			continue
+		}
+		var imgMeta *search.DescribedBlob
+		if img, ok := blob.Parse(it.meta.Permanode.Attr.Get("camliContentImage")); ok {
+			imgMeta = res.Describe.Meta.Get(img)
+		}
+		if e, ok := fileOrDirEntry(it.pn, it.meta, cr.ccMeta, imgMeta, seen, nameAttr, titleAttrAliases, specialPolicy); ok {
+			ents = append(ents, e)
+		}
+	}
+	total, totalKnown := totalMatches(res, len(res.Blobs))
+	return ents, res.Continue, elided, fallbacks, unresolved, badContent, degraded, total, totalKnown, nil
+}
+
+// pageItem is one res.Blobs entry that resolvePage's first pass has
+// already confirmed is either a set (members non-empty) or has a
+// camliContent worth resolving (hasContent), for
+// resolveContentConcurrently and resolvePage's finalization pass to
+// finish in that order.
+type pageItem struct {
+	pn               blob.Ref
+	meta             *search.DescribedBlob
+	members          []string
+	membersTruncated bool
+
+	hasContent bool
+	cc         blob.Ref // only meaningful when hasContent
+}
+
+// resolveConcurrency bounds how many of a page's content items
+// resolveContentConcurrently resolves at once: large enough that a
+// page full of entries needing a fallback or indirection describe (see
+// fallbackContentMeta and followContentIndirection) isn't bottlenecked
+// behind one fetch at a time, small enough not to open an unbounded
+// number of connections to the search server for a single ReadDirAll.
+const resolveConcurrency = 16
+
+// contentResolution is one pageItem's resolved content, once
+// resolveContentConcurrently has followed any fallback and indirection
+// hops it needed. reached is false if it never reached a file,
+// directory, or symlink; ccMeta is nil in that case.
+type contentResolution struct {
+	ccMeta   *search.DescribedBlob
+	fellBack bool
+	reached  bool
+}
+
+// resolveContentConcurrently resolves every content item's (see
+// pageItem.hasContent) final camliContent describe meta, using up to
+// resolveConcurrency workers at once. Each item is independent of the
+// others, so results are written straight into the slot matching its
+// position in items rather than collected through a channel; the
+// caller is the one that still needs items' original order, for the
+// seen-map-driven naming fileOrDirEntry and setEntry do.
+func resolveContentConcurrently(ctx context.Context, q Querier, at *types.Time3339, describe *search.DescribeResponse, items []pageItem, contentHops int, contentAttr string, contentAttrAliases []string) []contentResolution {
+	results := make([]contentResolution, len(items))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, resolveConcurrency)
+	for i, it := range items {
+		if !it.hasContent {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, cc blob.Ref) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ccMeta := describe.Meta.Get(cc)
+			var fellBack bool
+			if ccMeta == nil {
+				var ok bool
+				ccMeta, ok = fallbackContentMeta(ctx, q, cc, at)
+				if !ok {
+					return
+				}
+				fellBack = true
+			}
+			reached := followContentIndirection(ctx, q, at, describe, &ccMeta, contentHops, contentAttr, contentAttrAliases, it.pn)
+			results[i] = contentResolution{ccMeta: ccMeta, fellBack: fellBack, reached: reached}
+		}(i, it.cc)
+	}
+	wg.Wait()
+	return results
+}
+
+// followContentIndirection advances *ccMeta through up to hops more
+// camliContent hops when it's itself a permanode rather than a
+// resolved file, directory, or symlink: some permanodes point their
+// camliContent at another permanode (e.g. one that re-shares or
+// versions another's content) instead of a file blob directly. Each
+// hop's target is looked up in res first, the same as the describe
+// request's own page, and only described directly (via
+// fallbackContentMeta) when the page didn't already carry it.
+//
+// reached is false if *ccMeta still isn't a file, directory, or
+// symlink once hops runs out, or a hop's camliContent is missing,
+// malformed, itself fails to describe, or revisits a blobref already
+// seen earlier in this same chain (a cycle, which no finite hops
+// budget would otherwise stop); ccMeta is left at whatever it last
+// resolved to, for the caller to skip without it. pn, the entry's own
+// permanode, is only used to identify the chain in the debug log line
+// this emits once indirection actually does something (zero hops
+// followed logs nothing, since that's the common, uninteresting
+// case).
+func followContentIndirection(ctx context.Context, q Querier, at *types.Time3339, res *search.DescribeResponse, ccMeta **search.DescribedBlob, hops int, contentAttr string, contentAttrAliases []string, pn blob.Ref) (reached bool) {
+	meta := *ccMeta
+	visited := map[blob.Ref]bool{meta.BlobRef: true}
+	followed := 0
+	for i := 0; i < hops; i++ {
+		if meta.File != nil || meta.Dir != nil || meta.Symlink != nil {
+			break
+		}
+		if meta.Permanode == nil {
+			break
+		}
+		next, ok, malformed := latestCamliContent(meta.BlobRef, meta.Permanode.Attr, contentAttr, contentAttrAliases)
+		if !ok || malformed {
+			return false
+		}
+		if visited[next] {
+			Logger.Printf("dir: permanode %v: camliContent indirection revisited %v after %d hop(s); stopping to avoid a cycle", pn, next, followed)
+			return false
+		}
+		visited[next] = true
+		nextMeta := res.Meta.Get(next)
+		if nextMeta == nil {
+			var ok2 bool
+			nextMeta, ok2 = fallbackContentMeta(ctx, q, next, at)
+			if !ok2 {
+				return false
+			}
+		}
+		meta = nextMeta
+		followed++
+	}
+	if followed > 0 {
+		Logger.Printf("dir: permanode %v: camliContent indirection followed %d hop(s) to reach %v", pn, followed, meta.BlobRef)
+	}
+	*ccMeta = meta
+	return meta.File != nil || meta.Dir != nil || meta.Symlink != nil
+}
+
+// contentAttrValues returns the raw candidate values to resolve a
+// permanode's primary content from: attrs[contentAttr] when
+// contentAttr is set and non-empty for this permanode, falling back to
+// attrs["camliContent"] otherwise, so a schema that points at its file
+// or directory through some other attribute still resolves for a
+// permanode that (for whatever reason) only has camliContent set.
+// contentAttrValues returns attrs[contentAttr], or, failing that,
+// attrs[alias] for the first of contentAttrAliases with any values at
+// all, before falling back to attrs["camliContent"] exactly as
+// before either parameter existed. contentAttrAliases lets a mount
+// recognize a permanode written under an older or newer schema's
+// content-attribute name without replacing contentAttr outright; see
+// CamliFileSystem.ContentAttrAliases.
+func contentAttrValues(attrs url.Values, contentAttr string, contentAttrAliases []string) []string {
+	if contentAttr != "" {
+		if values := attrs[contentAttr]; len(values) > 0 {
+			return values
+		}
+	}
+	for _, alias := range contentAttrAliases {
+		if values := attrs[alias]; len(values) > 0 {
+			Logger.Printf("dir: content resolved via alias attribute %q instead of %q", alias, contentAttr)
+			return values
+		}
+	}
+	return attrs["camliContent"]
+}
+
+// firstAttrValue returns the first non-empty value of primary, or,
+// failing that, of each of aliases in order, along with which
+// attribute name actually supplied it, so a caller can tell whether
+// primary or a fallback alias was what resolved it. It reports
+// ok=false if neither primary nor any alias has a value.
+func firstAttrValue(attrs url.Values, primary string, aliases []string) (value, attr string, ok bool) {
+	if primary != "" {
+		if v := attrs.Get(primary); v != "" {
+			return v, primary, true
+		}
+	}
+	for _, alias := range aliases {
+		if v := attrs.Get(alias); v != "" {
+			return v, alias, true
+		}
+	}
+	return "", "", false
+}
+
+// latestCamliContent returns the most recently claimed value of a
+// permanode's primary content attribute (see contentAttrValues),
+// rather than Attr.Get's first element: Perkeep accumulates a
+// multi-valued attribute's claims in the order they were applied, so
+// the first element is the oldest surviving value, not the newest. pn
+// is only used for the log line when there's more than one candidate,
+// so a caller can tell a permanode was ambiguous without re-fetching it
+// to investigate.
+//
+// malformed distinguishes "no content attribute at all" (ok and
+// malformed both false, a permanode that may still be a set) from
+// "content attribute present but didn't parse as a blobref" (malformed
+// true), which a caller paging through a lot of results wants to count
+// as a data problem rather than silently treat the same as the former.
+func latestCamliContent(pn blob.Ref, attrs url.Values, contentAttr string, contentAttrAliases []string) (cc blob.Ref, ok bool, malformed bool) {
+	values := contentAttrValues(attrs, contentAttr, contentAttrAliases)
+	if len(values) == 0 {
+		return blob.Ref{}, false, false
+	}
+	latest := values[len(values)-1]
+	if len(values) > 1 {
+		Logger.Printf("dir: permanode %v has %d camliContent values %v; using most recent %q", pn, len(values), values, latest)
+	}
+	cc, ok = blob.Parse(latest)
+	return cc, ok, !ok
+}
+
+// preferredCamliContent is latestCamliContent, but when a permanode
+// has more than one content candidate (see contentAttrValues) and
+// mimePreference is non-empty, it picks the first candidate whose MIME
+// type appears in mimePreference, trying each preferred type in order,
+// instead of just the most recently claimed candidate. Only candidates
+// already described within this page (desc.Meta.Get) can be inspected
+// for a MIME type; an undescribed candidate is skipped rather than
+// fetched just to check it. latestCamliContent's most-recent-claim
+// behavior is the fallback whenever no candidate matches a preference,
+// or there's nothing to prefer between (a single candidate, or no
+// mimePreference at all).
+func preferredCamliContent(pn blob.Ref, attrs url.Values, desc *search.DescribeResponse, mimePreference []string, contentAttr string, contentAttrAliases []string) (cc blob.Ref, ok bool, malformed bool) {
+	values := contentAttrValues(attrs, contentAttr, contentAttrAliases)
+	if len(mimePreference) > 0 && len(values) > 1 && desc != nil && desc.Meta != nil {
+		var candidates []blob.Ref
+		for _, v := range values {
+			if ref, ok := blob.Parse(v); ok {
+				candidates = append(candidates, ref)
+			}
+		}
+		for _, want := range mimePreference {
+			for _, ref := range candidates {
+				m := desc.Meta.Get(ref)
+				if m != nil && m.File != nil && m.File.MIMEType == want {
+					Logger.Printf("dir: permanode %v has %d camliContent values; chose %v for preferred MIME %q", pn, len(values), ref, want)
+					return ref, true, false
+				}
+			}
+		}
+	}
+	return latestCamliContent(pn, attrs, contentAttr, contentAttrAliases)
+}
+
+// fallbackContentMeta describes cc directly when the surrounding
+// query's own describe didn't resolve it (most likely because depth
+// cut it off before reaching it), so an otherwise-legitimate entry
+// isn't dropped just because it happened to need one more hop than
+// the query allowed for. It requires q to also implement Describer,
+// which the real client always does; ok is false if it doesn't, or if
+// the direct describe itself fails or still doesn't resolve cc. at
+// re-pins the fallback to the same instant as the query it's
+// recovering for, so a snapshot directory's recovered entries are just
+// as point-in-time as its regular ones.
+func fallbackContentMeta(ctx context.Context, q Querier, cc blob.Ref, at *types.Time3339) (*search.DescribedBlob, bool) {
+	d, ok := q.(Describer)
+	if !ok {
+		return nil, false
+	}
+	req := &search.DescribeRequest{BlobRef: cc}
+	if at != nil {
+		req.At = *at
+	}
+	res, err := d.Describe(ctx, req)
+	if err != nil {
+		return nil, false
+	}
+	meta := res.Meta.Get(cc)
+	return meta, meta != nil
+}
+
+// anyMemberDescribed reports whether at least one of members (raw
+// camliMember attribute values) was described within the query's
+// depth limit, i.e. has describe meta in res.
+func anyMemberDescribed(res *search.DescribeResponse, members []string) bool {
+	for _, m := range members {
+		if mr, ok := blob.Parse(m); ok && res.Meta.Get(mr) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// mimeExtOverrides gives the canonical extension for MIME types
+// either mime.ExtensionsByType doesn't know, or for which it returns
+// an extension Perkeep users wouldn't expect first (e.g. ".jpe"
+// ahead of ".jpg" for image/jpeg, on some systems' mime.types).
+var mimeExtOverrides = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"audio/mpeg":      ".mp3",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+}
+
+// extensionForMIME returns the canonical filename extension
+// (including the leading dot) for mimeType, or "" if none is known.
+// mimeExtOverrides is checked first, for types where Perkeep's
+// preference differs from or isn't covered by Go's mime package;
+// mime.ExtensionsByType is the fallback for everything else.
+func extensionForMIME(mimeType string) string {
+	if ext, ok := mimeExtOverrides[mimeType]; ok {
+		return ext
+	}
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return ""
+}
+
+// unixMtimeAttr reports the permanode mtime recorded in pnMeta's
+// "unixMtime" attribute (the same attribute "pk-put file" sets
+// alongside unixPermission/unixOwner/unixGroup), for a file whose own
+// schema blob has no embedded time. ok is false if pnMeta has no such
+// attribute, or its value doesn't parse as a time.
+func unixMtimeAttr(pnMeta *search.DescribedBlob) (_ time.Time, ok bool) {
+	if pnMeta == nil || pnMeta.Permanode == nil {
+		return time.Time{}, false
+	}
+	raw := pnMeta.Permanode.Attr.Get("unixMtime")
+	if raw == "" {
+		return time.Time{}, false
+	}
+	mt, err := types.ParseTime3339(raw)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return mt.Time(), true
+}
+
+// numericNameCollision derives a display name that isn't already in
+// seen, by suffixing name's stem with " (2)", " (3)", and so on,
+// skipping any number already taken, matching the convention most
+// desktop file managers use for a copy-and-paste collision.
+func numericNameCollision(name string, seen map[string]bool) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if !seen[candidate] {
+			return candidate
+		}
+	}
+}
+
+// fileOrDirEntry builds the Entry for a permanode (pn, with describe
+// meta pnMeta) whose camliContent (ccMeta) resolved to a file,
+// directory, or static set, assigning it a unique name via seen.
+// imgMeta is the describe meta of the permanode's camliContentImage,
+// if it has one, carried through so pkg/fs can expose its
+// width/height/capture time without an extra query; it's unrelated to
+// whether ccMeta resolves. ok is false if ccMeta isn't any of those
+// after all (e.g. it's some other schema blob), in which case there's
+// nothing to list.
+//
+// nameAttr, if non-empty, is a permanode attribute (e.g. "title")
+// whose value, if present on pnMeta, is used for Name instead of
+// whatever the switch below derives from ccMeta's own filename.
+//
+// specialPolicy governs what happens when ccMeta isn't any of those
+// after all: SpecialContentRepresent gives specialEntry a chance to
+// represent it as a unix-special file first; see its own doc comment.
+func fileOrDirEntry(pn blob.Ref, pnMeta, ccMeta, imgMeta *search.DescribedBlob, seen map[string]bool, nameAttr string, titleAttrAliases []string, specialPolicy SpecialContentPolicy) (_ Entry, ok bool) {
+	var name, symlinkTarget string
+	isSymlink := false
+	modTime := time.Now()
+	switch {
+	case ccMeta.File != nil:
+		name = ccMeta.File.FileName
+		if mt := ccMeta.File.Time; !mt.IsAnyZero() {
+			modTime = mt.Time()
+		} else if mt, ok := unixMtimeAttr(pnMeta); ok {
+			// Many imports (e.g. "pk-put file" on a tree without EXIF or
+			// other embedded timestamps) have no file schema time at
+			// all, but still record the original mtime as a permanode
+			// attribute; prefer that over the time the import happened
+			// to run at.
+			modTime = mt
+		}
+	case ccMeta.Dir != nil:
+		name = ccMeta.Dir.FileName
+		if mt := ccMeta.Dir.Time; !mt.IsAnyZero() {
+			modTime = mt.Time()
+		} else if pnMeta != nil && pnMeta.Permanode != nil && pnMeta.Permanode.ModTime != nil {
+			modTime = pnMeta.Permanode.ModTime.Time()
+		}
+	case ccMeta.Symlink != nil:
+		// A symlink's target isn't verified here; a dangling or even
+		// empty one still produces a node, the same way a real
+		// dangling symlink on disk still shows up in a listing.
+		name = ccMeta.Symlink.FileName
+		isSymlink = true
+		symlinkTarget = ccMeta.Symlink.Target
+		if pnMeta != nil && pnMeta.Permanode != nil && pnMeta.Permanode.ModTime != nil {
+			modTime = pnMeta.Permanode.ModTime.Time()
+		}
+	case ccMeta.StaticSet != nil:
+		// A static-set schema blob has no filename of its own; name
+		// stays "" here and falls into the content-hash fallback below,
+		// the same as a File or Dir with no stored name. pkg/fs browses
+		// it the same way it browses ccMeta.Dir, just listing the set's
+		// members by their own blobrefs instead of named entries; see
+		// pkg/fs's staticSetDir.
+		if pnMeta != nil && pnMeta.Permanode != nil && pnMeta.Permanode.ModTime != nil {
+			modTime = pnMeta.Permanode.ModTime.Time()
+		}
+	default:
+		if specialPolicy == SpecialContentRepresent {
+			if e, ok := specialEntry(pn, pnMeta, ccMeta.BlobRef, seen); ok {
+				return e, true
+			}
+		}
+		return Entry{}, false
+	}
+	if pnMeta != nil && pnMeta.Permanode != nil {
+		if title, attr, ok := firstAttrValue(pnMeta.Permanode.Attr, nameAttr, titleAttrAliases); ok {
+			if attr != nameAttr {
+				Logger.Printf("dir: permanode %v: title resolved via alias attribute %q instead of %q", pn, attr, nameAttr)
+			}
+			name = title
+		}
+	}
+	switch {
+	case name == "":
+		// No stored filename at all (a static set, or a File/Dir
+		// schema that never recorded one): there's nothing to
+		// disambiguate from, so name it after its own content hash
+		// instead.
+		ext := filepath.Ext(name)
+		if ext == "" && ccMeta.File != nil {
+			ext = extensionForMIME(ccMeta.File.MIMEType)
+		}
+		base := strings.TrimPrefix(ccMeta.BlobRef.String(), ccMeta.BlobRef.HashName()+"-")[:10]
+		name = base + ext
+		// The content-hash fallback above is itself occasionally already
+		// taken (e.g. two permanodes pointing at resized copies of the
+		// same file, or two plain collisions landing on the same
+		// truncated hash), so it gets the same numeric disambiguation
+		// savedSearches and searchMemberDir.resolve give a colliding
+		// title, instead of dropping the entry outright: no matching
+		// permanode should ever go missing from a listing just because
+		// it had no stored filename.
+		for i := 2; seen[name]; i++ {
+			name = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+	case seen[name]:
+		// A real stored filename that collides with one already seen
+		// this resolution: disambiguate it the way most file managers
+		// do, by appending " (2)", " (3)", ... to the original name
+		// (respecting its extension), rather than replacing it
+		// outright with an opaque content-hash name. Deterministic
+		// within one resolution since it only depends on seen, which
+		// this same function populates in encounter order.
+		name = numericNameCollision(name, seen)
+	}
+	seen[name] = true
+	return Entry{
+		Name:          name,
+		Blob:          ccMeta,
+		Permanode:     pn,
+		PNodeMeta:     pnMeta,
+		Image:         imgMeta,
+		ModTime:       modTime,
+		IsSymlink:     isSymlink,
+		SymlinkTarget: symlinkTarget,
+	}, true
+}
+
+// setEntry builds the Entry for a permanode (pn, with describe meta
+// pnMeta) that's a collection: it has camliMember values instead of a
+// camliContent. Its members aren't resolved here; see
+// pkg/fs's searchMemberDir, which calls ResolveMember on each one
+// lazily, as it's listed or looked up. truncated is carried straight
+// through to Entry.MembersTruncated; see capMembers.
+func setEntry(pn blob.Ref, pnMeta *search.DescribedBlob, members []string, truncated bool, seen map[string]bool) Entry {
+	name := pnMeta.Permanode.Attr.Get("title")
+	if name == "" || seen[name] {
+		name = strings.TrimPrefix(pn.String(), pn.HashName()+"-")[:10]
+	}
+	seen[name] = true
+	var memberRefs []blob.Ref
+	for _, m := range members {
+		if mr, ok := blob.Parse(m); ok {
+			memberRefs = append(memberRefs, mr)
+		}
+	}
+	return Entry{Name: name, Permanode: pn, PNodeMeta: pnMeta, ModTime: time.Now(), IsSet: true, Members: memberRefs, MembersTruncated: truncated}
+}
+
+// capMembers truncates members, a set permanode pn's raw camliMember
+// attribute values, to at most maxInlineMembers entries, logging the
+// cut so it's visible why a large collection only lists some of its
+// members until opened. maxInlineMembers <= 0 (every caller predating
+// this option) leaves members alone.
+func capMembers(pn blob.Ref, members []string, maxInlineMembers int) (capped []string, truncated bool) {
+	if maxInlineMembers <= 0 || len(members) <= maxInlineMembers {
+		return members, false
+	}
+	Logger.Printf("dir: permanode %v has %d members; capping the inline describe to %d and resolving the rest lazily", pn, len(members), maxInlineMembers)
+	return members[:maxInlineMembers], true
+}
+
+// contentlessEntry builds the Entry resolvePage returns for a
+// permanode with neither a camliContent nor a camliMember attribute,
+// when the caller asked for includeContentless; named the same way
+// setEntry names an untitled set, falling back to unixMtimeAttr (see
+// pkg/fs's applyUnixAttrs for the analogous fallback on a file) before
+// giving up and using time.Now(), since such a permanode has no
+// content-derived modtime to fall back to first.
+func contentlessEntry(pn blob.Ref, pnMeta *search.DescribedBlob, seen map[string]bool) Entry {
+	name := pnMeta.Permanode.Attr.Get("title")
+	if name == "" || seen[name] {
+		name = strings.TrimPrefix(pn.String(), pn.HashName()+"-")[:10]
+	}
+	seen[name] = true
+	modTime := time.Now()
+	if mt, ok := unixMtimeAttr(pnMeta); ok {
+		modTime = mt
+	}
+	return Entry{Name: name, Permanode: pn, PNodeMeta: pnMeta, ModTime: modTime, IsContentless: true}
+}
+
+// placeholderEntry builds the Entry resolvePage returns in place of a
+// camliContent it couldn't resolve to a file, directory, or symlink,
+// when policy is UndescribedContentPlaceholder: a zero-byte stub
+// named after cc's own blobref, since there's no file or dir schema
+// to name it from, so the entry stays visible in the listing rather
+// than vanishing the way UndescribedContentSkip leaves it.
+func placeholderEntry(pn blob.Ref, pnMeta *search.DescribedBlob, cc blob.Ref, seen map[string]bool) Entry {
+	name := strings.TrimPrefix(cc.String(), cc.HashName()+"-")[:10]
+	for i := 2; seen[name]; i++ {
+		name = fmt.Sprintf("%s-%d", strings.TrimPrefix(cc.String(), cc.HashName()+"-")[:10], i)
+	}
+	seen[name] = true
+	return Entry{Name: name, Permanode: pn, PNodeMeta: pnMeta, ModTime: time.Now(), IsPlaceholder: true}
+}
+
+// specialEntry builds the Entry for a permanode whose camliContent
+// resolved to a schema type fileOrDirEntry doesn't otherwise
+// recognize, when SpecialContentRepresent is in effect and the
+// permanode's own "camliUnixType" attribute names a unix-special file
+// (see Entry.IsSpecial). Named after cc's own blobref, the same way
+// placeholderEntry is, since there's no file or dir schema to name it
+// from. ok is false when camliUnixType is missing or not one of the
+// recognized kinds, in which case there's nothing to represent.
+func specialEntry(pn blob.Ref, pnMeta *search.DescribedBlob, cc blob.Ref, seen map[string]bool) (_ Entry, ok bool) {
+	if pnMeta == nil || pnMeta.Permanode == nil {
+		return Entry{}, false
+	}
+	kind := pnMeta.Permanode.Attr.Get("camliUnixType")
+	switch kind {
+	case "fifo", "socket", "chardev", "blockdev":
+	default:
+		return Entry{}, false
+	}
+	var major, minor int
+	if kind == "chardev" || kind == "blockdev" {
+		fmt.Sscanf(pnMeta.Permanode.Attr.Get("camliUnixDev"), "%d:%d", &major, &minor)
+	}
+	name := strings.TrimPrefix(cc.String(), cc.HashName()+"-")[:10]
+	for i := 2; seen[name]; i++ {
+		name = fmt.Sprintf("%s-%d", strings.TrimPrefix(cc.String(), cc.HashName()+"-")[:10], i)
+	}
+	seen[name] = true
+	return Entry{
+		Name:            name,
+		Permanode:       pn,
+		PNodeMeta:       pnMeta,
+		ModTime:         time.Now(),
+		IsSpecial:       true,
+		SpecialType:     kind,
+		SpecialDevMajor: major,
+		SpecialDevMinor: minor,
+	}, true
+}
@@ -0,0 +1,490 @@
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dir
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"testing"
+
+	"perkeep.org/pkg/blob"
+	"perkeep.org/pkg/search"
+)
+
+// fakeQuerier returns a canned *search.SearchResult from Query,
+// regardless of the request, so a test can exercise resolvePage's
+// handling of a particular response shape without a real server.
+type fakeQuerier struct {
+	res *search.SearchResult
+}
+
+func (q fakeQuerier) Query(ctx context.Context, req *search.SearchQuery) (*search.SearchResult, error) {
+	return q.res, nil
+}
+
+// pagedQuerier serves a fixed sequence of pages keyed by the incoming
+// request's Continue token ("" for the first page), so a test can walk
+// resolvePage across more than one page the way doReaddir does.
+type pagedQuerier struct {
+	pages map[string]*search.SearchResult
+}
+
+func (q pagedQuerier) Query(ctx context.Context, req *search.SearchQuery) (*search.SearchResult, error) {
+	return q.pages[req.Continue], nil
+}
+
+// TestResolvePageNilDescribeMeta covers resolvePage's two distinct
+// degraded-fallback cases: a response with no Describe section at
+// all, and one with a Describe section whose Meta came back nil. Both
+// must hand every blob in the page back as degraded rather than
+// dropping them, since doReaddir's caller retries those directly via
+// fetchSchemaMeta.
+func TestResolvePageNilDescribeMeta(t *testing.T) {
+	ref1 := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	ref2 := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+	blobs := []*search.SearchResultBlob{
+		{Blob: ref1},
+		{Blob: ref2},
+	}
+
+	tests := []struct {
+		name string
+		res  *search.SearchResult
+	}{
+		{
+			name: "nil Describe",
+			res:  &search.SearchResult{Blobs: blobs},
+		},
+		{
+			name: "non-nil Describe, nil Meta",
+			res:  &search.SearchResult{Blobs: blobs, Describe: &search.DescribeResponse{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := fakeQuerier{res: tt.res}
+			ents, _, elided, fallbacks, unresolved, badContent, degraded, _, _, err := resolvePage(
+				context.Background(), q, "is:image", nil, 10, "", map[string]bool{}, 0, nil, search.UnspecifiedSort, "", "", nil, defaultContentHops, false, UndescribedContentSkip, DescribeEmbedded, "", 0, nil, nil, SpecialContentSkip)
+			if err != nil {
+				t.Fatalf("resolvePage() error = %v", err)
+			}
+			if len(ents) != 0 {
+				t.Errorf("ents = %v; want empty", ents)
+			}
+			if elided != 0 || fallbacks != 0 || unresolved != 0 || badContent != nil {
+				t.Errorf("elided, fallbacks, unresolved, badContent = %d, %d, %d, %v; want all zero/nil",
+					elided, fallbacks, unresolved, badContent)
+			}
+			if len(degraded) != len(blobs) {
+				t.Fatalf("degraded = %v; want one entry per blob (%d)", degraded, len(blobs))
+			}
+			if degraded[0] != ref1 || degraded[1] != ref2 {
+				t.Errorf("degraded = %v; want %v", degraded, []blob.Ref{ref1, ref2})
+			}
+		})
+	}
+}
+
+// TestResolvePageDedupesDuplicateBlobrefs covers resolvePage's handling
+// of a server that returns the same blobref more than once in a single
+// page: it must come back exactly once, not once per occurrence, since
+// a caller that resolved it twice would otherwise list the same content
+// under two collision-suffixed names.
+func TestResolvePageDedupesDuplicateBlobrefs(t *testing.T) {
+	ref := blob.MustParse("sha224-3333333333333333333333333333333333333333333333333333333333333333")
+	blobs := []*search.SearchResultBlob{
+		{Blob: ref},
+		{Blob: ref},
+	}
+	q := fakeQuerier{res: &search.SearchResult{Blobs: blobs}}
+
+	_, _, _, _, _, _, degraded, _, _, err := resolvePage(
+		context.Background(), q, "is:image", nil, 10, "", map[string]bool{}, 0, nil, search.UnspecifiedSort, "", "", nil, defaultContentHops, false, UndescribedContentSkip, DescribeEmbedded, "", 0, nil, nil, SpecialContentSkip)
+	if err != nil {
+		t.Fatalf("resolvePage() error = %v", err)
+	}
+	if len(degraded) != 1 || degraded[0] != ref {
+		t.Errorf("degraded = %v; want exactly one entry, %v", degraded, ref)
+	}
+}
+
+// TestNumericNameCollisionAppendsParenNumber checks that three results
+// sharing "name.jpg" resolve, in encounter order, to "name.jpg",
+// "name (2).jpg", "name (3).jpg", the convention most file managers
+// use, instead of an opaque content-hash name.
+func TestNumericNameCollisionAppendsParenNumber(t *testing.T) {
+	seen := map[string]bool{}
+	want := []string{"name.jpg", "name (2).jpg", "name (3).jpg"}
+	for i, w := range want {
+		var got string
+		if i == 0 {
+			got = "name.jpg"
+		} else {
+			got = numericNameCollision("name.jpg", seen)
+		}
+		if got != w {
+			t.Errorf("entry %d = %q; want %q", i, got, w)
+		}
+		seen[got] = true
+	}
+}
+
+// TestNumericNameCollisionSkipsTaken checks that numericNameCollision
+// skips past a number already claimed in seen, rather than always
+// starting at " (2)".
+func TestNumericNameCollisionSkipsTaken(t *testing.T) {
+	seen := map[string]bool{"photo.jpg": true, "photo (2).jpg": true}
+	if got, want := numericNameCollision("photo.jpg", seen), "photo (3).jpg"; got != want {
+		t.Errorf("numericNameCollision() = %q; want %q", got, want)
+	}
+}
+
+// TestResolvePageWalksContinueToken checks resolvePage's pagination
+// contract across three pages: each call's returned "next" token is
+// what the caller is expected to pass back as the following call's
+// continueToken, and every page's own degraded blobs (stood in for
+// resolved entries, since a fully resolved Entry needs a much deeper
+// describe chain than this test is about) must show up exactly once
+// in the caller's accumulated total, the same way doReaddir folds
+// each page into its own ents map.
+func TestResolvePageWalksContinueToken(t *testing.T) {
+	ref1 := blob.MustParse("sha224-1111111111111111111111111111111111111111111111111111111111111111")
+	ref2 := blob.MustParse("sha224-2222222222222222222222222222222222222222222222222222222222222222")
+	ref3 := blob.MustParse("sha224-3333333333333333333333333333333333333333333333333333333333333333")
+
+	q := pagedQuerier{pages: map[string]*search.SearchResult{
+		"":      {Blobs: []*search.SearchResultBlob{{Blob: ref1}}, Continue: "page2"},
+		"page2": {Blobs: []*search.SearchResultBlob{{Blob: ref2}}, Continue: "page3"},
+		"page3": {Blobs: []*search.SearchResultBlob{{Blob: ref3}}, Continue: ""},
+	}}
+
+	var allDegraded []blob.Ref
+	seen := make(map[string]bool)
+	cont := ""
+	for pages := 0; ; pages++ {
+		if pages > 2 {
+			t.Fatalf("resolvePage kept paginating past the canned 3 pages")
+		}
+		_, next, _, _, _, _, degraded, _, _, err := resolvePage(
+			context.Background(), q, "is:image", nil, 10, cont, seen, 0, nil, search.UnspecifiedSort, "", "", nil, defaultContentHops, false, UndescribedContentSkip, DescribeEmbedded, "", 0, nil, nil, SpecialContentSkip)
+		if err != nil {
+			t.Fatalf("resolvePage() error = %v", err)
+		}
+		allDegraded = append(allDegraded, degraded...)
+		if next == "" {
+			break
+		}
+		cont = next
+	}
+
+	want := []blob.Ref{ref1, ref2, ref3}
+	if len(allDegraded) != len(want) {
+		t.Fatalf("collected %v; want one entry per page, %v", allDegraded, want)
+	}
+	for i, w := range want {
+		if allDegraded[i] != w {
+			t.Errorf("entry %d = %v; want %v", i, allDegraded[i], w)
+		}
+	}
+}
+
+// ruleAwareQuerier serves a permanode whose content lives under a
+// custom "appContent" attribute instead of "camliContent", only
+// including the target file's own describe meta in the response when
+// the incoming request's rules actually asked for "appContent" to be
+// expanded, the same way the real server only expands the attrs a
+// DescribeRule.Attrs lists.
+type ruleAwareQuerier struct {
+	pn, fileRef blob.Ref
+}
+
+func (q ruleAwareQuerier) Query(ctx context.Context, req *search.SearchQuery) (*search.SearchResult, error) {
+	meta := search.MetaMap{
+		q.pn: {
+			BlobRef:   q.pn,
+			Permanode: &search.Permanode{Attr: url.Values{"appContent": []string{q.fileRef.String()}}},
+		},
+	}
+	for _, rule := range req.Describe.Rules {
+		for _, attr := range rule.Attrs {
+			if attr == "appContent" {
+				meta[q.fileRef] = &search.DescribedBlob{BlobRef: q.fileRef, File: &search.DescribedFile{FileName: "photo.jpg"}}
+			}
+		}
+	}
+	return &search.SearchResult{
+		Blobs:    []*search.SearchResultBlob{{Blob: q.pn}},
+		Describe: &search.DescribeResponse{Meta: meta},
+	}, nil
+}
+
+// TestResolvePageCustomRuleResolvesNonStandardContentAttr checks that a
+// permanode whose content pointer lives under a custom attr, rather
+// than camliContent, is skipped when the explicit describe rules in
+// effect don't expand that attr, and listed once they do: the
+// scenario CamliFileSystem.DescribeRules/DescribeExtraAttrs exist to
+// let a caller fix, without pkg/fs needing any schema-specific
+// knowledge of its own. Both calls pass explicit, non-nil rules (an
+// explicit copy of DefaultDescribeRules, with or without "appContent"
+// added), rather than relying on resolvePage's own nil-rules
+// auto-merge of contentAttr, since a caller's own DescribeRules
+// replaces that default outright; see DefaultDescribeRules's doc
+// comment and ResolvePage's contentAttr and rules parameters.
+func TestResolvePageCustomRuleResolvesNonStandardContentAttr(t *testing.T) {
+	pn := blob.MustParse("sha224-4444444444444444444444444444444444444444444444444444444444444444")
+	fileRef := blob.MustParse("sha224-5555555555555555555555555555555555555555555555555555555555555555")
+	q := ruleAwareQuerier{pn: pn, fileRef: fileRef}
+
+	plainRules := []*search.DescribeRule{{Attrs: append([]string{}, DefaultDescribeRules[0].Attrs...)}}
+	ents, _, _, _, unresolved, _, _, _, _, err := resolvePage(
+		context.Background(), q, "is:image", nil, 10, "", map[string]bool{}, 0, plainRules, search.UnspecifiedSort, "", "", nil, defaultContentHops, false, UndescribedContentSkip, DescribeEmbedded, "appContent", 0, nil, nil, SpecialContentSkip)
+	if err != nil {
+		t.Fatalf("resolvePage() with plainRules error = %v", err)
+	}
+	if len(ents) != 0 {
+		t.Errorf("ents with plainRules = %v; want none, since appContent isn't expanded", ents)
+	}
+	if unresolved != 1 {
+		t.Errorf("unresolved with plainRules = %d; want 1", unresolved)
+	}
+
+	extendedRules := []*search.DescribeRule{{Attrs: append(append([]string{}, DefaultDescribeRules[0].Attrs...), "appContent")}}
+	ents, _, _, _, unresolved, _, _, _, _, err = resolvePage(
+		context.Background(), q, "is:image", nil, 10, "", map[string]bool{}, 0, extendedRules, search.UnspecifiedSort, "", "", nil, defaultContentHops, false, UndescribedContentSkip, DescribeEmbedded, "appContent", 0, nil, nil, SpecialContentSkip)
+	if err != nil {
+		t.Fatalf("resolvePage() with extendedRules error = %v", err)
+	}
+	if len(ents) != 1 {
+		t.Fatalf("ents with extendedRules = %v; want exactly one entry", ents)
+	}
+	if ents[0].Name != "photo.jpg" {
+		t.Errorf("ents[0].Name = %q; want %q", ents[0].Name, "photo.jpg")
+	}
+	if unresolved != 0 {
+		t.Errorf("unresolved with extendedRules = %d; want 0", unresolved)
+	}
+}
+
+// TestSkipSummary checks skipSummary's rendering: each reason with a
+// non-zero count, in skipReasons order, separated by ", ", nothing at
+// all for an empty or nil counts map.
+func TestSkipSummary(t *testing.T) {
+	tests := []struct {
+		counts map[skipReason]int
+		want   string
+	}{
+		{nil, ""},
+		{map[skipReason]int{skipDuplicate: 2}, "2 duplicate"},
+		{map[skipReason]int{skipNoMeta: 3, skipNoPermanode: 2}, "3 no describe meta, 2 no permanode"},
+		{map[skipReason]int{skipDuplicate: 1, skipNoMeta: 3, skipNoPermanode: 2}, "1 duplicate, 3 no describe meta, 2 no permanode"},
+	}
+	for _, tt := range tests {
+		if got := skipSummary(tt.counts); got != tt.want {
+			t.Errorf("skipSummary(%v) = %q; want %q", tt.counts, got, tt.want)
+		}
+	}
+}
+
+// TestResolvePageSkipSummaryCounts checks that a page mixing a
+// duplicate blobref, a blobref with no describe meta at all, and one
+// with meta but no Permanode produces exactly one Logger line, with
+// an accurate per-reason count, rather than one line per skipped
+// blob.
+func TestResolvePageSkipSummaryCounts(t *testing.T) {
+	var buf bytes.Buffer
+	orig := Logger
+	Logger = log.New(&buf, "", 0)
+	defer func() { Logger = orig }()
+
+	ref1 := blob.MustParse("sha224-6666666666666666666666666666666666666666666666666666666666666666")
+	ref2 := blob.MustParse("sha224-7777777777777777777777777777777777777777777777777777777777777777")
+	ref3 := blob.MustParse("sha224-8888888888888888888888888888888888888888888888888888888888888888")
+
+	meta := search.MetaMap{
+		ref1: {BlobRef: ref1, Permanode: &search.Permanode{Attr: url.Values{}}},
+		ref3: {BlobRef: ref3},
+	}
+	res := &search.SearchResult{
+		Blobs:    []*search.SearchResultBlob{{Blob: ref1}, {Blob: ref1}, {Blob: ref2}, {Blob: ref3}},
+		Describe: &search.DescribeResponse{Meta: meta},
+	}
+	q := fakeQuerier{res: res}
+
+	_, _, _, _, _, _, _, _, _, err := resolvePage(
+		context.Background(), q, "is:image", nil, 10, "", map[string]bool{}, 0, nil, search.UnspecifiedSort, "", "", nil, defaultContentHops, false, UndescribedContentSkip, DescribeEmbedded, "", 0, nil, nil, SpecialContentSkip)
+	if err != nil {
+		t.Fatalf("resolvePage() error = %v", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{"skipped 3 blob(s)", "1 duplicate", "1 no describe meta", "1 no permanode"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log output = %q; want it to contain %q", got, want)
+		}
+	}
+	if n := strings.Count(got, "\n"); n != 1 {
+		t.Errorf("log output had %d line(s); want exactly 1, one summary line rather than one per skipped blob", n)
+	}
+}
+
+// TestResolvePageMissingMetaDegradesOnlyThatBlob checks that when the
+// server's Describe response is missing meta for some, but not all, of
+// a page's blobs, the blobs it did describe still come back as normal
+// Entries, and the ones it left out come back via degraded rather than
+// being silently dropped — a partial describe failure should yield a
+// partial, not empty, result.
+func TestResolvePageMissingMetaDegradesOnlyThatBlob(t *testing.T) {
+	described := blob.MustParse("sha224-9999999999999999999999999999999999999999999999999999999999999999")
+	missing := blob.MustParse("sha224-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	res := &search.SearchResult{
+		Blobs: []*search.SearchResultBlob{{Blob: described}, {Blob: missing}},
+		Describe: &search.DescribeResponse{Meta: search.MetaMap{
+			described: {BlobRef: described, Permanode: &search.Permanode{Attr: url.Values{}}},
+		}},
+	}
+	q := fakeQuerier{res: res}
+
+	ents, _, _, _, _, _, degraded, _, _, err := resolvePage(
+		context.Background(), q, "is:image", nil, 10, "", map[string]bool{}, 0, nil, search.UnspecifiedSort, "", "", nil, defaultContentHops, true, UndescribedContentSkip, DescribeEmbedded, "", 0, nil, nil, SpecialContentSkip)
+	if err != nil {
+		t.Fatalf("resolvePage() error = %v", err)
+	}
+	if len(ents) != 1 || ents[0].Permanode != described {
+		t.Errorf("ents = %v; want exactly one entry, for %v", ents, described)
+	}
+	if len(degraded) != 1 || degraded[0] != missing {
+		t.Errorf("degraded = %v; want exactly [%v], so the caller can still try to resolve it directly", degraded, missing)
+	}
+}
+
+// TestResolvePageFollowsContentIndirectionChain checks that a
+// permanode whose camliContent points at another permanode, which in
+// turn points at a file, resolves all the way through to that file
+// within defaultContentHops (see followContentIndirection), rather
+// than being skipped as unresolved the way it would be with zero hops
+// of budget.
+func TestResolvePageFollowsContentIndirectionChain(t *testing.T) {
+	pn := blob.MustParse("sha224-6666666666666666666666666666666666666666666666666666666666666666")
+	midPn := blob.MustParse("sha224-7777777777777777777777777777777777777777777777777777777777777777")
+	fileRef := blob.MustParse("sha224-8888888888888888888888888888888888888888888888888888888888888888")
+
+	res := &search.SearchResult{
+		Blobs: []*search.SearchResultBlob{{Blob: pn}},
+		Describe: &search.DescribeResponse{Meta: search.MetaMap{
+			pn: {
+				BlobRef:   pn,
+				Permanode: &search.Permanode{Attr: url.Values{"camliContent": []string{midPn.String()}}},
+			},
+			midPn: {
+				BlobRef:   midPn,
+				Permanode: &search.Permanode{Attr: url.Values{"camliContent": []string{fileRef.String()}}},
+			},
+			fileRef: {BlobRef: fileRef, File: &search.DescribedFile{FileName: "photo.jpg"}},
+		}},
+	}
+	q := fakeQuerier{res: res}
+
+	ents, _, _, _, unresolved, _, _, _, _, err := resolvePage(
+		context.Background(), q, "is:image", nil, 10, "", map[string]bool{}, 0, nil, search.UnspecifiedSort, "", "", nil, defaultContentHops, false, UndescribedContentSkip, DescribeEmbedded, "", 0, nil, nil, SpecialContentSkip)
+	if err != nil {
+		t.Fatalf("resolvePage() error = %v", err)
+	}
+	if len(ents) != 1 {
+		t.Fatalf("ents = %v; want exactly one entry, for the file at the end of the chain", ents)
+	}
+	if ents[0].Name != "photo.jpg" {
+		t.Errorf("ents[0].Name = %q; want %q", ents[0].Name, "photo.jpg")
+	}
+	if unresolved != 0 {
+		t.Errorf("unresolved = %d; want 0", unresolved)
+	}
+}
+
+// countingDescriber serves Describe from a fixed blobref table,
+// counting how many calls it actually served, so a test can verify
+// that a cache hit against an already-fetched Meta union really did
+// skip the network round trip it claims to, rather than just
+// happening to return the right answer anyway.
+type countingDescriber struct {
+	calls int
+	table map[blob.Ref]*search.DescribedBlob
+}
+
+func (d *countingDescriber) Describe(ctx context.Context, req *search.DescribeRequest) (*search.DescribeResponse, error) {
+	d.calls++
+	meta := search.MetaMap{}
+	m, ok := d.table[req.BlobRef]
+	if !ok {
+		return &search.DescribeResponse{Meta: meta}, nil
+	}
+	meta[req.BlobRef] = m
+	if m.Permanode != nil {
+		if cc, ok := blob.Parse(m.Permanode.Attr.Get("camliContent")); ok {
+			if fm, ok := d.table[cc]; ok {
+				meta[cc] = fm
+			}
+		}
+	}
+	return &search.DescribeResponse{Meta: meta}, nil
+}
+
+// TestResolveMemberFromMetaReusesParentDescribe checks that walking
+// two levels into a nested set (A, then its member B) reuses the Meta
+// union a single top-level describe already returned instead of
+// describing either one again, and that only the third level (C, a
+// member of B the top-level describe never reached) costs a real
+// describe call.
+func TestResolveMemberFromMetaReusesParentDescribe(t *testing.T) {
+	a := blob.MustParse("sha224-" + strings.Repeat("a", 56))
+	b := blob.MustParse("sha224-" + strings.Repeat("b", 56))
+	c := blob.MustParse("sha224-" + strings.Repeat("c", 56))
+	f := blob.MustParse("sha224-" + strings.Repeat("f", 56))
+
+	rootMeta := search.MetaMap{
+		a: {BlobRef: a, Permanode: &search.Permanode{Attr: url.Values{"camliMember": {b.String()}}}},
+		b: {BlobRef: b, Permanode: &search.Permanode{Attr: url.Values{"camliMember": {c.String()}}}},
+	}
+	root := Entry{Permanode: a, Members: []blob.Ref{b}, IsSet: true, Meta: rootMeta}
+
+	d := &countingDescriber{table: map[blob.Ref]*search.DescribedBlob{
+		c: {BlobRef: c, Permanode: &search.Permanode{Attr: url.Values{"camliContent": {f.String()}}}},
+		f: {BlobRef: f, File: &search.DescribedFile{FileName: "c.txt"}},
+	}}
+
+	bEntry, ok, covered := ResolveMemberFromMeta(b, root.Meta)
+	if !covered || !ok || !bEntry.IsSet {
+		t.Fatalf("ResolveMemberFromMeta(b) = %+v, ok=%v, covered=%v; want a covered set entry", bEntry, ok, covered)
+	}
+	if d.calls != 0 {
+		t.Fatalf("resolving b cost %d describe call(s); want 0 (covered by the root's own Meta)", d.calls)
+	}
+
+	if _, _, covered := ResolveMemberFromMeta(c, bEntry.Meta); covered {
+		t.Fatalf("ResolveMemberFromMeta(c) reported covered; the root's Meta never described c")
+	}
+	cEntry, ok, err := ResolveMember(context.Background(), d, c, nil)
+	if err != nil || !ok {
+		t.Fatalf("ResolveMember(c) = %+v, %v, %v", cEntry, ok, err)
+	}
+	if d.calls != 1 {
+		t.Errorf("resolving c cost %d describe call(s); want exactly 1", d.calls)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webdav adapts Perkeep's "search expression as a directory"
+// convention (see pkg/search/dir) to golang.org/x/net/webdav.FileSystem,
+// so that Windows/macOS Finder clients and mobile apps can browse
+// search results without mounting FUSE. It is the non-FUSE sibling of
+// pkg/fs's search directory: both build their listings with
+// pkg/search/dir, so future frontends (SFTP, S3) can plug in the same
+// way.
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"perkeep.org/pkg/client"
+	"perkeep.org/pkg/schema"
+	"perkeep.org/pkg/search/dir"
+)
+
+// Logger is where the package logs debug information. It defaults to
+// discarding output.
+var Logger = log.New(io.Discard, "webdav: ", log.LstdFlags)
+
+// FileSystem implements webdav.FileSystem over Perkeep search
+// results. Paths look like "/<expr>/<filename>", where <expr> is a
+// Perkeep search expression and <filename> is one of the names that
+// expression's directory listing produces.
+type FileSystem struct {
+	Client *client.Client
+}
+
+var _ webdav.FileSystem = (*FileSystem)(nil)
+
+// splitPath splits a clean, slash-separated WebDAV path into its
+// search expression and, if present, the filename within that
+// expression's results.
+func splitPath(name string) (expr, filename string) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "", ""
+	}
+	i := strings.IndexByte(name, '/')
+	if i < 0 {
+		return name, ""
+	}
+	return name[:i], name[i+1:]
+}
+
+func (fsys *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	expr, filename := splitPath(name)
+	if expr == "" || filename != "" {
+		return os.ErrInvalid
+	}
+	// A directory at the top level is a saved search: create a
+	// permanode recording the expression, the same way the web UI's
+	// "save search" button does.
+	pr, err := fsys.Client.UploadNewPermanode(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = fsys.Client.UploadAndSignBlob(ctx, schema.NewSetAttributeClaim(pr.BlobRef, "camliContentSearch", expr))
+	return err
+}
+
+func (fsys *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	// Removing a search directory doesn't delete anything it
+	// describes; it's not a saved search unless it was Mkdir'd.
+	return nil
+}
+
+func (fsys *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (fsys *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	expr, filename := splitPath(name)
+	if expr == "" {
+		return dirInfo{name: "/"}, nil
+	}
+	if filename == "" {
+		return dirInfo{name: expr}, nil
+	}
+	ent, err := fsys.lookup(ctx, expr, filename)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{ent: ent}, nil
+}
+
+func (fsys *FileSystem) lookup(ctx context.Context, expr, filename string) (*dir.Entry, error) {
+	ents, err := dir.Resolve(ctx, fsys.Client, expr, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, ent := range ents {
+		if ent.Name == filename {
+			return &ents[i], nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// OpenFile opens name for reading. Writing (O_CREATE, O_WRONLY,
+// O_RDWR) isn't supported; Perkeep files are written by uploading
+// blobs, not by streaming into an existing path.
+func (fsys *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE) != 0 {
+		return nil, os.ErrPermission
+	}
+	expr, filename := splitPath(name)
+	if filename == "" {
+		ents, err := dir.Resolve(ctx, fsys.Client, expr, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &dirHandle{name: name, ents: ents}, nil
+	}
+	ent, err := fsys.lookup(ctx, expr, filename)
+	if err != nil {
+		return nil, err
+	}
+	blobContent, err := fsys.Client.FetchSchemaBlob(ctx, ent.Blob.BlobRef)
+	if err != nil {
+		Logger.Printf("fetchSchemaMeta(%v): %v", ent.Blob.BlobRef, err)
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fr, err := schema.NewFileReader(ctx, fsys.Client, blobContent.BlobRef())
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+	if _, err := io.Copy(&buf, fr); err != nil {
+		return nil, err
+	}
+	return &fileHandle{
+		info:   fileInfo{ent: ent},
+		Reader: bytes.NewReader(buf.Bytes()),
+	}, nil
+}
+
+// dirInfo implements os.FileInfo for a search-expression directory.
+type dirInfo struct {
+	name string
+}
+
+func (d dirInfo) Name() string       { return path.Base(d.name) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
+
+// fileInfo implements os.FileInfo for a single search result.
+type fileInfo struct {
+	ent *dir.Entry
+}
+
+func (f fileInfo) Name() string { return f.ent.Name }
+func (f fileInfo) Size() int64 {
+	if f.ent.Blob.File != nil {
+		return f.ent.Blob.File.Size
+	}
+	return 0
+}
+func (f fileInfo) Mode() os.FileMode  { return 0444 }
+func (f fileInfo) ModTime() time.Time { return f.ent.ModTime }
+func (f fileInfo) IsDir() bool        { return false }
+func (f fileInfo) Sys() interface{}   { return nil }
+
+// dirHandle implements webdav.File for ReadDir/Readdir over a search
+// expression's results.
+type dirHandle struct {
+	name string
+	ents []dir.Entry
+}
+
+func (d *dirHandle) Close() error                                 { return nil }
+func (d *dirHandle) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (d *dirHandle) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (d *dirHandle) Stat() (os.FileInfo, error)                   { return dirInfo{name: d.name}, nil }
+func (d *dirHandle) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+
+func (d *dirHandle) Readdir(count int) ([]os.FileInfo, error) {
+	infos := make([]os.FileInfo, 0, len(d.ents))
+	for i := range d.ents {
+		infos = append(infos, fileInfo{ent: &d.ents[i]})
+	}
+	return infos, nil
+}
+
+// fileHandle implements webdav.File for a single search result's
+// content, fetched in full from the blob server.
+type fileHandle struct {
+	info fileInfo
+	*bytes.Reader
+}
+
+func (f *fileHandle) Close() error                        { return nil }
+func (f *fileHandle) Write(p []byte) (int, error)         { return 0, os.ErrPermission }
+func (f *fileHandle) Stat() (os.FileInfo, error)          { return f.info, nil }
+func (f *fileHandle) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+// RegisterOnMux registers the search-as-directory WebDAV gateway on
+// mux at prefix (e.g. "/webdav/search/"), the way camlistored wires up
+// its other handlers. authorized should reject anything that wouldn't
+// otherwise be allowed to reach the Perkeep search handler; camlistored
+// is expected to pass the same auth check it uses for its other
+// handlers rather than a bespoke one for WebDAV.
+//
+// This tree has no camlistored main package to call RegisterOnMux from
+// yet, so it's still unreferenced outside this package's tests; once
+// camlistored's handler setup exists, registering this gateway is this
+// one call.
+func RegisterOnMux(mux *http.ServeMux, prefix string, cl *client.Client, authorized func(*http.Request) bool) {
+	mux.Handle(prefix, NewHandler(cl, prefix, authorized))
+}
+
+// NewHandler returns an http.Handler serving the search-as-directory
+// WebDAV gateway for cl, suitable for mounting at a prefix such as
+// "/webdav/search/" (see RegisterOnMux). authorized is consulted for
+// every request and should reject anything that wouldn't otherwise be
+// allowed to reach the Perkeep search handler.
+func NewHandler(cl *client.Client, prefix string, authorized func(*http.Request) bool) http.Handler {
+	wh := &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: &FileSystem{Client: cl},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				Logger.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		wh.ServeHTTP(w, r)
+	})
+}
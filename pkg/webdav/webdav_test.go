@@ -0,0 +1,61 @@
+/*
+Copyright 2016 The Perkeep Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webdav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRegisterOnMux is a regression test for the missing piece a
+// server needs to actually expose this gateway: registering it on a
+// *http.ServeMux at a prefix, and consulting authorized before any
+// request reaches the underlying webdav.Handler.
+func TestRegisterOnMux(t *testing.T) {
+	var authorizedCalls int
+	authorized := func(r *http.Request) bool {
+		authorizedCalls++
+		return false
+	}
+
+	mux := http.NewServeMux()
+	RegisterOnMux(mux, "/webdav/search/", nil, authorized)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/webdav/search/is:image/", nil)
+	mux.ServeHTTP(rec, req)
+
+	if authorizedCalls != 1 {
+		t.Errorf("authorized called %d times; want 1", authorizedCalls)
+	}
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// A path outside the registered prefix shouldn't reach our handler
+	// at all, so authorized shouldn't be consulted for it.
+	rec2 := httptest.NewRecorder()
+	req2 := httptest.NewRequest("GET", "/other/", nil)
+	mux.ServeHTTP(rec2, req2)
+	if authorizedCalls != 1 {
+		t.Errorf("authorized called %d times after unrelated request; want still 1", authorizedCalls)
+	}
+	if rec2.Code != http.StatusNotFound {
+		t.Errorf("status for unrelated path = %d; want %d", rec2.Code, http.StatusNotFound)
+	}
+}